@@ -0,0 +1,493 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// ynobot load tests a server with headless bots.
+//
+// Each bot opens a session and a room socket like a real client, signs its
+// room messages and random walks around one of the given maps, optionally
+// chatting, showing pictures and playing sounds. Movement latency is measured
+// from a bot sending a move to the other bots in the room receiving it, so
+// bots need to share maps for latency to be reported. Bots connect from their
+// own address through X-Forwarded-For, which the server only honors over tcp
+// when the host running ynobot is in trusted_proxies.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/ynoproject/ynoserver/server/protocol"
+	"github.com/ynoproject/ynoserver/server/security"
+)
+
+const (
+	delim  = "\uffff"
+	mdelim = "\ufffe"
+
+	// moves nobody received within this long are forgotten
+	moveExpiry = 10 * time.Second
+)
+
+var (
+	addr     = flag.String("addr", "ws://127.0.0.1:8028", "base websocket URL of the server")
+	keyPath  = flag.String("key", "key.bin", "ring key to sign room messages with")
+	keyId    = flag.Uint("keyid", 0, "id of the ring key in the server's key ring")
+	botCount = flag.Int("bots", 50, "number of bots")
+	mapList  = flag.String("maps", "1", "comma separated maps to spread the bots over")
+	duration = flag.Duration("duration", time.Minute, "how long to run for")
+	rampUp   = flag.Duration("ramp", 10*time.Second, "time to spread connecting the bots over")
+	step     = flag.Duration("step", 250*time.Millisecond, "time between moves")
+	area     = flag.Int("area", 20, "size of the square in the top left of the map the bots walk in")
+	useV2    = flag.Bool("v2", false, "use the binary room protocol")
+
+	system      = flag.String("system", "", "system graphic to set, needed for chat")
+	chatRate    = flag.Float64("chat", 0, "chat messages per bot per minute")
+	picture     = flag.String("picture", "", "picture to show")
+	pictureRate = flag.Float64("pictures", 0, "pictures shown per bot per minute")
+	sound       = flag.String("sound", "", "sound effect to play")
+	soundRate   = flag.Float64("sounds", 0, "sound effects per bot per minute")
+)
+
+var stats struct {
+	connected       atomic.Int64
+	connectFailures atomic.Int64
+	disconnects     atomic.Int64
+	sent            atomic.Int64
+	received        atomic.Int64
+
+	// pending moves by "id x y", and the latencies of received ones
+	moves     map[string]time.Time
+	latencies []time.Duration
+	mutex     sync.Mutex
+}
+
+type bot struct {
+	n     int
+	ip    string
+	mapId int
+
+	session *websocket.Conn
+	room    *websocket.Conn
+
+	id      int
+	connKey []byte
+	counter uint32
+
+	x, y int
+}
+
+func main() {
+	flag.Parse()
+
+	key, err := os.ReadFile(*keyPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var maps []int
+	for _, str := range strings.Split(*mapList, ",") {
+		mapId, err := strconv.Atoi(str)
+		if err != nil {
+			log.Fatalf("invalid map: %s", str)
+		}
+
+		maps = append(maps, mapId)
+	}
+
+	stats.moves = make(map[string]time.Time)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	ctx, cancel = context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for n := range *botCount {
+		b := &bot{
+			n:     n,
+			ip:    fmt.Sprintf("10.%d.%d.%d", n>>16&0xff, n>>8&0xff, n&0xff),
+			mapId: maps[n%len(maps)],
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// spread connections over the ramp up time
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(int64(*rampUp) * int64(n) / int64(*botCount))):
+			}
+
+			b.run(ctx, key)
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report()
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	report()
+}
+
+func (b *bot) run(ctx context.Context, key []byte) {
+	if err := b.connect(key); err != nil {
+		stats.connectFailures.Add(1)
+		log.Printf("bot %d: %s", b.n, err)
+		b.close()
+		return
+	}
+
+	stats.connected.Add(1)
+	defer stats.connected.Add(-1)
+
+	defer b.close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go b.read(ctx, cancel, b.session, false)
+	go b.read(ctx, cancel, b.room, *useV2)
+
+	b.x, b.y = rand.IntN(*area), rand.IntN(*area)
+
+	if *system != "" {
+		b.sendRoom("sys", *system)
+	}
+	b.sendRoom("m", strconv.Itoa(b.x), strconv.Itoa(b.y))
+
+	moveTicker := time.NewTicker(*step)
+	defer moveTicker.Stop()
+
+	chat, stopChat := newRateTicker(*chatRate)
+	defer stopChat()
+	pictures, stopPictures := newRateTicker(*pictureRate)
+	defer stopPictures()
+	sounds, stopSounds := newRateTicker(*soundRate)
+	defer stopSounds()
+
+	var showingPicture bool
+
+	for {
+		var err error
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-moveTicker.C:
+			err = b.move()
+		case <-chat:
+			err = b.sendSession("say", fmt.Sprintf("hello from bot %d", b.n))
+		case <-pictures:
+			if showingPicture {
+				err = b.sendRoom("rp", "1")
+			} else {
+				err = b.sendRoom(getShowPictureMsg(*picture)...)
+			}
+			showingPicture = !showingPicture
+		case <-sounds:
+			err = b.sendRoom("se", *sound, "100", "100", "50")
+		}
+
+		if err != nil {
+			stats.disconnects.Add(1)
+			return
+		}
+	}
+}
+
+func (b *bot) connect(key []byte) error {
+	var err error
+
+	b.session, err = b.dial("/session", nil)
+	if err != nil {
+		return err
+	}
+
+	// the room socket needs the session to be registered,
+	// which it is once the session answers messages
+	if err := b.sendSession("i"); err != nil {
+		return err
+	}
+	if _, err := readUntil(b.session, false, "i"); err != nil {
+		return err
+	}
+
+	if err := b.sendSession("name", fmt.Sprintf("bot%d", b.n)); err != nil {
+		return err
+	}
+
+	var subprotocols []string
+	if *useV2 {
+		subprotocols = []string{protocol.Subprotocol}
+	}
+
+	b.room, err = b.dial(fmt.Sprintf("/room?id=%d", b.mapId), subprotocols)
+	if err != nil {
+		return err
+	}
+
+	// the server sends the nonce to derive the signing key from first
+	msgFields, err := readUntil(b.room, *useV2, "s")
+	if err != nil {
+		return err
+	}
+
+	if len(msgFields) < 3 {
+		return errors.New("malformed s message")
+	}
+
+	b.id, err = strconv.Atoi(msgFields[1])
+	if err != nil {
+		return err
+	}
+
+	nonce, err := hex.DecodeString(msgFields[2])
+	if err != nil {
+		return err
+	}
+
+	b.connKey = security.DeriveKey(key, nonce)
+
+	return nil
+}
+
+func (b *bot) dial(path string, subprotocols []string) (*websocket.Conn, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = subprotocols
+
+	conn, _, err := dialer.Dial(*addr+path, http.Header{"X-Forwarded-For": {b.ip}})
+
+	return conn, err
+}
+
+func (b *bot) close() {
+	for _, conn := range []*websocket.Conn{b.room, b.session} {
+		if conn == nil {
+			continue
+		}
+
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		conn.Close()
+	}
+}
+
+// move takes a random step, staying inside the walking area
+func (b *bot) move() error {
+	x, y := b.x, b.y
+	switch rand.IntN(4) {
+	case 0:
+		y--
+	case 1:
+		x++
+	case 2:
+		y++
+	case 3:
+		x--
+	}
+
+	if x < 0 || y < 0 || x >= *area || y >= *area {
+		return nil
+	}
+
+	b.x, b.y = x, y
+
+	stats.mutex.Lock()
+	stats.moves[fmt.Sprintf("%d %d %d", b.id, x, y)] = time.Now()
+	stats.mutex.Unlock()
+
+	return b.sendRoom("m", strconv.Itoa(x), strconv.Itoa(y))
+}
+
+func (b *bot) sendSession(msgFields ...string) error {
+	stats.sent.Add(1)
+
+	return b.session.WriteMessage(websocket.TextMessage, []byte(strings.Join(msgFields, delim)))
+}
+
+func (b *bot) sendRoom(msgFields ...string) error {
+	var payload []byte
+	if *useV2 {
+		payload = protocol.AppendMessage(nil, msgFields)
+	} else {
+		payload = []byte(strings.Join(msgFields, delim))
+	}
+
+	b.counter++
+	stats.sent.Add(1)
+
+	return b.room.WriteMessage(websocket.BinaryMessage, security.Sign(b.connKey, byte(*keyId), b.counter, payload))
+}
+
+func (b *bot) read(ctx context.Context, cancel context.CancelFunc, conn *websocket.Conn, v2 bool) {
+	defer cancel()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() == nil {
+				stats.disconnects.Add(1)
+			}
+			return
+		}
+
+		now := time.Now()
+
+		msgs, err := decodeMessages(message, v2)
+		if err != nil {
+			log.Printf("bot %d: %s", b.n, err)
+		}
+
+		stats.received.Add(int64(len(msgs)))
+
+		for _, msgFields := range msgs {
+			if msgFields[0] != "m" || len(msgFields) != 4 {
+				continue
+			}
+
+			stats.mutex.Lock()
+			if sent, ok := stats.moves[strings.Join(msgFields[1:], " ")]; ok {
+				stats.latencies = append(stats.latencies, now.Sub(sent))
+			}
+			stats.mutex.Unlock()
+		}
+	}
+}
+
+// readUntil reads messages until one of type msgType and returns its fields
+func readUntil(conn *websocket.Conn, v2 bool, msgType string) ([]string, error) {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		msgs, err := decodeMessages(message, v2)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msgFields := range msgs {
+			if msgFields[0] == msgType {
+				return msgFields, nil
+			}
+		}
+	}
+}
+
+func decodeMessages(message []byte, v2 bool) ([][]string, error) {
+	if v2 {
+		return protocol.DecodeMessages(message)
+	}
+
+	var msgs [][]string
+	for _, msg := range strings.Split(string(message), mdelim) {
+		msgs = append(msgs, strings.Split(msg, delim))
+	}
+
+	return msgs, nil
+}
+
+// newRateTicker ticks perMinute times a minute, or never if perMinute is 0
+func newRateTicker(perMinute float64) (<-chan time.Time, func()) {
+	if perMinute <= 0 {
+		return nil, func() {}
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Minute) / perMinute))
+
+	return ticker.C, ticker.Stop
+}
+
+func getShowPictureMsg(name string) []string {
+	return []string{
+		"ap", "1", // picture id
+		"160", "120", "0", "0", "0", "0", // position, map position and pan
+		"100", "0", "0", // magnify, top and bottom transparency
+		"100", "100", "100", "100", // red, green, blue and saturation
+		"0", "0", // effect mode and power
+		name,
+		"1", "0", // transparent color, fixed to map
+		"1", "1", "0", "0", "0", // spritesheet columns, rows, frame, speed and play once
+		"7", "0", "0", "0", // map layer, battle layer, flags and blend mode
+		"0", "0", "0", // flip x, flip y and origin
+	}
+}
+
+func report() {
+	stats.mutex.Lock()
+
+	// forget moves that were received by everyone who was going to
+	expiry := time.Now().Add(-moveExpiry)
+	for key, sent := range stats.moves {
+		if sent.Before(expiry) {
+			delete(stats.moves, key)
+		}
+	}
+
+	latencies := slices.Clone(stats.latencies)
+	stats.mutex.Unlock()
+
+	slices.Sort(latencies)
+
+	log.Printf("connected: %d, connect failures: %d, disconnects: %d, sent: %d, received: %d",
+		stats.connected.Load(), stats.connectFailures.Load(), stats.disconnects.Load(), stats.sent.Load(), stats.received.Load())
+
+	if len(latencies) == 0 {
+		log.Print("move latency: no moves received")
+		return
+	}
+
+	log.Printf("move latency: p50 %s, p90 %s, p99 %s, max %s (%d samples)",
+		getPercentile(latencies, 0.5), getPercentile(latencies, 0.9), getPercentile(latencies, 0.99), latencies[len(latencies)-1], len(latencies))
+}
+
+func getPercentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(p*float64(len(sorted)-1))]
+}
@@ -0,0 +1,304 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// ynoreplay replays traffic recordings against a server, or prints them as a timeline.
+//
+//	ynoreplay [flags] recording.jsonl.gz...
+//
+// Messages the recorded clients sent are sent again by a client per recorded
+// client, with the original timing. Each client connects from its own address
+// through X-Forwarded-For so the server sees them as different players,
+// which it only honors over tcp when the replaying host is in trusted_proxies.
+// Recordings of several rooms and the session recording can be replayed
+// together to follow players between rooms.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/ynoproject/ynoserver/server/recorder"
+	"github.com/ynoproject/ynoserver/server/security"
+)
+
+const (
+	delim  = "\uffff"
+	mdelim = "\ufffe"
+)
+
+var (
+	addr     = flag.String("addr", "ws://127.0.0.1:8028", "base websocket URL of the server")
+	keyPath  = flag.String("key", "key.bin", "ring key to sign room messages with")
+	keyId    = flag.Uint("keyid", 0, "id of the ring key in the server's key ring")
+	speed    = flag.Float64("speed", 1, "playback speed, 0 to send everything as fast as possible")
+	timeline = flag.Bool("timeline", false, "print a timeline of the recording instead of replaying it")
+)
+
+type client struct {
+	uuid string
+	ip   string
+
+	session *websocket.Conn
+	room    *websocket.Conn
+
+	connKey []byte
+	counter uint32
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] recording%s...\n", os.Args[0], recorder.Extension)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var frames []*recorder.Frame
+	for _, path := range flag.Args() {
+		recording, err := recorder.ReadAll(path)
+		if err != nil {
+			log.Fatalf("%s: %s", path, err)
+		}
+
+		frames = append(frames, recording...)
+	}
+
+	if len(frames) == 0 {
+		log.Fatal("nothing recorded")
+	}
+
+	slices.SortStableFunc(frames, func(a, b *recorder.Frame) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	if *timeline {
+		printTimeline(frames)
+		return
+	}
+
+	key, err := os.ReadFile(*keyPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	replay(frames, key)
+}
+
+func printTimeline(frames []*recorder.Frame) {
+	start := frames[0].Time
+
+	for _, frame := range frames {
+		location := "sess"
+		if frame.Socket == recorder.SocketRoom {
+			location = fmt.Sprintf("%04d", frame.Room)
+			if frame.Instance != 0 {
+				location += fmt.Sprintf("#%d", frame.Instance)
+			}
+		}
+
+		dir := "<-"
+		if frame.Inbound {
+			dir = "->"
+		}
+
+		fmt.Printf("%10.3f  %-7s  %5d  %-16s  %s %s\n", frame.Time.Sub(start).Seconds(), location, frame.Client, frame.Uuid, dir, strings.Join(frame.Msg, " "))
+	}
+}
+
+func replay(frames []*recorder.Frame, key []byte) {
+	// by uuid, session ids are reused by later players once a player leaves
+	clients := make(map[string]*client)
+
+	var sent int
+
+	start, recordingStart := time.Now(), frames[0].Time
+	for _, frame := range frames {
+		// what the server sent back is only used for the timeline
+		if !frame.Inbound {
+			continue
+		}
+
+		if *speed > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(float64(frame.Time.Sub(recordingStart)) / *speed))))
+		}
+
+		c, ok := clients[frame.Uuid]
+		if !ok {
+			n := len(clients) + 1
+			c = &client{
+				uuid: frame.Uuid,
+				ip:   fmt.Sprintf("10.%d.%d.%d", n>>16&0xff, n>>8&0xff, n&0xff),
+			}
+			clients[frame.Uuid] = c
+		}
+
+		if err := c.send(frame, key); err != nil {
+			log.Printf("client %s: %s", c.uuid, err)
+			continue
+		}
+
+		sent++
+	}
+
+	// give the server a moment to process the last messages
+	time.Sleep(time.Second)
+
+	for _, c := range clients {
+		c.close()
+	}
+
+	log.Printf("replayed %d messages from %d clients", sent, len(clients))
+}
+
+func (c *client) send(frame *recorder.Frame, key []byte) error {
+	if c.session == nil {
+		if err := c.connectSession(); err != nil {
+			return err
+		}
+	}
+
+	payload := []byte(strings.Join(frame.Msg, delim))
+
+	if frame.Socket == recorder.SocketSession {
+		return c.session.WriteMessage(websocket.TextMessage, payload)
+	}
+
+	if c.room == nil {
+		if err := c.connectRoom(frame.Room, key); err != nil {
+			return err
+		}
+	}
+
+	c.counter++
+
+	return c.room.WriteMessage(websocket.BinaryMessage, security.Sign(c.connKey, byte(*keyId), c.counter, payload))
+}
+
+func (c *client) connectSession() error {
+	conn, err := c.dial("/session")
+	if err != nil {
+		return err
+	}
+
+	// the room socket needs the session to be registered,
+	// which it is once the session answers messages
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("i")); err != nil {
+		conn.Close()
+		return err
+	}
+
+	if _, err := readUntil(conn, "i"); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.session = conn
+
+	go discard(conn)
+
+	return nil
+}
+
+func (c *client) connectRoom(roomId int, key []byte) error {
+	conn, err := c.dial(fmt.Sprintf("/room?id=%d", roomId))
+	if err != nil {
+		return err
+	}
+
+	// the server sends the nonce to derive the signing key from first
+	msgFields, err := readUntil(conn, "s")
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if len(msgFields) < 3 {
+		conn.Close()
+		return errors.New("malformed s message")
+	}
+
+	nonce, err := hex.DecodeString(msgFields[2])
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.room = conn
+	c.connKey = security.DeriveKey(key, nonce)
+	c.counter = 0
+
+	go discard(conn)
+
+	return nil
+}
+
+func (c *client) dial(path string) (*websocket.Conn, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(*addr+path, http.Header{"X-Forwarded-For": {c.ip}})
+
+	return conn, err
+}
+
+func (c *client) close() {
+	for _, conn := range []*websocket.Conn{c.room, c.session} {
+		if conn == nil {
+			continue
+		}
+
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		conn.Close()
+	}
+}
+
+// readUntil reads messages until one of type msgType and returns its fields
+func readUntil(conn *websocket.Conn, msgType string) ([]string, error) {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range strings.Split(string(message), mdelim) {
+			if msgFields := strings.Split(msg, delim); msgFields[0] == msgType {
+				return msgFields, nil
+			}
+		}
+	}
+}
+
+func discard(conn *websocket.Conn) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
@@ -24,7 +24,7 @@ import (
 )
 
 func adminGetPlayers(w http.ResponseWriter, r *http.Request) {
-	_, _, rank, _, _, _ := getPlayerDataFromToken(r.Header.Get("Authorization"))
+	_, _, rank, _, _, _ := getPlayerDataFromToken(r.Context(), r.Header.Get("Authorization"))
 	if rank == 0 {
 		handleError(w, r, "access denied")
 		return
@@ -49,13 +49,67 @@ func adminGetPlayers(w http.ResponseWriter, r *http.Request) {
 }
 
 func adminGetBansMutes(w http.ResponseWriter, r *http.Request) {
-	_, _, rank, _, _, _ := getPlayerDataFromToken(r.Header.Get("Authorization"))
+	_, _, rank, _, _, _ := getPlayerDataFromToken(r.Context(), r.Header.Get("Authorization"))
 	if rank == 0 {
 		handleError(w, r, "access denied")
 		return
 	}
 
-	responseJson, err := json.Marshal(getBannedMutedPlayers(r.URL.Path == "/admin/getbans"))
+	responseJson, err := json.Marshal(getBannedMutedPlayers(r.Context(), r.URL.Path == "/admin/getbans"))
+	if err != nil {
+		handleError(w, r, "error while marshaling")
+		return
+	}
+
+	w.Write(responseJson)
+}
+
+func adminGetSuspiciousActivity(w http.ResponseWriter, r *http.Request) {
+	_, _, rank, _, _, _ := getPlayerDataFromToken(r.Context(), r.Header.Get("Authorization"))
+	if rank == 0 {
+		handleError(w, r, "access denied")
+		return
+	}
+
+	responseJson, err := json.Marshal(getSuspiciousActivity(r.URL.Query().Get("uuid")))
+	if err != nil {
+		handleError(w, r, "error while marshaling")
+		return
+	}
+
+	w.Write(responseJson)
+}
+
+// adminReload reloads game data on this server, or on every server with all
+func adminReload(w http.ResponseWriter, r *http.Request) {
+	uuid, _, rank, _, _, _ := getPlayerDataFromToken(r.Context(), r.Header.Get("Authorization"))
+	if rank == 0 {
+		handleError(w, r, "access denied")
+		return
+	}
+
+	writeLog(uuid, "admin", "reload", 200)
+
+	response := map[string][]string{
+		getConfig().gameName: getErrorStrings(reloadGameData()),
+	}
+
+	if r.URL.Query().Has("all") {
+		for game := range gameIdToName {
+			if game == getConfig().gameName {
+				continue
+			}
+
+			errs, err := reloadGameDataInGame(game)
+			if err != nil {
+				errs = []string{err.Error()}
+			}
+
+			response[game] = errs
+		}
+	}
+
+	responseJson, err := json.Marshal(response)
 	if err != nil {
 		handleError(w, r, "error while marshaling")
 		return
@@ -65,7 +119,7 @@ func adminGetBansMutes(w http.ResponseWriter, r *http.Request) {
 }
 
 func adminBanMute(w http.ResponseWriter, r *http.Request) {
-	uuid, _, rank, _, _, _ := getPlayerDataFromToken(r.Header.Get("Authorization"))
+	uuid, _, rank, _, _, _ := getPlayerDataFromToken(r.Context(), r.Header.Get("Authorization"))
 	if rank == 0 {
 		handleError(w, r, "access denied")
 		return
@@ -82,7 +136,7 @@ func adminBanMute(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		uuid, err := getUuidFromName(user)
+		uuid, err := getUuidFromName(r.Context(), user)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -106,27 +160,27 @@ func adminBanMute(w http.ResponseWriter, r *http.Request) {
 	var err error
 	switch r.URL.Path {
 	case "/admin/ban":
-		err = tryBanPlayer(uuid, targetUuid, false, broadcast)
+		err = tryBanPlayer(r.Context(), uuid, targetUuid, false, broadcast)
 	case "/admin/dban":
-		err = tryBanPlayer(uuid, targetUuid, true, broadcast)
+		err = tryBanPlayer(r.Context(), uuid, targetUuid, true, broadcast)
 	case "/admin/unban":
-		err = tryUnbanPlayer(uuid, targetUuid)
+		err = tryUnbanPlayer(r.Context(), uuid, targetUuid)
 	case "/admin/mute":
-		err = tryMutePlayer(uuid, targetUuid, false, broadcast)
+		err = tryMutePlayer(r.Context(), uuid, targetUuid, false, broadcast)
 	case "/admin/unmute":
-		err = tryUnmutePlayer(uuid, targetUuid)
+		err = tryUnmutePlayer(r.Context(), uuid, targetUuid)
 	case "/admin/tempban":
 		if expiry == nil {
 			handleError(w, r, "tempban requires expiry")
 			return
 		}
-		err = tryBanPlayerWithExpiry(uuid, targetUuid, *expiry, query.Get("reason"), broadcast)
+		err = tryBanPlayerWithExpiry(r.Context(), uuid, targetUuid, *expiry, query.Get("reason"), broadcast)
 	case "/admin/tempmute":
 		if expiry == nil {
 			handleError(w, r, "tempmute requires expiry")
 			return
 		}
-		err = tryMutePlayerWithExpiry(uuid, targetUuid, *expiry, query.Get("reason"), broadcast)
+		err = tryMutePlayerWithExpiry(r.Context(), uuid, targetUuid, *expiry, query.Get("reason"), broadcast)
 	}
 	if err != nil {
 		handleInternalError(w, r, err)
@@ -137,7 +191,7 @@ func adminBanMute(w http.ResponseWriter, r *http.Request) {
 }
 
 func adminChangeUsername(w http.ResponseWriter, r *http.Request) {
-	uuid, _, rank, _, _, _ := getPlayerDataFromToken(r.Header.Get("Authorization"))
+	uuid, _, rank, _, _, _ := getPlayerDataFromToken(r.Context(), r.Header.Get("Authorization"))
 	if rank == 0 {
 		handleError(w, r, "access denied")
 		return
@@ -155,7 +209,7 @@ func adminChangeUsername(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userUuid, err := getUuidFromName(user)
+	userUuid, err := getUuidFromName(r.Context(), user)
 	if err != nil {
 		handleInternalError(w, r, err)
 		return
@@ -165,7 +219,7 @@ func adminChangeUsername(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = tryChangePlayerUsername(uuid, userUuid, newUser)
+	err = tryChangePlayerUsername(r.Context(), uuid, userUuid, newUser)
 	if err != nil {
 		handleInternalError(w, r, err)
 		return
@@ -175,7 +229,7 @@ func adminChangeUsername(w http.ResponseWriter, r *http.Request) {
 }
 
 func adminResetPw(w http.ResponseWriter, r *http.Request) {
-	_, _, rank, _, _, _ := getPlayerDataFromToken(r.Header.Get("Authorization"))
+	_, _, rank, _, _, _ := getPlayerDataFromToken(r.Context(), r.Header.Get("Authorization"))
 	if rank == 0 {
 		handleError(w, r, "access denied")
 		return
@@ -187,7 +241,7 @@ func adminResetPw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userUuid, err := getUuidFromName(user)
+	userUuid, err := getUuidFromName(r.Context(), user)
 	if err != nil {
 		handleInternalError(w, r, err)
 		return
@@ -197,13 +251,13 @@ func adminResetPw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	userRank := getPlayerRank(userUuid)
+	userRank := getPlayerRank(r.Context(), userUuid)
 	if userRank >= rank {
 		handleError(w, r, "target rank too high")
 		return
 	}
 
-	newPw, err := handleResetPw(userUuid)
+	newPw, err := handleResetPw(r.Context(), userUuid)
 	if err != nil {
 		handleInternalError(w, r, err)
 		return
@@ -213,7 +267,7 @@ func adminResetPw(w http.ResponseWriter, r *http.Request) {
 }
 
 func adminManageBadge(w http.ResponseWriter, r *http.Request) {
-	_, _, rank, _, _, _ := getPlayerDataFromToken(r.Header.Get("Authorization"))
+	_, _, rank, _, _, _ := getPlayerDataFromToken(r.Context(), r.Header.Get("Authorization"))
 	if rank == 0 {
 		handleError(w, r, "access denied")
 		return
@@ -227,7 +281,7 @@ func adminManageBadge(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		var err error
-		uuidParam, err = getUuidFromName(userParam)
+		uuidParam, err = getUuidFromName(r.Context(), userParam)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -246,7 +300,7 @@ func adminManageBadge(w http.ResponseWriter, r *http.Request) {
 
 	var badgeExists bool
 
-	for _, gameBadges := range badges {
+	for _, gameBadges := range getBadgeData().badges {
 		for badgeId := range gameBadges {
 			if badgeId == idParam {
 				badgeExists = true
@@ -265,9 +319,9 @@ func adminManageBadge(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 	if r.URL.Path == "/admin/grantbadge" {
-		err = unlockPlayerBadge(uuidParam, idParam)
+		err = unlockPlayerBadge(r.Context(), uuidParam, idParam)
 	} else {
-		err = removePlayerBadge(uuidParam, idParam)
+		err = removePlayerBadge(r.Context(), uuidParam, idParam)
 	}
 	if err != nil {
 		handleInternalError(w, r, err)
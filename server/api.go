@@ -18,6 +18,7 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -102,6 +103,12 @@ func initApi() {
 	http.HandleFunc("/admin/resetpw", adminResetPw)
 	http.HandleFunc("/admin/grantbadge", adminManageBadge)
 	http.HandleFunc("/admin/revokebadge", adminManageBadge)
+	http.HandleFunc("/admin/getsuspiciousactivity", adminGetSuspiciousActivity)
+	http.HandleFunc("/admin/reload", adminReload)
+
+	http.HandleFunc("/metrics", handleMetrics)
+	http.HandleFunc("/health", handleHealth)
+	http.HandleFunc("/ready", handleReady)
 
 	http.HandleFunc("/api/party", handleParty)
 	http.HandleFunc("/api/savesync", handleSaveSync)
@@ -150,9 +157,9 @@ func handleParty(w http.ResponseWriter, r *http.Request) {
 
 	token := r.Header.Get("Authorization")
 	if token == "" {
-		uuid, banned, _ = getOrCreatePlayerData(getIp(r))
+		uuid, banned, _ = getOrCreatePlayerData(r.Context(), getIp(r))
 	} else {
-		uuid, _, rank, _, banned, _ = getPlayerDataFromToken(token)
+		uuid, _, rank, _, banned, _ = getPlayerDataFromToken(r.Context(), token)
 		if uuid == "" {
 			handleError(w, r, "invalid token")
 			return
@@ -172,7 +179,7 @@ func handleParty(w http.ResponseWriter, r *http.Request) {
 
 	switch commandParam {
 	case "id":
-		partyId, err := getPlayerPartyId(uuid)
+		partyId, err := getPlayerPartyId(r.Context(), uuid)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -210,7 +217,7 @@ func handleParty(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(party.Description))
 		return
 	case "create", "update":
-		partyId, err := getPlayerPartyId(uuid)
+		partyId, err := getPlayerPartyId(r.Context(), uuid)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -218,7 +225,7 @@ func handleParty(w http.ResponseWriter, r *http.Request) {
 		create := commandParam == "create"
 		if create {
 			if partyId != 0 {
-				err = handlePartyMemberLeave(partyId, uuid)
+				err = handlePartyMemberLeave(r.Context(), partyId, uuid)
 				if err != nil {
 					handleInternalError(w, r, err)
 					return
@@ -280,16 +287,16 @@ func handleParty(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if create {
-			partyId, err = createPartyData(nameParam, public, pass, themeParam, description, uuid)
+			partyId, err = createPartyData(r.Context(), nameParam, public, pass, themeParam, description, uuid)
 		} else {
-			err = updatePartyData(partyId, nameParam, public, pass, themeParam, description, uuid)
+			err = updatePartyData(r.Context(), partyId, nameParam, public, pass, themeParam, description, uuid)
 		}
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
 		}
 		if create {
-			err = joinPlayerParty(partyId, uuid)
+			err = joinPlayerParty(r.Context(), partyId, uuid)
 			if err != nil {
 				handleInternalError(w, r, err)
 				return
@@ -326,25 +333,25 @@ func handleParty(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 		}
-		playerPartyId, err := getPlayerPartyId(uuid)
+		playerPartyId, err := getPlayerPartyId(r.Context(), uuid)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
 		}
 		if playerPartyId != 0 {
-			err = handlePartyMemberLeave(partyId, uuid)
+			err = handlePartyMemberLeave(r.Context(), partyId, uuid)
 			if err != nil {
 				handleInternalError(w, r, err)
 				return
 			}
 		}
-		err = joinPlayerParty(partyId, uuid)
+		err = joinPlayerParty(r.Context(), partyId, uuid)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
 		}
 	case "leave":
-		partyId, err := getPlayerPartyId(uuid)
+		partyId, err := getPlayerPartyId(r.Context(), uuid)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -353,14 +360,14 @@ func handleParty(w http.ResponseWriter, r *http.Request) {
 			handleError(w, r, "player not in a party")
 			return
 		}
-		err = handlePartyMemberLeave(partyId, uuid)
+		err = handlePartyMemberLeave(r.Context(), partyId, uuid)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
 		}
 	case "kick", "transfer":
 		kick := commandParam == "kick"
-		partyId, err := getPlayerPartyId(uuid)
+		partyId, err := getPlayerPartyId(r.Context(), uuid)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -387,7 +394,7 @@ func handleParty(w http.ResponseWriter, r *http.Request) {
 			handleError(w, r, "player not specified")
 			return
 		}
-		playerPartyId, err := getPlayerPartyId(playerParam)
+		playerPartyId, err := getPlayerPartyId(r.Context(), playerParam)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -401,15 +408,15 @@ func handleParty(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if kick {
-			err = leavePlayerParty(playerParam)
+			err = leavePlayerParty(r.Context(), playerParam)
 		} else {
-			err = setPartyOwner(partyId, playerParam)
+			err = setPartyOwner(r.Context(), partyId, playerParam)
 		}
 		if err != nil {
 			handleInternalError(w, r, nil)
 		}
 	case "disband":
-		partyId, err := getPlayerPartyId(uuid)
+		partyId, err := getPlayerPartyId(r.Context(), uuid)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -423,11 +430,41 @@ func handleParty(w http.ResponseWriter, r *http.Request) {
 			handleError(w, r, "attempted party disband from non-owner")
 			return
 		}
-		err = deletePartyAndMembers(partyId)
+		err = deletePartyAndMembers(r.Context(), partyId)
+		if err != nil {
+			handleInternalError(w, r, err)
+			return
+		}
+		clearPartySpectators(partyId)
+	case "allowspectator", "disallowspectator":
+		partyId, err := getPlayerPartyId(r.Context(), uuid)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
 		}
+		if partyId == 0 {
+			handleError(w, r, "player not in a party")
+			return
+		}
+		ownerUuid, err := getPartyOwnerUuid(partyId)
+		if err != nil {
+			handleInternalError(w, r, err)
+			return
+		}
+		if ownerUuid != uuid {
+			handleError(w, r, "attempted spectator change from non-owner")
+			return
+		}
+		playerParam := r.URL.Query().Get("player")
+		if playerParam == "" {
+			handleError(w, r, "player not specified")
+			return
+		}
+		if commandParam == "allowspectator" {
+			allowPartySpectator(partyId, playerParam)
+		} else {
+			disallowPartySpectator(partyId, playerParam)
+		}
 	default:
 		handleError(w, r, "unknown command")
 		return
@@ -436,23 +473,23 @@ func handleParty(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("ok"))
 }
 
-func handlePartyMemberLeave(partyId int, playerUuid string) error {
+func handlePartyMemberLeave(ctx context.Context, partyId int, playerUuid string) error {
 	ownerUuid, err := getPartyOwnerUuid(partyId)
 	if err != nil {
 		return err
 	}
 
-	err = leavePlayerParty(playerUuid)
+	err = leavePlayerParty(ctx, playerUuid)
 	if err != nil {
 		return err
 	}
 
-	deleted, err := checkDeleteOrphanedParty(partyId)
+	deleted, err := checkDeleteOrphanedParty(ctx, partyId)
 	if err != nil {
 		return err
 	}
 	if !deleted && playerUuid == ownerUuid {
-		err = assumeNextPartyOwner(partyId)
+		err = assumeNextPartyOwner(ctx, partyId)
 		if err != nil {
 			return err
 		}
@@ -470,7 +507,7 @@ func handleSaveSync(w http.ResponseWriter, r *http.Request) {
 		handleError(w, r, "token not specified")
 		return
 	} else {
-		uuid, _, _, _, banned, _ = getPlayerDataFromToken(token)
+		uuid, _, _, _, banned, _ = getPlayerDataFromToken(r.Context(), token)
 		if uuid == "" {
 			handleError(w, r, "invalid token")
 			return
@@ -552,7 +589,7 @@ func handleVm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	gameId, mapId, vmGroup, err := getEventVmInfo(eventVmId)
+	gameId, mapId, vmGroup, err := getEventVmInfo(r.Context(), eventVmId)
 	if err != nil {
 		handleInternalError(w, r, err)
 		return
@@ -591,13 +628,13 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 	if token == "" {
 		// commands available for guest players
 		if commandParam == "list" || commandParam == "playerSlotList" {
-			uuid, banned, _ = getOrCreatePlayerData(getIp(r))
+			uuid, banned, _ = getOrCreatePlayerData(r.Context(), getIp(r))
 		} else {
 			handleError(w, r, "token not specified")
 			return
 		}
 	} else {
-		uuid, name, rank, badge, banned, _ = getPlayerDataFromToken(token)
+		uuid, name, rank, badge, banned, _ = getPlayerDataFromToken(r.Context(), token)
 		if uuid == "" {
 			handleError(w, r, "invalid token")
 			return
@@ -610,7 +647,7 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if strings.HasPrefix(commandParam, "slot") || strings.HasPrefix(commandParam, "preset") {
-		badgeSlotRows, badgeSlotCols = getPlayerBadgeSlotCounts(name)
+		badgeSlotRows, badgeSlotCols = getPlayerBadgeSlotCounts(r.Context(), name)
 	}
 
 	if strings.HasPrefix(commandParam, "preset") {
@@ -638,12 +675,12 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 			case "null":
 				unlocked = true
 			default:
-				tags, _, err := getPlayerTags(uuid)
+				tags, _, err := getPlayerTags(r.Context(), uuid)
 				if err != nil {
 					handleInternalError(w, r, err)
 					return
 				}
-				badgeData, err := getPlayerBadgeData(uuid, rank, tags, true, true)
+				badgeData, err := getPlayerBadgeData(r.Context(), uuid, rank, tags, true, true)
 				if err != nil {
 					handleInternalError(w, r, err)
 					return
@@ -669,7 +706,7 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if commandParam == "set" {
-			err := setPlayerBadge(uuid, idParam)
+			err := setPlayerBadge(r.Context(), uuid, idParam)
 			if err != nil {
 				handleInternalError(w, r, err)
 				return
@@ -699,7 +736,7 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			err = setPlayerBadgeSlot(uuid, idParam, slotRow, slotCol)
+			err = setPlayerBadgeSlot(r.Context(), uuid, idParam, slotRow, slotCol)
 			if err != nil {
 				handleInternalError(w, r, err)
 				return
@@ -709,14 +746,14 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 		var tags []string
 		if token != "" {
 			var err error
-			tags, _, err = getPlayerTags(uuid)
+			tags, _, err = getPlayerTags(r.Context(), uuid)
 			if err != nil {
 				handleInternalError(w, r, err)
 				return
 			}
 		}
 		if r.URL.Query().Get("simple") == "true" {
-			simpleBadgeData, err := getSimplePlayerBadgeData(uuid, rank, tags, token != "")
+			simpleBadgeData, err := getSimplePlayerBadgeData(r.Context(), uuid, rank, tags, token != "")
 			if err != nil {
 				handleInternalError(w, r, err)
 				return
@@ -732,7 +769,7 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 				handleError(w, r, "cannot retrieve player badge data for guest player")
 				return
 			}
-			badgeData, err := getPlayerBadgeData(uuid, rank, tags, true, false)
+			badgeData, err := getPlayerBadgeData(r.Context(), uuid, rank, tags, true, false)
 			if err != nil {
 				handleInternalError(w, r, err)
 				return
@@ -756,20 +793,20 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 		if token != "" {
 			var err error
 			var lastUnlocked time.Time
-			tags, lastUnlocked, err = getPlayerTags(uuid)
+			tags, lastUnlocked, err = getPlayerTags(r.Context(), uuid)
 			if err != nil {
 				handleInternalError(w, r, err)
 				return
 			}
 			newTags = lastUnlocked.UTC().After(sinceTimestamp)
 		}
-		newUnlockedBadgeIds, err := getPlayerNewUnlockedBadgeIds(uuid, rank, tags)
+		newUnlockedBadgeIds, err := getPlayerNewUnlockedBadgeIds(r.Context(), uuid, rank, tags)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
 		}
 		if len(newUnlockedBadgeIds) != 0 {
-			err := updatePlayerBadgeSlotCounts(uuid)
+			err := updatePlayerBadgeSlotCounts(r.Context(), uuid)
 			if err != nil {
 				handleInternalError(w, r, err)
 				return
@@ -784,7 +821,7 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 		w.Write(responseJson)
 		return
 	case "slotList":
-		badgeSlots, err := getPlayerBadgeSlots(name, badgeSlotRows, badgeSlotCols)
+		badgeSlots, err := getPlayerBadgeSlots(r.Context(), name, badgeSlotRows, badgeSlotCols)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -803,9 +840,9 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		playerBadgeSlotRows, playerBadgeSlotCols := getPlayerBadgeSlotCounts(playerParam)
+		playerBadgeSlotRows, playerBadgeSlotCols := getPlayerBadgeSlotCounts(r.Context(), playerParam)
 
-		badgeSlots, err := getPlayerBadgeSlots(playerParam, playerBadgeSlotRows, playerBadgeSlotCols)
+		badgeSlots, err := getPlayerBadgeSlots(r.Context(), playerParam, playerBadgeSlotRows, playerBadgeSlotCols)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -818,7 +855,7 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 		w.Write(badgeSlotsJson)
 		return
 	case "presetGet":
-		preset, err := getPlayerBadgePreset(uuid, presetId)
+		preset, err := getPlayerBadgePreset(r.Context(), uuid, presetId)
 		if err != nil {
 			handleError(w, r, "could not get badge preset")
 			return
@@ -827,7 +864,7 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(preset))
 		return
 	case "presetSave":
-		badgeSlots, err := getPlayerBadgeSlots(name, badgeSlotRows, badgeSlotCols)
+		badgeSlots, err := getPlayerBadgeSlots(r.Context(), name, badgeSlotRows, badgeSlotCols)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -839,7 +876,7 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := setPlayerBadgePreset(uuid, presetId, string(data)); err != nil {
+		if err := setPlayerBadgePreset(r.Context(), uuid, presetId, string(data)); err != nil {
 			handleInternalError(w, r, err)
 			return
 		}
@@ -847,7 +884,7 @@ func handleBadge(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
 		return
 	case "presetLoad":
-		if err := applyPlayerBadgePreset(uuid, presetId, badgeSlotRows, badgeSlotCols); err != nil {
+		if err := applyPlayerBadgePreset(r.Context(), uuid, presetId, badgeSlotRows, badgeSlotCols); err != nil {
 			handleInternalError(w, r, err)
 			return
 		}
@@ -873,34 +910,28 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 
 	ip := getIp(r)
 
-	if isIpBanned(ip) {
+	if isIpBanned(r.Context(), ip) {
 		handleError(w, r, "banned users cannot create accounts")
 		return
 	}
 
-	var userExists int
-	db.QueryRow("SELECT EXISTS(SELECT * FROM accounts WHERE user = ?)", user).Scan(&userExists)
-
-	if userExists > 0 {
+	if userExists, _ := store.players.accountExists(r.Context(), user); userExists {
 		handleError(w, r, "user exists")
 		return
 	}
 
-	var uuid string
-	db.QueryRow("SELECT uuid FROM players WHERE ip = ?", ip).Scan(&uuid) // no row causes a non-fatal error, uuid is still unset so it doesn't matter
+	uuid, _, _, _ := store.players.getPlayerDataFromIp(r.Context(), ip) // no row causes a non-fatal error, uuid is still unset so it doesn't matter
 	if uuid == "" {
-		uuid, _, _ = getOrCreatePlayerData(ip)
+		uuid, _, _ = getOrCreatePlayerData(r.Context(), ip)
 	}
 
-	db.Exec("UPDATE players SET ip = NULL WHERE ip = ?", ip) // set ip to null to disable ip-based login
-
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		handleError(w, r, "bcrypt error")
 		return
 	}
 
-	db.Exec("INSERT INTO accounts (ip, timestampRegistered, uuid, user, pass) VALUES (?, NOW(), ?, ?, ?)", ip, uuid, user, hashedPassword)
+	store.players.createAccount(r.Context(), ip, uuid, user, hashedPassword)
 
 	w.Write([]byte("ok"))
 }
@@ -914,8 +945,7 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var userPassHash string
-	db.QueryRow("SELECT pass FROM accounts WHERE user = ?", user).Scan(&userPassHash)
+	userPassHash, _ := store.players.getAccountPassHash(r.Context(), user)
 
 	if userPassHash == "" || bcrypt.CompareHashAndPassword([]byte(userPassHash), []byte(password)) != nil {
 		handleError(w, r, "bad login")
@@ -923,8 +953,7 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	token := randString(32)
-	db.Exec("INSERT INTO playerSessions (sessionId, uuid, expiration) (SELECT ?, uuid, DATE_ADD(NOW(), INTERVAL 30 DAY) FROM accounts WHERE user = ?)", token, user)
-	db.Exec("UPDATE accounts SET timestampLoggedIn = NOW() WHERE user = ?", user)
+	store.players.createPlayerSession(r.Context(), token, user)
 
 	w.Write([]byte(token))
 }
@@ -937,12 +966,13 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if getUuidFromToken(token) == "" {
+	if getUuidFromToken(r.Context(), token) == "" {
 		handleError(w, r, "invalid token")
 		return
 	}
 
-	db.Exec("DELETE FROM playerSessions WHERE sessionId = ?", token)
+	store.players.deletePlayerSession(r.Context(), token)
+	invalidateSessionCache(token)
 
 	w.Write([]byte("ok"))
 }
@@ -955,7 +985,7 @@ func handleChangePw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, loginUser, rank, _, _, _, _ := getPlayerInfoFromToken(token)
+	_, loginUser, rank, _, _, _, _ := getPlayerInfoFromToken(r.Context(), token)
 
 	// GET params user, new password
 	user, newPassword := r.URL.Query().Get("user"), r.URL.Query().Get("newPassword")
@@ -972,8 +1002,7 @@ func handleChangePw(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		var userPassHash string
-		db.QueryRow("SELECT pass FROM accounts WHERE user = ?", username).Scan(&userPassHash)
+		userPassHash, _ := store.players.getAccountPassHash(r.Context(), username)
 
 		if userPassHash == "" || bcrypt.CompareHashAndPassword([]byte(userPassHash), []byte(password)) != nil {
 			handleError(w, r, "bad login")
@@ -994,16 +1023,17 @@ func handleChangePw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db.Exec("UPDATE accounts SET pass = ? WHERE user = ?", hashedPassword, username)
+	store.players.setAccountPassHash(r.Context(), username, hashedPassword)
+
+	if uuid, _ := getUuidFromName(r.Context(), username); uuid != "" {
+		invalidatePlayerCache(uuid)
+	}
 
 	w.Write([]byte("ok"))
 }
 
-func handleResetPw(uuid string) (newPassword string, err error) {
-	var userExists int
-	db.QueryRow("SELECT EXISTS (SELECT * FROM accounts WHERE uuid = ?)", uuid).Scan(&userExists)
-
-	if userExists == 0 {
+func handleResetPw(ctx context.Context, uuid string) (newPassword string, err error) {
+	if userExists, _ := store.players.accountExistsForUuid(ctx, uuid); !userExists {
 		return "", errors.New("user not found")
 	}
 
@@ -1014,7 +1044,8 @@ func handleResetPw(uuid string) (newPassword string, err error) {
 		return "", errors.New("bcrypt error")
 	}
 
-	db.Exec("UPDATE accounts SET pass = ? WHERE uuid = ?", hashedPassword, uuid)
+	store.players.setAccountPassHashForUuid(ctx, uuid, hashedPassword)
+	invalidatePlayerCache(uuid)
 
 	return newPassword, nil
 }
@@ -1035,7 +1066,7 @@ func handleAddRemovePlayerFriend(w http.ResponseWriter, r *http.Request, isAdd b
 		return
 	}
 
-	uuid := getUuidFromToken(token)
+	uuid := getUuidFromToken(r.Context(), token)
 
 	if uuid == "" {
 		handleError(w, r, "invalid token")
@@ -1050,7 +1081,7 @@ func handleAddRemovePlayerFriend(w http.ResponseWriter, r *http.Request, isAdd b
 			return
 		}
 
-		uuid, err := getUuidFromName(user)
+		uuid, err := getUuidFromName(r.Context(), user)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -1067,17 +1098,17 @@ func handleAddRemovePlayerFriend(w http.ResponseWriter, r *http.Request, isAdd b
 	var err error
 
 	if isAdd {
-		if isPlayerBlocked(uuid, targetUuid) {
+		if isPlayerBlocked(r.Context(), uuid, targetUuid) {
 			handleError(w, r, "cannot send friend request to blocked user")
 			return
 		}
-		if isPlayerBlocked(targetUuid, uuid) {
+		if isPlayerBlocked(r.Context(), targetUuid, uuid) {
 			handleError(w, r, "cannot send friend request to user who has blocked you")
 			return
 		}
-		err = addPlayerFriend(uuid, targetUuid)
+		err = addPlayerFriend(r.Context(), uuid, targetUuid)
 	} else {
-		err = removePlayerFriend(uuid, targetUuid)
+		err = removePlayerFriend(r.Context(), uuid, targetUuid)
 	}
 
 	if err != nil {
@@ -1094,9 +1125,9 @@ func handleBlockPlayer(w http.ResponseWriter, r *http.Request) {
 	var uuid string
 
 	if token == "" {
-		uuid, _, _ = getPlayerInfo(getIp(r))
+		uuid, _, _ = getPlayerInfo(r.Context(), getIp(r))
 	} else {
-		uuid = getUuidFromToken(token)
+		uuid = getUuidFromToken(r.Context(), token)
 	}
 
 	targetUuid := r.URL.Query().Get("uuid")
@@ -1107,7 +1138,7 @@ func handleBlockPlayer(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		uuid, err := getUuidFromName(user)
+		uuid, err := getUuidFromName(r.Context(), user)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -1121,21 +1152,21 @@ func handleBlockPlayer(w http.ResponseWriter, r *http.Request) {
 		targetUuid = uuid
 	}
 
-	err := tryBlockPlayer(uuid, targetUuid)
+	err := tryBlockPlayer(r.Context(), uuid, targetUuid)
 	if err != nil {
 		handleInternalError(w, r, err)
 		return
 	}
 	// after blocking, remove friend
-	_ = removePlayerFriend(uuid, targetUuid)
+	_ = removePlayerFriend(r.Context(), uuid, targetUuid)
 
 	// "disconnect" them NOW!!!
 	if client, ok := clients.Load(uuid); ok {
 		client.blockedUsers[targetUuid] = true
 		if otherClient, ok := clients.Load(targetUuid); ok {
-			if (client.roomC != nil && otherClient.roomC != nil) && client.roomC.room == otherClient.roomC.room {
-				client.roomC.outbox <- buildMsg("d", otherClient.id)
-				otherClient.roomC.outbox <- buildMsg("d", client.id)
+			if (client.roomC != nil && otherClient.roomC != nil) && client.roomC.getRoom() == otherClient.roomC.getRoom() {
+				client.roomC.outbox.send(buildMsg("d", otherClient.id))
+				otherClient.roomC.outbox.send(buildMsg("d", client.id))
 			}
 		}
 	}
@@ -1149,9 +1180,9 @@ func handleUnblockPlayer(w http.ResponseWriter, r *http.Request) {
 	var uuid string
 
 	if token == "" {
-		uuid, _, _ = getPlayerInfo(getIp(r))
+		uuid, _, _ = getPlayerInfo(r.Context(), getIp(r))
 	} else {
-		uuid = getUuidFromToken(token)
+		uuid = getUuidFromToken(r.Context(), token)
 	}
 
 	targetUuid := r.URL.Query().Get("uuid")
@@ -1162,7 +1193,7 @@ func handleUnblockPlayer(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		uuid, err := getUuidFromName(user)
+		uuid, err := getUuidFromName(r.Context(), user)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -1176,7 +1207,7 @@ func handleUnblockPlayer(w http.ResponseWriter, r *http.Request) {
 		targetUuid = uuid
 	}
 
-	err := tryUnblockPlayer(uuid, targetUuid)
+	err := tryUnblockPlayer(r.Context(), uuid, targetUuid)
 	if err != nil {
 		handleInternalError(w, r, err)
 		return
@@ -1186,7 +1217,7 @@ func handleUnblockPlayer(w http.ResponseWriter, r *http.Request) {
 	if client, ok := clients.Load(uuid); ok {
 		client.blockedUsers[targetUuid] = false
 		if otherClient, ok := clients.Load(targetUuid); ok {
-			if (client.roomC != nil && otherClient.roomC != nil) && client.roomC.room == otherClient.roomC.room {
+			if (client.roomC != nil && otherClient.roomC != nil) && client.roomC.getRoom() == otherClient.roomC.getRoom() {
 				client.roomC.getPlayerData(otherClient.roomC)
 				otherClient.roomC.getPlayerData(client.roomC)
 			}
@@ -1202,12 +1233,12 @@ func handleBlockList(w http.ResponseWriter, r *http.Request) {
 	var uuid string
 
 	if token == "" {
-		uuid, _, _ = getPlayerInfo(getIp(r))
+		uuid, _, _ = getPlayerInfo(r.Context(), getIp(r))
 	} else {
-		uuid = getUuidFromToken(token)
+		uuid = getUuidFromToken(r.Context(), token)
 	}
 
-	blockedPlayers, err := getBlockedPlayerData(uuid)
+	blockedPlayers, err := getBlockedPlayerData(r.Context(), uuid)
 	if err != nil {
 		handleInternalError(w, r, err)
 		return
@@ -1223,7 +1254,7 @@ func handleBlockList(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleExplorer(w http.ResponseWriter, r *http.Request) {
-	if config.gameName != "2kki" {
+	if getConfig().gameName != "2kki" {
 		handleError(w, r, "explorer is only available for Yume 2kki")
 		return
 	}
@@ -1235,14 +1266,14 @@ func handleExplorer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uuid := getUuidFromToken(token)
+	uuid := getUuidFromToken(r.Context(), token)
 
 	if client, ok := clients.Load(uuid); ok {
 		if client.roomC != nil {
 			var allConnLocationNames []string
 			retUrl := "https://explorer.yume.wiki/location?locations="
 
-			for i, locationName := range client.roomC.locations {
+			for i, locationName := range client.getRoomState().locations {
 				var connLocationNames []string
 
 				if i > 0 {
@@ -1277,7 +1308,7 @@ func handleExplorer(w http.ResponseWriter, r *http.Request) {
 				allConnLocationNames = append(allConnLocationNames, connLocationNames...)
 			}
 
-			hiddenLocationNames, err := getPlayerMissingGameLocationNames(uuid, allConnLocationNames)
+			hiddenLocationNames, err := getPlayerMissingGameLocationNames(r.Context(), uuid, allConnLocationNames)
 			if err != nil {
 				handleError(w, r, err.Error())
 				return
@@ -1314,9 +1345,9 @@ func handleExplorerCompletion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uuid := getUuidFromToken(token)
+	uuid := getUuidFromToken(r.Context(), token)
 
-	locationCompletion, err := getPlayerGameLocationCompletion(uuid, config.gameName)
+	locationCompletion, err := getPlayerGameLocationCompletion(r.Context(), uuid, getConfig().gameName)
 	if err != nil {
 		handleError(w, r, err.Error())
 		return
@@ -1333,9 +1364,9 @@ func handleExplorerLocations(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uuid := getUuidFromToken(token)
+	uuid := getUuidFromToken(r.Context(), token)
 
-	locationCompletion, err := getPlayerGameLocationCompletion(uuid, config.gameName)
+	locationCompletion, err := getPlayerGameLocationCompletion(r.Context(), uuid, getConfig().gameName)
 	if err != nil {
 		handleError(w, r, err.Error())
 		return
@@ -1345,7 +1376,7 @@ func handleExplorerLocations(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	missingLocationNames, err := getPlayerAllMissingGameLocationNames(uuid)
+	missingLocationNames, err := getPlayerAllMissingGameLocationNames(r.Context(), uuid)
 	if err != nil {
 		handleError(w, r, err.Error())
 		return
@@ -1376,9 +1407,9 @@ func handleChatHistory(w http.ResponseWriter, r *http.Request) {
 	token := r.Header.Get("Authorization")
 
 	if token == "" {
-		uuid, _, _ = getOrCreatePlayerData(getIp(r))
+		uuid, _, _ = getOrCreatePlayerData(r.Context(), getIp(r))
 	} else {
-		uuid = getUuidFromToken(token)
+		uuid = getUuidFromToken(r.Context(), token)
 	}
 
 	lastMsgId := r.URL.Query().Get("lastMsgId")
@@ -1418,7 +1449,7 @@ func handleChatHistory(w http.ResponseWriter, r *http.Request) {
 		partyMsgLimit = 250
 	}
 
-	chatHistory, err := getChatMessageHistory(uuid, globalMsgLimit, partyMsgLimit, lastMsgId)
+	chatHistory, err := getChatMessageHistory(r.Context(), uuid, globalMsgLimit, partyMsgLimit, lastMsgId)
 	if err != nil {
 		handleInternalError(w, r, err)
 		return
@@ -1439,9 +1470,9 @@ func handleClearChatHistory(w http.ResponseWriter, r *http.Request) {
 	token := r.Header.Get("Authorization")
 
 	if token == "" {
-		uuid, _, _ = getOrCreatePlayerData(getIp(r))
+		uuid, _, _ = getOrCreatePlayerData(r.Context(), getIp(r))
 	} else {
-		uuid = getUuidFromToken(token)
+		uuid = getUuidFromToken(r.Context(), token)
 	}
 
 	lastGlobalMsgId := r.URL.Query().Get("lastGlobalMsgId")
@@ -1451,7 +1482,7 @@ func handleClearChatHistory(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		updatePlayerLastChatMessage(uuid, lastGlobalMsgId, false)
+		updatePlayerLastChatMessage(r.Context(), uuid, lastGlobalMsgId, false)
 	}
 
 	lastPartyMsgId := r.URL.Query().Get("lastPartyMsgId")
@@ -1461,7 +1492,7 @@ func handleClearChatHistory(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		updatePlayerLastChatMessage(uuid, lastPartyMsgId, true)
+		updatePlayerLastChatMessage(r.Context(), uuid, lastPartyMsgId, true)
 	}
 
 	w.Write([]byte("ok"))
@@ -1482,11 +1513,11 @@ func handleInfo(w http.ResponseWriter, r *http.Request) {
 
 	token := r.Header.Get("Authorization")
 	if token == "" {
-		uuid, name, rank = getPlayerInfo(getIp(r))
+		uuid, name, rank = getPlayerInfo(r.Context(), getIp(r))
 	} else {
-		uuid, name, rank, badge, badgeSlotRows, badgeSlotCols, screenshotLimit = getPlayerInfoFromToken(token)
-		medals = getPlayerMedals(uuid)
-		locationIds, _ = getPlayerGameLocationIds(uuid, config.gameName)
+		uuid, name, rank, badge, badgeSlotRows, badgeSlotCols, screenshotLimit = getPlayerInfoFromToken(r.Context(), token)
+		medals = getPlayerMedals(r.Context(), uuid)
+		locationIds, _ = getPlayerGameLocationIds(r.Context(), uuid, getConfig().gameName)
 	}
 
 	// guest accounts with no playerGameData records will return nothing
@@ -1518,8 +1549,8 @@ func handlePlayers(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(strconv.Itoa(clients.GetAmount())))
 }
 
-func query2kki(action string, queryString string) (response string, err error) {
-	err = db.QueryRow("SELECT response FROM 2kkiApiQueries WHERE action = ? AND query = ? AND NOW() < timestampExpired", action, queryString).Scan(&response)
+func query2kki(ctx context.Context, action string, queryString string) (response string, err error) {
+	response, err = store.apiCache.get2kkiApiQuery(ctx, action, queryString)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return "", err
@@ -1545,7 +1576,7 @@ func query2kki(action string, queryString string) (response string, err error) {
 		if strings.HasPrefix(string(body), "{\"error\"") || strings.HasPrefix(string(body), "<!DOCTYPE html>") {
 			return string(body), errors.New("received error response from Yume 2kki Explorer API: " + string(body))
 		} else {
-			_, err = db.Exec("INSERT INTO 2kkiApiQueries (action, query, response, timestampExpired) VALUES (?, ?, ?, DATE_ADD(NOW(), INTERVAL 1 HOUR)) ON DUPLICATE KEY UPDATE response = ?, timestampExpired = DATE_ADD(NOW(), INTERVAL 1 HOUR)", action, queryString, string(body), string(body))
+			err = store.apiCache.write2kkiApiQuery(ctx, action, queryString, string(body))
 			if err != nil {
 				return "", err
 			}
@@ -1557,14 +1588,14 @@ func query2kki(action string, queryString string) (response string, err error) {
 	return response, nil
 }
 
-func queryWiki(action string, queryString string) (response string, err error) {
-	err = db.QueryRow("SELECT response FROM wikiApiQueries WHERE game = ? AND action = ? AND query = ? AND NOW() < timestampExpired", config.gameName, action, queryString).Scan(&response)
+func queryWiki(ctx context.Context, action string, queryString string) (response string, err error) {
+	response, err = store.apiCache.getWikiApiQuery(ctx, action, queryString)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return "", err
 		}
 
-		url := "https://wrapper.yume.wiki/" + action + "?game=" + config.gameName
+		url := "https://wrapper.yume.wiki/" + action + "?game=" + getConfig().gameName
 		if queryString != "" {
 			url += "&" + queryString
 		}
@@ -1588,7 +1619,7 @@ func queryWiki(action string, queryString string) (response string, err error) {
 		if strings.HasPrefix(bodyStr, "{\"error\"") || strings.HasPrefix(bodyStr, "<!DOCTYPE html>") {
 			return "", errors.New("received error response from Yume Wiki API: " + bodyStr)
 		} else {
-			_, err = db.Exec("INSERT INTO wikiApiQueries (game, action, query, response, timestampExpired) VALUES (?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL 1 HOUR)) ON DUPLICATE KEY UPDATE response = ?, timestampExpired = DATE_ADD(NOW(), INTERVAL 12 HOUR)", config.gameName, action, queryString, bodyStr, bodyStr)
+			err = store.apiCache.writeWikiApiQuery(ctx, action, queryString, bodyStr)
 			if err != nil {
 				return "", err
 			}
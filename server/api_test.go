@@ -0,0 +1,306 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// registerTestAccount creates an account for the player at ip and logs it in
+func registerTestAccount(t testing.TB, ip string, user string) (token string) {
+	t.Helper()
+
+	query := "?" + url.Values{"user": {user}, "password": {"password"}}.Encode()
+
+	if status, body, err := testRequest(ip, "POST", "/api/register"+query, "", ""); err != nil || status != 200 {
+		t.Fatalf("failed to register %s: %d %s %v", user, status, body, err)
+	}
+
+	status, token, err := testRequest(ip, "POST", "/api/login"+query, "", "")
+	if err != nil || status != 200 {
+		t.Fatalf("failed to log in %s: %d %s %v", user, status, token, err)
+	}
+
+	return token
+}
+
+func getTestChatHistory(t testing.TB, ip string) ChatHistory {
+	t.Helper()
+
+	status, body, err := testRequest(ip, "GET", "/api/chathistory", "", "")
+	if err != nil || status != 200 {
+		t.Fatalf("failed to get chat history: %d %s %v", status, body, err)
+	}
+
+	var chatHistory ChatHistory
+	if err := json.Unmarshal([]byte(body), &chatHistory); err != nil {
+		t.Fatal(err)
+	}
+
+	return chatHistory
+}
+
+// getTestChatMessages returns the messages of uuid in the chat history of the player at ip
+func getTestChatMessages(t testing.TB, ip string, uuid string) (messages []*ChatMessage, listed bool) {
+	t.Helper()
+
+	chatHistory := getTestChatHistory(t, ip)
+	for _, msg := range chatHistory.Messages {
+		if msg.Uuid == uuid {
+			messages = append(messages, msg)
+		}
+	}
+	for _, player := range chatHistory.Players {
+		if player.Uuid == uuid {
+			listed = true
+		}
+	}
+
+	return messages, listed
+}
+
+func TestChatHistory(t *testing.T) {
+	c := connectTestClient(t, newTestPlayer(), 1)
+	defer c.close()
+
+	c.sendSession("name", "chatter")
+	c.sendSession("gsay", "first")
+	c.sendSession("gsay", "second")
+
+	var messages []*ChatMessage
+	var listed bool
+	waitFor(t, "the messages to be written", func() bool {
+		messages, listed = getTestChatMessages(t, c.ip, c.uuid)
+		return len(messages) == 2
+	})
+
+	if messages[0].Contents != "first" || messages[1].Contents != "second" {
+		t.Errorf("got messages %q and %q, want them oldest first", messages[0].Contents, messages[1].Contents)
+	}
+	if !listed {
+		t.Error("the sender isn't among the players")
+	}
+
+	// clearing the history up to the first message leaves the second
+	status, body, err := testRequest(c.ip, "GET", "/api/clearchathistory?lastGlobalMsgId="+messages[0].MsgId, "", "")
+	if err != nil || status != 200 {
+		t.Fatalf("failed to clear chat history: %d %s %v", status, body, err)
+	}
+
+	messages, _ = getTestChatMessages(t, c.ip, c.uuid)
+	if len(messages) != 1 || messages[0].Contents != "second" {
+		t.Errorf("got %d messages after clearing, want only the second", len(messages))
+	}
+}
+
+func TestExplorerCompletion(t *testing.T) {
+	ctx := context.Background()
+
+	n := newTestPlayer()
+	suffix := strconv.Itoa(n)
+
+	visitedId, err := store.locations.createGameLocation(ctx, "Visited"+suffix, "", 1, 1, []string{"0002"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.locations.createGameLocation(ctx, "Unvisited"+suffix, "", 2, 2, []string{"0003"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := connectTestClient(t, n, 2)
+	defer c.close()
+
+	token := registerTestAccount(t, c.ip, "explorer"+suffix)
+
+	// only the location on the player's map counts
+	c.sendSession("l", "Visited"+suffix, "Unvisited"+suffix, "Unknown")
+
+	var playerInfo PlayerInfo
+	waitFor(t, "the location to be written", func() bool {
+		status, body, err := testRequest(c.ip, "GET", "/api/info", token, "")
+		if err != nil || status != 200 {
+			t.Fatalf("failed to get player info: %d %s %v", status, body, err)
+		}
+		if err := json.Unmarshal([]byte(body), &playerInfo); err != nil {
+			t.Fatal(err)
+		}
+		return len(playerInfo.LocationIds) != 0
+	})
+
+	if len(playerInfo.LocationIds) != 1 || playerInfo.LocationIds[0] != visitedId {
+		t.Errorf("got location ids %v, want [%d]", playerInfo.LocationIds, visitedId)
+	}
+
+	locations, err := store.locations.getGameLocations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, body, err := testRequest(c.ip, "GET", "/api/explorercompletion", token, "")
+	if err != nil || status != 200 {
+		t.Fatalf("failed to get completion: %d %s %v", status, body, err)
+	}
+	if want := strconv.Itoa(100 / len(locations)); body != want {
+		t.Errorf("got completion %s, want %s", body, want)
+	}
+}
+
+func TestPushSubscriptions(t *testing.T) {
+	ip := testIp(newTestPlayer())
+
+	sub := `{"endpoint": "https://push.example/1", "keys": {"p256dh": "key", "auth": "auth"}}`
+
+	// the test notification fails to send, which doesn't fail the registration
+	if status, body, err := testRequest(ip, "POST", "/api/registernotification", "", sub); err != nil || status != 200 {
+		t.Fatalf("failed to register: %d %s %v", status, body, err)
+	}
+
+	uuid, _, _, err := store.players.getPlayerDataFromIp(context.Background(), ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := store.notifications.getPushSubscriptions(context.Background(), []string{uuid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].Endpoint != "https://push.example/1" || subs[0].Keys.Auth != "auth" {
+		t.Fatalf("got %d subscriptions, want the registered one", len(subs))
+	}
+
+	if status, body, err := testRequest(ip, "POST", "/api/unregisternotification", "", `{"endpoint": "https://push.example/1"}`); err != nil || status != 200 {
+		t.Fatalf("failed to unregister: %d %s %v", status, body, err)
+	}
+
+	subs, err = store.notifications.getPushSubscriptions(context.Background(), []string{uuid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 0 {
+		t.Errorf("got %d subscriptions after unregistering, want none", len(subs))
+	}
+}
+
+func TestReport(t *testing.T) {
+	target := connectTestClient(t, newTestPlayer(), 3)
+	defer target.close()
+
+	target.sendSession("name", "target")
+	target.sendSession("gsay", "reported")
+
+	var msgId string
+	waitFor(t, "the message to be written", func() bool {
+		chatHistory := getTestChatHistory(t, target.ip)
+		for _, msg := range chatHistory.Messages {
+			if msg.Uuid == target.uuid {
+				msgId = msg.MsgId
+				return true
+			}
+		}
+		return false
+	})
+
+	n := newTestPlayer()
+	reporterIp := testIp(n)
+	token := registerTestAccount(t, reporterIp, "reporter"+strconv.Itoa(n))
+
+	report := func(reason string, msgId string) {
+		t.Helper()
+
+		req, _ := json.Marshal(map[string]string{
+			"uuid":         target.uuid,
+			"reason":       reason,
+			"original_msg": "made up",
+			"msg_id":       msgId,
+		})
+		if status, body, err := testRequest(reporterIp, "POST", "/api/report", token, string(req)); err != nil || status != 200 {
+			t.Fatalf("failed to report: %d %s %v", status, body, err)
+		}
+	}
+
+	// a report of a message that doesn't exist is kept without it
+	report("spam", msgId)
+	report("spam", "000000000000")
+
+	ctx := context.Background()
+
+	reasons, err := store.moderation.getReportReasonCounts(ctx, target.uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reasons["spam"] != 2 {
+		t.Errorf("got %d spam reports, want 2", reasons["spam"])
+	}
+
+	contents, err := store.chat.getChatMessageContents(ctx, msgId, target.uuid)
+	if err != nil || contents != "reported" {
+		t.Errorf("got message contents %q, want the reported message", contents)
+	}
+
+	markAsResolved(target.uuid)
+
+	reasons, err = store.moderation.getReportReasonCounts(ctx, target.uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reasons) != 0 {
+		t.Errorf("got %d unresolved reasons after resolving, want none", len(reasons))
+	}
+}
+
+func TestRecords(t *testing.T) {
+	ctx := context.Background()
+	uuid := "records" + strconv.Itoa(newTestPlayer())
+
+	for _, trial := range []struct {
+		seconds int
+		want    bool
+	}{{60, true}, {70, false}, {50, true}} {
+		if got, err := tryWritePlayerTimeTrial(ctx, uuid, 1, trial.seconds); err != nil || got != trial.want {
+			t.Errorf("time trial of %ds: got %t %v, want %t", trial.seconds, got, err, trial.want)
+		}
+	}
+
+	timeTrialRecords, err := getPlayerTimeTrialRecords(ctx, uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timeTrialRecords) != 1 || timeTrialRecords[0].Seconds != 50 {
+		t.Errorf("got %d time trial records, want the best one", len(timeTrialRecords))
+	}
+
+	for _, score := range []struct {
+		score int
+		want  bool
+	}{{0, false}, {10, true}, {5, false}, {20, true}} {
+		if got, err := tryWritePlayerMinigameScore(ctx, uuid, "minigame", score.score); err != nil || got != score.want {
+			t.Errorf("score of %d: got %t %v, want %t", score.score, got, err, score.want)
+		}
+	}
+
+	if score, err := getPlayerMinigameScore(ctx, uuid, "minigame"); err != nil || score != 20 {
+		t.Errorf("got score %d %v, want 20", score, err)
+	}
+	if score, err := getPlayerMinigameScore(ctx, uuid, "other"); err != nil || score != 0 {
+		t.Errorf("got score %d %v for a minigame never played, want 0", score, err)
+	}
+}
@@ -18,7 +18,9 @@
 package server
 
 import (
+	"fmt"
 	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -26,7 +28,8 @@ import (
 )
 
 type Assets struct {
-	maps []int
+	maps     []int
+	mapInfos map[int]*MapInfo
 
 	sprites  map[string]bool
 	systems  map[string]bool
@@ -34,9 +37,21 @@ type Assets struct {
 	pictures map[string]bool
 }
 
+type MapInfo struct {
+	width, height int
+
+	loopHorizontal, loopVertical bool
+
+	// nil if the map's chipset couldn't be read
+	impassable []bool
+}
+
 func getAssets(gamePath string) *Assets {
+	maps := getMaps(gamePath)
+
 	return &Assets{
-		maps: getMaps(gamePath),
+		maps:     maps,
+		mapInfos: getMapInfos(gamePath, maps),
 
 		sprites:  getCharSets(gamePath),
 		systems:  getSystems(gamePath),
@@ -131,6 +146,34 @@ func getMaps(gamePath string) []int {
 	return maps
 }
 
+func getMapInfos(gamePath string, maps []int) map[int]*MapInfo {
+	var chipsets map[int]*Chipset
+	if data, err := os.ReadFile(gamePath + "/RPG_RT.ldb"); err == nil {
+		chipsets, err = parseChipsets(data)
+		if err != nil {
+			log.Printf("failed to parse chipsets: %s", err)
+		}
+	}
+
+	mapInfos := make(map[int]*MapInfo)
+	for _, id := range maps {
+		data, err := os.ReadFile(fmt.Sprintf("%s/Map%04d.lmu", gamePath, id))
+		if err != nil {
+			continue
+		}
+
+		mapInfo, err := parseMap(data, chipsets)
+		if err != nil {
+			log.Printf("failed to parse map %04d: %s", id, err)
+			continue
+		}
+
+		mapInfos[id] = mapInfo
+	}
+
+	return mapInfos
+}
+
 func (a *Assets) IsValidSprite(name string) bool {
 	if name == "" {
 		return true
@@ -154,7 +197,7 @@ func (a *Assets) IsValidSound(name string) bool {
 	if strings.Contains(name, "../") || strings.Contains(name, "..\\") {
 		return false
 	}
-	if config.badSounds[name] {
+	if getConfig().badSounds[name] {
 		return false
 	}
 
@@ -170,11 +213,11 @@ func (a *Assets) IsValidPicture(name string) bool {
 		return false
 	}
 
-	if config.pictures[name] {
+	if getConfig().pictures[name] {
 		return true
 	}
 
-	for _, prefix := range config.picturePrefixes {
+	for _, prefix := range getConfig().picturePrefixes {
 		if strings.HasPrefix(strings.ToLower(name), prefix) {
 			return true
 		}
@@ -183,3 +226,11 @@ func (a *Assets) IsValidPicture(name string) bool {
 	return false
 }
 
+func (a *Assets) IsValidCoords(mapId int, x int, y int) bool {
+	mapInfo, ok := a.mapInfos[mapId]
+	if !ok {
+		return true
+	}
+
+	return x < mapInfo.width && y < mapInfo.height
+}
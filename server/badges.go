@@ -18,27 +18,37 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"maps"
 	"math"
 	"os"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	globalConditions []*Condition
+	badgeData atomic.Pointer[BadgeData]
 
-	conditions             map[string]map[string]*Condition
-	badges                 map[string]map[string]*Badge
 	badgeUnlockPercentages map[string]float32
-	sortedBadgeIds         map[string][]string
 )
 
+// BadgeData holds the badges and conditions of every game. Once published it
+// is never changed, reloads and batch updates publish a new one instead.
+type BadgeData struct {
+	conditions       map[string]map[string]*Condition
+	globalConditions []*Condition
+	badges           map[string]map[string]*Badge
+	sortedBadgeIds   map[string][]string
+}
+
 const (
 	maxPresets = 3
 )
@@ -211,19 +221,90 @@ type TimeTrialRecord struct {
 func initBadges() {
 	setBadgeData()
 
-	scheduler.Every(1).Tuesday().At("20:00").Do(updateActiveBadgesAndConditions)
+	scheduler.Every(1).Tuesday().At("20:00").Do(func() {
+		gameDataMutex.Lock()
+		defer gameDataMutex.Unlock()
+
+		updateActiveBadgesAndConditions()
+	})
 	scheduler.Every(1).Friday().At("20:00").Do(func() {
-		setConditions()
-		setBadges()
-		globalConditions = getGlobalConditions()
-		for _, roomId := range assets.maps {
-			rooms[roomId].conditions = getRoomConditions(roomId)
+		gameDataMutex.Lock()
+		defer gameDataMutex.Unlock()
+
+		for _, err := range reloadBadges() {
+			eprintf("badges", "%s", err)
 		}
-		setBadgeData()
-		updateActiveBadgesAndConditions()
 	})
+}
+
+// getBadgeData returns the current badges and conditions
+func getBadgeData() *BadgeData {
+	if data := badgeData.Load(); data != nil {
+		return data
+	}
+	return &BadgeData{}
+}
+
+// loadBadges reads badges and conditions and publishes them, returning the
+// files that failed to parse. Those keep what they had before.
+func loadBadges() (errs []error) {
+	prev := getBadgeData()
+	data := &BadgeData{}
 
-	updateActiveBadgesAndConditions()
+	var conditionErrs, badgeErrs []error
+	data.conditions, conditionErrs = readConditions(prev.conditions)
+	data.badges, data.sortedBadgeIds, badgeErrs = readBadges(prev.badges, prev.sortedBadgeIds)
+
+	data.applyBatch(getCurrentBatch())
+	publishBadgeData(data)
+
+	return slices.Concat(conditionErrs, badgeErrs)
+}
+
+// reloadBadges rereads badges and conditions, returning the files that failed to parse
+func reloadBadges() (errs []error) {
+	errs = loadBadges()
+
+	setBadgeData()
+
+	return errs
+}
+
+// publishBadgeData makes data the current badge data and hands every room its new conditions
+func publishBadgeData(data *BadgeData) {
+	data.globalConditions = data.getRoomConditions(0)
+
+	badgeData.Store(data)
+
+	for _, roomId := range assets.maps {
+		conditions := data.getRoomConditions(roomId)
+		for _, room := range getRoomInstances(roomId) {
+			room.exec(func() {
+				room.conditions = conditions
+			})
+		}
+	}
+}
+
+// clone copies the badges and conditions so that the copy can be changed before publishing it
+func (d *BadgeData) clone() *BadgeData {
+	return &BadgeData{
+		conditions:     cloneGameEntries(d.conditions),
+		badges:         cloneGameEntries(d.badges),
+		sortedBadgeIds: maps.Clone(d.sortedBadgeIds),
+	}
+}
+
+func cloneGameEntries[T any](games map[string]map[string]*T) map[string]map[string]*T {
+	clone := make(map[string]map[string]*T, len(games))
+	for game, entries := range games {
+		clone[game] = make(map[string]*T, len(entries))
+		for id, entry := range entries {
+			entryCopy := *entry
+			clone[game][id] = &entryCopy
+		}
+	}
+	return clone
 }
 
 func getCurrentBatch() int {
@@ -233,7 +314,7 @@ func getCurrentBatch() int {
 }
 
 func setBadgeData() {
-	if len(badges) == 0 {
+	if len(getBadgeData().badges) == 0 {
 		return
 	}
 
@@ -242,20 +323,27 @@ func setBadgeData() {
 	badgeUnlockPercentages, _ = getBadgeUnlockPercentages()
 	// Use main server to update badge data
 	if isMainServer {
-		if _, ok := badges[config.gameName]; ok {
+		if _, ok := getBadgeData().badges[getConfig().gameName]; ok {
 			// Badge records needed for determining badge game
 			writeGameBadges()
-			updatePlayerBadgeSlotCounts("")
+			updatePlayerBadgeSlotCounts(context.Background(), "")
 		}
 	}
 }
 
+// updateActiveBadgesAndConditions publishes the badges and conditions again
+// with the ones of the current batch no longer in development
 func updateActiveBadgesAndConditions() {
 	logUpdateTask("badge visibility")
 
-	currentBatch := getCurrentBatch()
+	data := getBadgeData().clone()
+	data.applyBatch(getCurrentBatch())
+	publishBadgeData(data)
+}
 
-	for game, gameBadges := range badges {
+// applyBatch marks the badges of later batches and their conditions as in development
+func (d *BadgeData) applyBatch(currentBatch int) {
+	for game, gameBadges := range d.badges {
 		for _, gameBadge := range gameBadges {
 			if gameBadge.Batch == 0 {
 				continue
@@ -265,19 +353,19 @@ func updateActiveBadgesAndConditions() {
 			}
 			switch gameBadge.ReqType {
 			case "tag":
-				if condition, ok := conditions[game][gameBadge.ReqString]; ok {
+				if condition, ok := d.conditions[game][gameBadge.ReqString]; ok {
 					condition.Disabled = gameBadge.Dev
 				}
 			case "tags":
 				for _, tag := range gameBadge.ReqStrings {
-					if condition, ok := conditions[game][tag]; ok {
+					if condition, ok := d.conditions[game][tag]; ok {
 						condition.Disabled = gameBadge.Dev
 					}
 				}
 			case "tagArrays":
 				for _, tags := range gameBadge.ReqStringArrays {
 					for _, tag := range tags {
-						if condition, ok := conditions[game][tag]; ok {
+						if condition, ok := d.conditions[game][tag]; ok {
 							condition.Disabled = gameBadge.Dev
 						}
 					}
@@ -287,19 +375,9 @@ func updateActiveBadgesAndConditions() {
 	}
 }
 
-func getGlobalConditions() (globalConditions []*Condition) {
-	if gameConditions, ok := conditions[config.gameName]; ok {
-		for _, condition := range gameConditions {
-			if condition.Map == 0 {
-				globalConditions = append(globalConditions, condition)
-			}
-		}
-	}
-	return globalConditions
-}
-
-func getRoomConditions(roomId int) (roomConditions []*Condition) {
-	if gameConditions, ok := conditions[config.gameName]; ok {
+// getRoomConditions returns the conditions of the room, or the global ones for room 0
+func (d *BadgeData) getRoomConditions(roomId int) (roomConditions []*Condition) {
+	if gameConditions, ok := d.conditions[getConfig().gameName]; ok {
 		for _, condition := range gameConditions {
 			if condition.Map == roomId {
 				roomConditions = append(roomConditions, condition)
@@ -317,7 +395,7 @@ func (c *RoomClient) checkRoomConditions(trigger string, value string) {
 		return
 	}
 
-	for _, condition := range globalConditions {
+	for _, condition := range getBadgeData().globalConditions {
 		c.checkCondition(condition, 0, nil, trigger, value)
 	}
 
@@ -326,6 +404,38 @@ func (c *RoomClient) checkRoomConditions(trigger string, value string) {
 	}
 }
 
+// writeTag unlocks the tag for the client off the room's goroutine
+func (c *RoomClient) writeTag(conditionId string) {
+	uuid, mapId, tags := c.session.uuid, c.mapId, c.tags
+
+	runDetached(c.getCtx(), func(ctx context.Context) {
+		success, err := tryWritePlayerTag(ctx, uuid, conditionId, tags)
+		if err != nil {
+			writeErrLog(uuid, mapId, err.Error())
+			return
+		}
+		if success {
+			c.outbox.send(buildMsg("b"))
+		}
+	})
+}
+
+// writeTimeTrial records the time trial for the client's room off the room's goroutine
+func (c *RoomClient) writeTimeTrial(seconds int) {
+	uuid, mapId, roomId := c.session.uuid, c.mapId, c.room.id
+
+	runDetached(c.getCtx(), func(ctx context.Context) {
+		success, err := tryWritePlayerTimeTrial(ctx, uuid, roomId, seconds)
+		if err != nil {
+			writeErrLog(uuid, mapId, err.Error())
+			return
+		}
+		if success {
+			c.outbox.send(buildMsg("b"))
+		}
+	})
+}
+
 func (c *RoomClient) checkCondition(condition *Condition, roomId int, minigames []*Minigame, trigger string, value string) {
 	if condition.Disabled && c.session.rank < 2 {
 		return
@@ -358,7 +468,7 @@ func (c *RoomClient) checkCondition(condition *Condition, roomId int, minigames
 					switchSyncType = 1
 				}
 			}
-			c.outbox <- buildMsg("ss", switchId, switchSyncType)
+			c.outbox.send(buildMsg("ss", switchId, switchSyncType))
 		} else if condition.VarId > 0 || len(condition.VarIds) != 0 {
 			varId := condition.VarId
 			if len(condition.VarIds) != 0 {
@@ -385,19 +495,13 @@ func (c *RoomClient) checkCondition(condition *Condition, roomId int, minigames
 					varSyncType = 1
 				}
 			}
-			c.outbox <- buildMsg("sv", varId, varSyncType)
+			c.outbox.send(buildMsg("sv", varId, varSyncType))
 		} else if c.checkConditionCoords(condition) {
-			timeTrial := condition.TimeTrial && config.gameName == "2kki"
+			timeTrial := condition.TimeTrial && getConfig().gameName == "2kki"
 			if !timeTrial {
-				success, err := tryWritePlayerTag(c.session.uuid, condition.ConditionId)
-				if err != nil {
-					writeErrLog(c.session.uuid, c.mapId, err.Error())
-				}
-				if success {
-					c.outbox <- buildMsg("b")
-				}
+				c.writeTag(condition.ConditionId)
 			} else {
-				c.outbox <- buildMsg("ss", 1430, 0)
+				c.outbox.send(buildMsg("ss", 1430, 0))
 			}
 		}
 	} else if trigger == "" {
@@ -410,18 +514,18 @@ func (c *RoomClient) checkCondition(condition *Condition, roomId int, minigames
 			}
 			for _, value := range values {
 				if condition.Trigger == "picture" {
-					c.outbox <- buildMsg("sp", value)
+					c.outbox.send(buildMsg("sp", value))
 				} else {
 					valueInt, err := strconv.Atoi(value)
 					if err != nil {
-						writeErrLog(c.session.ip, strconv.Itoa(roomId), err.Error())
+						writeErrLog(c.session.getIp(), strconv.Itoa(roomId), err.Error())
 						continue
 					}
 
 					var eventTriggerType int
 					if condition.Trigger == "eventAction" {
-						eventVms, hasGameVms := gameEventVms[config.gameName]
-						if hasGameVms && config.gameName == currentEventVmGame && roomId > 0 && roomId == currentEventVmMapId {
+						eventVms, hasGameVms := getEventVms()[getConfig().gameName]
+						if hasGameVms && getConfig().gameName == currentEventVmGame && roomId > 0 && roomId == currentEventVmMapId {
 							if vmGroups, hasVms := eventVms[roomId]; hasVms {
 								var skipEvSync bool
 								for _, vmGroup := range vmGroups {
@@ -442,7 +546,7 @@ func (c *RoomClient) checkCondition(condition *Condition, roomId int, minigames
 						eventTriggerType = 1
 					}
 
-					c.outbox <- buildMsg("sev", value, eventTriggerType)
+					c.outbox.send(buildMsg("sev", value, eventTriggerType))
 				}
 			}
 		} else if condition.Trigger == "coords" {
@@ -458,7 +562,7 @@ func (c *RoomClient) checkConditionCoords(condition *Condition) bool {
 			((condition.MapY1 == -1 || condition.MapY1 <= c.y) && (condition.MapY2 == -1 || condition.MapY2 >= c.y)))
 }
 
-func getPlayerBadgeData(playerUuid string, playerRank int, playerTags []string, account bool, simple bool) (playerBadges []*PlayerBadge, err error) {
+func getPlayerBadgeData(ctx context.Context, playerUuid string, playerRank int, playerTags []string, account bool, simple bool) (playerBadges []*PlayerBadge, err error) {
 	var playerExp int
 	var playerEventLocationCount int
 	var playerEventLocationCompletion int
@@ -469,31 +573,31 @@ func getPlayerBadgeData(playerUuid string, playerRank int, playerTags []string,
 	var medalCounts [5]int
 
 	if account {
-		playerExp, err = getPlayerTotalEventExp(playerUuid)
+		playerExp, err = getPlayerTotalEventExp(ctx, playerUuid)
 		if err != nil {
 			return playerBadges, err
 		}
-		playerEventLocationCount, err = getPlayerEventLocationCount(playerUuid)
+		playerEventLocationCount, err = getPlayerEventLocationCount(ctx, playerUuid)
 		if err != nil {
 			return playerBadges, err
 		}
-		playerEventLocationCompletion, err = getPlayerEventLocationCompletion(playerUuid)
+		playerEventLocationCompletion, err = getPlayerEventLocationCompletion(ctx, playerUuid)
 		if err != nil {
 			return playerBadges, err
 		}
-		playerEventVmCount, err = getPlayerEventVmCount(playerUuid)
+		playerEventVmCount, err = getPlayerEventVmCount(ctx, playerUuid)
 		if err != nil {
 			return playerBadges, err
 		}
-		yume2kkiLocationCompletion, err = getPlayerGameLocationCompletion(playerUuid, "2kki")
+		yume2kkiLocationCompletion, err = getPlayerGameLocationCompletion(ctx, playerUuid, "2kki")
 		if err != nil {
 			return playerBadges, err
 		}
-		timeTrialRecords, err = getPlayerTimeTrialRecords(playerUuid)
+		timeTrialRecords, err = getPlayerTimeTrialRecords(ctx, playerUuid)
 		if err != nil {
 			return playerBadges, err
 		}
-		medalCounts = getPlayerMedals(playerUuid)
+		medalCounts = getPlayerMedals(ctx, playerUuid)
 	}
 
 	playerBadgesMap := make(map[string]*PlayerBadge)
@@ -502,13 +606,15 @@ func getPlayerBadgeData(playerUuid string, playerRank int, playerTags []string,
 	var playerUnlockedBadgeIds []string
 
 	if account {
-		playerUnlockedBadgeIds, err = getPlayerUnlockedBadgeIds(playerUuid)
+		playerUnlockedBadgeIds, err = getPlayerUnlockedBadgeIds(ctx, playerUuid)
 		if err != nil {
 			return playerBadges, err
 		}
 	}
 
-	for game, gameBadges := range badges {
+	data := getBadgeData()
+
+	for game, gameBadges := range data.badges {
 		for badgeId, gameBadge := range gameBadges {
 			if gameBadge.Dev && playerRank == 0 {
 				continue
@@ -630,10 +736,10 @@ func getPlayerBadgeData(playerUuid string, playerRank int, playerTags []string,
 			playerBadgesMap[badgeId] = playerBadge
 		}
 
-		for _, badgeId := range sortedBadgeIds[game] {
+		for _, badgeId := range data.sortedBadgeIds[game] {
 			if playerBadge, ok := playerBadgesMap[badgeId]; ok {
 				if playerBadge.Secret {
-					if badge, ok := badges[playerBadge.Game][badgeId]; ok {
+					if badge, ok := data.badges[playerBadge.Game][badgeId]; ok {
 						parentBadgeId := badge.Parent
 						if parentBadgeId != "" {
 							playerBadge.Secret = !playerBadgesMap[parentBadgeId].Unlocked
@@ -658,7 +764,7 @@ func getPlayerBadgeData(playerUuid string, playerRank int, playerTags []string,
 				}
 			}
 			if !unlocked {
-				err := unlockPlayerBadge(playerUuid, badge.BadgeId)
+				err := unlockPlayerBadge(ctx, playerUuid, badge.BadgeId)
 				if err != nil {
 					return playerBadges, err
 				}
@@ -674,15 +780,15 @@ func getPlayerBadgeData(playerUuid string, playerRank int, playerTags []string,
 			playerBadgeA := badgeCountPlayerBadges[a]
 			playerBadgeB := badgeCountPlayerBadges[b]
 
-			return badges[playerBadgeA.Game][playerBadgeA.BadgeId].ReqInt < badges[playerBadgeB.Game][playerBadgeB.BadgeId].ReqInt
+			return data.badges[playerBadgeA.Game][playerBadgeA.BadgeId].ReqInt < data.badges[playerBadgeB.Game][playerBadgeB.BadgeId].ReqInt
 		})
 		for _, playerBadge := range badgeCountPlayerBadges {
-			reqBadgeCount := badges[playerBadge.Game][playerBadge.BadgeId].ReqInt
+			reqBadgeCount := data.badges[playerBadge.Game][playerBadge.BadgeId].ReqInt
 			playerBadge.Goals = playerBadgeCount
 			playerBadge.GoalsTotal = reqBadgeCount
 			if !playerBadge.Unlocked && playerBadgeCount >= reqBadgeCount {
 				playerBadge.Unlocked = true
-				err := unlockPlayerBadge(playerUuid, playerBadge.BadgeId)
+				err := unlockPlayerBadge(ctx, playerUuid, playerBadge.BadgeId)
 				if err != nil {
 					return playerBadges, err
 				}
@@ -693,15 +799,15 @@ func getPlayerBadgeData(playerUuid string, playerRank int, playerTags []string,
 	} else if !simple {
 		for _, playerBadge := range badgeCountPlayerBadges {
 			playerBadge.Goals = playerBadgeCount
-			playerBadge.GoalsTotal = badges[playerBadge.Game][playerBadge.BadgeId].ReqInt
+			playerBadge.GoalsTotal = data.badges[playerBadge.Game][playerBadge.BadgeId].ReqInt
 		}
 	}
 
 	return playerBadges, nil
 }
 
-func getSimplePlayerBadgeData(playerUuid string, playerRank int, playerTags []string, account bool) (playerBadges []*SimplePlayerBadge, err error) {
-	badgeData, err := getPlayerBadgeData(playerUuid, playerRank, playerTags, account, true)
+func getSimplePlayerBadgeData(ctx context.Context, playerUuid string, playerRank int, playerTags []string, account bool) (playerBadges []*SimplePlayerBadge, err error) {
+	badgeData, err := getPlayerBadgeData(ctx, playerUuid, playerRank, playerTags, account, true)
 	if err != nil {
 		return playerBadges, err
 	}
@@ -714,8 +820,8 @@ func getSimplePlayerBadgeData(playerUuid string, playerRank int, playerTags []st
 	return playerBadges, nil
 }
 
-func getPlayerNewUnlockedBadgeIds(playerUuid string, playerRank int, playerTags []string) (badgeIds []string, err error) {
-	badgeData, err := getPlayerBadgeData(playerUuid, playerRank, playerTags, true, true)
+func getPlayerNewUnlockedBadgeIds(ctx context.Context, playerUuid string, playerRank int, playerTags []string) (badgeIds []string, err error) {
+	badgeData, err := getPlayerBadgeData(ctx, playerUuid, playerRank, playerTags, true, true)
 	if err != nil {
 		return badgeIds, err
 	}
@@ -729,14 +835,16 @@ func getPlayerNewUnlockedBadgeIds(playerUuid string, playerRank int, playerTags
 	return badgeIds, nil
 }
 
-func setConditions() {
+// readConditions reads the conditions for every game and returns the files that failed
+// to parse. Conditions that can't be read are copied from prevConditions.
+func readConditions(prevConditions map[string]map[string]*Condition) (conditionConfig map[string]map[string]*Condition, errs []error) {
 	logUpdateTask("conditions")
 
-	conditionConfig := make(map[string]map[string]*Condition)
+	conditionConfig = make(map[string]map[string]*Condition)
 
 	gameConditionDirs, err := os.ReadDir("badges/conditions/")
 	if err != nil {
-		return
+		return cloneGameEntries(prevConditions), []error{err}
 	}
 
 	for _, gameConditionsDir := range gameConditionDirs {
@@ -746,20 +854,32 @@ func setConditions() {
 			configPath := "badges/conditions/" + gameId + "/"
 			conditionConfigs, err := os.ReadDir(configPath)
 			if err != nil {
+				errs = append(errs, err)
+				for conditionId, condition := range prevConditions[gameId] {
+					conditionCopy := *condition
+					conditionConfig[gameId][conditionId] = &conditionCopy
+				}
 				continue
 			}
 
 			for _, conditionConfigFile := range conditionConfigs {
 				var condition Condition
 
+				conditionId := conditionConfigFile.Name()[:len(conditionConfigFile.Name())-5]
+
 				data, err := os.ReadFile(configPath + conditionConfigFile.Name())
 				if err != nil {
-					continue
+					errs = append(errs, err)
+				} else if err = json.Unmarshal(data, &condition); err != nil {
+					errs = append(errs, fmt.Errorf("%s%s: %w", configPath, conditionConfigFile.Name(), err))
 				}
 
-				err = json.Unmarshal(data, &condition)
-				if err == nil {
-					conditionId := conditionConfigFile.Name()[:len(conditionConfigFile.Name())-5]
+				if err != nil {
+					if prevCondition, ok := prevConditions[gameId][conditionId]; ok {
+						conditionCopy := *prevCondition
+						conditionConfig[gameId][conditionId] = &conditionCopy
+					}
+				} else {
 					condition.ConditionId = conditionId
 					if condition.VarId > 0 {
 						if condition.VarOp == "" {
@@ -781,18 +901,20 @@ func setConditions() {
 		}
 	}
 
-	conditions = conditionConfig
+	return conditionConfig, errs
 }
 
-func setBadges() {
+// readBadges reads the badges for every game and returns the files that failed
+// to parse. Badges that can't be read are copied from prevBadges.
+func readBadges(prevBadges map[string]map[string]*Badge, prevSortedBadgeIds map[string][]string) (badgeConfig map[string]map[string]*Badge, sortedBadgeConfigIds map[string][]string, errs []error) {
 	logUpdateTask("badges")
 
-	badgeConfig := make(map[string]map[string]*Badge)
-	sortedBadgeIds = make(map[string][]string)
+	badgeConfig = make(map[string]map[string]*Badge)
+	sortedBadgeConfigIds = make(map[string][]string)
 
 	gameBadgeDirs, err := os.ReadDir("badges/data/")
 	if err != nil {
-		return
+		return cloneGameEntries(prevBadges), maps.Clone(prevSortedBadgeIds), []error{err}
 	}
 
 	for _, gameBadgesDir := range gameBadgeDirs {
@@ -803,23 +925,37 @@ func setBadges() {
 			configPath := "badges/data/" + gameId + "/"
 			badgeConfigs, err := os.ReadDir(configPath)
 			if err != nil {
+				errs = append(errs, err)
+				for badgeId, badge := range prevBadges[gameId] {
+					badgeCopy := *badge
+					badgeConfig[gameId][badgeId] = &badgeCopy
+				}
+				sortedBadgeConfigIds[gameId] = prevSortedBadgeIds[gameId]
 				continue
 			}
 
 			for _, badgeConfigFile := range badgeConfigs {
 				var badge Badge
 
+				badgeId := badgeConfigFile.Name()[:len(badgeConfigFile.Name())-5]
+
 				data, err := os.ReadFile(configPath + badgeConfigFile.Name())
 				if err != nil {
-					continue
+					errs = append(errs, err)
+				} else if err = json.Unmarshal(data, &badge); err != nil {
+					errs = append(errs, fmt.Errorf("%s%s: %w", configPath, badgeConfigFile.Name(), err))
 				}
 
-				err = json.Unmarshal(data, &badge)
-				if err == nil {
-					badgeId := badgeConfigFile.Name()[:len(badgeConfigFile.Name())-5]
-					badgeConfig[gameId][badgeId] = &badge
-					badgeIds = append(badgeIds, badgeId)
+				if err != nil {
+					prevBadge, ok := prevBadges[gameId][badgeId]
+					if !ok {
+						continue
+					}
+					badge = *prevBadge
 				}
+
+				badgeConfig[gameId][badgeId] = &badge
+				badgeIds = append(badgeIds, badgeId)
 			}
 
 			sort.Slice(badgeIds, func(a, b int) bool {
@@ -848,27 +984,15 @@ func setBadges() {
 				return badgeA.MapOrder < badgeB.MapOrder
 			})
 
-			sortedBadgeIds[gameId] = badgeIds
+			sortedBadgeConfigIds[gameId] = badgeIds
 		}
 	}
 
-	currentBatch := getCurrentBatch()
-	for _, gameBadges := range badgeConfig {
-		for _, gameBadge := range gameBadges {
-			if gameBadge.Batch == 0 {
-				continue
-			}
-			if !gameBadge.Dev {
-				gameBadge.Dev = gameBadge.Batch > currentBatch
-			}
-		}
-	}
-
-	badges = badgeConfig
+	return badgeConfig, sortedBadgeConfigIds, errs
 }
 
-func getPlayerBadgeSlotCounts(playerName string) (badgeSlotRows int, badgeSlotCols int) {
-	err := db.QueryRow("SELECT badgeSlotRows, badgeSlotCols FROM accounts WHERE user = ?", playerName).Scan(&badgeSlotRows, &badgeSlotCols)
+func getPlayerBadgeSlotCounts(ctx context.Context, playerName string) (badgeSlotRows int, badgeSlotCols int) {
+	badgeSlotRows, badgeSlotCols, err := store.badges.getPlayerBadgeSlotCounts(ctx, playerName)
 	if err != nil {
 		return 1, 3
 	}
@@ -876,78 +1000,52 @@ func getPlayerBadgeSlotCounts(playerName string) (badgeSlotRows int, badgeSlotCo
 	return badgeSlotRows, badgeSlotCols
 }
 
-func updatePlayerBadgeSlotCounts(uuid string) (err error) {
-	query := "UPDATE accounts JOIN (SELECT pb.uuid, SUM(b.bp) bp, COUNT(b.badgeId) bc FROM playerBadges pb JOIN badges b ON b.badgeId = pb.badgeId AND b.hidden = 0 GROUP BY pb.uuid) AS pb ON pb.uuid = accounts.uuid " +
-		"SET badgeSlotRows = CASE WHEN bp < 300 THEN 1 WHEN bp < 1000 THEN 2 WHEN bp < 2000 THEN 3 WHEN bp < 4000 THEN 4 WHEN bp < 7500 THEN 5 WHEN bp < 12500 THEN 6 WHEN bp < 20000 THEN 7 WHEN bp < 30000 THEN 8 WHEN bp < 50000 THEN 9 ELSE 10 END, " +
-		"badgeSlotCols = CASE WHEN bc < 50 THEN 3 WHEN bc < 150 THEN 4 WHEN bc < 300 THEN 5 WHEN bc < 500 THEN 6 ELSE 7 END, " +
-		"screenshotLimit = GREATEST(CASE WHEN bp < 100 THEN 10 WHEN bp < 250 THEN 15 WHEN bp < 500 THEN 20 WHEN bp < 1000 THEN 25 WHEN bp < 2500 THEN 30 WHEN bp < 5000 THEN 35 WHEN bp < 7500 THEN 40 WHEN bp < 10000 THEN 45 WHEN bp < 12500 THEN 50 WHEN bp < 15000 THEN 55 WHEN bp < 17500 THEN 60 WHEN bp < 20000 THEN 65 WHEN bp < 25000 THEN 70 ELSE 75 END, screenshotLimit)"
-	if uuid == "" {
-		_, err = db.Exec(query)
-	} else {
-		query += " WHERE accounts.uuid = ?"
-		_, err = db.Exec(query, uuid)
-	}
+func updatePlayerBadgeSlotCounts(ctx context.Context, uuid string) (err error) {
+	err = store.badges.updatePlayerBadgeSlotCounts(ctx, uuid)
 	if err != nil {
 		return err
 	}
 
+	invalidatePlayerCache(uuid)
+
 	return nil
 }
 
-func setPlayerBadge(uuid string, badge string) error {
+func setPlayerBadge(ctx context.Context, uuid string, badge string) error {
 	if client, ok := clients.Load(uuid); ok {
 		client.badge = badge
 	}
 
-	_, err := db.Exec("UPDATE accounts SET badge = ? WHERE uuid = ?", badge, uuid)
+	err := store.badges.setPlayerBadge(ctx, uuid, badge)
 	if err != nil {
 		return err
 	}
 
+	invalidatePlayerCache(uuid)
+
 	return nil
 }
 
-func getPlayerBadgeSlots(playerName string, badgeSlotRows int, badgeSlotCols int) (badgeSlots [][]string, err error) {
-	results, err := db.Query("SELECT pb.badgeId, pb.slotRow, pb.slotCol FROM playerBadges pb JOIN accounts a ON a.uuid = pb.uuid WHERE a.user = ? AND pb.slotRow BETWEEN 1 AND ? AND pb.slotCol BETWEEN 1 AND ? ORDER BY pb.slotRow, pb.slotCol", playerName, badgeSlotRows, badgeSlotCols)
+func getPlayerBadgeSlots(ctx context.Context, playerName string, badgeSlotRows int, badgeSlotCols int) (badgeSlots [][]string, err error) {
+	slotted, err := store.badges.getPlayerBadgeSlots(ctx, playerName, badgeSlotRows, badgeSlotCols)
 	if err != nil {
 		return badgeSlots, err
 	}
 
-	defer results.Close()
-
-	var badgeId string
-	var badgeRow int
-	var badgeCol int
+	var i int
 
 	for r := 1; r <= badgeSlotRows; r++ {
 		var badgeSlotRow []string
 		for c := 1; c <= badgeSlotCols; c++ {
-			if badgeRow > r || (badgeRow == r && badgeCol >= c) {
-				if badgeRow == r && badgeCol == c {
-					badgeSlotRow = append(badgeSlotRow, badgeId)
-				} else {
-					badgeSlotRow = append(badgeSlotRow, "null")
-				}
-			} else {
-				for {
-					if !results.Next() {
-						break
-					}
-					err := results.Scan(&badgeId, &badgeRow, &badgeCol)
-					if err != nil {
-						break
-					}
+			// skip past slots, the rows are ordered by row and column
+			for i < len(slotted) && (slotted[i].Row < r || (slotted[i].Row == r && slotted[i].Col < c)) {
+				i++
+			}
 
-					if badgeRow > r || (badgeRow == r && badgeCol >= c) {
-						if badgeRow == r && badgeCol == c {
-							badgeSlotRow = append(badgeSlotRow, badgeId)
-						}
-						break
-					}
-				}
-				if len(badgeSlotRow) < c {
-					badgeSlotRow = append(badgeSlotRow, "null")
-				}
+			if i < len(slotted) && slotted[i].Row == r && slotted[i].Col == c {
+				badgeSlotRow = append(badgeSlotRow, slotted[i].BadgeId)
+			} else {
+				badgeSlotRow = append(badgeSlotRow, "null")
 			}
 		}
 		badgeSlots = append(badgeSlots, badgeSlotRow)
@@ -956,49 +1054,16 @@ func getPlayerBadgeSlots(playerName string, badgeSlotRows int, badgeSlotCols int
 	return badgeSlots, nil
 }
 
-func setPlayerBadgeSlot(uuid string, badgeId string, slotRow int, slotCol int) error {
-	var slotCurrentBadgeId string
-	err := db.QueryRow("SELECT badgeId FROM playerBadges WHERE uuid = ? AND slotRow = ? AND slotCol = ? LIMIT 1", uuid, slotRow, slotCol).Scan(&slotCurrentBadgeId)
-	if err != nil {
-		if err != sql.ErrNoRows {
-			return err
-		}
-	} else if slotCurrentBadgeId == badgeId {
-		return nil
-	} else {
-		if badgeId != "null" {
-			var badgeCurrentSlotRow, badgeCurrentSlotCol int
-			err := db.QueryRow("SELECT slotRow, slotCol FROM playerBadges WHERE uuid = ? AND badgeId = ? LIMIT 1", uuid, badgeId).Scan(&badgeCurrentSlotRow, &badgeCurrentSlotCol)
-			if err != nil && err != sql.ErrNoRows {
-				return err
-			} else {
-				_, err = db.Exec("UPDATE playerBadges SET slotRow = ?, slotCol = ? WHERE uuid = ? AND badgeId = ?", badgeCurrentSlotRow, badgeCurrentSlotCol, uuid, slotCurrentBadgeId)
-				if err != nil && err != sql.ErrNoRows {
-					return err
-				}
-			}
-		} else {
-			_, err = db.Exec("UPDATE playerBadges SET slotRow = 0, slotCol = 0 WHERE uuid = ? AND slotRow = ? AND slotCol = ?", uuid, slotRow, slotCol)
-			if err != nil && err != sql.ErrNoRows {
-				return err
-			}
-		}
-	}
-
-	_, err = db.Exec("UPDATE playerBadges SET slotRow = ?, slotCol = ? WHERE uuid = ? AND badgeId = ?", slotRow, slotCol, uuid, badgeId)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func setPlayerBadgeSlot(ctx context.Context, uuid string, badgeId string, slotRow int, slotCol int) error {
+	return store.badges.setPlayerBadgeSlot(ctx, uuid, badgeId, slotRow, slotCol)
 }
 
-func getPlayerBadgePreset(uuid string, presetId int) (preset string, err error) {
+func getPlayerBadgePreset(ctx context.Context, uuid string, presetId int) (preset string, err error) {
 	if !(presetId >= 0 && presetId < maxPresets) {
 		return "null", errors.New("invalid preset")
 	}
 
-	err = db.QueryRow("SELECT data FROM playerBadgePresets WHERE uuid = ? AND presetId = ?", uuid, presetId).Scan(&preset)
+	preset, err = store.badges.getPlayerBadgePreset(ctx, uuid, presetId)
 	switch err {
 	case sql.ErrNoRows:
 		return "null", nil
@@ -1010,18 +1075,17 @@ func getPlayerBadgePreset(uuid string, presetId int) (preset string, err error)
 	}
 }
 
-func setPlayerBadgePreset(uuid string, presetId int, data string) (err error) {
+func setPlayerBadgePreset(ctx context.Context, uuid string, presetId int, data string) (err error) {
 	if !(presetId >= 0 && presetId < maxPresets) {
 		return errors.New("invalid preset")
 	}
 
-	_, err = db.Exec("REPLACE INTO playerBadgePresets (uuid, presetId, data) VALUES (?, ?, ?)", uuid, presetId, data)
-	return
+	return store.badges.setPlayerBadgePreset(ctx, uuid, presetId, data)
 }
 
-func applyPlayerBadgePreset(uuid string, presetId, slotRows, slotCols int) (err error) {
+func applyPlayerBadgePreset(ctx context.Context, uuid string, presetId, slotRows, slotCols int) (err error) {
 	var raw string
-	if raw, err = getPlayerBadgePreset(uuid, presetId); err != nil {
+	if raw, err = getPlayerBadgePreset(ctx, uuid, presetId); err != nil {
 		return
 	}
 
@@ -1030,93 +1094,42 @@ func applyPlayerBadgePreset(uuid string, presetId, slotRows, slotCols int) (err
 		return
 	}
 
-	tx, err := db.Begin()
-	if err != nil {
-		return
-	}
-	defer func() {
-		if err != nil {
-			err = errors.Join(err, tx.Rollback())
-		} else {
-			err = tx.Commit()
-		}
-	}()
-
-	for r := range slotRows {
-		if r >= len(preset) {
-			if _, err = db.Exec("UPDATE playerBadges SET slotRow = 0, slotCol = 0 WHERE uuid = ? AND slotRow >= ?", uuid, r); err != nil {
-				return
-			}
-			continue
-		}
-
-		row := preset[r]
-		for c := range slotCols {
-			if c >= len(row) {
-				if _, err = db.Exec("UPDATE playerBadges SET slotRow = 0, slotCol = 0 WHERE uuid = ? AND slotRow = ? AND slotCol >= ?", uuid, r, c); err != nil {
-					return
-				}
-				continue
-			}
-
-			badgeId := row[c]
-			if err = setPlayerBadgeSlot(uuid, badgeId, r+1, c+1); err != nil {
-				return
-			}
-		}
-	}
-
-	return
+	return store.badges.applyPlayerBadgePreset(ctx, uuid, preset, slotRows, slotCols)
 }
 
 func writeGameBadges() error {
-	_, err := db.Exec("TRUNCATE TABLE badges")
-	if err != nil {
-		return err
-	}
-
-	for badgeGame := range badges {
-		for badgeId, badge := range badges[badgeGame] {
-			if _, ok := badges[config.gameName]; ok {
-				badgeUnlockPercentage := badgeUnlockPercentages[badgeId]
-				_, err = db.Exec("INSERT INTO badges (badgeId, game, bp, hidden, percentUnlocked) VALUES (?, ?, ?, ?, ?)", badgeId, badgeGame, badge.Bp, badge.Hidden || badge.Dev, badgeUnlockPercentage)
-				if err != nil {
-					return err
-				}
+	var gameBadges []BadgeRecord
+
+	data := getBadgeData()
+
+	for badgeGame := range data.badges {
+		for badgeId, badge := range data.badges[badgeGame] {
+			if _, ok := data.badges[getConfig().gameName]; ok {
+				gameBadges = append(gameBadges, BadgeRecord{
+					BadgeId:         badgeId,
+					Game:            badgeGame,
+					Bp:              badge.Bp,
+					Hidden:          badge.Hidden || badge.Dev,
+					PercentUnlocked: badgeUnlockPercentages[badgeId],
+				})
 			}
 		}
 	}
 
-	return nil
+	return store.badges.writeBadges(context.Background(), gameBadges)
 }
 
-func getPlayerUnlockedBadgeIds(playerUuid string) (unlockedBadgeIds []string, err error) {
-	results, err := db.Query("SELECT badgeId FROM playerBadges WHERE uuid = ?", playerUuid)
-	if err != nil {
-		return unlockedBadgeIds, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var badgeId string
-		err := results.Scan(&badgeId)
-		if err != nil {
-			return unlockedBadgeIds, err
-		}
-		unlockedBadgeIds = append(unlockedBadgeIds, badgeId)
-	}
-
-	return unlockedBadgeIds, nil
+func getPlayerUnlockedBadgeIds(ctx context.Context, playerUuid string) (unlockedBadgeIds []string, err error) {
+	return store.badges.getPlayerUnlockedBadgeIds(ctx, playerUuid)
 }
 
-func unlockPlayerBadge(playerUuid string, badgeId string) error {
-	_, err := db.Exec("INSERT INTO playerBadges (uuid, badgeId, timestampUnlocked) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE badgeId = badgeId", playerUuid, badgeId, time.Now())
+func unlockPlayerBadge(ctx context.Context, playerUuid string, badgeId string) error {
+	err := store.badges.unlockPlayerBadge(ctx, playerUuid, badgeId)
 	if err != nil {
 		return err
 	}
 
-	badgeUnlockPercentages[badgeId], err = getBadgeUnlockPercentage(badgeId)
+	badgeUnlockPercentages[badgeId], err = getBadgeUnlockPercentage(ctx, badgeId)
 	if err != nil {
 		return err
 	}
@@ -1124,55 +1137,21 @@ func unlockPlayerBadge(playerUuid string, badgeId string) error {
 	return nil
 }
 
-func removePlayerBadge(playerUuid string, badgeId string) error {
-	var slotRow int
-	var slotCol int
-
-	err := db.QueryRow("SELECT slotRow, slotCol FROM playerBadges WHERE uuid = ? AND badgeId = ?", playerUuid, badgeId).Scan(&slotRow, &slotCol)
+func removePlayerBadge(ctx context.Context, playerUuid string, badgeId string) error {
+	err := store.badges.removePlayerBadge(ctx, playerUuid, badgeId)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec("DELETE FROM playerBadges WHERE uuid = ? AND badgeId = ?", playerUuid, badgeId)
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec("UPDATE accounts SET badge = 'null' WHERE uuid = ? AND badge = ?", playerUuid, badgeId)
-	if err != nil {
-		return err
-	}
+	invalidatePlayerCache(playerUuid)
 
 	return nil
 }
 
-func getBadgeUnlockPercentage(badgeId string) (unlockPercentage float32, err error) {
-	err = db.QueryRow("SELECT COALESCE(COUNT(b.uuid) / aa.count, 0) * 100 FROM playerBadges b JOIN accounts a ON a.uuid = b.uuid JOIN (SELECT COUNT(aa.uuid) count FROM accounts aa WHERE EXISTS(SELECT * FROM playerBadges aab WHERE aab.uuid = aa.uuid AND aa.inactive = 0)) aa WHERE EXISTS(SELECT * FROM playerBadges ab WHERE ab.uuid = a.uuid AND a.inactive = 0) AND b.badgeId = ?", badgeId).Scan(&unlockPercentage)
-
-	return unlockPercentage, err
+func getBadgeUnlockPercentage(ctx context.Context, badgeId string) (unlockPercentage float32, err error) {
+	return store.badges.getBadgeUnlockPercentage(ctx, badgeId)
 }
 
 func getBadgeUnlockPercentages() (unlockPercentages map[string]float32, err error) {
-	results, err := db.Query("SELECT b.badgeId, (COUNT(b.uuid) / aa.count) * 100 FROM playerBadges b JOIN accounts a ON a.uuid = b.uuid JOIN (SELECT COUNT(aa.uuid) count FROM accounts aa WHERE EXISTS(SELECT * FROM playerBadges aab WHERE aab.uuid = aa.uuid AND aa.inactive = 0)) aa WHERE EXISTS(SELECT * FROM playerBadges ab WHERE ab.uuid = a.uuid AND a.inactive = 0) GROUP BY b.badgeId")
-	if err != nil {
-		return unlockPercentages, err
-	}
-
-	defer results.Close()
-
-	unlockPercentages = make(map[string]float32)
-
-	for results.Next() {
-		var badgeId string
-		var percentUnlocked float32
-
-		err := results.Scan(&badgeId, &percentUnlocked)
-		if err != nil {
-			return unlockPercentages, err
-		}
-
-		unlockPercentages[badgeId] = percentUnlocked
-	}
-
-	return unlockPercentages, nil
+	return store.badges.getBadgeUnlockPercentages(context.Background())
 }
@@ -0,0 +1,108 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"os"
+	"testing"
+)
+
+func writeTestGameFile(t *testing.T, path string, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getTestRoomConditions returns the conditions room 1 has once it handled everything sent to it so far
+func getTestRoomConditions() (conditions []*Condition) {
+	rooms[1].call(func() {
+		conditions = rooms[1].conditions
+	})
+
+	return conditions
+}
+
+func TestLoadBadges(t *testing.T) {
+	conditionsPath := "badges/conditions/" + getConfig().gameName + "/"
+	badgesPath := "badges/data/" + getConfig().gameName + "/"
+
+	for _, path := range []string{conditionsPath, badgesPath} {
+		if err := os.MkdirAll(path, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		os.RemoveAll("badges")
+		publishBadgeData(&BadgeData{})
+	}()
+
+	writeTestGameFile(t, conditionsPath+"room.json", `{"map": 1, "trigger": "coords"}`)
+	writeTestGameFile(t, conditionsPath+"global.json", `{"map": 0, "trigger": "coords"}`)
+	// badges of a batch far ahead are still in development, and so are their conditions
+	writeTestGameFile(t, badgesPath+"badge.json", `{"reqType": "tag", "reqString": "room", "batch": 100000}`)
+
+	if errs := loadBadges(); len(errs) != 0 {
+		t.Fatalf("failed to load badges: %v", errs)
+	}
+
+	loaded := getBadgeData()
+	if len(loaded.globalConditions) != 1 || loaded.globalConditions[0].ConditionId != "global" {
+		t.Errorf("got %d global conditions, want the global one", len(loaded.globalConditions))
+	}
+	if !loaded.badges[getConfig().gameName]["badge"].Dev || !loaded.conditions[getConfig().gameName]["room"].Disabled {
+		t.Error("the badge of a later batch and its condition aren't in development")
+	}
+
+	roomConditions := getTestRoomConditions()
+	if len(roomConditions) != 1 || roomConditions[0] != loaded.conditions[getConfig().gameName]["room"] {
+		t.Fatalf("room 1 got %d conditions, want the loaded room condition", len(roomConditions))
+	}
+
+	// files that fail to parse keep what they had
+	writeTestGameFile(t, conditionsPath+"room.json", `{"map": `)
+	writeTestGameFile(t, badgesPath+"badge.json", `{"reqType": `)
+
+	if errs := loadBadges(); len(errs) != 2 {
+		t.Errorf("got %d errors, want one per broken file", len(errs))
+	}
+
+	reloaded := getBadgeData()
+	condition, ok := reloaded.conditions[getConfig().gameName]["room"]
+	if !ok || condition.Map != 1 {
+		t.Fatal("the condition that failed to parse was dropped")
+	}
+	if condition == loaded.conditions[getConfig().gameName]["room"] {
+		t.Error("the reloaded condition is shared with the previous badge data")
+	}
+	if _, ok := reloaded.badges[getConfig().gameName]["badge"]; !ok || len(reloaded.sortedBadgeIds[getConfig().gameName]) != 1 {
+		t.Error("the badge that failed to parse was dropped")
+	}
+
+	roomConditions = getTestRoomConditions()
+	if len(roomConditions) != 1 || roomConditions[0] != condition {
+		t.Error("room 1 still has the previous conditions")
+	}
+
+	// batch updates publish a copy as well
+	updateActiveBadgesAndConditions()
+	if updated := getBadgeData(); updated == reloaded || updated.conditions[getConfig().gameName]["room"] == condition {
+		t.Error("the batch update changed the published badge data")
+	}
+}
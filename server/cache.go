@@ -0,0 +1,235 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lookups cached by playerCache, entries are keyed by kind and token (or uuid for ranks)
+const (
+	playerCacheData = iota
+	playerCacheInfo
+	playerCacheUuid
+	playerCacheRank
+)
+
+var playerCache = &PlayerCache{
+	entries: make(map[playerCacheKey]*list.Element),
+	lru:     list.New(),
+	tokens:  make(map[string]map[string]bool),
+}
+
+type playerCacheKey struct {
+	kind int
+	key  string
+}
+
+type playerCacheEntry struct {
+	key     playerCacheKey
+	value   any
+	uuid    string
+	expires time.Time
+}
+
+type PlayerCacheData struct {
+	uuid, name    string
+	rank          int
+	badge         string
+	banned, muted bool
+}
+
+type PlayerCacheInfo struct {
+	uuid, name                   string
+	rank                         int
+	badge                        string
+	badgeSlotRows, badgeSlotCols int
+	screenshotLimit              int
+}
+
+// PlayerCache keeps recent token and rank lookups so that API calls
+// and room connects don't have to go to the database every time
+type PlayerCache struct {
+	mu      sync.Mutex
+	entries map[playerCacheKey]*list.Element
+	lru     *list.List                 // of *playerCacheEntry, most recently used first
+	tokens  map[string]map[string]bool // uuid -> cached tokens
+
+	// bumped on every invalidation so lookups that started before one aren't cached
+	generation uint64
+}
+
+func (c *PlayerCache) getGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+func (c *PlayerCache) get(kind int, key string) (any, bool) {
+	if getConfig().playerCache.ttl <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[playerCacheKey{kind, key}]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*playerCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.deleteLocked(entry.key)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(element)
+
+	return entry.value, true
+}
+
+func (c *PlayerCache) set(generation uint64, kind int, key string, uuid string, value any) {
+	if getConfig().playerCache.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	entry := &playerCacheEntry{
+		key:     playerCacheKey{kind, key},
+		value:   value,
+		uuid:    uuid,
+		expires: time.Now().Add(getConfig().playerCache.ttl),
+	}
+
+	if element, ok := c.entries[entry.key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+	} else {
+		c.evictLocked(getConfig().playerCache.maxEntries - 1)
+		c.entries[entry.key] = c.lru.PushFront(entry)
+	}
+
+	if kind != playerCacheRank {
+		if c.tokens[uuid] == nil {
+			c.tokens[uuid] = make(map[string]bool)
+		}
+		c.tokens[uuid][key] = true
+	}
+}
+
+// evictLocked drops the least recently used entries until at most maxEntries are left
+func (c *PlayerCache) evictLocked(maxEntries int) {
+	for len(c.entries) > max(maxEntries, 0) {
+		c.deleteLocked(c.lru.Back().Value.(*playerCacheEntry).key)
+	}
+}
+
+func (c *PlayerCache) deleteLocked(key playerCacheKey) {
+	element, ok := c.entries[key]
+	if !ok {
+		return
+	}
+
+	entry := c.lru.Remove(element).(*playerCacheEntry)
+	delete(c.entries, key)
+
+	if key.kind != playerCacheRank {
+		// keep the token indexed while another lookup for it is cached
+		for _, kind := range []int{playerCacheData, playerCacheInfo, playerCacheUuid} {
+			if _, ok := c.entries[playerCacheKey{kind, key.key}]; ok {
+				return
+			}
+		}
+
+		delete(c.tokens[entry.uuid], key.key)
+		if len(c.tokens[entry.uuid]) == 0 {
+			delete(c.tokens, entry.uuid)
+		}
+	}
+}
+
+func (c *PlayerCache) deleteToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	for _, kind := range []int{playerCacheData, playerCacheInfo, playerCacheUuid} {
+		c.deleteLocked(playerCacheKey{kind, token})
+	}
+}
+
+func (c *PlayerCache) deleteUuid(uuid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	for token := range c.tokens[uuid] {
+		for _, kind := range []int{playerCacheData, playerCacheInfo, playerCacheUuid} {
+			c.deleteLocked(playerCacheKey{kind, token})
+		}
+	}
+
+	c.deleteLocked(playerCacheKey{playerCacheRank, uuid})
+}
+
+func (c *PlayerCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	clear(c.entries)
+	c.lru.Init()
+	clear(c.tokens)
+}
+
+// invalidatePlayerCache drops what is cached for uuid here and on the other game servers,
+// an empty uuid drops everything
+func invalidatePlayerCache(uuid string) {
+	uncachePlayer(uuid, "")
+	broadcastPlayerCacheInvalidation(uuid, "")
+}
+
+// invalidateSessionCache drops what is cached for token here and on the other game servers
+func invalidateSessionCache(token string) {
+	uncachePlayer("", token)
+	broadcastPlayerCacheInvalidation("", token)
+}
+
+func uncachePlayer(uuid, token string) {
+	switch {
+	case token != "":
+		playerCache.deleteToken(token)
+	case uuid != "":
+		playerCache.deleteUuid(uuid)
+	default:
+		playerCache.clear()
+	}
+}
@@ -0,0 +1,181 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestPlayerCache(t *testing.T, maxEntries int, ttl time.Duration) *PlayerCache {
+	prevConfig := getConfig()
+	t.Cleanup(func() { currentConfig.Store(prevConfig) })
+
+	config := *prevConfig
+	config.playerCache.maxEntries = maxEntries
+	config.playerCache.ttl = ttl
+	currentConfig.Store(&config)
+
+	return &PlayerCache{
+		entries: make(map[playerCacheKey]*list.Element),
+		lru:     list.New(),
+		tokens:  make(map[string]map[string]bool),
+	}
+}
+
+func TestPlayerCacheEviction(t *testing.T) {
+	cache := newTestPlayerCache(t, 3, time.Minute)
+
+	for _, token := range []string{"a", "b", "c"} {
+		cache.set(0, playerCacheUuid, token, "uuid-"+token, token)
+	}
+
+	// a is used again, so b is the least recently used
+	if _, ok := cache.get(playerCacheUuid, "a"); !ok {
+		t.Fatal("a is not cached")
+	}
+
+	cache.set(0, playerCacheUuid, "d", "uuid-d", "d")
+
+	for token, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, ok := cache.get(playerCacheUuid, token); ok != want {
+			t.Errorf("%s cached: %t, want %t", token, ok, want)
+		}
+	}
+
+	if len(cache.entries) != 3 || cache.lru.Len() != 3 {
+		t.Errorf("%d entries and %d in the lru list, want 3", len(cache.entries), cache.lru.Len())
+	}
+	if _, ok := cache.tokens["uuid-b"]; ok {
+		t.Error("evicted token is still indexed")
+	}
+}
+
+func TestPlayerCacheInvalidation(t *testing.T) {
+	cache := newTestPlayerCache(t, 10, time.Minute)
+
+	cache.set(0, playerCacheData, "token", "uuid", "data")
+	cache.set(0, playerCacheInfo, "token", "uuid", "info")
+	cache.set(0, playerCacheRank, "uuid", "uuid", 1)
+
+	// lookups that started before an invalidation aren't cached
+	generation := cache.getGeneration()
+	cache.deleteUuid("uuid")
+	cache.set(generation, playerCacheData, "token", "uuid", "stale")
+
+	if len(cache.entries) != 0 || cache.lru.Len() != 0 || len(cache.tokens) != 0 {
+		t.Errorf("%d entries, %d in the lru list and %d uuids left", len(cache.entries), cache.lru.Len(), len(cache.tokens))
+	}
+}
+
+func TestPlayerCacheExpiry(t *testing.T) {
+	cache := newTestPlayerCache(t, 10, time.Millisecond)
+
+	cache.set(0, playerCacheUuid, "token", "uuid", "uuid")
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := cache.get(playerCacheUuid, "token"); ok {
+		t.Error("expired entry returned")
+	}
+	if len(cache.entries) != 0 || cache.lru.Len() != 0 {
+		t.Error("expired entry kept")
+	}
+}
+
+// TestIpc stands in for another game server
+type TestIpc struct {
+	invalidations chan []InvalidatePlayerCacheArgs
+}
+
+func (i *TestIpc) InvalidatePlayerCaches(args InvalidatePlayerCachesArgs, _ *Void) error {
+	i.invalidations <- args.Invalidations
+	time.Sleep(10 * time.Millisecond) // let the next ones queue up
+	return nil
+}
+
+func TestCacheInvalidationBatches(t *testing.T) {
+	const game = "cachetest"
+
+	os.MkdirAll("/tmp/yno", 0777)
+	socketPath := fmt.Sprintf("/tmp/yno/%s.sck", game)
+	os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("can't listen on %s: %s", socketPath, err)
+	}
+	defer os.Remove(socketPath)
+	defer listener.Close()
+
+	ipc := &TestIpc{invalidations: make(chan []InvalidatePlayerCacheArgs, 100)}
+	server := rpc.NewServer()
+	server.RegisterName("IPC", ipc)
+
+	var (
+		conns      int
+		connsMutex sync.Mutex
+	)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			connsMutex.Lock()
+			conns++
+			connsMutex.Unlock()
+
+			go server.ServeConn(conn)
+		}
+	}()
+
+	const invalidations = 50
+
+	invalidator := getCacheInvalidator(game)
+	for i := range invalidations {
+		invalidator.queue(InvalidatePlayerCacheArgs{Uuid: fmt.Sprint(i)})
+	}
+
+	var received, batches int
+	for received < invalidations {
+		select {
+		case batch := <-ipc.invalidations:
+			received += len(batch)
+			batches++
+		case <-time.After(10 * time.Second):
+			t.Fatalf("received %d of %d invalidations", received, invalidations)
+		}
+	}
+
+	if batches >= invalidations {
+		t.Errorf("sent %d invalidations in %d calls", invalidations, batches)
+	}
+
+	connsMutex.Lock()
+	defer connsMutex.Unlock()
+	if conns != 1 {
+		t.Errorf("dialed %d times, want 1", conns)
+	}
+}
@@ -21,9 +21,12 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fasthttp/websocket"
+	"github.com/ynoproject/ynoserver/server/protocol"
+	"github.com/ynoproject/ynoserver/server/security"
 )
 
 const (
@@ -61,17 +64,45 @@ type Picture struct {
 	flipX, flipY bool
 }
 
+// ClientConn is a client's current connection. Resuming a client swaps
+// in a new one as a whole, while the goroutines of the previous
+// connection may still be using theirs.
+type ClientConn struct {
+	ws *websocket.Conn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	ip string // sessions only
+
+	// rooms only
+	protocol int
+	key      *security.ClientKey
+	counter  uint32 // only used by the connection's reader
+}
+
+func newClientConn(parent context.Context, ws *websocket.Conn) *ClientConn {
+	conn := &ClientConn{ws: ws}
+	conn.ctx, conn.cancel = context.WithCancel(parent)
+
+	return conn
+}
+
 // SessionClient
 type SessionClient struct {
 	roomC *RoomClient
 
-	conn *websocket.Conn
-	ip   string
+	conn atomic.Pointer[ClientConn]
 
-	ctx    context.Context
-	cancel context.CancelFunc
+	outbox *Outbox
+
+	floodGuard floodGuard
 
-	outbox chan []byte
+	// see resume.go
+	resumeToken string
+	suspension  *suspension
+	terminated  bool
+	resumeMutex sync.Mutex
 
 	id int
 
@@ -94,25 +125,54 @@ type SessionClient struct {
 
 	hideLocation       bool
 	hideUnnamedPlayers bool
-	partyId            int
 
-	onlineFriends map[string]bool
-	blockedUsers  map[string]bool
+	// set from the api and the scheduler while other clients read them,
+	// see getPartyId and isOnlineFriend
+	partyId       atomic.Int64
+	onlineFriends atomic.Pointer[map[string]bool]
+
+	blockedUsers map[string]bool
+}
+
+// getCtx returns the context of the current connection
+func (c *SessionClient) getCtx() context.Context {
+	return c.conn.Load().ctx
+}
+
+func (c *SessionClient) getIp() string {
+	return c.conn.Load().ip
+}
+
+func (c *SessionClient) getPartyId() int {
+	return int(c.partyId.Load())
+}
+
+func (c *SessionClient) setPartyId(partyId int) {
+	c.partyId.Store(int64(partyId))
+}
+
+func (c *SessionClient) isOnlineFriend(uuid string) bool {
+	onlineFriends := c.onlineFriends.Load()
+	return onlineFriends != nil && (*onlineFriends)[uuid]
 }
 
 func (c *SessionClient) msgReader() {
-	defer c.cancel()
+	// the connection may be replaced when the session is resumed
+	conn := c.conn.Load()
+	ws := conn.ws
+
+	defer conn.cancel()
 
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	ws.SetReadLimit(maxMessageSize)
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error { ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
 	for {
 		select {
-		case <-c.ctx.Done():
+		case <-conn.ctx.Done():
 			return
 		default:
-			_, message, err := c.conn.ReadMessage()
+			_, message, err := ws.ReadMessage()
 			if err != nil {
 				return
 			}
@@ -126,31 +186,39 @@ func (c *SessionClient) msgReader() {
 }
 
 func (c *SessionClient) msgWriter() {
+	conn := c.conn.Load()
+	ws := conn.ws
+
 	ticker := time.NewTicker(pingPeriod)
 
 	defer func() {
 		ticker.Stop()
 
-		c.cancel()
-		c.disconnect()
+		conn.cancel()
+		c.disconnect(conn)
 	}()
 
 	for {
 		select {
-		case <-c.ctx.Done():
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(1028, ""))
+		case <-conn.ctx.Done():
+			ws.SetWriteDeadline(time.Now().Add(writeWait))
+			ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(getCloseCode(), ""))
 
 			return
-		case message := <-c.outbox:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			err := c.conn.WriteMessage(websocket.TextMessage, message)
-			if err != nil {
-				return
+		case <-c.outbox.ready:
+			msgs := c.outbox.take()
+			c.recordOutbound(msgs)
+
+			for _, msg := range msgs {
+				ws.SetWriteDeadline(time.Now().Add(writeWait))
+				err := writeWsMessage(ws, websocket.TextMessage, msg.msg)
+				if err != nil {
+					return
+				}
 			}
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			err := c.conn.WriteMessage(websocket.PingMessage, nil)
+			ws.SetWriteDeadline(time.Now().Add(writeWait))
+			err := ws.WriteMessage(websocket.PingMessage, nil)
 			if err != nil {
 				return
 			}
@@ -158,12 +226,23 @@ func (c *SessionClient) msgWriter() {
 	}
 }
 
-func (c *SessionClient) disconnect() {
-	// unregister
-	clients.Delete(c.uuid)
-
+func (c *SessionClient) disconnect(conn *ClientConn) {
 	// close conn, ends reader and processor
-	c.conn.Close()
+	conn.ws.Close()
+
+	if c.suspend() {
+		return
+	}
+
+	c.unregister()
+}
+
+func (c *SessionClient) unregister() {
+	clients.CompareAndDelete(c.uuid, c)
+
+	if c.roomC != nil {
+		c.roomC.terminate()
+	}
 
 	err := c.updatePlayerGameActivity(false)
 	if err != nil {
@@ -171,11 +250,13 @@ func (c *SessionClient) disconnect() {
 	}
 
 	writeLog(c.uuid, "sess", "disconnect", 200)
+
+	sessionWg.Done()
 }
 
 func (c *SessionClient) isPrivatedTo(other *SessionClient) bool {
 	return (c.private || other.private) && ((c.singleplayer || other.singleplayer) ||
-		(other.partyId == 0 || c.partyId != other.partyId) && !c.onlineFriends[other.uuid])
+		(other.getPartyId() == 0 || c.getPartyId() != other.getPartyId()) && !c.isOnlineFriend(other.uuid))
 }
 
 func (c *SessionClient) isBlockedWith(other *SessionClient) bool {
@@ -192,20 +273,36 @@ func (c *SessionClient) isUnnamedPlayerHiddenBy(other *SessionClient) bool {
 
 // RoomClient
 type RoomClient struct {
-	room    *Room
+	// room is only used from the client's reader and the room's goroutine,
+	// anything else goes through getRoom or inRoom
+	room       *Room
+	sharedRoom atomic.Pointer[Room]
+
+	// held while joining and leaving rooms, see inRoom
+	switchMutex sync.Mutex
+
 	session *SessionClient
 
-	conn *websocket.Conn
+	conn atomic.Pointer[ClientConn]
 
-	ctx    context.Context
-	cancel context.CancelFunc
+	// watching the room without being in it, see joinRoomSpectatorWs
+	spectator bool
 
-	outbox chan []byte
+	outbox *Outbox
 
-	key, counter uint32
+	floodGuard floodGuard
+
+	// guarded by session.resumeMutex
+	suspension *suspension
+	terminated bool
 
 	x, y, facing, speed int
 
+	// movement plausibility, see checkMove
+	moveBudget  float64
+	moveUpdated time.Time
+	lastFlagged time.Time
+
 	flash          [5]int
 	repeatingFlash bool
 	transparency   int
@@ -230,24 +327,38 @@ type RoomClient struct {
 	notifiedMaps map[int]bool
 }
 
+// getCtx returns the context of the current connection
+func (c *RoomClient) getCtx() context.Context {
+	return c.conn.Load().ctx
+}
+
+// getRoom returns the room the client is in, it is safe to use from any goroutine
+func (c *RoomClient) getRoom() *Room {
+	return c.sharedRoom.Load()
+}
+
 func (c *RoomClient) msgReader() {
-	defer c.cancel()
+	// the connection may be replaced when the session is resumed
+	conn := c.conn.Load()
+	ws := conn.ws
+
+	defer conn.cancel()
 
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	ws.SetReadLimit(maxMessageSize)
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error { ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
 	for {
 		select {
-		case <-c.ctx.Done():
+		case <-conn.ctx.Done():
 			return
 		default:
-			_, message, err := c.conn.ReadMessage()
+			_, message, err := ws.ReadMessage()
 			if err != nil {
 				return
 			}
 
-			errs := c.processMsgs(message)
+			errs := c.processMsgs(conn, message)
 			if len(errs) != 0 {
 				for _, err := range errs {
 					writeErrLog(c.session.uuid, c.mapId, err.Error())
@@ -258,40 +369,63 @@ func (c *RoomClient) msgReader() {
 }
 
 func (c *RoomClient) msgWriter() {
+	conn := c.conn.Load()
+	ws := conn.ws
+
 	ticker := time.NewTicker(pingPeriod)
 
 	defer func() {
 		ticker.Stop()
 
-		c.cancel()
-		c.disconnect()
+		conn.cancel()
+		c.disconnect(conn)
 	}()
 
 	for {
 		select {
-		case <-c.ctx.Done():
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(1028, ""))
+		case <-conn.ctx.Done():
+			ws.SetWriteDeadline(time.Now().Add(writeWait))
+			ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(getCloseCode(), ""))
 
 			return
-		case message := <-c.outbox:
-			for len(c.outbox) != 0 { // for each extra message in the channel
-				if len(message) > maxMessageSize-256 { // stop if we're close to the message size limit
-					break
+		case <-c.outbox.ready:
+			msgs := c.outbox.take()
+			c.recordOutbound(msgs)
+
+			var message []byte
+			for _, msg := range msgs {
+				if len(message) > maxMessageSize-256 { // send what we have if we're close to the message size limit
+					ws.SetWriteDeadline(time.Now().Add(writeWait))
+					err := writeWsMessage(ws, websocket.BinaryMessage, message)
+					if err != nil {
+						return
+					}
+
+					message = nil
+				}
+
+				if conn.protocol == protocol.V2 {
+					// v2 messages are self-delimiting
+					message = append(message, msg.encode(protocol.V2)...)
+					continue
 				}
 
-				message = append(message, []byte(mdelim)...) // add message delimiter
-				message = append(message, <-c.outbox...)     // write next message contents
+				if len(message) != 0 {
+					message = append(message, []byte(mdelim)...) // add message delimiter
+				}
+				message = append(message, msg.msg...) // write next message contents
 			}
 
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			err := c.conn.WriteMessage(websocket.BinaryMessage, message)
-			if err != nil {
-				return
+			if len(message) != 0 {
+				ws.SetWriteDeadline(time.Now().Add(writeWait))
+				err := writeWsMessage(ws, websocket.BinaryMessage, message)
+				if err != nil {
+					return
+				}
 			}
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			err := c.conn.WriteMessage(websocket.PingMessage, nil)
+			ws.SetWriteDeadline(time.Now().Add(writeWait))
+			err := ws.WriteMessage(websocket.PingMessage, nil)
 			if err != nil {
 				return
 			}
@@ -299,14 +433,34 @@ func (c *RoomClient) msgWriter() {
 	}
 }
 
-func (c *RoomClient) disconnect() {
-	c.cancel()
-
-	// unregister
-	c.leaveRoom()
+func (c *RoomClient) disconnect(conn *ClientConn) {
+	conn.cancel()
 
 	// close conn, ends reader and processor
-	c.conn.Close()
+	conn.ws.Close()
+
+	if c.suspend() {
+		return
+	}
+
+	c.unregister()
+}
+
+func (c *RoomClient) unregister() {
+	if c.spectator {
+		c.room.call(c.stopSpectating)
+
+		spectators.mutex.Lock()
+		delete(spectators.clients, c)
+		spectators.mutex.Unlock()
+
+		writeLog(c.session.uuid, c.mapId, "stop spectating", 200)
+		return
+	}
+
+	c.switchMutex.Lock()
+	c.leaveRoom()
+	c.switchMutex.Unlock()
 
 	writeLog(c.session.uuid, c.mapId, "disconnect", 200)
 }
@@ -339,95 +493,3 @@ func (c *RoomClient) reset() {
 	c.switchCache = make(map[int]bool)
 	c.varCache = make(map[int]int)
 }
-
-type SClientMap struct {
-	clients map[string]*SessionClient
-	mutex   sync.RWMutex
-}
-
-func NewSCMap() *SClientMap {
-	return &SClientMap{
-		clients: make(map[string]*SessionClient),
-	}
-}
-
-func (m *SClientMap) Store(uuid string, client *SessionClient) {
-	m.mutex.Lock()
-
-	m.clients[uuid] = client
-
-	m.mutex.Unlock()
-}
-
-func (m *SClientMap) nextFreeId() (id int) {
-	for i := 0; i < 0xFFFF; i++ {
-		var used bool
-		for _, client := range m.clients {
-			if client.id == i {
-				used = true
-			}
-		}
-
-		if !used {
-			id = i
-			break
-		}
-	}
-	return id
-}
-
-func (m *SClientMap) StoreAndSetId(uuid string, client *SessionClient) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	client.id = m.nextFreeId()
-	m.clients[uuid] = client
-}
-
-func (m *SClientMap) Load(uuid string) (*SessionClient, bool) {
-	m.mutex.RLock()
-
-	client, ok := m.clients[uuid]
-
-	m.mutex.RUnlock()
-
-	return client, ok
-}
-
-func (m *SClientMap) Delete(uuid string) {
-	m.mutex.Lock()
-
-	delete(m.clients, uuid)
-
-	m.mutex.Unlock()
-}
-
-func (m *SClientMap) Get() []*SessionClient {
-	m.mutex.RLock()
-
-	clients := make([]*SessionClient, 0, len(m.clients))
-	for _, client := range m.clients {
-		clients = append(clients, client)
-	}
-
-	m.mutex.RUnlock()
-
-	return clients
-}
-
-func (m *SClientMap) GetAmount() int {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
-
-	return len(m.clients)
-}
-
-func (m *SClientMap) Exists(uuid string) bool {
-	m.mutex.RLock()
-
-	_, ok := m.clients[uuid]
-
-	m.mutex.RUnlock()
-
-	return ok
-}
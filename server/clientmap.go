@@ -0,0 +1,256 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	clientMapShards = 64
+
+	// session ids are sent as uint16, the last one is never handed out
+	maxSessionId = 0xFFFF
+)
+
+// SClientMap holds the connected session clients by uuid. Clients are spread
+// over shards so that lookups don't contend with each other, and session ids
+// are handed out from a free list instead of by scanning the clients.
+type SClientMap struct {
+	shards [clientMapShards]clientMapShard
+	amount atomic.Int64
+
+	ids SessionIdPool
+
+	// per-shard copies made by Range, reused between calls
+	buffers sync.Pool
+}
+
+type clientMapShard struct {
+	clients map[string]*SessionClient
+	mutex   sync.RWMutex
+}
+
+func NewSCMap() *SClientMap {
+	m := &SClientMap{
+		buffers: sync.Pool{
+			New: func() any {
+				return new([]*SessionClient)
+			},
+		},
+	}
+
+	for i := range m.shards {
+		m.shards[i].clients = make(map[string]*SessionClient)
+	}
+
+	return m
+}
+
+func (m *SClientMap) shard(uuid string) *clientMapShard {
+	// FNV-1a
+	hash := uint32(2166136261)
+	for i := 0; i < len(uuid); i++ {
+		hash ^= uint32(uuid[i])
+		hash *= 16777619
+	}
+
+	return &m.shards[hash%clientMapShards]
+}
+
+// StoreAndSetId gives client the lowest free session id and stores it,
+// a client already stored for uuid is replaced and gives up its id
+func (m *SClientMap) StoreAndSetId(uuid string, client *SessionClient) {
+	client.id = m.ids.acquire()
+
+	shard := m.shard(uuid)
+	shard.mutex.Lock()
+
+	old, replaced := shard.clients[uuid]
+	shard.clients[uuid] = client
+
+	shard.mutex.Unlock()
+
+	if replaced {
+		m.ids.release(old.id)
+	} else {
+		m.amount.Add(1)
+	}
+}
+
+func (m *SClientMap) Load(uuid string) (*SessionClient, bool) {
+	shard := m.shard(uuid)
+	shard.mutex.RLock()
+
+	client, ok := shard.clients[uuid]
+
+	shard.mutex.RUnlock()
+
+	return client, ok
+}
+
+func (m *SClientMap) Delete(uuid string) {
+	shard := m.shard(uuid)
+	shard.mutex.Lock()
+
+	client, ok := shard.clients[uuid]
+	delete(shard.clients, uuid)
+
+	shard.mutex.Unlock()
+
+	if ok {
+		m.amount.Add(-1)
+		m.ids.release(client.id)
+	}
+}
+
+// CompareAndDelete only deletes the entry for uuid if it is still client
+func (m *SClientMap) CompareAndDelete(uuid string, client *SessionClient) {
+	shard := m.shard(uuid)
+	shard.mutex.Lock()
+
+	deleted := shard.clients[uuid] == client
+	if deleted {
+		delete(shard.clients, uuid)
+	}
+
+	shard.mutex.Unlock()
+
+	if deleted {
+		m.amount.Add(-1)
+		m.ids.release(client.id)
+	}
+}
+
+// Range calls f for every client until it returns false. No lock is held
+// while f runs, so it may use the map itself (e.g. terminate the client).
+// Clients stored or deleted meanwhile may or may not be seen.
+func (m *SClientMap) Range(f func(client *SessionClient) bool) {
+	buf := m.buffers.Get().(*[]*SessionClient)
+	defer func() {
+		clear(*buf)
+		*buf = (*buf)[:0]
+		m.buffers.Put(buf)
+	}()
+
+	for i := range m.shards {
+		shard := &m.shards[i]
+
+		shard.mutex.RLock()
+		clients := (*buf)[:0]
+		for _, client := range shard.clients {
+			clients = append(clients, client)
+		}
+		*buf = clients
+		shard.mutex.RUnlock()
+
+		for _, client := range clients {
+			if !f(client) {
+				return
+			}
+		}
+	}
+}
+
+// Get returns a copy of every client, prefer Range where the copy isn't needed
+func (m *SClientMap) Get() []*SessionClient {
+	clients := make([]*SessionClient, 0, m.GetAmount())
+	m.Range(func(client *SessionClient) bool {
+		clients = append(clients, client)
+		return true
+	})
+
+	return clients
+}
+
+func (m *SClientMap) GetAmount() int {
+	return int(m.amount.Load())
+}
+
+func (m *SClientMap) Exists(uuid string) bool {
+	_, ok := m.Load(uuid)
+
+	return ok
+}
+
+// SessionIdPool hands out the lowest session id not in use
+type SessionIdPool struct {
+	free  sessionIdHeap // released ids below next
+	next  int
+	mutex sync.Mutex
+
+	// clients sharing id 0 because every id was in use,
+	// their releases must not free it for the client that owns it
+	shared int
+}
+
+func (p *SessionIdPool) acquire() (id int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.free) != 0 {
+		return heap.Pop(&p.free).(int)
+	}
+
+	// every id is in use, share 0 like before
+	if p.next == maxSessionId {
+		p.shared++
+		return 0
+	}
+
+	id = p.next
+	p.next++
+
+	return id
+}
+
+func (p *SessionIdPool) release(id int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if id >= p.next {
+		return
+	}
+
+	if id == 0 && p.shared != 0 {
+		p.shared--
+		return
+	}
+
+	heap.Push(&p.free, id)
+}
+
+type sessionIdHeap []int
+
+func (h sessionIdHeap) Len() int           { return len(h) }
+func (h sessionIdHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h sessionIdHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *sessionIdHeap) Push(x any) {
+	*h = append(*h, x.(int))
+}
+
+func (h *sessionIdHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return x
+}
@@ -0,0 +1,174 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+const benchmarkClients = 5000
+
+func newBenchmarkClients() (uuids []string, sessions []*SessionClient) {
+	for i := range benchmarkClients {
+		uuids = append(uuids, fmt.Sprintf("%016x", i))
+		sessions = append(sessions, &SessionClient{uuid: uuids[i]})
+	}
+
+	return uuids, sessions
+}
+
+func newFilledClientMap(uuids []string, sessions []*SessionClient) *SClientMap {
+	m := NewSCMap()
+	for i, uuid := range uuids {
+		m.StoreAndSetId(uuid, sessions[i])
+	}
+
+	return m
+}
+
+func TestSessionIdReuse(t *testing.T) {
+	m := NewSCMap()
+
+	a, b, c := &SessionClient{}, &SessionClient{}, &SessionClient{}
+	m.StoreAndSetId("a", a)
+	m.StoreAndSetId("b", b)
+	m.StoreAndSetId("c", c)
+
+	if a.id != 0 || b.id != 1 || c.id != 2 {
+		t.Fatalf("got ids %d %d %d, want 0 1 2", a.id, b.id, c.id)
+	}
+
+	m.Delete("b")
+	m.CompareAndDelete("a", a)
+
+	// the lowest released id is handed out first
+	d := &SessionClient{}
+	m.StoreAndSetId("d", d)
+	if d.id != 0 {
+		t.Errorf("got id %d, want 0", d.id)
+	}
+
+	// a client that was replaced gives up its id
+	e := &SessionClient{}
+	m.StoreAndSetId("c", e)
+	if e.id != 1 {
+		t.Errorf("got id %d, want 1", e.id)
+	}
+
+	f := &SessionClient{}
+	m.StoreAndSetId("f", f)
+	if f.id != 2 {
+		t.Errorf("got id %d, want 2", f.id)
+	}
+
+	// deleting a client that was already replaced does nothing
+	m.CompareAndDelete("c", c)
+	if got := m.GetAmount(); got != 3 {
+		t.Errorf("got %d clients, want 3", got)
+	}
+}
+
+func TestSessionIdPoolShared(t *testing.T) {
+	var p SessionIdPool
+	for id := range maxSessionId {
+		if got := p.acquire(); got != id {
+			t.Fatalf("got id %d, want %d", got, id)
+		}
+	}
+
+	// every id is in use, so these share 0 with its owner
+	for range 2 {
+		if got := p.acquire(); got != 0 {
+			t.Fatalf("got id %d, want the shared 0", got)
+		}
+	}
+
+	p.release(0)
+	p.release(0)
+
+	// 0 is still owned by one client
+	p.release(5)
+	if got := p.acquire(); got != 5 {
+		t.Errorf("got id %d, want 5", got)
+	}
+	if got := p.acquire(); got != 0 {
+		t.Errorf("got id %d, want the shared 0", got)
+	}
+
+	// once every holder let go of it, 0 is handed out once
+	p.release(0)
+	p.release(0)
+	if got := p.acquire(); got != 0 {
+		t.Errorf("got id %d, want 0", got)
+	}
+	if len(p.free) != 0 {
+		t.Errorf("got %d free ids, want none", len(p.free))
+	}
+}
+
+func BenchmarkStoreAndSetId(b *testing.B) {
+	uuids, sessions := newBenchmarkClients()
+	m := newFilledClientMap(uuids, sessions)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	// replacing a client releases its id and acquires one again
+	for i := 0; i < b.N; i++ {
+		n := i % benchmarkClients
+		m.StoreAndSetId(uuids[n], sessions[n])
+	}
+}
+
+func BenchmarkRange(b *testing.B) {
+	m := newFilledClientMap(newBenchmarkClients())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var n int
+		m.Range(func(*SessionClient) bool {
+			n++
+			return true
+		})
+		if n != benchmarkClients {
+			b.Fatalf("ranged over %d clients, want %d", n, benchmarkClients)
+		}
+	}
+}
+
+func BenchmarkDelete(b *testing.B) {
+	uuids, sessions := newBenchmarkClients()
+	m := newFilledClientMap(uuids, sessions)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		n := i % benchmarkClients
+		if n == 0 && i != 0 {
+			b.StopTimer()
+			m = newFilledClientMap(uuids, sessions)
+			b.StartTimer()
+		}
+
+		m.Delete(uuids[n])
+	}
+}
@@ -0,0 +1,130 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fasthttp/websocket"
+)
+
+var compressionStats struct {
+	messages     atomic.Uint64 // messages sent compressed
+	payloadBytes atomic.Uint64 // size of those messages before compression
+	wireBytes    atomic.Uint64 // bytes written to the socket for those messages
+}
+
+func initCompression() {
+	logInitTask("compression")
+
+	upgrader.EnableCompression = true
+
+	scheduler.Every(1).Hour().Do(func() {
+		payloadBytes := compressionStats.payloadBytes.Load()
+		wireBytes := compressionStats.wireBytes.Load()
+
+		var saved uint64
+		if payloadBytes > wireBytes {
+			saved = payloadBytes - wireBytes
+		}
+
+		writeLog("SERVER", "compression", fmt.Sprintf("compressed messages: %d, payload: %d bytes, sent: %d bytes, saved: %d bytes", compressionStats.messages.Load(), payloadBytes, wireBytes, saved), 200)
+	})
+}
+
+// meteredConn counts the bytes written to a hijacked connection so the
+// size of compressed frames can be compared to their payload
+type meteredConn struct {
+	net.Conn
+
+	deflate bool // permessage-deflate was negotiated
+	written uint64
+}
+
+func (c *meteredConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written += uint64(n)
+
+	return n, err
+}
+
+type meteredResponseWriter struct {
+	http.ResponseWriter
+
+	deflate bool
+}
+
+func (w *meteredResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &meteredConn{Conn: conn, deflate: w.deflate}, brw, nil
+}
+
+func upgradeWs(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*websocket.Conn, error) {
+	deflate := upgrader.EnableCompression && strings.Contains(r.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+
+	conn, err := upgrader.Upgrade(&meteredResponseWriter{ResponseWriter: w, deflate: deflate}, r, responseHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	if deflate {
+		conn.SetCompressionLevel(getConfig().compression.level)
+	}
+
+	return conn, nil
+}
+
+// writeWsMessage writes a data message, compressing it if
+// compression was negotiated and the message is large enough
+func writeWsMessage(conn *websocket.Conn, messageType int, data []byte) error {
+	metered, ok := conn.UnderlyingConn().(*meteredConn)
+	if !ok || !metered.deflate || len(data) < getConfig().compression.minSize {
+		conn.EnableWriteCompression(false)
+		return conn.WriteMessage(messageType, data)
+	}
+
+	conn.EnableWriteCompression(true)
+
+	written := metered.written
+
+	err := conn.WriteMessage(messageType, data)
+	if err != nil {
+		return err
+	}
+
+	compressionStats.messages.Add(1)
+	compressionStats.payloadBytes.Add(uint64(len(data)))
+	compressionStats.wireBytes.Add(metered.written - written)
+
+	return nil
+}
@@ -18,6 +18,9 @@
 package server
 
 import (
+	"compress/flate"
+	"log/slog"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
@@ -30,9 +33,33 @@ type Config struct {
 	gameName string
 	gamePath string
 
+	listen         []listenConfig
+	trustedProxies []netip.Prefix
+
+	storage                        string
 	dbUser, dbPass, dbAddr, dbName string
 
+	database struct {
+		queryTimeout           time.Duration
+		backgroundQueryTimeout time.Duration
+		slowQuery              time.Duration
+	}
+
+	playerCache struct {
+		ttl        time.Duration
+		maxEntries int
+	}
+
+	writeQueue struct {
+		size     int
+		maxBatch int
+		maxDelay time.Duration
+	}
+
 	spRooms         []int
+	interestRadii   map[int]int
+	roomCapacity    int
+	roomCapacities  map[int]int
 	badSounds       map[string]bool
 	pictures        map[string]bool
 	picturePrefixes []string
@@ -52,10 +79,45 @@ type Config struct {
 		deadline time.Duration
 	}
 
+	session struct {
+		resumeWindow time.Duration
+	}
+
+	outbox struct {
+		maxBacklog  int
+		slowTimeout time.Duration
+	}
+
+	rateLimits struct {
+		messages        map[string]rateLimit
+		disconnectAfter int
+		muteAfter       int
+		muteDuration    time.Duration
+	}
+
+	compression struct {
+		enabled bool
+		level   int
+		minSize int
+	}
+
+	metrics struct {
+		token string
+	}
+
+	recorder struct {
+		enabled bool
+		path    string
+		rooms   map[int]bool // all rooms if empty
+	}
+
 	logging struct {
 		maxSize    int
 		maxBackups int
 		maxAge     int
+		format     string // text or json
+		level      slog.Level
+		levels     map[string]slog.Level
 	}
 
 	vapidKeys struct {
@@ -68,16 +130,54 @@ type Config struct {
 	}
 }
 
+type listenConfig struct {
+	network  string // unix, tcp or tls
+	address  string
+	certFile string
+	keyFile  string
+}
+
 type ConfigFile struct {
 	GameName string `yaml:"game_name"`
 	GamePath string `yaml:"game_path"`
 
+	Listen []struct {
+		Type     string `yaml:"type"`
+		Path     string `yaml:"path"`
+		Addr     string `yaml:"addr"`
+		CertFile string `yaml:"cert_file"`
+		KeyFile  string `yaml:"key_file"`
+	} `yaml:"listen"`
+	TrustedProxies string `yaml:"trusted_proxies"`
+
+	Storage string `yaml:"storage"`
+
 	DbUser string `yaml:"db_user"`
 	DbPass string `yaml:"db_pass"`
 	DbAddr string `yaml:"db_addr"`
 	DbName string `yaml:"db_name"`
 
+	Database struct {
+		QueryTimeoutMs           int `yaml:"query_timeout_ms"`
+		BackgroundQueryTimeoutMs int `yaml:"background_query_timeout_ms"`
+		SlowQueryMs              int `yaml:"slow_query_ms"`
+	} `yaml:"database"`
+
+	PlayerCache struct {
+		TtlSeconds int `yaml:"ttl_seconds"`
+		MaxEntries int `yaml:"max_entries"`
+	} `yaml:"player_cache"`
+
+	WriteQueue struct {
+		Size       int `yaml:"size"`
+		MaxBatch   int `yaml:"max_batch"`
+		MaxDelayMs int `yaml:"max_delay_ms"`
+	} `yaml:"write_queue"`
+
 	SpRooms         string `yaml:"sp_rooms"`
+	InterestRadii   string `yaml:"interest_radii"`
+	RoomCapacity    int    `yaml:"room_capacity"`
+	RoomCapacities  string `yaml:"room_capacities"`
 	BadSounds       string `yaml:"bad_sounds"`
 	PictureNames    string `yaml:"picture_names"`
 	PicturePrefixes string `yaml:"picture_prefixes"`
@@ -97,15 +197,53 @@ type ConfigFile struct {
 		DeadlineMs int `yaml:"deadline_ms"`
 	} `yaml:"ipc"`
 
+	Session struct {
+		ResumeWindow int `yaml:"resume_window"`
+	} `yaml:"session"`
+
+	Outbox struct {
+		MaxBacklog  int `yaml:"max_backlog"`
+		SlowTimeout int `yaml:"slow_timeout"`
+	} `yaml:"outbox"`
+
+	RateLimits struct {
+		Messages map[string]struct {
+			Rate  float64 `yaml:"rate"`
+			Burst int     `yaml:"burst"`
+		} `yaml:"messages"`
+		DisconnectAfter int `yaml:"disconnect_after"`
+		MuteAfter       int `yaml:"mute_after"`
+		MuteMinutes     int `yaml:"mute_minutes"`
+	} `yaml:"rate_limits"`
+
+	Compression struct {
+		Enabled bool `yaml:"enabled"`
+		Level   int  `yaml:"level"`
+		MinSize int  `yaml:"min_size"`
+	} `yaml:"compression"`
+
+	Metrics struct {
+		Token string `yaml:"token"`
+	} `yaml:"metrics"`
+
+	Recorder struct {
+		Enabled bool   `yaml:"enabled"`
+		Path    string `yaml:"path"`
+		Rooms   string `yaml:"rooms"`
+	} `yaml:"recorder"`
+
 	VapidKeys struct {
 		Private string `yaml:"private"`
 		Public  string `yaml:"public"`
 	} `yaml:"vapid_keys"`
 
 	Logging struct {
-		MaxSize    int `yaml:"max_size"`
-		MaxBackups int `yaml:"max_backups"`
-		MaxAge     int `yaml:"max_age"`
+		MaxSize    int               `yaml:"max_size"`
+		MaxBackups int               `yaml:"max_backups"`
+		MaxAge     int               `yaml:"max_age"`
+		Format     string            `yaml:"format"`
+		Level      string            `yaml:"level"`
+		Categories map[string]string `yaml:"categories"`
 	} `yaml:"logging"`
 
 	Flags struct {
@@ -131,11 +269,113 @@ func parseConfigFile(filename string) *Config {
 	config.gameName = configFile.GameName
 	config.gamePath = configFile.GamePath
 
+	for _, listen := range configFile.Listen {
+		switch listen.Type {
+		case "unix":
+			if listen.Path == "" {
+				panic("unix listener requires a path")
+			}
+
+			config.listen = append(config.listen, listenConfig{network: "unix", address: listen.Path})
+		case "tcp":
+			if listen.Addr == "" {
+				panic("tcp listener requires an addr")
+			}
+
+			config.listen = append(config.listen, listenConfig{network: "tcp", address: listen.Addr})
+		case "tls":
+			if listen.Addr == "" || listen.CertFile == "" || listen.KeyFile == "" {
+				panic("tls listener requires an addr, cert_file and key_file")
+			}
+
+			config.listen = append(config.listen, listenConfig{
+				network:  "tls",
+				address:  listen.Addr,
+				certFile: listen.CertFile,
+				keyFile:  listen.KeyFile,
+			})
+		default:
+			panic("unknown listener type: " + listen.Type)
+		}
+	}
+	if len(config.listen) == 0 {
+		config.listen = append(config.listen, listenConfig{network: "unix", address: "sockets/" + config.gameName + ".sock"})
+	}
+
+	if configFile.TrustedProxies != "" {
+		for _, str := range strings.Split(configFile.TrustedProxies, ",") {
+			str = strings.TrimSpace(str)
+
+			prefix, err := netip.ParsePrefix(str)
+			if err != nil {
+				addr, err := netip.ParseAddr(str)
+				if err != nil {
+					panic("invalid trusted proxy: " + str)
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+
+			config.trustedProxies = append(config.trustedProxies, prefix.Masked())
+		}
+	}
+
+	switch configFile.Storage {
+	case "", storageMysql:
+		config.storage = storageMysql
+	case storageMemory:
+		config.storage = storageMemory
+	default:
+		panic("unknown storage: " + configFile.Storage)
+	}
+
 	config.dbUser = configFile.DbUser
 	config.dbPass = configFile.DbPass
 	config.dbAddr = configFile.DbAddr
 	config.dbName = configFile.DbName
 
+	if configFile.Database.QueryTimeoutMs != 0 {
+		config.database.queryTimeout = time.Duration(configFile.Database.QueryTimeoutMs) * time.Millisecond
+	} else {
+		config.database.queryTimeout = 5 * time.Second
+	}
+	if configFile.Database.BackgroundQueryTimeoutMs != 0 {
+		config.database.backgroundQueryTimeout = time.Duration(configFile.Database.BackgroundQueryTimeoutMs) * time.Millisecond
+	} else {
+		config.database.backgroundQueryTimeout = 30 * time.Second
+	}
+	if configFile.Database.SlowQueryMs != 0 {
+		config.database.slowQuery = time.Duration(configFile.Database.SlowQueryMs) * time.Millisecond
+	} else {
+		config.database.slowQuery = 500 * time.Millisecond
+	}
+
+	if configFile.PlayerCache.TtlSeconds != 0 {
+		config.playerCache.ttl = time.Duration(configFile.PlayerCache.TtlSeconds) * time.Second
+	} else {
+		config.playerCache.ttl = time.Minute
+	}
+	if configFile.PlayerCache.MaxEntries != 0 {
+		config.playerCache.maxEntries = configFile.PlayerCache.MaxEntries
+	} else {
+		config.playerCache.maxEntries = 10000
+	}
+
+	if configFile.WriteQueue.Size != 0 {
+		config.writeQueue.size = configFile.WriteQueue.Size
+	} else {
+		config.writeQueue.size = 4096
+	}
+	if configFile.WriteQueue.MaxBatch != 0 {
+		config.writeQueue.maxBatch = configFile.WriteQueue.MaxBatch
+	} else {
+		config.writeQueue.maxBatch = 100
+	}
+	if configFile.WriteQueue.MaxDelayMs != 0 {
+		config.writeQueue.maxDelay = time.Duration(configFile.WriteQueue.MaxDelayMs) * time.Millisecond
+	} else {
+		config.writeQueue.maxDelay = 250 * time.Millisecond
+	}
+
 	if configFile.SpRooms != "" {
 		for _, str := range strings.Split(configFile.SpRooms, ",") {
 			num, err := strconv.Atoi(str)
@@ -147,6 +387,11 @@ func parseConfigFile(filename string) *Config {
 		}
 	}
 
+	config.interestRadii = parseRoomValues(configFile.InterestRadii)
+
+	config.roomCapacity = configFile.RoomCapacity
+	config.roomCapacities = parseRoomValues(configFile.RoomCapacities)
+
 	config.badSounds = make(map[string]bool)
 	if configFile.BadSounds != "" {
 		for _, name := range strings.Split(configFile.BadSounds, ",") {
@@ -193,6 +438,52 @@ func parseConfigFile(filename string) *Config {
 		config.ipc.deadline = 100 * time.Millisecond
 	}
 
+	config.session.resumeWindow = time.Duration(configFile.Session.ResumeWindow) * time.Second
+
+	if configFile.Outbox.MaxBacklog != 0 {
+		config.outbox.maxBacklog = configFile.Outbox.MaxBacklog
+	} else {
+		config.outbox.maxBacklog = 256
+	}
+	if configFile.Outbox.SlowTimeout != 0 {
+		config.outbox.slowTimeout = time.Duration(configFile.Outbox.SlowTimeout) * time.Second
+	} else {
+		config.outbox.slowTimeout = 10 * time.Second
+	}
+
+	config.rateLimits.messages = make(map[string]rateLimit)
+	for msgType, limit := range configFile.RateLimits.Messages {
+		if limit.Rate <= 0 {
+			continue
+		}
+
+		burst := float64(limit.Burst)
+		if burst < 1 {
+			burst = 1
+		}
+
+		config.rateLimits.messages[msgType] = rateLimit{rate: limit.Rate, burst: burst}
+	}
+	config.rateLimits.disconnectAfter = configFile.RateLimits.DisconnectAfter
+	config.rateLimits.muteAfter = configFile.RateLimits.MuteAfter
+	if configFile.RateLimits.MuteMinutes != 0 {
+		config.rateLimits.muteDuration = time.Duration(configFile.RateLimits.MuteMinutes) * time.Minute
+	} else {
+		config.rateLimits.muteDuration = 10 * time.Minute
+	}
+
+	config.compression.enabled = configFile.Compression.Enabled
+	if configFile.Compression.Level != 0 {
+		config.compression.level = configFile.Compression.Level
+	} else {
+		config.compression.level = flate.BestSpeed
+	}
+	if configFile.Compression.MinSize != 0 {
+		config.compression.minSize = configFile.Compression.MinSize
+	} else {
+		config.compression.minSize = 512 // bytes
+	}
+
 	if configFile.Logging.MaxSize != 0 {
 		config.logging.maxSize = configFile.Logging.MaxSize
 	} else {
@@ -208,6 +499,48 @@ func parseConfigFile(filename string) *Config {
 	} else {
 		config.logging.maxAge = 28 // Days
 	}
+	if configFile.Logging.Format != "" {
+		config.logging.format = configFile.Logging.Format
+	} else {
+		config.logging.format = "text"
+	}
+	if configFile.Logging.Level != "" {
+		config.logging.level, err = parseLogLevel(configFile.Logging.Level)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		config.logging.level = slog.LevelInfo
+	}
+	config.logging.levels = map[string]slog.Level{
+		"movement": levelOff,
+	}
+	for category, str := range configFile.Logging.Categories {
+		config.logging.levels[category], err = parseLogLevel(str)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	config.metrics.token = configFile.Metrics.Token
+
+	config.recorder.enabled = configFile.Recorder.Enabled
+	if configFile.Recorder.Path != "" {
+		config.recorder.path = configFile.Recorder.Path
+	} else {
+		config.recorder.path = "recordings"
+	}
+	config.recorder.rooms = make(map[int]bool)
+	if configFile.Recorder.Rooms != "" {
+		for _, str := range strings.Split(configFile.Recorder.Rooms, ",") {
+			num, err := strconv.Atoi(str)
+			if err != nil {
+				continue
+			}
+
+			config.recorder.rooms[num] = true
+		}
+	}
 
 	config.vapidKeys.private = configFile.VapidKeys.Private
 	config.vapidKeys.public = configFile.VapidKeys.Public
@@ -216,3 +549,104 @@ func parseConfigFile(filename string) *Config {
 
 	return &config
 }
+
+// getConfig returns the current config. It is never changed once loaded,
+// reloads replace it, so read it once where settings must agree.
+func getConfig() *Config {
+	return currentConfig.Load()
+}
+
+// reloadConfig applies the settings that can change without a restart
+// and reloads the key ring, everything else keeps its startup value
+func reloadConfig() {
+	writeLog("SERVER", "config", "reloading", 200)
+
+	defer func() {
+		// parseConfigFile panics on bad configs since it's made for startup
+		if err := recover(); err != nil {
+			eprintf("config", "failed to reload config: %v", err)
+		}
+	}()
+
+	newConfig := *getConfig()
+	reloaded := parseConfigFile(configPath)
+
+	newConfig.interestRadii = reloaded.interestRadii
+	newConfig.roomCapacity = reloaded.roomCapacity
+	newConfig.roomCapacities = reloaded.roomCapacities
+	newConfig.badSounds = reloaded.badSounds
+	newConfig.pictures = reloaded.pictures
+	newConfig.picturePrefixes = reloaded.picturePrefixes
+	newConfig.battleAnimIds = reloaded.battleAnimIds
+	newConfig.chatWebhook = reloaded.chatWebhook
+	newConfig.screenshotWebhook = reloaded.screenshotWebhook
+	newConfig.ipc = reloaded.ipc
+	newConfig.database = reloaded.database
+	newConfig.playerCache = reloaded.playerCache
+	newConfig.session = reloaded.session
+	newConfig.outbox = reloaded.outbox
+	newConfig.rateLimits = reloaded.rateLimits
+	newConfig.compression.level = reloaded.compression.level
+	newConfig.compression.minSize = reloaded.compression.minSize
+	newConfig.metrics = reloaded.metrics
+	newConfig.logging.level = reloaded.logging.level
+	newConfig.logging.levels = reloaded.logging.levels
+	newConfig.recorder = reloaded.recorder
+
+	currentConfig.Store(&newConfig)
+
+	for _, roomId := range assets.maps {
+		radius := newConfig.interestRadii[roomId]
+		for _, room := range getRoomInstances(roomId) {
+			room.exec(func() {
+				room.setInterestRadius(radius)
+			})
+		}
+	}
+
+	// synced pictures and battle animations may have changed
+	clients.Range(func(client *SessionClient) bool {
+		if client.roomC != nil {
+			client.roomC.sendSyncedAssets()
+		}
+		return true
+	})
+
+	if err := serverSecurity.LoadKeys(); err != nil {
+		eprintf("security", "failed to reload keys: %s", err)
+	}
+
+	// start a new recording so it only has traffic from after the reload
+	setRecorder()
+
+	writeLog("SERVER", "config", "reloaded", 200)
+}
+
+// parseRoomValues parses comma separated room:value pairs, skipping
+// malformed pairs and values that aren't positive
+func parseRoomValues(str string) map[int]int {
+	values := make(map[int]int)
+	if str == "" {
+		return values
+	}
+
+	for _, pair := range strings.Split(str, ",") {
+		roomId, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			continue
+		}
+
+		roomIdInt, errconv := strconv.Atoi(roomId)
+		if errconv != nil {
+			continue
+		}
+		valueInt, errconv := strconv.Atoi(value)
+		if errconv != nil || valueInt <= 0 {
+			continue
+		}
+
+		values[roomIdInt] = valueInt
+	}
+
+	return values
+}
@@ -0,0 +1,77 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+// TestReloadConfig reloads the config while it is being read, run it with -race
+func TestReloadConfig(t *testing.T) {
+	prev := getConfig()
+	defer currentConfig.Store(prev)
+
+	if err := os.WriteFile("reload.yml", []byte(`
+game_name: "other"
+storage: "memory"
+room_capacity: 5
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("reload.yml")
+
+	prevPath := configPath
+	configPath = "reload.yml"
+	defer func() {
+		configPath = prevPath
+	}()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					_ = getRoomCapacity(1)
+				}
+			}
+		}()
+	}
+
+	reloadConfig()
+
+	close(stop)
+	wg.Wait()
+
+	if capacity := getRoomCapacity(1); capacity != 5 {
+		t.Errorf("got room capacity %d after reloading, want 5", capacity)
+	}
+	if gameName := getConfig().gameName; gameName != prev.gameName {
+		t.Errorf("game name changed to %s on reload, want it kept", gameName)
+	}
+	if prev.roomCapacity != 3 {
+		t.Errorf("the reload changed the previous config's room capacity to %d", prev.roomCapacity)
+	}
+}
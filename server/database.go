@@ -18,13 +18,16 @@
 package server
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"slices"
@@ -32,19 +35,234 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 )
 
-var db *sql.DB
+var db *Database
 
-func getDatabaseConn(user, password, addr, database string) *sql.DB {
+// Database times queries for the metrics endpoint, bounds them with
+// config.database.queryTimeout and logs the ones slower than config.database.slowQuery
+type Database struct {
+	*sql.DB
+
+	stmts sync.Map // query string -> *sql.Stmt
+}
+
+// Rows cancels the deadline of its query once read or closed
+type Rows struct {
+	*sql.Rows
+
+	cancel context.CancelFunc
+}
+
+func (r *Rows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+
+	r.cancel()
+
+	return false
+}
+
+func (r *Rows) Close() error {
+	defer r.cancel()
+
+	return r.Rows.Close()
+}
+
+// Row cancels the deadline of its query once scanned, or right away if the query failed.
+// Rows that are dropped without being scanned cancel it once they are collected.
+type Row struct {
+	row *sql.Row
+	err error
+
+	cancel context.CancelFunc
+}
+
+func newRow(row *sql.Row, err error, cancel context.CancelFunc) *Row {
+	if err == nil {
+		err = row.Err()
+	}
+
+	if err != nil {
+		cancel()
+		return &Row{err: err, cancel: cancel}
+	}
+
+	r := &Row{row: row, cancel: cancel}
+	runtime.SetFinalizer(r, func(r *Row) { r.cancel() })
+
+	return r
+}
+
+func (r *Row) Scan(dest ...any) error {
+	defer r.cancel()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.row.Scan(dest...)
+}
+
+func (r *Row) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+
+	// the row won't be scanned after failing
+	err := r.row.Err()
+	if err != nil {
+		r.cancel()
+	}
+
+	return err
+}
+
+func getDatabaseConn(user, password, addr, database string) *Database {
 	conn, err := sql.Open("mysql", fmt.Sprintf("%s:%s@%s/%s?parseTime=true", user, password, addr, database))
 	if err != nil {
 		panic(err)
 	}
 
-	return conn
+	return &Database{DB: conn}
 }
 
-func getOrCreatePlayerData(ip string) (uuid string, banned bool, muted bool) {
-	err := db.QueryRow("SELECT uuid, banned, muted FROM players WHERE ip = ?", ip).Scan(&uuid, &banned, &muted)
+func (d *Database) Exec(query string, args ...any) (sql.Result, error) {
+	return d.ExecContext(context.Background(), query, args...)
+}
+
+func (d *Database) Query(query string, args ...any) (*Rows, error) {
+	return d.QueryContext(context.Background(), query, args...)
+}
+
+func (d *Database) QueryRow(query string, args ...any) *Row {
+	return d.QueryRowContext(context.Background(), query, args...)
+}
+
+func (d *Database) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	defer observeQuery("exec", query, time.Now())
+
+	return d.DB.ExecContext(ctx, query, args...)
+}
+
+func (d *Database) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+
+	defer observeQuery("query", query, time.Now())
+
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &Rows{rows, cancel}, nil
+}
+
+// QueryRowContext only times the query, not reading the row with Scan
+func (d *Database) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	ctx, cancel := withQueryTimeout(ctx)
+
+	defer observeQuery("queryrow", query, time.Now())
+
+	return newRow(d.DB.QueryRowContext(ctx, query, args...), nil, cancel)
+}
+
+// ExecPrepared is ExecContext through a cached prepared statement, for hot queries with a fixed query string
+func (d *Database) ExecPrepared(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	defer observeQuery("exec", query, time.Now())
+
+	stmt, err := d.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.ExecContext(ctx, args...)
+}
+
+// QueryRowPrepared is QueryRowContext through a cached prepared statement, for hot queries with a fixed query string
+func (d *Database) QueryRowPrepared(ctx context.Context, query string, args ...any) *Row {
+	ctx, cancel := withQueryTimeout(ctx)
+
+	defer observeQuery("queryrow", query, time.Now())
+
+	stmt, err := d.prepare(ctx, query)
+	if err != nil {
+		return newRow(nil, err, cancel)
+	}
+
+	return newRow(stmt.QueryRowContext(ctx, args...), nil, cancel)
+}
+
+// prepare returns the statement for query, preparing it on first use.
+// Statements are never closed, so query strings must not be built from values
+// or vary in length like batch writes do.
+func (d *Database) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if stmt, ok := d.stmts.Load(query); ok {
+		return stmt.(*sql.Stmt), nil
+	}
+
+	stmt, err := d.DB.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, loaded := d.stmts.LoadOrStore(query, stmt); loaded {
+		stmt.Close()
+		return existing.(*sql.Stmt), nil
+	}
+
+	return stmt, nil
+}
+
+// withQueryTimeout keeps ctx's own deadline if it is sooner. Background jobs
+// use contexts that are never canceled, those get their own timeout instead.
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := getConfig().database.queryTimeout
+
+	if ctx.Done() == nil {
+		timeout = getConfig().database.backgroundQueryTimeout
+		if timeout <= 0 {
+			return ctx, func() {}
+		}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+func observeQuery(op string, query string, start time.Time) {
+	elapsed := time.Since(start)
+
+	metrics.dbQueries.observe(op, elapsed)
+
+	if slowQuery := getConfig().database.slowQuery; slowQuery > 0 && elapsed >= slowQuery {
+		writeLog("SERVER", "db", fmt.Sprintf("slow %s (%s) at %s: %s", op, elapsed.Round(time.Millisecond), getQueryCallSite(), query), 400)
+	}
+}
+
+// getQueryCallSite finds the first caller outside of Database
+func getQueryCallSite() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+
+	for {
+		frame, more := frames.Next()
+		if !strings.Contains(frame.Function, "(*Database).") && !strings.HasSuffix(frame.Function, ".observeQuery") && !strings.HasPrefix(frame.Function, "runtime.") {
+			return fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+func getOrCreatePlayerData(ctx context.Context, ip string) (uuid string, banned bool, muted bool) {
+	uuid, banned, muted, err := store.players.getPlayerDataFromIp(ctx, ip)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return "", false, false
@@ -52,87 +270,111 @@ func getOrCreatePlayerData(ip string) (uuid string, banned bool, muted bool) {
 
 		// create new guest account
 		uuid = randString(16)
-		createPlayerData(ip, uuid, banned)
+		createPlayerData(ctx, ip, uuid, banned)
 
 		// recheck moderation status
 		if !banned {
-			banned, muted = getPlayerModerationStatus(uuid)
+			banned, muted = getPlayerModerationStatus(ctx, uuid)
 		}
 	}
 
 	return uuid, banned, muted
 }
 
-func getPlayerDataFromToken(token string) (uuid string, name string, rank int, badge string, banned bool, muted bool) {
-	err := db.QueryRow("SELECT a.uuid, a.user, pd.rank, a.badge, pd.banned, pd.muted FROM accounts a JOIN playerSessions ps ON ps.uuid = a.uuid JOIN players pd ON pd.uuid = a.uuid WHERE ps.sessionId = ? AND NOW() < ps.expiration", token).Scan(&uuid, &name, &rank, &badge, &banned, &muted)
+func getPlayerDataFromToken(ctx context.Context, token string) (uuid string, name string, rank int, badge string, banned bool, muted bool) {
+	if cached, ok := playerCache.get(playerCacheData, token); ok {
+		data := cached.(PlayerCacheData)
+		return data.uuid, data.name, data.rank, data.badge, data.banned, data.muted
+	}
+
+	generation := playerCache.getGeneration()
+	uuid, name, rank, badge, banned, muted, err := store.players.getPlayerDataFromToken(ctx, token)
 	if err != nil {
 		return "", "", 0, "", false, false
 	}
 
+	playerCache.set(generation, playerCacheData, token, uuid, PlayerCacheData{uuid, name, rank, badge, banned, muted})
+
 	return uuid, name, rank, badge, banned, muted
 }
 
-func getPlayerRank(uuid string) (rank int) {
+func getPlayerRank(ctx context.Context, uuid string) (rank int) {
+	if uuid == systemUuid {
+		return systemRank
+	}
+
 	if client, ok := clients.Load(uuid); ok {
 		return client.rank // return rank from session if client is connected
 	}
 
-	err := db.QueryRow("SELECT rank FROM players WHERE uuid = ?", uuid).Scan(&rank)
+	if cached, ok := playerCache.get(playerCacheRank, uuid); ok {
+		return cached.(int)
+	}
+
+	generation := playerCache.getGeneration()
+	rank, err := store.players.getPlayerRank(ctx, uuid)
 	if err != nil {
 		return 0
 	}
 
+	playerCache.set(generation, playerCacheRank, uuid, uuid, rank)
+
 	return rank
 }
 
-func tryBanPlayer(senderUuid string, recipientUuid string, disconnect, broadcast bool) error { // called by api only
-	if getPlayerRank(senderUuid) <= getPlayerRank(recipientUuid) {
+func tryBanPlayer(ctx context.Context, senderUuid string, recipientUuid string, disconnect, broadcast bool) error { // called by api only
+	if getPlayerRank(ctx, senderUuid) <= getPlayerRank(ctx, recipientUuid) {
 		return errors.New("insufficient rank")
 	}
 
 	if senderUuid == recipientUuid {
 		return errors.New("attempted self-ban")
 	}
-	return banPlayerUnchecked(recipientUuid, true, disconnect, false, broadcast)
+	return banPlayerUnchecked(ctx, recipientUuid, true, disconnect, false, broadcast)
 }
 
-func tryBanPlayerWithExpiry(senderUuid, recipientUuid string, expiry time.Time, reason string, broadcast bool) error {
-	err := tryBanPlayer(senderUuid, recipientUuid, true, broadcast)
+func tryBanPlayerWithExpiry(ctx context.Context, senderUuid, recipientUuid string, expiry time.Time, reason string, broadcast bool) error {
+	err := tryBanPlayer(ctx, senderUuid, recipientUuid, true, broadcast)
 	if err != nil {
 		return err
 	}
 
-	return registerModAction(recipientUuid, actionBan, expiry, reason)
+	return registerModAction(ctx, recipientUuid, actionBan, expiry, reason)
 }
 
-func registerModAction(uuid string, action int, expiry time.Time, reason string) error {
-	_, err := db.Exec(
-		"INSERT INTO playerModerationActions (uuid, action, reason, time, expiry) VALUES (?, ?, ?, NOW(), ?)",
-		uuid, action, reason, expiry)
+func registerModAction(ctx context.Context, uuid string, action int, expiry time.Time, reason string) error {
+	err := store.moderation.writeModAction(ctx, uuid, action, reason, expiry)
 	if err != nil {
 		return err
 	}
 
 	return scheduleModActionReversal(uuid, action, expiry)
 }
-func banPlayerUnchecked(recipientUuid string, updateDb, disconnect, temporary, broadcast bool) error {
-	name := getNameFromUuid(recipientUuid)
+func banPlayerUnchecked(ctx context.Context, recipientUuid string, updateDb, disconnect, temporary, broadcast bool) error {
+	name := getNameFromUuid(ctx, recipientUuid)
 
 	if updateDb {
-		_, err := db.Exec("UPDATE players SET banned = 1 WHERE uuid = ?", recipientUuid)
+		err := store.players.setPlayerBanned(ctx, recipientUuid, true)
 		if err != nil {
 			return err
 		}
+
+		invalidatePlayerCache(recipientUuid)
 	}
 
+	// spectators have no session to be banned in
+	dropSpectator(recipientUuid)
+
 	if client, ok := clients.Load(recipientUuid); ok {
 		client.banned = true
 		if client.roomC != nil {
-			for _, other := range clients.Get() {
-				if other.roomC != nil && other.roomC.room == client.roomC.room {
-					other.roomC.outbox <- buildMsg("d", client.id)
+			msg := buildMsg("d", client.id)
+			clients.Range(func(other *SessionClient) bool {
+				if other.roomC != nil && other.roomC.getRoom() == client.roomC.getRoom() {
+					other.roomC.outbox.send(msg)
 				}
-			}
+				return true
+			})
 		}
 
 		if broadcast {
@@ -147,17 +389,17 @@ func banPlayerUnchecked(recipientUuid string, updateDb, disconnect, temporary, b
 
 		if disconnect {
 			if client.roomC != nil {
-				client.roomC.cancel()
+				client.roomC.terminate()
 			}
-			client.cancel()
+			client.terminate()
 		}
 	}
 
 	return nil
 }
 
-func tryUnbanPlayer(senderUuid string, recipientUuid string) error { // called by api only
-	if getPlayerRank(senderUuid) <= getPlayerRank(recipientUuid) {
+func tryUnbanPlayer(ctx context.Context, senderUuid string, recipientUuid string) error { // called by api only
+	if getPlayerRank(ctx, senderUuid) <= getPlayerRank(ctx, recipientUuid) {
 		return errors.New("insufficient rank")
 	}
 
@@ -165,53 +407,57 @@ func tryUnbanPlayer(senderUuid string, recipientUuid string) error { // called b
 		return errors.New("attempted self-unban")
 	}
 
-	return unbanPlayerUnchecked(recipientUuid)
+	return unbanPlayerUnchecked(ctx, recipientUuid)
 }
 
-func unbanPlayerUnchecked(recipientUuid string) error {
-	_, err := db.Exec("UPDATE players SET banned = 0 WHERE uuid = ?", recipientUuid)
+func unbanPlayerUnchecked(ctx context.Context, recipientUuid string) error {
+	err := store.players.setPlayerBanned(ctx, recipientUuid, false)
 	if err != nil {
 		return err
 	}
 
+	invalidatePlayerCache(recipientUuid)
+
 	systemMessage("You have been unbanned.", recipientUuid)
 
 	return nil
 }
 
-func tryMutePlayer(senderUuid string, recipientUuid string, temporary, broadcast bool) error { // called by api only
-	if getPlayerRank(senderUuid) <= getPlayerRank(recipientUuid) {
+func tryMutePlayer(ctx context.Context, senderUuid string, recipientUuid string, temporary, broadcast bool) error { // called by api only
+	if getPlayerRank(ctx, senderUuid) <= getPlayerRank(ctx, recipientUuid) {
 		return errors.New("insufficient rank")
 	}
 
 	if senderUuid == recipientUuid {
 		return errors.New("attempted self-mute")
 	}
-	return mutePlayerUnchecked(recipientUuid, true, temporary, broadcast)
+	return mutePlayerUnchecked(ctx, recipientUuid, true, temporary, broadcast)
 }
 
-func tryMutePlayerWithExpiry(senderUuid, recipientUuid string, expiry time.Time, reason string, broadcast bool) error {
-	err := tryMutePlayer(senderUuid, recipientUuid, true, broadcast)
+func tryMutePlayerWithExpiry(ctx context.Context, senderUuid, recipientUuid string, expiry time.Time, reason string, broadcast bool) error {
+	err := tryMutePlayer(ctx, senderUuid, recipientUuid, true, broadcast)
 	if err != nil {
 		return err
 	}
 
-	return registerModAction(recipientUuid, actionMute, expiry, reason)
+	return registerModAction(ctx, recipientUuid, actionMute, expiry, reason)
 }
 
-func mutePlayerUnchecked(recipientUuid string, updateDb, temporary, broadcast bool) error {
+func mutePlayerUnchecked(ctx context.Context, recipientUuid string, updateDb, temporary, broadcast bool) error {
 	if updateDb {
-		_, err := db.Exec("UPDATE players SET muted = 1 WHERE uuid = ?", recipientUuid)
+		err := store.players.setPlayerMuted(ctx, recipientUuid, true)
 		if err != nil {
 			return err
 		}
+
+		invalidatePlayerCache(recipientUuid)
 	}
 
 	if client, ok := clients.Load(recipientUuid); ok { // mute client if they're connected
 		client.muted = true
 
 		if broadcast {
-			name := getNameFromUuid(recipientUuid)
+			name := getNameFromUuid(ctx, recipientUuid)
 			var msg string
 			if temporary {
 				msg = fmt.Sprintf("*%s has been temporarily muted.*", name)
@@ -225,8 +471,8 @@ func mutePlayerUnchecked(recipientUuid string, updateDb, temporary, broadcast bo
 	return nil
 }
 
-func tryUnmutePlayer(senderUuid string, recipientUuid string) error { // called by api only
-	if getPlayerRank(senderUuid) <= getPlayerRank(recipientUuid) {
+func tryUnmutePlayer(ctx context.Context, senderUuid string, recipientUuid string) error { // called by api only
+	if getPlayerRank(ctx, senderUuid) <= getPlayerRank(ctx, recipientUuid) {
 		return errors.New("insufficient rank")
 	}
 
@@ -234,27 +480,29 @@ func tryUnmutePlayer(senderUuid string, recipientUuid string) error { // called
 		return errors.New("attempted self-unmute")
 	}
 
-	return unmutePlayerUnchecked(recipientUuid)
+	return unmutePlayerUnchecked(ctx, recipientUuid)
 }
 
-func unmutePlayerUnchecked(recipientUuid string) error {
-	_, err := db.Exec("UPDATE players SET muted = 0 WHERE uuid = ?", recipientUuid)
+func unmutePlayerUnchecked(ctx context.Context, recipientUuid string) error {
+	err := store.players.setPlayerMuted(ctx, recipientUuid, false)
 	if err != nil {
 		return err
 	}
 
+	invalidatePlayerCache(recipientUuid)
+
 	// unmute client if they're connected
 	systemMessage("You have been unmuted.", recipientUuid)
 
 	return nil
 }
 
-func tryChangePlayerUsername(senderUuid string, recipientUuid string, newUsername string) error { // called by api only
-	if getPlayerRank(senderUuid) <= getPlayerRank(recipientUuid) {
+func tryChangePlayerUsername(ctx context.Context, senderUuid string, recipientUuid string, newUsername string) error { // called by api only
+	if getPlayerRank(ctx, senderUuid) <= getPlayerRank(ctx, recipientUuid) {
 		return errors.New("insufficient rank")
 	}
 
-	existingUuid, err := getUuidFromName(newUsername)
+	existingUuid, err := getUuidFromName(ctx, newUsername)
 	if err != nil {
 		return err
 	}
@@ -262,32 +510,37 @@ func tryChangePlayerUsername(senderUuid string, recipientUuid string, newUsernam
 		return errors.New("user with new username already exists")
 	}
 
-	_, err = db.Exec("UPDATE accounts SET user = ? WHERE uuid = ?", newUsername, recipientUuid)
+	err = store.players.setAccountName(ctx, recipientUuid, newUsername)
 	if err != nil {
 		return err
 	}
 
+	invalidatePlayerCache(recipientUuid)
+
 	if client, ok := clients.Load(recipientUuid); ok { // change client username if they're connected
-		client.name = newUsername
+		// the name is read on the room's goroutine, so set it there
+		client.inRoom(func(room *Room) {
+			client.name = newUsername
 
-		if client.roomC != nil {
-			client.roomC.broadcast(buildMsg("name", client.id, newUsername)) // broadcast name change to room if client is in one
-		}
+			if room != nil {
+				client.roomC.broadcast(buildMsg("name", client.id, newUsername)) // broadcast name change to room if client is in one
+			}
+		})
 	}
 
 	return nil
 }
 
-func getPlayerMedals(uuid string) (medals [5]int) {
+func getPlayerMedals(ctx context.Context, uuid string) (medals [5]int) {
 	if client, ok := clients.Load(uuid); ok {
 		select {
-		case <-client.ctx.Done(): // disconnecting, fetch from DB
+		case <-client.getCtx().Done(): // disconnecting, fetch from DB
 		default:
 			return client.medals
 		}
 	}
 
-	err := db.QueryRow("SELECT pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM players pd LEFT JOIN playerGameData pgd ON pgd.uuid = pd.uuid WHERE pd.uuid = ? AND pgd.game = ?", uuid, config.gameName).Scan(&medals[0], &medals[1], &medals[2], &medals[3], &medals[4])
+	medals, err := store.players.getPlayerMedals(ctx, uuid)
 	if err != nil {
 		return [5]int{}
 	}
@@ -295,8 +548,8 @@ func getPlayerMedals(uuid string) (medals [5]int) {
 	return medals
 }
 
-func getPlayerModerationStatus(uuid string) (banned bool, muted bool) {
-	err := db.QueryRow("SELECT banned, muted FROM players WHERE uuid = ?", uuid).Scan(&banned, &muted)
+func getPlayerModerationStatus(ctx context.Context, uuid string) (banned bool, muted bool) {
+	banned, muted, err := store.players.getPlayerModerationStatus(ctx, uuid)
 	if err != nil {
 		return false, false
 	}
@@ -304,8 +557,8 @@ func getPlayerModerationStatus(uuid string) (banned bool, muted bool) {
 	return banned, muted
 }
 
-func tryBlockPlayer(uuid string, targetUuid string) error { // called by api only
-	if getPlayerRank(uuid) < getPlayerRank(targetUuid) {
+func tryBlockPlayer(ctx context.Context, uuid string, targetUuid string) error { // called by api only
+	if getPlayerRank(ctx, uuid) < getPlayerRank(ctx, targetUuid) {
 		return errors.New("insufficient rank")
 	}
 
@@ -313,7 +566,7 @@ func tryBlockPlayer(uuid string, targetUuid string) error { // called by api onl
 		return errors.New("attempted self-block")
 	}
 
-	_, err := db.Exec("INSERT IGNORE INTO playerBlocks (uuid, targetUuid, timestamp) VALUES (?, ?, UTC_TIMESTAMP())", uuid, targetUuid)
+	err := store.players.blockPlayer(ctx, uuid, targetUuid)
 	if err != nil {
 		return err
 	}
@@ -321,8 +574,8 @@ func tryBlockPlayer(uuid string, targetUuid string) error { // called by api onl
 	return nil
 }
 
-func tryUnblockPlayer(uuid string, targetUuid string) error { // called by api only
-	_, err := db.Exec("DELETE FROM playerBlocks WHERE uuid = ? AND targetUuid = ?", uuid, targetUuid)
+func tryUnblockPlayer(ctx context.Context, uuid string, targetUuid string) error { // called by api only
+	err := store.players.unblockPlayer(ctx, uuid, targetUuid)
 	if err != nil {
 		return err
 	}
@@ -330,50 +583,24 @@ func tryUnblockPlayer(uuid string, targetUuid string) error { // called by api o
 	return nil
 }
 
-func isPlayerBlocked(uuid string, targetUuid string) bool {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM playerBlocks WHERE uuid = ? AND targetUuid = ?", uuid, targetUuid).Scan(&count)
+func isPlayerBlocked(ctx context.Context, uuid string, targetUuid string) bool {
+	blocked, err := store.players.isPlayerBlocked(ctx, uuid, targetUuid)
 	if err != nil {
 		return false
 	}
-	return count > 0
+	return blocked
 }
 
-func getBlockedPlayerData(uuid string) ([]*PlayerListData, error) {
-	var blockedPlayers []*PlayerListData
-
-	results, err := db.Query("SELECT pd.uuid, COALESCE(a.user, pgd.name), pd.rank, CASE WHEN a.user IS NULL THEN 0 ELSE 1 END, COALESCE(a.badge, ''), pgd.systemName, pgd.spriteName, pgd.spriteIndex, pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM players pd JOIN playerBlocks pb ON pb.targetUuid = pd.uuid AND pb.uuid = ? JOIN playerGameData pgd ON pgd.uuid = pd.uuid LEFT JOIN accounts a ON a.uuid = pd.uuid WHERE pgd.game = ? ORDER BY pb.timestamp", uuid, config.gameName)
-	if err != nil {
-		return blockedPlayers, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var blockedPlayer PlayerListData
-
-		err := results.Scan(&blockedPlayer.Uuid, &blockedPlayer.Name, &blockedPlayer.Rank, &blockedPlayer.Account, &blockedPlayer.Badge, &blockedPlayer.SystemName, &blockedPlayer.SpriteName, &blockedPlayer.SpriteIndex, &blockedPlayer.Medals[0], &blockedPlayer.Medals[1], &blockedPlayer.Medals[2], &blockedPlayer.Medals[3], &blockedPlayer.Medals[4])
-		if err != nil {
-			return blockedPlayers, err
-		}
-
-		blockedPlayers = append(blockedPlayers, &blockedPlayer)
-	}
-
-	return blockedPlayers, nil
+func getBlockedPlayerData(ctx context.Context, uuid string) ([]*PlayerListData, error) {
+	return store.players.getBlockedPlayerData(ctx, uuid)
 }
 
-func createPlayerData(ip string, uuid string, banned bool) error {
-	_, err := db.Exec("INSERT INTO players (ip, uuid, banned) VALUES (?, ?, ?)", ip, uuid, banned)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func createPlayerData(ctx context.Context, ip string, uuid string, banned bool) error {
+	return store.players.createPlayerData(ctx, ip, uuid, banned)
 }
 
-func getPlayerGameData(uuid string) (spriteName string, spriteIndex int, systemName string) {
-	err := db.QueryRow("SELECT pgd.spriteName, pgd.spriteIndex, pgd.systemName FROM players pd LEFT JOIN playerGameData pgd ON pgd.uuid = pd.uuid WHERE pd.uuid = ? AND pgd.game = ?", uuid, config.gameName).Scan(&spriteName, &spriteIndex, &systemName)
+func getPlayerGameData(ctx context.Context, uuid string) (spriteName string, spriteIndex int, systemName string) {
+	spriteName, spriteIndex, systemName, err := store.players.getPlayerGameData(ctx, uuid)
 	if err != nil {
 		return "", 0, ""
 	}
@@ -382,216 +609,162 @@ func getPlayerGameData(uuid string) (spriteName string, spriteIndex int, systemN
 }
 
 func (c *SessionClient) addOrUpdatePlayerGameData() error {
-	_, err := db.Exec("INSERT INTO playerGameData (uuid, game, online) VALUES (?, ?, 1) ON DUPLICATE KEY UPDATE online = 1, timestampLastActive = UTC_TIMESTAMP()", c.uuid, config.gameName)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return store.players.addOrUpdatePlayerGameData(c.getCtx(), c.uuid)
 }
 
+// updatePlayerGameActivity must not be used from a room's goroutine, see inRoom
 func (c *SessionClient) updatePlayerGameActivity(online bool) error {
-	_, err := db.Exec("UPDATE playerGameData SET name = ?, systemName = ?, spriteName = ?, spriteIndex = ?, online = ?, timestampLastActive = UTC_TIMESTAMP() WHERE uuid = ? AND game = ?", c.name, c.system, c.sprite, c.spriteIndex, online, c.uuid, config.gameName)
-	if err != nil {
-		return err
-	}
+	// the sprite and system graphic are set on the room's goroutine
+	var activity PlayerGameActivity
+	c.inRoom(func(*Room) {
+		activity = PlayerGameActivity{c.uuid, c.name, c.system, c.sprite, c.spriteIndex, online}
+	})
 
-	return nil
-}
+	seq := gameActivitySeq.Add(1)
 
-func getPlayerInfo(ip string) (uuid string, name string, rank int) {
-	err := db.QueryRow("SELECT pd.uuid, pgd.name, pd.rank FROM players pd LEFT JOIN playerGameData pgd ON pgd.uuid = pd.uuid WHERE pd.ip = ? AND (pgd.uuid IS NULL OR pgd.game = ?)", ip, config.gameName).Scan(&uuid, &name, &rank)
-	if err != nil {
-		return "", "", 0
+	if !online {
+		// going offline has to be written after the updates already queued, so wait
+		// for room until the server shuts down
+		err := gameActivityQueue.add(serverCtx, GameActivityWrite{activity, seq})
+		if errors.Is(err, context.Canceled) {
+			return writeGameActivityDirectly(activity, seq)
+		}
+		return err
 	}
 
-	return uuid, name, rank
-}
+	// activity is last-write-wins, so rather than holding up the caller while the queue
+	// is full, drop the update and let the next one replace it
+	ctx, cancel := context.WithTimeout(context.Background(), gameActivityWait)
+	defer cancel()
 
-func getPlayerInfoFromToken(token string) (uuid string, name string, rank int, badge string, badgeSlotRows int, badgeSlotCols int, screenshotLimit int) {
-	err := db.QueryRow("SELECT a.uuid, a.user, pd.rank, a.badge, a.badgeSlotRows, a.badgeSlotCols, a.screenshotLimit FROM accounts a JOIN playerSessions ps ON ps.uuid = a.uuid JOIN players pd ON pd.uuid = a.uuid WHERE ps.sessionId = ? AND NOW() < ps.expiration", token).Scan(&uuid, &name, &rank, &badge, &badgeSlotRows, &badgeSlotCols, &screenshotLimit)
-	if err != nil {
-		return "", "", 0, "", 0, 0, 0
+	err := gameActivityQueue.add(ctx, GameActivityWrite{activity, seq})
+	if errors.Is(err, context.DeadlineExceeded) {
+		metrics.writeQueueDrops.inc(gameActivityQueue.name)
+		return nil
 	}
 
-	return uuid, name, rank, badge, badgeSlotRows, badgeSlotCols, screenshotLimit
+	return err
 }
 
-func updatePlayerActivity() error {
-	_, err := db.Exec("UPDATE accounts SET inactive = CASE WHEN timestampLoggedIn IS NULL OR timestampLoggedIn < DATE_SUB(NOW(), INTERVAL 3 MONTH) THEN 1 ELSE 0 END")
-	if err != nil {
-		return err
-	}
+// writeGameActivityDirectly writes activity without queueing it,
+// the player's updates still in the queue are skipped when it is flushed
+func writeGameActivityDirectly(activity PlayerGameActivity, seq uint64) error {
+	directGameActivities.mutex.Lock()
+	defer directGameActivities.mutex.Unlock()
 
-	return nil
-}
+	directGameActivities.seqs[activity.Uuid] = seq
 
-func setActivePlayersOffline(game string) error {
-	_, err := db.Exec("UPDATE playerGameData SET online = 0 WHERE game = ? AND online = 1", game)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return writePlayerGameActivities([]PlayerGameActivity{activity})
 }
 
-func writeGlobalChatMessage(msgId, uuid, mapId, prevMapId, prevLocations string, x, y int, contents string) error {
-	_, err := db.Exec("INSERT INTO chatMessages (msgId, game, uuid, mapId, prevMapId, prevLocations, x, y, contents) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", msgId, config.gameName, uuid, mapId, prevMapId, prevLocations, x, y, contents)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
+// writeQueuedGameActivities writes queued activity that hasn't been superseded by a direct write
+func writeQueuedGameActivities(writes []GameActivityWrite) error {
+	// held while writing so a direct write can't land between the check and the write
+	directGameActivities.mutex.Lock()
+	defer directGameActivities.mutex.Unlock()
 
-func updatePlayerLastChatMessage(uuid, lastMsgId string, party bool) error {
-	query := "UPDATE playerGameData SET "
+	activities := make([]PlayerGameActivity, 0, len(writes))
+	for _, write := range writes {
+		directSeq, ok := directGameActivities.seqs[write.activity.Uuid]
+		if ok {
+			if write.seq < directSeq {
+				continue
+			}
+			// queued after the direct write, so are any that follow
+			delete(directGameActivities.seqs, write.activity.Uuid)
+		}
 
-	if party {
-		query += "lastPartyMsgId"
-	} else {
-		query += "lastGlobalMsgId"
+		activities = append(activities, write.activity)
 	}
 
-	query += " = ? WHERE uuid = ? AND game = ?"
-
-	_, err := db.Exec(query, lastMsgId, uuid, config.gameName)
-	if err != nil {
-		return err
+	if len(activities) == 0 {
+		return nil
 	}
 
-	return nil
+	return writePlayerGameActivities(activities)
 }
 
-func getChatMessageHistory(uuid string, globalMsgLimit, partyMsgLimit int, lastMsgId string) (*ChatHistory, error) {
-	var chatHistory ChatHistory
-
-	partyId, err := getPlayerPartyId(uuid)
-	if err != nil {
-		return &chatHistory, err
+// writePlayerGameActivities writes the latest activity of every player in activities
+func writePlayerGameActivities(activities []PlayerGameActivity) error {
+	latest := make(map[string]int, len(activities))
+	for i, activity := range activities {
+		latest[activity.Uuid] = i
 	}
 
-	var query string
-
-	selectClause := "SELECT cm.msgId, cm.uuid, cm.mapId, cm.prevMapId, cm.prevLocations, cm.x, cm.y, cm.contents, cm.timestamp, "
-	globalSelectClause := selectClause + "0"
-	partySelectClause := selectClause + "1"
-
-	fromClause := " FROM chatMessages cm JOIN players pd ON pd.uuid = cm.uuid JOIN playerGameData pgd ON pgd.uuid = pd.uuid AND pgd.game = cm.game "
-
-	whereClause := "WHERE cm.game = ? AND pd.banned = 0"
-
-	if lastMsgId != "" {
-		whereClause += " AND cm.timestamp > (SELECT cm2.timestamp FROM chatMessages cm2 WHERE cm2.msgId = ?)"
-	}
-
-	globalWhereClause := whereClause + " AND cm.partyId IS NULL AND (pgd.lastGlobalMsgId IS NULL OR cm.timestamp > (SELECT cmg.timestamp FROM chatMessages cmg WHERE cmg.msgId = pgd.lastGlobalMsgId)) ORDER BY 9 DESC"
-	partyWhereClause := whereClause + " AND cm.partyId = ? AND (pgd.lastPartyMsgId IS NULL OR cm.timestamp > (SELECT cmp.timestamp FROM chatMessages cmp WHERE cmp.msgId = pgd.lastPartyMsgId)) ORDER BY 9 DESC"
-
-	var messageQueryArgs []interface{}
-
-	messageQueryArgs = append(messageQueryArgs, config.gameName)
-
-	if lastMsgId != "" {
-		messageQueryArgs = append(messageQueryArgs, lastMsgId)
-	}
-
-	messageQueryArgs = append(messageQueryArgs, globalMsgLimit)
-
-	query += "("
-
-	if partyId == 0 {
-		query += globalSelectClause + fromClause + globalWhereClause + " LIMIT ?"
-	} else {
-		messageQueryArgs = append(messageQueryArgs, config.gameName)
-
-		if lastMsgId != "" {
-			messageQueryArgs = append(messageQueryArgs, lastMsgId)
+	if len(latest) != len(activities) {
+		var deduped []PlayerGameActivity
+		for i, activity := range activities {
+			if latest[activity.Uuid] == i {
+				deduped = append(deduped, activity)
+			}
 		}
-
-		messageQueryArgs = append(messageQueryArgs, partyId, partyMsgLimit)
-
-		query += globalSelectClause + fromClause + globalWhereClause + " LIMIT ?) UNION (" + partySelectClause + fromClause + partyWhereClause + " LIMIT ?"
+		activities = deduped
 	}
 
-	query += ") ORDER BY 9"
+	return store.players.updatePlayerGameActivities(context.Background(), activities)
+}
 
-	messageResults, err := db.Query(query, messageQueryArgs...)
+func getPlayerInfo(ctx context.Context, ip string) (uuid string, name string, rank int) {
+	uuid, name, rank, err := store.players.getPlayerInfo(ctx, ip)
 	if err != nil {
-		return &chatHistory, err
-	}
-
-	defer messageResults.Close()
-
-	for messageResults.Next() {
-		var chatMessage ChatMessage
-
-		err := messageResults.Scan(&chatMessage.MsgId, &chatMessage.Uuid, &chatMessage.MapId, &chatMessage.PrevMapId, &chatMessage.PrevLocations, &chatMessage.X, &chatMessage.Y, &chatMessage.Contents, &chatMessage.Timestamp, &chatMessage.Party)
-		if err != nil {
-			return &chatHistory, err
-		}
-
-		chatHistory.Messages = append(chatHistory.Messages, &chatMessage)
+		return "", "", 0
 	}
 
-	var firstTimestamp time.Time
-	var lastTimestamp time.Time
+	return uuid, name, rank
+}
 
-	if len(chatHistory.Messages) != 0 {
-		firstTimestamp = chatHistory.Messages[0].Timestamp
-		lastTimestamp = chatHistory.Messages[len(chatHistory.Messages)-1].Timestamp
+func getPlayerInfoFromToken(ctx context.Context, token string) (uuid string, name string, rank int, badge string, badgeSlotRows int, badgeSlotCols int, screenshotLimit int) {
+	if cached, ok := playerCache.get(playerCacheInfo, token); ok {
+		info := cached.(PlayerCacheInfo)
+		return info.uuid, info.name, info.rank, info.badge, info.badgeSlotRows, info.badgeSlotCols, info.screenshotLimit
 	}
 
-	playersQuery := "SELECT DISTINCT pd.uuid, COALESCE(a.user, pgd.name), pd.rank, CASE WHEN a.user IS NULL THEN 0 ELSE 1 END, COALESCE(a.badge, ''), pgd.systemName, pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM players pd JOIN playerGameData pgd ON pgd.uuid = pd.uuid LEFT JOIN accounts a ON a.uuid = pd.uuid WHERE pgd.game = ? AND EXISTS (SELECT cm.uuid FROM chatMessages cm WHERE cm.uuid = pd.uuid AND cm.game = pgd.game AND cm.timestamp BETWEEN ? AND ? "
-
-	var playerQueryArgs []interface{}
-
-	playerQueryArgs = append(playerQueryArgs, config.gameName, firstTimestamp, lastTimestamp)
-
-	if partyId == 0 {
-		playersQuery += "AND cm.partyId IS NULL"
-	} else {
-		playersQuery += "AND (cm.partyId IS NULL OR cm.partyId = ?)"
-
-		playerQueryArgs = append(playerQueryArgs, partyId)
+	generation := playerCache.getGeneration()
+	uuid, name, rank, badge, badgeSlotRows, badgeSlotCols, screenshotLimit, err := store.players.getPlayerInfoFromToken(ctx, token)
+	if err != nil {
+		return "", "", 0, "", 0, 0, 0
 	}
 
-	playersQuery += ")"
+	playerCache.set(generation, playerCacheInfo, token, uuid, PlayerCacheInfo{uuid, name, rank, badge, badgeSlotRows, badgeSlotCols, screenshotLimit})
 
-	playerResults, err := db.Query(playersQuery, playerQueryArgs...)
-	if err != nil {
-		return &chatHistory, err
-	}
+	return uuid, name, rank, badge, badgeSlotRows, badgeSlotCols, screenshotLimit
+}
 
-	defer playerResults.Close()
+func updatePlayerActivity() error {
+	return store.players.updatePlayerActivity(context.Background())
+}
 
-	for playerResults.Next() {
-		var chatPlayer ChatPlayer
+func setActivePlayersOffline(game string) error {
+	return store.players.setActivePlayersOffline(context.Background(), game)
+}
 
-		err := playerResults.Scan(&chatPlayer.Uuid, &chatPlayer.Name, &chatPlayer.Rank, &chatPlayer.Account, &chatPlayer.Badge, &chatPlayer.SystemName, &chatPlayer.Medals[0], &chatPlayer.Medals[1], &chatPlayer.Medals[2], &chatPlayer.Medals[3], &chatPlayer.Medals[4])
-		if err != nil {
-			return &chatHistory, err
-		}
+func writeGlobalChatMessage(ctx context.Context, msgId, uuid, mapId, prevMapId, prevLocations string, x, y int, contents string) error {
+	return chatMessageQueue.add(ctx, ChatMessageWrite{msgId, uuid, mapId, prevMapId, prevLocations, x, y, contents})
+}
 
-		chatHistory.Players = append(chatHistory.Players, &chatPlayer)
-	}
+func writeGlobalChatMessages(messages []ChatMessageWrite) error {
+	return store.chat.writeChatMessages(context.Background(), messages)
+}
 
-	return &chatHistory, nil
+func updatePlayerLastChatMessage(ctx context.Context, uuid, lastMsgId string, party bool) error {
+	return store.chat.setPlayerLastChatMessage(ctx, uuid, lastMsgId, party)
 }
 
-func deleteOldChatMessages() error {
-	_, err := db.Exec("DELETE FROM chatMessages WHERE timestamp < DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY)")
+func getChatMessageHistory(ctx context.Context, uuid string, globalMsgLimit, partyMsgLimit int, lastMsgId string) (*ChatHistory, error) {
+	partyId, err := getPlayerPartyId(ctx, uuid)
 	if err != nil {
-		return err
+		return &ChatHistory{}, err
 	}
 
-	return nil
+	return store.chat.getChatMessageHistory(ctx, partyId, globalMsgLimit, partyMsgLimit, lastMsgId)
 }
 
-func getGameLocationByName(locationName string) (gameLocation GameLocation, err error) {
-	var mapIdsJson []byte
-	err = db.QueryRow("SELECT id, game, title, mapIds FROM gameLocations WHERE title = ? AND game = ?", locationName, config.gameName).Scan(&gameLocation.Id, &gameLocation.Game, &gameLocation.Name, &mapIdsJson)
+func deleteOldChatMessages() error {
+	return store.chat.deleteOldChatMessages(context.Background())
+}
 
+func getGameLocationByName(ctx context.Context, locationName string) (gameLocation GameLocation, err error) {
+	gameLocation, err = store.locations.getGameLocation(ctx, locationName)
 	if err != nil && err != sql.ErrNoRows {
 		return
 	}
@@ -600,14 +773,14 @@ func getGameLocationByName(locationName string) (gameLocation GameLocation, err
 
 	var matchingEventLocation *EventLocationData
 
-	for _, eventLocation := range gameEventLocations[config.gameName] {
+	for _, eventLocation := range gameEventLocations[getConfig().gameName] {
 		if eventLocation.Title == locationName {
 			matchingEventLocation = eventLocation
 			break
 		}
 	}
 
-	if config.gameName == "2kki" {
+	if getConfig().gameName == "2kki" {
 		if matchingEventLocation == nil || !matchingEventLocation.syncdb {
 			var eventLocationFromApi *EventLocationData
 			eventLocationFromApi, err = get2kkiEventLocationData(locationName)
@@ -619,7 +792,7 @@ func getGameLocationByName(locationName string) (gameLocation GameLocation, err
 				}
 			} else {
 				if matchingEventLocation == nil {
-					gameEventLocations[config.gameName] = append(gameEventLocations[config.gameName], eventLocationFromApi)
+					gameEventLocations[getConfig().gameName] = append(gameEventLocations[getConfig().gameName], eventLocationFromApi)
 					matchingEventLocation = eventLocationFromApi
 				} else {
 					*matchingEventLocation = *eventLocationFromApi
@@ -628,84 +801,54 @@ func getGameLocationByName(locationName string) (gameLocation GameLocation, err
 		}
 	}
 
-	if matchingEventLocation != nil {
-		mapIdsJson, err = json.Marshal(matchingEventLocation.MapIds)
-		if err != nil {
-			return
+	if matchingEventLocation == nil {
+		if !dbHasData {
+			return gameLocation, sql.ErrNoRows
 		}
+		return gameLocation, nil
+	}
 
-		if !matchingEventLocation.syncdb {
-			if dbHasData {
-				_, err = db.Exec("UPDATE gameLocations SET title = ?, titleJP = ?, depth = ?, minDepth = ?, mapIds = ? WHERE id = ?", matchingEventLocation.Title, matchingEventLocation.TitleJP, matchingEventLocation.Depth, matchingEventLocation.MinDepth, mapIdsJson, gameLocation.Id)
-				if err != nil {
-					return
-				}
-			} else {
-				var res sql.Result
-				var locationId int64
-
-				res, err = db.Exec("INSERT INTO gameLocations (game, title, titleJP, depth, minDepth, mapIds) VALUES (?, ?, ?, ?, ?, ?)", config.gameName, matchingEventLocation.Title, matchingEventLocation.TitleJP, matchingEventLocation.Depth, matchingEventLocation.MinDepth, mapIdsJson)
-				if err != nil {
-					return gameLocation, err
-				}
-
-				locationId, err = res.LastInsertId()
-				if err != nil {
-					return
-				}
+	if !matchingEventLocation.syncdb {
+		if dbHasData {
+			err = store.locations.updateGameLocation(ctx, gameLocation.Id, matchingEventLocation.Title, matchingEventLocation.TitleJP, matchingEventLocation.Depth, matchingEventLocation.MinDepth, matchingEventLocation.MapIds)
+			if err != nil {
+				return
+			}
+		} else {
+			var locationId int
+			locationId, err = store.locations.createGameLocation(ctx, matchingEventLocation.Title, matchingEventLocation.TitleJP, matchingEventLocation.Depth, matchingEventLocation.MinDepth, matchingEventLocation.MapIds)
+			if err != nil {
+				return
+			}
 
-				gameLocation = GameLocation{
-					Id:     int(locationId),
-					Game:   config.gameName,
-					Name:   matchingEventLocation.Title,
-					MapIds: matchingEventLocation.MapIds,
-				}
+			gameLocation = GameLocation{
+				Id:   locationId,
+				Game: getConfig().gameName,
+				Name: matchingEventLocation.Title,
 			}
-			matchingEventLocation.syncdb = true
 		}
-	} // matchingEventLocation != nil
-
-	err = json.Unmarshal([]byte(mapIdsJson), &gameLocation.MapIds)
-	if err != nil {
-		return
+		matchingEventLocation.syncdb = true
 	}
-	return
-}
 
-func writePlayerGameLocation(uuid string, locationName string) error {
-	_, err := db.Exec("INSERT IGNORE INTO playerGameLocations (uuid, locationId, timestamp) (SELECT ?, gl.id, UTC_TIMESTAMP() FROM gameLocations gl WHERE gl.title = ? AND gl.game = ? LIMIT 1)", uuid, locationName, config.gameName)
-	if err != nil {
-		return err
-	}
+	gameLocation.MapIds = slices.Clone(matchingEventLocation.MapIds)
 
-	return nil
+	return gameLocation, nil
 }
 
-func getPlayerGameLocationIds(uuid string, gameId string) (gameLocationIds []int, err error) {
-	var locationIds []int
-
-	results, err := db.Query("SELECT gl.id FROM playerGameLocations pgl JOIN gameLocations gl ON gl.id = pgl.locationId AND gl.game = ? WHERE pgl.uuid = ?", gameId, uuid)
-	if err != nil {
-		return gameLocationIds, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var locationId int
-		err = results.Scan(&locationId)
-		if err != nil {
-			return gameLocationIds, err
-		}
+func writePlayerGameLocation(ctx context.Context, uuid string, locationId int) error {
+	return gameLocationQueue.add(ctx, GameLocationWrite{uuid, locationId})
+}
 
-		locationIds = append(locationIds, locationId)
-	}
+func writePlayerGameLocations(locations []GameLocationWrite) error {
+	return store.locations.writePlayerGameLocations(context.Background(), locations)
+}
 
-	return locationIds, nil
+func getPlayerGameLocationIds(ctx context.Context, uuid string, gameId string) (gameLocationIds []int, err error) {
+	return store.locations.getPlayerGameLocationIds(ctx, uuid, gameId)
 }
 
-func getPlayerGameLocationCompletion(uuid string, gameId string) (gameLocationCompletion int, err error) {
-	err = db.QueryRow("SELECT FLOOR(COUNT(*) / (SELECT COUNT(*) FROM gameLocations WHERE game = ? AND secret = 0) * 100) FROM playerGameLocations pgl JOIN gameLocations gl ON gl.id = pgl.locationId WHERE gl.game = ? and gl.secret = 0 AND pgl.uuid = ?", gameId, gameId, uuid).Scan(&gameLocationCompletion)
+func getPlayerGameLocationCompletion(ctx context.Context, uuid string, gameId string) (gameLocationCompletion int, err error) {
+	gameLocationCompletion, err = store.locations.getPlayerGameLocationCompletion(ctx, uuid, gameId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, nil
@@ -713,72 +856,19 @@ func getPlayerGameLocationCompletion(uuid string, gameId string) (gameLocationCo
 		return gameLocationCompletion, err
 	}
 
-	return gameLocationCompletion, nil
-}
-
-func getPlayerMissingGameLocationNames(uuid string, locationNames []string) ([]string, error) {
-	var missingGameLocationNames []string
-
-	if len(locationNames) == 0 {
-		return missingGameLocationNames, nil
-	}
-
-	var queryArgs []any
-	queryArgs = append(queryArgs, config.gameName)
-
-	for _, locationName := range locationNames {
-		queryArgs = append(queryArgs, locationName)
-	}
-
-	queryArgs = append(queryArgs, uuid)
-
-	results, err := db.Query("SELECT gl.title FROM gameLocations gl WHERE gl.game = ? AND gl.title IN (?"+strings.Repeat(", ?", len(locationNames)-1)+") AND NOT EXISTS (SELECT * FROM playerGameLocations pgl WHERE pgl.uuid = ? AND pgl.locationId = gl.id)", queryArgs...)
-	if err != nil {
-		return missingGameLocationNames, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var locationName string
-		err = results.Scan(&locationName)
-		if err != nil {
-			return missingGameLocationNames, err
-		}
-
-		missingGameLocationNames = append(missingGameLocationNames, locationName)
-	}
-
-	return missingGameLocationNames, nil
-}
-
-func getPlayerAllMissingGameLocationNames(uuid string) ([]string, error) {
-	var missingGameLocationNames []string
-
-	results, err := db.Query("SELECT gl.title FROM gameLocations gl WHERE gl.game = ? AND gl.secret = 0 AND NOT EXISTS (SELECT * FROM playerGameLocations pgl WHERE pgl.uuid = ? AND pgl.locationId = gl.id)", config.gameName, uuid)
-	if err != nil {
-		return missingGameLocationNames, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var locationName string
-		err = results.Scan(&locationName)
-		if err != nil {
-			return missingGameLocationNames, err
-		}
+	return gameLocationCompletion, nil
+}
 
-		missingGameLocationNames = append(missingGameLocationNames, locationName)
-	}
+func getPlayerMissingGameLocationNames(ctx context.Context, uuid string, locationNames []string) ([]string, error) {
+	return store.locations.getPlayerMissingGameLocationNames(ctx, uuid, locationNames)
+}
 
-	return missingGameLocationNames, nil
+func getPlayerAllMissingGameLocationNames(ctx context.Context, uuid string) ([]string, error) {
+	return store.locations.getPlayerAllMissingGameLocationNames(ctx, uuid)
 }
 
 func setCurrentEventPeriodId() error {
-	var periodId int
-
-	err := db.QueryRow("SELECT id FROM eventPeriods WHERE UTC_DATE() >= startDate AND UTC_DATE() < endDate").Scan(&periodId)
+	periodId, err := store.events.getCurrentEventPeriodId(context.Background())
 	if err != nil {
 		currentEventPeriodId = 0
 		if err == sql.ErrNoRows {
@@ -792,8 +882,8 @@ func setCurrentEventPeriodId() error {
 	return nil
 }
 
-func getCurrentEventPeriodData() (eventPeriod EventPeriod, err error) {
-	err = db.QueryRow("SELECT ep.periodOrdinal, ep.endDate, gep.enableVms FROM eventPeriods ep JOIN gameEventPeriods gep ON gep.periodId = ep.id AND gep.game = ? WHERE UTC_DATE() >= ep.startDate AND UTC_DATE() < ep.endDate", config.gameName).Scan(&eventPeriod.PeriodOrdinal, &eventPeriod.EndDate, &eventPeriod.EnableVms)
+func getCurrentEventPeriodData(ctx context.Context) (eventPeriod EventPeriod, err error) {
+	eventPeriod, err = store.events.getCurrentEventPeriodData(ctx)
 	if err != nil {
 		eventPeriod.PeriodOrdinal = -1
 		if err == sql.ErrNoRows {
@@ -806,32 +896,11 @@ func getCurrentEventPeriodData() (eventPeriod EventPeriod, err error) {
 }
 
 func getGameCurrentEventPeriodsData() (gameEventPeriods map[string]*EventPeriod, err error) {
-	gameEventPeriods = make(map[string]*EventPeriod)
-
-	results, err := db.Query("SELECT gep.id, ep.periodOrdinal, ep.endDate, gep.enableVms, gep.game FROM eventPeriods ep JOIN gameEventPeriods gep ON gep.periodId = ep.id WHERE UTC_DATE() >= ep.startDate AND UTC_DATE() < ep.endDate")
-	if err != nil {
-		return gameEventPeriods, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var gameId string
-		var eventPeriod EventPeriod
-
-		err = results.Scan(&eventPeriod.Id, &eventPeriod.PeriodOrdinal, &eventPeriod.EndDate, &eventPeriod.EnableVms, &gameId)
-		if err != nil {
-			return gameEventPeriods, err
-		}
-
-		gameEventPeriods[gameId] = &eventPeriod
-	}
-
-	return gameEventPeriods, nil
+	return store.events.getGameCurrentEventPeriodsData(context.Background())
 }
 
 func setCurrentGameEventPeriodId() error {
-	gamePeriodId, err := getGameEventPeriodIdForGame(config.gameName)
+	gamePeriodId, err := getGameEventPeriodIdForGame(getConfig().gameName)
 	if err != nil {
 		currentGameEventPeriodId = 0
 		if err == sql.ErrNoRows {
@@ -846,30 +915,21 @@ func setCurrentGameEventPeriodId() error {
 }
 
 func getGameEventPeriodIdForGame(game string) (id int, err error) {
-	err = db.QueryRow("SELECT id FROM gameEventPeriods WHERE game = ? AND periodId = ?", game, currentEventPeriodId).Scan(&id)
-	return
+	return store.events.getGameEventPeriodId(context.Background(), game, currentEventPeriodId)
 }
 
 func getRandomGameForEventPool[Event any](pool map[string][]Event, eventPoolMinPopulation int) (gameId string, err error) {
-	results, err := db.Query("SELECT CEIL(AVG(gpc.playerCount)), gpc.game FROM gamePlayerCounts gpc JOIN gameEventPeriods gep ON gep.periodId = ? AND gep.game = gpc.game GROUP BY gpc.game", currentEventPeriodId)
+	periodGameIds, periodPlayerCounts, err := store.events.getGamePlayerCounts(context.Background(), currentEventPeriodId)
 	if err != nil {
 		return "", err
 	}
 
-	defer results.Close()
-
 	var playerCounts []int
 	var gameIds []string
 	var totalPlayerCount int
 
-	for results.Next() {
-		var currentPlayerCount int
-		var currentGameId string
-
-		err = results.Scan(&currentPlayerCount, &currentGameId)
-		if err != nil {
-			return "", err
-		}
+	for i, currentGameId := range periodGameIds {
+		currentPlayerCount := periodPlayerCounts[i]
 
 		// Ignore games with no event locations in the current pool
 		if eventLocations, ok := pool[currentGameId]; currentGameId != "2kki" && (!ok || len(eventLocations) < eventPoolMinPopulation) {
@@ -916,22 +976,22 @@ func getRandomGameForEventPool[Event any](pool map[string][]Event, eventPoolMinP
 	return gameId, nil
 }
 
-func getPlayerEventExpData(playerUuid string) (eventExp EventExp, err error) {
-	totalEventExp, err := getPlayerTotalEventExp(playerUuid)
+func getPlayerEventExpData(ctx context.Context, playerUuid string) (eventExp EventExp, err error) {
+	totalEventExp, err := getPlayerTotalEventExp(ctx, playerUuid)
 	if err != nil {
 		return eventExp, err
 	}
 
 	eventExp.TotalExp = totalEventExp
 
-	periodEventExp, err := getPlayerPeriodEventExp(playerUuid)
+	periodEventExp, err := getPlayerPeriodEventExp(ctx, playerUuid)
 	if err != nil {
 		return eventExp, err
 	}
 
 	eventExp.PeriodExp = periodEventExp
 
-	weekEventExp, err := getPlayerWeekEventExp(playerUuid)
+	weekEventExp, err := getPlayerWeekEventExp(ctx, playerUuid)
 	if err != nil {
 		return eventExp, err
 	}
@@ -941,56 +1001,24 @@ func getPlayerEventExpData(playerUuid string) (eventExp EventExp, err error) {
 	return eventExp, nil
 }
 
-func getPlayerTotalEventExp(playerUuid string) (totalEventExp int, err error) {
-	err = db.QueryRow("SELECT SUM(exp) FROM ((SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventLocations el ON el.id = ec.eventId AND ec.type = 0 JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ec.uuid = ?) UNION ALL (SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventVms ev ON ev.id = ec.eventId AND ec.type = 2 JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ec.uuid = ?)) eventExp", playerUuid, playerUuid).Scan(&totalEventExp)
-	if err != nil {
-		return totalEventExp, err
-	}
-
-	return totalEventExp, nil
+func getPlayerTotalEventExp(ctx context.Context, playerUuid string) (totalEventExp int, err error) {
+	return store.events.getPlayerTotalEventExp(ctx, playerUuid)
 }
 
-func getPlayerPeriodEventExp(playerUuid string) (periodEventExp int, err error) {
-	err = db.QueryRow("SELECT SUM(exp) FROM ((SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventLocations el ON el.id = ec.eventId AND ec.type = 0 JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ep.id = ? AND ec.uuid = ?) UNION ALL (SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventVms ev ON ev.id = ec.eventId AND ec.type = 2 JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ep.id = ? AND ec.uuid = ?)) eventExp", currentEventPeriodId, playerUuid, currentEventPeriodId, playerUuid).Scan(&periodEventExp)
-	if err != nil {
-		return periodEventExp, err
-	}
-
-	return periodEventExp, nil
+func getPlayerPeriodEventExp(ctx context.Context, playerUuid string) (periodEventExp int, err error) {
+	return store.events.getPlayerPeriodEventExp(ctx, playerUuid, currentEventPeriodId)
 }
 
-func getPlayerWeekEventExp(playerUuid string) (weekEventExp int, err error) {
-	weekdayIndex := int(time.Now().UTC().Weekday())
-
-	err = db.QueryRow("SELECT SUM(exp) FROM ((SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventLocations el ON el.id = ec.eventId AND ec.type = 0 JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ep.id = ? AND ec.uuid = ? AND DATE_SUB(UTC_DATE(), INTERVAL ? DAY) <= el.startDate AND DATE_ADD(UTC_DATE(), INTERVAL ? DAY) >= el.endDate) UNION ALL (SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventVms ev ON ev.id = ec.eventId AND ec.type = 2 JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ep.id = ? AND ec.uuid = ? AND DATE_SUB(UTC_DATE(), INTERVAL ? DAY) <= ev.startDate AND DATE_ADD(UTC_DATE(), INTERVAL ? DAY) >= ev.endDate)) eventExp", currentEventPeriodId, playerUuid, weekdayIndex, 7-weekdayIndex, currentEventPeriodId, playerUuid, weekdayIndex, 7-weekdayIndex).Scan(&weekEventExp)
-	if err != nil {
-		return weekEventExp, err
-	}
-
-	return weekEventExp, nil
+func getPlayerWeekEventExp(ctx context.Context, playerUuid string) (weekEventExp int, err error) {
+	return store.events.getPlayerWeekEventExp(ctx, playerUuid, currentEventPeriodId)
 }
 
-func getPlayerEventLocationCount(playerUuid string) (eventLocationCount int, err error) {
-	err = db.QueryRow("SELECT COUNT(eventId) FROM eventCompletions WHERE uuid = ? AND type < 2", playerUuid).Scan(&eventLocationCount)
-	if err != nil {
-		return eventLocationCount, err
-	}
-
-	return eventLocationCount, nil
+func getPlayerEventLocationCount(ctx context.Context, playerUuid string) (eventLocationCount int, err error) {
+	return store.events.getPlayerEventLocationCount(ctx, playerUuid)
 }
 
-func getPlayerEventLocationCompletion(playerUuid string) (eventLocationCompletion int, err error) {
-	// err = db.QueryRow("SELECT FLOOR(valueFloat * 100) FROM rankingEntries WHERE uuid = ? AND categoryId = 'eventLocationCompletion' AND subCategoryId = 'all'", playerUuid).Scan(&eventLocationCompletion)
-	err = db.QueryRow(`
-	SELECT COUNT(locationId)
-	FROM (
-		SELECT DISTINCT(COALESCE(el.locationId, pel.locationId)) AS locationId
-		FROM eventCompletions ec
-		JOIN accounts a ON a.uuid = ec.uuid
-		LEFT JOIN eventLocations el ON el.id = ec.eventId AND ec.type = 0
-		LEFT JOIN playerEventLocations pel ON pel.id = ec.eventId AND ec.type = 1
-		LEFT JOIN ( SELECT gl.id, gl.secret FROM gameLocations gl ) gl ON COALESCE(el.locationId, pel.locationId) = gl.id
-		WHERE gl.secret = 0 AND ec.uuid = ?) ael`, playerUuid).Scan(&eventLocationCompletion)
+func getPlayerEventLocationCompletion(ctx context.Context, playerUuid string) (eventLocationCompletion int, err error) {
+	eventLocationCompletion, err = store.events.getPlayerEventLocationCompletion(ctx, playerUuid)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, nil
@@ -1001,57 +1029,8 @@ func getPlayerEventLocationCompletion(playerUuid string) (eventLocationCompletio
 	return eventLocationCompletion, nil
 }
 
-func getLocationName(locationId int) (locationName string, err error) {
-	err = db.QueryRow("SELECT l.title FROM gameLocations l WHERE l.id = ?", locationId).Scan(&locationName)
-	if err != nil {
-		return "", err
-	}
-
-	return locationName, nil
-}
-
-func getOrWriteLocationIdForEventLocation(gameId string, gameEventPeriodId int, title string, titleJP string, depth int, minDepth int, mapIds []string) (locationId int, err error) {
-	mapIdsJson, err := json.Marshal(mapIds)
-	if err != nil {
-		return locationId, err
-	}
-
-	_, err = db.Exec("INSERT INTO gameLocations (game, title, titleJP, depth, minDepth, mapIds) VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE titleJP = ?, depth = ?, minDepth = ?, mapIds = ?", gameId, title, titleJP, depth, minDepth, mapIdsJson, titleJP, depth, minDepth, mapIdsJson)
-	if err != nil {
-		return locationId, err
-	}
-
-	db.QueryRow("SELECT l.id FROM gameLocations l JOIN gameEventPeriods gep ON gep.game = l.game WHERE gep.id = ? AND l.game = ? AND l.title = ?", gameEventPeriodId, gameId, title).Scan(&locationId)
-
-	return locationId, nil
-}
-
-func getOrWriteLocationIdForPlayerEventLocation(gameId string, gameEventPeriodId int, playerUuid string, title string, titleJP string, depth int, minDepth int, mapIds []string) (locationId int, err error) {
-	var playerEventLocationQueueLength int
-	db.QueryRow("SELECT COUNT(*) FROM playerEventLocationQueue WHERE game = ? AND date = UTC_DATE()", gameId).Scan(&playerEventLocationQueueLength)
-
-	if playerEventLocationQueueLength > 0 {
-		var currentPlayerEventLocationQueueLength int
-		db.QueryRow("SELECT COUNT(*) FROM eventCompletions ec JOIN playerEventLocations pel ON pel.id = ec.eventId AND ec.type = 1 WHERE pel.gamePeriodId = ? AND pel.startDate = UTC_DATE() AND pel.uuid = ?", gameEventPeriodId, playerUuid).Scan(&currentPlayerEventLocationQueueLength)
-
-		if currentPlayerEventLocationQueueLength < playerEventLocationQueueLength {
-			db.QueryRow("SELECT locationId FROM playerEventLocationQueue WHERE game = ? AND date = UTC_DATE() AND queueIndex = ?", gameId, currentPlayerEventLocationQueueLength+1).Scan(&locationId)
-
-			return locationId, nil
-		}
-	}
-
-	locationId, err = getOrWriteLocationIdForEventLocation(gameId, gameEventPeriodId, title, titleJP, depth, minDepth, mapIds)
-	if err != nil {
-		return locationId, err
-	}
-
-	_, err = db.Exec("INSERT INTO playerEventLocationQueue (game, date, queueIndex, locationId) VALUES (?, UTC_DATE(), ?, ?)", gameId, playerEventLocationQueueLength+1, locationId)
-	if err != nil {
-		return locationId, err
-	}
-
-	return locationId, nil
+func getLocationName(ctx context.Context, locationId int) (locationName string, err error) {
+	return store.events.getLocationName(ctx, locationId)
 }
 
 func writeEventLocationData(gameId string, gameEventPeriodId int, eventType int, title string, titleJP string, depth int, minDepth int, exp int, mapIds []string) error {
@@ -1075,128 +1054,65 @@ func writeEventLocationData(gameId string, gameEventPeriodId int, eventType int,
 
 	days -= offsetDays
 
-	locationId, err := getOrWriteLocationIdForEventLocation(gameId, gameEventPeriodId, title, titleJP, depth, minDepth, mapIds)
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec("INSERT INTO eventLocations (locationId, gamePeriodId, type, exp, startDate, endDate) VALUES (?, ?, ?, ?, DATE_SUB(UTC_DATE(), INTERVAL ? DAY), DATE_ADD(UTC_DATE(), INTERVAL ? DAY))", locationId, gameEventPeriodId, eventType, exp, offsetDays, days)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return store.events.writeEventLocation(context.Background(), gameId, gameEventPeriodId, eventType, title, titleJP, depth, minDepth, exp, mapIds, offsetDays, days)
 }
 
 func writePlayerEventLocationData(gameId string, gameEventPeriodId int, playerUuid string, title string, titleJP string, depth int, minDepth int, mapIds []string) error {
-	locationId, err := getOrWriteLocationIdForPlayerEventLocation(gameId, gameEventPeriodId, playerUuid, title, titleJP, depth, minDepth, mapIds)
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec("INSERT INTO playerEventLocations (locationId, gamePeriodId, uuid, startDate, endDate) SELECT ?, ?, ?, UTC_DATE(), DATE_ADD(UTC_DATE(), INTERVAL 1 DAY) WHERE NOT EXISTS(SELECT * FROM playerEventLocations pel LEFT JOIN eventCompletions ec ON ec.eventId = pel.id AND ec.type = 1 AND ec.uuid = pel.uuid WHERE pel.uuid = ? AND pel.gamePeriodId = ? AND ec.uuid IS NULL AND UTC_DATE() >= pel.startDate AND UTC_DATE() < pel.endDate)", locationId, gameEventPeriodId, playerUuid, playerUuid, gameEventPeriodId)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return store.events.writePlayerEventLocation(context.Background(), gameId, gameEventPeriodId, playerUuid, title, titleJP, depth, minDepth, mapIds)
 }
 
-func getCurrentPlayerEventLocationsData(playerUuid string) (eventLocations []*EventLocation, err error) {
-	results, err := db.Query("SELECT el.id, el.type, gep.game, l.id, l.title, l.titleJP, l.depth, l.minDepth, el.exp, el.endDate, CASE WHEN ec.uuid IS NOT NULL THEN 1 ELSE 0 END FROM eventLocations el JOIN gameLocations l ON l.id = el.locationId JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId LEFT JOIN eventCompletions ec ON ec.eventId = el.id AND ec.type = 0 AND ec.uuid = ? WHERE gep.periodId = ? AND UTC_DATE() >= el.startDate AND UTC_DATE() < el.endDate ORDER BY 2, 1", playerUuid, currentEventPeriodId)
+func getCurrentPlayerEventLocationsData(ctx context.Context, playerUuid string) (eventLocations []*EventLocation, err error) {
+	eventLocations, err = store.events.getCurrentEventLocations(ctx, playerUuid, currentEventPeriodId)
 	if err != nil {
 		return eventLocations, err
 	}
 
-	defer results.Close()
-
-	for results.Next() {
-		var eventLocation EventLocation
-
-		var completeBin int
-
-		err := results.Scan(&eventLocation.Id, &eventLocation.Type, &eventLocation.Game, &eventLocation.LocationId, &eventLocation.Title, &eventLocation.TitleJP, &eventLocation.Depth, &eventLocation.MinDepth, &eventLocation.Exp, &eventLocation.EndDate, &completeBin)
-		if err != nil {
-			return eventLocations, err
-		}
-
+	for _, eventLocation := range eventLocations {
 		if eventLocation.MinDepth == eventLocation.Depth {
 			eventLocation.MinDepth = 0
 		}
-
-		if completeBin == 1 {
-			eventLocation.Complete = true
-		}
-
-		eventLocations = append(eventLocations, &eventLocation)
 	}
 
-	results, err = db.Query("SELECT pel.id, gep.game, pl.id, pl.title, pl.titleJP, pl.depth, pl.minDepth, pel.endDate FROM playerEventLocations pel JOIN gameLocations pl ON pl.id = pel.locationId JOIN gameEventPeriods gep ON gep.id = pel.gamePeriodId LEFT JOIN eventCompletions ec ON ec.eventId = pel.id AND ec.type = 1 AND ec.uuid = pel.uuid WHERE pel.uuid = ? AND gep.periodId = ? AND gep.game = ? AND ec.uuid IS NULL AND UTC_DATE() >= pel.startDate AND UTC_DATE() < pel.endDate ORDER BY 1", playerUuid, currentEventPeriodId, config.gameName)
+	playerEventLocations, err := store.events.getCurrentPlayerEventLocations(ctx, playerUuid, currentEventPeriodId)
 	if err != nil {
 		return eventLocations, err
 	}
 
-	defer results.Close()
-
-	for results.Next() {
-		var eventLocation EventLocation
-
-		err := results.Scan(&eventLocation.Id, &eventLocation.Game, &eventLocation.LocationId, &eventLocation.Title, &eventLocation.TitleJP, &eventLocation.Depth, &eventLocation.MinDepth, &eventLocation.EndDate)
-		if err != nil {
-			return eventLocations, err
-		}
-
+	for _, eventLocation := range playerEventLocations {
 		eventLocation.Type = -1
 
 		if eventLocation.MinDepth == eventLocation.Depth {
 			eventLocation.MinDepth = 0
 		}
 
-		eventLocations = append(eventLocations, &eventLocation)
+		eventLocations = append(eventLocations, eventLocation)
 	}
 
 	return eventLocations, nil
 }
 
-func tryCompleteEventLocation(playerUuid string, location string) (exp int, err error) {
+func tryCompleteEventLocation(ctx context.Context, playerUuid string, location string) (exp int, err error) {
 	if client, ok := clients.Load(playerUuid); ok {
 		if client.roomC == nil {
 			return -1, err
 		}
 
-		// prevent race condition
-		clientMapId := client.roomC.mapId
+		clientMapId := client.getRoomState().mapId
 
-		results, err := db.Query("SELECT el.id, el.type, el.exp, l.mapIds FROM eventLocations el JOIN gameLocations l ON l.id = el.locationId WHERE el.gamePeriodId = ? AND l.title = ? AND l.game = ? AND UTC_DATE() >= el.startDate AND UTC_DATE() < el.endDate ORDER BY 2", currentGameEventPeriodId, location, config.gameName)
+		candidates, err := store.events.getEventLocationCandidates(ctx, currentGameEventPeriodId, location)
 		if err != nil {
 			return -1, err
 		}
 
-		defer results.Close()
-
-		weekEventExp, err := getPlayerWeekEventExp(playerUuid)
+		weekEventExp, err := getPlayerWeekEventExp(ctx, playerUuid)
 		if err != nil {
 			return -1, err
 		}
 
-		for results.Next() {
-			var eventId string
-			var eventType int
-			var eventExp int
-			var mapIdsJson string
-
-			err := results.Scan(&eventId, &eventType, &eventExp, &mapIdsJson)
-			if err != nil {
-				return exp, err
-			}
-
-			var mapIds []string
-			err = json.Unmarshal([]byte(mapIdsJson), &mapIds)
-			if err != nil {
-				return exp, err
-			}
+		for _, candidate := range candidates {
+			eventExp := candidate.Exp
 
-			for _, mapId := range mapIds {
+			for _, mapId := range candidate.MapIds {
 				if clientMapId != mapId {
 					continue
 				}
@@ -1206,7 +1122,7 @@ func tryCompleteEventLocation(playerUuid string, location string) (exp int, err
 					eventExp = weeklyExpCap - weekEventExp
 				}
 
-				_, err = db.Exec("INSERT INTO eventCompletions (eventId, uuid, type, timestampCompleted, exp) VALUES (?, ?, 0, ?, ?)", eventId, playerUuid, time.Now(), eventExp)
+				err = store.events.writeEventCompletion(ctx, candidate.Id, playerUuid, 0, eventExp)
 				if err != nil {
 					break
 				}
@@ -1223,43 +1139,26 @@ func tryCompleteEventLocation(playerUuid string, location string) (exp int, err
 	return -1, err
 }
 
-func tryCompletePlayerEventLocation(playerUuid string, location string) (success bool, err error) {
+func tryCompletePlayerEventLocation(ctx context.Context, playerUuid string, location string) (success bool, err error) {
 	if client, ok := clients.Load(playerUuid); ok {
 		if client.roomC == nil {
 			return false, err
 		}
 
-		// prevent race condition
-		clientMapId := client.roomC.mapId
+		clientMapId := client.getRoomState().mapId
 
-		results, err := db.Query("SELECT pel.id, pl.mapIds FROM playerEventLocations pel JOIN gameLocations pl ON pl.id = pel.locationId WHERE pel.gamePeriodId = ? AND pl.title = ? AND pl.game = ? AND pel.uuid = ? AND UTC_DATE() >= pel.startDate AND UTC_DATE() < pel.endDate ORDER BY 2", currentGameEventPeriodId, location, config.gameName, playerUuid)
+		candidates, err := store.events.getPlayerEventLocationCandidates(ctx, currentGameEventPeriodId, location, playerUuid)
 		if err != nil {
 			return false, err
 		}
 
-		defer results.Close()
-
-		for results.Next() {
-			var eventId string
-			var mapIdsJson string
-
-			err := results.Scan(&eventId, &mapIdsJson)
-			if err != nil {
-				return false, err
-			}
-
-			var mapIds []string
-			err = json.Unmarshal([]byte(mapIdsJson), &mapIds)
-			if err != nil {
-				return false, err
-			}
-
-			for _, mapId := range mapIds {
+		for _, candidate := range candidates {
+			for _, mapId := range candidate.MapIds {
 				if clientMapId != mapId {
 					continue
 				}
 
-				_, err = db.Exec("INSERT INTO eventCompletions (eventId, uuid, type, timestampCompleted, exp) VALUES (?, ?, 1, ?, 0)", eventId, playerUuid, time.Now())
+				err = store.events.writeEventCompletion(ctx, candidate.Id, playerUuid, 1, 0)
 				if err != nil {
 					break
 				}
@@ -1275,47 +1174,16 @@ func tryCompletePlayerEventLocation(playerUuid string, location string) (success
 	return false, err
 }
 
-func getPlayerEventVmCount(playerUuid string) (eventVmCount int, err error) {
-	err = db.QueryRow("SELECT COUNT(eventId) FROM eventCompletions WHERE uuid = ? AND type = 2", playerUuid).Scan(&eventVmCount)
-	if err != nil {
-		return eventVmCount, err
-	}
-
-	return eventVmCount, nil
+func getPlayerEventVmCount(ctx context.Context, playerUuid string) (eventVmCount int, err error) {
+	return store.events.getPlayerEventVmCount(ctx, playerUuid)
 }
 
-func getCurrentPlayerEventVmsData(playerUuid string) (eventVms []*EventVm, err error) {
-	results, err := db.Query("SELECT ev.id, gep.game, ev.exp, ev.endDate, CASE WHEN ec.uuid IS NOT NULL THEN 1 ELSE 0 END FROM eventVms ev JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId LEFT JOIN eventCompletions ec ON ec.eventId = ev.id AND ec.type = 2 AND ec.uuid = ? WHERE gep.periodId = ? AND UTC_DATE() >= ev.startDate AND UTC_DATE() < ev.endDate ORDER BY 2, 1", playerUuid, currentEventPeriodId)
-	if err != nil {
-		return eventVms, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var eventVm EventVm
-
-		var completeBin int
-
-		err := results.Scan(&eventVm.Id, &eventVm.Game, &eventVm.Exp, &eventVm.EndDate, &completeBin)
-		if err != nil {
-			return eventVms, err
-		}
-
-		if completeBin == 1 {
-			eventVm.Complete = true
-		}
-
-		eventVms = append(eventVms, &eventVm)
-	}
-
-	return eventVms, nil
+func getCurrentPlayerEventVmsData(ctx context.Context, playerUuid string) (eventVms []*EventVm, err error) {
+	return store.events.getCurrentEventVms(ctx, playerUuid, currentEventPeriodId)
 }
 
-func getEventVmInfo(id int) (gameId string, mapId int, vmGroup []int, err error) {
-	var vmGroupJson []byte
-	err = db.QueryRow("SELECT gep.game, ev.mapId, ev.eventIds FROM eventVms ev JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId WHERE ev.id = ?", id).Scan(&gameId, &mapId, &vmGroupJson)
-	err = errors.Join(err, json.Unmarshal(vmGroupJson, &vmGroup))
+func getEventVmInfo(ctx context.Context, id int) (gameId string, mapId int, vmGroup []int, err error) {
+	gameId, mapId, vmGroup, err = store.events.getEventVmInfo(ctx, id)
 	if err != nil {
 		return "", 0, nil, err
 	}
@@ -1323,14 +1191,9 @@ func getEventVmInfo(id int) (gameId string, mapId int, vmGroup []int, err error)
 	return
 }
 
-func writeEventVmData(gameId string, mapId int, vmGroup EventIds, exp int) error {
-	vmGroupJson, err := json.Marshal(vmGroup)
-	if err != nil {
-		return err
-	}
-
+func writeEventVmData(gameId string, mapId int, vmGroup EventIds, exp int) (err error) {
 	gameEventPeriod := currentGameEventPeriodId
-	if gameId != config.gameName {
+	if gameId != getConfig().gameName {
 		gameEventPeriod, err = getGameEventPeriodIdForGame(gameId)
 		if err != nil {
 			return err
@@ -1355,170 +1218,73 @@ func writeEventVmData(gameId string, mapId int, vmGroup EventIds, exp int) error
 
 	days -= offsetDays
 
-	_, err = db.Exec("INSERT INTO eventVms (gamePeriodId, mapId, eventIds, exp, startDate, endDate) VALUES (?, ?, ?, ?, DATE_SUB(UTC_DATE(), INTERVAL ? DAY), DATE_ADD(UTC_DATE(), INTERVAL ? DAY))", gameEventPeriod, mapId, vmGroupJson, exp, offsetDays, days)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return store.events.writeEventVm(context.Background(), gameEventPeriod, mapId, vmGroup, exp, offsetDays, days)
 }
 
-func tryCompleteEventVm(playerUuid string, mapId int, eventId int) (exp int, err error) {
-	if client, ok := clients.Load(playerUuid); ok {
-		if client.roomC == nil {
-			return -1, err
-		}
-
-		// prevent race condition
-		clientMapId := client.roomC.mapId
-
-		results, err := db.Query("SELECT ev.id, ev.mapId, ev.exp FROM eventVms ev JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId WHERE gep.periodId = ? AND ev.mapId = ? AND JSON_CONTAINS(ev.eventIds, ?) AND UTC_DATE() >= ev.startDate AND UTC_DATE() < ev.endDate ORDER BY 2", currentEventPeriodId, mapId, eventId)
-		if err != nil {
-			return -1, err
-		}
-
-		defer results.Close()
-
-		currentEventVmsData, err := getCurrentPlayerEventVmsData(playerUuid)
-		if err != nil {
-			return -1, err
-		}
+// tryCompleteEventVm completes the vending machine expedition for eventId on mapId
+// for the player, who was on clientMapId when they triggered it. It counts even
+// if they have left since.
+func tryCompleteEventVm(ctx context.Context, playerUuid string, clientMapId string, mapId int, eventId int) (exp int, err error) {
+	candidates, err := store.events.getEventVmCandidates(ctx, currentEventPeriodId, mapId, eventId)
+	if err != nil {
+		return -1, err
+	}
 
-		weekEventExp, err := getPlayerWeekEventExp(playerUuid)
-		if err != nil {
-			return -1, err
-		}
+	currentEventVmsData, err := getCurrentPlayerEventVmsData(ctx, playerUuid)
+	if err != nil {
+		return -1, err
+	}
 
-		for results.Next() {
-			var eventVmId int
-			var eventMapId int
-			var eventExp int
+	weekEventExp, err := getPlayerWeekEventExp(ctx, playerUuid)
+	if err != nil {
+		return -1, err
+	}
 
-			err := results.Scan(&eventVmId, &eventMapId, &eventExp)
-			if err != nil {
-				return exp, err
-			}
+	for _, candidate := range candidates {
+		eventExp := candidate.Exp
 
-			for _, eventVm := range currentEventVmsData {
-				if eventVm.Id == eventVmId {
-					if eventVm.Complete {
-						return -1, nil
-					}
-					break
+		for _, eventVm := range currentEventVmsData {
+			if eventVm.Id == candidate.Id {
+				if eventVm.Complete {
+					return -1, nil
 				}
-			}
-
-			if clientMapId != fmt.Sprintf("%04d", eventMapId) {
-				continue
-			}
-			if weekEventExp >= weeklyExpCap {
-				eventExp = 0
-			} else if weekEventExp+eventExp > weeklyExpCap {
-				eventExp = weeklyExpCap - weekEventExp
-			}
-
-			_, err = db.Exec("INSERT INTO eventCompletions (eventId, uuid, type, timestampCompleted, exp) VALUES (?, ?, 2, ?, ?)", eventVmId, playerUuid, time.Now(), eventExp)
-			if err != nil {
 				break
 			}
-
-			exp += eventExp
-			weekEventExp += eventExp
 		}
 
-		return exp, nil
-	}
-
-	return -1, err
-}
-
-func getPlayerTags(playerUuid string) (tags []string, lastUnlocked time.Time, err error) {
-	results, err := db.Query("SELECT name, timestampUnlocked FROM playerTags WHERE uuid = ?", playerUuid)
-	if err != nil {
-		return tags, lastUnlocked, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var tagName string
-		var timestamp time.Time
-		err := results.Scan(&tagName, &timestamp)
-		if err != nil {
-			return tags, lastUnlocked, err
+		if clientMapId != fmt.Sprintf("%04d", candidate.MapId) {
+			continue
 		}
-		tags = append(tags, tagName)
-		if timestamp.After(lastUnlocked) {
-			lastUnlocked = timestamp
+		if weekEventExp >= weeklyExpCap {
+			eventExp = 0
+		} else if weekEventExp+eventExp > weeklyExpCap {
+			eventExp = weeklyExpCap - weekEventExp
 		}
-	}
 
-	return tags, lastUnlocked, nil
-}
-
-func tryWritePlayerTag(playerUuid string, name string) (success bool, err error) {
-	if client, ok := clients.Load(playerUuid); ok { // Player must be online to add a tag
-		if client.roomC == nil {
-			return false, nil
+		err = store.events.writeEventCompletion(ctx, candidate.Id, playerUuid, 2, eventExp)
+		if err != nil {
+			break
 		}
 
-		// prevent race condition
-		tags := client.roomC.tags
-
-		// Spare SQL having to deal with a duplicate record by checking player tags beforehand
-		tagExists := slices.Contains(tags, name)
-		if !tagExists {
-			_, err = db.Exec("INSERT INTO playerTags (uuid, name, timestampUnlocked) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE name = name", playerUuid, name, time.Now())
-			if err != nil {
-				return false, err
-			}
-			return true, nil
-		}
+		exp += eventExp
+		weekEventExp += eventExp
 	}
 
-	return false, nil
+	return exp, nil
 }
 
-func getPlayerTimeTrialRecords(playerUuid string) (timeTrialRecords []*TimeTrialRecord, err error) {
-	results, err := db.Query("SELECT mapId, MIN(seconds) FROM playerTimeTrials WHERE uuid = ? GROUP BY mapId", playerUuid)
-	if err != nil {
-		return timeTrialRecords, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var timeTrialRecord TimeTrialRecord
-
-		err := results.Scan(&timeTrialRecord.MapId, &timeTrialRecord.Seconds)
-		if err != nil {
-			return timeTrialRecords, err
-		}
-
-		timeTrialRecords = append(timeTrialRecords, &timeTrialRecord)
-	}
-
-	return timeTrialRecords, nil
+func getPlayerTags(ctx context.Context, playerUuid string) (tags []string, lastUnlocked time.Time, err error) {
+	return store.records.getPlayerTags(ctx, playerUuid)
 }
 
-func tryWritePlayerTimeTrial(playerUuid string, mapId int, seconds int) (success bool, err error) {
-	var prevSeconds int
-	err = db.QueryRow("SELECT seconds FROM playerTimeTrials WHERE uuid = ? AND mapId = ?", playerUuid, mapId).Scan(&prevSeconds)
-	if err != nil {
-		if err != sql.ErrNoRows {
-			return false, err
-		}
-	} else if seconds >= prevSeconds {
+// tryWritePlayerTag unlocks the tag unless it is in tags, the ones the player had when they joined
+func tryWritePlayerTag(ctx context.Context, playerUuid string, name string, tags []string) (success bool, err error) {
+	// Spare SQL having to deal with a duplicate record by checking player tags beforehand
+	if slices.Contains(tags, name) {
 		return false, nil
-	} else {
-		_, err = db.Exec("UPDATE playerTimeTrials SET seconds = ?, timestampCompleted = ? WHERE uuid = ? AND mapId = ?", seconds, time.Now(), playerUuid, mapId)
-		if err != nil {
-			return false, err
-		}
-		return true, nil
 	}
 
-	_, err = db.Exec("INSERT INTO playerTimeTrials (uuid, mapId, seconds, timestampCompleted) VALUES (?, ?, ?, ?)", playerUuid, mapId, seconds, time.Now())
+	err = store.records.writePlayerTag(ctx, playerUuid, name)
 	if err != nil {
 		return false, err
 	}
@@ -1526,43 +1292,29 @@ func tryWritePlayerTimeTrial(playerUuid string, mapId int, seconds int) (success
 	return true, nil
 }
 
-func getBannedMutedPlayers(banned bool) (players []PlayerInfo) {
-	var actionStr string
+func getPlayerTimeTrialRecords(ctx context.Context, playerUuid string) (timeTrialRecords []*TimeTrialRecord, err error) {
+	return store.records.getPlayerTimeTrialRecords(ctx, playerUuid)
+}
 
-	if banned {
-		actionStr = "banned"
-	} else {
-		actionStr = "muted"
-	}
+func tryWritePlayerTimeTrial(ctx context.Context, playerUuid string, mapId int, seconds int) (success bool, err error) {
+	return store.records.writePlayerTimeTrial(ctx, playerUuid, mapId, seconds)
+}
 
-	results, err := db.Query("SELECT uuid, rank FROM players WHERE " + actionStr + " = 1")
+func getBannedMutedPlayers(ctx context.Context, banned bool) (players []PlayerInfo) {
+	players, err := store.players.getBannedMutedPlayers(ctx, banned)
 	if err != nil {
 		return players
 	}
 
-	defer results.Close()
-
-	for results.Next() {
-		var uuid string
-		var rank int
-
-		err := results.Scan(&uuid, &rank)
-		if err != nil {
-			return players
-		}
-
-		players = append(players, PlayerInfo{
-			Uuid: uuid,
-			Name: getNameFromUuid(uuid),
-			Rank: rank,
-		})
+	for i := range players {
+		players[i].Name = getNameFromUuid(ctx, players[i].Uuid)
 	}
 
 	return players
 }
 
-func getUuidFromName(name string) (uuid string, err error) {
-	err = db.QueryRow("SELECT uuid FROM accounts WHERE user = ?", name).Scan(&uuid)
+func getUuidFromName(ctx context.Context, name string) (uuid string, err error) {
+	uuid, err = store.players.getUuidFromName(ctx, name)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return "", nil
@@ -1573,7 +1325,7 @@ func getUuidFromName(name string) (uuid string, err error) {
 	return uuid, nil
 }
 
-func getNameFromUuid(uuid string) (name string) {
+func getNameFromUuid(ctx context.Context, uuid string) (name string) {
 	default_ := fmt.Sprintf("`%s`", uuid)
 
 	// get name from sessionClients if they're connected
@@ -1584,7 +1336,7 @@ func getNameFromUuid(uuid string) (name string) {
 	}
 
 	// otherwise check accounts
-	err := db.QueryRow("SELECT user FROM accounts WHERE uuid = ?", uuid).Scan(&name)
+	name, err := store.players.getAccountName(ctx, uuid)
 	if err != nil {
 		return default_
 	}
@@ -1595,7 +1347,7 @@ func getNameFromUuid(uuid string) (name string) {
 	}
 
 	// otherwise check playergamedata
-	err = db.QueryRow("SELECT name FROM playerGameData WHERE uuid = ?").Scan(&name)
+	name, err = store.players.getPlayerGameName(ctx, uuid)
 	if err != nil {
 		return default_
 	}
@@ -1607,112 +1359,52 @@ func getNameFromUuid(uuid string) (name string) {
 	return default_
 }
 
-func isIpBanned(ip string) bool {
-	var banned int
-
-	// check if account is banned
-	err := db.QueryRow("SELECT banned FROM players JOIN accounts ON players.uuid = accounts.uuid WHERE accounts.ip = ?", ip).Scan(&banned)
-	if err != nil && err != sql.ErrNoRows {
-		return false
-	}
-
-	if banned == 1 {
-		return true
-	}
-
-	// check if guest account is banned
-	err = db.QueryRow("SELECT banned FROM players WHERE ip = ?", ip).Scan(&banned)
+func isIpBanned(ctx context.Context, ip string) bool {
+	banned, err := store.players.isIpBanned(ctx, ip)
 	if err != nil {
 		return false
 	}
 
-	return banned == 1
-}
-
-func getUuidFromToken(token string) (uuid string) {
-	db.QueryRow("SELECT uuid FROM playerSessions WHERE sessionId = ? AND NOW() < expiration", token).Scan(&uuid)
-
-	return uuid
+	return banned
 }
 
-func writeGamePlayerCount(playerCount int) error {
-	_, err := db.Exec("INSERT INTO gamePlayerCounts (game, playerCount) VALUES (?, ?)", config.gameName, playerCount)
-	if err != nil {
-		return err
+func getUuidFromToken(ctx context.Context, token string) (uuid string) {
+	if cached, ok := playerCache.get(playerCacheUuid, token); ok {
+		return cached.(string)
 	}
 
-	var playerCounts int
-	err = db.QueryRow("SELECT COUNT(*) FROM gamePlayerCounts WHERE game = ?", config.gameName).Scan(&playerCounts)
-	if err != nil {
-		return err
+	generation := playerCache.getGeneration()
+	uuid, err := store.players.getUuidFromToken(ctx, token)
+	if err != nil || uuid == "" {
+		return ""
 	}
 
-	if playerCounts > 28 {
-		_, err = db.Exec("DELETE FROM gamePlayerCounts WHERE game = ? ORDER BY id LIMIT ?", config.gameName, playerCounts-28)
-		if err != nil {
-			return err
-		}
-	}
+	playerCache.set(generation, playerCacheUuid, token, uuid, uuid)
 
-	return nil
+	return uuid
 }
 
-func getReportersForPlayer(targetUuid, msgId string) (result map[string]string, err error) {
-	var msgIdLink *string
-	if msgId != "" {
-		msgIdLink = &msgId
-	}
-	rows, err := db.Query(`
-		SELECT pgd.name, pr.reason FROM playerReports pr
-		JOIN playerGameData pgd ON pgd.uuid = pr.uuid
-		WHERE pr.targetUuid = ? AND pr.msgId = ? AND NOT actionTaken`, targetUuid, msgIdLink)
-	if err != nil {
-		return result, err
-	}
-
-	result = make(map[string]string)
-	defer rows.Close()
-	for rows.Next() {
-		var reporter string
-		var reason string
-		err = rows.Scan(&reporter, &reason)
-		if err != nil {
-			return nil, err
-		}
-
-		result[reporter] = reason
-	}
+func writeGamePlayerCount(playerCount int) error {
+	return store.events.writeGamePlayerCount(context.Background(), playerCount)
+}
 
-	return result, nil
+func getReportersForPlayer(ctx context.Context, targetUuid, msgId string) (result map[string]string, err error) {
+	return store.moderation.getReporters(ctx, targetUuid, msgId)
 }
 
 func doCleanupQueries() error {
-	// Remove player sessions that have expired
-	_, err := db.Exec("DELETE FROM playerSessions WHERE expiration < NOW()")
-	if err != nil {
-		return err
-	}
-
-	// Remove player expeditions that were never completed
-	_, err = db.Exec("DELETE pel FROM playerEventLocations pel WHERE UTC_DATE() > pel.endDate AND NOT EXISTS (SELECT ec.eventId FROM eventCompletions ec WHERE ec.eventId = pel.id AND ec.type = 1)")
-	if err != nil {
-		return err
-	}
-
-	// Remove player records with no game activity
-	_, err = db.Exec("DELETE IGNORE FROM players WHERE ip IS NOT NULL")
+	err := store.players.cleanupPlayers(context.Background())
 	if err != nil {
 		return err
 	}
 
-	// Remove player event location queue for past dates
-	_, err = db.Exec("DELETE FROM playerEventLocationQueue WHERE UTC_DATE() > date")
+	err = store.events.cleanupEvents(context.Background())
 	if err != nil {
 		return err
 	}
 
 	// Remove Yume 2kki Explorer API query cache records that have expired
-	_, err = db.Exec("DELETE FROM 2kkiApiQueries WHERE timestampExpired < NOW()")
+	err = store.apiCache.cleanupApiQueries(context.Background())
 	if err != nil {
 		return err
 	}
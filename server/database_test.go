@@ -0,0 +1,99 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	prevConfig := getConfig()
+	defer currentConfig.Store(prevConfig)
+
+	config := *prevConfig
+	config.database.queryTimeout = time.Second
+	config.database.backgroundQueryTimeout = 0
+	currentConfig.Store(&config)
+
+	requestCtx, cancelRequest := context.WithCancel(context.Background())
+	defer cancelRequest()
+
+	ctx, cancel := withQueryTimeout(requestCtx)
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Second {
+		t.Errorf("request query deadline is %v, want within a second", deadline)
+	}
+	cancel()
+
+	ctx, cancel = withQueryTimeout(context.Background())
+	if deadline, ok := ctx.Deadline(); ok {
+		t.Errorf("background query has deadline %v", deadline)
+	}
+	cancel()
+
+	config.database.backgroundQueryTimeout = time.Minute
+	ctx, cancel = withQueryTimeout(context.Background())
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) <= time.Second {
+		t.Errorf("background query deadline is %v, want within a minute", deadline)
+	}
+	cancel()
+}
+
+func TestFailedRowReleasesDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	failure := errors.New("prepare failed")
+	row := newRow(nil, failure, cancel)
+
+	if ctx.Err() == nil {
+		t.Error("deadline of a failed query is held until Scan")
+	}
+	if err := row.Scan(); err != failure {
+		t.Errorf("Scan returned %v, want %v", err, failure)
+	}
+	if err := row.Err(); err != failure {
+		t.Errorf("Err returned %v, want %v", err, failure)
+	}
+}
+
+func TestDroppedRowReleasesDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// a query whose row is never scanned
+	newRow(&sql.Row{}, nil, cancel)
+
+	for range 10 {
+		runtime.GC()
+		if ctx.Err() != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Error("deadline of a dropped row is never released")
+}
+
+func TestBackgroundQueryTimeoutDefault(t *testing.T) {
+	if timeout := getConfig().database.backgroundQueryTimeout; timeout <= 0 {
+		t.Errorf("background queries have no timeout by default (%s)", timeout)
+	}
+}
@@ -18,6 +18,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -29,6 +30,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -141,20 +143,42 @@ var (
 	currentEventVmGroup      EventIds
 	eventsCount              int
 
-	gameCurrentEventPeriods       map[string]*EventPeriod
-	gameDailyEventLocationPools   map[string][]*EventLocationData
-	gameDailyEventLocation2Pools  map[string][]*EventLocationData
-	gameWeeklyEventLocationPools  map[string][]*EventLocationData
-	gameWeekendEventLocationPools map[string][]*EventLocationData
-	freeEventLocationPool         []*EventLocationData
+	gameCurrentEventPeriods map[string]*EventPeriod
 
-	gameEventVms map[string]map[int][]EventIds
+	eventLocationPools atomic.Pointer[EventLocationPools]
+
+	gameEventVms atomic.Pointer[map[string]map[int][]EventIds]
 
 	// in 2kki, only used for cache bookkeeping
 	gameEventLocations map[string][]*EventLocationData = make(map[string][]*EventLocationData)
-	gameLocationColors map[string][]string
 )
 
+// EventLocationPools holds the event locations expeditions are picked from
+// and the location colors. Once published it is never changed, reloads
+// publish a new one instead.
+type EventLocationPools struct {
+	daily, daily2, weekly, weekend map[string][]*EventLocationData
+	free                           []*EventLocationData
+
+	locationColors map[string][]string
+}
+
+// getEventLocationPools returns the current event location pools
+func getEventLocationPools() *EventLocationPools {
+	if pools := eventLocationPools.Load(); pools != nil {
+		return pools
+	}
+	return &EventLocationPools{}
+}
+
+// getEventVms returns the current event VMs by game and map id
+func getEventVms() map[string]map[int][]EventIds {
+	if eventVms := gameEventVms.Load(); eventVms != nil {
+		return *eventVms
+	}
+	return nil
+}
+
 func initEvents() {
 	logInitTask("events")
 
@@ -179,7 +203,9 @@ func initEvents() {
 		}
 	}
 
-	setGameEventLocationPoolsAndLocationColors()
+	for _, err := range setGameEventLocationPoolsAndLocationColors() {
+		eprintf("events", "failed to load event locations: %s", err)
+	}
 
 	// vending machine expedition
 	eventVmId, err := updateEventVmInfo()
@@ -190,7 +216,7 @@ func initEvents() {
 		return
 	}
 
-	db.QueryRow("SELECT COUNT(*) FROM eventLocations el").Scan(&eventsCount)
+	eventsCount, _ = store.events.getEventLocationCount(context.Background(), 0, 0, 0, 0)
 
 	scheduler.Every(1).Day().At("00:00").Do(func() {
 		err := setCurrentEventPeriodId()
@@ -240,24 +266,21 @@ func initEvents() {
 	})
 
 	scheduler.Every(5).Minutes().Do(func() {
-		var newEventLocationsCount int
-		db.QueryRow("SELECT COUNT(*) FROM eventLocations").Scan(&newEventLocationsCount)
+		newEventLocationsCount, _ := store.events.getEventLocationCount(context.Background(), 0, 0, 0, 0)
 		if newEventLocationsCount != eventsCount {
 			eventsCount = newEventLocationsCount
 			sendEventsUpdate()
 		}
 	})
 
-	var count int
-
 	// daily easy expedition
-	db.QueryRow("SELECT COUNT(el.id) FROM eventLocations el JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE el.type = 0 AND ep.id = ? AND el.startDate = UTC_DATE() AND el.exp = 1", currentEventPeriodId).Scan(&count)
+	count, _ := store.events.getEventLocationCount(context.Background(), currentEventPeriodId, 0, 1, 0)
 	if count == 0 {
 		addDailyEventLocation(false)
 	}
 
 	// daily deeper expedition
-	db.QueryRow("SELECT COUNT(el.id) FROM eventLocations el JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE el.type = 0 AND ep.id = ? AND el.startDate = UTC_DATE() AND el.exp = 3", currentEventPeriodId).Scan(&count)
+	count, _ = store.events.getEventLocationCount(context.Background(), currentEventPeriodId, 0, 3, 0)
 	if count == 0 {
 		addDailyEventLocation(true)
 	}
@@ -265,7 +288,7 @@ func initEvents() {
 	weekday := time.Now().UTC().Weekday()
 
 	// weekly expedition
-	db.QueryRow("SELECT COUNT(el.id) FROM eventLocations el JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE el.type = 1 AND ep.id = ? AND el.startDate = DATE_SUB(UTC_DATE(), INTERVAL ? DAY)", currentEventPeriodId, int(weekday)).Scan(&count)
+	count, _ = store.events.getEventLocationCount(context.Background(), currentEventPeriodId, 1, 0, int(weekday))
 	if count == 0 {
 		addWeeklyEventLocation()
 	}
@@ -273,7 +296,7 @@ func initEvents() {
 	switch weekday {
 	case time.Friday, time.Saturday:
 		// weekend expedition
-		db.QueryRow("SELECT COUNT(el.id) FROM eventLocations el JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE el.type = 2 AND ep.id = ? AND el.startDate = DATE_SUB(UTC_DATE(), INTERVAL ? DAY)", currentEventPeriodId, int(weekday-time.Friday)).Scan(&count)
+		count, _ = store.events.getEventLocationCount(context.Background(), currentEventPeriodId, 2, 0, int(weekday-time.Friday))
 		if count == 0 {
 			addWeekendEventLocation()
 		}
@@ -286,9 +309,15 @@ func initEvents() {
 
 func updateEventVmInfo() (eventVmId int, err error) {
 	weekday, lastVmWeekday := getVmWeekdays()
-	var eventIdsJson []byte
-	err = db.QueryRow("SELECT ev.id, gep.game, ev.mapId, ev.eventIds FROM eventVms ev JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ep.id = ? AND ev.startDate = DATE_SUB(UTC_DATE(), INTERVAL ? DAY)", currentEventPeriodId, int(weekday-lastVmWeekday)).Scan(&eventVmId, &currentEventVmGame, &currentEventVmMapId, &eventIdsJson)
-	err = errors.Join(err, json.Unmarshal(eventIdsJson, &currentEventVmGroup))
+	eventVmId, gameId, mapId, vmGroup, err := store.events.getEventVmStartedDaysAgo(context.Background(), currentEventPeriodId, int(weekday-lastVmWeekday))
+	if err != nil {
+		return
+	}
+
+	currentEventVmGame = gameId
+	currentEventVmMapId = mapId
+	currentEventVmGroup = vmGroup
+
 	return
 }
 
@@ -308,19 +337,20 @@ func getVmWeekdays() (time.Weekday, time.Weekday) {
 }
 
 func sendEventsUpdate() {
-	for _, client := range clients.Get() {
+	clients.Range(func(client *SessionClient) bool {
 		if client.account {
 			client.handleE()
 		}
-	}
+		return true
+	})
 }
 
 func addDailyEventLocation(deeper bool) {
 	var pools map[string][]*EventLocationData
 	if !deeper {
-		pools = gameDailyEventLocationPools
+		pools = getEventLocationPools().daily
 	} else {
-		pools = gameDailyEventLocation2Pools
+		pools = getEventLocationPools().daily2
 	}
 
 	gameId, err := getRandomGameForEventPool(pools, eventLocationCountDailyThreshold)
@@ -345,7 +375,9 @@ func addDailyEventLocation(deeper bool) {
 }
 
 func addWeeklyEventLocation() {
-	gameId, err := getRandomGameForEventPool(gameWeeklyEventLocationPools, eventLocationCountWeeklyThreshold)
+	pools := getEventLocationPools().weekly
+
+	gameId, err := getRandomGameForEventPool(pools, eventLocationCountWeeklyThreshold)
 	if err != nil {
 		handleInternalEventError(1, err)
 		return
@@ -354,12 +386,14 @@ func addWeeklyEventLocation() {
 	if gameId == "2kki" {
 		add2kkiEventLocation(1, weekly2kkiEventLocationMinDepth, weekly2kkiEventLocationMaxDepth, weeklyEventLocationExp)
 	} else {
-		addEventLocation(gameId, 1, weeklyEventLocationExp, gameWeeklyEventLocationPools)
+		addEventLocation(gameId, 1, weeklyEventLocationExp, pools)
 	}
 }
 
 func addWeekendEventLocation() {
-	gameId, err := getRandomGameForEventPool(gameWeekendEventLocationPools, eventLocationCountWeekendThreshold)
+	pools := getEventLocationPools().weekend
+
+	gameId, err := getRandomGameForEventPool(pools, eventLocationCountWeekendThreshold)
 	if err != nil {
 		handleInternalEventError(2, err)
 		return
@@ -368,7 +402,7 @@ func addWeekendEventLocation() {
 	if gameId == "2kki" {
 		add2kkiEventLocation(2, weekend2kkiEventLocationMinDepth, weekend2kkiEventLocationMaxDepth, weekendEventLocationExp)
 	} else {
-		addEventLocation(gameId, 2, weekendEventLocationExp, gameWeekendEventLocationPools)
+		addEventLocation(gameId, 2, weekendEventLocationExp, pools)
 	}
 }
 
@@ -381,7 +415,7 @@ func addPlayerEventLocation(gameId string, eventType int, exp int, pool []*Event
 	eventLocation := pool[rand.Intn(len(pool))]
 
 	var gameEventPeriodId int
-	if gameId == config.gameName {
+	if gameId == getConfig().gameName {
 		gameEventPeriodId = currentGameEventPeriodId
 	} else {
 		gameEventPeriodId = gameCurrentEventPeriods[gameId].Id
@@ -400,7 +434,7 @@ func addPlayerEventLocation(gameId string, eventType int, exp int, pool []*Event
 
 func add2kkiEventLocation(eventType int, minDepth int, maxDepth int, exp int) {
 	var gameEventPeriodId int
-	if config.gameName == "2kki" {
+	if getConfig().gameName == "2kki" {
 		gameEventPeriodId = currentGameEventPeriodId
 	} else {
 		gameEventPeriodId = gameCurrentEventPeriods["2kki"].Id
@@ -483,9 +517,11 @@ func get2kkiEventLocationData(locationName string) (*EventLocationData, error) {
 }
 
 func addEventVm() {
+	gameVms := getEventVms()
+
 	vmsPerGame := make(map[string][]int)
 	// count the number of VM groups per game
-	for game, vmMapIds := range gameEventVms {
+	for game, vmMapIds := range gameVms {
 		for _, vmGroups := range vmMapIds {
 			for k := range vmGroups {
 				vmsPerGame[game] = append(vmsPerGame[game], k)
@@ -498,8 +534,8 @@ func addEventVm() {
 		return
 	}
 
-	eventVms, hasEventVms := gameEventVms[gameId]
-	if !hasEventVms || gameEventVms == nil {
+	eventVms, hasEventVms := gameVms[gameId]
+	if !hasEventVms {
 		handleInternalEventError(4, fmt.Errorf("missing VMs for %s", gameId))
 		return
 	}
@@ -536,15 +572,17 @@ func handleEventError(eventType int, payload string) {
 	writeErrLog("SERVER", strconv.Itoa(eventType), payload)
 }
 
-func setEventVms() {
+// setEventVms reads the VMs for every game and returns the files that
+// couldn't be used, the previous VMs are kept if vms/ can't be read
+func setEventVms() (errs []error) {
 	logUpdateTask("event VMs")
 
 	gamesVmDirs, err := os.ReadDir("vms/")
 	if err != nil {
-		return
+		return []error{err}
 	}
 
-	gameEventVms = make(map[string]map[int][]EventIds)
+	eventVms := make(map[string]map[int][]EventIds)
 
 	for _, gameVmDir := range gamesVmDirs {
 		game := gameVmDir.Name()
@@ -555,11 +593,11 @@ func setEventVms() {
 
 		vmDir, err := os.ReadDir("vms/" + game)
 		if err != nil {
-			eprintf("VM", "Could not read VMs for %s: %s", game, err)
-			return
+			errs = append(errs, fmt.Errorf("could not read VMs for %s: %w", game, err))
+			continue
 		}
 
-		gameEventVms[game] = make(map[int][]EventIds)
+		eventVms[game] = make(map[int][]EventIds)
 		for _, vmFile := range vmDir {
 			var (
 				eventIds []int
@@ -569,7 +607,7 @@ func setEventVms() {
 			vmName := vmFile.Name()
 			mapId, vmErr := strconv.Atoi(vmName[3:7])
 			if vmErr != nil {
-				eprintf("VM", "%s does not match `Mapxxxx_EVxxxx.png`", vmName)
+				errs = append(errs, fmt.Errorf("%s does not match `Mapxxxx_EVxxxx.png`", vmName))
 				continue
 			}
 
@@ -577,7 +615,7 @@ func setEventVms() {
 			eventIdCsv := strings.Split(vmBaseName, ",")
 			for _, eventIdRaw := range eventIdCsv {
 				if len(eventIdRaw) != 4 {
-					eprintf("VM", "%s must all have 4-padded events", vmName)
+					errs = append(errs, fmt.Errorf("%s must all have 4-padded events", vmName))
 					eventIds = nil
 					break
 				}
@@ -588,31 +626,40 @@ func setEventVms() {
 				eventIds = append(eventIds, eventId)
 			}
 			if vmErr != nil {
-				return
+				errs = append(errs, fmt.Errorf("%s: %w", vmName, vmErr))
+				continue
 			}
 
 			if eventIds == nil {
-				eprintf("VM", "%s has no events", vmName)
+				errs = append(errs, fmt.Errorf("%s has no events", vmName))
 				continue
 			}
 
-			gameEventVms[game][mapId] = append(gameEventVms[game][mapId], eventIds)
+			eventVms[game][mapId] = append(eventVms[game][mapId], eventIds)
 		}
 	}
+
+	gameEventVms.Store(&eventVms)
+
+	return errs
 }
 
-func setGameEventLocationPoolsAndLocationColors() {
-	if isMainServer {
-		gameDailyEventLocationPools = make(map[string][]*EventLocationData)
-		gameDailyEventLocation2Pools = make(map[string][]*EventLocationData)
-		gameWeeklyEventLocationPools = make(map[string][]*EventLocationData)
-		gameWeekendEventLocationPools = make(map[string][]*EventLocationData)
-	}
+// setGameEventLocationPoolsAndLocationColors reads the event locations for
+// every game and returns the files that failed to parse, whose locations
+// from before are kept
+func setGameEventLocationPoolsAndLocationColors() (errs []error) {
+	dailyPools := make(map[string][]*EventLocationData)
+	daily2Pools := make(map[string][]*EventLocationData)
+	weeklyPools := make(map[string][]*EventLocationData)
+	weekendPools := make(map[string][]*EventLocationData)
+	var freePool []*EventLocationData
 
-	gameLocationColors = make(map[string][]string)
+	locationColors := make(map[string][]string)
 
-	// gameEventLocations = make(map[string][]*EventLocationData)
-	gameMaxDepths := make(map[string]int)
+	eventLocationsByGame := make(map[string][]*EventLocationData)
+	for gameId, eventLocations := range gameEventLocations {
+		eventLocationsByGame[gameId] = eventLocations
+	}
 
 	configPath := "eventlocations/"
 
@@ -622,7 +669,7 @@ func setGameEventLocationPoolsAndLocationColors() {
 			gameIds = append(gameIds, gameId)
 		}
 	} else {
-		gameIds = append(gameIds, config.gameName)
+		gameIds = append(gameIds, getConfig().gameName)
 	}
 
 	for _, gameId := range gameIds {
@@ -630,69 +677,90 @@ func setGameEventLocationPoolsAndLocationColors() {
 
 		data, err := os.ReadFile(configPath + gameId + ".json")
 		if err != nil {
-			gameEventLocations[gameId] = nil
+			eventLocationsByGame[gameId] = nil
 			continue
 		}
 
 		err = json.Unmarshal(data, &eventLocations)
 		if err != nil {
+			errs = append(errs, fmt.Errorf("%s%s.json: %w", configPath, gameId, err))
 			continue
 		}
 
-		if len(eventLocations) > 0 {
-			gameEventLocations[gameId] = eventLocations
-			gameMaxDepths[gameId] = 0
+		if len(eventLocations) == 0 {
+			continue
 		}
 
+		// depths are adjusted in place so only new locations are adjusted,
+		// the ones kept from before already were
+		var gameMaxDepth int
 		for _, eventLocation := range eventLocations {
 			if eventLocation.Ignored {
 				continue
 			}
-			if eventLocation.Depth > gameMaxDepths[gameId] {
-				gameMaxDepths[gameId] = eventLocation.Depth
+			if eventLocation.Depth > gameMaxDepth {
+				gameMaxDepth = eventLocation.Depth
 			}
 		}
-	}
 
-	for gameId, eventLocations := range gameEventLocations {
-		gameMaxDepth := math.Min(float64(gameMaxDepths[gameId]), 15)
+		adjustEventLocationDepths(eventLocations, math.Min(float64(gameMaxDepth), 15))
 
+		eventLocationsByGame[gameId] = eventLocations
+	}
+
+	for gameId, eventLocations := range eventLocationsByGame {
 		for _, eventLocation := range eventLocations {
-			if gameId == config.gameName {
-				var locationColors []string
-				locationColors = append(locationColors, eventLocation.FgColor, eventLocation.BgColor)
-				gameLocationColors[eventLocation.Title] = locationColors
-			}
-			adjustedDepth := eventLocation.Depth
-			adjustedMinDepth := eventLocation.MinDepth
-			if gameMaxDepth > 10 {
-				adjustedDepth = int(math.Floor(float64(adjustedDepth) / gameMaxDepth * 10))
-				adjustedMinDepth = int(math.Floor(float64(adjustedMinDepth) / gameMaxDepth * 10))
+			if gameId == getConfig().gameName {
+				locationColors[eventLocation.Title] = []string{eventLocation.FgColor, eventLocation.BgColor}
 			}
-			eventLocation.Depth = adjustedDepth
-			eventLocation.MinDepth = adjustedMinDepth
 
 			if eventLocation.Ignored {
 				continue
 			}
 
+			depth := eventLocation.Depth
+
 			if isMainServer {
-				if adjustedDepth >= dailyEventLocationMinDepth && adjustedDepth <= dailyEventLocationMaxDepth {
-					gameDailyEventLocationPools[gameId] = append(gameDailyEventLocationPools[gameId], eventLocation)
+				if depth >= dailyEventLocationMinDepth && depth <= dailyEventLocationMaxDepth {
+					dailyPools[gameId] = append(dailyPools[gameId], eventLocation)
 				}
-				if adjustedDepth >= dailyEventLocation2MinDepth && adjustedDepth <= dailyEventLocation2MaxDepth {
-					gameDailyEventLocation2Pools[gameId] = append(gameDailyEventLocation2Pools[gameId], eventLocation)
+				if depth >= dailyEventLocation2MinDepth && depth <= dailyEventLocation2MaxDepth {
+					daily2Pools[gameId] = append(daily2Pools[gameId], eventLocation)
 				}
-				if adjustedDepth >= weeklyEventLocationMinDepth && adjustedDepth <= weeklyEventLocationMaxDepth {
-					gameWeeklyEventLocationPools[gameId] = append(gameWeeklyEventLocationPools[gameId], eventLocation)
+				if depth >= weeklyEventLocationMinDepth && depth <= weeklyEventLocationMaxDepth {
+					weeklyPools[gameId] = append(weeklyPools[gameId], eventLocation)
 				}
-				if adjustedDepth >= weekendEventLocationMinDepth && adjustedDepth <= weekendEventLocationMaxDepth {
-					gameWeekendEventLocationPools[gameId] = append(gameWeekendEventLocationPools[gameId], eventLocation)
+				if depth >= weekendEventLocationMinDepth && depth <= weekendEventLocationMaxDepth {
+					weekendPools[gameId] = append(weekendPools[gameId], eventLocation)
 				}
 			}
-			if gameId == config.gameName && adjustedDepth >= freeEventLocationMinDepth {
-				freeEventLocationPool = append(freeEventLocationPool, eventLocation)
+			if gameId == getConfig().gameName && depth >= freeEventLocationMinDepth {
+				freePool = append(freePool, eventLocation)
 			}
 		}
 	}
+
+	gameEventLocations = eventLocationsByGame
+
+	eventLocationPools.Store(&EventLocationPools{
+		daily:          dailyPools,
+		daily2:         daily2Pools,
+		weekly:         weeklyPools,
+		weekend:        weekendPools,
+		free:           freePool,
+		locationColors: locationColors,
+	})
+
+	return errs
+}
+
+func adjustEventLocationDepths(eventLocations []*EventLocationData, gameMaxDepth float64) {
+	if gameMaxDepth <= 10 {
+		return
+	}
+
+	for _, eventLocation := range eventLocations {
+		eventLocation.Depth = int(math.Floor(float64(eventLocation.Depth) / gameMaxDepth * 10))
+		eventLocation.MinDepth = int(math.Floor(float64(eventLocation.MinDepth) / gameMaxDepth * 10))
+	}
 }
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 )
@@ -13,14 +14,14 @@ type PlayerFriend struct {
 }
 
 func sendFriendsUpdate() {
-	for _, client := range clients.Get() {
+	clients.Range(func(client *SessionClient) bool {
 		if !client.account {
-			continue
+			return true
 		}
 
-		playerFriendData, err := getPlayerFriendData(client.uuid)
+		playerFriendData, err := getPlayerFriendData(context.Background(), client.uuid)
 		if err != nil {
-			continue
+			return true
 		}
 
 		// for private mode
@@ -32,106 +33,66 @@ func sendFriendsUpdate() {
 			}
 		}
 
-		client.onlineFriends = onlineFriends
+		client.onlineFriends.Store(&onlineFriends)
 
 		playerFriendDataJson, err := json.Marshal(playerFriendData)
 		if err != nil {
-			continue
+			return true
 		}
 
-		client.outbox <- buildMsg("pf", playerFriendDataJson)
-	}
+		client.outbox.send(buildMsg("pf", playerFriendDataJson))
+		return true
+	})
 }
 
-func addPlayerFriend(uuid string, targetUuid string) error {
+func addPlayerFriend(ctx context.Context, uuid string, targetUuid string) error {
 	if uuid == targetUuid {
 		return errors.New("attempted adding self as friend")
 	}
 
-	var accepted bool
-
-	results, err := db.Exec("UPDATE playerFriends SET accepted = 1 WHERE uuid = ? AND targetUuid = ?", targetUuid, uuid)
-	if err == nil {
-		updatedRows, err := results.RowsAffected()
-		if err != nil {
-			return err
-		}
-		accepted = updatedRows > 0
-	}
-
-	_, err = db.Exec("INSERT IGNORE INTO playerFriends (uuid, targetUuid, accepted) VALUES (?, ?, ?)", uuid, targetUuid, accepted)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return store.players.addPlayerFriend(ctx, uuid, targetUuid)
 }
 
-func removePlayerFriend(uuid string, targetUuid string) error {
-	_, err := db.Exec("DELETE FROM playerFriends WHERE (uuid = ? AND targetUuid = ?) OR (uuid = ? AND targetUuid = ?)", uuid, targetUuid, targetUuid, uuid)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func removePlayerFriend(ctx context.Context, uuid string, targetUuid string) error {
+	return store.players.removePlayerFriend(ctx, uuid, targetUuid)
 }
 
-func getPlayerFriendData(uuid string) (playerFriends []*PlayerFriend, err error) {
-	results, err := db.Query("SELECT pf.targetUuid, pf.accepted, 0, a.user, pd.rank, COALESCE(a.badge, ''), pgd.game, pgd.online, pgd.timestampLastActive, pgd.systemName, pgd.spriteName, pgd.spriteIndex, pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM playerFriends pf JOIN playerGameData pgd ON pgd.uuid = pf.targetUuid JOIN players pd ON pd.uuid = pgd.uuid JOIN accounts a ON a.uuid = pd.uuid WHERE pf.uuid       = ? AND pgd.game = (SELECT rpgd.game FROM playerGameData rpgd WHERE rpgd.uuid = pf.targetUuid AND rpgd.spriteName <> '' ORDER BY online DESC, timestampLastActive DESC, CASE WHEN game = ? THEN 1 ELSE 0 END DESC LIMIT 1) UNION "+
-		"                       SELECT pf.uuid,       pf.accepted, 1, a.user, pd.rank, COALESCE(a.badge, ''), pgd.game, pgd.online, pgd.timestampLastActive, pgd.systemName, pgd.spriteName, pgd.spriteIndex, pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM playerFriends pf JOIN playerGameData pgd ON pgd.uuid = pf.uuid       JOIN players pd ON pd.uuid = pgd.uuid JOIN accounts a ON a.uuid = pd.uuid WHERE pf.targetUuid = ? AND pgd.game = (SELECT rpgd.game FROM playerGameData rpgd WHERE rpgd.uuid = pf.uuid       AND rpgd.spriteName <> '' ORDER BY online DESC, timestampLastActive DESC, CASE WHEN game = ? THEN 1 ELSE 0 END DESC LIMIT 1) AND NOT EXISTS (SELECT * FROM playerFriends opf WHERE opf.uuid = pf.targetUuid AND opf.targetUuid = pf.uuid) ORDER BY user", uuid, config.gameName, uuid, config.gameName)
+func getPlayerFriendData(ctx context.Context, uuid string) (playerFriends []*PlayerFriend, err error) {
+	playerFriends, err = store.players.getPlayerFriendData(ctx, uuid)
 	if err != nil {
 		return playerFriends, err
 	}
 
-	defer results.Close()
-
-	for results.Next() {
-		playerListData := PlayerListData{
-			Account: true,
-		}
-		playerFriendData := PlayerListFullData{
-			PlayerListData: playerListData,
-			MapId:          "0000",
-			PrevMapId:      "0000",
-		}
-		playerFriend := &PlayerFriend{
-			PlayerListFullData: playerFriendData,
-		}
-
-		err := results.Scan(&playerFriend.Uuid, &playerFriend.Accepted, &playerFriend.Incoming, &playerFriend.Name, &playerFriend.Rank, &playerFriend.Badge, &playerFriend.Game, &playerFriend.Online, &playerFriend.LastActive, &playerFriend.SystemName, &playerFriend.SpriteName, &playerFriend.SpriteIndex, &playerFriend.Medals[0], &playerFriend.Medals[1], &playerFriend.Medals[2], &playerFriend.Medals[3], &playerFriend.Medals[4])
-		if err != nil {
-			return playerFriends, err
-		}
-
-		if playerFriend.Accepted && playerFriend.Game == config.gameName {
+	for _, playerFriend := range playerFriends {
+		if playerFriend.Accepted && playerFriend.Game == getConfig().gameName {
 			client, ok := clients.Load(playerFriend.Uuid)
 			if ok {
-				if client.system != "" {
-					playerFriend.SystemName = client.system
+				state := client.getRoomState()
+
+				if state.system != "" {
+					playerFriend.SystemName = state.system
 				}
-				if client.sprite != "" {
-					playerFriend.SpriteName = client.sprite
+				if state.sprite != "" {
+					playerFriend.SpriteName = state.sprite
 				}
-				if client.spriteIndex > -1 {
-					playerFriend.SpriteIndex = client.spriteIndex
+				if state.spriteIndex > -1 {
+					playerFriend.SpriteIndex = state.spriteIndex
 				}
 
 				playerFriend.Badge = client.badge
 				playerFriend.Medals = client.medals
 
-				if client.roomC != nil && !(client.hideLocation && client.singleplayer) {
-					playerFriend.MapId = client.roomC.mapId
-					playerFriend.PrevMapId = client.roomC.prevMapId
-					playerFriend.PrevLocations = client.roomC.prevLocations
-					playerFriend.X = client.roomC.x
-					playerFriend.Y = client.roomC.y
+				if state.hasRoomClient && !(client.hideLocation && client.singleplayer) {
+					playerFriend.MapId = state.mapId
+					playerFriend.PrevMapId = state.prevMapId
+					playerFriend.PrevLocations = state.prevLocations
+					playerFriend.X = state.x
+					playerFriend.Y = state.y
 				}
 
 				playerFriend.Online = true
 			}
 		}
-
-		playerFriends = append(playerFriends, playerFriend)
 	}
 
 	return playerFriends, nil
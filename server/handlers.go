@@ -18,6 +18,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -36,18 +37,20 @@ func (c *RoomClient) handleSr(msg []string) error {
 		return errconv
 	}
 
-	room, ok := rooms[roomId]
-	if !ok {
+	if _, ok := rooms[roomId]; !ok {
 		return errors.New("invalid room id")
 	}
 
+	c.switchMutex.Lock()
+	defer c.switchMutex.Unlock()
+
 	c.leaveRoom()
 
 	if roomId == 0 {
 		c.notifiedMaps = make(map[int]bool)
 	}
 
-	c.joinRoom(room)
+	c.joinRoom(c.session.placeInRoom(roomId))
 
 	return nil
 }
@@ -67,6 +70,17 @@ func (c *RoomClient) handleM(msg []string) error {
 		return errconv
 	}
 
+	if !assets.IsValidCoords(c.room.id, x, y) {
+		return errors.New("coordinates out of bounds")
+	}
+
+	switch msg[0] {
+	case "m":
+		c.checkMove(x, y)
+	case "jmp":
+		c.checkJump(x, y)
+	}
+
 	// c.x and c.y get set at the same time
 	// only one needs to be checked
 	if msg[0] == "m" && c.x != -1 {
@@ -94,9 +108,9 @@ func (c *RoomClient) handleM(msg []string) error {
 	}
 
 	if msg[0] == "jmp" {
-		c.broadcast(buildMsg("jmp", c.session.id, msg[1:])) // user %id% jumped to x y
+		c.broadcastNearby(buildMsg("jmp", c.session.id, msg[1:])) // user %id% jumped to x y
 	} else {
-		c.broadcast(buildMsg("m", c.session.id, msg[1:])) // user %id% moved to x y
+		c.broadcastNearby(buildMsg("m", c.session.id, msg[1:])) // user %id% moved to x y
 	}
 
 	return nil
@@ -115,7 +129,7 @@ func (c *RoomClient) handleF(msg []string) error {
 
 	c.facing = facing
 
-	c.broadcast(buildMsg("f", c.session.id, msg[1])) // user %id% facing changed to f
+	c.broadcastNearby(buildMsg("f", c.session.id, msg[1])) // user %id% facing changed to f
 
 	return nil
 }
@@ -232,7 +246,9 @@ func (c *RoomClient) handleH(msg []string) error {
 
 	c.hidden = msg[1] != "0"
 
-	c.broadcast(buildMsg(msg[0], c.session.id, msg[1]))
+	// clients out of range already have us hidden and get
+	// the real visibility in the snapshot once we're near
+	c.broadcastNearby(buildMsg(msg[0], c.session.id, msg[1]))
 
 	return nil
 }
@@ -383,7 +399,7 @@ func (c *RoomClient) handleP(msg []string) error {
 		}
 
 		if ptr := c.pictures[id-1]; ptr != nil {
-			err := c.processMsg("rp" + delim + msg[1])
+			err := c.processMsg([]string{"rp", msg[1]})
 			if err != nil {
 				return err
 			}
@@ -500,7 +516,7 @@ func (c *RoomClient) handleBa(msg []string) error {
 		return errconv
 	}
 
-	if !config.battleAnimIds[id] {
+	if !getConfig().battleAnimIds[id] {
 		return errors.New("invalid battle animation id")
 	}
 
@@ -521,14 +537,15 @@ func (c *RoomClient) handleSs(msg []string) error {
 
 	value := msg[2] == "1"
 
-	if config.gameName == "2kki" && c.session.rank == 0 && switchId == 11 && value {
-		c.session.cancel()
+	if getConfig().gameName == "2kki" && c.session.rank == 0 && switchId == 11 && value {
+		// terminating leaves the room, which can't be done from the room's goroutine
+		go c.session.terminate()
 	}
 
 	c.switchCache[switchId] = value
-	if switchId == 1430 && config.gameName == "2kki" { // time trial mode
+	if switchId == 1430 && getConfig().gameName == "2kki" { // time trial mode
 		if value {
-			c.outbox <- buildMsg("sv", 88, 0) // time elapsed
+			c.outbox.send(buildMsg("sv", 88, 0)) // time elapsed
 		}
 	} else {
 		if len(c.room.minigames) != 0 {
@@ -536,13 +553,13 @@ func (c *RoomClient) handleSs(msg []string) error {
 				if minigame.Dev && c.session.rank < 1 {
 					continue
 				}
-				if minigame.SwitchId == switchId && minigame.SwitchValue == value && c.minigameScores[m] < c.varCache[minigame.VarId] {
-					tryWritePlayerMinigameScore(c.session.uuid, minigame.Id, c.varCache[minigame.VarId])
+				if minigame.SwitchId == switchId && minigame.SwitchValue == value && c.getMinigameScore(m) < c.varCache[minigame.VarId] {
+					c.writeMinigameScore(minigame.Id, c.varCache[minigame.VarId])
 				}
 			}
 		}
 
-		for _, condition := range append(globalConditions, c.room.conditions...) {
+		for _, condition := range slices.Concat(getBadgeData().globalConditions, c.room.conditions) {
 			validVars := !condition.VarTrigger
 			if condition.VarTrigger {
 				if condition.VarId > 0 {
@@ -575,23 +592,17 @@ func (c *RoomClient) handleSs(msg []string) error {
 						if condition.VarTrigger || (condition.VarId == 0 && len(condition.VarIds) == 0) {
 							if !condition.TimeTrial {
 								if c.checkConditionCoords(condition) {
-									success, err := tryWritePlayerTag(c.session.uuid, condition.ConditionId)
-									if err != nil {
-										return err
-									}
-									if success {
-										c.outbox <- buildMsg("b")
-									}
+									c.writeTag(condition.ConditionId)
 								}
-							} else if config.gameName == "2kki" {
-								c.outbox <- buildMsg("ss", 1430, 0)
+							} else if getConfig().gameName == "2kki" {
+								c.outbox.send(buildMsg("ss", 1430, 0))
 							}
 						} else {
 							varId := condition.VarId
 							if len(condition.VarIds) != 0 {
 								varId = condition.VarIds[0]
 							}
-							c.outbox <- buildMsg("sv", varId, 0)
+							c.outbox.send(buildMsg("sv", varId, 0))
 						}
 					}
 				} else if len(condition.SwitchIds) != 0 {
@@ -600,26 +611,20 @@ func (c *RoomClient) handleSs(msg []string) error {
 							if condition.VarTrigger || (condition.VarId == 0 && len(condition.VarIds) == 0) {
 								if !condition.TimeTrial {
 									if c.checkConditionCoords(condition) {
-										success, err := tryWritePlayerTag(c.session.uuid, condition.ConditionId)
-										if err != nil {
-											return err
-										}
-										if success {
-											c.outbox <- buildMsg("b")
-										}
+										c.writeTag(condition.ConditionId)
 									}
-								} else if config.gameName == "2kki" {
-									c.outbox <- buildMsg("ss", 1430, 0)
+								} else if getConfig().gameName == "2kki" {
+									c.outbox.send(buildMsg("ss", 1430, 0))
 								}
 							} else {
 								varId := condition.VarId
 								if len(condition.VarIds) != 0 {
 									varId = condition.VarIds[0]
 								}
-								c.outbox <- buildMsg("sv", varId, 0)
+								c.outbox.send(buildMsg("sv", varId, 0))
 							}
 						} else {
-							c.outbox <- buildMsg("ss", condition.SwitchIds[s+1], 0)
+							c.outbox.send(buildMsg("ss", condition.SwitchIds[s+1], 0))
 						}
 					}
 				}
@@ -645,9 +650,9 @@ func (c *RoomClient) handleSv(msg []string) error {
 	}
 	c.varCache[varId] = value
 
-	conditions := append(globalConditions, c.room.conditions...)
+	conditions := slices.Concat(getBadgeData().globalConditions, c.room.conditions)
 
-	if varId == 88 && config.gameName == "2kki" {
+	if varId == 88 && getConfig().gameName == "2kki" {
 		if c.notifiedMaps == nil {
 			c.notifiedMaps = make(map[int]bool)
 		}
@@ -655,16 +660,10 @@ func (c *RoomClient) handleSv(msg []string) error {
 			if condition.TimeTrial && value < 3600 {
 				if c.checkConditionCoords(condition) {
 					if !c.notifiedMaps[condition.Map] {
-						c.session.outbox <- buildMsg("ttr", c.room.id, value)
+						c.session.outbox.send(buildMsg("ttr", c.room.id, value))
 						c.notifiedMaps[condition.Map] = true
 					}
-					success, err := tryWritePlayerTimeTrial(c.session.uuid, c.room.id, value)
-					if err != nil {
-						return err
-					}
-					if success {
-						c.outbox <- buildMsg("b")
-					}
+					c.writeTimeTrial(value)
 				}
 			}
 		}
@@ -674,11 +673,11 @@ func (c *RoomClient) handleSv(msg []string) error {
 				if minigame.Dev && c.session.rank < 1 {
 					continue
 				}
-				if minigame.VarId == varId && c.minigameScores[m] < value {
+				if minigame.VarId == varId && c.getMinigameScore(m) < value {
 					if minigame.SwitchId > 0 {
-						c.outbox <- buildMsg("ss", minigame.SwitchId, 0)
+						c.outbox.send(buildMsg("ss", minigame.SwitchId, 0))
 					} else {
-						tryWritePlayerMinigameScore(c.session.uuid, minigame.Id, value)
+						c.writeMinigameScore(minigame.Id, value)
 					}
 				}
 			}
@@ -717,23 +716,17 @@ func (c *RoomClient) handleSv(msg []string) error {
 						if !condition.VarTrigger || (condition.SwitchId == 0 && len(condition.SwitchIds) == 0) {
 							if !condition.TimeTrial {
 								if c.checkConditionCoords(condition) {
-									success, err := tryWritePlayerTag(c.session.uuid, condition.ConditionId)
-									if err != nil {
-										return err
-									}
-									if success {
-										c.outbox <- buildMsg("b")
-									}
+									c.writeTag(condition.ConditionId)
 								}
-							} else if config.gameName == "2kki" {
-								c.outbox <- buildMsg("ss", 1430, 0)
+							} else if getConfig().gameName == "2kki" {
+								c.outbox.send(buildMsg("ss", 1430, 0))
 							}
 						} else {
 							switchId := condition.SwitchId
 							if len(condition.SwitchIds) != 0 {
 								switchId = condition.SwitchIds[0]
 							}
-							c.outbox <- buildMsg("ss", switchId, 0)
+							c.outbox.send(buildMsg("ss", switchId, 0))
 						}
 					}
 				} else if len(condition.VarIds) != 0 {
@@ -742,26 +735,20 @@ func (c *RoomClient) handleSv(msg []string) error {
 							if !condition.VarTrigger || (condition.SwitchId == 0 && len(condition.SwitchIds) == 0) {
 								if !condition.TimeTrial {
 									if c.checkConditionCoords(condition) {
-										success, err := tryWritePlayerTag(c.session.uuid, condition.ConditionId)
-										if err != nil {
-											return err
-										}
-										if success {
-											c.outbox <- buildMsg("b")
-										}
+										c.writeTag(condition.ConditionId)
 									}
-								} else if config.gameName == "2kki" {
-									c.outbox <- buildMsg("ss", 1430, 0)
+								} else if getConfig().gameName == "2kki" {
+									c.outbox.send(buildMsg("ss", 1430, 0))
 								}
 							} else {
 								switchId := condition.SwitchId
 								if len(condition.SwitchIds) != 0 {
 									switchId = condition.SwitchIds[0]
 								}
-								c.outbox <- buildMsg("ss", switchId, 0)
+								c.outbox.send(buildMsg("ss", switchId, 0))
 							}
 						} else {
-							c.outbox <- buildMsg("sv", condition.VarIds[v+1], 0)
+							c.outbox.send(buildMsg("sv", condition.VarIds[v+1], 0))
 						}
 					}
 				}
@@ -796,13 +783,18 @@ func (c *RoomClient) handleSev(msg []string) error {
 		return errors.New("event vm id mismatch")
 	}
 
-	exp, err := tryCompleteEventVm(c.session.uuid, currentEventVmMapId, eventIdInt)
-	if err != nil {
-		return err
-	}
-	if exp > -1 {
-		c.session.outbox <- buildMsg("vm", exp)
-	}
+	// completing it goes to the database, keep that off the room's goroutine
+	uuid, mapId, vmMapId := c.session.uuid, c.mapId, currentEventVmMapId
+	runDetached(c.getCtx(), func(ctx context.Context) {
+		exp, err := tryCompleteEventVm(ctx, uuid, mapId, vmMapId, eventIdInt)
+		if err != nil {
+			writeErrLog(uuid, mapId, err.Error())
+			return
+		}
+		if exp > -1 {
+			c.session.outbox.send(buildMsg("vm", exp))
+		}
+	})
 
 	return nil
 }
@@ -833,8 +825,8 @@ func (c *RoomClient) handleAnc(msg []string) error {
 // SESSION
 
 func (c *SessionClient) handleI() error {
-	badgeSlotRows, badgeSlotCols := getPlayerBadgeSlotCounts(c.name)
-	screenshotLimit := getPlayerScreenshotLimit(c.name)
+	badgeSlotRows, badgeSlotCols := getPlayerBadgeSlotCounts(c.getCtx(), c.name)
+	screenshotLimit := getPlayerScreenshotLimit(c.getCtx(), c.name)
 	playerInfoJson, err := json.Marshal(PlayerInfo{
 		Uuid:            c.uuid,
 		Name:            c.name,
@@ -843,13 +835,13 @@ func (c *SessionClient) handleI() error {
 		BadgeSlotRows:   badgeSlotRows,
 		BadgeSlotCols:   badgeSlotCols,
 		ScreenshotLimit: screenshotLimit,
-		Medals:          getPlayerMedals(c.uuid),
+		Medals:          getPlayerMedals(c.getCtx(), c.uuid),
 	})
 	if err != nil {
 		return err
 	}
 
-	c.outbox <- buildMsg("i", playerInfoJson)
+	c.outbox.send(buildMsg("i", playerInfoJson))
 
 	return nil
 }
@@ -868,11 +860,14 @@ func (c *SessionClient) handleName(msg []string) error {
 		return errors.New("invalid name")
 	}
 
-	c.name = msg[1]
+	// the name is read on the room's goroutine, so set it there
+	c.inRoom(func(room *Room) {
+		c.name = msg[1]
 
-	if c.roomC != nil {
-		c.roomC.broadcast(buildMsg("name", c.id, c.name)) // broadcast name change to room if client is in one
-	}
+		if room != nil {
+			c.roomC.broadcast(buildMsg("name", c.id, c.name)) // broadcast name change to room if client is in one
+		}
+	})
 
 	return nil
 }
@@ -890,10 +885,14 @@ func (c *SessionClient) handlePloc(msg []string) error {
 		return errors.New("invalid prev map id")
 	}
 
-	c.roomC.prevMapId = msg[1]
-	c.roomC.prevLocations = msg[2]
+	c.roomC.inRoom(func(room *Room) {
+		c.roomC.prevMapId = msg[1]
+		c.roomC.prevLocations = msg[2]
 
-	c.roomC.checkRoomConditions("prevMap", c.roomC.prevMapId)
+		if room != nil {
+			c.roomC.checkRoomConditions("prevMap", c.roomC.prevMapId)
+		}
+	})
 
 	return nil
 }
@@ -909,12 +908,12 @@ func (c *SessionClient) handleLcol(msg []string) error {
 
 	locationName := msg[1]
 
-	if locationColors, ok := gameLocationColors[locationName]; ok {
-		c.outbox <- buildMsg("lcol", locationColors[0], locationColors[1])
+	if locationColors, ok := getEventLocationPools().locationColors[locationName]; ok {
+		c.outbox.send(buildMsg("lcol", locationColors[0], locationColors[1]))
 		return nil
 	}
 
-	c.outbox <- buildMsg("lcol", "", "")
+	c.outbox.send(buildMsg("lcol", "", ""))
 
 	return nil
 }
@@ -932,17 +931,28 @@ func (c *SessionClient) handleSay(msg []string) error {
 		return errors.New("segment count mismatch")
 	}
 
-	if c.name == "" || c.system == "" {
-		return errors.New("no name or system graphic set")
-	}
-
-	msgContents := wordFilter.ReplaceAllString(strings.TrimSpace(msg[1]), ":2kkiSign:")
+	msgContents := filterWords(strings.TrimSpace(msg[1]))
 	if msgContents == "" || len(msgContents) > 150 {
 		return errors.New("invalid message")
 	}
 
-	if !c.banned {
-		for _, client := range c.roomC.room.clients {
+	var err error
+	c.roomC.inRoom(func(room *Room) {
+		if room == nil {
+			err = errors.New("room client does not exist")
+			return
+		}
+
+		if c.name == "" || c.system == "" {
+			err = errors.New("no name or system graphic set")
+			return
+		}
+
+		if c.banned {
+			return
+		}
+
+		for _, client := range room.clients {
 			if client.session == c {
 				continue
 			}
@@ -955,12 +965,15 @@ func (c *SessionClient) handleSay(msg []string) error {
 				continue
 			}
 
-			client.session.outbox <- buildMsg("say", c.uuid, msgContents)
+			client.session.outbox.send(buildMsg("say", c.uuid, msgContents))
 		}
+	})
+	if err != nil {
+		return err
 	}
 
 	// so local echo appears
-	c.outbox <- buildMsg("say", c.uuid, msgContents)
+	c.outbox.send(buildMsg("say", c.uuid, msgContents))
 
 	return nil
 }
@@ -978,12 +991,12 @@ func (c *SessionClient) handleGPSay(msg []string) error {
 		return errors.New("no name set")
 	}
 
-	msgContents := wordFilter.ReplaceAllString(strings.TrimSpace(msg[1]), ":2kkiSign:")
+	msgContents := filterWords(strings.TrimSpace(msg[1]))
 	if msgContents == "" || len(msgContents) > 150 {
 		return errors.New("invalid message")
 	}
 
-	if msg[0] == "psay" && c.partyId == 0 {
+	if msg[0] == "psay" && c.getPartyId() == 0 {
 		return errors.New("player not in a party")
 	}
 
@@ -993,57 +1006,63 @@ func (c *SessionClient) handleGPSay(msg []string) error {
 	x := -1
 	y := -1
 
-	if c.roomC != nil && !c.hideLocation {
-		mapId = c.roomC.mapId
-		prevMapId = c.roomC.prevMapId
-		prevLocations = c.roomC.prevLocations
-		x = c.roomC.x
-		y = c.roomC.y
-	}
+	var system string
+
+	// the location and system graphic are set on the room's goroutine
+	c.inRoom(func(room *Room) {
+		system = c.system
+
+		if room != nil && !c.hideLocation {
+			mapId = c.roomC.mapId
+			prevMapId = c.roomC.prevMapId
+			prevLocations = c.roomC.prevLocations
+			x = c.roomC.x
+			y = c.roomC.y
+		}
+	})
 
 	msgId := randString(12)
 
 	if msg[0] == "gsay" {
 		if !c.banned {
-			c.broadcast(buildMsg("p", c.uuid, c.name, c.system, c.rank, c.account, c.badge, c.medals[:]))
+			c.broadcast(buildMsg("p", c.uuid, c.name, system, c.rank, c.account, c.badge, c.medals[:]))
 			c.broadcast(buildMsg("gsay", c.uuid, mapId, prevMapId, prevLocations, x, y, msgContents, msgId))
 		} else {
-			c.outbox <- buildMsg("gsay", c.uuid, mapId, prevMapId, prevLocations, x, y, msgContents, msgId)
+			c.outbox.send(buildMsg("gsay", c.uuid, mapId, prevMapId, prevLocations, x, y, msgContents, msgId))
 			return nil
 		}
 
-		err := writeGlobalChatMessage(msgId, c.uuid, mapId, prevMapId, prevLocations, x, y, msgContents)
+		err := writeGlobalChatMessage(c.getCtx(), msgId, c.uuid, mapId, prevMapId, prevLocations, x, y, msgContents)
 		if err != nil {
 			return err
 		}
 
-		if c.account && config.chatWebhook != "" {
-			game := config.gameName
+		if c.account && getConfig().chatWebhook != "" {
+			game := getConfig().gameName
 			if gameName, ok := gameIdToName[game]; ok {
 				game = gameName
 			}
 
-			err = sendWebhookMessage(config.chatWebhook, fmt.Sprintf("%s (%s)", c.name, game), c.badge, msgContents, true)
+			err = sendWebhookMessage(getConfig().chatWebhook, fmt.Sprintf("%s (%s)", c.name, game), c.badge, msgContents, true)
 			if err != nil {
 				return err
 			}
 		}
 	} else {
 		if !c.banned {
-			for _, client := range clients.Get() {
-				if client.partyId == c.partyId {
-					if c.isBlockedWith(client) {
-						continue
-					}
-					client.outbox <- buildMsg("psay", c.uuid, msgContents, msgId)
+			msg := buildMsg("psay", c.uuid, msgContents, msgId)
+			clients.Range(func(client *SessionClient) bool {
+				if client.getPartyId() == c.getPartyId() && !c.isBlockedWith(client) {
+					client.outbox.send(msg)
 				}
-			}
+				return true
+			})
 		} else {
-			c.outbox <- buildMsg("psay", c.uuid, msgContents, msgId)
+			c.outbox.send(buildMsg("psay", c.uuid, msgContents, msgId))
 			return nil
 		}
 
-		err := writePartyChatMessage(msgId, c.uuid, mapId, prevMapId, prevLocations, x, y, msgContents, c.partyId)
+		err := writePartyChatMessage(c.getCtx(), msgId, c.uuid, mapId, prevMapId, prevLocations, x, y, msgContents, c.getPartyId())
 		if err != nil {
 			return err
 		}
@@ -1057,42 +1076,51 @@ func (c *SessionClient) handleL(msg []string) error {
 		return errors.New("room client does not exist")
 	}
 
-	if len(c.roomC.locationIds) > 0 {
-		c.roomC.locations = []string{}
-		c.roomC.locationIds = []int{}
-	}
-
-	var locationIds []int
+	// looked up before going to the room, its goroutine mustn't wait for the database
+	var gameLocations []GameLocation
+	var locationNames []string
 
 	for i, locationName := range msg {
 		if i == 0 {
 			continue
 		}
 
-		gameLocation, err := getGameLocationByName(locationName)
+		gameLocation, err := getGameLocationByName(c.getCtx(), locationName)
 		if err != nil {
 			writeLog(c.uuid, "sess", err.Error(), 200)
 			continue
 		}
 
-		duplicateLocation := slices.Contains(c.roomC.locationIds, gameLocation.Id)
+		gameLocations = append(gameLocations, gameLocation)
+		locationNames = append(locationNames, locationName)
+	}
 
-		if duplicateLocation {
-			continue
-		}
+	var locationIds, matchedLocationIds []int
+
+	c.roomC.inRoom(func(*Room) {
+		c.roomC.locations = []string{}
+		c.roomC.locationIds = []int{}
 
-		locationIds = append(locationIds, gameLocation.Id)
-		c.roomC.locationIds = append(c.roomC.locationIds, gameLocation.Id)
+		for i, gameLocation := range gameLocations {
+			if slices.Contains(c.roomC.locationIds, gameLocation.Id) {
+				continue
+			}
 
-		matchedLocationMap := slices.Contains(gameLocation.MapIds, c.roomC.mapId)
+			locationIds = append(locationIds, gameLocation.Id)
+			c.roomC.locationIds = append(c.roomC.locationIds, gameLocation.Id)
 
-		if matchedLocationMap {
-			writePlayerGameLocation(c.uuid, locationName)
-			c.roomC.locations = append(c.roomC.locations, locationName)
+			if slices.Contains(gameLocation.MapIds, c.roomC.mapId) {
+				matchedLocationIds = append(matchedLocationIds, gameLocation.Id)
+				c.roomC.locations = append(c.roomC.locations, locationNames[i])
+			}
 		}
+	})
+
+	for _, locationId := range matchedLocationIds {
+		writePlayerGameLocation(c.getCtx(), c.uuid, locationId)
 	}
 
-	c.outbox <- buildMsg("l", locationIds)
+	c.outbox.send(buildMsg("l", locationIds))
 
 	return nil
 }
@@ -1111,20 +1139,21 @@ func (c *SessionClient) handleNl(msg []string) error {
 		return errors.New("invalid destination location id")
 	}
 
-	destLocationName, err := getLocationName(destLocationId)
+	destLocationName, err := getLocationName(c.getCtx(), destLocationId)
 	if err != nil {
 		return fmt.Errorf("invalid destination location: %s", err)
 	} else if destLocationName == "" {
 		return errors.New("invalid destination location")
 	}
 
-	if len(c.roomC.locations) == 0 {
+	locations := c.getRoomState().locations
+	if len(locations) == 0 {
 		return errors.New("player location unknown")
 	}
 
-	nextLocations, err := getNext2kkiLocations(c.roomC.locations[0], destLocationName)
+	nextLocations, err := getNext2kkiLocations(c.getCtx(), locations[0], destLocationName)
 	if err != nil {
-		return fmt.Errorf("invalid next locations for %s -> %s: %s", c.roomC.locations[0], destLocationName, err)
+		return fmt.Errorf("invalid next locations for %s -> %s: %s", locations[0], destLocationName, err)
 	}
 
 	nextLocationsJson, err := json.Marshal(nextLocations.Locations)
@@ -1132,13 +1161,13 @@ func (c *SessionClient) handleNl(msg []string) error {
 		return fmt.Errorf("error while marshaling: %s", err)
 	}
 
-	c.outbox <- buildMsg("nl", nextLocationsJson)
+	c.outbox.send(buildMsg("nl", nextLocationsJson))
 
 	return nil
 }
 
 func (c *SessionClient) handleLp() error {
-	c.outbox <- buildMsg("lp", locationPlayerCountsPayload)
+	c.outbox.send(buildMsg("lp", locationPlayerCountsPayload))
 
 	return nil
 }
@@ -1148,7 +1177,7 @@ func (c *SessionClient) handlePf() error {
 		return nil
 	}
 
-	playerFriendData, err := getPlayerFriendData(c.uuid)
+	playerFriendData, err := getPlayerFriendData(c.getCtx(), c.uuid)
 	if err != nil {
 		return err
 	}
@@ -1157,7 +1186,7 @@ func (c *SessionClient) handlePf() error {
 		return err
 	}
 
-	c.outbox <- buildMsg("pf", playerFriendDataJson)
+	c.outbox.send(buildMsg("pf", playerFriendDataJson))
 
 	return nil
 }
@@ -1167,10 +1196,10 @@ func (c *SessionClient) handlePt() error {
 		return nil
 	}
 
-	if c.partyId == 0 {
+	if c.getPartyId() == 0 {
 		return errors.New("player not in a party")
 	}
-	partyData, err := getPartyData(c.partyId)
+	partyData, err := getPartyData(c.getPartyId())
 	if err != nil {
 		return err
 	}
@@ -1179,13 +1208,13 @@ func (c *SessionClient) handlePt() error {
 		return err
 	}
 
-	c.outbox <- buildMsg("pt", partyDataJson)
+	c.outbox.send(buildMsg("pt", partyDataJson))
 
 	return nil
 }
 
 func (c *SessionClient) handleEp() error {
-	period, err := getCurrentEventPeriodData()
+	period, err := getCurrentEventPeriodData(c.getCtx())
 	if err != nil {
 		return err
 	}
@@ -1194,36 +1223,36 @@ func (c *SessionClient) handleEp() error {
 		return err
 	}
 
-	c.outbox <- buildMsg("ep", periodJson)
+	c.outbox.send(buildMsg("ep", periodJson))
 
 	return nil
 }
 
 func (c *SessionClient) handleE() error {
-	currentEventLocationsData, err := getCurrentPlayerEventLocationsData(c.uuid)
+	currentEventLocationsData, err := getCurrentPlayerEventLocationsData(c.getCtx(), c.uuid)
 	if err != nil {
 		return err
 	}
 	var hasIncompleteEvent bool
 	for _, currentEventLocation := range currentEventLocationsData {
-		if !currentEventLocation.Complete && currentEventLocation.Game == config.gameName {
+		if !currentEventLocation.Complete && currentEventLocation.Game == getConfig().gameName {
 			hasIncompleteEvent = true
 			break
 		}
 	}
 	if !hasIncompleteEvent {
-		if config.gameName == "2kki" {
+		if getConfig().gameName == "2kki" {
 			addPlayer2kkiEventLocation(currentGameEventPeriodId, -1, freeEventLocationMinDepth, 0, 0, c.uuid)
-		} else if len(freeEventLocationPool) > 0 {
-			addPlayerEventLocation(config.gameName, -1, 0, freeEventLocationPool, c.uuid)
+		} else if freePool := getEventLocationPools().free; len(freePool) > 0 {
+			addPlayerEventLocation(getConfig().gameName, -1, 0, freePool, c.uuid)
 		}
-		currentEventLocationsData, err = getCurrentPlayerEventLocationsData(c.uuid)
+		currentEventLocationsData, err = getCurrentPlayerEventLocationsData(c.getCtx(), c.uuid)
 		if err != nil {
 			return err
 		}
 	}
 
-	currentEventVmsData, err := getCurrentPlayerEventVmsData(c.uuid)
+	currentEventVmsData, err := getCurrentPlayerEventVmsData(c.getCtx(), c.uuid)
 	if err != nil {
 		return err
 	}
@@ -1238,7 +1267,7 @@ func (c *SessionClient) handleE() error {
 		return err
 	}
 
-	c.outbox <- buildMsg("e", eventsDataJson)
+	c.outbox.send(buildMsg("e", eventsDataJson))
 
 	return nil
 }
@@ -1248,7 +1277,7 @@ func (c *SessionClient) handleEexp() error {
 		return errors.New("events are disabled")
 	}
 
-	playerEventExpData, err := getPlayerEventExpData(c.uuid)
+	playerEventExpData, err := getPlayerEventExpData(c.getCtx(), c.uuid)
 	if err != nil {
 		return err
 	}
@@ -1257,45 +1286,45 @@ func (c *SessionClient) handleEexp() error {
 		return err
 	}
 
-	c.outbox <- buildMsg("eexp", playerEventExpDataJson)
+	c.outbox.send(buildMsg("eexp", playerEventExpDataJson))
 
 	return nil
 }
 
 func (c *SessionClient) handleEec(msg []string) error {
 	if currentGameEventPeriodId <= 0 {
-		c.outbox <- buildMsg("eec", 0, false)
+		c.outbox.send(buildMsg("eec", 0, false))
 		return errors.New("events are disabled")
 	}
 
 	if len(msg) < 3 {
-		c.outbox <- buildMsg("eec", 0, false)
+		c.outbox.send(buildMsg("eec", 0, false))
 		return errors.New("segment count mismatch")
 	}
 
 	location := msg[1]
 	if len(location) == 0 {
-		c.outbox <- buildMsg("eec", 0, false)
+		c.outbox.send(buildMsg("eec", 0, false))
 		return errors.New("location not specified")
 	}
 
 	exp := -1
 	if c.roomC != nil {
 		if msg[2] != "1" { // not free expedition
-			expV, err := tryCompleteEventLocation(c.uuid, location)
+			expV, err := tryCompleteEventLocation(c.getCtx(), c.uuid, location)
 			if err != nil {
-				c.outbox <- buildMsg("eec", 0, false)
+				c.outbox.send(buildMsg("eec", 0, false))
 				return err
 			}
 			if expV < 0 {
-				c.outbox <- buildMsg("eec", 0, false)
+				c.outbox.send(buildMsg("eec", 0, false))
 				return errors.New("unexpected state")
 			}
 			exp = expV
 		} else { // free expedition
-			complete, err := tryCompletePlayerEventLocation(c.uuid, location)
+			complete, err := tryCompletePlayerEventLocation(c.getCtx(), c.uuid, location)
 			if err != nil {
-				c.outbox <- buildMsg("eec", 0, false)
+				c.outbox.send(buildMsg("eec", 0, false))
 				return err
 			}
 			if complete {
@@ -1303,27 +1332,27 @@ func (c *SessionClient) handleEec(msg []string) error {
 			}
 		}
 	}
-	currentEventLocationsData, err := getCurrentPlayerEventLocationsData(c.uuid)
+	currentEventLocationsData, err := getCurrentPlayerEventLocationsData(c.getCtx(), c.uuid)
 	if err != nil {
-		c.outbox <- buildMsg("eec", 0, false)
+		c.outbox.send(buildMsg("eec", 0, false))
 		return err
 	}
 	var hasIncompleteEvent bool
 	for _, currentEventLocation := range currentEventLocationsData {
-		if !currentEventLocation.Complete && currentEventLocation.Game == config.gameName {
+		if !currentEventLocation.Complete && currentEventLocation.Game == getConfig().gameName {
 			hasIncompleteEvent = true
 			break
 		}
 	}
 	if !hasIncompleteEvent {
-		if config.gameName == "2kki" {
+		if getConfig().gameName == "2kki" {
 			addPlayer2kkiEventLocation(currentGameEventPeriodId, -1, freeEventLocationMinDepth, 0, 0, c.uuid)
-		} else if len(freeEventLocationPool) > 0 {
-			addPlayerEventLocation(config.gameName, -1, 0, freeEventLocationPool, c.uuid)
+		} else if freePool := getEventLocationPools().free; len(freePool) > 0 {
+			addPlayerEventLocation(getConfig().gameName, -1, 0, freePool, c.uuid)
 		}
 	}
 
-	c.outbox <- buildMsg("eec", exp, true)
+	c.outbox.send(buildMsg("eec", exp, true))
 
 	return nil
 }
@@ -1333,7 +1362,7 @@ func (c *SessionClient) handlePsi(uuid string, msg []string) error {
 		return errors.New("segment count mismatch")
 	}
 
-	screenshotInfo, err := getScreenshotInfo(uuid, msg[1], msg[2])
+	screenshotInfo, err := getScreenshotInfo(c.getCtx(), uuid, msg[1], msg[2])
 	if err != nil {
 		return err
 	}
@@ -1344,7 +1373,7 @@ func (c *SessionClient) handlePsi(uuid string, msg []string) error {
 			return err
 		}
 
-		c.outbox <- buildMsg("psi", screenshotInfoJson)
+		c.outbox.send(buildMsg("psi", screenshotInfoJson))
 	}
 
 	return nil
@@ -0,0 +1,171 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// how long each health check may take before it counts as failed
+const healthCheckTimeout = 2 * time.Second
+
+type HealthCheck struct {
+	Ok      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+type HealthData struct {
+	Ok     bool                   `json:"ok"`
+	Game   string                 `json:"game"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+var healthChecks = map[string]func(ctx context.Context) error{
+	"db":        checkDatabaseHealth,
+	"scheduler": checkSchedulerHealth,
+	"ipc":       checkIpcHealth,
+	"assets":    checkAssetsHealth,
+}
+
+// handleHealth reports whether the server and everything it depends on works
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeHealthData(w, r, getHealthData())
+}
+
+// handleReady is handleHealth, except it also fails while shutting down
+// so no new players are sent to a server that's about to go away
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	healthData := getHealthData()
+
+	if shuttingDown.Load() {
+		healthData.Ok = false
+		healthData.Checks["shutdown"] = HealthCheck{Error: "server is shutting down"}
+	}
+
+	writeHealthData(w, r, healthData)
+}
+
+func getHealthData() *HealthData {
+	healthData := &HealthData{
+		Ok:     true,
+		Game:   getConfig().gameName,
+		Checks: make(map[string]HealthCheck),
+	}
+
+	type result struct {
+		name  string
+		check HealthCheck
+	}
+
+	results := make(chan result, len(healthChecks))
+	for name, check := range healthChecks {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(ctx)
+
+			healthCheck := HealthCheck{Ok: err == nil, Latency: time.Since(start).String()}
+			if err != nil {
+				healthCheck.Error = err.Error()
+			}
+
+			results <- result{name, healthCheck}
+		}()
+	}
+
+	for range healthChecks {
+		result := <-results
+		if !result.check.Ok {
+			healthData.Ok = false
+		}
+
+		healthData.Checks[result.name] = result.check
+	}
+
+	return healthData
+}
+
+func writeHealthData(w http.ResponseWriter, r *http.Request, healthData *HealthData) {
+	healthDataJson, err := json.Marshal(healthData)
+	if err != nil {
+		handleInternalError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !healthData.Ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(healthDataJson)
+}
+
+func checkDatabaseHealth(ctx context.Context) error {
+	if getConfig().storage == storageMemory {
+		return nil
+	}
+
+	if db == nil {
+		return errors.New("database not connected")
+	}
+
+	return db.PingContext(ctx)
+}
+
+func checkSchedulerHealth(ctx context.Context) error {
+	if !scheduler.IsRunning() {
+		return errors.New("scheduler is not running")
+	}
+
+	return nil
+}
+
+func checkIpcHealth(ctx context.Context) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "unix", fmt.Sprintf("/tmp/yno/%s.sck", getConfig().gameName))
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+func checkAssetsHealth(ctx context.Context) error {
+	if assets == nil {
+		return errors.New("assets not loaded")
+	}
+
+	if len(assets.maps) == 0 {
+		return fmt.Errorf("no maps found in %s", getConfig().gamePath)
+	}
+
+	if len(assets.sprites) == 0 || len(assets.systems) == 0 {
+		return fmt.Errorf("no charsets or systems found in %s", getConfig().gamePath)
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Rooms with a capacity are split into numbered instances once they fill up.
+// rooms only holds instance 0 of every room, the rest are created on demand
+// and kept for reuse. Players in different instances of a room can't see
+// each other.
+
+var roomInstances = struct {
+	instances map[int][]*Room
+
+	// guards instances and Room.members
+	mutex sync.Mutex
+}{
+	instances: make(map[int][]*Room),
+}
+
+func getRoomCapacity(roomId int) int {
+	config := getConfig()
+	if capacity, ok := config.roomCapacities[roomId]; ok {
+		return capacity
+	}
+
+	return config.roomCapacity
+}
+
+// getRoomInstances returns every instance of roomId
+func getRoomInstances(roomId int) []*Room {
+	roomInstances.mutex.Lock()
+	defer roomInstances.mutex.Unlock()
+
+	return append([]*Room(nil), roomInstances.instances[roomId]...)
+}
+
+// getRoomInstance returns an existing instance of roomId
+func getRoomInstance(roomId int, instance int) (*Room, bool) {
+	roomInstances.mutex.Lock()
+	defer roomInstances.mutex.Unlock()
+
+	instances := roomInstances.instances[roomId]
+	if instance < 0 || instance >= len(instances) {
+		return nil, false
+	}
+
+	return instances[instance], true
+}
+
+// placeInRoom picks the instance of roomId for c to join and adds c to its
+// members, preferring instances with party members or friends
+func (c *SessionClient) placeInRoom(roomId int) *Room {
+	roomInstances.mutex.Lock()
+	defer roomInstances.mutex.Unlock()
+
+	instances := roomInstances.instances[roomId]
+
+	room := instances[0]
+	if capacity := getRoomCapacity(roomId); capacity != 0 && !room.singleplayer {
+		room = c.pickRoomInstance(instances, capacity)
+		if room == nil {
+			room = instances[0].newInstance(len(instances))
+			roomInstances.instances[roomId] = append(instances, room)
+		}
+	}
+
+	room.members[c] = true
+
+	return room
+}
+
+func (c *SessionClient) pickRoomInstance(instances []*Room, capacity int) *Room {
+	var (
+		room          *Room
+		acquaintances int
+	)
+	for _, instance := range instances {
+		if len(instance.members) >= capacity {
+			continue
+		}
+
+		if count := c.countAcquaintances(instance); room == nil || count > acquaintances {
+			room, acquaintances = instance, count
+		}
+	}
+
+	return room
+}
+
+// countAcquaintances counts the party members and friends of c in the
+// instance, it must be used with roomInstances.mutex held
+func (c *SessionClient) countAcquaintances(instance *Room) (count int) {
+	partyId := c.getPartyId()
+
+	for member := range instance.members {
+		if member == c {
+			continue
+		}
+
+		if (partyId != 0 && member.getPartyId() == partyId) || c.isOnlineFriend(member.uuid) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// release removes a session that left the room from its members
+func (r *Room) release(session *SessionClient) {
+	roomInstances.mutex.Lock()
+	defer roomInstances.mutex.Unlock()
+
+	delete(r.members, session)
+}
+
+func (r *Room) newInstance(instance int) *Room {
+	// conditions belong to the room's goroutine, so take them from the current badge data
+	room := newRoom(r.id, instance, r.singleplayer, getConfig().interestRadii[r.id], getBadgeData().getRoomConditions(r.id), r.minigames)
+
+	writeLog("SERVER", "rooms", fmt.Sprintf("created instance %d of room %d", instance, r.id), 200)
+
+	return room
+}
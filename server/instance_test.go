@@ -0,0 +1,77 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPlaceInRoom(t *testing.T) {
+	const roomId = testRooms
+
+	newSession := func(partyId int, friends ...string) *SessionClient {
+		session := &SessionClient{uuid: "instance" + strconv.Itoa(int(lastTestPlayer.Add(1)))}
+		session.setPartyId(partyId)
+
+		onlineFriends := make(map[string]bool)
+		for _, friend := range friends {
+			onlineFriends[friend] = true
+		}
+		session.onlineFriends.Store(&onlineFriends)
+
+		return session
+	}
+
+	var placed []*SessionClient
+	place := func(session *SessionClient) *Room {
+		placed = append(placed, session)
+		return session.placeInRoom(roomId)
+	}
+	defer func() {
+		for _, session := range placed {
+			for _, room := range getRoomInstances(roomId) {
+				room.release(session)
+			}
+		}
+	}()
+
+	// fill the first instance so the next player opens another one
+	first := place(newSession(0))
+	place(newSession(0))
+	released := newSession(0)
+	place(released)
+
+	partyMember := newSession(7)
+	second := place(partyMember)
+	if second == first {
+		t.Fatal("placed in a full instance")
+	}
+
+	first.release(released)
+
+	if room := place(newSession(7)); room != second {
+		t.Errorf("party member placed in instance %d, want %d", room.instance, second.instance)
+	}
+	if room := place(newSession(0, partyMember.uuid)); room != second {
+		t.Errorf("friend placed in instance %d, want %d", room.instance, second.instance)
+	}
+	if room := place(newSession(0)); room != first {
+		t.Errorf("stranger placed in instance %d, want %d", room.instance, first.instance)
+	}
+}
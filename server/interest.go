@@ -0,0 +1,147 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+// interestPair is stored in Room.outOfRange while viewer can't see subject
+type interestPair struct {
+	viewer, subject *RoomClient
+}
+
+// broadcastNearby works like broadcast but only sends msg to clients within
+// the room's interest radius. Clients entering range get a snapshot of our
+// movement state and clients leaving range get a hide message, and the same
+// is done for us with every client whose range we enter or leave.
+func (c *RoomClient) broadcastNearby(msg []byte) {
+	if c.room.interestRadius == 0 {
+		c.broadcast(msg)
+		return
+	}
+
+	if c.session.banned {
+		return
+	}
+
+	// built once and shared by every recipient
+	m := newMessage(msg)
+
+	for _, client := range c.room.clients {
+		if client == c {
+			continue
+		}
+
+		inRange := c.isInInterestRange(client)
+
+		if client.canBroadcastTo(c) && !client.session.banned {
+			c.setInRange(client, inRange)
+		}
+
+		if !c.canBroadcastTo(client) {
+			continue
+		}
+
+		if !inRange {
+			client.setInRange(c, false)
+			continue
+		}
+
+		// the snapshot already has our current state
+		if client.setInRange(c, true) {
+			continue
+		}
+
+		client.outbox.sendMessage(m)
+	}
+
+	// spectators have no position so they see everyone
+	c.room.broadcastSpectators(c, m)
+}
+
+func (c *RoomClient) isInInterestRange(client *RoomClient) bool {
+	// clients that haven't moved yet don't have a position
+	if c.x == -1 || client.x == -1 {
+		return true
+	}
+
+	radius := c.room.interestRadius
+	dx, dy := getMapDistance(c.room.id, c.x, c.y, client.x, client.y)
+
+	return dx <= radius && dy <= radius
+}
+
+// setInRange updates whether c can see subject and returns true if
+// subject just entered range and a snapshot was sent
+func (c *RoomClient) setInRange(subject *RoomClient, inRange bool) bool {
+	pair := interestPair{viewer: c, subject: subject}
+
+	if c.room.outOfRange[pair] == !inRange {
+		return false
+	}
+
+	if !inRange {
+		c.room.outOfRange[pair] = true
+		c.outbox.send(buildMsg("h", subject.session.id, 1))
+		return false
+	}
+
+	delete(c.room.outOfRange, pair)
+	c.getMovementData(subject)
+
+	return true
+}
+
+// getMovementData is a subset of getPlayerData with everything
+// that may have changed while client was out of range
+func (c *RoomClient) getMovementData(client *RoomClient) {
+	if client.x != -1 {
+		c.outbox.send(buildMsg("m", client.session.id, client.x, client.y))
+	}
+	c.outbox.send(buildMsg("f", client.session.id, client.facing))
+	c.outbox.send(buildMsg("spd", client.session.id, client.speed))
+	c.outbox.send(buildMsg("h", client.session.id, client.hidden))
+}
+
+// clearInterest forgets every pair involving c, called when leaving a room
+func (c *RoomClient) clearInterest() {
+	for pair := range c.room.outOfRange {
+		if pair.viewer == c || pair.subject == c {
+			delete(c.room.outOfRange, pair)
+		}
+	}
+}
+
+// setInterestRadius changes the room's interest radius and shows everyone
+// to everyone again, the next moves hide whoever is out of the new range
+func (r *Room) setInterestRadius(radius int) {
+	if r.interestRadius == radius {
+		return
+	}
+
+	r.interestRadius = radius
+
+	for pair := range r.outOfRange {
+		pair.viewer.setInRange(pair.subject, true)
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
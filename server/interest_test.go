@@ -0,0 +1,150 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newInterestTestRoom returns a room without a goroutine holding
+// one client per position, so it can be used from the test directly
+func newInterestTestRoom(mapId int, radius int, positions ...[2]int) (*Room, []*RoomClient) {
+	room := &Room{
+		id:             mapId,
+		interestRadius: radius,
+		outOfRange:     make(map[interestPair]bool),
+	}
+
+	for i, position := range positions {
+		room.clients = append(room.clients, &RoomClient{
+			room:    room,
+			session: &SessionClient{id: i + 1, uuid: "interest" + strconv.Itoa(i)},
+			outbox:  newOutbox(func() {}),
+			x:       position[0],
+			y:       position[1],
+		})
+	}
+
+	return room, room.clients
+}
+
+func takeTestMsgTypes(o *Outbox) (msgTypes []string) {
+	for _, msg := range o.take() {
+		msgTypes = append(msgTypes, strings.Split(string(msg.msg), delim)[0])
+	}
+
+	return msgTypes
+}
+
+// moveTo moves c and returns the types of the messages viewer got from it
+func moveTo(c *RoomClient, x, y int, viewer *RoomClient) (msgTypes []string) {
+	c.x, c.y = x, y
+	c.broadcastNearby(buildMsg("m", c.session.id, x, y))
+
+	for _, msg := range viewer.outbox.take() {
+		msgFields := strings.Split(string(msg.msg), delim)
+		if msgFields[1] == strconv.Itoa(c.session.id) {
+			msgTypes = append(msgTypes, msgFields[0])
+		}
+	}
+
+	return msgTypes
+}
+
+func TestInterestRadius(t *testing.T) {
+	const radius = 3
+
+	_, clients := newInterestTestRoom(testRooms, radius, [2]int{10, 10}, [2]int{10, 10})
+	viewer, mover := clients[0], clients[1]
+
+	snapshot := []string{"m", "f", "spd", "h"}
+
+	tests := []struct {
+		name   string
+		x, y   int
+		viewer []string // messages the viewer gets from the mover
+		mover  []string // and the mover from the viewer
+	}{
+		{"on the boundary", 10 + radius, 10 - radius, []string{"m"}, nil},
+		{"past the boundary", 10 + radius + 1, 10, []string{"h"}, []string{"h"}},
+		{"still outside", 10 + radius + 2, 10 + radius + 2, nil, nil},
+		{"past the other boundary", 10, 10 - radius - 1, nil, nil},
+		{"back on the boundary", 10 - radius, 10 - radius, snapshot, snapshot},
+		{"inside", 10, 10, []string{"m"}, nil},
+	}
+
+	for _, test := range tests {
+		got := moveTo(mover, test.x, test.y, viewer)
+		if !slices.Equal(got, test.viewer) {
+			t.Errorf("%s: viewer got %q, want %q", test.name, got, test.viewer)
+		}
+
+		if gotMover := takeTestMsgTypes(mover.outbox); !slices.Equal(gotMover, test.mover) {
+			t.Errorf("%s: mover got %q, want %q", test.name, gotMover, test.mover)
+		}
+	}
+}
+
+func TestInterestRadiusLooping(t *testing.T) {
+	// 20 tiles wide, so 0 and 19 are next to each other
+	_, clients := newInterestTestRoom(testHorizontalMap, 3, [2]int{0, 5}, [2]int{10, 5})
+	viewer, mover := clients[0], clients[1]
+
+	if got := moveTo(mover, 17, 5, viewer); !slices.Equal(got, []string{"m"}) {
+		t.Errorf("across the edge got %q, want a move", got)
+	}
+	if got := moveTo(mover, 16, 5, viewer); !slices.Equal(got, []string{"h"}) {
+		t.Errorf("past the boundary across the edge got %q, want a hide", got)
+	}
+}
+
+func TestInterestRadiusUnplaced(t *testing.T) {
+	// clients that haven't moved yet have no position and see everyone
+	_, clients := newInterestTestRoom(testRooms, 3, [2]int{-1, -1}, [2]int{10, 10})
+	viewer, mover := clients[0], clients[1]
+
+	if got := moveTo(mover, 100, 100, viewer); !slices.Equal(got, []string{"m"}) {
+		t.Errorf("got %q, want a move", got)
+	}
+}
+
+func TestSetInterestRadius(t *testing.T) {
+	room, clients := newInterestTestRoom(testRooms, 3, [2]int{0, 0}, [2]int{0, 0})
+	viewer, mover := clients[0], clients[1]
+
+	moveTo(mover, 10, 10, viewer)
+	mover.outbox.take()
+
+	// a wider radius shows everyone hidden by the old one
+	room.setInterestRadius(20)
+
+	if len(room.outOfRange) != 0 {
+		t.Errorf("%d pairs still out of range", len(room.outOfRange))
+	}
+
+	if got := takeTestMsgTypes(viewer.outbox); !slices.Equal(got, []string{"m", "f", "spd", "h"}) {
+		t.Errorf("got %q, want a snapshot", got)
+	}
+
+	if got := moveTo(mover, 15, 15, viewer); !slices.Equal(got, []string{"m"}) {
+		t.Errorf("got %q, want a move", got)
+	}
+}
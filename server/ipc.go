@@ -18,15 +18,19 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/rpc"
 	"os"
+	"sync"
 	"time"
 )
 
+var rpcListener net.Listener
+
 // "Methods" can be defined on this actor which then can be called by sibling processes.
 type IPC struct{}
 
@@ -38,7 +42,7 @@ type TryBanArgs struct {
 }
 
 func (*IPC) TryBan(args TryBanArgs, _ *Void) error {
-	return banPlayerUnchecked(args.TargetUuid, false, args.Disconnect, args.Temporary, args.Broadcast)
+	return banPlayerUnchecked(context.Background(), args.TargetUuid, false, args.Disconnect, args.Temporary, args.Broadcast)
 }
 
 type TryMuteArgs struct {
@@ -47,7 +51,7 @@ type TryMuteArgs struct {
 }
 
 func (*IPC) TryMute(args TryMuteArgs, _ *Void) error {
-	return mutePlayerUnchecked(args.TargetUuid, false, args.Temporary, args.Broadcast)
+	return mutePlayerUnchecked(context.Background(), args.TargetUuid, false, args.Temporary, args.Broadcast)
 }
 
 type SendReportLogArgs struct {
@@ -73,113 +77,254 @@ func (*IPC) UpdateEventVmInfo(args Void, _ *Void) error {
 	return err
 }
 
+type ReloadReply struct {
+	Errors []string
+}
+
+func (*IPC) Reload(args Void, reply *ReloadReply) error {
+	reply.Errors = getErrorStrings(reloadGameData())
+	return nil
+}
+
+type InvalidatePlayerCacheArgs struct {
+	Uuid, Token string
+}
+
+// InvalidatePlayerCache is no longer sent, it is kept so servers that haven't been
+// updated yet can still reach this one during a rolling deploy. It can be removed
+// once every game server sends InvalidatePlayerCaches instead.
+func (*IPC) InvalidatePlayerCache(args InvalidatePlayerCacheArgs, _ *Void) error {
+	uncachePlayer(args.Uuid, args.Token)
+	return nil
+}
+
+type InvalidatePlayerCachesArgs struct {
+	Invalidations []InvalidatePlayerCacheArgs
+}
+
+func (*IPC) InvalidatePlayerCaches(args InvalidatePlayerCachesArgs, _ *Void) error {
+	for _, invalidation := range args.Invalidations {
+		uncachePlayer(invalidation.Uuid, invalidation.Token)
+	}
+	return nil
+}
+
 func banPlayerInGameUnchecked(game, uuid string, disconnect, temporary, broadcast bool) error {
-	if game == config.gameName {
-		return banPlayerUnchecked(uuid, true, disconnect, temporary, broadcast)
+	if game == getConfig().gameName {
+		return banPlayerUnchecked(context.Background(), uuid, true, disconnect, temporary, broadcast)
 	}
-	client, err := rpc.Dial("unix", fmt.Sprintf("/tmp/yno/%s.sck", game))
-	if err != nil {
-		return errors.Join(errors.New("could not dial rpc socket"), err)
+	return ipcCall(game, "IPC.TryBan", TryBanArgs{uuid, disconnect, temporary, broadcast}, new(Void), getConfig().ipc.deadline)
+}
+
+func mutePlayerInGameUnchecked(game, uuid string, temporary, broadcast bool) error {
+	if game == getConfig().gameName {
+		return mutePlayerUnchecked(context.Background(), uuid, true, temporary, broadcast)
 	}
+	return ipcCall(game, "IPC.TryMute", TryMuteArgs{uuid, temporary, broadcast}, new(Void), getConfig().ipc.deadline)
+}
 
-	defer client.Close()
-	call := client.Go("IPC.TryBan", TryBanArgs{uuid, disconnect, temporary, broadcast}, new(Void), make(chan *rpc.Call, 1))
-	select {
-	case <-call.Done:
-		return call.Error
-	case <-time.After(config.ipc.deadline):
-		return errors.New("banPlayerInGameUnchecked: timed out")
+func sendReportLog(uuid, ynoMsgId, originalMsg string) error {
+	if isMainServer {
+		return sendReportLogMainServer(uuid, ynoMsgId, originalMsg, getConfig().gameName)
 	}
+	return ipcCall(mainGameId, "IPC.SendReportLog", SendReportLogArgs{uuid, ynoMsgId, originalMsg, getConfig().gameName}, new(Void), getConfig().ipc.deadline)
 }
 
-func mutePlayerInGameUnchecked(game, uuid string, temporary, broadcast bool) error {
-	if game == config.gameName {
-		return mutePlayerUnchecked(uuid, true, temporary, broadcast)
+func scheduleModActionReversal(uuid string, action int, expiry time.Time) error {
+	if isMainServer {
+		return scheduleModActionReversalMainServer(uuid, action, expiry, false)
 	}
-	client, err := rpc.Dial("unix", fmt.Sprintf("/tmp/yno/%s.sck", game))
-	if err != nil {
-		return errors.Join(errors.New("could not dial rpc socket"), err)
+	return ipcCall(mainGameId, "IPC.ScheduleModActionReversal", ScheduleModActionReversalArgs{uuid, action, expiry}, new(Void), getConfig().ipc.deadline)
+}
+
+// reloadGameDataInGame asks the server for game to reload its game data
+// and returns what failed to load there
+func reloadGameDataInGame(game string) ([]string, error) {
+	reply := new(ReloadReply)
+	err := ipcCall(game, "IPC.Reload", Void{}, reply, reloadDeadline)
+
+	return reply.Errors, err
+}
+
+func notifyVmUpdated(gameId string) {
+	if !isMainServer {
+		return
 	}
 
-	defer client.Close()
-	call := client.Go("IPC.TryMute", TryMuteArgs{uuid, temporary, broadcast}, new(Void), nil)
-	select {
-	case <-call.Done:
-		return call.Error
-	case <-time.After(config.ipc.deadline):
-		return errors.New("mutePlayerInGameUnchecked: timed out")
+	if err := ipcCall(gameId, "IPC.UpdateEventVmInfo", Void{}, new(Void), getConfig().ipc.deadline); err != nil {
+		eprintf("VM", "error notifying %s: %s", gameId, err)
 	}
 }
 
-func sendReportLog(uuid, ynoMsgId, originalMsg string) error {
-	if isMainServer {
-		return sendReportLogMainServer(uuid, ynoMsgId, originalMsg, config.gameName)
+// invalidations queued while a batch is in flight, beyond this
+// everything is invalidated instead
+const maxPendingInvalidations = 1000
+
+// errors sending invalidations to a game are logged at most this often
+const invalidationErrorInterval = time.Minute
+
+var cacheInvalidators = struct {
+	games map[string]*CacheInvalidator
+	mutex sync.Mutex
+}{
+	games: make(map[string]*CacheInvalidator),
+}
+
+// CacheInvalidator sends the cache invalidations for one game server in
+// batches over a connection that is kept open until a call fails
+type CacheInvalidator struct {
+	game string
+
+	pending []InvalidatePlayerCacheArgs
+	ready   chan struct{}
+	mutex   sync.Mutex
+
+	// only used by run
+	client      *rpc.Client
+	lastError   time.Time
+	quietErrors int
+}
+
+// broadcastPlayerCacheInvalidation tells every other game server to drop
+// what it has cached for uuid or token, without waiting for them
+func broadcastPlayerCacheInvalidation(uuid, token string) {
+	for game := range gameIdToName {
+		if game == getConfig().gameName {
+			continue
+		}
+
+		getCacheInvalidator(game).queue(InvalidatePlayerCacheArgs{uuid, token})
 	}
-	client, err := rpc.Dial("unix", fmt.Sprintf("/tmp/yno/%s.sck", mainGameId))
-	if err != nil {
-		return errors.Join(errors.New("could not dial rpc socket"), err)
+}
+
+func getCacheInvalidator(game string) *CacheInvalidator {
+	cacheInvalidators.mutex.Lock()
+	defer cacheInvalidators.mutex.Unlock()
+
+	invalidator, ok := cacheInvalidators.games[game]
+	if !ok {
+		invalidator = &CacheInvalidator{game: game, ready: make(chan struct{}, 1)}
+		cacheInvalidators.games[game] = invalidator
+
+		go invalidator.run()
 	}
 
-	defer client.Close()
-	call := client.Go("IPC.SendReportLog", SendReportLogArgs{uuid, ynoMsgId, originalMsg, config.gameName}, new(Void), make(chan *rpc.Call, 1))
+	return invalidator
+}
+
+func (i *CacheInvalidator) queue(invalidation InvalidatePlayerCacheArgs) {
+	i.mutex.Lock()
+	if len(i.pending) < maxPendingInvalidations {
+		i.pending = append(i.pending, invalidation)
+	} else {
+		// an empty uuid and token drops everything
+		i.pending = append(i.pending[:0], InvalidatePlayerCacheArgs{})
+	}
+	i.mutex.Unlock()
+
 	select {
-	case <-call.Done:
-		return call.Error
-	case <-time.After(config.ipc.deadline):
-		return errors.New("mutePlayerInGameUnchecked: timed out")
+	case i.ready <- struct{}{}:
+	default:
 	}
 }
 
-func scheduleModActionReversal(uuid string, action int, expiry time.Time) error {
-	if isMainServer {
-		return scheduleModActionReversalMainServer(uuid, action, expiry, false)
+// run sends everything queued since the previous batch in one call
+func (i *CacheInvalidator) run() {
+	for range i.ready {
+		i.mutex.Lock()
+		batch := i.pending
+		i.pending = nil
+		i.mutex.Unlock()
+
+		if len(batch) == 0 {
+			continue
+		}
+
+		if err := i.send(batch); err != nil {
+			i.logError(err)
+		}
 	}
-	client, err := rpc.Dial("unix", fmt.Sprintf("/tmp/yno/%s.sck", mainGameId))
-	if err != nil {
-		return errors.Join(errors.New("could not dial rpc socket"), err)
+}
+
+func (i *CacheInvalidator) send(batch []InvalidatePlayerCacheArgs) error {
+	if i.client == nil {
+		client, err := dialIpc(i.game)
+		if err != nil {
+			return err
+		}
+		i.client = client
 	}
 
-	defer client.Close()
-	call := client.Go("IPC.ScheduleModActionReversal", ScheduleModActionReversalArgs{uuid, action, expiry}, new(Void), make(chan *rpc.Call, 1))
-	select {
-	case <-call.Done:
-		return call.Error
-	case <-time.After(config.ipc.deadline):
-		return errors.New("scheduleModActionReversal: timed out")
+	err := ipcCallClient(i.client, "IPC.InvalidatePlayerCaches", InvalidatePlayerCachesArgs{batch}, new(Void), getConfig().ipc.deadline)
+	if err != nil {
+		// the connection may be broken, so redial for the next batch
+		i.client.Close()
+		i.client = nil
 	}
+
+	return err
 }
 
-func notifyVmUpdated(gameId string) {
-	if !isMainServer {
+func (i *CacheInvalidator) logError(err error) {
+	if time.Since(i.lastError) < invalidationErrorInterval {
+		i.quietErrors++
 		return
 	}
 
-	client, err := rpc.Dial("unix", fmt.Sprintf("/tmp/yno/%s.sck", gameId))
+	if i.quietErrors != 0 {
+		eprintf("cache", "error notifying %s: %s (%d more since the last error)", i.game, err, i.quietErrors)
+	} else {
+		eprintf("cache", "error notifying %s: %s", i.game, err)
+	}
+
+	i.lastError = time.Now()
+	i.quietErrors = 0
+}
+
+// ipcCall calls method on the server for game and waits for it
+// up to deadline, recording how long it took for metrics
+func ipcCall(game string, method string, args any, reply any, deadline time.Duration) error {
+	client, err := dialIpc(game)
 	if err != nil {
-		eprintf("VM", "socket for %s not found", gameId)
-		return
+		return err
 	}
 
 	defer client.Close()
-	call := client.Go("IPC.UpdateEventVmInfo", Void{}, new(Void), make(chan *rpc.Call, 1))
+
+	return ipcCallClient(client, method, args, reply, deadline)
+}
+
+func dialIpc(game string) (*rpc.Client, error) {
+	client, err := rpc.Dial("unix", fmt.Sprintf("/tmp/yno/%s.sck", game))
+	if err != nil {
+		return nil, errors.Join(errors.New("could not dial rpc socket"), err)
+	}
+
+	return client, nil
+}
+
+// ipcCallClient is ipcCall over an open connection
+func ipcCallClient(client *rpc.Client, method string, args any, reply any, deadline time.Duration) error {
+	start := time.Now()
+	call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
 	select {
 	case <-call.Done:
-		if err := call.Error; err != nil {
-			eprintf("VM", "error notifying %s: %s", gameId, err)
-		}
-	case <-time.After(config.ipc.deadline):
-		eprintf("VM", "%s not responding to IPC", gameId)
+		metrics.ipcCalls.observe(method, time.Since(start))
+		return call.Error
+	case <-time.After(deadline):
+		metrics.ipcTimeouts.inc(method)
+		return fmt.Errorf("%s: timed out", method)
 	}
 }
 
 func initRpc() {
 	var err error
-	socketPath := fmt.Sprintf("/tmp/yno/%s.sck", config.gameName)
+	socketPath := fmt.Sprintf("/tmp/yno/%s.sck", getConfig().gameName)
 
 	os.MkdirAll("/tmp/yno", 0777)
 	os.Remove(socketPath)
 
-	socket, err := net.Listen("unix", socketPath)
+	rpcListener, err = net.Listen("unix", socketPath)
 	if err != nil {
 		log.Fatal("initRpc(listen):", err)
 	}
@@ -190,5 +335,5 @@ func initRpc() {
 
 	ipc := new(IPC)
 	rpc.Register(ipc)
-	go rpc.Accept(socket)
+	go rpc.Accept(rpcListener)
 }
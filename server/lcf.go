@@ -0,0 +1,297 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// minimal reader for the RPG Maker 2000/2003 LCF format used by
+// RPG_RT.ldb and MapXXXX.lmu, only reading what the server needs
+
+const (
+	lcfDatabaseChipsets = 0x14
+
+	lcfChipsetPassableLower = 0x04
+	lcfChipsetPassableUpper = 0x05
+
+	lcfMapChipsetId  = 0x01
+	lcfMapWidth      = 0x02
+	lcfMapHeight     = 0x03
+	lcfMapScrollType = 0x0B
+	lcfMapLowerLayer = 0x47
+	lcfMapUpperLayer = 0x48
+
+	// the largest map the editor can make
+	lcfMaxMapSize = 500
+)
+
+// passability flags
+const (
+	passDown  = 0x01
+	passLeft  = 0x02
+	passRight = 0x04
+	passUp    = 0x08
+	passAbove = 0x10 // star tile, drawn above the player and ignored for passability
+
+	passAll = passDown | passLeft | passRight | passUp
+)
+
+var errLcfTruncated = errors.New("truncated lcf data")
+
+type lcfChunk struct {
+	id   int
+	data []byte
+}
+
+type Chipset struct {
+	passableLower [162]byte
+	passableUpper [144]byte
+}
+
+// readLcfInt reads a BER compressed integer
+func readLcfInt(data []byte) (value int, n int, err error) {
+	for n < len(data) && n < 5 {
+		b := data[n]
+		n++
+
+		value = value<<7 | int(b&0x7F)
+		if b&0x80 == 0 {
+			return value, n, nil
+		}
+	}
+
+	return 0, 0, errLcfTruncated
+}
+
+// readLcfHeader skips the length prefixed file signature
+func readLcfHeader(data []byte, signature string) ([]byte, error) {
+	length, n, err := readLcfInt(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < n+length || string(data[n:n+length]) != signature {
+		return nil, errors.New("invalid lcf signature")
+	}
+
+	return data[n+length:], nil
+}
+
+// readLcfChunks reads chunks until the data ends or a zero chunk id
+func readLcfChunks(data []byte) (chunks []lcfChunk, rest []byte, err error) {
+	for len(data) != 0 {
+		id, n, err := readLcfInt(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = data[n:]
+
+		if id == 0 {
+			break
+		}
+
+		size, n, err := readLcfInt(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = data[n:]
+
+		if size > len(data) {
+			return nil, nil, errLcfTruncated
+		}
+
+		chunks = append(chunks, lcfChunk{id: id, data: data[:size]})
+		data = data[size:]
+	}
+
+	return chunks, data, nil
+}
+
+func readLcfChunkInt(chunk lcfChunk) int {
+	value, _, err := readLcfInt(chunk.data)
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+func parseChipsets(data []byte) (map[int]*Chipset, error) {
+	data, err := readLcfHeader(data, "LcfDataBase")
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, _, err := readLcfChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	chipsets := make(map[int]*Chipset)
+
+	for _, chunk := range chunks {
+		if chunk.id != lcfDatabaseChipsets {
+			continue
+		}
+
+		data := chunk.data
+
+		count, n, err := readLcfInt(data)
+		if err != nil {
+			return nil, err
+		}
+		data = data[n:]
+
+		for i := 0; i < count; i++ {
+			id, n, err := readLcfInt(data)
+			if err != nil {
+				return nil, err
+			}
+			data = data[n:]
+
+			var fields []lcfChunk
+			fields, data, err = readLcfChunks(data)
+			if err != nil {
+				return nil, err
+			}
+
+			chipset := &Chipset{}
+			for i := range chipset.passableLower {
+				chipset.passableLower[i] = passAll
+			}
+			for i := range chipset.passableUpper {
+				chipset.passableUpper[i] = passAll
+			}
+
+			for _, field := range fields {
+				switch field.id {
+				case lcfChipsetPassableLower:
+					copy(chipset.passableLower[:], field.data)
+				case lcfChipsetPassableUpper:
+					copy(chipset.passableUpper[:], field.data)
+				}
+			}
+
+			chipsets[id] = chipset
+		}
+	}
+
+	return chipsets, nil
+}
+
+func parseMap(data []byte, chipsets map[int]*Chipset) (*MapInfo, error) {
+	data, err := readLcfHeader(data, "LcfMapUnit")
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, _, err := readLcfChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// defaults used by the editor when a chunk is omitted
+	chipsetId := 1
+	mapInfo := &MapInfo{width: 20, height: 15}
+
+	var lowerLayer, upperLayer []byte
+
+	for _, chunk := range chunks {
+		switch chunk.id {
+		case lcfMapChipsetId:
+			chipsetId = readLcfChunkInt(chunk)
+		case lcfMapWidth:
+			mapInfo.width = readLcfChunkInt(chunk)
+		case lcfMapHeight:
+			mapInfo.height = readLcfChunkInt(chunk)
+		case lcfMapScrollType:
+			scrollType := readLcfChunkInt(chunk)
+			mapInfo.loopVertical = scrollType == 1 || scrollType == 3
+			mapInfo.loopHorizontal = scrollType == 2 || scrollType == 3
+		case lcfMapLowerLayer:
+			lowerLayer = chunk.data
+		case lcfMapUpperLayer:
+			upperLayer = chunk.data
+		}
+	}
+
+	if mapInfo.width < 1 || mapInfo.width > lcfMaxMapSize || mapInfo.height < 1 || mapInfo.height > lcfMaxMapSize {
+		return nil, fmt.Errorf("invalid map size %dx%d", mapInfo.width, mapInfo.height)
+	}
+
+	tiles := mapInfo.width * mapInfo.height
+
+	chipset, ok := chipsets[chipsetId]
+	if !ok || len(lowerLayer) < tiles*2 || len(upperLayer) < tiles*2 {
+		// dimensions are still useful without passability
+		return mapInfo, nil
+	}
+
+	mapInfo.impassable = make([]bool, tiles)
+
+	for i := 0; i < tiles; i++ {
+		lowerFlags := chipset.getLowerPassability(int(binary.LittleEndian.Uint16(lowerLayer[i*2:])))
+		upperFlags := chipset.getUpperPassability(int(binary.LittleEndian.Uint16(upperLayer[i*2:])))
+
+		if upperFlags&passAbove == 0 {
+			mapInfo.impassable[i] = upperFlags&passAll == 0
+			continue
+		}
+
+		mapInfo.impassable[i] = lowerFlags&passAll == 0
+	}
+
+	return mapInfo, nil
+}
+
+func (c *Chipset) getLowerPassability(tileId int) byte {
+	var index int
+
+	switch {
+	case tileId >= 10000:
+		return passAll
+	case tileId >= 5000: // regular tiles
+		index = tileId - 5000 + 18
+	case tileId >= 4000: // autotiles
+		index = (tileId-4000)/50 + 6
+	case tileId >= 3000: // animated tiles
+		index = (tileId-3000)/50 + 3
+	default: // water
+		index = tileId / 1000
+	}
+
+	if index >= len(c.passableLower) {
+		return passAll
+	}
+
+	return c.passableLower[index]
+}
+
+func (c *Chipset) getUpperPassability(tileId int) byte {
+	index := tileId - 10000
+
+	// the first upper tile is always empty
+	if index <= 0 || index >= len(c.passableUpper) {
+		return passAll | passAbove
+	}
+
+	return c.passableUpper[index]
+}
@@ -0,0 +1,234 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// lcfInt encodes value as a BER compressed integer
+func lcfInt(value int) []byte {
+	data := []byte{byte(value & 0x7F)}
+	for value >>= 7; value != 0; value >>= 7 {
+		data = append([]byte{byte(value&0x7F) | 0x80}, data...)
+	}
+
+	return data
+}
+
+func lcfChunkData(id int, data []byte) []byte {
+	return append(append(lcfInt(id), lcfInt(len(data))...), data...)
+}
+
+func lcfHeader(signature string) []byte {
+	return append(lcfInt(len(signature)), signature...)
+}
+
+func lcfTiles(tileIds ...int) []byte {
+	data := make([]byte, len(tileIds)*2)
+	for i, tileId := range tileIds {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(tileId))
+	}
+
+	return data
+}
+
+// testDatabase has chipset 1, where regular tile 5000 and upper tiles 10002
+// and 10003 are impassable, 10003 being a star tile
+func testDatabase() []byte {
+	lower := bytes.Repeat([]byte{passAll}, 162)
+	lower[18] = 0
+
+	upper := bytes.Repeat([]byte{passAll}, 144)
+	upper[2] = 0
+	upper[3] = passAbove
+
+	var chipset []byte
+	chipset = append(chipset, lcfInt(1)...)
+	chipset = append(chipset, lcfChunkData(lcfChipsetPassableLower, lower)...)
+	chipset = append(chipset, lcfChunkData(lcfChipsetPassableUpper, upper)...)
+	chipset = append(chipset, 0)
+
+	data := lcfHeader("LcfDataBase")
+	data = append(data, lcfChunkData(lcfDatabaseChipsets, append(lcfInt(1), chipset...))...)
+
+	return data
+}
+
+// testMap is a looping 3x2 map, see testMapImpassable
+func testMap() []byte {
+	data := lcfHeader("LcfMapUnit")
+	data = append(data, lcfChunkData(lcfMapChipsetId, lcfInt(1))...)
+	data = append(data, lcfChunkData(lcfMapWidth, lcfInt(3))...)
+	data = append(data, lcfChunkData(lcfMapHeight, lcfInt(2))...)
+	data = append(data, lcfChunkData(lcfMapScrollType, lcfInt(3))...)
+	data = append(data, lcfChunkData(lcfMapLowerLayer, lcfTiles(5001, 5000, 5000, 5001, 5000, 5001))...)
+	data = append(data, lcfChunkData(lcfMapUpperLayer, lcfTiles(10000, 10000, 10001, 10002, 10003, 10003))...)
+
+	return data
+}
+
+var testMapImpassable = []bool{
+	false, // passable lower tile
+	true,  // impassable lower tile
+	false, // passable upper tile over an impassable one
+	true,  // impassable upper tile
+	true,  // star tile over an impassable lower tile
+	false, // star tile over a passable lower tile
+}
+
+func TestReadLcfInt(t *testing.T) {
+	tests := []struct {
+		data  []byte
+		value int
+		n     int
+		err   bool
+	}{
+		{[]byte{0x00}, 0, 1, false},
+		{[]byte{0x7F, 0xFF}, 0x7F, 1, false},
+		{[]byte{0x81, 0x00}, 0x80, 2, false},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x7F}, 1<<35 - 1, 5, false},
+		{nil, 0, 0, true},
+		{[]byte{0x80}, 0, 0, true},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}, 0, 0, true},
+	}
+
+	for _, test := range tests {
+		value, n, err := readLcfInt(test.data)
+		if value != test.value || n != test.n || (err != nil) != test.err {
+			t.Errorf("%x: got %d, %d, %v, want %d, %d, error %t", test.data, value, n, err, test.value, test.n, test.err)
+		}
+	}
+}
+
+func TestParseMap(t *testing.T) {
+	chipsets, err := parseChipsets(testDatabase())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapInfo, err := parseMap(testMap(), chipsets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mapInfo.width != 3 || mapInfo.height != 2 || !mapInfo.loopHorizontal || !mapInfo.loopVertical {
+		t.Errorf("got %dx%d looping %t %t, want 3x2 looping both ways", mapInfo.width, mapInfo.height, mapInfo.loopHorizontal, mapInfo.loopVertical)
+	}
+
+	if len(mapInfo.impassable) != len(testMapImpassable) {
+		t.Fatalf("got %d tiles, want %d", len(mapInfo.impassable), len(testMapImpassable))
+	}
+	for i, want := range testMapImpassable {
+		if mapInfo.impassable[i] != want {
+			t.Errorf("tile %d impassable: %t, want %t", i, mapInfo.impassable[i], want)
+		}
+	}
+
+	// passability is left out rather than guessed without the chipset
+	mapInfo, err = parseMap(testMap(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapInfo.width != 3 || mapInfo.impassable != nil {
+		t.Errorf("got %d wide with passability %v without chipsets", mapInfo.width, mapInfo.impassable)
+	}
+}
+
+func TestParseMalformedLcf(t *testing.T) {
+	mapWithSize := func(width, height int) []byte {
+		data := lcfHeader("LcfMapUnit")
+		data = append(data, lcfChunkData(lcfMapWidth, lcfInt(width))...)
+		data = append(data, lcfChunkData(lcfMapHeight, lcfInt(height))...)
+		return data
+	}
+
+	validMap := testMap()
+
+	mapTests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"wrong signature", append(lcfHeader("LcfDataBase"), validMap[len(lcfHeader("LcfMapUnit")):]...)},
+		{"signature longer than the file", append(lcfInt(100), "LcfMapUnit"...)},
+		{"unterminated signature length", []byte{0x80}},
+		{"chunk larger than the file", append(lcfHeader("LcfMapUnit"), append(lcfInt(lcfMapWidth), lcfInt(1000)...)...)},
+		{"unterminated chunk id", append(lcfHeader("LcfMapUnit"), 0xFF)},
+		{"unterminated chunk size", append(lcfHeader("LcfMapUnit"), lcfMapWidth, 0xFF)},
+		{"zero width", mapWithSize(0, 15)},
+		{"zero height", mapWithSize(20, 0)},
+		{"too wide", mapWithSize(lcfMaxMapSize+1, 15)},
+		{"overflowing size", mapWithSize(1<<35-1, 1<<35-1)},
+	}
+
+	chipsets, err := parseChipsets(testDatabase())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range mapTests {
+		if _, err := parseMap(test.data, chipsets); err == nil {
+			t.Errorf("map %s: no error", test.name)
+		}
+	}
+
+	validDatabase := testDatabase()
+	header := len(lcfHeader("LcfDataBase"))
+
+	databaseTests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"wrong signature", append(lcfHeader("LcfMapUnit"), validDatabase[header:]...)},
+		{"missing chipsets", append(lcfHeader("LcfDataBase"), lcfChunkData(lcfDatabaseChipsets, lcfInt(2))...)},
+		{"unterminated chipset count", append(lcfHeader("LcfDataBase"), lcfChunkData(lcfDatabaseChipsets, []byte{0x80})...)},
+		{"truncated chipset", append(lcfHeader("LcfDataBase"), lcfChunkData(lcfDatabaseChipsets, append(lcfInt(1), lcfInt(1)[0], lcfChipsetPassableLower, 10))...)},
+	}
+
+	for _, test := range databaseTests {
+		if _, err := parseChipsets(test.data); err == nil {
+			t.Errorf("database %s: no error", test.name)
+		}
+	}
+}
+
+// TestParseTruncatedLcf cuts the files off at every byte,
+// which must never panic or give a map partial passability
+func TestParseTruncatedLcf(t *testing.T) {
+	database := testDatabase()
+	for i := range database {
+		parseChipsets(database[:i])
+	}
+
+	chipsets, err := parseChipsets(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := testMap()
+	for i := range data {
+		mapInfo, err := parseMap(data[:i], chipsets)
+		if err == nil && mapInfo.impassable != nil {
+			t.Errorf("map cut off after %d of %d bytes has passability", i, len(data))
+		}
+	}
+}
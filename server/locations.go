@@ -18,6 +18,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -107,14 +108,14 @@ func handleGameLocations(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(gameLocationsJson))
 }
 
-func getNext2kkiLocations(originLocationName string, destLocationName string) (PathLocations, error) {
+func getNext2kkiLocations(ctx context.Context, originLocationName string, destLocationName string) (PathLocations, error) {
 	var nextLocations PathLocations
 
 	v := make(url.Values)
 	v.Set("origin", originLocationName)
 	v.Set("dest", destLocationName)
 
-	response, err := query2kki("getNextLocations", v.Encode())
+	response, err := query2kki(ctx, "getNextLocations", v.Encode())
 	if err != nil {
 		return nextLocations, err
 	}
@@ -134,7 +135,7 @@ func updateLocationCache() {
 	continueKey := "0"
 
 	for continueKey != "" {
-		response, err := queryWiki("locations", fmt.Sprintf("continueKey=%s", continueKey))
+		response, err := queryWiki(context.Background(), "locations", fmt.Sprintf("continueKey=%s", continueKey))
 		if err != nil {
 			writeErrLog("SERVER", "Locations", err.Error())
 			return
@@ -155,22 +156,13 @@ func updateLocationCache() {
 
 	locationsMap := make(map[string]*Location)
 
-	results, err := db.Query("SELECT id, title, depth, minDepth, secret FROM gameLocations WHERE game = ?", config.gameName)
+	gameLocations, err := store.locations.getGameLocations(context.Background())
 	if err != nil {
 		writeErrLog("SERVER", "Locations", err.Error())
 		return
 	}
 
-	defer results.Close()
-
-	for results.Next() {
-		location := &Location{}
-		err = results.Scan(&location.Id, &location.Title, &location.Depth, &location.MinDepth, &location.Secret)
-		if err != nil {
-			writeErrLog("SERVER", "Locations", err.Error())
-			return
-		}
-
+	for _, location := range gameLocations {
 		locationsMap[location.Title] = location
 	}
 
@@ -189,7 +181,7 @@ func updateLocationCache() {
 
 	locationCache = locations
 
-	for _, eventLocation := range gameEventLocations[config.gameName] {
+	for _, eventLocation := range gameEventLocations[getConfig().gameName] {
 		eventLocation.syncdb = false
 	}
 }
@@ -199,14 +191,15 @@ func updateLocationPlayerCounts() {
 		delete(locationPlayerCounts, k)
 	}
 
-	for _, client := range clients.Get() {
+	clients.Range(func(client *SessionClient) bool {
 		if client.private || client.hideLocation || client.roomC == nil {
-			continue
+			return true
 		}
-		for _, locationId := range client.roomC.locationIds {
+		for _, locationId := range client.getRoomState().locationIds {
 			locationPlayerCounts[locationId]++
 		}
-	}
+		return true
+	})
 
 	playerCountsJson, err := json.Marshal(locationPlayerCounts)
 	if err != nil {
@@ -0,0 +1,129 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+)
+
+// levelOff disables a log category entirely
+const levelOff = slog.Level(math.MaxInt32)
+
+var logger = slog.Default()
+
+func initLogging(w io.Writer) {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug} // filtered per category by logEnabled
+
+	var handler slog.Handler
+	if getConfig().logging.format == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+
+	logger = slog.New(handler)
+
+	// route the standard logger through slog as well
+	slog.SetDefault(logger)
+}
+
+func parseLogLevel(str string) (slog.Level, error) {
+	if strings.EqualFold(str, "off") {
+		return levelOff, nil
+	}
+
+	var level slog.Level
+	err := level.UnmarshalText([]byte(str))
+
+	return level, err
+}
+
+func logEnabled(category string, level slog.Level) bool {
+	minLevel, ok := getConfig().logging.levels[category]
+	if !ok {
+		minLevel = getConfig().logging.level
+	}
+
+	return level >= minLevel
+}
+
+func getMsgLogCategory(msgType string) string {
+	switch msgType {
+	case "m", "tp", "jmp", "f", "spd":
+		return "movement"
+	}
+
+	return "messages"
+}
+
+// logMessage logs a processed client message with how long it took
+func logMessage(uuid string, location string, msgType string, payload string, latency time.Duration) {
+	category := getMsgLogCategory(msgType)
+	if !logEnabled(category, slog.LevelInfo) {
+		return
+	}
+
+	logger.LogAttrs(context.Background(), slog.LevelInfo, "message",
+		slog.String("category", category),
+		slog.String("uuid", uuid),
+		slog.String("map", location),
+		slog.String("type", msgType),
+		slog.String("payload", payload),
+		slog.Duration("latency", latency),
+	)
+}
+
+func writeLog(uuid string, location string, payload string, errorcode int) {
+	level := slog.LevelInfo
+	switch {
+	case errorcode >= 500:
+		level = slog.LevelError
+	case errorcode >= 400:
+		level = slog.LevelWarn
+	}
+
+	category := "session"
+	if uuid == "SERVER" {
+		category = strings.ToLower(location)
+	}
+
+	if !logEnabled(category, level) {
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("category", category)}
+	if uuid != "SERVER" {
+		attrs = append(attrs, slog.String("uuid", uuid), slog.String("map", location))
+	}
+
+	logger.LogAttrs(context.Background(), level, payload, attrs...)
+}
+
+func writeErrLog(uuid string, location string, payload string) {
+	writeLog(uuid, location, payload, 400)
+}
+
+func eprintf(category string, format string, args ...any) {
+	writeLog("SERVER", category, fmt.Sprintf(format, args...), 500)
+}
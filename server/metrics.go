@@ -0,0 +1,270 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-co-op/gocron"
+)
+
+// Metrics are served at /metrics in the Prometheus text format.
+// They're only written by hand since there are so few of them.
+
+// upper bounds of histogram buckets in seconds
+var latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var metrics = struct {
+	roomMessages      *counterVec
+	sessionMessages   *counterVec
+	dbQueries         *histogramVec
+	jobs              *histogramVec
+	ipcCalls          *histogramVec
+	ipcTimeouts       *counterVec
+	writeQueueWaits   *counterVec
+	writeQueueDrops   *counterVec
+	writeQueueFlushes *histogramVec
+	pushFailures      atomic.Uint64
+}{
+	roomMessages:      newCounterVec(),
+	sessionMessages:   newCounterVec(),
+	dbQueries:         newHistogramVec(latencyBuckets),
+	jobs:              newHistogramVec(latencyBuckets),
+	ipcCalls:          newHistogramVec(latencyBuckets),
+	ipcTimeouts:       newCounterVec(),
+	writeQueueWaits:   newCounterVec(),
+	writeQueueDrops:   newCounterVec(),
+	writeQueueFlushes: newHistogramVec(latencyBuckets),
+}
+
+// counterVec is a set of counters by label value
+type counterVec struct {
+	values map[string]uint64
+	mutex  sync.Mutex
+}
+
+func newCounterVec() *counterVec {
+	return &counterVec{values: make(map[string]uint64)}
+}
+
+func (v *counterVec) inc(label string) {
+	v.mutex.Lock()
+	v.values[label]++
+	v.mutex.Unlock()
+}
+
+// write writes every counter, labels is a format string for the label value
+func (v *counterVec) write(buf *bytes.Buffer, name string, labels string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	for _, label := range getSortedKeys(v.values) {
+		fmt.Fprintf(buf, "%s{%s} %d\n", name, fmt.Sprintf(labels, label), v.values[label])
+	}
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// histogramVec is a set of histograms by label value
+type histogramVec struct {
+	buckets    []float64
+	histograms map[string]*histogram
+	mutex      sync.Mutex
+}
+
+func newHistogramVec(buckets []float64) *histogramVec {
+	return &histogramVec{
+		buckets:    buckets,
+		histograms: make(map[string]*histogram),
+	}
+}
+
+func (v *histogramVec) observe(label string, duration time.Duration) {
+	seconds := duration.Seconds()
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	h, ok := v.histograms[label]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(v.buckets))}
+		v.histograms[label] = h
+	}
+
+	if i, _ := slices.BinarySearch(v.buckets, seconds); i < len(v.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// write writes every histogram, labels is a format string for the label value
+func (v *histogramVec) write(buf *bytes.Buffer, name string, labels string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	for _, label := range getSortedKeys(v.histograms) {
+		h := v.histograms[label]
+		labelStr := fmt.Sprintf(labels, label)
+
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(buf, "%s_bucket{%s,le=\"%s\"} %d\n", name, labelStr, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labelStr, h.count)
+		fmt.Fprintf(buf, "%s_sum{%s} %g\n", name, labelStr, h.sum)
+		fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labelStr, h.count)
+	}
+}
+
+func getSortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+// initJobMetrics times every job scheduled so far
+func initJobMetrics() {
+	var started sync.Map
+
+	scheduler.RegisterEventListeners(
+		gocron.BeforeJobRuns(func(jobName string) {
+			started.Store(jobName, time.Now())
+		}),
+		gocron.AfterJobRuns(func(jobName string) {
+			if start, ok := started.LoadAndDelete(jobName); ok {
+				metrics.jobs.observe(strings.TrimPrefix(jobName, "github.com/ynoproject/ynoserver/server."), time.Since(start.(time.Time)))
+			}
+		}),
+	)
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !canReadMetrics(r) {
+		http.Error(w, "403 - Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var buf bytes.Buffer
+
+	writeMetricHeader(&buf, "ynoserver_sessions", "gauge", "Connected sessions.")
+	fmt.Fprintf(&buf, "ynoserver_sessions{game=%q} %d\n", getConfig().gameName, clients.GetAmount())
+
+	writeMetricHeader(&buf, "ynoserver_room_clients", "gauge", "Clients placed in each room instance.")
+	roomInstances.mutex.Lock()
+	for _, roomId := range assets.maps {
+		for _, room := range roomInstances.instances[roomId] {
+			if len(room.members) == 0 {
+				continue
+			}
+
+			fmt.Fprintf(&buf, "ynoserver_room_clients{game=%q,room=\"%d\",instance=\"%d\"} %d\n", getConfig().gameName, room.id, room.instance, len(room.members))
+		}
+	}
+	roomInstances.mutex.Unlock()
+
+	writeMetricHeader(&buf, "ynoserver_messages_total", "counter", "Processed client messages by socket and type.")
+	metrics.roomMessages.write(&buf, "ynoserver_messages_total", `socket="room",type=%q`)
+	metrics.sessionMessages.write(&buf, "ynoserver_messages_total", `socket="session",type=%q`)
+
+	writeCounter(&buf, "ynoserver_outbox_coalesced_total", "Queued messages replaced by a newer one.", outboxStats.coalesced.Load())
+	writeCounter(&buf, "ynoserver_outbox_dropped_total", "Cosmetic messages dropped from full queues.", outboxStats.dropped.Load())
+	writeCounter(&buf, "ynoserver_outbox_slow_disconnects_total", "Clients disconnected for not keeping up with their queue.", outboxStats.slowDisconnects.Load())
+
+	writeCounter(&buf, "ynoserver_ws_compressed_messages_total", "WebSocket messages sent compressed.", compressionStats.messages.Load())
+	writeCounter(&buf, "ynoserver_ws_compressed_payload_bytes_total", "Payload bytes of compressed WebSocket messages before compression.", compressionStats.payloadBytes.Load())
+	writeCounter(&buf, "ynoserver_ws_compressed_wire_bytes_total", "Bytes compressed WebSocket messages took on the wire.", compressionStats.wireBytes.Load())
+
+	writeMetricHeader(&buf, "ynoserver_db_query_duration_seconds", "histogram", "Database call latency by operation.")
+	metrics.dbQueries.write(&buf, "ynoserver_db_query_duration_seconds", "op=%q")
+
+	writeMetricHeader(&buf, "ynoserver_job_duration_seconds", "histogram", "Scheduled job run time.")
+	metrics.jobs.write(&buf, "ynoserver_job_duration_seconds", "job=%q")
+
+	writeCounter(&buf, "ynoserver_push_notification_failures_total", "Push notifications that failed to send.", metrics.pushFailures.Load())
+
+	writeMetricHeader(&buf, "ynoserver_ipc_call_duration_seconds", "histogram", "IPC call latency by method.")
+	metrics.ipcCalls.write(&buf, "ynoserver_ipc_call_duration_seconds", "method=%q")
+
+	writeMetricHeader(&buf, "ynoserver_ipc_timeouts_total", "counter", "IPC calls that timed out by method.")
+	metrics.ipcTimeouts.write(&buf, "ynoserver_ipc_timeouts_total", "method=%q")
+
+	writeMetricHeader(&buf, "ynoserver_write_queue_flush_duration_seconds", "histogram", "Time taken to write a batch of queued rows by queue.")
+	metrics.writeQueueFlushes.write(&buf, "ynoserver_write_queue_flush_duration_seconds", "queue=%q")
+
+	writeMetricHeader(&buf, "ynoserver_write_queue_waits_total", "counter", "Writes that waited for room in a full queue by queue.")
+	metrics.writeQueueWaits.write(&buf, "ynoserver_write_queue_waits_total", "queue=%q")
+
+	writeMetricHeader(&buf, "ynoserver_write_queue_drops_total", "counter", "Writes dropped because a queue stayed full by queue.")
+	metrics.writeQueueDrops.write(&buf, "ynoserver_write_queue_drops_total", "queue=%q")
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+// canReadMetrics requires the metrics token if there is one,
+// otherwise it only allows requests from this machine
+func canReadMetrics(r *http.Request) bool {
+	if getConfig().metrics.token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && subtle.ConstantTimeCompare([]byte(token), []byte(getConfig().metrics.token)) == 1
+	}
+
+	var remoteAddr netip.Addr
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteAddr, _ = netip.ParseAddr(ip)
+	}
+
+	// requests through a reverse proxy are judged by the client address it forwarded,
+	// not by the proxy's own address, which is on this machine too
+	if (!remoteAddr.IsValid() || isTrustedProxy(remoteAddr)) && r.Header.Get("x-forwarded-for") == "" {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(getIp(r))
+	return err == nil && addr.IsLoopback()
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name string, metricType string, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func writeCounter(buf *bytes.Buffer, name string, help string, value uint64) {
+	writeMetricHeader(buf, name, "counter", help)
+	fmt.Fprintf(buf, "%s %d\n", name, value)
+}
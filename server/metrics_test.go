@@ -0,0 +1,69 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanReadMetrics(t *testing.T) {
+	prevConfig := getConfig()
+	t.Cleanup(func() { currentConfig.Store(prevConfig) })
+
+	tests := []struct {
+		name          string
+		token         string
+		remoteAddr    string
+		forwardedFor  string
+		authorization string
+		want          bool
+	}{
+		{"token", "secret", "203.0.113.1:1234", "", "Bearer secret", true},
+		{"wrong token", "secret", "203.0.113.1:1234", "", "Bearer wrong", false},
+		{"loopback without the token", "secret", "[::1]:1234", "", "", false},
+		{"loopback", "", "[::1]:1234", "", "", true},
+		{"remote", "", "203.0.113.1:1234", "", "", false},
+		{"remote claiming loopback", "", "203.0.113.1:1234", "127.0.0.1", "", false},
+		{"unix socket without x-forwarded-for", "", "@", "", "", false},
+		{"unix socket forwarding loopback", "", "@", "127.0.0.1", "", true},
+		{"unix socket forwarding remote", "", "@", "203.0.113.1", "", false},
+		{"unix socket forwarding spoofed loopback", "", "@", "127.0.0.1, 203.0.113.1", "", false},
+		{"trusted proxy without x-forwarded-for", "", "127.0.0.1:1234", "", "", false},
+		{"trusted proxy forwarding remote", "", "127.0.0.1:1234", "203.0.113.1", "", false},
+	}
+
+	for _, test := range tests {
+		config := *prevConfig
+		config.metrics.token = test.token
+		currentConfig.Store(&config)
+
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+		if test.authorization != "" {
+			r.Header.Set("Authorization", test.authorization)
+		}
+
+		if got := canReadMetrics(r); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Migrations are named <version>_<name>.sql and applied in version order.
+// Statements are separated by a semicolon at the end of a line.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const migrationLockName = "ynoserver_migrations"
+
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string
+}
+
+func getMigrations() (migrations []*Migration, err error) {
+	files, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		versionStr, name, ok := strings.Cut(strings.TrimSuffix(file.Name(), ".sql"), "_")
+		if !ok {
+			return nil, errors.New("invalid migration file name: " + file.Name())
+		}
+
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, errors.New("invalid migration version: " + file.Name())
+		}
+
+		contents, err := migrationFiles.ReadFile("migrations/" + file.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, &Migration{
+			Version:    version,
+			Name:       name,
+			Statements: splitMigrationStatements(string(contents)),
+		})
+	}
+
+	slices.SortFunc(migrations, func(a, b *Migration) int {
+		return a.Version - b.Version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+func splitMigrationStatements(contents string) (statements []string) {
+	var statement strings.Builder
+
+	for _, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		statement.WriteString(line)
+		statement.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(statement.String()))
+			statement.Reset()
+		}
+	}
+
+	if rest := strings.TrimSpace(statement.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
+
+// migrateDatabase applies every migration not yet recorded in schemaMigrations
+func migrateDatabase() error {
+	migrations, err := getMigrations()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	// locks are per connection, so everything runs on this one
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// every game server shares the database, only one of them may migrate at a time
+	var locked int
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", migrationLockName).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if locked != 1 {
+		return errors.New("timed out waiting for the migration lock")
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", migrationLockName)
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schemaMigrations (version INT NOT NULL, name VARCHAR(255) NOT NULL, timestampApplied DATETIME NOT NULL, PRIMARY KEY (version))")
+	if err != nil {
+		return err
+	}
+
+	results, err := conn.QueryContext(ctx, "SELECT version FROM schemaMigrations")
+	if err != nil {
+		return err
+	}
+
+	var appliedVersions []int
+	for results.Next() {
+		var version int
+		if err := results.Scan(&version); err != nil {
+			results.Close()
+			return err
+		}
+		appliedVersions = append(appliedVersions, version)
+	}
+	results.Close()
+
+	for _, migration := range migrations {
+		if slices.Contains(appliedVersions, migration.Version) {
+			continue
+		}
+
+		fmt.Printf("Applying migration %d (%s)...\n", migration.Version, migration.Name)
+
+		// MySQL commits schema changes implicitly, so a failed migration has to be fixed by hand
+		for i, statement := range migration.Statements {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("migration %d (%s) statement %d: %w", migration.Version, migration.Name, i+1, err)
+			}
+		}
+
+		_, err = conn.ExecContext(ctx, "INSERT INTO schemaMigrations (version, name, timestampApplied) VALUES (?, ?, UTC_TIMESTAMP())", migration.Version, migration.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,379 @@
+-- Schema as it existed before migrations were tracked.
+-- Every statement is IF NOT EXISTS so existing databases are adopted as-is.
+
+CREATE TABLE IF NOT EXISTS players (
+	uuid VARCHAR(16) NOT NULL,
+	ip VARCHAR(45) NULL,
+	`rank` INT NOT NULL DEFAULT 0,
+	banned BOOLEAN NOT NULL DEFAULT 0,
+	muted BOOLEAN NOT NULL DEFAULT 0,
+	PRIMARY KEY (uuid),
+	KEY (ip)
+);
+
+CREATE TABLE IF NOT EXISTS accounts (
+	uuid VARCHAR(16) NOT NULL,
+	user VARCHAR(12) NOT NULL,
+	pass VARCHAR(60) NOT NULL,
+	ip VARCHAR(45) NULL,
+	timestampRegistered DATETIME NOT NULL,
+	timestampLoggedIn DATETIME NULL,
+	inactive BOOLEAN NOT NULL DEFAULT 0,
+	badge VARCHAR(32) NOT NULL DEFAULT 'null',
+	badgeSlotRows INT NOT NULL DEFAULT 1,
+	badgeSlotCols INT NOT NULL DEFAULT 3,
+	screenshotLimit INT NOT NULL DEFAULT 10,
+	PRIMARY KEY (uuid),
+	UNIQUE KEY (user),
+	KEY (ip),
+	FOREIGN KEY (uuid) REFERENCES players (uuid)
+);
+
+CREATE TABLE IF NOT EXISTS playerSessions (
+	sessionId VARCHAR(32) NOT NULL,
+	uuid VARCHAR(16) NOT NULL,
+	expiration DATETIME NOT NULL,
+	PRIMARY KEY (sessionId),
+	KEY (uuid),
+	FOREIGN KEY (uuid) REFERENCES accounts (uuid) ON DELETE CASCADE
+);
+
+-- guests are only cleaned up while nothing references them
+CREATE TABLE IF NOT EXISTS playerGameData (
+	uuid VARCHAR(16) NOT NULL,
+	game VARCHAR(16) NOT NULL,
+	name VARCHAR(12) NOT NULL DEFAULT '',
+	systemName VARCHAR(255) NOT NULL DEFAULT '',
+	spriteName VARCHAR(255) NOT NULL DEFAULT '',
+	spriteIndex INT NOT NULL DEFAULT 0,
+	online BOOLEAN NOT NULL DEFAULT 0,
+	timestampLastActive DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	medalCountBronze INT NOT NULL DEFAULT 0,
+	medalCountSilver INT NOT NULL DEFAULT 0,
+	medalCountGold INT NOT NULL DEFAULT 0,
+	medalCountPlatinum INT NOT NULL DEFAULT 0,
+	medalCountDiamond INT NOT NULL DEFAULT 0,
+	lastGlobalMsgId VARCHAR(12) NULL,
+	lastPartyMsgId VARCHAR(12) NULL,
+	PRIMARY KEY (uuid, game),
+	KEY (game, online),
+	FOREIGN KEY (uuid) REFERENCES players (uuid)
+);
+
+CREATE TABLE IF NOT EXISTS playerBlocks (
+	uuid VARCHAR(16) NOT NULL,
+	targetUuid VARCHAR(16) NOT NULL,
+	timestamp DATETIME NOT NULL,
+	PRIMARY KEY (uuid, targetUuid)
+);
+
+CREATE TABLE IF NOT EXISTS playerFriends (
+	uuid VARCHAR(16) NOT NULL,
+	targetUuid VARCHAR(16) NOT NULL,
+	accepted BOOLEAN NOT NULL DEFAULT 0,
+	PRIMARY KEY (uuid, targetUuid),
+	KEY (targetUuid)
+);
+
+CREATE TABLE IF NOT EXISTS playerTags (
+	uuid VARCHAR(16) NOT NULL,
+	name VARCHAR(64) NOT NULL,
+	timestampUnlocked DATETIME NOT NULL,
+	PRIMARY KEY (uuid, name)
+);
+
+CREATE TABLE IF NOT EXISTS playerTimeTrials (
+	uuid VARCHAR(16) NOT NULL,
+	mapId INT NOT NULL,
+	seconds INT NOT NULL,
+	timestampCompleted DATETIME NOT NULL,
+	PRIMARY KEY (uuid, mapId)
+);
+
+CREATE TABLE IF NOT EXISTS playerMinigameScores (
+	uuid VARCHAR(16) NOT NULL,
+	game VARCHAR(16) NOT NULL,
+	minigameId VARCHAR(64) NOT NULL,
+	score INT NOT NULL,
+	timestampCompleted DATETIME NOT NULL,
+	PRIMARY KEY (uuid, game, minigameId),
+	KEY (uuid, minigameId)
+);
+
+CREATE TABLE IF NOT EXISTS parties (
+	id INT NOT NULL AUTO_INCREMENT,
+	game VARCHAR(16) NOT NULL,
+	owner VARCHAR(16) NULL,
+	name VARCHAR(255) NOT NULL,
+	public BOOLEAN NOT NULL DEFAULT 0,
+	pass VARCHAR(255) NOT NULL DEFAULT '',
+	theme VARCHAR(255) NOT NULL DEFAULT '',
+	description TEXT NOT NULL,
+	PRIMARY KEY (id),
+	KEY (game)
+);
+
+CREATE TABLE IF NOT EXISTS partyMembers (
+	id INT NOT NULL AUTO_INCREMENT,
+	partyId INT NOT NULL,
+	uuid VARCHAR(16) NOT NULL,
+	PRIMARY KEY (id),
+	KEY (uuid),
+	FOREIGN KEY (partyId) REFERENCES parties (id)
+);
+
+CREATE TABLE IF NOT EXISTS chatMessages (
+	msgId VARCHAR(12) NOT NULL,
+	game VARCHAR(16) NOT NULL,
+	uuid VARCHAR(16) NOT NULL,
+	mapId CHAR(4) NOT NULL,
+	prevMapId CHAR(4) NOT NULL,
+	prevLocations TEXT NOT NULL,
+	x INT NOT NULL,
+	y INT NOT NULL,
+	contents TEXT NOT NULL,
+	partyId INT NULL,
+	timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (msgId),
+	KEY (game, partyId, timestamp),
+	KEY (uuid)
+);
+
+CREATE TABLE IF NOT EXISTS badges (
+	badgeId VARCHAR(32) NOT NULL,
+	game VARCHAR(16) NOT NULL,
+	bp INT NOT NULL DEFAULT 0,
+	hidden BOOLEAN NOT NULL DEFAULT 0,
+	percentUnlocked FLOAT NOT NULL DEFAULT 0,
+	PRIMARY KEY (badgeId)
+);
+
+CREATE TABLE IF NOT EXISTS playerBadges (
+	uuid VARCHAR(16) NOT NULL,
+	badgeId VARCHAR(32) NOT NULL,
+	timestampUnlocked DATETIME NOT NULL,
+	slotRow INT NOT NULL DEFAULT 0,
+	slotCol INT NOT NULL DEFAULT 0,
+	PRIMARY KEY (uuid, badgeId),
+	KEY (badgeId)
+);
+
+CREATE TABLE IF NOT EXISTS playerBadgePresets (
+	uuid VARCHAR(16) NOT NULL,
+	presetId INT NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (uuid, presetId)
+);
+
+CREATE TABLE IF NOT EXISTS gameLocations (
+	id INT NOT NULL AUTO_INCREMENT,
+	game VARCHAR(16) NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	titleJP VARCHAR(255) NULL,
+	depth INT NOT NULL DEFAULT 0,
+	minDepth INT NOT NULL DEFAULT 0,
+	mapIds JSON NULL,
+	secret BOOLEAN NOT NULL DEFAULT 0,
+	PRIMARY KEY (id),
+	UNIQUE KEY (game, title)
+);
+
+CREATE TABLE IF NOT EXISTS playerGameLocations (
+	uuid VARCHAR(16) NOT NULL,
+	locationId INT NOT NULL,
+	timestamp DATETIME NOT NULL,
+	PRIMARY KEY (uuid, locationId),
+	FOREIGN KEY (locationId) REFERENCES gameLocations (id)
+);
+
+CREATE TABLE IF NOT EXISTS eventPeriods (
+	id INT NOT NULL AUTO_INCREMENT,
+	periodOrdinal INT NOT NULL,
+	startDate DATE NOT NULL,
+	endDate DATE NOT NULL,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS gameEventPeriods (
+	id INT NOT NULL AUTO_INCREMENT,
+	periodId INT NOT NULL,
+	game VARCHAR(16) NOT NULL,
+	enableVms BOOLEAN NOT NULL DEFAULT 0,
+	PRIMARY KEY (id),
+	UNIQUE KEY (periodId, game),
+	FOREIGN KEY (periodId) REFERENCES eventPeriods (id)
+);
+
+CREATE TABLE IF NOT EXISTS gamePlayerCounts (
+	id INT NOT NULL AUTO_INCREMENT,
+	game VARCHAR(16) NOT NULL,
+	playerCount INT NOT NULL,
+	PRIMARY KEY (id),
+	KEY (game)
+);
+
+CREATE TABLE IF NOT EXISTS eventLocations (
+	id INT NOT NULL AUTO_INCREMENT,
+	locationId INT NOT NULL,
+	gamePeriodId INT NOT NULL,
+	type INT NOT NULL,
+	exp INT NOT NULL,
+	startDate DATE NOT NULL,
+	endDate DATE NOT NULL,
+	PRIMARY KEY (id),
+	KEY (gamePeriodId, startDate),
+	FOREIGN KEY (locationId) REFERENCES gameLocations (id),
+	FOREIGN KEY (gamePeriodId) REFERENCES gameEventPeriods (id)
+);
+
+CREATE TABLE IF NOT EXISTS playerEventLocations (
+	id INT NOT NULL AUTO_INCREMENT,
+	locationId INT NOT NULL,
+	gamePeriodId INT NOT NULL,
+	uuid VARCHAR(16) NOT NULL,
+	startDate DATE NOT NULL,
+	endDate DATE NOT NULL,
+	PRIMARY KEY (id),
+	KEY (uuid, gamePeriodId),
+	FOREIGN KEY (locationId) REFERENCES gameLocations (id),
+	FOREIGN KEY (gamePeriodId) REFERENCES gameEventPeriods (id)
+);
+
+CREATE TABLE IF NOT EXISTS playerEventLocationQueue (
+	game VARCHAR(16) NOT NULL,
+	date DATE NOT NULL,
+	queueIndex INT NOT NULL,
+	locationId INT NOT NULL,
+	PRIMARY KEY (game, date, queueIndex),
+	FOREIGN KEY (locationId) REFERENCES gameLocations (id)
+);
+
+CREATE TABLE IF NOT EXISTS eventVms (
+	id INT NOT NULL AUTO_INCREMENT,
+	gamePeriodId INT NOT NULL,
+	mapId INT NOT NULL,
+	eventIds JSON NOT NULL,
+	exp INT NOT NULL,
+	startDate DATE NOT NULL,
+	endDate DATE NOT NULL,
+	PRIMARY KEY (id),
+	KEY (gamePeriodId, startDate),
+	FOREIGN KEY (gamePeriodId) REFERENCES gameEventPeriods (id)
+);
+
+-- eventId points into eventLocations, playerEventLocations or eventVms depending on type
+CREATE TABLE IF NOT EXISTS eventCompletions (
+	eventId INT NOT NULL,
+	uuid VARCHAR(16) NOT NULL,
+	type INT NOT NULL,
+	timestampCompleted DATETIME NOT NULL,
+	exp INT NOT NULL DEFAULT 0,
+	PRIMARY KEY (eventId, uuid, type),
+	KEY (uuid, type)
+);
+
+CREATE TABLE IF NOT EXISTS playerScreenshots (
+	id VARCHAR(32) NOT NULL,
+	uuid VARCHAR(16) NOT NULL,
+	game VARCHAR(16) NOT NULL,
+	mapId CHAR(4) NOT NULL,
+	mapX INT NOT NULL,
+	mapY INT NOT NULL,
+	public BOOLEAN NOT NULL DEFAULT 0,
+	publicTimestamp DATETIME NULL,
+	temp BOOLEAN NOT NULL DEFAULT 0,
+	spoiler BOOLEAN NOT NULL DEFAULT 0,
+	timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id),
+	KEY (uuid, temp),
+	KEY (public, publicTimestamp)
+);
+
+CREATE TABLE IF NOT EXISTS playerScreenshotLikes (
+	screenshotId VARCHAR(32) NOT NULL,
+	uuid VARCHAR(16) NOT NULL,
+	timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (screenshotId, uuid),
+	FOREIGN KEY (screenshotId) REFERENCES playerScreenshots (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS schedules (
+	id INT NOT NULL AUTO_INCREMENT,
+	name VARCHAR(255) NOT NULL,
+	description TEXT NOT NULL,
+	ownerUuid VARCHAR(16) NOT NULL,
+	partyId INT NULL,
+	game VARCHAR(16) NOT NULL,
+	official BOOLEAN NOT NULL DEFAULT 0,
+	recurring BOOLEAN NOT NULL DEFAULT 0,
+	intervalValue INT NOT NULL DEFAULT 0,
+	intervalType VARCHAR(8) NOT NULL DEFAULT '',
+	datetime DATETIME NOT NULL,
+	systemName VARCHAR(255) NOT NULL DEFAULT '',
+	discord VARCHAR(255) NOT NULL DEFAULT '',
+	youtube VARCHAR(255) NOT NULL DEFAULT '',
+	twitch VARCHAR(255) NOT NULL DEFAULT '',
+	niconico VARCHAR(255) NOT NULL DEFAULT '',
+	openrec VARCHAR(255) NOT NULL DEFAULT '',
+	bilibili VARCHAR(255) NOT NULL DEFAULT '',
+	PRIMARY KEY (id),
+	KEY (game, datetime)
+);
+
+CREATE TABLE IF NOT EXISTS playerScheduleFollows (
+	uuid VARCHAR(16) NOT NULL,
+	scheduleId INT NOT NULL,
+	PRIMARY KEY (uuid, scheduleId),
+	KEY (scheduleId),
+	FOREIGN KEY (scheduleId) REFERENCES schedules (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS pushSubscriptions (
+	uuid VARCHAR(16) NOT NULL,
+	endpoint VARCHAR(512) NOT NULL,
+	p256dh VARCHAR(255) NOT NULL,
+	auth VARCHAR(255) NOT NULL,
+	PRIMARY KEY (uuid, endpoint)
+);
+
+CREATE TABLE IF NOT EXISTS playerReports (
+	uuid VARCHAR(16) NOT NULL,
+	targetUuid VARCHAR(16) NOT NULL,
+	msgId VARCHAR(12) NULL,
+	game VARCHAR(16) NOT NULL,
+	reason VARCHAR(255) NOT NULL,
+	originalMsg TEXT NULL,
+	timestampReported DATETIME NOT NULL,
+	actionTaken BOOLEAN NOT NULL DEFAULT 0,
+	UNIQUE KEY (uuid, targetUuid, msgId),
+	KEY (targetUuid)
+);
+
+CREATE TABLE IF NOT EXISTS playerModerationActions (
+	id INT NOT NULL AUTO_INCREMENT,
+	uuid VARCHAR(16) NOT NULL,
+	action INT NOT NULL,
+	reason TEXT NOT NULL,
+	time DATETIME NOT NULL,
+	expiry DATETIME NOT NULL,
+	PRIMARY KEY (id),
+	KEY (uuid, action),
+	KEY (expiry)
+);
+
+CREATE TABLE IF NOT EXISTS 2kkiApiQueries (
+	action VARCHAR(64) NOT NULL,
+	query VARCHAR(512) NOT NULL,
+	response MEDIUMTEXT NOT NULL,
+	timestampExpired DATETIME NOT NULL,
+	PRIMARY KEY (action, query)
+);
+
+CREATE TABLE IF NOT EXISTS wikiApiQueries (
+	game VARCHAR(16) NOT NULL,
+	action VARCHAR(64) NOT NULL,
+	query VARCHAR(512) NOT NULL,
+	response MEDIUMTEXT NOT NULL,
+	timestampExpired DATETIME NOT NULL,
+	PRIMARY KEY (game, action, query)
+);
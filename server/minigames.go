@@ -18,8 +18,8 @@
 package server
 
 import (
+	"context"
 	"database/sql"
-	"time"
 )
 
 type Minigame struct {
@@ -32,7 +32,7 @@ type Minigame struct {
 }
 
 func getRoomMinigames(roomId int) (minigames []*Minigame) {
-	switch config.gameName {
+	switch getConfig().gameName {
 	case "yume":
 		if roomId == 155 {
 			minigames = append(minigames, &Minigame{Id: "nasu", VarId: 88, SwitchId: 215})
@@ -67,8 +67,69 @@ func getRoomMinigames(roomId int) (minigames []*Minigame) {
 	return minigames
 }
 
-func getPlayerMinigameScore(playerUuid string, minigameId string) (score int, err error) {
-	err = db.QueryRow("SELECT score FROM playerMinigameScores WHERE uuid = ? AND minigameId = ?", playerUuid, minigameId).Scan(&score)
+// loadMinigameScores reads the client's scores for the minigames in room off the
+// room's goroutine and asks the client for the current values once they're in
+func (c *RoomClient) loadMinigameScores(room *Room) {
+	uuid, mapId, rank := c.session.uuid, c.mapId, c.session.rank
+
+	go func() {
+		scores := make([]int, len(room.minigames))
+		for m, minigame := range room.minigames {
+			if minigame.Dev && rank < 1 {
+				continue
+			}
+			score, err := getPlayerMinigameScore(c.getCtx(), uuid, minigame.Id)
+			if err != nil {
+				writeErrLog(uuid, mapId, "failed to read player minigame score for "+minigame.Id)
+			}
+			scores[m] = score
+		}
+
+		room.exec(func() {
+			// the client may have switched rooms since
+			if c.getRoom() != room {
+				return
+			}
+
+			c.minigameScores = scores
+
+			for _, minigame := range room.minigames {
+				if minigame.Dev && rank < 1 {
+					continue
+				}
+				varSyncType := 1
+				if minigame.InitialVarSync {
+					varSyncType = 2
+				}
+				c.outbox.send(buildMsg("sv", minigame.VarId, varSyncType))
+			}
+		})
+	}()
+}
+
+// getMinigameScore returns the client's best score for the room's minigame m,
+// 0 until loadMinigameScores is done
+func (c *RoomClient) getMinigameScore(m int) int {
+	if m >= len(c.minigameScores) {
+		return 0
+	}
+
+	return c.minigameScores[m]
+}
+
+// writeMinigameScore records the client's minigame score off the room's goroutine
+func (c *RoomClient) writeMinigameScore(minigameId string, score int) {
+	uuid, mapId := c.session.uuid, c.mapId
+
+	go func() {
+		if _, err := tryWritePlayerMinigameScore(c.getCtx(), uuid, minigameId, score); err != nil {
+			writeErrLog(uuid, mapId, err.Error())
+		}
+	}()
+}
+
+func getPlayerMinigameScore(ctx context.Context, playerUuid string, minigameId string) (score int, err error) {
+	score, err = store.records.getPlayerMinigameScore(ctx, playerUuid, minigameId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, nil
@@ -79,28 +140,10 @@ func getPlayerMinigameScore(playerUuid string, minigameId string) (score int, er
 	return score, nil
 }
 
-func tryWritePlayerMinigameScore(playerUuid string, minigameId string, score int) (success bool, err error) {
+func tryWritePlayerMinigameScore(ctx context.Context, playerUuid string, minigameId string, score int) (success bool, err error) {
 	if score <= 0 {
 		return false, nil
 	}
 
-	prevScore, err := getPlayerMinigameScore(playerUuid, minigameId)
-	if err != nil {
-		return false, err
-	} else if score <= prevScore {
-		return false, nil
-	} else if prevScore > 0 {
-		_, err = db.Exec("UPDATE playerMinigameScores SET score = ?, timestampCompleted = ? WHERE uuid = ? AND game = ? AND minigameId = ?", score, time.Now(), playerUuid, config.gameName, minigameId)
-		if err != nil {
-			return false, err
-		}
-		return true, nil
-	}
-
-	_, err = db.Exec("INSERT INTO playerMinigameScores (uuid, game, minigameId, score, timestampCompleted) VALUES (?, ?, ?, ?, ?)", playerUuid, config.gameName, minigameId, score, time.Now())
-	if err != nil {
-		return false, err
-	}
-
-	return true, nil
+	return store.records.writePlayerMinigameScore(ctx, playerUuid, minigameId, score)
 }
@@ -0,0 +1,163 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	maxSuspiciousActivity = 1000
+
+	// how many tiles a client may move at once without being flagged,
+	// messages are often batched so moves don't arrive evenly spaced
+	moveBurst = 6
+	// leeway for frame drops and timer inaccuracy
+	moveTolerance = 1.5
+	// jumps further than this are flagged
+	maxJumpDistance = 10
+	// a client is flagged at most once in this period
+	suspiciousActivityCooldown = 10 * time.Second
+)
+
+type SuspiciousActivity struct {
+	Time   time.Time `json:"time"`
+	Uuid   string    `json:"uuid"`
+	MapId  string    `json:"mapId"`
+	Type   string    `json:"type"`
+	Detail string    `json:"detail"`
+}
+
+var suspiciousActivity = struct {
+	entries []SuspiciousActivity
+	mutex   sync.Mutex
+}{}
+
+// getTilesPerSecond returns how fast a character moves at speed,
+// at 60 frames per second a step of 2^(speed+1) 256ths of a tile
+func getTilesPerSecond(speed int) float64 {
+	if speed < 4 {
+		speed = 4 // the default speed, clients only send spd when it changes
+	}
+
+	return 60 * float64(int(1)<<(speed+1)) / 256
+}
+
+// checkMove flags moves faster than the client's speed allows
+// and moves onto tiles that can't be walked on
+func (c *RoomClient) checkMove(x, y int) {
+	now := time.Now()
+
+	if c.x == -1 {
+		c.moveBudget = moveBurst
+		c.moveUpdated = now
+		return
+	}
+
+	c.moveBudget = min(moveBurst, c.moveBudget+now.Sub(c.moveUpdated).Seconds()*getTilesPerSecond(c.speed)*moveTolerance)
+	c.moveUpdated = now
+
+	c.moveBudget -= float64(c.getDistance(x, y))
+	if c.moveBudget < 0 {
+		c.flagSuspiciousActivity("speed", fmt.Sprintf("moved from %d,%d to %d,%d at speed %d", c.x, c.y, x, y, c.speed))
+		c.moveBudget = 0
+	}
+
+	if mapInfo, ok := assets.mapInfos[c.room.id]; ok && mapInfo.impassable != nil && mapInfo.impassable[y*mapInfo.width+x] {
+		c.flagSuspiciousActivity("passability", fmt.Sprintf("moved onto impassable tile %d,%d", x, y))
+	}
+}
+
+func (c *RoomClient) checkJump(x, y int) {
+	if c.x == -1 {
+		return
+	}
+
+	if distance := c.getDistance(x, y); distance > maxJumpDistance {
+		c.flagSuspiciousActivity("jump", fmt.Sprintf("jumped %d tiles from %d,%d to %d,%d", distance, c.x, c.y, x, y))
+	}
+}
+
+// getDistance returns the number of steps between the client and x y,
+// taking looping maps into account
+func (c *RoomClient) getDistance(x, y int) int {
+	dx, dy := getMapDistance(c.room.id, c.x, c.y, x, y)
+
+	return max(dx, dy)
+}
+
+// getMapDistance returns how many tiles apart two positions on mapId are on each axis,
+// going across the edge of looping maps when that is shorter
+func getMapDistance(mapId, x1, y1, x2, y2 int) (dx, dy int) {
+	dx = abs(x2 - x1)
+	dy = abs(y2 - y1)
+
+	if mapInfo, ok := assets.mapInfos[mapId]; ok {
+		if mapInfo.loopHorizontal {
+			dx = min(dx, mapInfo.width-dx)
+		}
+		if mapInfo.loopVertical {
+			dy = min(dy, mapInfo.height-dy)
+		}
+	}
+
+	return dx, dy
+}
+
+func (c *RoomClient) flagSuspiciousActivity(activityType string, detail string) {
+	if time.Since(c.lastFlagged) < suspiciousActivityCooldown {
+		return
+	}
+	c.lastFlagged = time.Now()
+
+	writeErrLog(c.session.uuid, c.mapId, "suspicious "+activityType+": "+detail)
+
+	suspiciousActivity.mutex.Lock()
+	defer suspiciousActivity.mutex.Unlock()
+
+	suspiciousActivity.entries = append(suspiciousActivity.entries, SuspiciousActivity{
+		Time:   time.Now(),
+		Uuid:   c.session.uuid,
+		MapId:  c.mapId,
+		Type:   activityType,
+		Detail: detail,
+	})
+
+	if len(suspiciousActivity.entries) > maxSuspiciousActivity {
+		suspiciousActivity.entries = suspiciousActivity.entries[len(suspiciousActivity.entries)-maxSuspiciousActivity:]
+	}
+}
+
+// getSuspiciousActivity returns recent entries, newest first, optionally only for uuid
+func getSuspiciousActivity(uuid string) []SuspiciousActivity {
+	suspiciousActivity.mutex.Lock()
+	defer suspiciousActivity.mutex.Unlock()
+
+	entries := make([]SuspiciousActivity, 0)
+	for i := len(suspiciousActivity.entries) - 1; i >= 0; i-- {
+		if uuid != "" && suspiciousActivity.entries[i].Uuid != uuid {
+			continue
+		}
+
+		entries = append(entries, suspiciousActivity.entries[i])
+	}
+
+	return entries
+}
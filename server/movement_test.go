@@ -0,0 +1,134 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// maps that only exist in assets, there are no rooms for them
+const (
+	testWalledMap     = 101 // 5x5 with an impassable tile at 2,2
+	testLoopingMap    = 102 // 20x15, looping both ways
+	testHorizontalMap = 103 // 20x15, looping horizontally
+)
+
+var testMapInfos = map[int]*MapInfo{
+	testWalledMap: {
+		width:      5,
+		height:     5,
+		impassable: func() []bool { impassable := make([]bool, 25); impassable[2*5+2] = true; return impassable }(),
+	},
+	testLoopingMap:    {width: 20, height: 15, loopHorizontal: true, loopVertical: true},
+	testHorizontalMap: {width: 20, height: 15, loopHorizontal: true},
+}
+
+func TestGetMapDistance(t *testing.T) {
+	tests := []struct {
+		mapId          int
+		x1, y1, x2, y2 int
+		dx, dy         int
+	}{
+		{testWalledMap, 0, 0, 4, 4, 4, 4},
+		{testLoopingMap, 0, 0, 19, 14, 1, 1},
+		{testLoopingMap, 19, 14, 0, 0, 1, 1},
+		{testLoopingMap, 0, 0, 10, 7, 10, 7},
+		{testLoopingMap, 2, 3, 12, 11, 10, 7},
+		{testHorizontalMap, 0, 0, 19, 14, 1, 14},
+		{testRooms, 0, 0, 19, 14, 19, 14}, // no map data
+	}
+
+	for _, test := range tests {
+		if dx, dy := getMapDistance(test.mapId, test.x1, test.y1, test.x2, test.y2); dx != test.dx || dy != test.dy {
+			t.Errorf("map %d from %d,%d to %d,%d: got %d,%d, want %d,%d", test.mapId, test.x1, test.y1, test.x2, test.y2, dx, dy, test.dx, test.dy)
+		}
+	}
+}
+
+func TestCheckMove(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapId   int
+		x, y    int
+		toX     int
+		toY     int
+		flagged string
+	}{
+		{"step", testWalledMap, 1, 2, 1, 1, ""},
+		{"onto impassable", testWalledMap, 1, 2, 2, 2, "passability"},
+		{"too far", testWalledMap, 0, 0, 3, 0, "speed"},
+		{"across looping edge", testLoopingMap, 0, 0, 19, 14, ""},
+		{"across horizontal loop", testHorizontalMap, 19, 5, 0, 5, ""},
+		{"not across vertical edge", testHorizontalMap, 5, 14, 5, 0, "speed"},
+		{"without map data", testRooms, 0, 0, 19, 0, "speed"},
+	}
+
+	for i, test := range tests {
+		uuid := "movement" + strconv.Itoa(i)
+
+		now := time.Now()
+		c := &RoomClient{
+			room:        &Room{id: test.mapId},
+			session:     &SessionClient{uuid: uuid},
+			x:           test.x,
+			y:           test.y,
+			moveBudget:  1, // one step
+			moveUpdated: now,
+		}
+
+		c.checkMove(test.toX, test.toY)
+
+		var flagged string
+		if entries := getSuspiciousActivity(uuid); len(entries) != 0 {
+			flagged = entries[0].Type
+		}
+
+		if flagged != test.flagged {
+			t.Errorf("%s: flagged %q, want %q", test.name, flagged, test.flagged)
+		}
+	}
+}
+
+func TestCheckMoveSpeed(t *testing.T) {
+	c := &RoomClient{
+		room:    &Room{id: testLoopingMap},
+		session: &SessionClient{uuid: "movementspeed"},
+		x:       -1,
+	}
+
+	// the first position isn't checked
+	c.checkMove(5, 5)
+	c.x, c.y = 5, 5
+
+	// a burst of steps is allowed right away
+	for range moveBurst {
+		c.checkMove(c.x+1, c.y)
+		c.x++
+	}
+	if len(getSuspiciousActivity("movementspeed")) != 0 {
+		t.Fatal("burst flagged")
+	}
+
+	// but the budget then has to refill
+	c.checkMove(c.x+1, c.y)
+	if entries := getSuspiciousActivity("movementspeed"); len(entries) != 1 || entries[0].Type != "speed" {
+		t.Errorf("got %v, want one speed entry", entries)
+	}
+}
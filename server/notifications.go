@@ -1,11 +1,11 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
-	"strings"
 	"time"
 
 	webpush "github.com/Appboy/webpush-go"
@@ -60,9 +60,9 @@ func handleRegisterSubscriber(w http.ResponseWriter, r *http.Request) {
 
 	token := r.Header.Get("Authorization")
 	if token == "" {
-		uuid, banned, _ = getOrCreatePlayerData(getIp(r))
+		uuid, banned, _ = getOrCreatePlayerData(r.Context(), getIp(r))
 	} else {
-		uuid, _, _, _, banned, _ = getPlayerDataFromToken(token)
+		uuid, _, _, _, banned, _ = getPlayerDataFromToken(r.Context(), token)
 		if uuid == "" {
 			handleError(w, r, "invalid token")
 			return
@@ -81,7 +81,7 @@ func handleRegisterSubscriber(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = db.Exec("INSERT IGNORE INTO pushSubscriptions (uuid, endpoint, p256dh, auth) VALUES (?, ?, ?, ?)", uuid, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth)
+	err = store.notifications.addPushSubscription(r.Context(), uuid, &sub)
 	if err != nil {
 		handleError(w, r, "error adding push subscription")
 		return
@@ -113,9 +113,9 @@ func handleUnregisterSubscriber(w http.ResponseWriter, r *http.Request) {
 
 	token := r.Header.Get("Authorization")
 	if token == "" {
-		uuid, banned, _ = getOrCreatePlayerData(getIp(r))
+		uuid, banned, _ = getOrCreatePlayerData(r.Context(), getIp(r))
 	} else {
-		uuid, _, _, _, banned, _ = getPlayerDataFromToken(token)
+		uuid, _, _, _, banned, _ = getPlayerDataFromToken(r.Context(), token)
 		if uuid == "" {
 			handleError(w, r, "invalid token")
 			return
@@ -137,7 +137,7 @@ func handleUnregisterSubscriber(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = db.Exec("DELETE FROM pushSubscriptions WHERE uuid = ? AND endpoint = ?", uuid, sub.Endpoint)
+	err = store.notifications.removePushSubscription(r.Context(), uuid, sub.Endpoint)
 	if err != nil {
 		handleError(w, r, "error removing push subscription")
 		return
@@ -145,18 +145,12 @@ func handleUnregisterSubscriber(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleVapidPublicKeyRequest(w http.ResponseWriter, _ *http.Request) {
-	w.Write([]byte(config.vapidKeys.public))
+	w.Write([]byte(getConfig().vapidKeys.public))
 }
 
 // If `uuids` is nil, sends the message to all users.
 func sendPushNotification(notification *Notification, uuids []string) error {
-	placeholder, uuidParams := getPlaceholders(uuids...)
-
-	query := "SELECT endpoint, p256dh, auth FROM pushSubscriptions"
-	if len(uuidParams) > 0 {
-		query += " WHERE uuid IN (" + placeholder + ")"
-	}
-	results, err := db.Query(query, uuidParams...)
+	subs, err := store.notifications.getPushSubscriptions(context.Background(), uuids)
 	if err != nil {
 		return err
 	}
@@ -168,42 +162,26 @@ func sendPushNotification(notification *Notification, uuids []string) error {
 
 	notification.SetDefaults()
 
-	defer results.Close()
 	var failures []error
-	for results.Next() {
-		var s webpush.Subscription
-		err = results.Scan(&s.Endpoint, &s.Keys.P256dh, &s.Keys.Auth)
-		if err != nil {
-			return err
-		}
-		resp, err := webpush.SendNotification(notificationString, &s, &webpush.Options{
+	for _, s := range subs {
+		resp, err := webpush.SendNotification(notificationString, s, &webpush.Options{
 			Subscriber:      "contact@ynoproject.net",
-			VAPIDPublicKey:  config.vapidKeys.public,
-			VAPIDPrivateKey: config.vapidKeys.private,
+			VAPIDPublicKey:  getConfig().vapidKeys.public,
+			VAPIDPrivateKey: getConfig().vapidKeys.private,
 			TTL:             30, // seconds,
 		})
 		if err != nil {
 			log.Printf("error sending notifications: %s", err)
 			failures = append(failures, err)
+			metrics.pushFailures.Add(1)
 			continue
 		}
 		if resp != nil && resp.StatusCode >= 400 {
 			log.Printf("webpush client responded with: %s", resp.Status)
 			failures = append(failures, errors.New(s.Endpoint+" "+resp.Status))
+			metrics.pushFailures.Add(1)
 		}
 	}
 
 	return errors.Join(failures...)
 }
-
-func getPlaceholders(values ...string) (placeholders string, parameters []interface{}) {
-	n := len(values)
-	p := make([]string, n)
-	parameters = make([]interface{}, n)
-	for i := 0; i < n; i++ {
-		p[i] = "?"
-		parameters[i] = values[i]
-	}
-	placeholders = strings.Join(p, ",")
-	return placeholders, parameters
-}
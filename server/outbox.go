@@ -0,0 +1,211 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ynoproject/ynoserver/server/protocol"
+)
+
+// room message types where a newer message replaces a queued one from the same sender
+var coalescedMsgTypes = map[string]bool{
+	"m":   true,
+	"f":   true,
+	"spd": true,
+}
+
+// session message types that are sent as a whole, so only the latest one matters
+var replacedMsgTypes = map[string]bool{
+	"pc": true,
+	"pt": true,
+	"pf": true,
+}
+
+// cosmetic message types that may be dropped when the backlog is too high,
+// everything else changes state on the client and is never dropped
+var droppableMsgTypes = map[string]bool{
+	"se":  true,
+	"ba":  true,
+	"fl":  true,
+	"cut": true,
+	"cuw": true,
+}
+
+var outboxStats struct {
+	coalesced       atomic.Uint64
+	dropped         atomic.Uint64
+	slowDisconnects atomic.Uint64
+}
+
+// Message is a message queued in any number of outboxes. It is parsed and
+// encoded once and the result is shared by every recipient.
+type Message struct {
+	msg []byte
+
+	msgType, key string // see getOutboxKey
+
+	v2     []byte
+	v2Once sync.Once
+}
+
+func newMessage(msg []byte) *Message {
+	msgType, key := getOutboxKey(msg)
+
+	return &Message{msg: msg, msgType: msgType, key: key}
+}
+
+// encode returns the message in the given protocol version,
+// v2 is encoded by the first writer that needs it
+func (m *Message) encode(version int) []byte {
+	if version != protocol.V2 {
+		return m.msg
+	}
+
+	m.v2Once.Do(func() {
+		m.v2 = protocol.AppendMessage(nil, strings.Split(string(m.msg), delim))
+	})
+
+	return m.v2
+}
+
+// Outbox queues messages for a client's writer. Sending never blocks;
+// instead the client is disconnected by calling slow if its backlog
+// stays above config.outbox.maxBacklog for config.outbox.slowTimeout.
+type Outbox struct {
+	queue  []*Message // nil entries were coalesced away
+	queued int
+
+	// coalesce key to index in queue
+	latest map[string]int
+
+	overSince    time.Time
+	disconnected bool
+
+	slow func()
+
+	ready chan struct{}
+	mutex sync.Mutex
+}
+
+func newOutbox(slow func()) *Outbox {
+	return &Outbox{
+		latest: make(map[string]int),
+		slow:   slow,
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+func (o *Outbox) send(msg []byte) {
+	o.sendMessage(newMessage(msg))
+}
+
+// sendMessage queues a message that may be shared with other outboxes
+func (o *Outbox) sendMessage(m *Message) {
+	o.mutex.Lock()
+
+	overLimit := o.queued >= getConfig().outbox.maxBacklog
+
+	var disconnect bool
+	if overLimit {
+		if o.overSince.IsZero() {
+			o.overSince = time.Now()
+		} else if !o.disconnected && time.Since(o.overSince) > getConfig().outbox.slowTimeout {
+			o.disconnected = true
+			disconnect = true
+		}
+	}
+
+	if overLimit && droppableMsgTypes[m.msgType] {
+		outboxStats.dropped.Add(1)
+	} else {
+		if m.key != "" {
+			if i, ok := o.latest[m.key]; ok {
+				o.queue[i] = nil
+				o.queued--
+
+				outboxStats.coalesced.Add(1)
+			}
+
+			o.latest[m.key] = len(o.queue)
+		}
+
+		o.queue = append(o.queue, m)
+		o.queued++
+	}
+
+	o.mutex.Unlock()
+
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+
+	if disconnect {
+		outboxStats.slowDisconnects.Add(1)
+		o.slow()
+	}
+}
+
+// take returns every queued message in order and empties the queue
+func (o *Outbox) take() (msgs []*Message) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	msgs = make([]*Message, 0, o.queued)
+	for _, msg := range o.queue {
+		if msg != nil {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	o.queue = o.queue[:0]
+	o.queued = 0
+	clear(o.latest)
+
+	o.overSince = time.Time{}
+	o.disconnected = false
+
+	return msgs
+}
+
+// getOutboxKey returns the message type and, for coalesced types,
+// the type and sender id that identify superseded messages
+func getOutboxKey(msg []byte) (msgType string, key string) {
+	fields := bytes.SplitN(msg, []byte(delim), 3)
+
+	msgType = string(fields[0])
+
+	switch {
+	case coalescedMsgTypes[msgType] && len(fields) > 1:
+		return msgType, msgType + delim + string(fields[1])
+	case replacedMsgTypes[msgType]:
+		return msgType, msgType
+	}
+
+	return msgType, ""
+}
+
+func logOutboxStats() {
+	writeLog("SERVER", "outbox", fmt.Sprintf("coalesced: %d, dropped: %d, slow consumers disconnected: %d", outboxStats.coalesced.Load(), outboxStats.dropped.Load(), outboxStats.slowDisconnects.Load()), 200)
+}
@@ -0,0 +1,198 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestOutbox returns an outbox with the given limits that counts its slow calls
+func newTestOutbox(t *testing.T, maxBacklog int, slowTimeout time.Duration) (*Outbox, *int) {
+	prevConfig := getConfig()
+	t.Cleanup(func() { currentConfig.Store(prevConfig) })
+
+	config := *prevConfig
+	config.outbox.maxBacklog = maxBacklog
+	config.outbox.slowTimeout = slowTimeout
+	currentConfig.Store(&config)
+
+	var slowCalls int
+
+	return newOutbox(func() { slowCalls++ }), &slowCalls
+}
+
+func takeTestMsgs(o *Outbox) (msgs []string) {
+	for _, msg := range o.take() {
+		msgs = append(msgs, string(msg.msg))
+	}
+
+	return msgs
+}
+
+func TestOutboxCoalesce(t *testing.T) {
+	o, _ := newTestOutbox(t, 256, time.Minute)
+
+	for _, msg := range []string{
+		"m" + delim + "1" + delim + "10" + delim + "10",
+		"m" + delim + "2" + delim + "20" + delim + "20",
+		"say" + delim + "1" + delim + "hi",
+		"say" + delim + "1" + delim + "hi",
+		"pc" + delim + "1",
+		"f" + delim + "1" + delim + "1",
+		"m" + delim + "1" + delim + "11" + delim + "10",
+		"pc" + delim + "2",
+	} {
+		o.send([]byte(msg))
+	}
+
+	// newer messages replace older ones at the end of the queue,
+	// so nothing overtakes a message sent between them
+	want := []string{
+		"m" + delim + "2" + delim + "20" + delim + "20",
+		"say" + delim + "1" + delim + "hi",
+		"say" + delim + "1" + delim + "hi",
+		"f" + delim + "1" + delim + "1",
+		"m" + delim + "1" + delim + "11" + delim + "10",
+		"pc" + delim + "2",
+	}
+	if got := takeTestMsgs(o); !slices.Equal(got, want) {
+		t.Errorf("took %q, want %q", got, want)
+	}
+
+	// messages that were already taken aren't replaced
+	o.send([]byte("m" + delim + "1" + delim + "12" + delim + "10"))
+	o.send([]byte("say" + delim + "1" + delim + "bye"))
+
+	want = []string{
+		"m" + delim + "1" + delim + "12" + delim + "10",
+		"say" + delim + "1" + delim + "bye",
+	}
+	if got := takeTestMsgs(o); !slices.Equal(got, want) {
+		t.Errorf("took %q after taking, want %q", got, want)
+	}
+}
+
+func TestOutboxDrop(t *testing.T) {
+	o, slowCalls := newTestOutbox(t, 3, time.Minute)
+
+	// cosmetic messages are kept below the limit
+	o.send([]byte("se" + delim + "1"))
+	o.send([]byte("say" + delim + "1" + delim + "a"))
+	o.send([]byte("say" + delim + "1" + delim + "b"))
+
+	o.send([]byte("se" + delim + "2"))
+	o.send([]byte("ba" + delim + "1"))
+	o.send([]byte("say" + delim + "1" + delim + "c"))
+	o.send([]byte("cut" + delim + "1"))
+
+	want := []string{
+		"se" + delim + "1",
+		"say" + delim + "1" + delim + "a",
+		"say" + delim + "1" + delim + "b",
+		"say" + delim + "1" + delim + "c",
+	}
+	if got := takeTestMsgs(o); !slices.Equal(got, want) {
+		t.Errorf("took %q, want %q", got, want)
+	}
+
+	if *slowCalls != 0 {
+		t.Error("disconnected before the slow timeout")
+	}
+
+	// and once the backlog is taken they are sent again
+	o.send([]byte("se" + delim + "3"))
+
+	if got := takeTestMsgs(o); !slices.Equal(got, []string{"se" + delim + "3"}) {
+		t.Errorf("took %q after taking", got)
+	}
+}
+
+func TestOutboxSlowConsumer(t *testing.T) {
+	const slowTimeout = 50 * time.Millisecond
+
+	fill := func(o *Outbox, n int) {
+		for i := 0; i < n; i++ {
+			o.send([]byte("say" + delim + "1" + delim + "a"))
+		}
+	}
+
+	t.Run("stays over the limit", func(t *testing.T) {
+		o, slowCalls := newTestOutbox(t, 2, slowTimeout)
+
+		fill(o, 5)
+		if *slowCalls != 0 {
+			t.Fatal("disconnected before the slow timeout")
+		}
+
+		time.Sleep(2 * slowTimeout)
+
+		fill(o, 3)
+		if *slowCalls != 1 {
+			t.Fatalf("slow called %d times, want 1", *slowCalls)
+		}
+	})
+
+	t.Run("catches up", func(t *testing.T) {
+		o, slowCalls := newTestOutbox(t, 2, slowTimeout)
+
+		fill(o, 5)
+		time.Sleep(2 * slowTimeout)
+
+		// the writer took the backlog, so the timeout starts over
+		o.take()
+		fill(o, 5)
+
+		if *slowCalls != 0 {
+			t.Error("disconnected a consumer that caught up")
+		}
+	})
+
+	t.Run("at the limit", func(t *testing.T) {
+		o, slowCalls := newTestOutbox(t, 2, slowTimeout)
+
+		// a backlog of maxBacklog is fine, the next message is over
+		fill(o, 2)
+		time.Sleep(2 * slowTimeout)
+		fill(o, 1)
+
+		if *slowCalls != 0 {
+			t.Error("disconnected a consumer at the limit")
+		}
+	})
+
+	t.Run("coalesced", func(t *testing.T) {
+		o, slowCalls := newTestOutbox(t, 3, slowTimeout)
+
+		// a busy room replaces movement instead of growing the backlog
+		for i := 0; i < 1000; i++ {
+			o.send([]byte("m" + delim + "1" + delim + "10" + delim + "10"))
+			o.send([]byte("m" + delim + "2" + delim + "10" + delim + "10"))
+		}
+		time.Sleep(2 * slowTimeout)
+		o.send([]byte("m" + delim + "1" + delim + "10" + delim + "10"))
+
+		if *slowCalls != 0 {
+			t.Error("disconnected a consumer of coalesced messages")
+		}
+		if got := len(o.take()); got != 2 {
+			t.Errorf("took %d messages, want 2", got)
+		}
+	})
+}
@@ -18,6 +18,7 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -52,7 +53,7 @@ func sendPartyUpdate() {
 		for _, member := range party.Members { // for every member
 			if member.Online {
 				if client, ok := clients.Load(member.Uuid); ok {
-					client.outbox <- buildMsg("pt", partyDataJson) // send JSON to client
+					client.outbox.send(buildMsg("pt", partyDataJson)) // send JSON to client
 				}
 			}
 		}
@@ -60,18 +61,18 @@ func sendPartyUpdate() {
 }
 
 func (c *SessionClient) cacheParty() error {
-	partyId, err := getPlayerPartyId(c.uuid)
+	partyId, err := getPlayerPartyId(c.getCtx(), c.uuid)
 	if err != nil {
 		return err
 	}
 
-	c.partyId = partyId
+	c.setPartyId(partyId)
 
 	if _, ok := parties[partyId]; ok { // it's already in the cache
 		return nil
 	}
 
-	party, err := getPartyDataFromDatabase(c.uuid)
+	party, err := getPartyDataFromDatabase(c.getCtx(), c.uuid)
 	if err != nil {
 		return err
 	}
@@ -81,8 +82,8 @@ func (c *SessionClient) cacheParty() error {
 	return nil
 }
 
-func getPlayerPartyId(uuid string) (partyId int, err error) {
-	err = db.QueryRow("SELECT pm.partyId FROM partyMembers pm JOIN parties p ON p.id = pm.partyId WHERE pm.uuid = ? AND p.game = ?", uuid, config.gameName).Scan(&partyId)
+func getPlayerPartyId(ctx context.Context, uuid string) (partyId int, err error) {
+	partyId, err = store.parties.getPlayerPartyId(ctx, uuid)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, nil
@@ -117,29 +118,31 @@ func getPartyData(partyId int) (*Party, error) {
 
 		hasOnlineMember = true
 
-		if client.name != "" {
-			member.Name = client.name
+		state := client.getRoomState()
+
+		if state.name != "" {
+			member.Name = state.name
 		}
-		if client.system != "" {
-			member.SystemName = client.system
+		if state.system != "" {
+			member.SystemName = state.system
 		}
-		if client.sprite != "" {
-			member.SpriteName = client.sprite
+		if state.sprite != "" {
+			member.SpriteName = state.sprite
 		}
-		if client.spriteIndex > -1 {
-			member.SpriteIndex = client.spriteIndex
+		if state.spriteIndex > -1 {
+			member.SpriteIndex = state.spriteIndex
 		}
 
 		member.Badge = client.badge
 		member.Medals = client.medals
 
-		if client.roomC != nil && !(client.hideLocation && client.singleplayer) {
-			member.MapId = client.roomC.mapId
-			member.PrevMapId = client.roomC.prevMapId
-			member.PrevLocations = client.roomC.prevLocations
-			member.X = client.roomC.x
-			member.Y = client.roomC.y
-		} else if client.roomC != nil && (client.hideLocation && client.singleplayer) {
+		if state.hasRoomClient && !(client.hideLocation && client.singleplayer) {
+			member.MapId = state.mapId
+			member.PrevMapId = state.prevMapId
+			member.PrevLocations = state.prevLocations
+			member.X = state.x
+			member.Y = state.y
+		} else if state.hasRoomClient && (client.hideLocation && client.singleplayer) {
 			member.MapId = "0000"
 			member.PrevMapId = "0000"
 			member.PrevLocations = ""
@@ -172,13 +175,13 @@ func getAllPartyData() ([]*Party, error) {
 	return partyData, nil
 }
 
-func getPartyDataFromDatabase(playerUuid string) (party Party, err error) {
-	err = db.QueryRow("SELECT p.id, p.owner, p.name, p.public, p.pass, p.theme, p.description FROM parties p JOIN partyMembers pm ON pm.partyId = p.id JOIN playerGameData pgd ON pgd.uuid = pm.uuid AND pgd.game = p.game WHERE p.game = ? AND pm.uuid = ?", config.gameName, playerUuid).Scan(&party.Id, &party.OwnerUuid, &party.Name, &party.Public, &party.Pass, &party.SystemName, &party.Description)
+func getPartyDataFromDatabase(ctx context.Context, playerUuid string) (party Party, err error) {
+	party, err = store.parties.getPlayerParty(ctx, playerUuid)
 	if err != nil {
 		return party, err
 	}
 
-	partyMembers, err := getPartyMemberDataFromDatabase(party.Id)
+	partyMembers, err := getPartyMemberDataFromDatabase(ctx, party.Id)
 	if err != nil {
 		return party, err
 	}
@@ -188,57 +191,25 @@ func getPartyDataFromDatabase(playerUuid string) (party Party, err error) {
 	return party, nil
 }
 
-func getPartyMemberDataFromDatabase(partyId int) (partyMembers []*PlayerListFullData, err error) {
-	results, err := db.Query("SELECT pm.partyId, pm.uuid, COALESCE(a.user, pgd.name), pd.rank, CASE WHEN a.user IS NULL THEN 0 ELSE 1 END, COALESCE(a.badge, ''), pgd.timestampLastActive, pgd.systemName, pgd.spriteName, pgd.spriteIndex, pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM partyMembers pm JOIN playerGameData pgd ON pgd.uuid = pm.uuid JOIN players pd ON pd.uuid = pgd.uuid JOIN parties p ON p.id = pm.partyId LEFT JOIN accounts a ON a.uuid = pd.uuid WHERE pm.partyId = ? AND pgd.game = ? ORDER BY CASE WHEN p.owner = pm.uuid THEN 0 ELSE 1 END, pd.rank DESC, pm.id", partyId, config.gameName)
+func getPartyMemberDataFromDatabase(ctx context.Context, partyId int) (partyMembers []*PlayerListFullData, err error) {
+	partyMembers, err = store.parties.getPartyMembers(ctx, partyId)
 	if err != nil {
 		return partyMembers, err
 	}
 
-	defer results.Close()
-
-	for results.Next() {
-		var partyId int
-		var accountBin int
-
-		partyMember := &PlayerListFullData{
-			MapId:     "0000",
-			PrevMapId: "0000",
-		}
-
-		err := results.Scan(&partyId, &partyMember.Uuid, &partyMember.Name, &partyMember.Rank, &accountBin, &partyMember.Badge, &partyMember.LastActive, &partyMember.SystemName, &partyMember.SpriteName, &partyMember.SpriteIndex, &partyMember.Medals[0], &partyMember.Medals[1], &partyMember.Medals[2], &partyMember.Medals[3], &partyMember.Medals[4])
-		if err != nil {
-			return partyMembers, err
-		}
-
-		partyMember.Account = accountBin == 1
+	for _, partyMember := range partyMembers {
 		partyMember.Online = clients.Exists(partyMember.Uuid)
-
-		partyMembers = append(partyMembers, partyMember)
 	}
 
 	return partyMembers, nil
 }
 
-func createPartyData(name string, public bool, pass string, theme string, description string, playerUuid string) (partyId int, err error) {
-	results, err := db.Exec("INSERT INTO parties (game, owner, name, public, pass, theme, description) VALUES (?, ?, ?, ?, ?, ?, ?)", config.gameName, playerUuid, name, public, pass, theme, description)
-	if err != nil {
-		return 0, err
-	}
-
-	var partyId64 int64
-
-	partyId64, err = results.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
-	partyId = int(partyId64)
-
-	return partyId, nil
+func createPartyData(ctx context.Context, name string, public bool, pass string, theme string, description string, playerUuid string) (partyId int, err error) {
+	return store.parties.createParty(ctx, name, public, pass, theme, description, playerUuid)
 }
 
-func updatePartyData(partyId int, name string, public bool, pass string, theme string, description string, playerUuid string) error {
-	_, err := db.Exec("UPDATE parties SET game = ?, owner = ?, name = ?, public = ?, pass = ?, theme = ?, description = ? WHERE id = ?", config.gameName, playerUuid, name, public, pass, theme, description, partyId)
+func updatePartyData(ctx context.Context, partyId int, name string, public bool, pass string, theme string, description string, playerUuid string) error {
+	err := store.parties.updateParty(ctx, partyId, name, public, pass, theme, description, playerUuid)
 	if err != nil {
 		return err
 	}
@@ -258,13 +229,8 @@ func updatePartyData(partyId int, name string, public bool, pass string, theme s
 	return nil
 }
 
-func joinPlayerParty(partyId int, playerUuid string) error {
-	_, err := db.Exec("INSERT INTO partyMembers (partyId, uuid) VALUES (?, ?)", partyId, playerUuid)
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec("UPDATE playerGameData pgd SET pgd.lastPartyMsgId = (SELECT cm.msgId FROM chatMessages cm WHERE cm.game = pgd.game AND cm.partyId = ? AND cm.timestamp = (SELECT MAX(timestamp) FROM chatMessages WHERE game = cm.game AND partyId = cm.partyId) LIMIT 1) WHERE pgd.uuid = ? AND pgd.game = ?", partyId, playerUuid, config.gameName)
+func joinPlayerParty(ctx context.Context, partyId int, playerUuid string) error {
+	err := store.parties.addPartyMember(ctx, partyId, playerUuid)
 	if err != nil {
 		return err
 	}
@@ -272,7 +238,7 @@ func joinPlayerParty(partyId int, playerUuid string) error {
 	party, ok := parties[partyId]
 	if !ok {
 		// this only happens when someone creates a party
-		party, err := getPartyDataFromDatabase(playerUuid)
+		party, err := getPartyDataFromDatabase(ctx, playerUuid)
 		if err != nil {
 			return err
 		}
@@ -305,23 +271,18 @@ func joinPlayerParty(partyId int, playerUuid string) error {
 		PrevMapId:      "0000", // initial value
 	})
 
-	client.partyId = partyId
+	client.setPartyId(partyId)
 
 	return nil
 }
 
-func leavePlayerParty(playerUuid string) error {
-	partyId, err := getPlayerPartyId(playerUuid) // get party id for later
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec("DELETE pm FROM partyMembers pm JOIN parties p ON p.id = pm.partyId WHERE pm.uuid = ? AND p.game = ?", playerUuid, config.gameName)
+func leavePlayerParty(ctx context.Context, playerUuid string) error {
+	partyId, err := getPlayerPartyId(ctx, playerUuid) // get party id for later
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec("UPDATE playerGameData SET lastPartyMsgId = NULL WHERE uuid = ? AND game = ?", playerUuid, config.gameName)
+	err = store.parties.removePartyMember(ctx, playerUuid)
 	if err != nil {
 		return err
 	}
@@ -344,7 +305,7 @@ func leavePlayerParty(playerUuid string) error {
 	}
 
 	if client, ok := clients.Load(playerUuid); ok {
-		client.partyId = 0
+		client.setPartyId(0)
 	}
 
 	return nil
@@ -372,7 +333,7 @@ func getPartyOwnerUuid(partyId int) (ownerUuid string, err error) {
 	return party.OwnerUuid, nil
 }
 
-func assumeNextPartyOwner(partyId int) error {
+func assumeNextPartyOwner(ctx context.Context, partyId int) error {
 	partyMemberUuids, err := getPartyMemberUuids(partyId)
 	if err != nil {
 		return err
@@ -390,12 +351,12 @@ func assumeNextPartyOwner(partyId int) error {
 	}
 
 	if nextOnlinePlayerUuid != "" {
-		err := setPartyOwner(partyId, nextOnlinePlayerUuid)
+		err := setPartyOwner(ctx, partyId, nextOnlinePlayerUuid)
 		if err != nil {
 			return err
 		}
 	} else {
-		_, err := db.Exec("UPDATE parties p SET p.owner = (SELECT pm.uuid FROM partyMembers pm JOIN players pd ON pd.uuid = pm.uuid WHERE pm.partyId = p.id ORDER BY pd.rank DESC, pm.id LIMIT 1) WHERE p.id = ?", partyId)
+		err := store.parties.setPartyOwnerByRank(ctx, partyId)
 		if err != nil {
 			return err
 		}
@@ -404,8 +365,8 @@ func assumeNextPartyOwner(partyId int) error {
 	return nil
 }
 
-func setPartyOwner(partyId int, playerUuid string) error {
-	_, err := db.Exec("UPDATE parties SET owner = ? WHERE id = ?", playerUuid, partyId)
+func setPartyOwner(ctx context.Context, partyId int, playerUuid string) error {
+	err := store.parties.setPartyOwner(ctx, partyId, playerUuid)
 	if err != nil {
 		return err
 	}
@@ -420,14 +381,14 @@ func setPartyOwner(partyId int, playerUuid string) error {
 	return nil
 }
 
-func checkDeleteOrphanedParty(partyId int) (deleted bool, err error) {
+func checkDeleteOrphanedParty(ctx context.Context, partyId int) (deleted bool, err error) {
 	party, ok := parties[partyId]
 	if !ok {
 		return false, errors.New("party id not in cache")
 	}
 
 	if len(party.Members) == 0 {
-		_, err := db.Exec("DELETE FROM parties WHERE id = ?", partyId)
+		err := store.parties.deleteParty(ctx, partyId)
 		if err != nil {
 			return true, err
 		}
@@ -440,13 +401,8 @@ func checkDeleteOrphanedParty(partyId int) (deleted bool, err error) {
 	return false, nil
 }
 
-func deletePartyAndMembers(partyId int) error {
-	_, err := db.Exec("DELETE FROM partyMembers WHERE partyId = ?", partyId)
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec("DELETE FROM parties WHERE id = ?", partyId)
+func deletePartyAndMembers(ctx context.Context, partyId int) error {
+	err := store.parties.deletePartyAndMembers(ctx, partyId)
 	if err != nil {
 		return err
 	}
@@ -456,11 +412,6 @@ func deletePartyAndMembers(partyId int) error {
 	return nil
 }
 
-func writePartyChatMessage(msgId, uuid, mapId, prevMapId, prevLocations string, x, y int, contents string, partyId int) error {
-	_, err := db.Exec("INSERT INTO chatMessages (msgId, game, uuid, mapId, prevMapId, prevLocations, x, y, contents, partyId) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", msgId, config.gameName, uuid, mapId, prevMapId, prevLocations, x, y, contents, partyId)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func writePartyChatMessage(ctx context.Context, msgId, uuid, mapId, prevMapId, prevLocations string, x, y int, contents string, partyId int) error {
+	return store.chat.writePartyChatMessage(ctx, ChatMessageWrite{msgId, uuid, mapId, prevMapId, prevLocations, x, y, contents}, partyId)
 }
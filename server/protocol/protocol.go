@@ -0,0 +1,219 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package protocol implements the compact binary room protocol (v2).
+//
+// A v2 frame is a sequence of messages. Each message starts with a one byte
+// opcode followed by a uvarint field count and the fields themselves. Opcode 0
+// is reserved for message types without an opcode, in which case the type name
+// is sent as the first field. Every field starts with a uvarint header: if the
+// low bit is clear the remaining bits hold a zigzag encoded integer, otherwise
+// they hold the length of the string bytes that follow.
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	V1 = 1 // delimiter separated strings
+	V2 = 2 // compact binary
+
+	// Subprotocol is the Sec-Websocket-Protocol value that selects V2
+	Subprotocol = "yno.v2"
+)
+
+// integers outside of this range are sent as strings since
+// the zigzag value must leave room for the header bit
+const (
+	minInt = -1 << 61
+	maxInt = 1<<61 - 1
+)
+
+// opcodes are assigned by index and must only ever be appended to
+var msgTypes = []string{
+	"", // no opcode, type name follows as a string field
+
+	// server -> client
+	"s", "ri", "c", "d", "name", "pns", "bas", "cut", "cuw",
+
+	// both directions
+	"m", "jmp", "tp", "f", "spd", "spr", "fl", "rfl", "rrfl", "tr", "h",
+	"sys", "se", "ap", "mp", "rp", "ba", "ss", "sv", "sev", "anc",
+
+	// client -> server
+	"sr",
+}
+
+var opcodes = make(map[string]byte)
+
+func init() {
+	for i, msgType := range msgTypes[1:] {
+		opcodes[msgType] = byte(i + 1)
+	}
+}
+
+var (
+	errTruncated     = errors.New("truncated message")
+	errUnknownOpcode = errors.New("unknown opcode")
+	errInvalidUtf8   = errors.New("invalid utf8")
+)
+
+// AppendMessage appends the v2 encoding of a message to dst.
+// fields[0] is the message type.
+func AppendMessage(dst []byte, fields []string) []byte {
+	if len(fields) == 0 {
+		return dst
+	}
+
+	opcode, ok := opcodes[fields[0]]
+	if ok {
+		dst = append(dst, opcode)
+		dst = binary.AppendUvarint(dst, uint64(len(fields)-1))
+		fields = fields[1:]
+	} else {
+		dst = append(dst, 0)
+		dst = binary.AppendUvarint(dst, uint64(len(fields)))
+	}
+
+	for _, field := range fields {
+		dst = appendField(dst, field)
+	}
+
+	return dst
+}
+
+func appendField(dst []byte, field string) []byte {
+	if num, ok := parseInt(field); ok {
+		zigzag := uint64(num<<1) ^ uint64(num>>63)
+		return binary.AppendUvarint(dst, zigzag<<1)
+	}
+
+	dst = binary.AppendUvarint(dst, uint64(len(field))<<1|1)
+	return append(dst, field...)
+}
+
+// parseInt parses integers whose text form survives the round trip, so
+// the decoded message is identical to the original. That rules out signs
+// other than a minus, leading zeros and negative zero.
+func parseInt(field string) (num int, ok bool) {
+	digits := field
+
+	negative := len(digits) > 1 && digits[0] == '-'
+	if negative {
+		digits = digits[1:]
+	}
+
+	// anything longer is out of range, which also keeps value from overflowing
+	if len(digits) == 0 || len(digits) > 19 || digits[0] == '0' && (len(digits) > 1 || negative) {
+		return 0, false
+	}
+
+	var value uint64
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return 0, false
+		}
+		value = value*10 + uint64(digits[i]-'0')
+	}
+
+	if negative {
+		if value > -minInt {
+			return 0, false
+		}
+		return -int(value), true
+	}
+
+	if value > maxInt {
+		return 0, false
+	}
+	return int(value), true
+}
+
+// DecodeMessages decodes every message in a v2 frame into its fields.
+func DecodeMessages(frame []byte) (msgs [][]string, err error) {
+	for len(frame) != 0 {
+		var fields []string
+
+		fields, frame, err = decodeMessage(frame)
+		if err != nil {
+			return msgs, err
+		}
+
+		msgs = append(msgs, fields)
+	}
+
+	return msgs, nil
+}
+
+func decodeMessage(frame []byte) (fields []string, rest []byte, err error) {
+	opcode := frame[0]
+	if int(opcode) >= len(msgTypes) {
+		return nil, nil, errUnknownOpcode
+	}
+
+	count, n := binary.Uvarint(frame[1:])
+	if n <= 0 {
+		return nil, nil, errTruncated
+	}
+	frame = frame[1+n:]
+
+	// every field takes at least one byte
+	if count > uint64(len(frame)) {
+		return nil, nil, errTruncated
+	}
+
+	if opcode != 0 {
+		fields = append(make([]string, 0, count+1), msgTypes[opcode])
+	} else {
+		if count == 0 {
+			return nil, nil, errTruncated
+		}
+		fields = make([]string, 0, count)
+	}
+
+	for i := uint64(0); i < count; i++ {
+		header, n := binary.Uvarint(frame)
+		if n <= 0 {
+			return nil, nil, errTruncated
+		}
+		frame = frame[n:]
+
+		if header&1 == 0 {
+			zigzag := header >> 1
+			fields = append(fields, strconv.Itoa(int(zigzag>>1)^-int(zigzag&1)))
+			continue
+		}
+
+		length := header >> 1
+		if length > uint64(len(frame)) {
+			return nil, nil, errTruncated
+		}
+
+		if !utf8.Valid(frame[:length]) {
+			return nil, nil, errInvalidUtf8
+		}
+
+		fields = append(fields, string(frame[:length]))
+		frame = frame[length:]
+	}
+
+	return fields, frame, nil
+}
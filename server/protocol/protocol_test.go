@@ -0,0 +1,166 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package protocol
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+	}{
+		{"opcode", []string{"m", "12", "34"}},
+		{"no opcode", []string{"say", "hello"}},
+		{"type only", []string{"h"}},
+		{"unknown type only", []string{"foo"}},
+		{"empty fields", []string{"name", "", ""}},
+		{"unicode", []string{"say", "こんにちは", "￿"}},
+		{"negative", []string{"sv", "-1", "-123456"}},
+		{"zero", []string{"ss", "0", "-0"}},
+		{"not canonical", []string{"sv", "007", "+5", "1_000", " 1", "1e3"}},
+		{"int range", []string{"sv", strconv.Itoa(maxInt), strconv.Itoa(minInt), strconv.Itoa(maxInt + 1), strconv.Itoa(minInt - 1)}},
+		{"too long", []string{"sv", "99999999999999999999", "-99999999999999999999", "18446744073709551616"}},
+		{"signs", []string{"sv", "-", "--1", "1-"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msgs, err := DecodeMessages(AppendMessage(nil, test.fields))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != 1 || !slices.Equal(msgs[0], test.fields) {
+				t.Fatalf("decoded %q, want %q", msgs, test.fields)
+			}
+		})
+	}
+}
+
+func TestRoundTripFrame(t *testing.T) {
+	want := [][]string{{"m", "1", "2"}, {"say", "hi"}, {"f", "3"}}
+
+	var frame []byte
+	for _, fields := range want {
+		frame = AppendMessage(frame, fields)
+	}
+
+	msgs, err := DecodeMessages(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(msgs, want, slices.Equal) {
+		t.Fatalf("decoded %q, want %q", msgs, want)
+	}
+}
+
+func TestZigzag(t *testing.T) {
+	tests := []struct {
+		field  string
+		header []byte
+	}{
+		{"0", []byte{0}},
+		{"-1", []byte{2}},
+		{"1", []byte{4}},
+		{"-2", []byte{6}},
+		{"2", []byte{8}},
+		{"31", []byte{124}},
+		{"32", []byte{128, 1}},
+		{"-32", []byte{126}},
+		{"-33", []byte{130, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.field, func(t *testing.T) {
+			if encoded := appendField(nil, test.field); !bytes.Equal(encoded, test.header) {
+				t.Fatalf("encoded as %v, want %v", encoded, test.header)
+			}
+		})
+	}
+}
+
+func TestStringField(t *testing.T) {
+	// the low bit marks strings, the rest is the length
+	if encoded := appendField(nil, "007"); !bytes.Equal(encoded, []byte{7, '0', '0', '7'}) {
+		t.Fatalf("encoded as %v", encoded)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	sv := opcodes["sv"]
+
+	tests := []struct {
+		name  string
+		frame []byte
+		err   error
+	}{
+		{"unknown opcode", []byte{byte(len(msgTypes)), 0}, errUnknownOpcode},
+		{"no count", []byte{sv}, errTruncated},
+		{"truncated count", []byte{sv, 0x80}, errTruncated},
+		{"overflowing count", []byte{sv, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, errTruncated},
+		{"count past end", []byte{sv, 3, 0}, errTruncated},
+		{"no type", []byte{0, 0}, errTruncated},
+		{"truncated header", []byte{sv, 1, 0x80}, errTruncated},
+		{"overflowing header", []byte{sv, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, errTruncated},
+		{"length past end", []byte{sv, 1, 9, 'a'}, errTruncated},
+		{"huge length", []byte{sv, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, errTruncated},
+		{"invalid utf8", []byte{sv, 1, 3, 0xff}, errInvalidUtf8},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := DecodeMessages(test.frame); err != test.err {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestDecodeNoPanic(t *testing.T) {
+	var frame []byte
+	frame = AppendMessage(frame, []string{"ap", "1", "-20", "picture", strconv.Itoa(maxInt)})
+	frame = AppendMessage(frame, []string{"say", "こんにちは"})
+
+	// every truncation of a valid frame
+	for i := range frame {
+		DecodeMessages(frame[:i])
+	}
+
+	// and every single byte corruption
+	for i := range frame {
+		for b := range 256 {
+			corrupted := bytes.Clone(frame)
+			corrupted[i] = byte(b)
+			DecodeMessages(corrupted)
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 10000 {
+		garbage := make([]byte, rng.IntN(32))
+		for i := range garbage {
+			garbage[i] = byte(rng.UintN(256))
+		}
+		DecodeMessages(garbage)
+	}
+}
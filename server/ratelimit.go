@@ -0,0 +1,145 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errFlood = errors.New("disconnected for flooding")
+
+var floodStrikes = struct {
+	strikes map[string][]time.Time
+	mutex   sync.Mutex
+}{
+	strikes: make(map[string][]time.Time),
+}
+
+type rateLimit struct {
+	rate  float64 // tokens per second
+	burst float64
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// floodGuard holds the token buckets of a single socket, it is only
+// used by the socket's reader so it doesn't need to be locked
+type floodGuard struct {
+	buckets map[string]*tokenBucket
+
+	dropped     int
+	windowStart time.Time
+}
+
+// allow takes a token for msgType, returning false if the message should be dropped
+func (g *floodGuard) allow(msgType string) bool {
+	limit, ok := getConfig().rateLimits.messages[msgType]
+	if !ok {
+		return true
+	}
+
+	now := time.Now()
+
+	if g.buckets == nil {
+		g.buckets = make(map[string]*tokenBucket)
+	}
+
+	bucket, ok := g.buckets[msgType]
+	if !ok {
+		bucket = &tokenBucket{tokens: limit.burst, updated: now}
+		g.buckets[msgType] = bucket
+	}
+
+	bucket.tokens = min(limit.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*limit.rate)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+
+	bucket.tokens--
+
+	return true
+}
+
+// drop records a dropped message and returns true once enough
+// messages were dropped within a minute to disconnect the client
+func (g *floodGuard) drop() bool {
+	if time.Since(g.windowStart) > time.Minute {
+		g.windowStart = time.Now()
+		g.dropped = 0
+	}
+
+	g.dropped++
+
+	return getConfig().rateLimits.disconnectAfter != 0 && g.dropped >= getConfig().rateLimits.disconnectAfter
+}
+
+// addFloodStrike is called when a player is disconnected for flooding
+// and mutes them temporarily once they keep doing it
+func addFloodStrike(uuid string) {
+	if getConfig().rateLimits.muteAfter == 0 {
+		return
+	}
+
+	floodStrikes.mutex.Lock()
+
+	// players who stopped flooding are forgotten here, nothing else removes them
+	for strikeUuid, strikes := range floodStrikes.strikes {
+		if strikeUuid != uuid && !hasRecentStrike(strikes) {
+			delete(floodStrikes.strikes, strikeUuid)
+		}
+	}
+
+	var strikes []time.Time
+	for _, strike := range floodStrikes.strikes[uuid] {
+		if time.Since(strike) < time.Hour {
+			strikes = append(strikes, strike)
+		}
+	}
+	strikes = append(strikes, time.Now())
+
+	mute := len(strikes) >= getConfig().rateLimits.muteAfter
+	if mute {
+		delete(floodStrikes.strikes, uuid)
+	} else {
+		floodStrikes.strikes[uuid] = strikes
+	}
+
+	floodStrikes.mutex.Unlock()
+
+	if !mute {
+		return
+	}
+
+	err := tryMutePlayerWithExpiry(context.Background(), systemUuid, uuid, time.Now().Add(getConfig().rateLimits.muteDuration), "flooding", false)
+	if err != nil {
+		writeErrLog(uuid, "flood", err.Error())
+	}
+}
+
+// hasRecentStrike returns whether any of strikes, oldest first, was within the hour
+func hasRecentStrike(strikes []time.Time) bool {
+	return len(strikes) != 0 && time.Since(strikes[len(strikes)-1]) < time.Hour
+}
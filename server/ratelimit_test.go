@@ -0,0 +1,54 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFloodStrikesPruned(t *testing.T) {
+	prevConfig := getConfig()
+	t.Cleanup(func() { currentConfig.Store(prevConfig) })
+
+	config := *prevConfig
+	config.rateLimits.muteAfter = 3
+	currentConfig.Store(&config)
+
+	floodStrikes.mutex.Lock()
+	floodStrikes.strikes["floodedlongago"] = []time.Time{time.Now().Add(-2 * time.Hour), time.Now().Add(-time.Hour - time.Minute)}
+	floodStrikes.strikes["floodedrecently"] = []time.Time{time.Now().Add(-time.Hour - time.Minute), time.Now().Add(-time.Minute)}
+	floodStrikes.mutex.Unlock()
+
+	addFloodStrike("flooding")
+
+	floodStrikes.mutex.Lock()
+	defer floodStrikes.mutex.Unlock()
+
+	if _, ok := floodStrikes.strikes["floodedlongago"]; ok {
+		t.Error("strikes older than an hour are kept")
+	}
+	if _, ok := floodStrikes.strikes["floodedrecently"]; !ok {
+		t.Error("recent strikes were pruned")
+	}
+	if strikes := floodStrikes.strikes["flooding"]; len(strikes) != 1 {
+		t.Errorf("%d strikes for the flooding player, want 1", len(strikes))
+	}
+
+	clear(floodStrikes.strikes)
+}
@@ -0,0 +1,229 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package recorder writes and reads recordings of client traffic.
+//
+// A recording is a gzip compressed stream of JSON frames, one per line.
+// Frames are recorded as message fields rather than raw websocket frames,
+// so recordings don't depend on the protocol version or message signing
+// and can be replayed by any client.
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Extension is the file extension of recordings
+const Extension = ".jsonl.gz"
+
+const (
+	SocketRoom    = "room"
+	SocketSession = "session"
+)
+
+type Frame struct {
+	Time     time.Time `json:"time"`
+	Socket   string    `json:"socket"`
+	Room     int       `json:"room,omitempty"`
+	Instance int       `json:"instance,omitempty"`
+	Client   int       `json:"client"`
+	Uuid     string    `json:"uuid,omitempty"`
+	Inbound  bool      `json:"in"`
+	Msg      []string  `json:"msg"`
+}
+
+// Recorder writes frames to one recording per name in a directory
+type Recorder struct {
+	dir   string
+	files map[string]*file
+	mutex sync.Mutex
+}
+
+type file struct {
+	f     *os.File
+	buf   *bufio.Writer
+	gz    *gzip.Writer
+	enc   *json.Encoder
+	mutex sync.Mutex
+}
+
+// New creates a recorder that writes to dir, creating it if needed
+func New(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		dir:   dir,
+		files: make(map[string]*file),
+	}, nil
+}
+
+// Record appends a frame to the recording called name
+func (r *Recorder) Record(name string, frame *Frame) error {
+	f, err := r.getFile(name)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.enc.Encode(frame)
+}
+
+func (r *Recorder) getFile(name string) (*file, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if f, ok := r.files[name]; ok {
+		return f, nil
+	}
+
+	if r.files == nil {
+		return nil, errors.New("recorder is closed")
+	}
+
+	osFile, err := os.Create(filepath.Join(r.dir, name+Extension))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &file{f: osFile, buf: bufio.NewWriter(osFile)}
+	f.gz = gzip.NewWriter(f.buf)
+	f.enc = json.NewEncoder(f.gz)
+
+	r.files[name] = f
+
+	return f, nil
+}
+
+// Flush writes everything recorded so far to disk, so the recordings
+// can be read while they're still being written
+func (r *Recorder) Flush() error {
+	var errs []error
+	for _, f := range r.getFiles() {
+		f.mutex.Lock()
+		errs = append(errs, f.gz.Flush(), f.buf.Flush())
+		f.mutex.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close finishes and closes every recording
+func (r *Recorder) Close() error {
+	files := r.getFiles()
+
+	r.mutex.Lock()
+	r.files = nil
+	r.mutex.Unlock()
+
+	var errs []error
+	for _, f := range files {
+		f.mutex.Lock()
+		errs = append(errs, f.gz.Close(), f.buf.Flush(), f.f.Close())
+		f.mutex.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *Recorder) getFiles() []*file {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	files := make([]*file, 0, len(r.files))
+	for _, f := range r.files {
+		files = append(files, f)
+	}
+
+	return files
+}
+
+// Reader reads the frames of a recording
+type Reader struct {
+	f   *os.File
+	gz  *gzip.Reader
+	dec *json.Decoder
+}
+
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Reader{f: f, gz: gz, dec: json.NewDecoder(gz)}, nil
+}
+
+// Next returns the next frame or io.EOF at the end of the recording.
+// Recordings that are still being written, or weren't closed because
+// the server went down, end at the last flush.
+func (r *Reader) Next() (*Frame, error) {
+	var frame Frame
+	if err := r.dec.Decode(&frame); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+
+		return nil, err
+	}
+
+	return &frame, nil
+}
+
+func (r *Reader) Close() error {
+	return errors.Join(r.gz.Close(), r.f.Close())
+}
+
+// ReadAll reads every frame of the recording at path
+func ReadAll(path string) ([]*Frame, error) {
+	r, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	var frames []*Frame
+	for {
+		frame, err := r.Next()
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			return frames, err
+		}
+
+		frames = append(frames, frame)
+	}
+}
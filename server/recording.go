@@ -0,0 +1,167 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ynoproject/ynoserver/server/recorder"
+)
+
+// nil unless recording is enabled
+var trafficRecorder atomic.Pointer[recorder.Recorder]
+
+func initRecorder() {
+	scheduler.Every(10).Seconds().Do(func() {
+		if rec := trafficRecorder.Load(); rec != nil {
+			if err := rec.Flush(); err != nil {
+				eprintf("recorder", "failed to flush recordings: %s", err)
+			}
+		}
+	})
+
+	setRecorder()
+}
+
+// setRecorder starts or stops recording to match the config,
+// a running recording is finished and a new one started otherwise
+func setRecorder() {
+	var rec *recorder.Recorder
+	if getConfig().recorder.enabled {
+		var err error
+		rec, err = recorder.New(filepath.Join(getConfig().recorder.path, getConfig().gameName, time.Now().UTC().Format("2006-01-02T15-04-05")))
+		if err != nil {
+			eprintf("recorder", "failed to start recording: %s", err)
+		}
+	}
+
+	if old := trafficRecorder.Swap(rec); old != nil {
+		if err := old.Close(); err != nil {
+			eprintf("recorder", "failed to finish recording: %s", err)
+		}
+	}
+
+	if rec != nil {
+		writeLog("SERVER", "recorder", "recording traffic", 200)
+	}
+}
+
+func stopRecorder() {
+	if rec := trafficRecorder.Swap(nil); rec != nil {
+		if err := rec.Close(); err != nil {
+			eprintf("recorder", "failed to finish recording: %s", err)
+		}
+	}
+}
+
+func (c *RoomClient) recordInbound(msgs [][]string) {
+	rec := c.getRecorder()
+	if rec == nil {
+		return
+	}
+
+	for _, msgFields := range msgs {
+		c.record(rec, true, msgFields)
+	}
+}
+
+func (c *RoomClient) recordOutbound(msgs []*Message) {
+	rec := c.getRecorder()
+	if rec == nil {
+		return
+	}
+
+	for _, msg := range msgs {
+		c.record(rec, false, strings.Split(string(msg.msg), delim))
+	}
+}
+
+func (c *RoomClient) getRecorder() *recorder.Recorder {
+	rec := trafficRecorder.Load()
+	if rec == nil || c.spectator {
+		return nil
+	}
+
+	room := c.getRoom()
+	if room == nil {
+		return nil
+	}
+
+	if len(getConfig().recorder.rooms) != 0 && !getConfig().recorder.rooms[room.id] {
+		return nil
+	}
+
+	return rec
+}
+
+func (c *RoomClient) record(rec *recorder.Recorder, inbound bool, msgFields []string) {
+	room := c.getRoom()
+
+	recordFrame(rec, fmt.Sprintf("room-%04d", room.id), &recorder.Frame{
+		Time:     time.Now(),
+		Socket:   recorder.SocketRoom,
+		Room:     room.id,
+		Instance: room.instance,
+		Client:   c.session.id,
+		Uuid:     c.session.uuid,
+		Inbound:  inbound,
+		Msg:      msgFields,
+	})
+}
+
+func (c *SessionClient) recordInbound(msgFields []string) {
+	if rec := trafficRecorder.Load(); rec != nil {
+		c.record(rec, true, msgFields)
+	}
+}
+
+func (c *SessionClient) recordOutbound(msgs []*Message) {
+	rec := trafficRecorder.Load()
+	if rec == nil {
+		return
+	}
+
+	for _, msg := range msgs {
+		c.record(rec, false, strings.Split(string(msg.msg), delim))
+	}
+}
+
+func (c *SessionClient) record(rec *recorder.Recorder, inbound bool, msgFields []string) {
+	recordFrame(rec, "session", &recorder.Frame{
+		Time:    time.Now(),
+		Socket:  recorder.SocketSession,
+		Client:  c.id,
+		Uuid:    c.uuid,
+		Inbound: inbound,
+		Msg:     msgFields,
+	})
+}
+
+func recordFrame(rec *recorder.Recorder, name string, frame *recorder.Frame) {
+	if err := rec.Record(name, frame); err != nil {
+		// stop recording rather than failing on every frame
+		if trafficRecorder.CompareAndSwap(rec, nil) {
+			eprintf("recorder", "stopped recording: %s", err)
+			rec.Close()
+		}
+	}
+}
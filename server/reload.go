@@ -0,0 +1,70 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// reading badges and conditions takes much longer than other ipc calls
+const reloadDeadline = 30 * time.Second
+
+// held while game data is being reloaded so reloads don't interleave
+var gameDataMutex sync.Mutex
+
+// reloadGameData rereads badges, conditions, the word filter, event VMs and
+// event locations, returning everything that failed to load. Each is swapped
+// in as a whole. Badges, conditions and event locations that fail to parse
+// keep their previous value and so does the word filter, event VMs that fail
+// are left out until they load.
+func reloadGameData() (errs []error) {
+	gameDataMutex.Lock()
+	defer gameDataMutex.Unlock()
+
+	errs = append(errs, reloadBadges()...)
+
+	if err := setWordFilter(); err != nil {
+		errs = append(errs, fmt.Errorf("filterwords.txt: %w", err))
+	}
+
+	errs = append(errs, setEventVms()...)
+
+	// event locations are only loaded while there is an event period
+	if currentGameEventPeriodId > 0 {
+		errs = append(errs, setGameEventLocationPoolsAndLocationColors()...)
+	}
+
+	for _, err := range errs {
+		eprintf("reload", "%s", err)
+	}
+
+	writeLog("SERVER", "reload", fmt.Sprintf("reloaded game data with %d errors", len(errs)), 200)
+
+	return errs
+}
+
+func getErrorStrings(errs []error) []string {
+	strs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		strs = append(strs, err.Error())
+	}
+
+	return strs
+}
@@ -0,0 +1,71 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"os"
+	"testing"
+)
+
+// TestReloadGameData reloads the word filter and event locations while
+// they are read, run it with -race
+func TestReloadGameData(t *testing.T) {
+	if err := os.MkdirAll("eventlocations", 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeTestGameFile(t, "eventlocations/"+getConfig().gameName+".json", `[{"title": "Nexus", "depth": 3, "fgColor": "#fff", "bgColor": "#000", "mapIds": ["0001"]}]`)
+
+	stop := make(chan struct{})
+	reads := make(chan struct{})
+	go func() {
+		defer close(reads)
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			filterWords("a badword")
+			_ = getEventLocationPools().locationColors["Nexus"]
+			_ = len(getEventLocationPools().free)
+			_ = getEventVms()[getConfig().gameName]
+		}
+	}()
+
+	for range 20 {
+		reloadGameData()
+		setGameEventLocationPoolsAndLocationColors()
+	}
+
+	close(stop)
+	<-reads
+
+	if msg := filterWords("a badword"); msg != "a :2kkiSign:" {
+		t.Errorf("filtered message is %q", msg)
+	}
+
+	pools := getEventLocationPools()
+	if colors := pools.locationColors["Nexus"]; len(colors) != 2 || colors[0] != "#fff" {
+		t.Errorf("location colors are %v", colors)
+	}
+	if len(pools.free) != 1 {
+		t.Errorf("free pool has %d locations, want 1", len(pools.free))
+	}
+}
@@ -18,6 +18,7 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -81,9 +82,9 @@ func initModBot() {
 	reportLog = make(map[string]map[string]string)
 
 	var err error
-	bot, err = discordgo.New("Bot " + config.moderation.botToken)
+	bot, err = discordgo.New("Bot " + getConfig().moderation.botToken)
 	if err != nil {
-		if config.moderation.botToken != "" {
+		if getConfig().moderation.botToken != "" {
 			log.Fatalf("initReports(bot): %s", err)
 		}
 		log.Printf("no bot token defined, not launching bot thread. (err=%s)", err)
@@ -119,7 +120,7 @@ func initModBot() {
 		ynoMsgId := parseMsgIdFromComponent(action.Interaction.Message)
 
 		doMute := func(broadcast bool) {
-			targetName := getNameFromUuid(uuid)
+			targetName := getNameFromUuid(context.Background(), uuid)
 			for game := range gameIdToName {
 				mutePlayerInGameUnchecked(game, uuid, false, broadcast)
 			}
@@ -140,7 +141,7 @@ func initModBot() {
 		}
 
 		doBan := func(disconnect, broadcast bool) {
-			targetName := getNameFromUuid(uuid)
+			targetName := getNameFromUuid(context.Background(), uuid)
 			for game := range gameIdToName {
 				banPlayerInGameUnchecked(game, uuid, disconnect, false, broadcast)
 			}
@@ -166,7 +167,7 @@ func initModBot() {
 		case "mute":
 			doMute(false)
 		case "ack":
-			targetName := getNameFromUuid(uuid)
+			targetName := getNameFromUuid(context.Background(), uuid)
 			content := fmt.Sprintf("*Report on %s acknowledged by %s*", targetName, action.Member.DisplayName())
 
 			resp.Type = discordgo.InteractionResponseUpdateMessage
@@ -186,7 +187,7 @@ func initModBot() {
 			}
 			switch data.Values[0] {
 			case "reveal":
-				reports, err := getReportersForPlayer(uuid, ynoMsgId)
+				reports, err := getReportersForPlayer(context.Background(), uuid, ynoMsgId)
 				if err != nil {
 					log.Printf("getReportersForPlayer: %s", err)
 					return
@@ -250,7 +251,7 @@ func initModBot() {
 			}
 
 			// reset the selection
-			edit := discordgo.NewMessageEdit(config.moderation.channelId, action.Interaction.Message.ID)
+			edit := discordgo.NewMessageEdit(getConfig().moderation.channelId, action.Interaction.Message.ID)
 			edit.Components = &action.Interaction.Message.Components
 			if _, err = bot.ChannelMessageEditComplex(edit); err != nil {
 				log.Printf("bot/cmd/edit: %s", err)
@@ -318,7 +319,7 @@ func botHandleModalResponse(resp *discordgo.InteractionResponse, data discordgo.
 
 		expiry := time.Now().Add(expiryDuration)
 		var action string
-		name := getNameFromUuid(uuid)
+		name := getNameFromUuid(context.Background(), uuid)
 		broadcast := strings.HasSuffix(cmd, "_broadcast")
 		cmd := strings.TrimSuffix(cmd, "_broadcast")
 
@@ -326,13 +327,13 @@ func botHandleModalResponse(resp *discordgo.InteractionResponse, data discordgo.
 			for game := range gameIdToName {
 				banPlayerInGameUnchecked(game, uuid, true, true, broadcast)
 			}
-			registerModAction(uuid, actionBan, expiry, reason)
+			registerModAction(context.Background(), uuid, actionBan, expiry, reason)
 			action = "**banned**"
 		} else {
 			for game := range gameIdToName {
 				mutePlayerInGameUnchecked(game, uuid, true, broadcast)
 			}
-			registerModAction(uuid, actionMute, expiry, reason)
+			registerModAction(context.Background(), uuid, actionMute, expiry, reason)
 			action = "muted"
 		}
 		content := fmt.Sprintf("*%s has been %s until <t:%d:F> by %s*", name, action, expiry.Unix(), interaction.Member.DisplayName())
@@ -354,38 +355,11 @@ func botHandleCommandResponse(resp *discordgo.InteractionResponse, data discordg
 			return
 		}
 		playerid := args[0].StringValue()
-		var (
-			onlineGames   []string
-			name, uuid    string
-			banned, muted bool
-			err           error
-		)
-		rows, err := db.Query(`
-SELECT
-	pgd.name, pgd.uuid, pgd.game, pgd.online, players.banned, players.muted
-FROM playerGameData pgd
-JOIN players ON players.uuid = pgd.uuid
-WHERE pgd.name = ? OR pgd.uuid = ?`, playerid, playerid)
+		name, uuid, banned, muted, onlineGames, err := store.moderation.getPlayerModInfo(context.Background(), playerid)
 		if err != nil {
 			setResponse(resp, fmt.Sprintf("pinfo: sql error: %s", err))
 			return
 		}
-
-		defer rows.Close()
-		for rows.Next() {
-			var (
-				game   string
-				online bool
-			)
-			err = rows.Scan(&name, &uuid, &game, &online, &banned, &muted)
-			if err != nil {
-				setResponse(resp, fmt.Sprintf("pinfo: sql error: %s", err))
-				return
-			}
-			if online {
-				onlineGames = append(onlineGames, game)
-			}
-		}
 		msg := fmt.Sprintf(`##### Player Info
 name=%s uuid=%s
 banned=%t muted=%t
@@ -403,7 +377,7 @@ func registerBotCommands() (err error) {
 
 	_, err = bot.ApplicationCommandCreate(
 		bot.State.User.ID,
-		config.moderation.guildId,
+		getConfig().moderation.guildId,
 		&discordgo.ApplicationCommand{
 			Name:        "pinfo",
 			Description: "Show player info",
@@ -432,24 +406,14 @@ func setResponse(resp *discordgo.InteractionResponse, err string) {
 func initModActionExpirations() {
 	modActionExpirations = make(map[ModAction]oneshotJob)
 
-	rows, err := db.Query("SELECT uuid, action, expiry FROM playerModerationActions WHERE expiry > NOW()")
+	expiries, err := store.moderation.getModActionExpiries(context.Background())
 	if err != nil {
 		log.Print("initModActionExpirations", err)
 		return
 	}
 
-	defer rows.Close()
-	for rows.Next() {
-		var uuid string
-		var action int
-		var expiry time.Time
-		err = rows.Scan(&uuid, &action, &expiry)
-		if err != nil {
-			log.Print("initModActionExpirations/rows", err)
-			return
-		}
-
-		if err = scheduleModActionReversalMainServer(uuid, action, expiry, false); err != nil {
+	for modAction, expiry := range expiries {
+		if err = scheduleModActionReversalMainServer(modAction.uuid, modAction.action, expiry, false); err != nil {
 			log.Print("initModActionsExpiration/schedule", err)
 			return
 		}
@@ -478,13 +442,13 @@ func scheduleModActionReversalMainServer(uuid string, action int, expiry time.Ti
 		var err error
 		switch action {
 		case actionBan:
-			err = unbanPlayerUnchecked(uuid)
+			err = unbanPlayerUnchecked(context.Background(), uuid)
 		case actionMute:
-			err = unmutePlayerUnchecked(uuid)
+			err = unmutePlayerUnchecked(context.Background(), uuid)
 		default:
 			err = fmt.Errorf("did not handle reversal for action %d", action)
 		}
-		_, dberr := db.Exec("DELETE FROM playerModerationActions WHERE action = ? AND uuid = ?", action, uuid)
+		dberr := store.moderation.deleteModAction(context.Background(), uuid, action)
 		err = errors.Join(err, dberr)
 		if err != nil {
 			log.Printf("error reversing mod action for %s: %s", uuid, err)
@@ -496,7 +460,7 @@ func scheduleModActionReversalMainServer(uuid string, action int, expiry time.Ti
 
 // obj must be an outpointer to a [discordgo.MessageSend] or [discordgo.MessageEdit]
 func formatReportLog(obj any, targetUuid, ynoMsgId, originalMsg, game string, reasons map[string]int) {
-	targetName := getNameFromUuid(targetUuid)
+	targetName := getNameFromUuid(context.Background(), targetUuid)
 	if originalMsg != "" {
 		originalMsg = fmt.Sprintf("> *%s*", originalMsg)
 	}
@@ -600,9 +564,9 @@ func formatReportLog(obj any, targetUuid, ynoMsgId, originalMsg, game string, re
 		},
 	})
 
-	content := fmt.Sprintf("<@&%s>", config.moderation.modRoleId)
+	content := fmt.Sprintf("<@&%s>", getConfig().moderation.modRoleId)
 	allowedMentions := &discordgo.MessageAllowedMentions{
-		Roles: []string{config.moderation.modRoleId},
+		Roles: []string{getConfig().moderation.modRoleId},
 	}
 	switch msg := obj.(type) {
 	case *discordgo.MessageSend:
@@ -635,7 +599,7 @@ func handleReport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uuid, _, _, _, banned, _ = getPlayerDataFromToken(token)
+	uuid, _, _, _, banned, _ = getPlayerDataFromToken(r.Context(), token)
 	if uuid == "" {
 		handleError(w, r, "invalid token")
 		return
@@ -682,36 +646,18 @@ func sendReportLogMainServer(uuid, ynoMsgId, originalMsg, game string) error {
 		return errors.New("cannot call sendReportMessage from non-main server")
 	}
 
-	rows, err := db.Query(`
-SELECT reason, COUNT(*) FROM playerReports
-WHERE targetUuid = ? AND NOT actionTaken
-GROUP BY reason`, uuid)
-
-	var reasons map[string]int
-	if err == nil {
-		reasons = make(map[string]int)
-		defer rows.Close()
-		for rows.Next() {
-			var reason string
-			var count int
-			err := rows.Scan(&reason, &count)
-			if err != nil {
-				return err
-			}
-
-			reasons[reason] = count
-		}
-	}
+	// the report is logged without counts if they can't be read
+	reasons, err := store.moderation.getReportReasonCounts(context.Background(), uuid)
 
 	var msg *discordgo.Message
 	if discordMsgId, ok := reportLog[uuid][ynoMsgId]; ok {
-		payload := discordgo.NewMessageEdit(config.moderation.channelId, discordMsgId)
+		payload := discordgo.NewMessageEdit(getConfig().moderation.channelId, discordMsgId)
 		formatReportLog(payload, uuid, ynoMsgId, originalMsg, game, reasons)
 		msg, err = bot.ChannelMessageEditComplex(payload)
 	} else {
 		payload := &discordgo.MessageSend{}
 		formatReportLog(payload, uuid, ynoMsgId, originalMsg, game, reasons)
-		msg, err = bot.ChannelMessageSendComplex(config.moderation.channelId, payload)
+		msg, err = bot.ChannelMessageSendComplex(getConfig().moderation.channelId, payload)
 	}
 
 	if msg != nil && err == nil {
@@ -729,10 +675,7 @@ GROUP BY reason`, uuid)
 }
 
 func createReport(uuid, targetUuid, reason, msgId, originalMsg string) (string, string, error) {
-	var err error
-	row := db.QueryRow("SELECT contents FROM chatMessages WHERE msgId = ? AND uuid = ? AND game = ?", msgId, targetUuid, config.gameName)
-	var contentsFromDb string
-	err = row.Scan(&contentsFromDb)
+	contentsFromDb, err := store.chat.getChatMessageContents(context.Background(), msgId, targetUuid)
 	if err == nil {
 		originalMsg = contentsFromDb
 	} else if err != sql.ErrNoRows {
@@ -742,22 +685,12 @@ func createReport(uuid, targetUuid, reason, msgId, originalMsg string) (string,
 		msgId = ""
 	}
 
-	var msgIdLink *string
-	if msgId != "" {
-		msgIdLink = &msgId
-	}
-
-	_, err = db.Exec(`
-REPLACE INTO playerReports
-	(uuid, targetUuid, msgId, game, reason, originalMsg, timestampReported, actionTaken)
-VALUES
-	(?, ?, ?, ?, ?, ?, NOW(), 0)`,
-		uuid, targetUuid, msgIdLink, config.gameName, urlReplacer.Replace(reason), originalMsg)
+	err = store.moderation.writeReport(context.Background(), uuid, targetUuid, msgId, urlReplacer.Replace(reason), originalMsg)
 	return msgId, originalMsg, err
 }
 
 func markAsResolved(targetUuid string) {
-	_, err := db.Exec(`UPDATE playerReports SET actionTaken = 1 WHERE targetUuid = ?`, targetUuid)
+	err := store.moderation.resolveReports(context.Background(), targetUuid)
 	if err != nil {
 		log.Printf("markAsResolved: %s", err)
 	}
@@ -0,0 +1,232 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"time"
+
+	"github.com/fasthttp/websocket"
+)
+
+// When a socket drops without being kicked, its client is suspended for
+// config.session.resumeWindow instead of being unregistered. It stays in
+// clients and in its room, so nobody sees it leave, and can be reattached
+// to a new connection with the resume token sent in "rt" on connect.
+// Clients that are kicked are terminated and can't be resumed.
+
+type suspension struct {
+	timer *time.Timer
+
+	// messages are discarded while suspended so senders don't block
+	stop, done chan struct{}
+}
+
+func newSuspension(outbox *Outbox, expire func()) *suspension {
+	s := &suspension{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+
+		for {
+			select {
+			case <-outbox.ready:
+				outbox.take()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+
+	s.timer = time.AfterFunc(getConfig().session.resumeWindow, expire)
+
+	return s
+}
+
+func (s *suspension) end() {
+	s.timer.Stop()
+
+	close(s.stop)
+	<-s.done
+}
+
+func (c *SessionClient) suspend() bool {
+	if getConfig().session.resumeWindow == 0 {
+		return false
+	}
+
+	c.resumeMutex.Lock()
+	defer c.resumeMutex.Unlock()
+
+	if c.terminated {
+		return false
+	}
+
+	var s *suspension
+	s = newSuspension(c.outbox, func() {
+		c.resumeMutex.Lock()
+		if c.suspension != s {
+			// resumed or terminated in the meantime
+			c.resumeMutex.Unlock()
+			return
+		}
+		c.suspension = nil
+		c.terminated = true
+		c.resumeMutex.Unlock()
+
+		s.end()
+		c.unregister()
+	})
+	c.suspension = s
+
+	writeLog(c.uuid, "sess", "suspend", 200)
+
+	return true
+}
+
+// terminate disconnects the client without allowing it to be resumed
+func (c *SessionClient) terminate() {
+	c.resumeMutex.Lock()
+	c.terminated = true
+	s := c.suspension
+	c.suspension = nil
+	c.resumeMutex.Unlock()
+
+	c.conn.Load().cancel()
+
+	// a suspended client has no writer left to unregister it
+	if s != nil {
+		s.end()
+		c.unregister()
+	}
+}
+
+// resume reattaches a suspended client to conn if resumeToken is valid
+func (c *SessionClient) resume(conn *websocket.Conn, ip string, resumeToken string) bool {
+	c.resumeMutex.Lock()
+	defer c.resumeMutex.Unlock()
+
+	if c.suspension == nil || subtle.ConstantTimeCompare([]byte(resumeToken), []byte(c.resumeToken)) != 1 {
+		return false
+	}
+
+	c.suspension.end()
+	c.suspension = nil
+
+	newConn := newClientConn(context.Background(), conn)
+	newConn.ip = ip
+	c.conn.Store(newConn)
+	c.resumeToken = randString(32)
+
+	go c.msgWriter()
+	go c.msgReader()
+
+	c.outbox.send(buildMsg("rt", c.resumeToken))
+
+	writeLog(c.uuid, "sess", "resume", 200)
+
+	return true
+}
+
+func (c *RoomClient) suspend() bool {
+	if getConfig().session.resumeWindow == 0 || c.spectator {
+		return false
+	}
+
+	c.session.resumeMutex.Lock()
+	defer c.session.resumeMutex.Unlock()
+
+	if c.terminated || c.session.terminated {
+		return false
+	}
+
+	var s *suspension
+	s = newSuspension(c.outbox, func() {
+		c.session.resumeMutex.Lock()
+		if c.suspension != s {
+			c.session.resumeMutex.Unlock()
+			return
+		}
+		c.suspension = nil
+		c.terminated = true
+		c.session.resumeMutex.Unlock()
+
+		s.end()
+		c.unregister()
+	})
+	c.suspension = s
+
+	writeLog(c.session.uuid, c.mapId, "suspend", 200)
+
+	return true
+}
+
+// terminate disconnects the client without allowing it to be resumed
+func (c *RoomClient) terminate() {
+	c.session.resumeMutex.Lock()
+	c.terminated = true
+	s := c.suspension
+	c.suspension = nil
+	c.session.resumeMutex.Unlock()
+
+	c.conn.Load().cancel()
+
+	if s != nil {
+		s.end()
+		c.unregister()
+	}
+}
+
+// resume reattaches a suspended client to conn if it was in roomId,
+// sending it the room state again without telling anyone else
+func (c *RoomClient) resume(conn *websocket.Conn, roomId int, version int) bool {
+	c.session.resumeMutex.Lock()
+	defer c.session.resumeMutex.Unlock()
+
+	room := c.getRoom()
+	if c.suspension == nil || c.session.suspension != nil || room.id != roomId {
+		return false
+	}
+
+	c.suspension.end()
+	c.suspension = nil
+
+	newConn := newClientConn(serverCtx, conn)
+	newConn.protocol = version
+	newConn.key = serverSecurity.NewClientKey()
+	c.conn.Store(newConn)
+
+	go c.msgWriter()
+
+	c.outbox.send(buildMsg("s", c.session.id, newConn.key.String(), c.session.uuid, c.session.rank, c.session.account, c.session.badge, c.session.medals[:]))
+	c.outbox.send(buildMsg("ri", room.id, room.instance))
+
+	room.call(c.getRoomPlayerData)
+
+	go c.msgReader()
+
+	c.sendSyncedAssets()
+
+	writeLog(c.session.uuid, c.mapId, "resume", 200)
+
+	return true
+}
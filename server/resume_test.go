@@ -0,0 +1,180 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func setResumeWindow(t *testing.T, resumeWindow time.Duration) {
+	prevConfig := getConfig()
+	t.Cleanup(func() { currentConfig.Store(prevConfig) })
+
+	config := *prevConfig
+	config.session.resumeWindow = resumeWindow
+	currentConfig.Store(&config)
+}
+
+// connectSuspendedClient connects a new player to roomId and drops both of its sockets
+func connectSuspendedClient(t *testing.T, roomId int) (*testClient, *SessionClient, *RoomClient) {
+	t.Helper()
+
+	c := connectTestClient(t, newTestPlayer(), roomId)
+	if c.resumeToken == "" {
+		t.Fatal("no resume token")
+	}
+
+	session, ok := clients.Load(c.uuid)
+	if !ok {
+		t.Fatal("player has no session")
+	}
+	roomC := session.roomC
+	t.Cleanup(session.terminate)
+
+	c.close()
+
+	waitFor(t, "suspension", func() bool {
+		session.resumeMutex.Lock()
+		defer session.resumeMutex.Unlock()
+
+		return session.suspension != nil && roomC.suspension != nil
+	})
+
+	return c, session, roomC
+}
+
+// reconnect opens a session with resumeToken and joins roomId again,
+// returning the client id and room the server reports
+func (c *testClient) reconnect(t *testing.T, resumeToken string, roomId int) (id int, room int) {
+	t.Helper()
+
+	var err error
+	if c.session, err = c.dial("/session?resume=" + resumeToken); err != nil {
+		t.Fatalf("failed to open session: %s", err)
+	}
+	t.Cleanup(c.close)
+
+	c.sendSession("i")
+	if _, err := readTestMsg(c.session, "i"); err != nil {
+		t.Fatalf("no player info: %s", err)
+	}
+
+	if c.room, err = c.dial("/room?id=" + strconv.Itoa(roomId)); err != nil {
+		t.Fatalf("failed to join room: %s", err)
+	}
+
+	if err := readTestMsgs(c.room, func(msgFields []string) bool {
+		switch msgFields[0] {
+		case "s":
+			id, _ = strconv.Atoi(msgFields[1])
+		case "ri":
+			room, _ = strconv.Atoi(msgFields[1])
+		}
+		return room != 0
+	}); err != nil {
+		t.Fatalf("no room info: %s", err)
+	}
+
+	go discardTestMsgs(c.session)
+	go discardTestMsgs(c.room)
+
+	return id, room
+}
+
+func TestResume(t *testing.T) {
+	const roomId = 1
+
+	t.Run("within window", func(t *testing.T) {
+		setResumeWindow(t, time.Minute)
+
+		c, session, roomC := connectSuspendedClient(t, roomId)
+
+		// nobody sees a suspended player leave
+		if resumed, ok := clients.Load(c.uuid); !ok || resumed != session {
+			t.Fatal("suspended session was unregistered")
+		}
+		var inRoom bool
+		room := roomC.getRoom()
+		room.call(func() { inRoom = slices.Contains(room.clients, roomC) })
+		if !inRoom {
+			t.Fatal("suspended client left the room")
+		}
+
+		id, resumedRoom := c.reconnect(t, c.resumeToken, roomId)
+
+		if resumed, ok := clients.Load(c.uuid); !ok || resumed != session {
+			t.Error("session was replaced instead of resumed")
+		}
+		if session.roomC != roomC {
+			t.Error("room client was replaced instead of resumed")
+		}
+		if id != c.id {
+			t.Errorf("resumed with id %d, want %d", id, c.id)
+		}
+		if resumedRoom != roomId {
+			t.Errorf("resumed in room %d, want %d", resumedRoom, roomId)
+		}
+	})
+
+	t.Run("after expiry", func(t *testing.T) {
+		setResumeWindow(t, 100*time.Millisecond)
+
+		c, session, roomC := connectSuspendedClient(t, roomId)
+
+		waitFor(t, "expiry", func() bool {
+			_, ok := clients.Load(c.uuid)
+			return !ok
+		})
+
+		c.reconnect(t, c.resumeToken, roomId)
+
+		resumed, ok := clients.Load(c.uuid)
+		if !ok {
+			t.Fatal("player has no session")
+		}
+		t.Cleanup(resumed.terminate)
+
+		if resumed == session {
+			t.Error("expired session was resumed")
+		}
+		if resumed.roomC == roomC {
+			t.Error("expired room client was resumed")
+		}
+	})
+
+	t.Run("wrong token", func(t *testing.T) {
+		setResumeWindow(t, time.Minute)
+
+		c, session, _ := connectSuspendedClient(t, roomId)
+
+		c.reconnect(t, randString(32), roomId)
+
+		resumed, ok := clients.Load(c.uuid)
+		if !ok {
+			t.Fatal("player has no session")
+		}
+		t.Cleanup(resumed.terminate)
+
+		if resumed == session {
+			t.Error("session was resumed with the wrong token")
+		}
+	})
+}
@@ -25,38 +25,119 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/fasthttp/websocket"
+	"github.com/ynoproject/ynoserver/server/protocol"
+	"github.com/ynoproject/ynoserver/server/security"
 )
 
-var rooms = make(map[int]*Room)
+// how many commands can be queued for a room before callers block
+const roomCommandBuffer = 64
+
+var rooms = make(map[int]*Room) // instance 0 of every room, see roomInstances
 
 type Room struct {
 	id           int
+	instance     int
 	singleplayer bool
 
-	clients []*RoomClient
+	// sessions placed in the room, see placeInRoom
+	members map[*SessionClient]bool
+
+	// clients, spectators and outOfRange are only accessed from the room's goroutine, see run
+	clients    []*RoomClient
+	spectators []*RoomClient
+
+	commands chan func()
+
+	// movement updates are only sent to clients within this many tiles, 0 disables it
+	interestRadius int
+	outOfRange     map[interestPair]bool
 
 	conditions []*Condition
 	minigames  []*Minigame
 }
 
-func createRooms(roomIds []int, spRooms []int) {
+func createRooms(roomIds []int, spRooms []int, interestRadii map[int]int) {
 	logInitTask("rooms")
 
 	for _, roomId := range roomIds {
-		rooms[roomId] = &Room{
-			id:           roomId,
-			singleplayer: slices.Contains(spRooms, roomId),
-			conditions:   getRoomConditions(roomId),
-			minigames:    getRoomMinigames(roomId),
-		}
+		room := newRoom(roomId, 0, slices.Contains(spRooms, roomId), interestRadii[roomId], getBadgeData().getRoomConditions(roomId), getRoomMinigames(roomId))
+
+		rooms[roomId] = room
+		roomInstances.instances[roomId] = []*Room{room}
+	}
+}
+
+func newRoom(roomId int, instance int, singleplayer bool, interestRadius int, conditions []*Condition, minigames []*Minigame) *Room {
+	room := &Room{
+		id:             roomId,
+		instance:       instance,
+		singleplayer:   singleplayer,
+		commands:       make(chan func(), roomCommandBuffer),
+		interestRadius: interestRadius,
+		outOfRange:     make(map[interestPair]bool),
+		members:        make(map[*SessionClient]bool),
+		conditions:     conditions,
+		minigames:      minigames,
+	}
+
+	go room.run()
+
+	return room
+}
+
+// run executes the room's commands one at a time. Joining, leaving and
+// every message from a client in the room are commands, so the room's
+// membership and the state of its clients are never accessed concurrently.
+func (r *Room) run() {
+	for command := range r.commands {
+		command()
+	}
+}
+
+// call runs fn on the room's goroutine and waits for it to finish.
+// It must never be used from the room's goroutine itself.
+func (r *Room) call(fn func()) {
+	done := make(chan any, 1)
+
+	r.commands <- func() {
+		defer func() {
+			done <- recover()
+		}()
+
+		fn()
 	}
+
+	// handlers used to run on the caller's goroutine, so panic there and keep the room running
+	if err := <-done; err != nil {
+		panic(err)
+	}
+}
+
+// exec queues fn to run on the room's goroutine without waiting for it
+func (r *Room) exec(fn func()) {
+	r.commands <- fn
 }
 
 func handleRoom(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, http.Header{"Sec-Websocket-Protocol": {r.Header.Get("Sec-Websocket-Protocol")}})
+	if shuttingDown.Load() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	// clients that offer the v2 subprotocol get the binary format,
+	// everyone else keeps the delimiter format
+	version := protocol.V1
+	subprotocol := r.Header.Get("Sec-Websocket-Protocol")
+	if slices.Contains(websocket.Subprotocols(r), protocol.Subprotocol) {
+		version = protocol.V2
+		subprotocol = protocol.Subprotocol
+	}
+
+	conn, err := upgradeWs(w, r, http.Header{"Sec-Websocket-Protocol": {subprotocol}})
 	if err != nil {
 		log.Println(err)
 		return
@@ -78,35 +159,52 @@ func handleRoom(w http.ResponseWriter, r *http.Request) {
 		playerToken = token
 	}
 
-	joinRoomWs(conn, getIp(r), playerToken, idInt)
+	if r.URL.Query().Get("spectate") == "1" {
+		instance, _ := strconv.Atoi(r.URL.Query().Get("instance"))
+		joinRoomSpectatorWs(r.Context(), conn, getIp(r), playerToken, idInt, instance, version)
+		return
+	}
+
+	joinRoomWs(r.Context(), conn, getIp(r), playerToken, idInt, version)
 }
 
-func joinRoomWs(conn *websocket.Conn, ip string, token string, roomId int) {
-	// we don't need the value of room until later but it would be silly to do
-	// the database lookups then close the socket after due to a bad room id
-	room, ok := rooms[roomId]
-	if !ok {
+func joinRoomWs(ctx context.Context, conn *websocket.Conn, ip string, token string, roomId int, version int) {
+	// it would be silly to do the database lookups
+	// then close the socket after due to a bad room id
+	if _, ok := rooms[roomId]; !ok {
 		return
 	}
 
 	var uuid string
 	if token != "" {
-		uuid = getUuidFromToken(token)
+		uuid = getUuidFromToken(ctx, token)
 	}
 
 	if uuid == "" {
-		uuid, _, _ = getOrCreatePlayerData(ip)
+		uuid, _, _ = getOrCreatePlayerData(ctx, ip)
 	}
 
-	client := &RoomClient{
-		conn:   conn,
-		outbox: make(chan []byte, 256),
-		key:    serverSecurity.NewClientKey(),
-	}
+	// the room connection has a context of its own so that it
+	// isn't torn down when the session socket drops and resumes
+	roomConn := newClientConn(serverCtx, conn)
+	roomConn.protocol = version
+	roomConn.key = serverSecurity.NewClientKey()
+
+	client := &RoomClient{}
+	client.conn.Store(roomConn)
+	client.outbox = newOutbox(func() {
+		writeErrLog(uuid, client.mapId, "disconnected slow consumer")
+		// not resumable, it would just fall behind again
+		go client.terminate()
+	})
 
 	if session, ok := clients.Load(uuid); ok {
 		if session.roomC != nil {
-			session.roomC.cancel()
+			if session.roomC.resume(conn, roomId, version) {
+				return
+			}
+
+			session.roomC.terminate()
 		}
 
 		session.roomC = client
@@ -117,9 +215,7 @@ func joinRoomWs(conn *websocket.Conn, ip string, token string, roomId int) {
 		return
 	}
 
-	client.ctx, client.cancel = context.WithCancel(client.session.ctx)
-
-	if tags, _, err := getPlayerTags(uuid); err != nil {
+	if tags, _, err := getPlayerTags(roomConn.ctx, uuid); err != nil {
 		writeErrLog(uuid, "0000", "failed to read player tags")
 	} else {
 		client.tags = tags
@@ -128,49 +224,62 @@ func joinRoomWs(conn *websocket.Conn, ip string, token string, roomId int) {
 	go client.msgWriter()
 
 	// send client info about itself
-	client.outbox <- buildMsg("s", client.session.id, int(client.key), uuid, client.session.rank, client.session.account, client.session.badge, client.session.medals[:])
+	client.outbox.send(buildMsg("s", client.session.id, roomConn.key.String(), uuid, client.session.rank, client.session.account, client.session.badge, client.session.medals[:]))
 
 	// register client to room
-	client.joinRoom(room)
+	client.switchMutex.Lock()
+	client.joinRoom(client.session.placeInRoom(roomId))
+	mapId := client.mapId // the reader may switch rooms from here on
+	client.switchMutex.Unlock()
 
 	go client.msgReader()
 
-	// send synced picture names, picture prefixes, and battle animation ids
-	if len(config.pictures) != 0 {
-		client.outbox <- buildMsg("pns", 0, config.pictures)
-	}
-	if len(config.picturePrefixes) != 0 {
-		client.outbox <- buildMsg("pns", 1, config.picturePrefixes)
-	}
-	if len(config.battleAnimIds) != 0 {
-		client.outbox <- buildMsg("bas", config.battleAnimIds)
-	}
+	client.sendSyncedAssets()
 
-	if config.flags.unconscious {
+	if getConfig().flags.unconscious {
 		didJoinRoomWsUnconscious(client)
 	}
 
-	writeLog(client.session.uuid, client.mapId, "connect", 200)
+	writeLog(client.session.uuid, mapId, "connect", 200)
 }
 
+// sendSyncedAssets sends synced picture names, picture prefixes, and battle animation ids
+func (c *RoomClient) sendSyncedAssets() {
+	if len(getConfig().pictures) != 0 {
+		c.outbox.send(buildMsg("pns", 0, getConfig().pictures))
+	}
+	if len(getConfig().picturePrefixes) != 0 {
+		c.outbox.send(buildMsg("pns", 1, getConfig().picturePrefixes))
+	}
+	if len(getConfig().battleAnimIds) != 0 {
+		c.outbox.send(buildMsg("bas", getConfig().battleAnimIds))
+	}
+}
+
+// joinRoom and leaveRoom must be used with c.switchMutex held
 func (c *RoomClient) joinRoom(room *Room) {
 	c.room = room
+	c.sharedRoom.Store(room)
 
+	room.call(c.join)
+}
+
+func (c *RoomClient) join() {
 	c.reset()
 
-	c.outbox <- buildMsg("ri", c.room.id) // tell client they've switched rooms serverside
+	c.outbox.send(buildMsg("ri", c.room.id, c.room.instance)) // tell client they've switched rooms serverside
 
-	if config.gameName == "2kki" && c.session.rank == 0 {
-		c.outbox <- buildMsg("ss", 11, 2)
+	if getConfig().gameName == "2kki" && c.session.rank == 0 {
+		c.outbox.send(buildMsg("ss", 11, 2))
 	}
-	if config.flags.unconscious {
+	if getConfig().flags.unconscious {
 		didJoinRoomUnconscious(c)
 	}
 
 	if !c.room.singleplayer {
 		c.getRoomPlayerData()
 
-		room.clients = append(room.clients, c)
+		c.room.clients = append(c.room.clients, c)
 
 		// tell everyone that a new client has connected
 		c.broadcast(buildMsg("c", c.session.id, c.session.uuid, c.session.rank, c.session.account, c.session.badge, c.session.medals[:])) // user %id% has connected message
@@ -189,7 +298,12 @@ func (c *RoomClient) joinRoom(room *Room) {
 func (c *RoomClient) leaveRoom() {
 	// setting c.room to nil could cause a nil pointer dereference
 	// so we let joinRoom update it
+	c.room.call(c.leave)
+
+	c.room.release(c.session)
+}
 
+func (c *RoomClient) leave() {
 	for i, client := range c.room.clients {
 		if client != c {
 			continue
@@ -199,60 +313,197 @@ func (c *RoomClient) leaveRoom() {
 		c.room.clients = c.room.clients[:len(c.room.clients)-1]
 	}
 
+	c.clearInterest()
+
 	c.broadcast(buildMsg("d", c.session.id)) // user %id% has disconnected message
 }
 
-func (c *RoomClient) broadcast(msg []byte) {
-	if c.session.banned {
+// inRoom runs fn on the goroutine of the room c is in, or with a nil room on
+// the caller's if c hasn't joined one yet. c stays in the room while fn runs,
+// so session handlers can use it to access the client's state.
+// It must never be used from a room's goroutine.
+func (c *RoomClient) inRoom(fn func(room *Room)) {
+	c.switchMutex.Lock()
+	defer c.switchMutex.Unlock()
+
+	room := c.room
+	if room == nil {
+		fn(nil)
 		return
 	}
-	for _, client := range c.room.clients {
-		if client == c {
-			continue
-		}
 
-		if c.session.isBlockedWith(client.session) {
-			continue
+	room.call(func() {
+		fn(room)
+	})
+}
+
+// inRoom is RoomClient.inRoom for the session's room client, if it has one
+func (c *SessionClient) inRoom(fn func(room *Room)) {
+	if roomC := c.roomC; roomC != nil {
+		roomC.inRoom(fn)
+		return
+	}
+
+	fn(nil)
+}
+
+// RoomState is a copy of the state of a session that its room's goroutine
+// writes, for reading it elsewhere, see getRoomState
+type RoomState struct {
+	name, system, sprite string
+	spriteIndex          int
+
+	// only set if the session has a room client
+	hasRoomClient                   bool
+	mapId, prevMapId, prevLocations string
+	x, y                            int
+	locations                       []string
+	locationIds                     []int
+}
+
+// getRoomState copies c's room state on its room's goroutine,
+// it must never be used from a room's goroutine
+func (c *SessionClient) getRoomState() (state RoomState) {
+	c.inRoom(func(*Room) {
+		state.name = c.name
+		state.system = c.system
+		state.sprite = c.sprite
+		state.spriteIndex = c.spriteIndex
+
+		if roomC := c.roomC; roomC != nil {
+			state.hasRoomClient = true
+			state.mapId = roomC.mapId
+			state.prevMapId = roomC.prevMapId
+			state.prevLocations = roomC.prevLocations
+			state.x = roomC.x
+			state.y = roomC.y
+			state.locations = slices.Clone(roomC.locations)
+			state.locationIds = slices.Clone(roomC.locationIds)
 		}
+	})
 
-		if client.session.isPrivatedTo(c.session) {
+	return state
+}
+
+// broadcast sends msg to everyone in the room who can see c,
+// it must only be used from the room's goroutine
+func (c *RoomClient) broadcast(msg []byte) {
+	c.room.broadcast(c, msg)
+}
+
+func (r *Room) broadcast(sender *RoomClient, msg []byte) {
+	if sender.session.banned {
+		return
+	}
+
+	// built once and shared by every recipient
+	m := newMessage(msg)
+
+	for _, client := range r.clients {
+		if !sender.canBroadcastTo(client) {
 			continue
 		}
 
-		if c.session.isUnnamedPlayerHiddenBy(client.session) {
+		client.outbox.sendMessage(m)
+	}
+
+	r.broadcastSpectators(sender, m)
+}
+
+func (r *Room) broadcastSpectators(sender *RoomClient, m *Message) {
+	for _, spectator := range r.spectators {
+		if !sender.canBroadcastTo(spectator) {
 			continue
 		}
 
-		select {
-		case client.outbox <- msg:
-		default:
-			writeErrLog(c.session.uuid, c.mapId, "send channel is full")
-		}
+		spectator.outbox.sendMessage(m)
 	}
 }
 
-func (c *RoomClient) processMsgs(msg []byte) (errs []error) {
-	if len(msg) < 8 {
+func (c *RoomClient) canBroadcastTo(client *RoomClient) bool {
+	if client == c {
+		return false
+	}
+
+	if c.session.isBlockedWith(client.session) {
+		return false
+	}
+
+	if client.session.isPrivatedTo(c.session) {
+		return false
+	}
+
+	if c.session.isUnnamedPlayerHiddenBy(client.session) {
+		return false
+	}
+
+	return true
+}
+
+func (c *RoomClient) processMsgs(conn *ClientConn, msg []byte) (errs []error) {
+	if len(msg) < security.HeaderSize {
 		return append(errs, errors.New("bad request size"))
 	}
 
-	if !serverSecurity.VerifySignature(c.key, msg) {
+	if c.spectator {
+		return append(errs, errors.New("spectators can't send messages"))
+	}
+
+	if !serverSecurity.VerifySignature(conn.key, msg) {
 		return append(errs, errors.New("bad signature"))
 	}
 
-	if !serverSecurity.VerifyCounter(&c.counter, msg) {
+	if !serverSecurity.VerifyCounter(&conn.counter, msg) {
 		return append(errs, errors.New("bad counter"))
 	}
 
-	msg = msg[8:]
+	msg = msg[security.HeaderSize:]
 
-	if !utf8.Valid(msg) {
-		return append(errs, errors.New("invalid utf8"))
+	var msgs [][]string
+	if conn.protocol == protocol.V2 {
+		var err error
+		msgs, err = protocol.DecodeMessages(msg)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	} else {
+		if !utf8.Valid(msg) {
+			return append(errs, errors.New("invalid utf8"))
+		}
+
+		for _, msgStr := range strings.Split(string(msg), mdelim) {
+			msgs = append(msgs, strings.Split(msgStr, delim))
+		}
 	}
 
+	c.recordInbound(msgs)
+
 	// message processing
-	for _, msgStr := range strings.Split(string(msg), mdelim) {
-		if err := c.processMsg(msgStr); err != nil {
+	for _, msgFields := range msgs {
+		if !c.floodGuard.allow(msgFields[0]) {
+			if c.floodGuard.drop() {
+				c.session.terminate()
+				go addFloodStrike(c.session.uuid)
+				return append(errs, errFlood)
+			}
+			continue
+		}
+
+		var err error
+		if msgFields[0] == "sr" {
+			// switching rooms calls into both rooms so it can't run on either of them
+			err = c.processMsg(msgFields)
+			if err == nil {
+				c.updateGameActivity()
+			}
+		} else {
+			// handlers only touch the room and its clients here,
+			// anything that goes to the database runs off the room's goroutine
+			c.room.call(func() {
+				err = c.processMsg(msgFields)
+			})
+		}
+		if err != nil {
 			errs = append(errs, err)
 		}
 	}
@@ -260,13 +511,12 @@ func (c *RoomClient) processMsgs(msg []byte) (errs []error) {
 	return errs
 }
 
-func (c *RoomClient) processMsg(msgStr string) (err error) {
-	var updateGameActivity bool
+func (c *RoomClient) processMsg(msgFields []string) (err error) {
+	start := time.Now()
 
-	switch msgFields := strings.Split(msgStr, delim); msgFields[0] {
+	switch msgFields[0] {
 	case "sr": // switch room
 		err = c.handleSr(msgFields)
-		updateGameActivity = true
 	case "m", "tp", "jmp": // moved / teleported / jumped to x y
 		err = c.handleM(msgFields)
 	case "f": // change facing direction
@@ -308,18 +558,21 @@ func (c *RoomClient) processMsg(msgStr string) (err error) {
 		return err
 	}
 
-	if updateGameActivity {
-		err = c.session.updatePlayerGameActivity(true)
-		if err != nil {
-			writeErrLog(c.session.uuid, c.mapId, err.Error())
-		}
-	}
+	metrics.roomMessages.inc(msgFields[0])
 
-	writeLog(c.session.uuid, c.mapId, msgStr, 200)
+	logMessage(c.session.uuid, c.mapId, msgFields[0], strings.Join(msgFields, delim), time.Since(start))
 
 	return nil
 }
 
+// updateGameActivity records the room switch in the player's game activity,
+// it must not be used from the room's goroutine
+func (c *RoomClient) updateGameActivity() {
+	if err := c.session.updatePlayerGameActivity(true); err != nil {
+		writeErrLog(c.session.uuid, c.mapId, err.Error())
+	}
+}
+
 func (c *RoomClient) getRoomPlayerData() {
 	// send the new client info about the game state
 	for _, client := range c.room.clients {
@@ -344,40 +597,40 @@ func (c *RoomClient) getPlayerData(client *RoomClient) {
 		return
 	}
 
-	c.outbox <- buildMsg("c", client.session.id, client.session.uuid, client.session.rank, client.session.account, client.session.badge, client.session.medals[:])
+	c.outbox.send(buildMsg("c", client.session.id, client.session.uuid, client.session.rank, client.session.account, client.session.badge, client.session.medals[:]))
 
 	// client.x and client.y get set at the same time
 	// only one needs to be checked
 	if client.x != -1 {
-		c.outbox <- buildMsg("m", client.session.id, client.x, client.y)
+		c.outbox.send(buildMsg("m", client.session.id, client.x, client.y))
 	}
 	if client.facing != defaultFacing {
-		c.outbox <- buildMsg("f", client.session.id, client.facing)
+		c.outbox.send(buildMsg("f", client.session.id, client.facing))
 	}
 	if client.speed != 0 {
-		c.outbox <- buildMsg("spd", client.session.id, client.speed)
+		c.outbox.send(buildMsg("spd", client.session.id, client.speed))
 	}
 	if client.session.name != "" {
-		c.outbox <- buildMsg("name", client.session.id, client.session.name)
+		c.outbox.send(buildMsg("name", client.session.id, client.session.name))
 	}
 	if client.session.spriteIndex != -1 {
-		c.outbox <- buildMsg("spr", client.session.id, client.session.sprite, client.session.spriteIndex) // if the other client sent us valid sprite and index before
+		c.outbox.send(buildMsg("spr", client.session.id, client.session.sprite, client.session.spriteIndex)) // if the other client sent us valid sprite and index before
 	}
 	if client.repeatingFlash {
-		c.outbox <- buildMsg("rfl", client.session.id, client.flash[:])
+		c.outbox.send(buildMsg("rfl", client.session.id, client.flash[:]))
 	}
 	if client.transparency != 0 {
-		c.outbox <- buildMsg("tr", client.session.id, client.transparency)
+		c.outbox.send(buildMsg("tr", client.session.id, client.transparency))
 	}
 	if client.hidden {
-		c.outbox <- buildMsg("h", client.session.id, 1)
+		c.outbox.send(buildMsg("h", client.session.id, 1))
 	}
 	if client.session.system != "" {
-		c.outbox <- buildMsg("sys", client.session.id, client.session.system)
+		c.outbox.send(buildMsg("sys", client.session.id, client.session.system))
 	}
 	for i, pic := range client.pictures {
 		if pic != nil {
-			c.outbox <- buildMsg("ap", client.session.id, i+1, pic.posX, pic.posY, pic.mapX, pic.mapY, pic.panX, pic.panY, pic.magnify, pic.topTrans, pic.bottomTrans, pic.red, pic.blue, pic.green, pic.saturation, pic.effectMode, pic.effectPower, pic.name, pic.useTransparentColor, pic.fixedToMap, pic.spritesheetCols, pic.spritesheetRows, pic.spritesheetFrame, pic.spritesheetSpeed, pic.spritesheetPlayOnce, pic.mapLayer, pic.battleLayer, pic.flags, pic.blendMode, pic.flipX, pic.flipY, pic.origin)
+			c.outbox.send(buildMsg("ap", client.session.id, i+1, pic.posX, pic.posY, pic.mapX, pic.mapY, pic.panX, pic.panY, pic.magnify, pic.topTrans, pic.bottomTrans, pic.red, pic.blue, pic.green, pic.saturation, pic.effectMode, pic.effectPower, pic.name, pic.useTransparentColor, pic.fixedToMap, pic.spritesheetCols, pic.spritesheetRows, pic.spritesheetFrame, pic.spritesheetSpeed, pic.spritesheetPlayOnce, pic.mapLayer, pic.battleLayer, pic.flags, pic.blendMode, pic.flipX, pic.flipY, pic.origin))
 		}
 	}
 }
@@ -385,20 +638,8 @@ func (c *RoomClient) getPlayerData(client *RoomClient) {
 func (c *RoomClient) getRoomEventData() {
 	c.checkRoomConditions("", "")
 
-	for _, minigame := range c.room.minigames {
-		if minigame.Dev && c.session.rank < 1 {
-			continue
-		}
-		score, err := getPlayerMinigameScore(c.session.uuid, minigame.Id)
-		if err != nil {
-			writeErrLog(c.session.uuid, c.mapId, "failed to read player minigame score for "+minigame.Id)
-		}
-		c.minigameScores = append(c.minigameScores, score)
-		varSyncType := 1
-		if minigame.InitialVarSync {
-			varSyncType = 2
-		}
-		c.outbox <- buildMsg("sv", minigame.VarId, varSyncType)
+	if len(c.room.minigames) != 0 {
+		c.loadMinigameScores(c.room)
 	}
 
 	// send variable sync request for vending machine expeditions
@@ -406,14 +647,14 @@ func (c *RoomClient) getRoomEventData() {
 		return
 	}
 
-	if mapVmGroups, hasVms := gameEventVms[config.gameName]; hasVms {
+	if mapVmGroups, hasVms := getEventVms()[getConfig().gameName]; hasVms {
 		if vmGroups, hasMapVms := mapVmGroups[c.room.id]; hasMapVms {
 			for _, vmGroup := range vmGroups {
 				if !slices.Equal(vmGroup, currentEventVmGroup) {
 					continue
 				}
 				for _, eventId := range vmGroup {
-					c.outbox <- buildMsg("sev", eventId, 1)
+					c.outbox.send(buildMsg("sev", eventId, 1))
 				}
 			}
 		}
@@ -0,0 +1,211 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRoomSimulation has players move, chat and switch rooms at the same
+// time, run it with -race to check the room and session goroutines
+func TestRoomSimulation(t *testing.T) {
+	const (
+		players = 16
+		actions = 100
+	)
+
+	testClients := make([]*testClient, players)
+	for i := range testClients {
+		testClients[i] = connectTestClient(t, i, 1+i%testRooms)
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range testClients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			c.sendSession("name", "player"+strconv.Itoa(i))
+			c.sendRoom("sys", "system")
+
+			for range actions {
+				var err error
+				switch rand.IntN(10) {
+				case 0:
+					err = c.sendRoom("sr", strconv.Itoa(1+rand.IntN(testRooms)))
+				case 1:
+					err = c.sendSession("ploc", "0001", "")
+				case 2:
+					err = c.sendSession("say", "hello")
+				case 3:
+					err = c.sendSession("gsay", "hello")
+				case 4:
+					err = c.sendRoom("ss", strconv.Itoa(rand.IntN(10)), "1")
+				case 5:
+					err = c.sendRoom("sv", strconv.Itoa(rand.IntN(10)), strconv.Itoa(rand.IntN(100)))
+				case 6:
+					err = c.sendSession("l", "location")
+				default:
+					err = c.sendRoom("m", strconv.Itoa(rand.IntN(20)), strconv.Itoa(rand.IntN(20)))
+				}
+				if err != nil {
+					t.Errorf("client %d: %s", i, err)
+					return
+				}
+
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	// look the players up from elsewhere while they move around
+	stop := make(chan struct{})
+	lookups := make(chan struct{})
+	go func() {
+		defer close(lookups)
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			for _, c := range testClients {
+				canSpectate(context.Background(), c.uuid, rooms[1])
+
+				if session, ok := clients.Load(c.uuid); ok {
+					session.getRoomState()
+				}
+			}
+
+			updateLocationPlayerCounts()
+		}
+	}()
+
+	wg.Wait()
+	close(stop)
+	<-lookups
+
+	// every player is still connected and in exactly one room
+	for _, c := range testClients {
+		if err := c.sendSession("i"); err != nil {
+			t.Fatalf("client %d lost its session: %s", c.id, err)
+		}
+	}
+
+	uuids := make(map[string]bool)
+	for _, c := range testClients {
+		uuids[c.uuid] = true
+	}
+
+	// the last room switches may still be under way
+	waitFor(t, "every player to be in one room", func() bool {
+		var population int
+		for roomId := 1; roomId <= testRooms; roomId++ {
+			for _, room := range getRoomInstances(roomId) {
+				room.call(func() {
+					for _, client := range room.clients {
+						if uuids[client.session.uuid] {
+							population++
+						}
+					}
+				})
+			}
+		}
+		return population == players
+	})
+
+	for _, c := range testClients {
+		c.close()
+	}
+
+	waitForNoClients(t)
+}
+
+// waitForNoClients waits until every closed connection has been cleaned up
+func waitForNoClients(t testing.TB) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for clients.GetAmount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients still connected", clients.GetAmount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRenameInRoom renames a player from the api while others join the
+// room and read their name, run it with -race
+func TestRenameInRoom(t *testing.T) {
+	renamed := connectTestClient(t, newTestPlayer(), 2)
+	other := connectTestClient(t, newTestPlayer(), 3)
+
+	stop := make(chan struct{})
+	switches := make(chan struct{})
+	go func() {
+		defer close(switches)
+
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			// joining a room sends the names of everyone in it
+			other.sendRoom("sr", strconv.Itoa(2+i%2))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	const renames = 50
+	for i := range renames {
+		if err := tryChangePlayerUsername(context.Background(), systemUuid, renamed.uuid, "renamed"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(stop)
+	<-switches
+
+	session, ok := clients.Load(renamed.uuid)
+	if !ok {
+		t.Fatal("renamed player lost its session")
+	}
+
+	var name string
+	session.inRoom(func(*Room) {
+		name = session.name
+	})
+	if want := "renamed" + strconv.Itoa(renames-1); name != want {
+		t.Fatalf("name is %q, want %q", name, want)
+	}
+
+	renamed.close()
+	other.close()
+
+	waitForNoClients(t)
+}
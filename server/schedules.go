@@ -18,6 +18,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -91,13 +92,13 @@ func handleSchedules(w http.ResponseWriter, r *http.Request) {
 	token := r.Header.Get("Authorization")
 	if token == "" {
 		if commandParam == "list" || commandParam == "follow" {
-			uuid, banned, _ = getOrCreatePlayerData(getIp(r))
+			uuid, banned, _ = getOrCreatePlayerData(r.Context(), getIp(r))
 		} else {
 			handleError(w, r, "token not specified")
 			return
 		}
 	} else {
-		uuid, _, rank, _, banned, _ = getPlayerDataFromToken(token)
+		uuid, _, rank, _, banned, _ = getPlayerDataFromToken(r.Context(), token)
 		if uuid == "" {
 			handleError(w, r, "invalid token")
 			return
@@ -111,7 +112,7 @@ func handleSchedules(w http.ResponseWriter, r *http.Request) {
 
 	switch commandParam {
 	case "list":
-		schedules, err := listSchedules(uuid, rank)
+		schedules, err := listSchedules(r.Context(), uuid, rank)
 		if err != nil {
 			handleError(w, r, "error listing schedules: "+err.Error())
 			return
@@ -185,7 +186,7 @@ func handleSchedules(w http.ResponseWriter, r *http.Request) {
 				Bilibili: query.Get("bilibili"),
 			},
 		}
-		id, err = updateSchedule(id, rank, uuid, payload)
+		id, err = updateSchedule(r.Context(), id, rank, uuid, payload)
 		if err != nil {
 			fmt.Printf("updateSchedules: %s", err)
 			handleError(w, r, fmt.Sprintf("error creating/updating schedule: %s", err))
@@ -200,7 +201,7 @@ func handleSchedules(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		shouldFollow := query.Get("value") == "true"
-		followCount, err := followSchedule(uuid, scheduleId, shouldFollow)
+		followCount, err := followSchedule(r.Context(), uuid, scheduleId, shouldFollow)
 		if err != nil {
 			fmt.Printf("followSchedules: %s", err)
 			handleError(w, r, "error following schedule")
@@ -213,7 +214,7 @@ func handleSchedules(w http.ResponseWriter, r *http.Request) {
 			handleError(w, r, "invalid scheduleId")
 			return
 		}
-		err = cancelSchedule(uuid, rank, scheduleId)
+		err = cancelSchedule(r.Context(), uuid, rank, scheduleId)
 		if err != nil {
 			fmt.Printf("cancelSchedules: %s", err)
 			handleError(w, r, "error cancelling schedule")
@@ -234,80 +235,28 @@ func clampDatetime(datetime, now time.Time) time.Time {
 	return datetime
 }
 
-func listSchedules(uuid string, rank int) ([]*ScheduleDisplay, error) {
-	var schedules []*ScheduleDisplay
-	partyId, err := getPlayerPartyId(uuid)
+func listSchedules(ctx context.Context, uuid string, rank int) ([]*ScheduleDisplay, error) {
+	partyId, err := getPlayerPartyId(ctx, uuid)
 	if err != nil {
-		return schedules, err
+		return nil, err
 	}
 
-	query := `
-WITH tally AS (SELECT scheduleId, COUNT(uuid) AS followerCount FROM playerScheduleFollows GROUP BY scheduleId)
-SELECT s.id, s.name, s.description, s.ownerUuid, acc.user AS ownerName, pd.rank AS ownerRank, acc.badge, pgd.systemName,
-	   s.partyId, s.game, s.official, s.recurring, s.intervalValue, s.intervalType, s.datetime, s.systemName, s.discord, s.youtube, s.twitch, s.niconico, s.openrec, s.bilibili,
-	   COALESCE(tally.followerCount, 0) AS followerCount, CASE WHEN s.id IN (SELECT scheduleId FROM playerScheduleFollows WHERE uuid = ?) THEN 1 ELSE 0 END AS playerLiked
-FROM schedules s
-JOIN accounts acc ON acc.uuid = s.ownerUuid
-JOIN playerGameData pgd ON pgd.uuid = s.ownerUuid AND pgd.game = ?
-JOIN players pd ON pd.uuid = s.ownerUuid
-LEFT JOIN tally ON tally.scheduleId = s.id
-WHERE COALESCE(s.partyId, 0) IN (0, ?) OR ?`
-
-	results, err := db.Query(query, uuid, config.gameName, partyId, rank > 0)
-	if err != nil {
-		return schedules, err
-	}
-	defer results.Close()
-	for results.Next() {
-		var s ScheduleDisplay
-		err := results.Scan(&s.Id, &s.Name, &s.Description, &s.OwnerUuid, &s.OwnerName, &s.OwnerRank, &s.OwnerBadge, &s.OwnerSystemName, &s.PartyId, &s.Game, &s.Official,
-			&s.Recurring, &s.IntervalValue, &s.IntervalType, &s.Datetime, &s.SystemName, &s.Discord, &s.Youtube, &s.Twitch, &s.Niconico, &s.Openrec, &s.Bilibili, &s.FollowerCount, &s.PlayerLiked)
-		if err != nil {
-			return schedules, err
-		}
-		schedules = append(schedules, &s)
-	}
-	return schedules, nil
+	return store.schedules.listSchedules(ctx, uuid, partyId, rank > 0)
 }
 
-func updateSchedule(id int, rank int, uuid string, s *ScheduleUpdate) (int, error) {
+func updateSchedule(ctx context.Context, id int, rank int, uuid string, s *ScheduleUpdate) (int, error) {
 	if id == 0 {
-		query := `
-INSERT INTO schedules
-	(name, description, ownerUuid, partyId, game, official, recurring, intervalValue, intervalType, datetime, systemName, discord, youtube, twitch, niconico, openrec, bilibili)
-VALUES
-	(   ?,           ?,         ?,       ?,    ?,         ?,        ?,             ?,            ?,        ?,          ?,       ?,       ?,      ?,        ?,       ?,        ?)`
-		results, err := db.Exec(query, s.Name, s.Description, s.OwnerUuid, s.PartyId, s.Game, s.Official, s.Recurring, s.IntervalValue, s.IntervalType, s.Datetime, s.SystemName,
-			s.Discord, s.Youtube, s.Twitch, s.Niconico, s.Openrec, s.Bilibili)
-		if err != nil {
-			return id, err
-		}
-		idLarge, err := results.LastInsertId()
+		newId, err := store.schedules.createSchedule(ctx, s)
 		if err != nil {
 			return id, err
 		} else {
 			setScheduleNotification(id, s.Datetime)
 		}
-		return int(idLarge), nil
+		return newId, nil
 	}
 
-	isMod := rank > 0
-	query := `
-UPDATE schedules SET
-	name = ?, description = ?, partyId = ?, game = ?, recurring = ?, intervalValue = ?, intervalType = ?, datetime = ?, systemName = ?,
-	official = (CASE WHEN ? THEN ? ELSE official END), ownerUuid = (CASE ? WHEN '' THEN ownerUuid ELSE ? END),
-	discord = ?, youtube = ?, twitch = ?, niconico = ?, openrec = ?, bilibili = ?
-WHERE id = ? AND (? OR ownerUuid = ?)`
-	results, err := db.Exec(query, s.Name, s.Description, s.PartyId, s.Game, s.Recurring, s.IntervalValue, s.IntervalType, s.Datetime, s.SystemName,
-		isMod, s.Official, s.OwnerUuid, s.OwnerUuid,
-		s.Discord, s.Youtube, s.Twitch, s.Niconico, s.Openrec, s.Bilibili,
-		id, isMod, uuid)
-
-	if err != nil {
-		return id, err
-	}
-	affected, err := results.RowsAffected()
-	if affected < 1 {
+	updated, err := store.schedules.updateSchedule(ctx, id, rank > 0, uuid, s)
+	if !updated {
 		return id, errors.Join(err, errors.New("did not update any schedules"))
 	}
 
@@ -345,7 +294,7 @@ func clearTimers() {
 
 func initScheduleTimers() {
 	ongoingLimit := time.Now().UTC().Add(15 * time.Minute)
-	results, err := db.Query("SELECT id, datetime FROM schedules WHERE datetime >= ? AND game = ?", ongoingLimit, config.gameName)
+	schedules, err := store.schedules.getUpcomingSchedules(context.Background(), ongoingLimit)
 	if err != nil {
 		log.Println("initScheduleTimers", err)
 		return
@@ -353,42 +302,22 @@ func initScheduleTimers() {
 
 	clearTimers()
 
-	defer results.Close()
-	for results.Next() {
-		var scheduleId int
-		var datetime time.Time
-		err = results.Scan(&scheduleId, &datetime)
-		if err != nil {
-			log.Println("initScheduleTimers", err)
-			continue
-		}
+	for scheduleId, datetime := range schedules {
 		setScheduleNotification(scheduleId, datetime)
 	}
 }
 
-func followSchedule(uuid string, scheduleId int, shouldFollow bool) (followCount int, _ error) {
-	var query string
-	if shouldFollow {
-		query = "INSERT IGNORE INTO playerScheduleFollows (uuid, scheduleId) VALUES (?, ?)"
-	} else {
-		query = "DELETE FROM playerScheduleFollows WHERE uuid = ? AND scheduleId = ?"
-	}
-	results, err := db.Exec(query, uuid, scheduleId)
-	if err != nil {
-		return 0, err
-	}
-
-	rowsAffected, err := results.RowsAffected()
-	if err != nil || rowsAffected < 1 {
+func followSchedule(ctx context.Context, uuid string, scheduleId int, shouldFollow bool) (followCount int, _ error) {
+	changed, err := store.schedules.followSchedule(ctx, uuid, scheduleId, shouldFollow)
+	if err != nil || !changed {
 		return 0, errors.Join(err, errors.New("failed to follow/unfollow"))
 	}
 
-	err = db.QueryRow("SELECT COUNT(uuid) FROM playerScheduleFollows WHERE scheduleId = ?", scheduleId).Scan(&followCount)
-	return followCount, err
+	return store.schedules.getScheduleFollowCount(ctx, scheduleId)
 }
 
-func cancelSchedule(uuid string, rank int, scheduleId int) error {
-	_, err := db.Exec("DELETE FROM schedules WHERE id = (SELECT id FROM schedules WHERE id = ? AND (? OR ownerUuid = ?))", scheduleId, rank > 0, uuid)
+func cancelSchedule(ctx context.Context, uuid string, rank int, scheduleId int) error {
+	err := store.schedules.cancelSchedule(ctx, uuid, rank > 0, scheduleId)
 	if err == nil {
 		if timer, ok := timers[scheduleId]; ok && timer != nil {
 			timer.Stop()
@@ -399,19 +328,12 @@ func cancelSchedule(uuid string, rank int, scheduleId int) error {
 }
 
 func clearDoneSchedules() {
-	_, err := db.Exec("DELETE FROM schedules WHERE datetime < NOW() AND NOT recurring AND game = ?", config.gameName)
+	err := store.schedules.deleteDoneSchedules(context.Background())
 	if err != nil {
 		fmt.Printf("error deleting non-recurring events: %s", err)
 	}
 
-	_, err = db.Exec(`
-UPDATE schedules
-SET datetime = CASE intervalType
-    WHEN 'days' THEN DATE_ADD(datetime, INTERVAL intervalValue DAY)
-    WHEN 'months' THEN DATE_ADD(datetime, INTERVAL intervalValue MONTH)
-    WHEN 'years' THEN DATE_ADD(datetime, INTERVAL intervalValue YEAR)
-    ELSE datetime
-END WHERE recurring AND datetime < NOW() AND game = ?`, config.gameName)
+	err = store.schedules.advanceRecurringSchedules(context.Background())
 	if err != nil {
 		fmt.Printf("error calculating recurring events: %s", err)
 	}
@@ -419,34 +341,16 @@ END WHERE recurring AND datetime < NOW() AND game = ?`, config.gameName)
 }
 
 func sendScheduleNotification(scheduleId int) error {
-	query := `
-SELECT psf.uuid
-FROM schedules s
-JOIN playerScheduleFollows psf ON psf.scheduleId = s.id
-WHERE s.id = ?`
-	results, err := db.Query(query, scheduleId)
+	uuids, err := store.schedules.getScheduleFollowers(context.Background(), scheduleId)
 	if err != nil {
 		return err
 	}
-	defer results.Close()
-	var uuids []string
-	for results.Next() {
-		var uuid string
-		err = results.Scan(&uuid)
-		if err != nil {
-			return err
-		}
-		uuids = append(uuids, uuid)
-	}
 
 	if len(uuids) < 1 {
 		return nil
 	}
 
-	var scheduleName string
-	var gameId string
-	var datetime time.Time
-	err = db.QueryRow("SELECT name, game, datetime FROM schedules WHERE id = ?", scheduleId).Scan(&scheduleName, &gameId, &datetime)
+	scheduleName, gameId, datetime, err := store.schedules.getScheduleInfo(context.Background(), scheduleId)
 	if err != nil {
 		return err
 	}
@@ -19,6 +19,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -99,7 +100,7 @@ func handleScreenshot(w http.ResponseWriter, r *http.Request) {
 	var uuid string
 
 	if token != "" {
-		uuid = getUuidFromToken(token)
+		uuid = getUuidFromToken(r.Context(), token)
 
 		if uuid == "" && accountRequired {
 			handleError(w, r, "invalid token")
@@ -167,7 +168,7 @@ func handleScreenshot(w http.ResponseWriter, r *http.Request) {
 			intervalParam = "day"
 		}
 
-		screenshots, err := getScreenshotFeed(uuid, limit, offset, offsetIdParam, gameParam, sortOrderParam, intervalParam)
+		screenshots, err := getScreenshotFeed(r.Context(), uuid, limit, offset, offsetIdParam, gameParam, sortOrderParam, intervalParam)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -191,7 +192,7 @@ func handleScreenshot(w http.ResponseWriter, r *http.Request) {
 			uuidParam = uuid
 		}
 
-		playerScreenshots, err := getPlayerScreenshots(uuidParam)
+		playerScreenshots, err := getPlayerScreenshots(r.Context(), uuidParam)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -206,7 +207,7 @@ func handleScreenshot(w http.ResponseWriter, r *http.Request) {
 		w.Write(playerScreenshotsJson)
 		return
 	case "getScreenshotGames":
-		screenshotGames, err := getScreenshotGames()
+		screenshotGames, err := getScreenshotGames(r.Context())
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -269,7 +270,7 @@ func handleScreenshot(w http.ResponseWriter, r *http.Request) {
 
 		id := getNanoId()
 
-		err = writeScreenshotData(id, uuid, config.gameName, mapIdParam, mapX, mapY, temp)
+		err = writeScreenshotData(r.Context(), id, uuid, getConfig().gameName, mapIdParam, mapX, mapY, temp)
 		if err != nil {
 			handleInternalError(w, r, err)
 			return
@@ -317,9 +318,9 @@ func handleScreenshot(w http.ResponseWriter, r *http.Request) {
 				var success bool
 				var err error
 				if commandParam == "setPublic" {
-					success, err = setPlayerScreenshotPublic(idParam, uuid, value)
+					success, err = setPlayerScreenshotPublic(r.Context(), idParam, uuid, value)
 				} else {
-					success, err = setPlayerScreenshotSpoiler(idParam, uuid, value)
+					success, err = setPlayerScreenshotSpoiler(r.Context(), idParam, uuid, value)
 				}
 				if err != nil {
 					handleInternalError(w, r, err)
@@ -332,9 +333,9 @@ func handleScreenshot(w http.ResponseWriter, r *http.Request) {
 				}
 
 				if commandParam == "setPublic" && valueParam == "1" {
-					_, name, _, badge, _, _ := getPlayerDataFromToken(r.Header.Get("Authorization"))
+					_, name, _, badge, _, _ := getPlayerDataFromToken(r.Context(), r.Header.Get("Authorization"))
 
-					err = sendWebhookMessage(config.screenshotWebhook, name, badge, fmt.Sprintf("https://connect.ynoproject.net/%s/screenshots/%s/%s.png", config.gameName, uuid, idParam), false)
+					err = sendWebhookMessage(getConfig().screenshotWebhook, name, badge, fmt.Sprintf("https://connect.ynoproject.net/%s/screenshots/%s/%s.png", getConfig().gameName, uuid, idParam), false)
 					if err != nil {
 						handleError(w, r, "failed to send to webhook")
 						return
@@ -344,9 +345,9 @@ func handleScreenshot(w http.ResponseWriter, r *http.Request) {
 				var err error
 				var success bool
 				if value {
-					success, err = writePlayerScreenshotLike(idParam, uuid)
+					success, err = writePlayerScreenshotLike(r.Context(), idParam, uuid)
 				} else {
-					success, err = deletePlayerScreenshotLike(idParam, uuid)
+					success, err = deletePlayerScreenshotLike(r.Context(), idParam, uuid)
 				}
 				if err != nil {
 					handleInternalError(w, r, err)
@@ -370,7 +371,7 @@ func handleScreenshot(w http.ResponseWriter, r *http.Request) {
 				ownerUuid = uuidParam
 			}
 
-			success, err := deleteScreenshot(idParam, uuid)
+			success, err := deleteScreenshot(r.Context(), idParam, uuid)
 			if err != nil {
 				handleInternalError(w, r, err)
 				return
@@ -400,8 +401,8 @@ func handleScreenshot(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func getPlayerScreenshotLimit(uuid string) (screenshotLimit int) {
-	err := db.QueryRow("SELECT screenshotLimit FROM accounts WHERE uuid = ?", uuid).Scan(&screenshotLimit)
+func getPlayerScreenshotLimit(ctx context.Context, uuid string) (screenshotLimit int) {
+	screenshotLimit, err := store.screenshots.getPlayerScreenshotLimit(ctx, uuid)
 	if err != nil {
 		return defaultPlayerScreenshotLimit
 	}
@@ -409,87 +410,12 @@ func getPlayerScreenshotLimit(uuid string) (screenshotLimit int) {
 	return screenshotLimit
 }
 
-func getScreenshotFeed(uuid string, limit int, offset int, offsetId string, game string, sortOrder string, intervalType string) ([]*ScreenshotData, error) {
-	var screenshots []*ScreenshotData
-
-	var queryArgs []any
-
-	var cteClause string
-	var selectClause string
-	var fromJoinClause string
-	var whereClause string
-	var orderByClause string
-
-	selectClause = "SELECT ps.id, op.uuid, oa.user, op.rank, COALESCE(oa.badge, ''), opgd.systemName, ps.game, ps.mapId, ps.mapX, ps.mapY, ps.publicTimestamp, ps.spoiler, (SELECT COUNT(*) FROM playerScreenshotLikes psl WHERE psl.screenshotId = ps.id) AS likeCount, CASE WHEN upsl.uuid IS NULL THEN 0 ELSE 1 END"
-
-	fromJoinClause = " FROM playerScreenshots ps JOIN players op ON op.uuid = ps.uuid JOIN accounts oa ON oa.uuid = op.uuid JOIN playerGameData opgd ON opgd.uuid = op.uuid AND opgd.game = ps.game LEFT JOIN playerScreenshotLikes upsl ON upsl.screenshotId = ps.id AND upsl.uuid = ? "
-
-	if offsetId != "" && sortOrder != "likes" {
-		cteClause = "WITH offsetScreenshot AS (SELECT publicTimestamp FROM playerScreenshots WHERE id = ?) "
-		fromJoinClause += "JOIN offsetScreenshot ops ON ops.publicTimestamp >= ps.publicTimestamp "
-		queryArgs = append(queryArgs, offsetId)
-	}
-
-	queryArgs = append(queryArgs, uuid)
-
-	whereClause = "WHERE ps.temp = 0 AND ps.public = 1 AND op.banned = 0 "
-
-	if game != "" {
-		whereClause += "AND ps.game = ? "
-		queryArgs = append(queryArgs, game)
-	}
-
-	if intervalType != "all" {
-		whereClause += "AND ps.publicTimestamp >= DATE_SUB(NOW(), INTERVAL 1 " + intervalType + ") "
-	}
-
-	orderByClause = "ORDER BY "
-
-	if sortOrder == "likes" {
-		if intervalType == "all" {
-			orderByClause += "likeCount"
-		} else {
-			orderByClause += "(SELECT COUNT(*) FROM playerScreenshotLikes ipsl WHERE ipsl.screenshotId = ps.id AND ipsl.timestamp >= DATE_SUB(NOW(), INTERVAL 1 " + intervalType + "))"
-		}
-		orderByClause += " DESC, "
-	}
-
-	orderByClause += "ps.publicTimestamp DESC, op.uuid, ps.id DESC "
-
-	query := cteClause + selectClause + fromJoinClause + whereClause + orderByClause + "LIMIT ?, ?"
-
-	queryArgs = append(queryArgs, offset, limit)
-
-	results, err := db.Query(query, queryArgs...)
-	if err != nil {
-		return screenshots, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var screenshot ScreenshotData
-		var owner ScreenshotOwner
-
-		err := results.Scan(&screenshot.Id, &owner.Uuid, &owner.Name, &owner.Rank, &owner.Badge, &owner.SystemName, &screenshot.Game, &screenshot.MapId, &screenshot.MapX, &screenshot.MapY, &screenshot.Timestamp, &screenshot.Spoiler, &screenshot.LikeCount, &screenshot.Liked)
-		if err != nil {
-			return screenshots, err
-		}
-
-		screenshot.Public = true
-		screenshot.Owner = &owner
-		screenshots = append(screenshots, &screenshot)
-	}
-
-	return screenshots, nil
+func getScreenshotFeed(ctx context.Context, uuid string, limit int, offset int, offsetId string, game string, sortOrder string, intervalType string) ([]*ScreenshotData, error) {
+	return store.screenshots.getScreenshotFeed(ctx, uuid, limit, offset, offsetId, game, sortOrder, intervalType)
 }
 
-func getScreenshotInfo(uuid string, ownerUuid string, id string) (*ScreenshotData, error) {
-	screenshot := &ScreenshotData{}
-	owner := &ScreenshotOwner{}
-
-	query := "SELECT ps.id, op.uuid, oa.user, op.rank, COALESCE(oa.badge, ''), opgd.systemName, ps.game, ps.mapId, ps.mapX, ps.mapY, ps.publicTimestamp, ps.public, ps.spoiler, (SELECT COUNT(*) FROM playerScreenshotLikes psl WHERE psl.screenshotId = ps.id) AS likeCount, CASE WHEN upsl.uuid IS NULL THEN 0 ELSE 1 END FROM playerScreenshots ps JOIN players op ON op.uuid = ps.uuid JOIN accounts oa ON oa.uuid = op.uuid JOIN playerGameData opgd ON opgd.uuid = op.uuid AND opgd.game = ps.game LEFT JOIN playerScreenshotLikes upsl ON upsl.screenshotId = ps.id AND upsl.uuid = ? WHERE ps.uuid = ? AND ps.id = ?"
-	err := db.QueryRow(query, uuid, ownerUuid, id).Scan(&screenshot.Id, &owner.Uuid, &owner.Name, &owner.Rank, &owner.Badge, &owner.SystemName, &screenshot.Game, &screenshot.MapId, &screenshot.MapX, &screenshot.MapY, &screenshot.Timestamp, &screenshot.Public, &screenshot.Spoiler, &screenshot.LikeCount, &screenshot.Liked)
+func getScreenshotInfo(ctx context.Context, uuid string, ownerUuid string, id string) (*ScreenshotData, error) {
+	screenshot, err := store.screenshots.getScreenshotInfo(ctx, uuid, ownerUuid, id)
 	if err != nil {
 		return nil, err
 	}
@@ -498,60 +424,19 @@ func getScreenshotInfo(uuid string, ownerUuid string, id string) (*ScreenshotDat
 		return nil, nil
 	}
 
-	screenshot.Owner = owner
-
 	return screenshot, nil
 }
 
-func getPlayerScreenshots(uuid string) ([]*PlayerScreenshotData, error) {
-	var playerScreenshots []*PlayerScreenshotData
-
-	results, err := db.Query("SELECT ps.id, ps.uuid, ps.game, ps.mapId, ps.mapX, ps.mapY, opgd.systemName, ps.timestamp, ps.public, ps.spoiler, (SELECT COUNT(*) FROM playerScreenshotLikes psl WHERE psl.screenshotId = ps.id), CASE WHEN upsl.uuid IS NULL THEN 0 ELSE 1 END FROM playerScreenshots ps JOIN playerGameData opgd ON opgd.uuid = ps.uuid AND opgd.game = ps.game LEFT JOIN playerScreenshotLikes upsl ON upsl.screenshotId = ps.id AND upsl.uuid = ps.uuid WHERE ps.uuid = ? AND ps.temp = 0 ORDER BY ps.timestamp DESC, ps.id", uuid)
-	if err != nil {
-		return playerScreenshots, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var screenshot PlayerScreenshotData
-
-		err := results.Scan(&screenshot.Id, &screenshot.Uuid, &screenshot.Game, &screenshot.MapId, &screenshot.MapX, &screenshot.MapY, &screenshot.SystemName, &screenshot.Timestamp, &screenshot.Public, &screenshot.Spoiler, &screenshot.LikeCount, &screenshot.Liked)
-		if err != nil {
-			return playerScreenshots, err
-		}
-
-		playerScreenshots = append(playerScreenshots, &screenshot)
-	}
-
-	return playerScreenshots, nil
+func getPlayerScreenshots(ctx context.Context, uuid string) ([]*PlayerScreenshotData, error) {
+	return store.screenshots.getPlayerScreenshots(ctx, uuid)
 }
 
-func getScreenshotGames() ([]string, error) {
-	var screenshotGames []string
-
-	results, err := db.Query("SELECT DISTINCT game FROM playerScreenshots")
-	if err != nil {
-		return screenshotGames, err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var game string
-		err := results.Scan(&game)
-		if err != nil {
-			return screenshotGames, err
-		}
-		screenshotGames = append(screenshotGames, game)
-	}
-
-	return screenshotGames, nil
+func getScreenshotGames(ctx context.Context) ([]string, error) {
+	return store.screenshots.getScreenshotGames(ctx)
 }
 
-func writeScreenshotData(id string, uuid string, game string, mapId string, mapX int, mapY int, temp bool) error {
-	var playerScreenshotCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM playerScreenshots WHERE uuid = ? AND temp = ?", uuid, temp).Scan(&playerScreenshotCount)
+func writeScreenshotData(ctx context.Context, id string, uuid string, game string, mapId string, mapX int, mapY int, temp bool) error {
+	playerScreenshotCount, err := store.screenshots.getPlayerScreenshotCount(ctx, uuid, temp)
 	if err != nil {
 		return err
 	} else {
@@ -560,114 +445,42 @@ func writeScreenshotData(id string, uuid string, game string, mapId string, mapX
 				return errors.New("screenshot limit exceeded")
 			}
 		} else {
-			playerScreenshotLimit := getPlayerScreenshotLimit(uuid)
+			playerScreenshotLimit := getPlayerScreenshotLimit(ctx, uuid)
 			if playerScreenshotCount >= playerScreenshotLimit {
 				return errors.New("screenshot limit exceeded")
 			}
 		}
 	}
 
-	_, err = db.Exec("INSERT INTO playerScreenshots (id, uuid, game, mapId, mapX, mapY, public, publicTimestamp, temp) VALUES (?, ?, ?, ?, ?, ?, ?, CASE WHEN ? = 1 THEN UTC_TIMESTAMP() ELSE NULL END, ?)", id, uuid, game, mapId, mapX, mapY, temp, temp, temp)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return store.screenshots.writeScreenshotData(ctx, id, uuid, game, mapId, mapX, mapY, temp)
 }
 
-func setPlayerScreenshotPublic(id string, uuid string, value bool) (bool, error) {
-	results, err := db.Exec("UPDATE playerScreenshots SET public = ?, publicTimestamp = COALESCE(publicTimestamp, NOW()) WHERE id = ? AND EXISTS (SELECT * FROM playerScreenshots ps JOIN players p ON p.uuid = ? JOIN players op ON op.uuid = ps.uuid WHERE p.uuid = op.uuid OR p.rank > op.rank)", value, id, uuid)
-	if err != nil {
-		return false, err
-	}
-
-	updatedRows, err := results.RowsAffected()
-	if err != nil {
-		return false, err
-	}
-
-	return updatedRows > 0, nil
+func setPlayerScreenshotPublic(ctx context.Context, id string, uuid string, value bool) (bool, error) {
+	return store.screenshots.setPlayerScreenshotPublic(ctx, id, uuid, value)
 }
 
-func setPlayerScreenshotSpoiler(id string, uuid string, value bool) (bool, error) {
-	results, err := db.Exec("UPDATE playerScreenshots SET spoiler = ? WHERE id = ? AND EXISTS (SELECT * FROM playerScreenshots ps JOIN players p ON p.uuid = ? JOIN players op ON op.uuid = ps.uuid WHERE p.uuid = op.uuid OR p.rank > op.rank)", value, id, uuid)
-	if err != nil {
-		return false, err
-	}
-
-	updatedRows, err := results.RowsAffected()
-	if err != nil {
-		return false, err
-	}
-
-	return updatedRows > 0, nil
+func setPlayerScreenshotSpoiler(ctx context.Context, id string, uuid string, value bool) (bool, error) {
+	return store.screenshots.setPlayerScreenshotSpoiler(ctx, id, uuid, value)
 }
 
-func writePlayerScreenshotLike(id string, uuid string) (bool, error) {
-	results, err := db.Exec("INSERT IGNORE INTO playerScreenshotLikes (screenshotId, uuid) VALUES (?, ?)", id, uuid)
-	if err != nil {
-		return false, err
-	}
-
-	insertedRows, err := results.RowsAffected()
-	if err != nil {
-		return false, err
-	}
-
-	return insertedRows > 0, nil
+func writePlayerScreenshotLike(ctx context.Context, id string, uuid string) (bool, error) {
+	return store.screenshots.writePlayerScreenshotLike(ctx, id, uuid)
 }
 
-func deletePlayerScreenshotLike(id string, uuid string) (bool, error) {
-	results, err := db.Exec("DELETE FROM playerScreenshotLikes WHERE screenshotId = ? AND uuid = ?", id, uuid)
-	if err != nil {
-		return false, err
-	}
-
-	deletedRows, err := results.RowsAffected()
-	if err != nil {
-		return false, err
-	}
-
-	return deletedRows > 0, nil
+func deletePlayerScreenshotLike(ctx context.Context, id string, uuid string) (bool, error) {
+	return store.screenshots.deletePlayerScreenshotLike(ctx, id, uuid)
 }
 
-func deleteScreenshot(id string, uuid string) (bool, error) {
-	results, err := db.Exec("DELETE FROM playerScreenshots WHERE id = ? AND EXISTS (SELECT * FROM playerScreenshots ps JOIN players p ON p.uuid = ? JOIN players op ON op.uuid = ps.uuid WHERE p.uuid = op.uuid OR p.rank > op.rank)", id, uuid)
-	if err != nil {
-		return false, err
-	}
-
-	deletedRows, err := results.RowsAffected()
-	if err != nil {
-		return false, err
-	}
-
-	return deletedRows > 0, nil
+func deleteScreenshot(ctx context.Context, id string, uuid string) (bool, error) {
+	return store.screenshots.deleteScreenshot(ctx, id, uuid)
 }
 
 func deleteTempScreenshots() error {
-	results, err := db.Query("SELECT id, uuid FROM playerScreenshots WHERE temp = 1 AND timestamp < DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY)")
-	if err != nil {
-		return err
-	}
-
-	defer results.Close()
-
-	for results.Next() {
-		var screenshotId string
-		var uuid string
-		err = results.Scan(&screenshotId, &uuid)
-		if err != nil {
-			continue
-		}
-
-		os.Remove("screenshots/temp/" + uuid + "/" + screenshotId + ".png")
-	}
+	screenshots, err := store.screenshots.deleteTempScreenshots(context.Background())
 
-	_, err = db.Exec("DELETE FROM playerScreenshots WHERE temp = 1 AND timestamp < DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY)")
-	if err != nil {
-		return err
+	for _, screenshot := range screenshots {
+		os.Remove("screenshots/temp/" + screenshot.Uuid + "/" + screenshot.Id + ".png")
 	}
 
-	return nil
+	return err
 }
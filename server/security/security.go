@@ -18,49 +18,167 @@
 package security
 
 import (
-	"bytes"
-	"crypto/sha1"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"log"
-	"math/rand"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Signed messages start with a header of the key id the client signed with,
+// the truncated HMAC-SHA256 of the rest of the message and a counter:
+//
+//	[key id: 1][mac: 8][counter: 4][payload]
+//
+// The MAC covers the key id, the counter and the payload. Its key is derived
+// per connection from the ring key and a random nonce the server sends to the
+// client, so a key in the ring is never used directly.
+const (
+	keyIdSize   = 1
+	macSize     = 8
+	counterSize = 4
+	nonceSize   = 16
+
+	HeaderSize = keyIdSize + macSize + counterSize
 )
 
 type Security struct {
-	signKey []byte
+	keys  map[byte][]byte
+	mutex sync.RWMutex
+}
+
+type ClientKey struct {
+	nonce []byte
 }
 
 func New() *Security {
-	key, err := os.ReadFile("key.bin")
-	if err != nil {
-		log.Fatalf("failed to read key file!")
+	s := &Security{}
+
+	if err := s.LoadKeys(); err != nil {
+		log.Fatalf("failed to load keys: %s", err)
 	}
 
-	return &Security{signKey: key}
+	return s
 }
 
-func (s *Security) NewClientKey() uint32 {
-	return rand.Uint32()
+// LoadKeys replaces the key ring with keys/<id>.bin, where id is 0-255.
+// Keeping the old and new key in the ring for a while allows them to be
+// rotated without disconnecting clients built with the old one.
+// If there is no keys directory, key.bin is loaded as key 0.
+func (s *Security) LoadKeys() error {
+	keys := make(map[byte][]byte)
+
+	files, err := os.ReadDir("keys")
+	switch {
+	case err == nil:
+		for _, file := range files {
+			name, ok := strings.CutSuffix(file.Name(), ".bin")
+			if !ok {
+				continue
+			}
+
+			id, err := strconv.ParseUint(name, 10, 8)
+			if err != nil {
+				continue
+			}
+
+			key, err := os.ReadFile(filepath.Join("keys", file.Name()))
+			if err != nil {
+				return err
+			}
+
+			keys[byte(id)] = key
+		}
+	case os.IsNotExist(err):
+		key, err := os.ReadFile("key.bin")
+		if err != nil {
+			return err
+		}
+
+		keys[0] = key
+	default:
+		return err
+	}
+
+	if len(keys) == 0 {
+		return errors.New("key ring is empty")
+	}
+
+	s.mutex.Lock()
+	s.keys = keys
+	s.mutex.Unlock()
+
+	return nil
 }
 
-func (s *Security) VerifySignature(clientKey uint32, msg []byte) bool {
-	clientKeyBytes := make([]byte, 4)
+func (s *Security) NewClientKey() *ClientKey {
+	nonce := make([]byte, nonceSize)
+	rand.Read(nonce)
 
-	binary.BigEndian.PutUint32(clientKeyBytes, clientKey)
+	return &ClientKey{nonce: nonce}
+}
 
-	hash := sha1.New()
-	hash.Write(s.signKey)
-	hash.Write(clientKeyBytes)
-	hash.Write(msg[4:])
+// String returns the nonce the client derives its key from
+func (k *ClientKey) String() string {
+	return hex.EncodeToString(k.nonce)
+}
+
+func (s *Security) VerifySignature(clientKey *ClientKey, msg []byte) bool {
+	if len(msg) < HeaderSize {
+		return false
+	}
+
+	s.mutex.RLock()
+	key, ok := s.keys[msg[0]]
+	s.mutex.RUnlock()
 
-	return bytes.Equal(hash.Sum(nil)[:4], msg[:4])
+	if !ok {
+		return false
+	}
+
+	return hmac.Equal(computeMac(DeriveKey(key, clientKey.nonce), msg), msg[keyIdSize:keyIdSize+macSize])
 }
 
 func (s *Security) VerifyCounter(counter *uint32, msg []byte) bool {
-	if cnt := binary.BigEndian.Uint32(msg[4 : len(msg)-4]); *counter < cnt {
+	if cnt := binary.BigEndian.Uint32(msg[keyIdSize+macSize : HeaderSize]); *counter < cnt {
 		*counter = cnt
 		return true
 	}
 
 	return false
 }
+
+// DeriveKey returns the per connection key for a ring key and nonce
+func DeriveKey(key []byte, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(nonce)
+
+	return mac.Sum(nil)
+}
+
+// Sign builds a signed message, the way clients do
+func Sign(connKey []byte, keyId byte, counter uint32, payload []byte) []byte {
+	msg := make([]byte, HeaderSize, HeaderSize+len(payload))
+	msg[0] = keyId
+	binary.BigEndian.PutUint32(msg[keyIdSize+macSize:], counter)
+	msg = append(msg, payload...)
+
+	copy(msg[keyIdSize:], computeMac(connKey, msg))
+
+	return msg
+}
+
+func computeMac(connKey []byte, msg []byte) []byte {
+	mac := hmac.New(sha256.New, connKey)
+	mac.Write(msg[:keyIdSize])
+	mac.Write(msg[keyIdSize+macSize:])
+
+	return mac.Sum(nil)[:macSize]
+}
@@ -0,0 +1,283 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package security
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	testKey0 = []byte("test key 0")
+	testKey1 = []byte("test key 1")
+)
+
+// chdirTemp runs the test in an empty directory, LoadKeys reads from the working directory
+func chdirTemp(t *testing.T) string {
+	dir := t.TempDir()
+
+	prevDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(prevDir) })
+
+	return dir
+}
+
+func writeKey(t *testing.T, path string, key []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestSecurity(t *testing.T) *Security {
+	chdirTemp(t)
+	writeKey(t, "keys/0.bin", testKey0)
+	writeKey(t, "keys/1.bin", testKey1)
+
+	s := &Security{}
+	if err := s.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// connKey derives the key a client signs with, from the nonce the server sent it
+func connKey(t *testing.T, clientKey *ClientKey, key []byte) []byte {
+	nonce, err := hex.DecodeString(clientKey.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return DeriveKey(key, nonce)
+}
+
+func TestLoadKeys(t *testing.T) {
+	t.Run("ring", func(t *testing.T) {
+		chdirTemp(t)
+		writeKey(t, "keys/0.bin", testKey0)
+		writeKey(t, "keys/255.bin", testKey1)
+		writeKey(t, "keys/256.bin", []byte("out of range"))
+		writeKey(t, "keys/old.bin", []byte("not an id"))
+		writeKey(t, "keys/1.txt", []byte("not a key"))
+		writeKey(t, "key.bin", []byte("ignored with a ring"))
+
+		s := &Security{}
+		if err := s.LoadKeys(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(s.keys) != 2 || !bytes.Equal(s.keys[0], testKey0) || !bytes.Equal(s.keys[255], testKey1) {
+			t.Errorf("loaded %q", s.keys)
+		}
+	})
+
+	t.Run("single key", func(t *testing.T) {
+		chdirTemp(t)
+		writeKey(t, "key.bin", testKey0)
+
+		s := &Security{}
+		if err := s.LoadKeys(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(s.keys) != 1 || !bytes.Equal(s.keys[0], testKey0) {
+			t.Errorf("loaded %q", s.keys)
+		}
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		chdirTemp(t)
+
+		if err := (&Security{}).LoadKeys(); err == nil {
+			t.Error("loaded without key.bin")
+		}
+	})
+
+	t.Run("empty ring", func(t *testing.T) {
+		chdirTemp(t)
+		writeKey(t, "keys/readme.txt", nil)
+
+		if err := (&Security{}).LoadKeys(); err == nil {
+			t.Error("loaded an empty ring")
+		}
+	})
+
+	t.Run("failed reload", func(t *testing.T) {
+		s := newTestSecurity(t)
+
+		if err := os.RemoveAll("keys"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.LoadKeys(); err == nil {
+			t.Fatal("reloaded without keys")
+		}
+		if len(s.keys) != 2 {
+			t.Error("failed reload replaced the ring")
+		}
+	})
+}
+
+func TestNewClientKey(t *testing.T) {
+	s := newTestSecurity(t)
+
+	a, b := s.NewClientKey(), s.NewClientKey()
+
+	if len(a.nonce) != nonceSize {
+		t.Errorf("nonce is %d bytes, want %d", len(a.nonce), nonceSize)
+	}
+	if bytes.Equal(a.nonce, b.nonce) {
+		t.Error("connections got the same nonce")
+	}
+
+	// a message signed for one connection doesn't verify on another
+	msg := Sign(connKey(t, a, testKey0), 0, 1, []byte("payload"))
+	if !s.VerifySignature(a, msg) {
+		t.Error("signature rejected")
+	}
+	if s.VerifySignature(b, msg) {
+		t.Error("signature accepted for another connection")
+	}
+
+	// and the ring key itself is never used directly
+	if s.VerifySignature(a, Sign(testKey0, 0, 1, []byte("payload"))) {
+		t.Error("signature with the ring key accepted")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	s := newTestSecurity(t)
+	clientKey := s.NewClientKey()
+
+	signed := func(key []byte, keyId byte) []byte {
+		return Sign(connKey(t, clientKey, key), keyId, 1, []byte("payload"))
+	}
+
+	tampered := func(msg []byte, i int) []byte {
+		msg = bytes.Clone(msg)
+		msg[i] ^= 1
+		return msg
+	}
+
+	msg := signed(testKey0, 0)
+
+	tests := []struct {
+		name string
+		msg  []byte
+		want bool
+	}{
+		{"key 0", msg, true},
+		{"key 1", signed(testKey1, 1), true},
+		{"wrong key for id", signed(testKey1, 0), false},
+		{"unknown key id", signed(testKey0, 2), false},
+		{"tampered key id", tampered(signed(testKey1, 1), 0), false},
+		{"tampered mac", tampered(msg, keyIdSize), false},
+		{"tampered counter", tampered(msg, keyIdSize+macSize), false},
+		{"tampered payload", tampered(msg, HeaderSize), false},
+		{"appended payload", append(bytes.Clone(msg), 'x'), false},
+		{"header only", Sign(connKey(t, clientKey, testKey0), 0, 1, nil), true},
+		{"short", msg[:HeaderSize-1], false},
+		{"empty", nil, false},
+	}
+
+	for _, test := range tests {
+		if got := s.VerifySignature(clientKey, test.msg); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestVerifySignatureRotation(t *testing.T) {
+	s := newTestSecurity(t)
+	clientKey := s.NewClientKey()
+
+	oldMsg := Sign(connKey(t, clientKey, testKey0), 0, 1, []byte("payload"))
+	newMsg := Sign(connKey(t, clientKey, testKey1), 1, 1, []byte("payload"))
+
+	// key 0 is rotated out
+	if err := os.Remove("keys/0.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.VerifySignature(clientKey, oldMsg) {
+		t.Error("signature with a removed key accepted")
+	}
+	if !s.VerifySignature(clientKey, newMsg) {
+		t.Error("signature with a kept key rejected")
+	}
+
+	// and replaced with a different key under the same id
+	writeKey(t, "keys/0.bin", []byte("test key 0, rotated"))
+	if err := s.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.VerifySignature(clientKey, oldMsg) {
+		t.Error("signature with a replaced key accepted")
+	}
+}
+
+func TestVerifyCounter(t *testing.T) {
+	s := newTestSecurity(t)
+	key := connKey(t, s.NewClientKey(), testKey0)
+
+	var counter uint32
+
+	tests := []struct {
+		name    string
+		counter uint32
+		want    bool
+	}{
+		{"first", 1, true},
+		{"replayed", 1, false},
+		{"skipped ahead", 5, true},
+		{"older", 3, false},
+		{"zero", 0, false},
+		{"last", math.MaxUint32, true},
+		// counters don't wrap, a client has to reconnect before running out
+		{"wrapped to zero", 0, false},
+		{"wrapped", 1, false},
+		{"last replayed", math.MaxUint32, false},
+	}
+
+	for _, test := range tests {
+		if got := s.VerifyCounter(&counter, Sign(key, 0, test.counter, nil)); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+
+	if counter != math.MaxUint32 {
+		t.Errorf("counter is %d, want %d", counter, uint32(math.MaxUint32))
+	}
+}
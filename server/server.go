@@ -19,16 +19,20 @@ package server
 
 import (
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/fasthttp/websocket"
@@ -40,6 +44,10 @@ import (
 const (
 	mainGameId = "2kki"
 
+	// used as the sender of system messages and automatic moderation actions
+	systemUuid = "0000000000000000"
+	systemRank = 2
+
 	delim  = "\uffff"
 	mdelim = "\ufffe"
 )
@@ -47,7 +55,9 @@ const (
 var (
 	scheduler = gocron.NewScheduler(time.UTC)
 
-	config         *Config
+	// replaced as a whole on reload, read it with getConfig
+	currentConfig  atomic.Pointer[Config]
+	configPath     string
 	serverSecurity *security.Security
 	assets         *Assets
 
@@ -62,46 +72,54 @@ var (
 	}
 
 	isOkString = regexp.MustCompile("^[A-Za-z0-9]+$").MatchString
-	wordFilter *regexp.Regexp
+	wordFilter atomic.Pointer[regexp.Regexp]
 )
 
 func Start() {
 	fmt.Println("Now starting YNOserver...")
 
-	configFile := flag.String("config", "config.yml", "Path to the configuration file")
+	flag.StringVar(&configPath, "config", "config.yml", "Path to the configuration file")
 	flag.Parse()
 
-	config = parseConfigFile(*configFile)
-	db = getDatabaseConn(config.dbUser, config.dbPass, config.dbAddr, config.dbName)
-	db.SetConnMaxIdleTime(1 * time.Minute)
+	currentConfig.Store(parseConfigFile(configPath))
+	initStorage()
+
+	if getConfig().storage == storageMysql {
+		if err := migrateDatabase(); err != nil {
+			panic(err)
+		}
+	}
 
-	err := setActivePlayersOffline(config.gameName) // clean up players when server starts
+	// "ynoserver migrate" only brings the database schema up to date
+	if flag.Arg(0) == "migrate" {
+		return
+	}
+
+	err := setActivePlayersOffline(getConfig().gameName) // clean up players when server starts
 	if err != nil {
 		log.Printf("failed to set active players offline: %s", err)
 	}
 
-	isMainServer = config.gameName == mainGameId
+	isMainServer = getConfig().gameName == mainGameId
 
 	serverSecurity = security.New()
-	assets = getAssets(config.gamePath)
+	assets = getAssets(getConfig().gamePath)
 
-	setConditions()
-	setBadges()
-	setEventVms()
+	for _, err := range slices.Concat(loadBadges(), setEventVms()) {
+		log.Printf("failed to load game data: %s", err)
+	}
 	setWordFilter()
 
-	globalConditions = getGlobalConditions()
+	createRooms(assets.maps, getConfig().spRooms, getConfig().interestRadii)
 
-	createRooms(assets.maps, config.spRooms)
-
-	log.SetOutput(&lumberjack.Logger{
-		Filename:   "logs/" + config.gameName + "/ynoserver.log",
-		MaxSize:    config.logging.maxSize,
-		MaxBackups: config.logging.maxBackups,
-		MaxAge:     config.logging.maxAge,
+	initLogging(&lumberjack.Logger{
+		Filename:   "logs/" + getConfig().gameName + "/ynoserver.log",
+		MaxSize:    getConfig().logging.maxSize,
+		MaxBackups: getConfig().logging.maxBackups,
+		MaxAge:     getConfig().logging.maxAge,
 	})
-	log.SetFlags(log.Ldate | log.Ltime)
 
+	initWriteQueues()
 	initApi()
 	initHistory()
 	initScreenshots()
@@ -112,22 +130,42 @@ func Start() {
 	initSession()
 	initReports()
 	initRpc()
+	initRecorder()
+
+	if getConfig().compression.enabled {
+		initCompression()
+	}
 
-	if config.flags.unconscious {
+	if getConfig().flags.unconscious {
 		initUnconscious()
 	}
 
+	// pick up keys added to or removed from the key ring
+	scheduler.Every(1).Minute().Do(func() {
+		if err := serverSecurity.LoadKeys(); err != nil {
+			eprintf("security", "failed to reload keys: %s", err)
+		}
+	})
+
+	scheduler.Every(1).Hour().Do(logOutboxStats)
+
+	scheduler.Every(10).Seconds().Do(checkSpectators)
+
 	scheduler.Every(1).Day().At("03:00").Do(updatePlayerActivity)
 
 	if isMainServer {
 		scheduler.Every(1).Day().At("04:00").Do(doCleanupQueries)
 	}
 
+	initJobMetrics()
+
 	scheduler.StartAsync()
 
+	servers := serve(getListeners())
+
 	fmt.Print("Now serving requests.\n")
 
-	http.Serve(getListener(), nil)
+	handleSignals(servers)
 }
 
 func logInitTask(taskName string) {
@@ -138,38 +176,97 @@ func logUpdateTask(taskName string) {
 	fmt.Print("Updating " + taskName + "...\n")
 }
 
-func getListener() net.Listener {
-	// remove socket file
-	os.Remove("sockets/" + config.gameName + ".sock")
-
-	// create unix socket at sockets/<game>.sock
-	listener, err := net.Listen("unix", "sockets/"+config.gameName+".sock")
-	if err != nil {
-		log.Fatal(err)
+func getListeners() (listeners []net.Listener) {
+	for _, listen := range getConfig().listen {
+		listeners = append(listeners, getListener(listen))
 	}
 
-	// set socket file permissions
-	if err := os.Chmod("sockets/"+config.gameName+".sock", 0666); err != nil {
-		log.Fatal(err)
-	}
+	return listeners
+}
+
+func getListener(listen listenConfig) net.Listener {
+	switch listen.network {
+	case "unix":
+		// remove socket file
+		os.Remove(listen.address)
+
+		listener, err := net.Listen("unix", listen.address)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// set socket file permissions
+		if err := os.Chmod(listen.address, 0666); err != nil {
+			log.Fatal(err)
+		}
 
-	return listener
+		return listener
+	case "tls":
+		cert, err := tls.LoadX509KeyPair(listen.certFile, listen.keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		listener, err := tls.Listen("tcp", listen.address, &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return listener
+	default:
+		listener, err := net.Listen("tcp", listen.address)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return listener
+	}
 }
 
+// getIp returns the address of the client, taken from x-forwarded-for only when
+// the request came through a unix socket or one of the trusted proxies
 func getIp(r *http.Request) string {
-	return r.Header.Get("x-forwarded-for")
-}
+	var remoteAddr netip.Addr
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteAddr, _ = netip.ParseAddr(ip)
+	}
 
-func writeLog(uuid string, location string, payload string, errorcode int) {
-	log.Printf("%v %v \"%v\" %v\n", uuid, location, strings.Replace(payload, "\"", "'", -1), errorcode)
-}
+	// unix sockets have no remote address, only a reverse proxy can connect to them
+	if remoteAddr.IsValid() && !isTrustedProxy(remoteAddr) {
+		return remoteAddr.String()
+	}
 
-func writeErrLog(uuid string, location string, payload string) {
-	writeLog(uuid, location, payload, 400)
+	// proxies append to the header, so the real client is the last address not added by a trusted proxy
+	forwarded := strings.Split(r.Header.Get("x-forwarded-for"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if ip == "" {
+			continue
+		}
+
+		if addr, err := netip.ParseAddr(ip); err == nil && isTrustedProxy(addr) && i != 0 {
+			continue
+		}
+
+		return ip
+	}
+
+	if remoteAddr.IsValid() {
+		return remoteAddr.String()
+	}
+
+	return ""
 }
 
-func eprintf(category string, format string, args ...any) {
-	writeLog("SERVER", category, fmt.Sprintf(format, args...), 500)
+func isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range getConfig().trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
 }
 
 const randRunes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890"
@@ -0,0 +1,384 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/ynoproject/ynoserver/server/security"
+)
+
+// the test server runs on memory storage with rooms 1 to testRooms
+const testRooms = 4
+
+const testConfig = `
+game_name: "test"
+storage: "memory"
+trusted_proxies: "127.0.0.1"
+room_capacity: 3
+`
+
+var (
+	testKey    = []byte("0123456789abcdef0123456789abcdef")
+	testServer *httptest.Server
+
+	// players numbered from here are new in every run
+	lastTestPlayer atomic.Int32
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ynoserver")
+	if err != nil {
+		panic(err)
+	}
+
+	code := runTests(m, dir)
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func runTests(m *testing.M, dir string) int {
+	// the key ring is read from the working directory
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile("key.bin", testKey, 0600); err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile("config.yml", []byte(testConfig), 0600); err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile("filterwords.txt", []byte("badword\n"), 0600); err != nil {
+		panic(err)
+	}
+
+	currentConfig.Store(parseConfigFile(filepath.Join(dir, "config.yml")))
+	initLogging(io.Discard)
+	initStorage()
+	if err := setWordFilter(); err != nil {
+		panic(err)
+	}
+
+	var roomIds []int
+	for roomId := 1; roomId <= testRooms; roomId++ {
+		roomIds = append(roomIds, roomId)
+	}
+
+	serverSecurity = security.New()
+	assets = &Assets{
+		maps:     roomIds,
+		mapInfos: testMapInfos,
+		systems:  map[string]bool{"system": true},
+	}
+
+	createRooms(roomIds, nil, nil)
+
+	initWriteQueues()
+	defer stopWriteQueues()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/session", handleSession)
+	mux.HandleFunc("/room", handleRoom)
+	mux.HandleFunc("/api/register", handleRegister)
+	mux.HandleFunc("/api/login", handleLogin)
+	mux.HandleFunc("/api/info", handleInfo)
+	mux.HandleFunc("/api/chathistory", handleChatHistory)
+	mux.HandleFunc("/api/clearchathistory", handleClearChatHistory)
+	mux.HandleFunc("/api/explorercompletion", handleExplorerCompletion)
+	mux.HandleFunc("/api/registernotification", handleRegisterSubscriber)
+	mux.HandleFunc("/api/unregisternotification", handleUnregisterSubscriber)
+	mux.HandleFunc("/api/report", handleReport)
+
+	testServer = httptest.NewServer(mux)
+	defer testServer.Close()
+
+	return m.Run()
+}
+
+// testClient is a player connected to the test server over websockets
+type testClient struct {
+	ip      string
+	session *websocket.Conn
+	room    *websocket.Conn
+
+	id          int
+	uuid        string
+	connKey     []byte
+	counter     uint32
+	resumeToken string
+
+	// guards writes to room, which the simulation makes from several goroutines
+	roomMutex sync.Mutex
+}
+
+// connectTestClient opens a session for a new guest player and joins roomId
+func connectTestClient(t testing.TB, n int, roomId int) *testClient {
+	t.Helper()
+
+	c := &testClient{ip: testIp(n)}
+
+	var err error
+	if c.session, err = c.dial("/session"); err != nil {
+		t.Fatalf("client %d: failed to open session: %s", n, err)
+	}
+
+	// the session is registered once it answers messages,
+	// the resume token comes before that if resuming is enabled
+	c.sendSession("i")
+	if err := readTestMsgs(c.session, func(msgFields []string) bool {
+		if msgFields[0] == "rt" {
+			c.resumeToken = msgFields[1]
+		}
+		return msgFields[0] == "i"
+	}); err != nil {
+		t.Fatalf("client %d: no player info: %s", n, err)
+	}
+
+	if c.room, err = c.dial("/room?id=" + strconv.Itoa(roomId)); err != nil {
+		t.Fatalf("client %d: failed to join room: %s", n, err)
+	}
+
+	msgFields, err := readTestMsg(c.room, "s")
+	if err != nil {
+		t.Fatalf("client %d: no client info: %s", n, err)
+	}
+
+	c.id, _ = strconv.Atoi(msgFields[1])
+	c.uuid = msgFields[3]
+
+	nonce, err := hex.DecodeString(msgFields[2])
+	if err != nil {
+		t.Fatalf("client %d: bad nonce: %s", n, err)
+	}
+	c.connKey = security.DeriveKey(testKey, nonce)
+
+	// keep reading so the server never sees a slow consumer
+	go discardTestMsgs(c.session)
+	go discardTestMsgs(c.room)
+
+	return c
+}
+
+// testIp is the address of the nth test player
+func testIp(n int) string {
+	return fmt.Sprintf("10.%d.%d.%d", n/65536, n/256%256, n%256)
+}
+
+// newTestPlayer numbers a player that no other test or earlier run has used
+func newTestPlayer() int {
+	return 1000 + int(lastTestPlayer.Add(1))
+}
+
+func (c *testClient) dial(path string) (*websocket.Conn, error) {
+	url := "ws" + strings.TrimPrefix(testServer.URL, "http") + path
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Forwarded-For": {c.ip}})
+
+	return conn, err
+}
+
+func (c *testClient) sendSession(msgFields ...string) error {
+	return c.session.WriteMessage(websocket.TextMessage, []byte(strings.Join(msgFields, delim)))
+}
+
+func (c *testClient) sendRoom(msgFields ...string) error {
+	c.roomMutex.Lock()
+	defer c.roomMutex.Unlock()
+
+	c.counter++
+
+	return c.room.WriteMessage(websocket.BinaryMessage, security.Sign(c.connKey, 0, c.counter, []byte(strings.Join(msgFields, delim))))
+}
+
+func (c *testClient) close() {
+	for _, conn := range []*websocket.Conn{c.room, c.session} {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
+
+// testRequest calls the API of the test server as the player at ip
+func testRequest(ip string, method string, path string, token string, body string) (int, string, error) {
+	req, err := http.NewRequest(method, testServer.URL+path, strings.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+
+	req.Header.Set("X-Forwarded-For", ip)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+
+	return resp.StatusCode, string(respBody), err
+}
+
+// waitFor polls cond until it holds, queued writes take a moment to land
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readTestMsg reads from conn until a message of msgType arrives
+func readTestMsg(conn *websocket.Conn, msgType string) (msgFields []string, err error) {
+	err = readTestMsgs(conn, func(fields []string) bool {
+		if fields[0] == msgType {
+			msgFields = fields
+			return true
+		}
+		return false
+	})
+
+	return msgFields, err
+}
+
+// readTestMsgs passes every message read from conn to fn until it returns true
+func readTestMsgs(conn *websocket.Conn, fn func(msgFields []string) bool) error {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range strings.Split(string(message), mdelim) {
+			if fn(strings.Split(msg, delim)) {
+				return nil
+			}
+		}
+	}
+}
+
+func discardTestMsgs(conn *websocket.Conn) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// setTestTrustedProxies trusts a single address, an IPv4 range and an IPv6 range
+func setTestTrustedProxies(t *testing.T) {
+	prevConfig := getConfig()
+	t.Cleanup(func() { currentConfig.Store(prevConfig) })
+
+	config := *prevConfig
+	config.trustedProxies = []netip.Prefix{
+		netip.MustParsePrefix("127.0.0.1/32"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+	currentConfig.Store(&config)
+}
+
+func TestIsTrustedProxy(t *testing.T) {
+	setTestTrustedProxies(t)
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"127.0.0.2", false},
+		{"10.0.0.0", true},
+		{"10.255.255.255", true},
+		{"11.0.0.0", false},
+		{"::ffff:10.1.2.3", true},
+		{"fd12::1", true},
+		{"fe00::1", false},
+		{"::1", false},
+	}
+
+	for _, test := range tests {
+		if got := isTrustedProxy(netip.MustParseAddr(test.addr)); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.addr, got, test.want)
+		}
+	}
+}
+
+func TestGetIp(t *testing.T) {
+	setTestTrustedProxies(t)
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{"direct", "203.0.113.1:1234", "", "203.0.113.1"},
+		{"direct ipv6", "[2001:db8::2]:1234", "", "2001:db8::2"},
+		{"direct with spoofed header", "203.0.113.1:1234", "198.51.100.7", "203.0.113.1"},
+		{"untrusted proxy", "203.0.113.1:1234", "198.51.100.7, 10.1.2.3", "203.0.113.1"},
+		{"trusted proxy", "127.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"trusted proxy without header", "127.0.0.1:1234", "", "127.0.0.1"},
+		{"trusted proxy with spoofed client", "127.0.0.1:1234", "192.0.2.1, 198.51.100.7", "198.51.100.7"},
+		{"trusted hops", "127.0.0.1:1234", "198.51.100.7, 10.1.2.3, 10.4.5.6", "198.51.100.7"},
+		{"trusted hops with spoofed client", "127.0.0.1:1234", "192.0.2.1, 198.51.100.7, 10.1.2.3", "198.51.100.7"},
+		{"untrusted hop", "127.0.0.1:1234", "198.51.100.7, 192.0.2.1, 10.1.2.3", "192.0.2.1"},
+		{"only trusted hops", "127.0.0.1:1234", "10.1.2.3, 10.4.5.6", "10.1.2.3"},
+		{"empty entries", "127.0.0.1:1234", " 198.51.100.7 ,, ", "198.51.100.7"},
+		{"trusted ipv6 proxy", "[fd00::1]:1234", "2001:db8::1", "2001:db8::1"},
+		{"trusted ipv4-mapped proxy", "[::ffff:127.0.0.1]:1234", "198.51.100.7", "198.51.100.7"},
+		{"unix socket", "@", "198.51.100.7, 10.1.2.3", "198.51.100.7"},
+		{"unix socket without header", "@", "", ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+
+		if got := getIp(r); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
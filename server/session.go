@@ -22,10 +22,7 @@ import (
 	"errors"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 	"unicode/utf8"
 
@@ -62,73 +59,70 @@ func initSession() {
 		writeGamePlayerCount(clients.GetAmount())
 	})
 
-	go func() {
-		stop := make(chan os.Signal, 1)
-
-		signal.Notify(stop, syscall.SIGTERM)
-
-		<-stop
-
-		systemMessage("**The server is restarting.**", "")
-
-		if bot != nil {
-			bot.Close()
-		}
-
-		time.Sleep(time.Second)
-
-		os.Exit(0)
-	}()
 }
 
 func handleSession(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, http.Header{"Sec-Websocket-Protocol": {r.Header.Get("Sec-Websocket-Protocol")}})
+	if shuttingDown.Load() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := upgradeWs(w, r, http.Header{"Sec-Websocket-Protocol": {r.Header.Get("Sec-Websocket-Protocol")}})
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	joinSessionWs(conn, getIp(r), r.URL.Query().Get("token"))
+	joinSessionWs(r.Context(), conn, getIp(r), r.URL.Query().Get("token"), r.URL.Query().Get("resume"))
 }
 
-func joinSessionWs(conn *websocket.Conn, ip string, token string) {
+func joinSessionWs(ctx context.Context, conn *websocket.Conn, ip string, token string, resumeToken string) {
 	c := &SessionClient{
-		conn:          conn,
-		ip:            ip,
-		outbox:        make(chan []byte, 8),
-		onlineFriends: make(map[string]bool),
-		blockedUsers:  make(map[string]bool),
+		blockedUsers: make(map[string]bool),
 	}
 
-	c.ctx, c.cancel = context.WithCancel(context.Background())
+	sessionConn := newClientConn(context.Background(), conn)
+	sessionConn.ip = ip
+	c.conn.Store(sessionConn)
+
+	c.outbox = newOutbox(func() {
+		writeErrLog(c.uuid, "sess", "disconnected slow consumer")
+		// not resumable, it would just fall behind again
+		go c.terminate()
+	})
 
 	if token != "" {
-		c.uuid, c.name, c.rank, c.badge, c.banned, c.muted = getPlayerDataFromToken(token)
+		c.uuid, c.name, c.rank, c.badge, c.banned, c.muted = getPlayerDataFromToken(ctx, token)
 	}
 
 	if c.uuid != "" {
 		c.account = true
 	} else {
-		c.uuid, c.banned, c.muted = getOrCreatePlayerData(ip)
+		c.uuid, c.banned, c.muted = getOrCreatePlayerData(ctx, ip)
 	}
 
 	c.cacheParty() // don't log error because player is probably not in a party
 
 	if client, ok := clients.Load(c.uuid); ok {
-		client.cancel()
+		if resumeToken != "" && client.resume(conn, ip, resumeToken) {
+			return
+		}
+
+		client.terminate()
 	}
 
 	// get medals after canceling existing client
 	if c.account {
-		c.medals = getPlayerMedals(c.uuid)
+		c.medals = getPlayerMedals(ctx, c.uuid)
 	}
 
 	var sameIp int
-	for _, client := range clients.Get() {
-		if client.ip == ip {
+	clients.Range(func(client *SessionClient) bool {
+		if client.getIp() == ip {
 			sameIp++
 		}
-	}
+		return true
+	})
 	if sameIp > 3 {
 		writeErrLog(c.uuid, "sess", "too many connections from ip")
 		return
@@ -138,14 +132,16 @@ func joinSessionWs(conn *websocket.Conn, ip string, token string) {
 		c.badge = "null"
 	}
 
-	c.sprite, c.spriteIndex, c.system = getPlayerGameData(c.uuid)
+	c.sprite, c.spriteIndex, c.system = getPlayerGameData(ctx, c.uuid)
 
-	if blockedPlayers, err := getBlockedPlayerData(c.uuid); err == nil {
+	if blockedPlayers, err := getBlockedPlayerData(ctx, c.uuid); err == nil {
 		for _, player := range blockedPlayers {
 			c.blockedUsers[player.Uuid] = true
 		}
 	}
 
+	sessionWg.Add(1)
+
 	go c.msgWriter()
 
 	// register client to the clients list;
@@ -155,6 +151,11 @@ func joinSessionWs(conn *websocket.Conn, ip string, token string) {
 
 	go c.msgReader()
 
+	if getConfig().session.resumeWindow != 0 {
+		c.resumeToken = randString(32)
+		c.outbox.send(buildMsg("rt", c.resumeToken))
+	}
+
 	err := c.addOrUpdatePlayerGameData()
 	if err != nil {
 		writeErrLog(c.uuid, "sess", err.Error())
@@ -164,19 +165,18 @@ func joinSessionWs(conn *websocket.Conn, ip string, token string) {
 }
 
 func (c *SessionClient) broadcast(msg []byte) {
-	for _, client := range clients.Get() {
-		select {
-		case client.outbox <- msg:
-		default:
-			writeErrLog(c.uuid, "sess", "send channel is full")
-		}
-	}
+	m := newMessage(msg)
+
+	clients.Range(func(client *SessionClient) bool {
+		client.outbox.sendMessage(m)
+		return true
+	})
 }
 
 // leave targetUuid empty to broadcast to all clients
 func systemMessage(msg string, targetUuid string) {
-	pmsg := buildMsg("p", "0000000000000000", "YNO", "", 2, true, "null", [5]int{})
-	gsaymsg := buildMsg("gsay", "0000000000000000", "0000", "0000", "0", 0, 0, msg, randString(12))
+	pmsg := buildMsg("p", systemUuid, "YNO", "", systemRank, true, "null", [5]int{})
+	gsaymsg := buildMsg("gsay", systemUuid, "0000", "0000", "0", 0, 0, msg, randString(12))
 	if targetUuid == "" {
 		var session *SessionClient
 		session.broadcast(pmsg)
@@ -185,8 +185,8 @@ func systemMessage(msg string, targetUuid string) {
 	}
 
 	if client, ok := clients.Load(targetUuid); ok {
-		client.outbox <- pmsg
-		client.outbox <- gsaymsg
+		client.outbox.send(pmsg)
+		client.outbox.send(gsaymsg)
 	}
 }
 
@@ -201,9 +201,24 @@ func (c *SessionClient) processMsg(msg []byte) (err error) {
 		}
 	}()
 
+	start := time.Now()
+
 	var updateGameActivity bool
 
-	switch msgFields := strings.Split(string(msg), delim); msgFields[0] {
+	msgFields := strings.Split(string(msg), delim)
+
+	c.recordInbound(msgFields)
+
+	if !c.floodGuard.allow(msgFields[0]) {
+		if c.floodGuard.drop() {
+			c.terminate()
+			go addFloodStrike(c.uuid)
+			return errFlood
+		}
+		return nil
+	}
+
+	switch msgFields[0] {
 	case "i": // player info
 		err = c.handleI()
 	case "name": // nick set
@@ -230,7 +245,7 @@ func (c *SessionClient) processMsg(msg []byte) (err error) {
 	case "pt": // party update
 		err = c.handlePt()
 		if err != nil {
-			c.outbox <- buildMsg("pt", "null")
+			c.outbox.send(buildMsg("pt", "null"))
 		}
 	case "ep": // event period
 		err = c.handleEp()
@@ -265,7 +280,9 @@ func (c *SessionClient) processMsg(msg []byte) (err error) {
 		}
 	}
 
-	writeLog(c.uuid, "sess", string(msg), 200)
+	metrics.sessionMessages.inc(msgFields[0])
+
+	logMessage(c.uuid, "sess", msgFields[0], string(msg), time.Since(start))
 
 	return
 }
@@ -0,0 +1,175 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fasthttp/websocket"
+)
+
+// how long to wait for requests to finish and clients to disconnect
+const shutdownTimeout = 10 * time.Second
+
+var (
+	shuttingDown atomic.Bool
+
+	// canceled on shutdown, for connections that aren't part of a session
+	serverCtx, stopServer = context.WithCancel(context.Background())
+
+	// sessions that haven't been unregistered yet
+	sessionWg sync.WaitGroup
+
+	// work started by clients that has to finish even if they leave, see runDetached
+	detachedWg sync.WaitGroup
+)
+
+// runDetached runs fn on its own goroutine with a context that isn't canceled when
+// ctx is, for writes that mustn't be lost if the client disconnects. Shutdown waits
+// for it before closing the database.
+func runDetached(ctx context.Context, fn func(ctx context.Context)) {
+	detachedWg.Add(1)
+
+	go func() {
+		defer detachedWg.Done()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), getConfig().database.queryTimeout)
+		defer cancel()
+
+		fn(ctx)
+	}()
+}
+
+func serve(listeners []net.Listener) (servers []*http.Server) {
+	for _, listener := range listeners {
+		server := &http.Server{}
+
+		go func() {
+			if err := server.Serve(listener); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+
+		servers = append(servers, server)
+	}
+
+	return servers
+}
+
+// handleSignals reloads the config on SIGHUP and returns after shutting down on SIGTERM
+func handleSignals(servers []*http.Server) {
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP)
+
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			reloadConfig()
+			continue
+		}
+
+		shutdown(servers)
+		return
+	}
+}
+
+func shutdown(servers []*http.Server) {
+	writeLog("SERVER", "shutdown", "shutting down", 200)
+
+	shuttingDown.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// stop accepting connections and wait for api requests to finish,
+	// websockets are hijacked so they aren't waited for
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			eprintf("shutdown", "failed to stop listener: %s", err)
+		}
+	}
+
+	if rpcListener != nil {
+		rpcListener.Close()
+	}
+
+	// waits for running jobs, so scheduled jobs can't queue writes after the queues are stopped
+	scheduler.Stop()
+
+	systemMessage("**The server is restarting.**", "")
+
+	// give writers a moment to send it
+	time.Sleep(time.Second)
+
+	// unregistering a session writes its game activity
+	for _, client := range clients.Get() {
+		client.terminate()
+	}
+	stopServer()
+
+	done := make(chan struct{})
+	go func() {
+		sessionWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		eprintf("shutdown", "timed out waiting for clients to disconnect")
+	}
+
+	// sessions are gone, so nothing starts detached work anymore
+	detachedWg.Wait()
+
+	// write what sessions left queued before marking everyone offline
+	stopWriteQueues()
+
+	if err := setActivePlayersOffline(getConfig().gameName); err != nil {
+		eprintf("shutdown", "failed to set active players offline: %s", err)
+	}
+
+	stopRecorder()
+
+	if bot != nil {
+		bot.Close()
+	}
+
+	db.Close()
+
+	writeLog("SERVER", "shutdown", "done", 200)
+}
+
+// getCloseCode returns the code sockets are closed with,
+// telling clients to reconnect when the server is restarting
+func getCloseCode() int {
+	if shuttingDown.Load() {
+		return websocket.CloseServiceRestart
+	}
+
+	return 1028
+}
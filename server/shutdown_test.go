@@ -0,0 +1,55 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"testing"
+)
+
+// TestRunDetached checks that detached work outlives the connection that started it
+func TestRunDetached(t *testing.T) {
+	connCtx, disconnect := context.WithCancel(context.Background())
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	var ctxErr error
+	var hasDeadline bool
+
+	runDetached(connCtx, func(ctx context.Context) {
+		close(started)
+		<-finish
+
+		ctxErr = ctx.Err()
+		_, hasDeadline = ctx.Deadline()
+	})
+
+	<-started
+	disconnect()
+	close(finish)
+
+	// what shutdown waits for
+	detachedWg.Wait()
+
+	if ctxErr != nil {
+		t.Errorf("detached context ended with the connection: %s", ctxErr)
+	}
+	if !hasDeadline {
+		t.Error("detached context has no deadline")
+	}
+}
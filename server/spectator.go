@@ -0,0 +1,230 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/fasthttp/websocket"
+)
+
+// Spectators watch a room without being part of it. They get the same
+// snapshot and broadcasts as players but are kept in Room.spectators
+// instead of Room.clients, so nobody is ever told about them, and every
+// message they send is rejected. They have a session of their own that
+// isn't registered in clients.
+
+// party id to the uuids its owner allowed to spectate rooms its members are in
+var partySpectators = struct {
+	allowed map[int]map[string]bool
+	mutex   sync.Mutex
+}{
+	allowed: make(map[int]map[string]bool),
+}
+
+// every connected spectator, for checking that they may still spectate
+var spectators = struct {
+	clients map[*RoomClient]bool
+	mutex   sync.Mutex
+}{
+	clients: make(map[*RoomClient]bool),
+}
+
+func allowPartySpectator(partyId int, uuid string) {
+	partySpectators.mutex.Lock()
+	defer partySpectators.mutex.Unlock()
+
+	if partySpectators.allowed[partyId] == nil {
+		partySpectators.allowed[partyId] = make(map[string]bool)
+	}
+
+	partySpectators.allowed[partyId][uuid] = true
+}
+
+func disallowPartySpectator(partyId int, uuid string) {
+	partySpectators.mutex.Lock()
+	defer partySpectators.mutex.Unlock()
+
+	delete(partySpectators.allowed[partyId], uuid)
+	if len(partySpectators.allowed[partyId]) == 0 {
+		delete(partySpectators.allowed, partyId)
+	}
+}
+
+func clearPartySpectators(partyId int) {
+	partySpectators.mutex.Lock()
+	defer partySpectators.mutex.Unlock()
+
+	delete(partySpectators.allowed, partyId)
+}
+
+// canSpectate reports whether uuid may spectate room, which banned players
+// never can, ranked players always can and everyone else only while a member
+// of a party that allowed them is in the same instance of the room
+func canSpectate(ctx context.Context, uuid string, room *Room) bool {
+	if banned, _ := getPlayerModerationStatus(ctx, uuid); banned {
+		return false
+	}
+
+	if getPlayerRank(ctx, uuid) > 0 {
+		return true
+	}
+
+	partySpectators.mutex.Lock()
+	defer partySpectators.mutex.Unlock()
+
+	var found bool
+	clients.Range(func(client *SessionClient) bool {
+		if client.getPartyId() == 0 || !partySpectators.allowed[client.getPartyId()][uuid] {
+			return true
+		}
+
+		found = client.roomC != nil && client.roomC.getRoom() == room
+		return !found
+	})
+
+	return found
+}
+
+func joinRoomSpectatorWs(ctx context.Context, conn *websocket.Conn, ip string, token string, roomId int, instance int, version int) {
+	room, ok := getRoomInstance(roomId, instance)
+	if !ok || room.singleplayer {
+		return
+	}
+
+	var uuid string
+	if token != "" {
+		uuid = getUuidFromToken(ctx, token)
+	}
+
+	if uuid == "" {
+		var banned bool
+		uuid, banned, _ = getOrCreatePlayerData(ctx, ip)
+		if banned {
+			return
+		}
+	}
+
+	mapId := fmt.Sprintf("%04d", roomId)
+
+	if !canSpectate(ctx, uuid, room) {
+		writeErrLog(uuid, mapId, "not allowed to spectate")
+		return
+	}
+
+	session := &SessionClient{
+		uuid:        uuid,
+		id:          -1,
+		rank:        getPlayerRank(ctx, uuid),
+		spriteIndex: -1,
+	}
+	if other, ok := clients.Load(uuid); ok {
+		session.account = other.account
+		session.badge = other.badge
+		session.medals = other.medals
+	}
+
+	spectatorConn := newClientConn(serverCtx, conn)
+	spectatorConn.protocol = version
+	spectatorConn.key = serverSecurity.NewClientKey()
+
+	client := &RoomClient{
+		session:   session,
+		room:      room,
+		spectator: true,
+		mapId:     mapId,
+	}
+	client.conn.Store(spectatorConn)
+	client.sharedRoom.Store(room)
+	client.outbox = newOutbox(func() {
+		writeErrLog(uuid, client.mapId, "disconnected slow consumer")
+		go client.terminate()
+	})
+
+	// before anything can unregister it
+	spectators.mutex.Lock()
+	spectators.clients[client] = true
+	spectators.mutex.Unlock()
+
+	go client.msgWriter()
+
+	client.outbox.send(buildMsg("s", session.id, spectatorConn.key.String(), uuid, session.rank, session.account, session.badge, session.medals[:]))
+
+	room.call(client.spectate)
+
+	go client.msgReader()
+
+	client.sendSyncedAssets()
+
+	writeLog(uuid, client.mapId, "spectate", 200)
+}
+
+func (c *RoomClient) spectate() {
+	c.outbox.send(buildMsg("ri", c.room.id, c.room.instance))
+
+	c.getRoomPlayerData()
+
+	c.room.spectators = append(c.room.spectators, c)
+}
+
+func (c *RoomClient) stopSpectating() {
+	for i, client := range c.room.spectators {
+		if client != c {
+			continue
+		}
+
+		c.room.spectators[i] = c.room.spectators[len(c.room.spectators)-1]
+		c.room.spectators = c.room.spectators[:len(c.room.spectators)-1]
+		break
+	}
+}
+
+// checkSpectators disconnects spectators who may no longer spectate their room,
+// since canSpectate is otherwise only checked when they connect
+func checkSpectators() {
+	for _, client := range getSpectators() {
+		// a spectator's room never changes, so it can be read from here
+		if !canSpectate(context.Background(), client.session.uuid, client.room) {
+			writeLog(client.session.uuid, client.mapId, "no longer allowed to spectate", 200)
+			client.terminate()
+		}
+	}
+}
+
+// dropSpectator disconnects uuid from every room it spectates
+func dropSpectator(uuid string) {
+	for _, client := range getSpectators() {
+		if client.session.uuid == uuid {
+			client.terminate()
+		}
+	}
+}
+
+func getSpectators() []*RoomClient {
+	spectators.mutex.Lock()
+	defer spectators.mutex.Unlock()
+
+	clients := make([]*RoomClient, 0, len(spectators.clients))
+	for client := range spectators.clients {
+		clients = append(clients, client)
+	}
+
+	return clients
+}
@@ -0,0 +1,108 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+)
+
+// TestSpectatorDropped checks that spectators are disconnected once they
+// may no longer spectate, not only refused when they connect
+func TestSpectatorDropped(t *testing.T) {
+	const (
+		roomId  = 1
+		partyId = 900
+	)
+
+	member := connectTestClient(t, newTestPlayer(), roomId)
+	defer member.close()
+
+	// the spectator plays elsewhere and watches the member's room from another socket
+	spectator := connectTestClient(t, newTestPlayer(), 2)
+	defer spectator.close()
+
+	session, ok := clients.Load(member.uuid)
+	if !ok {
+		t.Fatal("member has no session")
+	}
+	session.setPartyId(partyId)
+	defer session.setPartyId(0)
+
+	defer clearPartySpectators(partyId)
+
+	spectate := func() *websocket.Conn {
+		t.Helper()
+
+		conn, err := spectator.dial("/room?spectate=1&id=" + strconv.Itoa(roomId))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readTestMsg(conn, "s"); err != nil {
+			t.Fatalf("not spectating: %s", err)
+		}
+
+		return conn
+	}
+
+	waitForClose := func(conn *websocket.Conn, what string) {
+		t.Helper()
+
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				if isTimeout(err) {
+					t.Fatalf("still spectating after %s", what)
+				}
+				return
+			}
+		}
+	}
+
+	allowPartySpectator(partyId, spectator.uuid)
+	conn := spectate()
+	defer conn.Close()
+
+	// the permission is revoked
+	disallowPartySpectator(partyId, spectator.uuid)
+	checkSpectators()
+	waitForClose(conn, "losing permission")
+
+	// and the spectator is banned
+	allowPartySpectator(partyId, spectator.uuid)
+	conn = spectate()
+	defer conn.Close()
+
+	if err := banPlayerUnchecked(context.Background(), spectator.uuid, true, false, false, false); err != nil {
+		t.Fatal(err)
+	}
+	waitForClose(conn, "being banned")
+
+	waitFor(t, "spectators to be unregistered", func() bool {
+		return len(getSpectators()) == 0
+	})
+}
+
+func isTimeout(err error) bool {
+	timeout, ok := err.(interface{ Timeout() bool })
+	return ok && timeout.Timeout()
+}
@@ -0,0 +1,349 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	webpush "github.com/Appboy/webpush-go"
+)
+
+const (
+	storageMysql  = "mysql"
+	storageMemory = "memory"
+)
+
+// Store holds a repository per domain. Lookups that find nothing return
+// sql.ErrNoRows whatever the backend is, so callers can keep checking for it.
+type Store struct {
+	players     PlayerRepository
+	parties     PartyRepository
+	badges      BadgeRepository
+	events      EventRepository
+	screenshots ScreenshotRepository
+	schedules   ScheduleRepository
+
+	chat          ChatRepository
+	locations     LocationRepository
+	records       RecordRepository
+	moderation    ModerationRepository
+	notifications NotificationRepository
+	apiCache      ApiCacheRepository
+}
+
+var store Store
+
+type PlayerRepository interface {
+	getPlayerDataFromIp(ctx context.Context, ip string) (uuid string, banned bool, muted bool, err error)
+	createPlayerData(ctx context.Context, ip string, uuid string, banned bool) error
+	getPlayerDataFromToken(ctx context.Context, token string) (uuid string, name string, rank int, badge string, banned bool, muted bool, err error)
+	getPlayerInfoFromToken(ctx context.Context, token string) (uuid string, name string, rank int, badge string, badgeSlotRows int, badgeSlotCols int, screenshotLimit int, err error)
+	getUuidFromToken(ctx context.Context, token string) (uuid string, err error)
+	getPlayerInfo(ctx context.Context, ip string) (uuid string, name string, rank int, err error)
+	getPlayerRank(ctx context.Context, uuid string) (rank int, err error)
+	getPlayerModerationStatus(ctx context.Context, uuid string) (banned bool, muted bool, err error)
+	setPlayerBanned(ctx context.Context, uuid string, banned bool) error
+	setPlayerMuted(ctx context.Context, uuid string, muted bool) error
+	getBannedMutedPlayers(ctx context.Context, banned bool) (players []PlayerInfo, err error)
+	isIpBanned(ctx context.Context, ip string) (bool, error)
+	getUuidFromName(ctx context.Context, name string) (uuid string, err error)
+	getAccountName(ctx context.Context, uuid string) (name string, err error)
+	getPlayerGameName(ctx context.Context, uuid string) (name string, err error)
+	setAccountName(ctx context.Context, uuid string, name string) error
+	getPlayerMedals(ctx context.Context, uuid string) (medals [5]int, err error)
+	getPlayerGameData(ctx context.Context, uuid string) (spriteName string, spriteIndex int, systemName string, err error)
+	addOrUpdatePlayerGameData(ctx context.Context, uuid string) error
+	updatePlayerGameActivities(ctx context.Context, activities []PlayerGameActivity) error
+	setActivePlayersOffline(ctx context.Context, game string) error
+	updatePlayerActivity(ctx context.Context) error
+
+	blockPlayer(ctx context.Context, uuid string, targetUuid string) error
+	unblockPlayer(ctx context.Context, uuid string, targetUuid string) error
+	isPlayerBlocked(ctx context.Context, uuid string, targetUuid string) (bool, error)
+	getBlockedPlayerData(ctx context.Context, uuid string) ([]*PlayerListData, error)
+
+	addPlayerFriend(ctx context.Context, uuid string, targetUuid string) error
+	removePlayerFriend(ctx context.Context, uuid string, targetUuid string) error
+	getPlayerFriendData(ctx context.Context, uuid string) ([]*PlayerFriend, error)
+
+	accountExists(ctx context.Context, user string) (bool, error)
+	accountExistsForUuid(ctx context.Context, uuid string) (bool, error)
+	createAccount(ctx context.Context, ip string, uuid string, user string, passHash []byte) error
+	getAccountPassHash(ctx context.Context, user string) (string, error)
+	setAccountPassHash(ctx context.Context, user string, passHash []byte) error
+	setAccountPassHashForUuid(ctx context.Context, uuid string, passHash []byte) error
+	createPlayerSession(ctx context.Context, token string, user string) error
+	deletePlayerSession(ctx context.Context, token string) error
+
+	// cleanupPlayers removes expired sessions and guests that never played
+	cleanupPlayers(ctx context.Context) error
+}
+
+type PartyRepository interface {
+	getPlayerPartyId(ctx context.Context, uuid string) (partyId int, err error)
+	getPlayerParty(ctx context.Context, uuid string) (party Party, err error)
+	getPartyMembers(ctx context.Context, partyId int) ([]*PlayerListFullData, error)
+	createParty(ctx context.Context, name string, public bool, pass string, theme string, description string, ownerUuid string) (partyId int, err error)
+	updateParty(ctx context.Context, partyId int, name string, public bool, pass string, theme string, description string, ownerUuid string) error
+	addPartyMember(ctx context.Context, partyId int, uuid string) error
+	removePartyMember(ctx context.Context, uuid string) error
+	setPartyOwner(ctx context.Context, partyId int, uuid string) error
+	// setPartyOwnerByRank hands the party to its highest ranked member
+	setPartyOwnerByRank(ctx context.Context, partyId int) error
+	deleteParty(ctx context.Context, partyId int) error
+	deletePartyAndMembers(ctx context.Context, partyId int) error
+}
+
+type BadgeSlot struct {
+	BadgeId string
+	Row     int
+	Col     int
+}
+
+type PlayerGameActivity struct {
+	Uuid        string
+	Name        string
+	SystemName  string
+	SpriteName  string
+	SpriteIndex int
+	Online      bool
+}
+
+type BadgeRecord struct {
+	BadgeId         string
+	Game            string
+	Bp              int
+	Hidden          bool
+	PercentUnlocked float32
+}
+
+type BadgeRepository interface {
+	getPlayerBadgeSlotCounts(ctx context.Context, playerName string) (badgeSlotRows int, badgeSlotCols int, err error)
+	// updatePlayerBadgeSlotCounts updates every player when uuid is empty
+	updatePlayerBadgeSlotCounts(ctx context.Context, uuid string) error
+	setPlayerBadge(ctx context.Context, uuid string, badge string) error
+	// getPlayerBadgeSlots returns the slotted badges ordered by row and column
+	getPlayerBadgeSlots(ctx context.Context, playerName string, badgeSlotRows int, badgeSlotCols int) ([]BadgeSlot, error)
+	setPlayerBadgeSlot(ctx context.Context, uuid string, badgeId string, slotRow int, slotCol int) error
+	getPlayerBadgePreset(ctx context.Context, uuid string, presetId int) (string, error)
+	setPlayerBadgePreset(ctx context.Context, uuid string, presetId int, data string) error
+	applyPlayerBadgePreset(ctx context.Context, uuid string, preset [][]string, slotRows int, slotCols int) error
+	writeBadges(ctx context.Context, badges []BadgeRecord) error
+	getPlayerUnlockedBadgeIds(ctx context.Context, uuid string) ([]string, error)
+	unlockPlayerBadge(ctx context.Context, uuid string, badgeId string) error
+	removePlayerBadge(ctx context.Context, uuid string, badgeId string) error
+	getBadgeUnlockPercentage(ctx context.Context, badgeId string) (float32, error)
+	getBadgeUnlockPercentages(ctx context.Context) (map[string]float32, error)
+}
+
+// EventCandidate is an event the player may have completed by reaching a location
+type EventCandidate struct {
+	Id     int
+	Type   int
+	MapId  int
+	Exp    int
+	MapIds []string
+}
+
+type EventRepository interface {
+	getCurrentEventPeriodId(ctx context.Context) (int, error)
+	getCurrentEventPeriodData(ctx context.Context) (EventPeriod, error)
+	getGameCurrentEventPeriodsData(ctx context.Context) (map[string]*EventPeriod, error)
+	getGameEventPeriodId(ctx context.Context, game string, periodId int) (int, error)
+	// getGamePlayerCounts returns the average player count of every game in the period
+	getGamePlayerCounts(ctx context.Context, periodId int) (gameIds []string, playerCounts []int, err error)
+	writeGamePlayerCount(ctx context.Context, playerCount int) error
+
+	getPlayerTotalEventExp(ctx context.Context, uuid string) (int, error)
+	getPlayerPeriodEventExp(ctx context.Context, uuid string, periodId int) (int, error)
+	getPlayerWeekEventExp(ctx context.Context, uuid string, periodId int) (int, error)
+	getPlayerEventLocationCount(ctx context.Context, uuid string) (int, error)
+	getPlayerEventLocationCompletion(ctx context.Context, uuid string) (int, error)
+	getPlayerEventVmCount(ctx context.Context, uuid string) (int, error)
+
+	getLocationName(ctx context.Context, locationId int) (string, error)
+	// getEventLocationCount counts the event locations of a period and type starting
+	// daysAgo, any when exp is 0, or all event locations when periodId is 0
+	getEventLocationCount(ctx context.Context, periodId int, eventType int, exp int, daysAgo int) (int, error)
+	writeEventLocation(ctx context.Context, gameId string, gameEventPeriodId int, eventType int, title string, titleJP string, depth int, minDepth int, exp int, mapIds []string, offsetDays int, days int) error
+	writePlayerEventLocation(ctx context.Context, gameId string, gameEventPeriodId int, uuid string, title string, titleJP string, depth int, minDepth int, mapIds []string) error
+	getCurrentEventLocations(ctx context.Context, uuid string, periodId int) ([]*EventLocation, error)
+	getCurrentPlayerEventLocations(ctx context.Context, uuid string, periodId int) ([]*EventLocation, error)
+	getEventLocationCandidates(ctx context.Context, gameEventPeriodId int, title string) ([]*EventCandidate, error)
+	getPlayerEventLocationCandidates(ctx context.Context, gameEventPeriodId int, title string, uuid string) ([]*EventCandidate, error)
+
+	getCurrentEventVms(ctx context.Context, uuid string, periodId int) ([]*EventVm, error)
+	getEventVmInfo(ctx context.Context, id int) (gameId string, mapId int, vmGroup []int, err error)
+	// getEventVmStartedDaysAgo returns the event VM of the period that started daysAgo
+	getEventVmStartedDaysAgo(ctx context.Context, periodId int, daysAgo int) (id int, gameId string, mapId int, vmGroup []int, err error)
+	getEventVmCandidates(ctx context.Context, periodId int, mapId int, eventId int) ([]*EventCandidate, error)
+	writeEventVm(ctx context.Context, gameEventPeriodId int, mapId int, vmGroup EventIds, exp int, offsetDays int, days int) error
+
+	// writeEventCompletion records that the player completed an event of type
+	// 0 (location), 1 (player location) or 2 (VM)
+	writeEventCompletion(ctx context.Context, eventId int, uuid string, eventType int, exp int) error
+
+	// cleanupEvents removes expired player event locations and queues
+	cleanupEvents(ctx context.Context) error
+}
+
+type ScreenshotRepository interface {
+	getPlayerScreenshotLimit(ctx context.Context, uuid string) (int, error)
+	getScreenshotFeed(ctx context.Context, uuid string, limit int, offset int, offsetId string, game string, sortOrder string, intervalType string) ([]*ScreenshotData, error)
+	getScreenshotInfo(ctx context.Context, uuid string, ownerUuid string, id string) (*ScreenshotData, error)
+	getPlayerScreenshots(ctx context.Context, uuid string) ([]*PlayerScreenshotData, error)
+	getScreenshotGames(ctx context.Context) ([]string, error)
+	getPlayerScreenshotCount(ctx context.Context, uuid string, temp bool) (int, error)
+	writeScreenshotData(ctx context.Context, id string, uuid string, game string, mapId string, mapX int, mapY int, temp bool) error
+	setPlayerScreenshotPublic(ctx context.Context, id string, uuid string, value bool) (bool, error)
+	setPlayerScreenshotSpoiler(ctx context.Context, id string, uuid string, value bool) (bool, error)
+	writePlayerScreenshotLike(ctx context.Context, id string, uuid string) (bool, error)
+	deletePlayerScreenshotLike(ctx context.Context, id string, uuid string) (bool, error)
+	deleteScreenshot(ctx context.Context, id string, uuid string) (bool, error)
+	// deleteTempScreenshots deletes temporary screenshots older than a day
+	// and returns them so their files can be removed
+	deleteTempScreenshots(ctx context.Context) ([]*PlayerScreenshotData, error)
+}
+
+type ScheduleRepository interface {
+	listSchedules(ctx context.Context, uuid string, partyId int, mod bool) ([]*ScheduleDisplay, error)
+	createSchedule(ctx context.Context, s *ScheduleUpdate) (int, error)
+	updateSchedule(ctx context.Context, id int, mod bool, uuid string, s *ScheduleUpdate) (updated bool, err error)
+	getUpcomingSchedules(ctx context.Context, after time.Time) (map[int]time.Time, error)
+	followSchedule(ctx context.Context, uuid string, scheduleId int, follow bool) (changed bool, err error)
+	getScheduleFollowCount(ctx context.Context, scheduleId int) (int, error)
+	getScheduleFollowers(ctx context.Context, scheduleId int) ([]string, error)
+	getScheduleInfo(ctx context.Context, scheduleId int) (name string, gameId string, datetime time.Time, err error)
+	cancelSchedule(ctx context.Context, uuid string, mod bool, scheduleId int) error
+	deleteDoneSchedules(ctx context.Context) error
+	advanceRecurringSchedules(ctx context.Context) error
+}
+
+type ChatRepository interface {
+	writeChatMessages(ctx context.Context, messages []ChatMessageWrite) error
+	writePartyChatMessage(ctx context.Context, message ChatMessageWrite, partyId int) error
+	setPlayerLastChatMessage(ctx context.Context, uuid string, lastMsgId string, party bool) error
+	// getChatMessageHistory returns the newest global and party messages after
+	// lastMsgId, oldest first, along with the players that sent them
+	getChatMessageHistory(ctx context.Context, partyId int, globalMsgLimit int, partyMsgLimit int, lastMsgId string) (*ChatHistory, error)
+	getChatMessageContents(ctx context.Context, msgId string, uuid string) (string, error)
+	// deleteOldChatMessages removes messages older than a day
+	deleteOldChatMessages(ctx context.Context) error
+}
+
+type LocationRepository interface {
+	getGameLocation(ctx context.Context, title string) (GameLocation, error)
+	getGameLocations(ctx context.Context) ([]*Location, error)
+	createGameLocation(ctx context.Context, title string, titleJP string, depth int, minDepth int, mapIds []string) (id int, err error)
+	updateGameLocation(ctx context.Context, id int, title string, titleJP string, depth int, minDepth int, mapIds []string) error
+
+	writePlayerGameLocations(ctx context.Context, locations []GameLocationWrite) error
+	getPlayerGameLocationIds(ctx context.Context, uuid string, gameId string) ([]int, error)
+	// getPlayerGameLocationCompletion is the percentage of the game's non-secret locations the player visited
+	getPlayerGameLocationCompletion(ctx context.Context, uuid string, gameId string) (int, error)
+	// getPlayerMissingGameLocationNames returns the locations among locationNames the player hasn't visited
+	getPlayerMissingGameLocationNames(ctx context.Context, uuid string, locationNames []string) ([]string, error)
+	getPlayerAllMissingGameLocationNames(ctx context.Context, uuid string) ([]string, error)
+}
+
+// RecordRepository holds the tags, time trials and minigame scores badges are unlocked by
+type RecordRepository interface {
+	getPlayerTags(ctx context.Context, uuid string) (tags []string, lastUnlocked time.Time, err error)
+	writePlayerTag(ctx context.Context, uuid string, name string) error
+	getPlayerTimeTrialRecords(ctx context.Context, uuid string) ([]*TimeTrialRecord, error)
+	// writePlayerTimeTrial keeps seconds if they beat the player's time for the map
+	writePlayerTimeTrial(ctx context.Context, uuid string, mapId int, seconds int) (written bool, err error)
+	getPlayerMinigameScore(ctx context.Context, uuid string, minigameId string) (int, error)
+	// writePlayerMinigameScore keeps score if it beats the player's score for the minigame
+	writePlayerMinigameScore(ctx context.Context, uuid string, minigameId string, score int) (written bool, err error)
+}
+
+type ModerationRepository interface {
+	writeModAction(ctx context.Context, uuid string, action int, reason string, expiry time.Time) error
+	// getModActionExpiries returns when each mod action that is still in effect expires
+	getModActionExpiries(ctx context.Context) (map[ModAction]time.Time, error)
+	deleteModAction(ctx context.Context, uuid string, action int) error
+
+	// writeReport replaces the player's report of the target, msgId is empty if the message is unknown
+	writeReport(ctx context.Context, uuid string, targetUuid string, msgId string, reason string, originalMsg string) error
+	// getReportReasonCounts counts the unresolved reports of the player by reason
+	getReportReasonCounts(ctx context.Context, targetUuid string) (map[string]int, error)
+	// getReporters maps the names of the players that reported the message to their reasons
+	getReporters(ctx context.Context, targetUuid string, msgId string) (map[string]string, error)
+	resolveReports(ctx context.Context, targetUuid string) error
+
+	// getPlayerModInfo looks the player up by name or uuid
+	getPlayerModInfo(ctx context.Context, player string) (name string, uuid string, banned bool, muted bool, onlineGames []string, err error)
+}
+
+type NotificationRepository interface {
+	addPushSubscription(ctx context.Context, uuid string, sub *webpush.Subscription) error
+	removePushSubscription(ctx context.Context, uuid string, endpoint string) error
+	// getPushSubscriptions returns the subscriptions of the players, or everyone's when uuids is empty
+	getPushSubscriptions(ctx context.Context, uuids []string) ([]*webpush.Subscription, error)
+}
+
+// ApiCacheRepository caches the responses of the Yume 2kki Explorer and Yume Wiki APIs
+type ApiCacheRepository interface {
+	get2kkiApiQuery(ctx context.Context, action string, query string) (string, error)
+	write2kkiApiQuery(ctx context.Context, action string, query string, response string) error
+	getWikiApiQuery(ctx context.Context, action string, query string) (string, error)
+	writeWikiApiQuery(ctx context.Context, action string, query string, response string) error
+	// cleanupApiQueries removes expired Yume 2kki Explorer responses
+	cleanupApiQueries(ctx context.Context) error
+}
+
+func initStorage() {
+	switch getConfig().storage {
+	case storageMemory:
+		memory := newMemoryStore()
+		store = Store{memory, memory, memory, memory, memory, memory, memory, memory, memory, memory, memory, memory}
+
+		// nothing may reach a database, so anything that does fails
+		db = &Database{DB: sql.OpenDB(unavailableConnector{})}
+	default:
+		db = getDatabaseConn(getConfig().dbUser, getConfig().dbPass, getConfig().dbAddr, getConfig().dbName)
+		db.SetConnMaxIdleTime(1 * time.Minute)
+
+		mysql := &mysqlStore{}
+		store = Store{mysql, mysql, mysql, mysql, mysql, mysql, mysql, mysql, mysql, mysql, mysql, mysql}
+	}
+}
+
+var errNoDatabase = errors.New("no database with memory storage")
+
+// unavailableConnector is the database of the memory storage
+type unavailableConnector struct{}
+
+func (unavailableConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errNoDatabase
+}
+
+func (c unavailableConnector) Driver() driver.Driver {
+	return unavailableDriver{}
+}
+
+type unavailableDriver struct{}
+
+func (unavailableDriver) Open(string) (driver.Conn, error) {
+	return nil, errNoDatabase
+}
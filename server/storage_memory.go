@@ -0,0 +1,3349 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	webpush "github.com/Appboy/webpush-go"
+)
+
+// memoryStore keeps everything in process memory for local runs without a
+// database. It follows the MySQL queries closely enough for the server to
+// behave the same, but nothing survives a restart.
+type memoryStore struct {
+	mu sync.Mutex
+
+	players  map[string]*memoryPlayer
+	accounts map[string]*memoryAccount
+	gameData map[memoryGameKey]*memoryGameData
+	sessions map[string]memorySession
+	blocks   map[string]map[string]time.Time
+	friends  map[[2]string]bool
+
+	parties      map[int]*memoryParty
+	partyMembers []memoryPartyMember
+	lastPartyId  int
+
+	badges       []BadgeRecord
+	playerBadges map[string]map[string]*memoryPlayerBadge
+	badgePresets map[memoryPresetKey]string
+
+	eventPeriods         []*memoryEventPeriod
+	gameEventPeriods     []*memoryGameEventPeriod
+	gamePlayerCounts     map[string][]int
+	locations            []*memoryLocation
+	eventLocations       []*memoryEventLocation
+	playerEventLocations []*memoryPlayerEventLocation
+	locationQueues       map[string]*memoryLocationQueue
+	eventVms             []*memoryEventVm
+	eventCompletions     []memoryEventCompletion
+	lastEventId          int
+
+	screenshots     []*memoryScreenshot
+	screenshotLikes map[string]map[string]time.Time
+
+	schedules      map[int]*ScheduleDisplay
+	scheduleFollow map[int]map[string]bool
+	lastScheduleId int
+
+	chatMessages    []*memoryChatMessage
+	playerLocations map[string]map[int]time.Time
+
+	tags           map[string]map[string]time.Time
+	timeTrials     map[memoryTimeTrialKey]int
+	minigameScores map[memoryMinigameKey]int
+
+	modActions []memoryModAction
+	reports    map[memoryReportKey]*memoryReport
+
+	pushSubscriptions map[string]map[string]*webpush.Subscription
+	apiQueries        map[memoryApiQueryKey]memoryApiQuery
+}
+
+type memoryPlayer struct {
+	ip     string
+	rank   int
+	banned bool
+	muted  bool
+}
+
+type memoryAccount struct {
+	uuid            string
+	user            string
+	ip              string
+	pass            string
+	badge           string
+	badgeSlotRows   int
+	badgeSlotCols   int
+	screenshotLimit int
+	registered      time.Time
+	loggedIn        time.Time
+	inactive        bool
+}
+
+type memoryGameKey struct {
+	uuid string
+	game string
+}
+
+type memoryGameData struct {
+	name            string
+	systemName      string
+	spriteName      string
+	spriteIndex     int
+	online          bool
+	lastActive      time.Time
+	medals          [5]int
+	lastGlobalMsgId string
+	lastPartyMsgId  string
+}
+
+type memorySession struct {
+	uuid       string
+	expiration time.Time
+}
+
+type memoryParty struct {
+	Party
+	game string
+}
+
+type memoryPartyMember struct {
+	partyId int
+	uuid    string
+}
+
+type memoryPlayerBadge struct {
+	slotRow  int
+	slotCol  int
+	unlocked time.Time
+}
+
+type memoryPresetKey struct {
+	uuid     string
+	presetId int
+}
+
+type memoryEventPeriod struct {
+	id            int
+	periodOrdinal int
+	startDate     time.Time
+	endDate       time.Time
+}
+
+type memoryGameEventPeriod struct {
+	id        int
+	periodId  int
+	game      string
+	enableVms bool
+}
+
+type memoryLocation struct {
+	id       int
+	game     string
+	title    string
+	titleJP  string
+	depth    int
+	minDepth int
+	mapIds   []string
+	secret   bool
+}
+
+type memoryEventLocation struct {
+	id           int
+	locationId   int
+	gamePeriodId int
+	eventType    int
+	exp          int
+	startDate    time.Time
+	endDate      time.Time
+}
+
+type memoryPlayerEventLocation struct {
+	id           int
+	locationId   int
+	gamePeriodId int
+	uuid         string
+	startDate    time.Time
+	endDate      time.Time
+}
+
+type memoryLocationQueue struct {
+	date        time.Time
+	locationIds []int
+}
+
+type memoryEventVm struct {
+	id           int
+	gamePeriodId int
+	mapId        int
+	eventIds     []int
+	exp          int
+	startDate    time.Time
+	endDate      time.Time
+}
+
+type memoryEventCompletion struct {
+	eventId   int
+	uuid      string
+	eventType int
+	exp       int
+}
+
+type memoryScreenshot struct {
+	id              string
+	uuid            string
+	game            string
+	mapId           string
+	mapX            int
+	mapY            int
+	public          bool
+	publicTimestamp time.Time
+	temp            bool
+	spoiler         bool
+	timestamp       time.Time
+}
+
+type memoryChatMessage struct {
+	ChatMessage
+	game    string
+	partyId int
+}
+
+type memoryTimeTrialKey struct {
+	uuid  string
+	mapId int
+}
+
+type memoryMinigameKey struct {
+	uuid       string
+	minigameId string
+}
+
+type memoryModAction struct {
+	ModAction
+	reason string
+	expiry time.Time
+}
+
+type memoryReportKey struct {
+	uuid       string
+	targetUuid string
+	msgId      string
+}
+
+type memoryReport struct {
+	game        string
+	reason      string
+	originalMsg string
+	timestamp   time.Time
+	actionTaken bool
+}
+
+// memoryApiQueryKey has an empty game for Yume 2kki Explorer queries
+type memoryApiQueryKey struct {
+	api    string
+	game   string
+	action string
+	query  string
+}
+
+type memoryApiQuery struct {
+	response string
+	expiry   time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	m := &memoryStore{
+		players:           make(map[string]*memoryPlayer),
+		accounts:          make(map[string]*memoryAccount),
+		gameData:          make(map[memoryGameKey]*memoryGameData),
+		sessions:          make(map[string]memorySession),
+		blocks:            make(map[string]map[string]time.Time),
+		friends:           make(map[[2]string]bool),
+		parties:           make(map[int]*memoryParty),
+		playerBadges:      make(map[string]map[string]*memoryPlayerBadge),
+		badgePresets:      make(map[memoryPresetKey]string),
+		gamePlayerCounts:  make(map[string][]int),
+		locationQueues:    make(map[string]*memoryLocationQueue),
+		screenshotLikes:   make(map[string]map[string]time.Time),
+		schedules:         make(map[int]*ScheduleDisplay),
+		scheduleFollow:    make(map[int]map[string]bool),
+		playerLocations:   make(map[string]map[int]time.Time),
+		tags:              make(map[string]map[string]time.Time),
+		timeTrials:        make(map[memoryTimeTrialKey]int),
+		minigameScores:    make(map[memoryMinigameKey]int),
+		reports:           make(map[memoryReportKey]*memoryReport),
+		pushSubscriptions: make(map[string]map[string]*webpush.Subscription),
+		apiQueries:        make(map[memoryApiQueryKey]memoryApiQuery),
+	}
+
+	// there is no admin tooling to create event periods, so run one for a year
+	today := utcDate(0)
+	m.eventPeriods = append(m.eventPeriods, &memoryEventPeriod{id: 1, periodOrdinal: 1, startDate: today, endDate: today.AddDate(1, 0, 0)})
+	m.gameEventPeriods = append(m.gameEventPeriods, &memoryGameEventPeriod{id: 1, periodId: 1, game: getConfig().gameName, enableVms: true})
+
+	// the event pools are weighted by player counts and need at least one
+	m.gamePlayerCounts[getConfig().gameName] = []int{0}
+
+	return m
+}
+
+// utcDate is UTC_DATE() shifted by days
+func utcDate(days int) time.Time {
+	return time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, days)
+}
+
+// isCurrent is UTC_DATE() >= startDate AND UTC_DATE() < endDate
+func isCurrent(startDate time.Time, endDate time.Time) bool {
+	today := utcDate(0)
+	return !today.Before(startDate) && today.Before(endDate)
+}
+
+func (m *memoryStore) getGameData(uuid string, game string) *memoryGameData {
+	return m.gameData[memoryGameKey{uuid, game}]
+}
+
+func (m *memoryStore) getAccountByUser(user string) *memoryAccount {
+	for _, account := range m.accounts {
+		if account.user == user {
+			return account
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getSessionUuid(token string) (string, bool) {
+	session, ok := m.sessions[token]
+	if !ok || !time.Now().Before(session.expiration) {
+		return "", false
+	}
+
+	return session.uuid, true
+}
+
+func (m *memoryStore) getPlayerListData(uuid string, gameData *memoryGameData) PlayerListData {
+	playerListData := PlayerListData{
+		Uuid:        uuid,
+		Name:        gameData.name,
+		SystemName:  gameData.systemName,
+		SpriteName:  gameData.spriteName,
+		SpriteIndex: gameData.spriteIndex,
+		Medals:      gameData.medals,
+	}
+
+	if player, ok := m.players[uuid]; ok {
+		playerListData.Rank = player.rank
+	}
+
+	if account, ok := m.accounts[uuid]; ok {
+		playerListData.Name = account.user
+		playerListData.Account = true
+		playerListData.Badge = account.badge
+	}
+
+	return playerListData
+}
+
+// players
+
+func (m *memoryStore) getPlayerDataFromIp(ctx context.Context, ip string) (uuid string, banned bool, muted bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for uuid, player := range m.players {
+		if player.ip == ip {
+			return uuid, player.banned, player.muted, nil
+		}
+	}
+
+	return "", false, false, sql.ErrNoRows
+}
+
+func (m *memoryStore) createPlayerData(ctx context.Context, ip string, uuid string, banned bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.players[uuid]; ok {
+		return errors.New("player exists")
+	}
+
+	m.players[uuid] = &memoryPlayer{ip: ip, banned: banned}
+
+	return nil
+}
+
+func (m *memoryStore) getPlayerDataFromToken(ctx context.Context, token string) (uuid string, name string, rank int, badge string, banned bool, muted bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uuid, ok := m.getSessionUuid(token)
+	account, accountOk := m.accounts[uuid]
+	player, playerOk := m.players[uuid]
+	if !ok || !accountOk || !playerOk {
+		return "", "", 0, "", false, false, sql.ErrNoRows
+	}
+
+	return uuid, account.user, player.rank, account.badge, player.banned, player.muted, nil
+}
+
+func (m *memoryStore) getPlayerInfoFromToken(ctx context.Context, token string) (uuid string, name string, rank int, badge string, badgeSlotRows int, badgeSlotCols int, screenshotLimit int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uuid, ok := m.getSessionUuid(token)
+	account, accountOk := m.accounts[uuid]
+	player, playerOk := m.players[uuid]
+	if !ok || !accountOk || !playerOk {
+		return "", "", 0, "", 0, 0, 0, sql.ErrNoRows
+	}
+
+	return uuid, account.user, player.rank, account.badge, account.badgeSlotRows, account.badgeSlotCols, account.screenshotLimit, nil
+}
+
+func (m *memoryStore) getUuidFromToken(ctx context.Context, token string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uuid, ok := m.getSessionUuid(token)
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+
+	return uuid, nil
+}
+
+func (m *memoryStore) getPlayerInfo(ctx context.Context, ip string) (uuid string, name string, rank int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for uuid, player := range m.players {
+		if player.ip == ip {
+			if gameData := m.getGameData(uuid, getConfig().gameName); gameData != nil {
+				name = gameData.name
+			}
+			return uuid, name, player.rank, nil
+		}
+	}
+
+	return "", "", 0, sql.ErrNoRows
+}
+
+func (m *memoryStore) getPlayerRank(ctx context.Context, uuid string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	player, ok := m.players[uuid]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	return player.rank, nil
+}
+
+func (m *memoryStore) getPlayerModerationStatus(ctx context.Context, uuid string) (banned bool, muted bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	player, ok := m.players[uuid]
+	if !ok {
+		return false, false, sql.ErrNoRows
+	}
+
+	return player.banned, player.muted, nil
+}
+
+func (m *memoryStore) setPlayerBanned(ctx context.Context, uuid string, banned bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if player, ok := m.players[uuid]; ok {
+		player.banned = banned
+	}
+
+	return nil
+}
+
+func (m *memoryStore) setPlayerMuted(ctx context.Context, uuid string, muted bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if player, ok := m.players[uuid]; ok {
+		player.muted = muted
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getBannedMutedPlayers(ctx context.Context, banned bool) (players []PlayerInfo, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for uuid, player := range m.players {
+		if (banned && player.banned) || (!banned && player.muted) {
+			players = append(players, PlayerInfo{Uuid: uuid, Rank: player.rank})
+		}
+	}
+
+	return players, nil
+}
+
+func (m *memoryStore) isIpBanned(ctx context.Context, ip string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found bool
+
+	for uuid, account := range m.accounts {
+		if account.ip == ip {
+			if player, ok := m.players[uuid]; ok && player.banned {
+				return true, nil
+			}
+		}
+	}
+
+	for _, player := range m.players {
+		if player.ip == ip {
+			if player.banned {
+				return true, nil
+			}
+			found = true
+		}
+	}
+
+	if !found {
+		return false, sql.ErrNoRows
+	}
+
+	return false, nil
+}
+
+func (m *memoryStore) getUuidFromName(ctx context.Context, name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account := m.getAccountByUser(name)
+	if account == nil {
+		return "", sql.ErrNoRows
+	}
+
+	return account.uuid, nil
+}
+
+func (m *memoryStore) getAccountName(ctx context.Context, uuid string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[uuid]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+
+	return account.user, nil
+}
+
+func (m *memoryStore) getPlayerGameName(ctx context.Context, uuid string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, gameData := range m.gameData {
+		if key.uuid == uuid {
+			return gameData.name, nil
+		}
+	}
+
+	return "", sql.ErrNoRows
+}
+
+func (m *memoryStore) setAccountName(ctx context.Context, uuid string, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if account, ok := m.accounts[uuid]; ok {
+		account.user = name
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getPlayerMedals(ctx context.Context, uuid string) (medals [5]int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	gameData := m.getGameData(uuid, getConfig().gameName)
+	if gameData == nil {
+		return medals, sql.ErrNoRows
+	}
+
+	return gameData.medals, nil
+}
+
+func (m *memoryStore) getPlayerGameData(ctx context.Context, uuid string) (spriteName string, spriteIndex int, systemName string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	gameData := m.getGameData(uuid, getConfig().gameName)
+	if gameData == nil {
+		return "", 0, "", sql.ErrNoRows
+	}
+
+	return gameData.spriteName, gameData.spriteIndex, gameData.systemName, nil
+}
+
+func (m *memoryStore) addOrUpdatePlayerGameData(ctx context.Context, uuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryGameKey{uuid, getConfig().gameName}
+
+	gameData, ok := m.gameData[key]
+	if !ok {
+		gameData = &memoryGameData{}
+		m.gameData[key] = gameData
+	}
+
+	gameData.online = true
+	gameData.lastActive = time.Now().UTC()
+
+	return nil
+}
+
+func (m *memoryStore) updatePlayerGameActivities(ctx context.Context, activities []PlayerGameActivity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, activity := range activities {
+		if gameData := m.getGameData(activity.Uuid, getConfig().gameName); gameData != nil {
+			gameData.name = activity.Name
+			gameData.systemName = activity.SystemName
+			gameData.spriteName = activity.SpriteName
+			gameData.spriteIndex = activity.SpriteIndex
+			gameData.online = activity.Online
+			gameData.lastActive = time.Now().UTC()
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) setActivePlayersOffline(ctx context.Context, game string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, gameData := range m.gameData {
+		if key.game == game {
+			gameData.online = false
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) updatePlayerActivity(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	threeMonthsAgo := time.Now().AddDate(0, -3, 0)
+
+	for _, account := range m.accounts {
+		account.inactive = account.loggedIn.Before(threeMonthsAgo)
+	}
+
+	return nil
+}
+
+func (m *memoryStore) blockPlayer(ctx context.Context, uuid string, targetUuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.blocks[uuid] == nil {
+		m.blocks[uuid] = make(map[string]time.Time)
+	}
+
+	if _, ok := m.blocks[uuid][targetUuid]; !ok {
+		m.blocks[uuid][targetUuid] = time.Now()
+	}
+
+	return nil
+}
+
+func (m *memoryStore) unblockPlayer(ctx context.Context, uuid string, targetUuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.blocks[uuid], targetUuid)
+
+	return nil
+}
+
+func (m *memoryStore) isPlayerBlocked(ctx context.Context, uuid string, targetUuid string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.blocks[uuid][targetUuid]
+
+	return ok, nil
+}
+
+func (m *memoryStore) getBlockedPlayerData(ctx context.Context, uuid string) ([]*PlayerListData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var blockedPlayers []*PlayerListData
+
+	targetUuids := make([]string, 0, len(m.blocks[uuid]))
+	for targetUuid := range m.blocks[uuid] {
+		targetUuids = append(targetUuids, targetUuid)
+	}
+
+	sort.Slice(targetUuids, func(i, j int) bool {
+		return m.blocks[uuid][targetUuids[i]].Before(m.blocks[uuid][targetUuids[j]])
+	})
+
+	for _, targetUuid := range targetUuids {
+		gameData := m.getGameData(targetUuid, getConfig().gameName)
+		if gameData == nil {
+			continue
+		}
+
+		blockedPlayer := m.getPlayerListData(targetUuid, gameData)
+		blockedPlayers = append(blockedPlayers, &blockedPlayer)
+	}
+
+	return blockedPlayers, nil
+}
+
+func (m *memoryStore) addPlayerFriend(ctx context.Context, uuid string, targetUuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var accepted bool
+
+	if _, ok := m.friends[[2]string{targetUuid, uuid}]; ok {
+		m.friends[[2]string{targetUuid, uuid}] = true
+		accepted = true
+	}
+
+	if _, ok := m.friends[[2]string{uuid, targetUuid}]; !ok {
+		m.friends[[2]string{uuid, targetUuid}] = accepted
+	}
+
+	return nil
+}
+
+func (m *memoryStore) removePlayerFriend(ctx context.Context, uuid string, targetUuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.friends, [2]string{uuid, targetUuid})
+	delete(m.friends, [2]string{targetUuid, uuid})
+
+	return nil
+}
+
+// getFriendGameData picks the game the friend was last seen in, like the MySQL query
+func (m *memoryStore) getFriendGameData(uuid string) (string, *memoryGameData) {
+	var game string
+	var latest *memoryGameData
+
+	for key, gameData := range m.gameData {
+		if key.uuid != uuid || gameData.spriteName == "" {
+			continue
+		}
+
+		if latest == nil ||
+			(gameData.online && !latest.online) ||
+			(gameData.online == latest.online && gameData.lastActive.After(latest.lastActive)) ||
+			(gameData.online == latest.online && gameData.lastActive.Equal(latest.lastActive) && key.game == getConfig().gameName) {
+			game = key.game
+			latest = gameData
+		}
+	}
+
+	return game, latest
+}
+
+func (m *memoryStore) getPlayerFriendData(ctx context.Context, uuid string) (playerFriends []*PlayerFriend, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, accepted := range m.friends {
+		var friendUuid string
+		var incoming bool
+
+		switch uuid {
+		case key[0]:
+			friendUuid = key[1]
+		case key[1]:
+			// incoming requests are only listed until they are answered
+			if _, ok := m.friends[[2]string{key[1], key[0]}]; ok {
+				continue
+			}
+			friendUuid = key[0]
+			incoming = true
+		default:
+			continue
+		}
+
+		account, ok := m.accounts[friendUuid]
+		if !ok {
+			continue
+		}
+
+		game, gameData := m.getFriendGameData(friendUuid)
+		if gameData == nil {
+			continue
+		}
+
+		playerFriend := &PlayerFriend{
+			PlayerListFullData: PlayerListFullData{
+				PlayerListData: m.getPlayerListData(friendUuid, gameData),
+				MapId:          "0000",
+				PrevMapId:      "0000",
+				Online:         gameData.online,
+				LastActive:     gameData.lastActive,
+			},
+			Game:     game,
+			Incoming: incoming,
+			Accepted: accepted,
+		}
+		playerFriend.Name = account.user
+
+		playerFriends = append(playerFriends, playerFriend)
+	}
+
+	sort.Slice(playerFriends, func(i, j int) bool {
+		return playerFriends[i].Name < playerFriends[j].Name
+	})
+
+	return playerFriends, nil
+}
+
+func (m *memoryStore) accountExists(ctx context.Context, user string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.getAccountByUser(user) != nil, nil
+}
+
+func (m *memoryStore) accountExistsForUuid(ctx context.Context, uuid string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.accounts[uuid]
+
+	return ok, nil
+}
+
+func (m *memoryStore) createAccount(ctx context.Context, ip string, uuid string, user string, passHash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, player := range m.players {
+		if player.ip == ip {
+			player.ip = ""
+		}
+	}
+
+	if _, ok := m.accounts[uuid]; ok || m.getAccountByUser(user) != nil {
+		return errors.New("account exists")
+	}
+
+	m.accounts[uuid] = &memoryAccount{
+		uuid:            uuid,
+		user:            user,
+		ip:              ip,
+		pass:            string(passHash),
+		badge:           "null",
+		badgeSlotRows:   1,
+		badgeSlotCols:   3,
+		screenshotLimit: defaultPlayerScreenshotLimit,
+		registered:      time.Now(),
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getAccountPassHash(ctx context.Context, user string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account := m.getAccountByUser(user)
+	if account == nil {
+		return "", sql.ErrNoRows
+	}
+
+	return account.pass, nil
+}
+
+func (m *memoryStore) setAccountPassHash(ctx context.Context, user string, passHash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if account := m.getAccountByUser(user); account != nil {
+		account.pass = string(passHash)
+	}
+
+	return nil
+}
+
+func (m *memoryStore) setAccountPassHashForUuid(ctx context.Context, uuid string, passHash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if account, ok := m.accounts[uuid]; ok {
+		account.pass = string(passHash)
+	}
+
+	return nil
+}
+
+func (m *memoryStore) createPlayerSession(ctx context.Context, token string, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account := m.getAccountByUser(user)
+	if account == nil {
+		return nil
+	}
+
+	m.sessions[token] = memorySession{uuid: account.uuid, expiration: time.Now().AddDate(0, 0, 30)}
+	account.loggedIn = time.Now()
+
+	return nil
+}
+
+func (m *memoryStore) deletePlayerSession(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, token)
+
+	return nil
+}
+
+func (m *memoryStore) cleanupPlayers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for token, session := range m.sessions {
+		if session.expiration.Before(time.Now()) {
+			delete(m.sessions, token)
+		}
+	}
+
+	// the MySQL foreign keys keep guests that have any game data
+	for uuid, player := range m.players {
+		if player.ip == "" {
+			continue
+		}
+
+		var hasGameData bool
+		for key := range m.gameData {
+			if key.uuid == uuid {
+				hasGameData = true
+				break
+			}
+		}
+
+		if !hasGameData {
+			delete(m.players, uuid)
+		}
+	}
+
+	return nil
+}
+
+// parties
+
+func (m *memoryStore) getPlayerPartyId(ctx context.Context, uuid string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, member := range m.partyMembers {
+		if member.uuid == uuid {
+			if party, ok := m.parties[member.partyId]; ok && party.game == getConfig().gameName {
+				return party.Id, nil
+			}
+		}
+	}
+
+	return 0, sql.ErrNoRows
+}
+
+func (m *memoryStore) getPlayerParty(ctx context.Context, uuid string) (Party, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, member := range m.partyMembers {
+		if member.uuid != uuid {
+			continue
+		}
+
+		party, ok := m.parties[member.partyId]
+		if ok && party.game == getConfig().gameName && m.getGameData(uuid, party.game) != nil {
+			return party.Party, nil
+		}
+	}
+
+	return Party{}, sql.ErrNoRows
+}
+
+func (m *memoryStore) getPartyMembers(ctx context.Context, partyId int) (partyMembers []*PlayerListFullData, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	party, ok := m.parties[partyId]
+	if !ok {
+		return partyMembers, nil
+	}
+
+	for _, member := range m.partyMembers {
+		if member.partyId != partyId {
+			continue
+		}
+
+		gameData := m.getGameData(member.uuid, getConfig().gameName)
+		if gameData == nil {
+			continue
+		}
+
+		partyMembers = append(partyMembers, &PlayerListFullData{
+			PlayerListData: m.getPlayerListData(member.uuid, gameData),
+			MapId:          "0000",
+			PrevMapId:      "0000",
+			LastActive:     gameData.lastActive,
+		})
+	}
+
+	// owner first, then by rank, then by join order
+	sort.SliceStable(partyMembers, func(i, j int) bool {
+		iOwner, jOwner := partyMembers[i].Uuid == party.OwnerUuid, partyMembers[j].Uuid == party.OwnerUuid
+		if iOwner != jOwner {
+			return iOwner
+		}
+		return partyMembers[i].Rank > partyMembers[j].Rank
+	})
+
+	return partyMembers, nil
+}
+
+func (m *memoryStore) createParty(ctx context.Context, name string, public bool, pass string, theme string, description string, ownerUuid string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastPartyId++
+
+	m.parties[m.lastPartyId] = &memoryParty{
+		Party: Party{
+			Id:          m.lastPartyId,
+			Name:        name,
+			Public:      public,
+			Pass:        pass,
+			SystemName:  theme,
+			Description: description,
+			OwnerUuid:   ownerUuid,
+		},
+		game: getConfig().gameName,
+	}
+
+	return m.lastPartyId, nil
+}
+
+func (m *memoryStore) updateParty(ctx context.Context, partyId int, name string, public bool, pass string, theme string, description string, ownerUuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if party, ok := m.parties[partyId]; ok {
+		party.game = getConfig().gameName
+		party.OwnerUuid = ownerUuid
+		party.Name = name
+		party.Public = public
+		party.Pass = pass
+		party.SystemName = theme
+		party.Description = description
+	}
+
+	return nil
+}
+
+func (m *memoryStore) addPartyMember(ctx context.Context, partyId int, uuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.parties[partyId]; !ok {
+		return errors.New("party not found")
+	}
+
+	for _, member := range m.partyMembers {
+		if member.uuid == uuid && m.parties[member.partyId].game == getConfig().gameName {
+			return errors.New("player already in a party")
+		}
+	}
+
+	m.partyMembers = append(m.partyMembers, memoryPartyMember{partyId: partyId, uuid: uuid})
+
+	// the party's history starts after its latest message
+	if gameData := m.getGameData(uuid, getConfig().gameName); gameData != nil {
+		gameData.lastPartyMsgId = ""
+		for _, msg := range m.chatMessages {
+			if msg.game == getConfig().gameName && msg.partyId == partyId {
+				gameData.lastPartyMsgId = msg.MsgId
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) removePartyMember(ctx context.Context, uuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.partyMembers = slices.DeleteFunc(m.partyMembers, func(member memoryPartyMember) bool {
+		party, ok := m.parties[member.partyId]
+		return member.uuid == uuid && ok && party.game == getConfig().gameName
+	})
+
+	if gameData := m.getGameData(uuid, getConfig().gameName); gameData != nil {
+		gameData.lastPartyMsgId = ""
+	}
+
+	return nil
+}
+
+func (m *memoryStore) setPartyOwner(ctx context.Context, partyId int, uuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if party, ok := m.parties[partyId]; ok {
+		party.OwnerUuid = uuid
+	}
+
+	return nil
+}
+
+func (m *memoryStore) setPartyOwnerByRank(ctx context.Context, partyId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	party, ok := m.parties[partyId]
+	if !ok {
+		return nil
+	}
+
+	ownerUuid := ""
+	ownerRank := -1
+
+	for _, member := range m.partyMembers {
+		if member.partyId != partyId {
+			continue
+		}
+
+		var rank int
+		if player, ok := m.players[member.uuid]; ok {
+			rank = player.rank
+		}
+
+		if rank > ownerRank {
+			ownerUuid = member.uuid
+			ownerRank = rank
+		}
+	}
+
+	party.OwnerUuid = ownerUuid
+
+	return nil
+}
+
+func (m *memoryStore) deleteParty(ctx context.Context, partyId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, member := range m.partyMembers {
+		if member.partyId == partyId {
+			return errors.New("party has members")
+		}
+	}
+
+	delete(m.parties, partyId)
+
+	return nil
+}
+
+func (m *memoryStore) deletePartyAndMembers(ctx context.Context, partyId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.partyMembers = slices.DeleteFunc(m.partyMembers, func(member memoryPartyMember) bool {
+		return member.partyId == partyId
+	})
+
+	delete(m.parties, partyId)
+
+	return nil
+}
+
+// badges
+
+var (
+	badgeSlotRowThresholds   = []int{300, 1000, 2000, 4000, 7500, 12500, 20000, 30000, 50000}
+	badgeSlotColThresholds   = []int{50, 150, 300, 500}
+	screenshotLimitThreshods = []int{100, 250, 500, 1000, 2500, 5000, 7500, 10000, 12500, 15000, 17500, 20000, 25000}
+)
+
+// countBelow counts the thresholds value has reached
+func countBelow(thresholds []int, value int) int {
+	for i, threshold := range thresholds {
+		if value < threshold {
+			return i
+		}
+	}
+
+	return len(thresholds)
+}
+
+func (m *memoryStore) getPlayerBadgeSlotCounts(ctx context.Context, playerName string) (badgeSlotRows int, badgeSlotCols int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account := m.getAccountByUser(playerName)
+	if account == nil {
+		return 0, 0, sql.ErrNoRows
+	}
+
+	return account.badgeSlotRows, account.badgeSlotCols, nil
+}
+
+func (m *memoryStore) updatePlayerBadgeSlotCounts(ctx context.Context, uuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, account := range m.accounts {
+		if uuid != "" && account.uuid != uuid {
+			continue
+		}
+
+		var bp, bc int
+		for badgeId := range m.playerBadges[account.uuid] {
+			for _, badge := range m.badges {
+				if badge.BadgeId == badgeId && !badge.Hidden {
+					bp += badge.Bp
+					bc++
+				}
+			}
+		}
+
+		if bc == 0 {
+			continue
+		}
+
+		account.badgeSlotRows = countBelow(badgeSlotRowThresholds, bp) + 1
+		account.badgeSlotCols = countBelow(badgeSlotColThresholds, bc) + 3
+		account.screenshotLimit = max(countBelow(screenshotLimitThreshods, bp)*5+10, account.screenshotLimit)
+	}
+
+	return nil
+}
+
+func (m *memoryStore) setPlayerBadge(ctx context.Context, uuid string, badge string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if account, ok := m.accounts[uuid]; ok {
+		account.badge = badge
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getPlayerBadgeSlots(ctx context.Context, playerName string, badgeSlotRows int, badgeSlotCols int) (badgeSlots []BadgeSlot, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account := m.getAccountByUser(playerName)
+	if account == nil {
+		return badgeSlots, nil
+	}
+
+	for badgeId, playerBadge := range m.playerBadges[account.uuid] {
+		if playerBadge.slotRow >= 1 && playerBadge.slotRow <= badgeSlotRows && playerBadge.slotCol >= 1 && playerBadge.slotCol <= badgeSlotCols {
+			badgeSlots = append(badgeSlots, BadgeSlot{BadgeId: badgeId, Row: playerBadge.slotRow, Col: playerBadge.slotCol})
+		}
+	}
+
+	sort.Slice(badgeSlots, func(i, j int) bool {
+		if badgeSlots[i].Row != badgeSlots[j].Row {
+			return badgeSlots[i].Row < badgeSlots[j].Row
+		}
+		return badgeSlots[i].Col < badgeSlots[j].Col
+	})
+
+	return badgeSlots, nil
+}
+
+func (m *memoryStore) setPlayerBadgeSlot(ctx context.Context, uuid string, badgeId string, slotRow int, slotCol int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setPlayerBadgeSlotLocked(uuid, badgeId, slotRow, slotCol)
+
+	return nil
+}
+
+// setPlayerBadgeSlotLocked swaps the badge with the one in the slot, if any
+func (m *memoryStore) setPlayerBadgeSlotLocked(uuid string, badgeId string, slotRow int, slotCol int) {
+	playerBadges := m.playerBadges[uuid]
+
+	for slotBadgeId, playerBadge := range playerBadges {
+		if playerBadge.slotRow != slotRow || playerBadge.slotCol != slotCol {
+			continue
+		}
+
+		if slotBadgeId == badgeId {
+			return
+		}
+
+		if badge, ok := playerBadges[badgeId]; ok {
+			playerBadge.slotRow, playerBadge.slotCol = badge.slotRow, badge.slotCol
+		} else {
+			playerBadge.slotRow, playerBadge.slotCol = 0, 0
+		}
+	}
+
+	if badge, ok := playerBadges[badgeId]; ok {
+		badge.slotRow, badge.slotCol = slotRow, slotCol
+	}
+}
+
+func (m *memoryStore) getPlayerBadgePreset(ctx context.Context, uuid string, presetId int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	preset, ok := m.badgePresets[memoryPresetKey{uuid, presetId}]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+
+	return preset, nil
+}
+
+func (m *memoryStore) setPlayerBadgePreset(ctx context.Context, uuid string, presetId int, data string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.badgePresets[memoryPresetKey{uuid, presetId}] = data
+
+	return nil
+}
+
+func (m *memoryStore) applyPlayerBadgePreset(ctx context.Context, uuid string, preset [][]string, slotRows int, slotCols int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for r := range slotRows {
+		for c := range slotCols {
+			if r >= len(preset) || c >= len(preset[r]) {
+				for _, playerBadge := range m.playerBadges[uuid] {
+					if playerBadge.slotRow == r+1 && playerBadge.slotCol == c+1 {
+						playerBadge.slotRow, playerBadge.slotCol = 0, 0
+					}
+				}
+				continue
+			}
+
+			m.setPlayerBadgeSlotLocked(uuid, preset[r][c], r+1, c+1)
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) writeBadges(ctx context.Context, badges []BadgeRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.badges = slices.Clone(badges)
+
+	return nil
+}
+
+func (m *memoryStore) getPlayerUnlockedBadgeIds(ctx context.Context, uuid string) (unlockedBadgeIds []string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for badgeId := range m.playerBadges[uuid] {
+		unlockedBadgeIds = append(unlockedBadgeIds, badgeId)
+	}
+
+	return unlockedBadgeIds, nil
+}
+
+func (m *memoryStore) unlockPlayerBadge(ctx context.Context, uuid string, badgeId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.playerBadges[uuid] == nil {
+		m.playerBadges[uuid] = make(map[string]*memoryPlayerBadge)
+	}
+
+	if _, ok := m.playerBadges[uuid][badgeId]; !ok {
+		m.playerBadges[uuid][badgeId] = &memoryPlayerBadge{unlocked: time.Now()}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) removePlayerBadge(ctx context.Context, uuid string, badgeId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.playerBadges[uuid][badgeId]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(m.playerBadges[uuid], badgeId)
+
+	if account, ok := m.accounts[uuid]; ok && account.badge == badgeId {
+		account.badge = "null"
+	}
+
+	return nil
+}
+
+// getBadgeUnlockCounts counts unlocks among active accounts with any badge
+func (m *memoryStore) getBadgeUnlockCounts() (unlockCounts map[string]int, accountCount int) {
+	unlockCounts = make(map[string]int)
+
+	for uuid, playerBadges := range m.playerBadges {
+		account, ok := m.accounts[uuid]
+		if !ok || account.inactive || len(playerBadges) == 0 {
+			continue
+		}
+
+		accountCount++
+
+		for badgeId := range playerBadges {
+			unlockCounts[badgeId]++
+		}
+	}
+
+	return unlockCounts, accountCount
+}
+
+func (m *memoryStore) getBadgeUnlockPercentage(ctx context.Context, badgeId string) (float32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unlockCounts, accountCount := m.getBadgeUnlockCounts()
+	if accountCount == 0 {
+		return 0, nil
+	}
+
+	return float32(unlockCounts[badgeId]) / float32(accountCount) * 100, nil
+}
+
+func (m *memoryStore) getBadgeUnlockPercentages(ctx context.Context) (map[string]float32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unlockPercentages := make(map[string]float32)
+
+	unlockCounts, accountCount := m.getBadgeUnlockCounts()
+	for badgeId, unlockCount := range unlockCounts {
+		unlockPercentages[badgeId] = float32(unlockCount) / float32(accountCount) * 100
+	}
+
+	return unlockPercentages, nil
+}
+
+// events
+
+func (m *memoryStore) getCurrentEventPeriod() *memoryEventPeriod {
+	for _, eventPeriod := range m.eventPeriods {
+		if isCurrent(eventPeriod.startDate, eventPeriod.endDate) {
+			return eventPeriod
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getGameEventPeriod(id int) *memoryGameEventPeriod {
+	for _, gameEventPeriod := range m.gameEventPeriods {
+		if gameEventPeriod.id == id {
+			return gameEventPeriod
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getLocation(id int) *memoryLocation {
+	for _, location := range m.locations {
+		if location.id == id {
+			return location
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getEventCompletion(eventId int, uuid string, eventType int) *memoryEventCompletion {
+	for i, eventCompletion := range m.eventCompletions {
+		if eventCompletion.eventId == eventId && eventCompletion.uuid == uuid && eventCompletion.eventType == eventType {
+			return &m.eventCompletions[i]
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getCurrentEventPeriodId(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	eventPeriod := m.getCurrentEventPeriod()
+	if eventPeriod == nil {
+		return 0, sql.ErrNoRows
+	}
+
+	return eventPeriod.id, nil
+}
+
+func (m *memoryStore) getCurrentEventPeriodData(ctx context.Context) (EventPeriod, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if eventPeriod := m.getCurrentEventPeriod(); eventPeriod != nil {
+		for _, gameEventPeriod := range m.gameEventPeriods {
+			if gameEventPeriod.periodId == eventPeriod.id && gameEventPeriod.game == getConfig().gameName {
+				return EventPeriod{PeriodOrdinal: eventPeriod.periodOrdinal, EndDate: eventPeriod.endDate, EnableVms: gameEventPeriod.enableVms}, nil
+			}
+		}
+	}
+
+	return EventPeriod{}, sql.ErrNoRows
+}
+
+func (m *memoryStore) getGameCurrentEventPeriodsData(ctx context.Context) (map[string]*EventPeriod, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	gameEventPeriods := make(map[string]*EventPeriod)
+
+	if eventPeriod := m.getCurrentEventPeriod(); eventPeriod != nil {
+		for _, gameEventPeriod := range m.gameEventPeriods {
+			if gameEventPeriod.periodId == eventPeriod.id {
+				gameEventPeriods[gameEventPeriod.game] = &EventPeriod{Id: gameEventPeriod.id, PeriodOrdinal: eventPeriod.periodOrdinal, EndDate: eventPeriod.endDate, EnableVms: gameEventPeriod.enableVms}
+			}
+		}
+	}
+
+	return gameEventPeriods, nil
+}
+
+func (m *memoryStore) getGameEventPeriodId(ctx context.Context, game string, periodId int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, gameEventPeriod := range m.gameEventPeriods {
+		if gameEventPeriod.game == game && gameEventPeriod.periodId == periodId {
+			return gameEventPeriod.id, nil
+		}
+	}
+
+	return 0, sql.ErrNoRows
+}
+
+func (m *memoryStore) getGamePlayerCounts(ctx context.Context, periodId int) (gameIds []string, playerCounts []int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, gameEventPeriod := range m.gameEventPeriods {
+		counts := m.gamePlayerCounts[gameEventPeriod.game]
+		if gameEventPeriod.periodId != periodId || len(counts) == 0 {
+			continue
+		}
+
+		var total int
+		for _, count := range counts {
+			total += count
+		}
+
+		gameIds = append(gameIds, gameEventPeriod.game)
+		playerCounts = append(playerCounts, (total+len(counts)-1)/len(counts))
+	}
+
+	return gameIds, playerCounts, nil
+}
+
+func (m *memoryStore) writeGamePlayerCount(ctx context.Context, playerCount int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := append(m.gamePlayerCounts[getConfig().gameName], playerCount)
+	if len(counts) > 28 {
+		counts = counts[len(counts)-28:]
+	}
+
+	m.gamePlayerCounts[getConfig().gameName] = counts
+
+	return nil
+}
+
+// getPlayerEventExp sums the exp of completed locations and VMs, filtered by period and dates
+func (m *memoryStore) getPlayerEventExp(uuid string, periodId int, minStartDate time.Time, maxEndDate time.Time) int {
+	var exp int
+
+	for _, eventCompletion := range m.eventCompletions {
+		if eventCompletion.uuid != uuid {
+			continue
+		}
+
+		var gamePeriodId int
+		var startDate, endDate time.Time
+
+		switch eventCompletion.eventType {
+		case 0:
+			idx := slices.IndexFunc(m.eventLocations, func(el *memoryEventLocation) bool { return el.id == eventCompletion.eventId })
+			if idx == -1 {
+				continue
+			}
+			gamePeriodId, startDate, endDate = m.eventLocations[idx].gamePeriodId, m.eventLocations[idx].startDate, m.eventLocations[idx].endDate
+		case 2:
+			idx := slices.IndexFunc(m.eventVms, func(ev *memoryEventVm) bool { return ev.id == eventCompletion.eventId })
+			if idx == -1 {
+				continue
+			}
+			gamePeriodId, startDate, endDate = m.eventVms[idx].gamePeriodId, m.eventVms[idx].startDate, m.eventVms[idx].endDate
+		default:
+			continue
+		}
+
+		gameEventPeriod := m.getGameEventPeriod(gamePeriodId)
+		if gameEventPeriod == nil || (periodId != 0 && gameEventPeriod.periodId != periodId) {
+			continue
+		}
+
+		if (!minStartDate.IsZero() && startDate.Before(minStartDate)) || (!maxEndDate.IsZero() && endDate.After(maxEndDate)) {
+			continue
+		}
+
+		exp += eventCompletion.exp
+	}
+
+	return exp
+}
+
+func (m *memoryStore) getPlayerTotalEventExp(ctx context.Context, uuid string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.getPlayerEventExp(uuid, 0, time.Time{}, time.Time{}), nil
+}
+
+func (m *memoryStore) getPlayerPeriodEventExp(ctx context.Context, uuid string, periodId int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.getPlayerEventExp(uuid, periodId, time.Time{}, time.Time{}), nil
+}
+
+func (m *memoryStore) getPlayerWeekEventExp(ctx context.Context, uuid string, periodId int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	weekdayIndex := int(time.Now().UTC().Weekday())
+
+	return m.getPlayerEventExp(uuid, periodId, utcDate(-weekdayIndex), utcDate(7-weekdayIndex)), nil
+}
+
+func (m *memoryStore) getPlayerEventLocationCount(ctx context.Context, uuid string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int
+	for _, eventCompletion := range m.eventCompletions {
+		if eventCompletion.uuid == uuid && eventCompletion.eventType < 2 {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *memoryStore) getPlayerEventLocationCompletion(ctx context.Context, uuid string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[uuid]; !ok {
+		return 0, nil
+	}
+
+	locationIds := make(map[int]bool)
+
+	for _, eventCompletion := range m.eventCompletions {
+		if eventCompletion.uuid != uuid {
+			continue
+		}
+
+		locationId := -1
+
+		switch eventCompletion.eventType {
+		case 0:
+			if idx := slices.IndexFunc(m.eventLocations, func(el *memoryEventLocation) bool { return el.id == eventCompletion.eventId }); idx != -1 {
+				locationId = m.eventLocations[idx].locationId
+			}
+		case 1:
+			if idx := slices.IndexFunc(m.playerEventLocations, func(pel *memoryPlayerEventLocation) bool { return pel.id == eventCompletion.eventId }); idx != -1 {
+				locationId = m.playerEventLocations[idx].locationId
+			}
+		}
+
+		if location := m.getLocation(locationId); location != nil && !location.secret {
+			locationIds[locationId] = true
+		}
+	}
+
+	return len(locationIds), nil
+}
+
+func (m *memoryStore) getPlayerEventVmCount(ctx context.Context, uuid string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int
+	for _, eventCompletion := range m.eventCompletions {
+		if eventCompletion.uuid == uuid && eventCompletion.eventType == 2 {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *memoryStore) getLocationName(ctx context.Context, locationId int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	location := m.getLocation(locationId)
+	if location == nil {
+		return "", sql.ErrNoRows
+	}
+
+	return location.title, nil
+}
+
+func (m *memoryStore) getEventLocationCount(ctx context.Context, periodId int, eventType int, exp int, daysAgo int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if periodId == 0 {
+		return len(m.eventLocations), nil
+	}
+
+	startDate := utcDate(-daysAgo)
+
+	var count int
+	for _, eventLocation := range m.eventLocations {
+		gameEventPeriod := m.getGameEventPeriod(eventLocation.gamePeriodId)
+		if gameEventPeriod == nil || gameEventPeriod.periodId != periodId || eventLocation.eventType != eventType || !eventLocation.startDate.Equal(startDate) {
+			continue
+		}
+
+		if exp != 0 && eventLocation.exp != exp {
+			continue
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+func (m *memoryStore) getOrWriteLocationId(gameId string, title string, titleJP string, depth int, minDepth int, mapIds []string) int {
+	for _, location := range m.locations {
+		if location.game == gameId && location.title == title {
+			location.titleJP = titleJP
+			location.depth = depth
+			location.minDepth = minDepth
+			location.mapIds = mapIds
+			return location.id
+		}
+	}
+
+	location := &memoryLocation{
+		id:       len(m.locations) + 1,
+		game:     gameId,
+		title:    title,
+		titleJP:  titleJP,
+		depth:    depth,
+		minDepth: minDepth,
+		mapIds:   mapIds,
+	}
+
+	m.locations = append(m.locations, location)
+
+	return location.id
+}
+
+func (m *memoryStore) writeEventLocation(ctx context.Context, gameId string, gameEventPeriodId int, eventType int, title string, titleJP string, depth int, minDepth int, exp int, mapIds []string, offsetDays int, days int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	locationId := m.getOrWriteLocationId(gameId, title, titleJP, depth, minDepth, mapIds)
+
+	m.lastEventId++
+	m.eventLocations = append(m.eventLocations, &memoryEventLocation{
+		id:           m.lastEventId,
+		locationId:   locationId,
+		gamePeriodId: gameEventPeriodId,
+		eventType:    eventType,
+		exp:          exp,
+		startDate:    utcDate(-offsetDays),
+		endDate:      utcDate(days),
+	})
+
+	return nil
+}
+
+func (m *memoryStore) writePlayerEventLocation(ctx context.Context, gameId string, gameEventPeriodId int, uuid string, title string, titleJP string, depth int, minDepth int, mapIds []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	today := utcDate(0)
+
+	// every player is given the locations of the day in the same order
+	queue, ok := m.locationQueues[gameId]
+	if !ok || !queue.date.Equal(today) {
+		queue = &memoryLocationQueue{date: today}
+		m.locationQueues[gameId] = queue
+	}
+
+	var completedToday int
+	for _, playerEventLocation := range m.playerEventLocations {
+		if playerEventLocation.gamePeriodId == gameEventPeriodId && playerEventLocation.uuid == uuid && playerEventLocation.startDate.Equal(today) && m.getEventCompletion(playerEventLocation.id, uuid, 1) != nil {
+			completedToday++
+		}
+	}
+
+	var locationId int
+	if completedToday < len(queue.locationIds) {
+		locationId = queue.locationIds[completedToday]
+	} else {
+		locationId = m.getOrWriteLocationId(gameId, title, titleJP, depth, minDepth, mapIds)
+		queue.locationIds = append(queue.locationIds, locationId)
+	}
+
+	for _, playerEventLocation := range m.playerEventLocations {
+		if playerEventLocation.uuid == uuid && playerEventLocation.gamePeriodId == gameEventPeriodId && isCurrent(playerEventLocation.startDate, playerEventLocation.endDate) && m.getEventCompletion(playerEventLocation.id, uuid, 1) == nil {
+			return nil
+		}
+	}
+
+	m.lastEventId++
+	m.playerEventLocations = append(m.playerEventLocations, &memoryPlayerEventLocation{
+		id:           m.lastEventId,
+		locationId:   locationId,
+		gamePeriodId: gameEventPeriodId,
+		uuid:         uuid,
+		startDate:    today,
+		endDate:      utcDate(1),
+	})
+
+	return nil
+}
+
+func (m *memoryStore) getCurrentEventLocations(ctx context.Context, uuid string, periodId int) (eventLocations []*EventLocation, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, el := range m.eventLocations {
+		gameEventPeriod := m.getGameEventPeriod(el.gamePeriodId)
+		location := m.getLocation(el.locationId)
+		if gameEventPeriod == nil || location == nil || gameEventPeriod.periodId != periodId || !isCurrent(el.startDate, el.endDate) {
+			continue
+		}
+
+		eventLocations = append(eventLocations, &EventLocation{
+			Id:         el.id,
+			Type:       el.eventType,
+			Game:       gameEventPeriod.game,
+			LocationId: location.id,
+			Title:      location.title,
+			TitleJP:    location.titleJP,
+			Depth:      location.depth,
+			MinDepth:   location.minDepth,
+			Exp:        el.exp,
+			EndDate:    el.endDate,
+			Complete:   m.getEventCompletion(el.id, uuid, 0) != nil,
+		})
+	}
+
+	sort.SliceStable(eventLocations, func(i, j int) bool {
+		return eventLocations[i].Type < eventLocations[j].Type
+	})
+
+	return eventLocations, nil
+}
+
+func (m *memoryStore) getCurrentPlayerEventLocations(ctx context.Context, uuid string, periodId int) (eventLocations []*EventLocation, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, pel := range m.playerEventLocations {
+		gameEventPeriod := m.getGameEventPeriod(pel.gamePeriodId)
+		location := m.getLocation(pel.locationId)
+		if pel.uuid != uuid || gameEventPeriod == nil || location == nil || gameEventPeriod.periodId != periodId || gameEventPeriod.game != getConfig().gameName || !isCurrent(pel.startDate, pel.endDate) {
+			continue
+		}
+
+		if m.getEventCompletion(pel.id, uuid, 1) != nil {
+			continue
+		}
+
+		eventLocations = append(eventLocations, &EventLocation{
+			Id:         pel.id,
+			Game:       gameEventPeriod.game,
+			LocationId: location.id,
+			Title:      location.title,
+			TitleJP:    location.titleJP,
+			Depth:      location.depth,
+			MinDepth:   location.minDepth,
+			EndDate:    pel.endDate,
+		})
+	}
+
+	return eventLocations, nil
+}
+
+func (m *memoryStore) getEventLocationCandidates(ctx context.Context, gameEventPeriodId int, title string) (candidates []*EventCandidate, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, el := range m.eventLocations {
+		location := m.getLocation(el.locationId)
+		if el.gamePeriodId != gameEventPeriodId || location == nil || location.title != title || location.game != getConfig().gameName || !isCurrent(el.startDate, el.endDate) {
+			continue
+		}
+
+		candidates = append(candidates, &EventCandidate{Id: el.id, Type: el.eventType, Exp: el.exp, MapIds: location.mapIds})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Type < candidates[j].Type
+	})
+
+	return candidates, nil
+}
+
+func (m *memoryStore) getPlayerEventLocationCandidates(ctx context.Context, gameEventPeriodId int, title string, uuid string) (candidates []*EventCandidate, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, pel := range m.playerEventLocations {
+		location := m.getLocation(pel.locationId)
+		if pel.gamePeriodId != gameEventPeriodId || pel.uuid != uuid || location == nil || location.title != title || location.game != getConfig().gameName || !isCurrent(pel.startDate, pel.endDate) {
+			continue
+		}
+
+		candidates = append(candidates, &EventCandidate{Id: pel.id, Type: 1, MapIds: location.mapIds})
+	}
+
+	return candidates, nil
+}
+
+func (m *memoryStore) getCurrentEventVms(ctx context.Context, uuid string, periodId int) (eventVms []*EventVm, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ev := range m.eventVms {
+		gameEventPeriod := m.getGameEventPeriod(ev.gamePeriodId)
+		if gameEventPeriod == nil || gameEventPeriod.periodId != periodId || !isCurrent(ev.startDate, ev.endDate) {
+			continue
+		}
+
+		eventVms = append(eventVms, &EventVm{
+			Id:       ev.id,
+			Game:     gameEventPeriod.game,
+			Exp:      ev.exp,
+			EndDate:  ev.endDate,
+			Complete: m.getEventCompletion(ev.id, uuid, 2) != nil,
+		})
+	}
+
+	sort.SliceStable(eventVms, func(i, j int) bool {
+		return eventVms[i].Game < eventVms[j].Game
+	})
+
+	return eventVms, nil
+}
+
+func (m *memoryStore) getEventVmInfo(ctx context.Context, id int) (gameId string, mapId int, vmGroup []int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ev := range m.eventVms {
+		if ev.id == id {
+			if gameEventPeriod := m.getGameEventPeriod(ev.gamePeriodId); gameEventPeriod != nil {
+				return gameEventPeriod.game, ev.mapId, slices.Clone(ev.eventIds), nil
+			}
+		}
+	}
+
+	return "", 0, nil, sql.ErrNoRows
+}
+
+func (m *memoryStore) getEventVmStartedDaysAgo(ctx context.Context, periodId int, daysAgo int) (id int, gameId string, mapId int, vmGroup []int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	startDate := utcDate(-daysAgo)
+
+	for _, ev := range m.eventVms {
+		gameEventPeriod := m.getGameEventPeriod(ev.gamePeriodId)
+		if gameEventPeriod != nil && gameEventPeriod.periodId == periodId && ev.startDate.Equal(startDate) {
+			return ev.id, gameEventPeriod.game, ev.mapId, slices.Clone(ev.eventIds), nil
+		}
+	}
+
+	return 0, "", 0, nil, sql.ErrNoRows
+}
+
+func (m *memoryStore) getEventVmCandidates(ctx context.Context, periodId int, mapId int, eventId int) (candidates []*EventCandidate, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ev := range m.eventVms {
+		gameEventPeriod := m.getGameEventPeriod(ev.gamePeriodId)
+		if gameEventPeriod == nil || gameEventPeriod.periodId != periodId || ev.mapId != mapId || !slices.Contains(ev.eventIds, eventId) || !isCurrent(ev.startDate, ev.endDate) {
+			continue
+		}
+
+		candidates = append(candidates, &EventCandidate{Id: ev.id, Type: 2, MapId: ev.mapId, Exp: ev.exp})
+	}
+
+	return candidates, nil
+}
+
+func (m *memoryStore) writeEventVm(ctx context.Context, gameEventPeriodId int, mapId int, vmGroup EventIds, exp int, offsetDays int, days int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastEventId++
+	m.eventVms = append(m.eventVms, &memoryEventVm{
+		id:           m.lastEventId,
+		gamePeriodId: gameEventPeriodId,
+		mapId:        mapId,
+		eventIds:     slices.Clone(vmGroup),
+		exp:          exp,
+		startDate:    utcDate(-offsetDays),
+		endDate:      utcDate(days),
+	})
+
+	return nil
+}
+
+func (m *memoryStore) writeEventCompletion(ctx context.Context, eventId int, uuid string, eventType int, exp int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.getEventCompletion(eventId, uuid, eventType) != nil {
+		return errors.New("event already completed")
+	}
+
+	m.eventCompletions = append(m.eventCompletions, memoryEventCompletion{eventId: eventId, uuid: uuid, eventType: eventType, exp: exp})
+
+	return nil
+}
+
+func (m *memoryStore) cleanupEvents(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	today := utcDate(0)
+
+	m.playerEventLocations = slices.DeleteFunc(m.playerEventLocations, func(pel *memoryPlayerEventLocation) bool {
+		if !today.After(pel.endDate) {
+			return false
+		}
+
+		for _, eventCompletion := range m.eventCompletions {
+			if eventCompletion.eventId == pel.id && eventCompletion.eventType == 1 {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	for game, queue := range m.locationQueues {
+		if today.After(queue.date) {
+			delete(m.locationQueues, game)
+		}
+	}
+
+	return nil
+}
+
+// screenshots
+
+func (m *memoryStore) getScreenshotLikeCount(id string, since time.Time) int {
+	var count int
+	for _, timestamp := range m.screenshotLikes[id] {
+		if !timestamp.Before(since) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// canEditScreenshot is the MySQL rank check, which doesn't look at the screenshot itself
+func (m *memoryStore) canEditScreenshot(uuid string) bool {
+	player, ok := m.players[uuid]
+	if !ok {
+		return false
+	}
+
+	for _, screenshot := range m.screenshots {
+		owner, ok := m.players[screenshot.uuid]
+		if ok && (screenshot.uuid == uuid || player.rank > owner.rank) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *memoryStore) getScreenshotData(uuid string, screenshot *memoryScreenshot) (*ScreenshotData, bool) {
+	owner, ok := m.players[screenshot.uuid]
+	account, accountOk := m.accounts[screenshot.uuid]
+	gameData := m.getGameData(screenshot.uuid, screenshot.game)
+	if !ok || !accountOk || gameData == nil {
+		return nil, false
+	}
+
+	_, liked := m.screenshotLikes[screenshot.id][uuid]
+
+	return &ScreenshotData{
+		Id: screenshot.id,
+		Owner: &ScreenshotOwner{
+			Uuid:       screenshot.uuid,
+			Name:       account.user,
+			Rank:       owner.rank,
+			Badge:      account.badge,
+			SystemName: gameData.systemName,
+		},
+		Game:      screenshot.game,
+		MapId:     screenshot.mapId,
+		MapX:      screenshot.mapX,
+		MapY:      screenshot.mapY,
+		Timestamp: screenshot.publicTimestamp,
+		Public:    screenshot.public,
+		Spoiler:   screenshot.spoiler,
+		LikeCount: len(m.screenshotLikes[screenshot.id]),
+		Liked:     liked,
+	}, true
+}
+
+func (m *memoryStore) getPlayerScreenshotLimit(ctx context.Context, uuid string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[uuid]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	return account.screenshotLimit, nil
+}
+
+func (m *memoryStore) getScreenshotFeed(ctx context.Context, uuid string, limit int, offset int, offsetId string, game string, sortOrder string, intervalType string) ([]*ScreenshotData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var since time.Time
+	switch intervalType {
+	case "day":
+		since = time.Now().UTC().AddDate(0, 0, -1)
+	case "week":
+		since = time.Now().UTC().AddDate(0, 0, -7)
+	case "month":
+		since = time.Now().UTC().AddDate(0, -1, 0)
+	case "year":
+		since = time.Now().UTC().AddDate(-1, 0, 0)
+	}
+
+	var offsetTimestamp *time.Time
+	if offsetId != "" && sortOrder != "likes" {
+		idx := slices.IndexFunc(m.screenshots, func(s *memoryScreenshot) bool { return s.id == offsetId })
+		if idx == -1 {
+			return nil, nil
+		}
+		offsetTimestamp = &m.screenshots[idx].publicTimestamp
+	}
+
+	var filtered []*memoryScreenshot
+	for _, screenshot := range m.screenshots {
+		if screenshot.temp || !screenshot.public || (game != "" && screenshot.game != game) || screenshot.publicTimestamp.Before(since) {
+			continue
+		}
+
+		if owner, ok := m.players[screenshot.uuid]; !ok || owner.banned {
+			continue
+		}
+
+		if offsetTimestamp != nil && screenshot.publicTimestamp.After(*offsetTimestamp) {
+			continue
+		}
+
+		filtered = append(filtered, screenshot)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, b := filtered[i], filtered[j]
+		if sortOrder == "likes" {
+			if aLikes, bLikes := m.getScreenshotLikeCount(a.id, since), m.getScreenshotLikeCount(b.id, since); aLikes != bLikes {
+				return aLikes > bLikes
+			}
+		}
+		if !a.publicTimestamp.Equal(b.publicTimestamp) {
+			return a.publicTimestamp.After(b.publicTimestamp)
+		}
+		if a.uuid != b.uuid {
+			return a.uuid < b.uuid
+		}
+		return a.id > b.id
+	})
+
+	var screenshots []*ScreenshotData
+	for _, screenshot := range filtered {
+		screenshotData, ok := m.getScreenshotData(uuid, screenshot)
+		if !ok {
+			continue
+		}
+
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		if len(screenshots) >= limit {
+			break
+		}
+
+		screenshots = append(screenshots, screenshotData)
+	}
+
+	return screenshots, nil
+}
+
+func (m *memoryStore) getScreenshotInfo(ctx context.Context, uuid string, ownerUuid string, id string) (*ScreenshotData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, screenshot := range m.screenshots {
+		if screenshot.uuid == ownerUuid && screenshot.id == id {
+			if screenshotData, ok := m.getScreenshotData(uuid, screenshot); ok {
+				return screenshotData, nil
+			}
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (m *memoryStore) getPlayerScreenshots(ctx context.Context, uuid string) ([]*PlayerScreenshotData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var playerScreenshots []*PlayerScreenshotData
+
+	for _, screenshot := range m.screenshots {
+		gameData := m.getGameData(uuid, screenshot.game)
+		if screenshot.uuid != uuid || screenshot.temp || gameData == nil {
+			continue
+		}
+
+		_, liked := m.screenshotLikes[screenshot.id][uuid]
+
+		playerScreenshots = append(playerScreenshots, &PlayerScreenshotData{
+			Id:         screenshot.id,
+			Uuid:       screenshot.uuid,
+			Game:       screenshot.game,
+			MapId:      screenshot.mapId,
+			MapX:       screenshot.mapX,
+			MapY:       screenshot.mapY,
+			SystemName: gameData.systemName,
+			Timestamp:  screenshot.timestamp,
+			Public:     screenshot.public,
+			Spoiler:    screenshot.spoiler,
+			LikeCount:  len(m.screenshotLikes[screenshot.id]),
+			Liked:      liked,
+		})
+	}
+
+	sort.SliceStable(playerScreenshots, func(i, j int) bool {
+		if !playerScreenshots[i].Timestamp.Equal(playerScreenshots[j].Timestamp) {
+			return playerScreenshots[i].Timestamp.After(playerScreenshots[j].Timestamp)
+		}
+		return playerScreenshots[i].Id < playerScreenshots[j].Id
+	})
+
+	return playerScreenshots, nil
+}
+
+func (m *memoryStore) getScreenshotGames(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var screenshotGames []string
+
+	for _, screenshot := range m.screenshots {
+		if !slices.Contains(screenshotGames, screenshot.game) {
+			screenshotGames = append(screenshotGames, screenshot.game)
+		}
+	}
+
+	return screenshotGames, nil
+}
+
+func (m *memoryStore) getPlayerScreenshotCount(ctx context.Context, uuid string, temp bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int
+	for _, screenshot := range m.screenshots {
+		if screenshot.uuid == uuid && screenshot.temp == temp {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *memoryStore) writeScreenshotData(ctx context.Context, id string, uuid string, game string, mapId string, mapX int, mapY int, temp bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if slices.ContainsFunc(m.screenshots, func(s *memoryScreenshot) bool { return s.id == id }) {
+		return errors.New("screenshot exists")
+	}
+
+	screenshot := &memoryScreenshot{
+		id:        id,
+		uuid:      uuid,
+		game:      game,
+		mapId:     mapId,
+		mapX:      mapX,
+		mapY:      mapY,
+		public:    temp,
+		temp:      temp,
+		timestamp: time.Now().UTC(),
+	}
+	if temp {
+		screenshot.publicTimestamp = screenshot.timestamp
+	}
+
+	m.screenshots = append(m.screenshots, screenshot)
+
+	return nil
+}
+
+func (m *memoryStore) updateScreenshot(id string, uuid string, update func(*memoryScreenshot)) bool {
+	if !m.canEditScreenshot(uuid) {
+		return false
+	}
+
+	for _, screenshot := range m.screenshots {
+		if screenshot.id == id {
+			update(screenshot)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *memoryStore) setPlayerScreenshotPublic(ctx context.Context, id string, uuid string, value bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateScreenshot(id, uuid, func(screenshot *memoryScreenshot) {
+		screenshot.public = value
+		if screenshot.publicTimestamp.IsZero() {
+			screenshot.publicTimestamp = time.Now().UTC()
+		}
+	}), nil
+}
+
+func (m *memoryStore) setPlayerScreenshotSpoiler(ctx context.Context, id string, uuid string, value bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateScreenshot(id, uuid, func(screenshot *memoryScreenshot) {
+		screenshot.spoiler = value
+	}), nil
+}
+
+func (m *memoryStore) writePlayerScreenshotLike(ctx context.Context, id string, uuid string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.screenshotLikes[id] == nil {
+		m.screenshotLikes[id] = make(map[string]time.Time)
+	}
+
+	if _, ok := m.screenshotLikes[id][uuid]; ok {
+		return false, nil
+	}
+
+	m.screenshotLikes[id][uuid] = time.Now().UTC()
+
+	return true, nil
+}
+
+func (m *memoryStore) deletePlayerScreenshotLike(ctx context.Context, id string, uuid string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.screenshotLikes[id][uuid]; !ok {
+		return false, nil
+	}
+
+	delete(m.screenshotLikes[id], uuid)
+
+	return true, nil
+}
+
+func (m *memoryStore) deleteScreenshot(ctx context.Context, id string, uuid string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.canEditScreenshot(uuid) {
+		return false, nil
+	}
+
+	count := len(m.screenshots)
+	m.screenshots = slices.DeleteFunc(m.screenshots, func(s *memoryScreenshot) bool { return s.id == id })
+	delete(m.screenshotLikes, id)
+
+	return len(m.screenshots) < count, nil
+}
+
+func (m *memoryStore) deleteTempScreenshots(ctx context.Context) (screenshots []*PlayerScreenshotData, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dayAgo := time.Now().UTC().AddDate(0, 0, -1)
+
+	m.screenshots = slices.DeleteFunc(m.screenshots, func(s *memoryScreenshot) bool {
+		if s.temp && s.timestamp.Before(dayAgo) {
+			screenshots = append(screenshots, &PlayerScreenshotData{Id: s.id, Uuid: s.uuid})
+			return true
+		}
+		return false
+	})
+
+	return screenshots, nil
+}
+
+// schedules
+
+func (m *memoryStore) listSchedules(ctx context.Context, uuid string, partyId int, mod bool) ([]*ScheduleDisplay, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var schedules []*ScheduleDisplay
+
+	for _, schedule := range m.schedules {
+		if schedule.PartyId != 0 && schedule.PartyId != partyId && !mod {
+			continue
+		}
+
+		owner, ok := m.players[schedule.OwnerUuid]
+		account, accountOk := m.accounts[schedule.OwnerUuid]
+		gameData := m.getGameData(schedule.OwnerUuid, getConfig().gameName)
+		if !ok || !accountOk || gameData == nil {
+			continue
+		}
+
+		s := *schedule
+		s.OwnerName = account.user
+		s.OwnerRank = owner.rank
+		s.OwnerBadge = account.badge
+		s.OwnerSystemName = gameData.systemName
+		s.FollowerCount = len(m.scheduleFollow[s.Id])
+		s.PlayerLiked = m.scheduleFollow[s.Id][uuid]
+
+		schedules = append(schedules, &s)
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Id < schedules[j].Id
+	})
+
+	return schedules, nil
+}
+
+func (m *memoryStore) createSchedule(ctx context.Context, s *ScheduleUpdate) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastScheduleId++
+	m.schedules[m.lastScheduleId] = &ScheduleDisplay{ScheduleUpdate: *s, Id: m.lastScheduleId}
+
+	return m.lastScheduleId, nil
+}
+
+func (m *memoryStore) updateSchedule(ctx context.Context, id int, mod bool, uuid string, s *ScheduleUpdate) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.schedules[id]
+	if !ok || (!mod && schedule.OwnerUuid != uuid) {
+		return false, nil
+	}
+
+	official := schedule.Official
+	if mod {
+		official = s.Official
+	}
+
+	ownerUuid := schedule.OwnerUuid
+	if s.OwnerUuid != "" {
+		ownerUuid = s.OwnerUuid
+	}
+
+	schedule.ScheduleUpdate = *s
+	schedule.Official = official
+	schedule.OwnerUuid = ownerUuid
+
+	return true, nil
+}
+
+func (m *memoryStore) getUpcomingSchedules(ctx context.Context, after time.Time) (map[int]time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedules := make(map[int]time.Time)
+
+	for id, schedule := range m.schedules {
+		if !schedule.Datetime.Before(after) && schedule.Game == getConfig().gameName {
+			schedules[id] = schedule.Datetime
+		}
+	}
+
+	return schedules, nil
+}
+
+func (m *memoryStore) followSchedule(ctx context.Context, uuid string, scheduleId int, follow bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if follow {
+		if _, ok := m.schedules[scheduleId]; !ok || m.scheduleFollow[scheduleId][uuid] {
+			return false, nil
+		}
+
+		if m.scheduleFollow[scheduleId] == nil {
+			m.scheduleFollow[scheduleId] = make(map[string]bool)
+		}
+
+		m.scheduleFollow[scheduleId][uuid] = true
+
+		return true, nil
+	}
+
+	if !m.scheduleFollow[scheduleId][uuid] {
+		return false, nil
+	}
+
+	delete(m.scheduleFollow[scheduleId], uuid)
+
+	return true, nil
+}
+
+func (m *memoryStore) getScheduleFollowCount(ctx context.Context, scheduleId int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.scheduleFollow[scheduleId]), nil
+}
+
+func (m *memoryStore) getScheduleFollowers(ctx context.Context, scheduleId int) (uuids []string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.schedules[scheduleId]; !ok {
+		return nil, nil
+	}
+
+	for uuid := range m.scheduleFollow[scheduleId] {
+		uuids = append(uuids, uuid)
+	}
+
+	return uuids, nil
+}
+
+func (m *memoryStore) getScheduleInfo(ctx context.Context, scheduleId int) (name string, gameId string, datetime time.Time, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.schedules[scheduleId]
+	if !ok {
+		return "", "", time.Time{}, sql.ErrNoRows
+	}
+
+	return schedule.Name, schedule.Game, schedule.Datetime, nil
+}
+
+func (m *memoryStore) cancelSchedule(ctx context.Context, uuid string, mod bool, scheduleId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if schedule, ok := m.schedules[scheduleId]; ok && (mod || schedule.OwnerUuid == uuid) {
+		delete(m.schedules, scheduleId)
+		delete(m.scheduleFollow, scheduleId)
+	}
+
+	return nil
+}
+
+func (m *memoryStore) deleteDoneSchedules(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	for id, schedule := range m.schedules {
+		if schedule.Datetime.Before(now) && !schedule.Recurring && schedule.Game == getConfig().gameName {
+			delete(m.schedules, id)
+			delete(m.scheduleFollow, id)
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) advanceRecurringSchedules(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	for _, schedule := range m.schedules {
+		if !schedule.Recurring || !schedule.Datetime.Before(now) || schedule.Game != getConfig().gameName {
+			continue
+		}
+
+		switch schedule.IntervalType {
+		case "days":
+			schedule.Datetime = schedule.Datetime.AddDate(0, 0, schedule.IntervalValue)
+		case "months":
+			schedule.Datetime = schedule.Datetime.AddDate(0, schedule.IntervalValue, 0)
+		case "years":
+			schedule.Datetime = schedule.Datetime.AddDate(schedule.IntervalValue, 0, 0)
+		}
+	}
+
+	return nil
+}
+
+// chat
+
+func (m *memoryStore) getChatMessage(msgId string) *memoryChatMessage {
+	for _, msg := range m.chatMessages {
+		if msg.MsgId == msgId {
+			return msg
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) writeChatMessage(msg ChatMessageWrite, partyId int) {
+	m.chatMessages = append(m.chatMessages, &memoryChatMessage{
+		ChatMessage: ChatMessage{
+			MsgId:         msg.msgId,
+			Uuid:          msg.uuid,
+			MapId:         msg.mapId,
+			PrevMapId:     msg.prevMapId,
+			PrevLocations: msg.prevLocations,
+			X:             msg.x,
+			Y:             msg.y,
+			Contents:      msg.contents,
+			Timestamp:     time.Now().UTC(),
+			Party:         partyId != 0,
+		},
+		game:    getConfig().gameName,
+		partyId: partyId,
+	})
+}
+
+func (m *memoryStore) writeChatMessages(ctx context.Context, messages []ChatMessageWrite) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range messages {
+		m.writeChatMessage(msg, 0)
+	}
+
+	return nil
+}
+
+func (m *memoryStore) writePartyChatMessage(ctx context.Context, msg ChatMessageWrite, partyId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.writeChatMessage(msg, partyId)
+
+	return nil
+}
+
+func (m *memoryStore) setPlayerLastChatMessage(ctx context.Context, uuid string, lastMsgId string, party bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	gameData := m.getGameData(uuid, getConfig().gameName)
+	if gameData == nil {
+		return nil
+	}
+
+	if party {
+		gameData.lastPartyMsgId = lastMsgId
+	} else {
+		gameData.lastGlobalMsgId = lastMsgId
+	}
+
+	return nil
+}
+
+// isAfterMessage is timestamp > (SELECT timestamp ... WHERE msgId = msgId),
+// which is never true for a message that doesn't exist
+func (m *memoryStore) isAfterMessage(timestamp time.Time, msgId string) bool {
+	msg := m.getChatMessage(msgId)
+	return msg != nil && timestamp.After(msg.Timestamp)
+}
+
+// getNewChatMessages returns up to limit of the newest global messages, or
+// party messages if partyId isn't 0, that their senders haven't cleared
+func (m *memoryStore) getNewChatMessages(partyId int, lastMsgId string, limit int) (messages []*ChatMessage) {
+	for i := len(m.chatMessages) - 1; i >= 0 && len(messages) < limit; i-- {
+		msg := m.chatMessages[i]
+		if msg.game != getConfig().gameName || msg.partyId != partyId {
+			continue
+		}
+
+		if player, ok := m.players[msg.Uuid]; !ok || player.banned {
+			continue
+		}
+
+		gameData := m.getGameData(msg.Uuid, msg.game)
+		if gameData == nil {
+			continue
+		}
+
+		if lastMsgId != "" && !m.isAfterMessage(msg.Timestamp, lastMsgId) {
+			continue
+		}
+
+		clearedMsgId := gameData.lastGlobalMsgId
+		if partyId != 0 {
+			clearedMsgId = gameData.lastPartyMsgId
+		}
+		if clearedMsgId != "" && !m.isAfterMessage(msg.Timestamp, clearedMsgId) {
+			continue
+		}
+
+		chatMessage := msg.ChatMessage
+		messages = append(messages, &chatMessage)
+	}
+
+	return messages
+}
+
+func (m *memoryStore) getChatMessageHistory(ctx context.Context, partyId int, globalMsgLimit int, partyMsgLimit int, lastMsgId string) (*ChatHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var chatHistory ChatHistory
+
+	chatHistory.Messages = m.getNewChatMessages(0, lastMsgId, globalMsgLimit)
+	if partyId != 0 {
+		chatHistory.Messages = append(chatHistory.Messages, m.getNewChatMessages(partyId, lastMsgId, partyMsgLimit)...)
+	}
+
+	slices.SortStableFunc(chatHistory.Messages, func(a, b *ChatMessage) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	if len(chatHistory.Messages) == 0 {
+		return &chatHistory, nil
+	}
+
+	firstTimestamp := chatHistory.Messages[0].Timestamp
+	lastTimestamp := chatHistory.Messages[len(chatHistory.Messages)-1].Timestamp
+
+	// everyone that sent a message in that time, not only those whose messages are listed
+	seen := make(map[string]bool)
+	for _, msg := range m.chatMessages {
+		if msg.game != getConfig().gameName || seen[msg.Uuid] {
+			continue
+		}
+		if msg.partyId != 0 && msg.partyId != partyId {
+			continue
+		}
+		if msg.Timestamp.Before(firstTimestamp) || msg.Timestamp.After(lastTimestamp) {
+			continue
+		}
+
+		gameData := m.getGameData(msg.Uuid, msg.game)
+		if _, ok := m.players[msg.Uuid]; !ok || gameData == nil {
+			continue
+		}
+
+		seen[msg.Uuid] = true
+
+		playerListData := m.getPlayerListData(msg.Uuid, gameData)
+		chatHistory.Players = append(chatHistory.Players, &ChatPlayer{
+			Uuid:       playerListData.Uuid,
+			Name:       playerListData.Name,
+			SystemName: playerListData.SystemName,
+			Rank:       playerListData.Rank,
+			Account:    playerListData.Account,
+			Badge:      playerListData.Badge,
+			Medals:     playerListData.Medals,
+		})
+	}
+
+	return &chatHistory, nil
+}
+
+func (m *memoryStore) getChatMessageContents(ctx context.Context, msgId string, uuid string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range m.chatMessages {
+		if msg.MsgId == msgId && msg.Uuid == uuid && msg.game == getConfig().gameName {
+			return msg.Contents, nil
+		}
+	}
+
+	return "", sql.ErrNoRows
+}
+
+func (m *memoryStore) deleteOldChatMessages(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dayAgo := time.Now().UTC().AddDate(0, 0, -1)
+	m.chatMessages = slices.DeleteFunc(m.chatMessages, func(msg *memoryChatMessage) bool {
+		return msg.Timestamp.Before(dayAgo)
+	})
+
+	return nil
+}
+
+// locations
+
+func (m *memoryStore) getGameLocation(ctx context.Context, title string) (GameLocation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, location := range m.locations {
+		if location.game == getConfig().gameName && location.title == title {
+			return GameLocation{
+				Id:     location.id,
+				Game:   location.game,
+				Name:   location.title,
+				MapIds: slices.Clone(location.mapIds),
+			}, nil
+		}
+	}
+
+	return GameLocation{}, sql.ErrNoRows
+}
+
+func (m *memoryStore) getGameLocations(ctx context.Context) (locations []*Location, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, location := range m.locations {
+		if location.game != getConfig().gameName {
+			continue
+		}
+
+		locations = append(locations, &Location{
+			Id:       location.id,
+			Title:    location.title,
+			Depth:    location.depth,
+			MinDepth: location.minDepth,
+			Secret:   location.secret,
+		})
+	}
+
+	return locations, nil
+}
+
+func (m *memoryStore) createGameLocation(ctx context.Context, title string, titleJP string, depth int, minDepth int, mapIds []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	location := &memoryLocation{
+		id:       len(m.locations) + 1,
+		game:     getConfig().gameName,
+		title:    title,
+		titleJP:  titleJP,
+		depth:    depth,
+		minDepth: minDepth,
+		mapIds:   mapIds,
+	}
+
+	m.locations = append(m.locations, location)
+
+	return location.id, nil
+}
+
+func (m *memoryStore) updateGameLocation(ctx context.Context, id int, title string, titleJP string, depth int, minDepth int, mapIds []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if location := m.getLocation(id); location != nil {
+		location.title = title
+		location.titleJP = titleJP
+		location.depth = depth
+		location.minDepth = minDepth
+		location.mapIds = mapIds
+	}
+
+	return nil
+}
+
+func (m *memoryStore) writePlayerGameLocations(ctx context.Context, locations []GameLocationWrite) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, location := range locations {
+		if m.playerLocations[location.uuid] == nil {
+			m.playerLocations[location.uuid] = make(map[int]time.Time)
+		}
+		if _, ok := m.playerLocations[location.uuid][location.locationId]; !ok {
+			m.playerLocations[location.uuid][location.locationId] = time.Now().UTC()
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getPlayerGameLocationIds(ctx context.Context, uuid string, gameId string) (locationIds []int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, location := range m.locations {
+		if _, ok := m.playerLocations[uuid][location.id]; ok && location.game == gameId {
+			locationIds = append(locationIds, location.id)
+		}
+	}
+
+	return locationIds, nil
+}
+
+func (m *memoryStore) getPlayerGameLocationCompletion(ctx context.Context, uuid string, gameId string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count, visitedCount int
+	for _, location := range m.locations {
+		if location.game != gameId || location.secret {
+			continue
+		}
+
+		count++
+		if _, ok := m.playerLocations[uuid][location.id]; ok {
+			visitedCount++
+		}
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	return visitedCount * 100 / count, nil
+}
+
+func (m *memoryStore) getPlayerMissingGameLocationNames(ctx context.Context, uuid string, locationNames []string) (missingLocationNames []string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, location := range m.locations {
+		if location.game != getConfig().gameName || !slices.Contains(locationNames, location.title) {
+			continue
+		}
+		if _, ok := m.playerLocations[uuid][location.id]; !ok {
+			missingLocationNames = append(missingLocationNames, location.title)
+		}
+	}
+
+	return missingLocationNames, nil
+}
+
+func (m *memoryStore) getPlayerAllMissingGameLocationNames(ctx context.Context, uuid string) (missingLocationNames []string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, location := range m.locations {
+		if location.game != getConfig().gameName || location.secret {
+			continue
+		}
+		if _, ok := m.playerLocations[uuid][location.id]; !ok {
+			missingLocationNames = append(missingLocationNames, location.title)
+		}
+	}
+
+	return missingLocationNames, nil
+}
+
+// records
+
+func (m *memoryStore) getPlayerTags(ctx context.Context, uuid string) (tags []string, lastUnlocked time.Time, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, unlocked := range m.tags[uuid] {
+		tags = append(tags, name)
+		if unlocked.After(lastUnlocked) {
+			lastUnlocked = unlocked
+		}
+	}
+
+	slices.Sort(tags)
+
+	return tags, lastUnlocked, nil
+}
+
+func (m *memoryStore) writePlayerTag(ctx context.Context, uuid string, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tags[uuid] == nil {
+		m.tags[uuid] = make(map[string]time.Time)
+	}
+	if _, ok := m.tags[uuid][name]; !ok {
+		m.tags[uuid][name] = time.Now()
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getPlayerTimeTrialRecords(ctx context.Context, uuid string) (timeTrialRecords []*TimeTrialRecord, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, seconds := range m.timeTrials {
+		if key.uuid == uuid {
+			timeTrialRecords = append(timeTrialRecords, &TimeTrialRecord{MapId: key.mapId, Seconds: seconds})
+		}
+	}
+
+	slices.SortFunc(timeTrialRecords, func(a, b *TimeTrialRecord) int {
+		return a.MapId - b.MapId
+	})
+
+	return timeTrialRecords, nil
+}
+
+func (m *memoryStore) writePlayerTimeTrial(ctx context.Context, uuid string, mapId int, seconds int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryTimeTrialKey{uuid, mapId}
+	if prevSeconds, ok := m.timeTrials[key]; ok && seconds >= prevSeconds {
+		return false, nil
+	}
+
+	m.timeTrials[key] = seconds
+
+	return true, nil
+}
+
+func (m *memoryStore) getPlayerMinigameScore(ctx context.Context, uuid string, minigameId string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	score, ok := m.minigameScores[memoryMinigameKey{uuid, minigameId}]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	return score, nil
+}
+
+func (m *memoryStore) writePlayerMinigameScore(ctx context.Context, uuid string, minigameId string, score int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryMinigameKey{uuid, minigameId}
+	if prevScore, ok := m.minigameScores[key]; ok && score <= prevScore {
+		return false, nil
+	}
+
+	m.minigameScores[key] = score
+
+	return true, nil
+}
+
+// moderation
+
+func (m *memoryStore) writeModAction(ctx context.Context, uuid string, action int, reason string, expiry time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.modActions = append(m.modActions, memoryModAction{ModAction{uuid, action}, reason, expiry})
+
+	return nil
+}
+
+func (m *memoryStore) getModActionExpiries(ctx context.Context) (map[ModAction]time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	expiries := make(map[ModAction]time.Time)
+	for _, modAction := range m.modActions {
+		if modAction.expiry.After(now) && modAction.expiry.After(expiries[modAction.ModAction]) {
+			expiries[modAction.ModAction] = modAction.expiry
+		}
+	}
+
+	return expiries, nil
+}
+
+func (m *memoryStore) deleteModAction(ctx context.Context, uuid string, action int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.modActions = slices.DeleteFunc(m.modActions, func(modAction memoryModAction) bool {
+		return modAction.ModAction == ModAction{uuid, action}
+	})
+
+	return nil
+}
+
+func (m *memoryStore) writeReport(ctx context.Context, uuid string, targetUuid string, msgId string, reason string, originalMsg string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reports[memoryReportKey{uuid, targetUuid, msgId}] = &memoryReport{
+		game:        getConfig().gameName,
+		reason:      reason,
+		originalMsg: originalMsg,
+		timestamp:   time.Now(),
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getReportReasonCounts(ctx context.Context, targetUuid string) (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reasons := make(map[string]int)
+	for key, report := range m.reports {
+		if key.targetUuid == targetUuid && !report.actionTaken {
+			reasons[report.reason]++
+		}
+	}
+
+	return reasons, nil
+}
+
+func (m *memoryStore) getReporters(ctx context.Context, targetUuid string, msgId string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reporters := make(map[string]string)
+
+	// reports without a message have a NULL msgId, which matches nothing
+	if msgId == "" {
+		return reporters, nil
+	}
+
+	// reporters are named once per game they played, like the join
+	for gameKey, gameData := range m.gameData {
+		report, ok := m.reports[memoryReportKey{gameKey.uuid, targetUuid, msgId}]
+		if ok && !report.actionTaken {
+			reporters[gameData.name] = report.reason
+		}
+	}
+
+	return reporters, nil
+}
+
+func (m *memoryStore) resolveReports(ctx context.Context, targetUuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, report := range m.reports {
+		if key.targetUuid == targetUuid {
+			report.actionTaken = true
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) getPlayerModInfo(ctx context.Context, player string) (name string, uuid string, banned bool, muted bool, onlineGames []string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for gameKey, gameData := range m.gameData {
+		if gameData.name != player && gameKey.uuid != player {
+			continue
+		}
+
+		playerData, ok := m.players[gameKey.uuid]
+		if !ok {
+			continue
+		}
+
+		name, uuid, banned, muted = gameData.name, gameKey.uuid, playerData.banned, playerData.muted
+		if gameData.online {
+			onlineGames = append(onlineGames, gameKey.game)
+		}
+	}
+
+	slices.Sort(onlineGames)
+
+	return
+}
+
+// notifications
+
+func (m *memoryStore) addPushSubscription(ctx context.Context, uuid string, sub *webpush.Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pushSubscriptions[uuid] == nil {
+		m.pushSubscriptions[uuid] = make(map[string]*webpush.Subscription)
+	}
+	if _, ok := m.pushSubscriptions[uuid][sub.Endpoint]; !ok {
+		subCopy := *sub
+		m.pushSubscriptions[uuid][sub.Endpoint] = &subCopy
+	}
+
+	return nil
+}
+
+func (m *memoryStore) removePushSubscription(ctx context.Context, uuid string, endpoint string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.pushSubscriptions[uuid], endpoint)
+
+	return nil
+}
+
+func (m *memoryStore) getPushSubscriptions(ctx context.Context, uuids []string) (subs []*webpush.Subscription, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for uuid, playerSubs := range m.pushSubscriptions {
+		if len(uuids) != 0 && !slices.Contains(uuids, uuid) {
+			continue
+		}
+
+		for _, sub := range playerSubs {
+			subCopy := *sub
+			subs = append(subs, &subCopy)
+		}
+	}
+
+	return subs, nil
+}
+
+// api cache
+
+func (m *memoryStore) getApiQuery(key memoryApiQueryKey) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	apiQuery, ok := m.apiQueries[key]
+	if !ok || !time.Now().Before(apiQuery.expiry) {
+		return "", sql.ErrNoRows
+	}
+
+	return apiQuery.response, nil
+}
+
+func (m *memoryStore) get2kkiApiQuery(ctx context.Context, action string, query string) (string, error) {
+	return m.getApiQuery(memoryApiQueryKey{"2kki", "", action, query})
+}
+
+func (m *memoryStore) write2kkiApiQuery(ctx context.Context, action string, query string, response string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.apiQueries[memoryApiQueryKey{"2kki", "", action, query}] = memoryApiQuery{response, time.Now().Add(time.Hour)}
+
+	return nil
+}
+
+func (m *memoryStore) getWikiApiQuery(ctx context.Context, action string, query string) (string, error) {
+	return m.getApiQuery(memoryApiQueryKey{"wiki", getConfig().gameName, action, query})
+}
+
+func (m *memoryStore) writeWikiApiQuery(ctx context.Context, action string, query string, response string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// refreshed responses are kept longer than new ones, like the MySQL upsert
+	key := memoryApiQueryKey{"wiki", getConfig().gameName, action, query}
+	expiry := time.Now().Add(time.Hour)
+	if _, ok := m.apiQueries[key]; ok {
+		expiry = time.Now().Add(12 * time.Hour)
+	}
+
+	m.apiQueries[key] = memoryApiQuery{response, expiry}
+
+	return nil
+}
+
+func (m *memoryStore) cleanupApiQueries(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for key, apiQuery := range m.apiQueries {
+		if key.api == "2kki" && apiQuery.expiry.Before(now) {
+			delete(m.apiQueries, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,2071 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	webpush "github.com/Appboy/webpush-go"
+)
+
+// mysqlStore is the production storage, every repository backed by db.
+// Queries run under the caller's context, bounded by the default deadline.
+type mysqlStore struct{}
+
+// players
+
+func (s *mysqlStore) getPlayerDataFromIp(ctx context.Context, ip string) (uuid string, banned bool, muted bool, err error) {
+	err = db.QueryRowPrepared(ctx, "SELECT uuid, banned, muted FROM players WHERE ip = ?", ip).Scan(&uuid, &banned, &muted)
+	return
+}
+
+func (s *mysqlStore) createPlayerData(ctx context.Context, ip string, uuid string, banned bool) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO players (ip, uuid, banned) VALUES (?, ?, ?)", ip, uuid, banned)
+	return err
+}
+
+func (s *mysqlStore) getPlayerDataFromToken(ctx context.Context, token string) (uuid string, name string, rank int, badge string, banned bool, muted bool, err error) {
+	err = db.QueryRowPrepared(ctx, "SELECT a.uuid, a.user, pd.rank, a.badge, pd.banned, pd.muted FROM accounts a JOIN playerSessions ps ON ps.uuid = a.uuid JOIN players pd ON pd.uuid = a.uuid WHERE ps.sessionId = ? AND NOW() < ps.expiration", token).Scan(&uuid, &name, &rank, &badge, &banned, &muted)
+	return
+}
+
+func (s *mysqlStore) getPlayerInfoFromToken(ctx context.Context, token string) (uuid string, name string, rank int, badge string, badgeSlotRows int, badgeSlotCols int, screenshotLimit int, err error) {
+	err = db.QueryRowPrepared(ctx, "SELECT a.uuid, a.user, pd.rank, a.badge, a.badgeSlotRows, a.badgeSlotCols, a.screenshotLimit FROM accounts a JOIN playerSessions ps ON ps.uuid = a.uuid JOIN players pd ON pd.uuid = a.uuid WHERE ps.sessionId = ? AND NOW() < ps.expiration", token).Scan(&uuid, &name, &rank, &badge, &badgeSlotRows, &badgeSlotCols, &screenshotLimit)
+	return
+}
+
+func (s *mysqlStore) getUuidFromToken(ctx context.Context, token string) (uuid string, err error) {
+	err = db.QueryRowPrepared(ctx, "SELECT uuid FROM playerSessions WHERE sessionId = ? AND NOW() < expiration", token).Scan(&uuid)
+	return
+}
+
+func (s *mysqlStore) getPlayerInfo(ctx context.Context, ip string) (uuid string, name string, rank int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT pd.uuid, pgd.name, pd.rank FROM players pd LEFT JOIN playerGameData pgd ON pgd.uuid = pd.uuid WHERE pd.ip = ? AND (pgd.uuid IS NULL OR pgd.game = ?)", ip, getConfig().gameName).Scan(&uuid, &name, &rank)
+	return
+}
+
+func (s *mysqlStore) getPlayerRank(ctx context.Context, uuid string) (rank int, err error) {
+	err = db.QueryRowPrepared(ctx, "SELECT rank FROM players WHERE uuid = ?", uuid).Scan(&rank)
+	return
+}
+
+func (s *mysqlStore) getPlayerModerationStatus(ctx context.Context, uuid string) (banned bool, muted bool, err error) {
+	err = db.QueryRowContext(ctx, "SELECT banned, muted FROM players WHERE uuid = ?", uuid).Scan(&banned, &muted)
+	return
+}
+
+func (s *mysqlStore) setPlayerBanned(ctx context.Context, uuid string, banned bool) error {
+	_, err := db.ExecContext(ctx, "UPDATE players SET banned = ? WHERE uuid = ?", banned, uuid)
+	return err
+}
+
+func (s *mysqlStore) setPlayerMuted(ctx context.Context, uuid string, muted bool) error {
+	_, err := db.ExecContext(ctx, "UPDATE players SET muted = ? WHERE uuid = ?", muted, uuid)
+	return err
+}
+
+func (s *mysqlStore) getBannedMutedPlayers(ctx context.Context, banned bool) (players []PlayerInfo, err error) {
+	var actionStr string
+
+	if banned {
+		actionStr = "banned"
+	} else {
+		actionStr = "muted"
+	}
+
+	results, err := db.QueryContext(ctx, "SELECT uuid, rank FROM players WHERE "+actionStr+" = 1")
+	if err != nil {
+		return players, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var player PlayerInfo
+
+		err := results.Scan(&player.Uuid, &player.Rank)
+		if err != nil {
+			return players, err
+		}
+
+		players = append(players, player)
+	}
+
+	return players, nil
+}
+
+func (s *mysqlStore) isIpBanned(ctx context.Context, ip string) (bool, error) {
+	var banned int
+
+	// check if account is banned
+	err := db.QueryRowContext(ctx, "SELECT banned FROM players JOIN accounts ON players.uuid = accounts.uuid WHERE accounts.ip = ?", ip).Scan(&banned)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+
+	if banned == 1 {
+		return true, nil
+	}
+
+	// check if guest account is banned
+	err = db.QueryRowContext(ctx, "SELECT banned FROM players WHERE ip = ?", ip).Scan(&banned)
+	if err != nil {
+		return false, err
+	}
+
+	return banned == 1, nil
+}
+
+func (s *mysqlStore) getUuidFromName(ctx context.Context, name string) (uuid string, err error) {
+	err = db.QueryRowContext(ctx, "SELECT uuid FROM accounts WHERE user = ?", name).Scan(&uuid)
+	return
+}
+
+func (s *mysqlStore) getAccountName(ctx context.Context, uuid string) (name string, err error) {
+	err = db.QueryRowContext(ctx, "SELECT user FROM accounts WHERE uuid = ?", uuid).Scan(&name)
+	return
+}
+
+func (s *mysqlStore) getPlayerGameName(ctx context.Context, uuid string) (name string, err error) {
+	err = db.QueryRowContext(ctx, "SELECT name FROM playerGameData WHERE uuid = ?", uuid).Scan(&name)
+	return
+}
+
+func (s *mysqlStore) setAccountName(ctx context.Context, uuid string, name string) error {
+	_, err := db.ExecContext(ctx, "UPDATE accounts SET user = ? WHERE uuid = ?", name, uuid)
+	return err
+}
+
+func (s *mysqlStore) getPlayerMedals(ctx context.Context, uuid string) (medals [5]int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM players pd LEFT JOIN playerGameData pgd ON pgd.uuid = pd.uuid WHERE pd.uuid = ? AND pgd.game = ?", uuid, getConfig().gameName).Scan(&medals[0], &medals[1], &medals[2], &medals[3], &medals[4])
+	return
+}
+
+func (s *mysqlStore) getPlayerGameData(ctx context.Context, uuid string) (spriteName string, spriteIndex int, systemName string, err error) {
+	err = db.QueryRowContext(ctx, "SELECT pgd.spriteName, pgd.spriteIndex, pgd.systemName FROM players pd LEFT JOIN playerGameData pgd ON pgd.uuid = pd.uuid WHERE pd.uuid = ? AND pgd.game = ?", uuid, getConfig().gameName).Scan(&spriteName, &spriteIndex, &systemName)
+	return
+}
+
+func (s *mysqlStore) addOrUpdatePlayerGameData(ctx context.Context, uuid string) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO playerGameData (uuid, game, online) VALUES (?, ?, 1) ON DUPLICATE KEY UPDATE online = 1, timestampLastActive = UTC_TIMESTAMP()", uuid, getConfig().gameName)
+	return err
+}
+
+// getPlayerGameActivitiesQuery returns the update for a batch of that many activities.
+// It only updates rows addOrUpdatePlayerGameData created, every player must appear
+// once since which of several joined rows an UPDATE uses is undefined.
+func getPlayerGameActivitiesQuery(rows int) string {
+	// the first select names the derived table's columns
+	return "UPDATE playerGameData pgd JOIN (" +
+		"SELECT ? AS uuid, ? AS name, ? AS systemName, ? AS spriteName, ? AS spriteIndex, ? AS online" +
+		strings.Repeat(" UNION ALL SELECT ?, ?, ?, ?, ?, ?", rows-1) +
+		") a ON a.uuid = pgd.uuid " +
+		"SET pgd.name = a.name, pgd.systemName = a.systemName, pgd.spriteName = a.spriteName, pgd.spriteIndex = a.spriteIndex, pgd.online = a.online, pgd.timestampLastActive = UTC_TIMESTAMP() " +
+		"WHERE pgd.game = ?"
+}
+
+func (s *mysqlStore) updatePlayerGameActivities(ctx context.Context, activities []PlayerGameActivity) error {
+	query := getPlayerGameActivitiesQuery(len(activities))
+
+	args := make([]any, 0, len(activities)*6+1)
+	for _, activity := range activities {
+		args = append(args, activity.Uuid, activity.Name, activity.SystemName, activity.SpriteName, activity.SpriteIndex, activity.Online)
+	}
+	args = append(args, getConfig().gameName)
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *mysqlStore) setActivePlayersOffline(ctx context.Context, game string) error {
+	_, err := db.ExecContext(ctx, "UPDATE playerGameData SET online = 0 WHERE game = ? AND online = 1", game)
+	return err
+}
+
+func (s *mysqlStore) updatePlayerActivity(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, "UPDATE accounts SET inactive = CASE WHEN timestampLoggedIn IS NULL OR timestampLoggedIn < DATE_SUB(NOW(), INTERVAL 3 MONTH) THEN 1 ELSE 0 END")
+	return err
+}
+
+func (s *mysqlStore) blockPlayer(ctx context.Context, uuid string, targetUuid string) error {
+	_, err := db.ExecContext(ctx, "INSERT IGNORE INTO playerBlocks (uuid, targetUuid, timestamp) VALUES (?, ?, UTC_TIMESTAMP())", uuid, targetUuid)
+	return err
+}
+
+func (s *mysqlStore) unblockPlayer(ctx context.Context, uuid string, targetUuid string) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM playerBlocks WHERE uuid = ? AND targetUuid = ?", uuid, targetUuid)
+	return err
+}
+
+func (s *mysqlStore) isPlayerBlocked(ctx context.Context, uuid string, targetUuid string) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM playerBlocks WHERE uuid = ? AND targetUuid = ?", uuid, targetUuid).Scan(&count)
+	return count > 0, err
+}
+
+func (s *mysqlStore) getBlockedPlayerData(ctx context.Context, uuid string) ([]*PlayerListData, error) {
+	var blockedPlayers []*PlayerListData
+
+	results, err := db.QueryContext(ctx, "SELECT pd.uuid, COALESCE(a.user, pgd.name), pd.rank, CASE WHEN a.user IS NULL THEN 0 ELSE 1 END, COALESCE(a.badge, ''), pgd.systemName, pgd.spriteName, pgd.spriteIndex, pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM players pd JOIN playerBlocks pb ON pb.targetUuid = pd.uuid AND pb.uuid = ? JOIN playerGameData pgd ON pgd.uuid = pd.uuid LEFT JOIN accounts a ON a.uuid = pd.uuid WHERE pgd.game = ? ORDER BY pb.timestamp", uuid, getConfig().gameName)
+	if err != nil {
+		return blockedPlayers, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var blockedPlayer PlayerListData
+
+		err := results.Scan(&blockedPlayer.Uuid, &blockedPlayer.Name, &blockedPlayer.Rank, &blockedPlayer.Account, &blockedPlayer.Badge, &blockedPlayer.SystemName, &blockedPlayer.SpriteName, &blockedPlayer.SpriteIndex, &blockedPlayer.Medals[0], &blockedPlayer.Medals[1], &blockedPlayer.Medals[2], &blockedPlayer.Medals[3], &blockedPlayer.Medals[4])
+		if err != nil {
+			return blockedPlayers, err
+		}
+
+		blockedPlayers = append(blockedPlayers, &blockedPlayer)
+	}
+
+	return blockedPlayers, nil
+}
+
+func (s *mysqlStore) addPlayerFriend(ctx context.Context, uuid string, targetUuid string) error {
+	var accepted bool
+
+	results, err := db.ExecContext(ctx, "UPDATE playerFriends SET accepted = 1 WHERE uuid = ? AND targetUuid = ?", targetUuid, uuid)
+	if err == nil {
+		updatedRows, err := results.RowsAffected()
+		if err != nil {
+			return err
+		}
+		accepted = updatedRows > 0
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT IGNORE INTO playerFriends (uuid, targetUuid, accepted) VALUES (?, ?, ?)", uuid, targetUuid, accepted)
+	return err
+}
+
+func (s *mysqlStore) removePlayerFriend(ctx context.Context, uuid string, targetUuid string) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM playerFriends WHERE (uuid = ? AND targetUuid = ?) OR (uuid = ? AND targetUuid = ?)", uuid, targetUuid, targetUuid, uuid)
+	return err
+}
+
+func (s *mysqlStore) getPlayerFriendData(ctx context.Context, uuid string) (playerFriends []*PlayerFriend, err error) {
+	results, err := db.QueryContext(ctx, "SELECT pf.targetUuid, pf.accepted, 0, a.user, pd.rank, COALESCE(a.badge, ''), pgd.game, pgd.online, pgd.timestampLastActive, pgd.systemName, pgd.spriteName, pgd.spriteIndex, pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM playerFriends pf JOIN playerGameData pgd ON pgd.uuid = pf.targetUuid JOIN players pd ON pd.uuid = pgd.uuid JOIN accounts a ON a.uuid = pd.uuid WHERE pf.uuid       = ? AND pgd.game = (SELECT rpgd.game FROM playerGameData rpgd WHERE rpgd.uuid = pf.targetUuid AND rpgd.spriteName <> '' ORDER BY online DESC, timestampLastActive DESC, CASE WHEN game = ? THEN 1 ELSE 0 END DESC LIMIT 1) UNION "+
+		"                       SELECT pf.uuid,       pf.accepted, 1, a.user, pd.rank, COALESCE(a.badge, ''), pgd.game, pgd.online, pgd.timestampLastActive, pgd.systemName, pgd.spriteName, pgd.spriteIndex, pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM playerFriends pf JOIN playerGameData pgd ON pgd.uuid = pf.uuid       JOIN players pd ON pd.uuid = pgd.uuid JOIN accounts a ON a.uuid = pd.uuid WHERE pf.targetUuid = ? AND pgd.game = (SELECT rpgd.game FROM playerGameData rpgd WHERE rpgd.uuid = pf.uuid       AND rpgd.spriteName <> '' ORDER BY online DESC, timestampLastActive DESC, CASE WHEN game = ? THEN 1 ELSE 0 END DESC LIMIT 1) AND NOT EXISTS (SELECT * FROM playerFriends opf WHERE opf.uuid = pf.targetUuid AND opf.targetUuid = pf.uuid) ORDER BY user", uuid, getConfig().gameName, uuid, getConfig().gameName)
+	if err != nil {
+		return playerFriends, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		playerListData := PlayerListData{
+			Account: true,
+		}
+		playerFriendData := PlayerListFullData{
+			PlayerListData: playerListData,
+			MapId:          "0000",
+			PrevMapId:      "0000",
+		}
+		playerFriend := &PlayerFriend{
+			PlayerListFullData: playerFriendData,
+		}
+
+		err := results.Scan(&playerFriend.Uuid, &playerFriend.Accepted, &playerFriend.Incoming, &playerFriend.Name, &playerFriend.Rank, &playerFriend.Badge, &playerFriend.Game, &playerFriend.Online, &playerFriend.LastActive, &playerFriend.SystemName, &playerFriend.SpriteName, &playerFriend.SpriteIndex, &playerFriend.Medals[0], &playerFriend.Medals[1], &playerFriend.Medals[2], &playerFriend.Medals[3], &playerFriend.Medals[4])
+		if err != nil {
+			return playerFriends, err
+		}
+
+		playerFriends = append(playerFriends, playerFriend)
+	}
+
+	return playerFriends, nil
+}
+
+func (s *mysqlStore) accountExists(ctx context.Context, user string) (bool, error) {
+	var userExists int
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT * FROM accounts WHERE user = ?)", user).Scan(&userExists)
+	return userExists > 0, err
+}
+
+func (s *mysqlStore) accountExistsForUuid(ctx context.Context, uuid string) (bool, error) {
+	var userExists int
+	err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT * FROM accounts WHERE uuid = ?)", uuid).Scan(&userExists)
+	return userExists > 0, err
+}
+
+func (s *mysqlStore) createAccount(ctx context.Context, ip string, uuid string, user string, passHash []byte) error {
+	_, err := db.ExecContext(ctx, "UPDATE players SET ip = NULL WHERE ip = ?", ip) // set ip to null to disable ip-based login
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO accounts (ip, timestampRegistered, uuid, user, pass) VALUES (?, NOW(), ?, ?, ?)", ip, uuid, user, passHash)
+	return err
+}
+
+func (s *mysqlStore) getAccountPassHash(ctx context.Context, user string) (passHash string, err error) {
+	err = db.QueryRowContext(ctx, "SELECT pass FROM accounts WHERE user = ?", user).Scan(&passHash)
+	return
+}
+
+func (s *mysqlStore) setAccountPassHash(ctx context.Context, user string, passHash []byte) error {
+	_, err := db.ExecContext(ctx, "UPDATE accounts SET pass = ? WHERE user = ?", passHash, user)
+	return err
+}
+
+func (s *mysqlStore) setAccountPassHashForUuid(ctx context.Context, uuid string, passHash []byte) error {
+	_, err := db.ExecContext(ctx, "UPDATE accounts SET pass = ? WHERE uuid = ?", passHash, uuid)
+	return err
+}
+
+func (s *mysqlStore) createPlayerSession(ctx context.Context, token string, user string) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO playerSessions (sessionId, uuid, expiration) (SELECT ?, uuid, DATE_ADD(NOW(), INTERVAL 30 DAY) FROM accounts WHERE user = ?)", token, user)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "UPDATE accounts SET timestampLoggedIn = NOW() WHERE user = ?", user)
+	return err
+}
+
+func (s *mysqlStore) deletePlayerSession(ctx context.Context, token string) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM playerSessions WHERE sessionId = ?", token)
+	return err
+}
+
+func (s *mysqlStore) cleanupPlayers(ctx context.Context) error {
+	// Remove player sessions that have expired
+	_, err := db.ExecContext(ctx, "DELETE FROM playerSessions WHERE expiration < NOW()")
+	if err != nil {
+		return err
+	}
+
+	// Remove player records with no game activity
+	_, err = db.ExecContext(ctx, "DELETE IGNORE FROM players WHERE ip IS NOT NULL")
+	return err
+}
+
+// parties
+
+func (s *mysqlStore) getPlayerPartyId(ctx context.Context, uuid string) (partyId int, err error) {
+	err = db.QueryRowPrepared(ctx, "SELECT pm.partyId FROM partyMembers pm JOIN parties p ON p.id = pm.partyId WHERE pm.uuid = ? AND p.game = ?", uuid, getConfig().gameName).Scan(&partyId)
+	return
+}
+
+func (s *mysqlStore) getPlayerParty(ctx context.Context, uuid string) (party Party, err error) {
+	err = db.QueryRowContext(ctx, "SELECT p.id, p.owner, p.name, p.public, p.pass, p.theme, p.description FROM parties p JOIN partyMembers pm ON pm.partyId = p.id JOIN playerGameData pgd ON pgd.uuid = pm.uuid AND pgd.game = p.game WHERE p.game = ? AND pm.uuid = ?", getConfig().gameName, uuid).Scan(&party.Id, &party.OwnerUuid, &party.Name, &party.Public, &party.Pass, &party.SystemName, &party.Description)
+	return
+}
+
+func (s *mysqlStore) getPartyMembers(ctx context.Context, partyId int) (partyMembers []*PlayerListFullData, err error) {
+	results, err := db.QueryContext(ctx, "SELECT pm.partyId, pm.uuid, COALESCE(a.user, pgd.name), pd.rank, CASE WHEN a.user IS NULL THEN 0 ELSE 1 END, COALESCE(a.badge, ''), pgd.timestampLastActive, pgd.systemName, pgd.spriteName, pgd.spriteIndex, pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM partyMembers pm JOIN playerGameData pgd ON pgd.uuid = pm.uuid JOIN players pd ON pd.uuid = pgd.uuid JOIN parties p ON p.id = pm.partyId LEFT JOIN accounts a ON a.uuid = pd.uuid WHERE pm.partyId = ? AND pgd.game = ? ORDER BY CASE WHEN p.owner = pm.uuid THEN 0 ELSE 1 END, pd.rank DESC, pm.id", partyId, getConfig().gameName)
+	if err != nil {
+		return partyMembers, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var partyId int
+		var accountBin int
+
+		partyMember := &PlayerListFullData{
+			MapId:     "0000",
+			PrevMapId: "0000",
+		}
+
+		err := results.Scan(&partyId, &partyMember.Uuid, &partyMember.Name, &partyMember.Rank, &accountBin, &partyMember.Badge, &partyMember.LastActive, &partyMember.SystemName, &partyMember.SpriteName, &partyMember.SpriteIndex, &partyMember.Medals[0], &partyMember.Medals[1], &partyMember.Medals[2], &partyMember.Medals[3], &partyMember.Medals[4])
+		if err != nil {
+			return partyMembers, err
+		}
+
+		partyMember.Account = accountBin == 1
+
+		partyMembers = append(partyMembers, partyMember)
+	}
+
+	return partyMembers, nil
+}
+
+func (s *mysqlStore) createParty(ctx context.Context, name string, public bool, pass string, theme string, description string, ownerUuid string) (partyId int, err error) {
+	results, err := db.ExecContext(ctx, "INSERT INTO parties (game, owner, name, public, pass, theme, description) VALUES (?, ?, ?, ?, ?, ?, ?)", getConfig().gameName, ownerUuid, name, public, pass, theme, description)
+	if err != nil {
+		return 0, err
+	}
+
+	partyId64, err := results.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(partyId64), nil
+}
+
+func (s *mysqlStore) updateParty(ctx context.Context, partyId int, name string, public bool, pass string, theme string, description string, ownerUuid string) error {
+	_, err := db.ExecContext(ctx, "UPDATE parties SET game = ?, owner = ?, name = ?, public = ?, pass = ?, theme = ?, description = ? WHERE id = ?", getConfig().gameName, ownerUuid, name, public, pass, theme, description, partyId)
+	return err
+}
+
+func (s *mysqlStore) addPartyMember(ctx context.Context, partyId int, uuid string) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO partyMembers (partyId, uuid) VALUES (?, ?)", partyId, uuid)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "UPDATE playerGameData pgd SET pgd.lastPartyMsgId = (SELECT cm.msgId FROM chatMessages cm WHERE cm.game = pgd.game AND cm.partyId = ? AND cm.timestamp = (SELECT MAX(timestamp) FROM chatMessages WHERE game = cm.game AND partyId = cm.partyId) LIMIT 1) WHERE pgd.uuid = ? AND pgd.game = ?", partyId, uuid, getConfig().gameName)
+	return err
+}
+
+func (s *mysqlStore) removePartyMember(ctx context.Context, uuid string) error {
+	_, err := db.ExecContext(ctx, "DELETE pm FROM partyMembers pm JOIN parties p ON p.id = pm.partyId WHERE pm.uuid = ? AND p.game = ?", uuid, getConfig().gameName)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "UPDATE playerGameData SET lastPartyMsgId = NULL WHERE uuid = ? AND game = ?", uuid, getConfig().gameName)
+	return err
+}
+
+func (s *mysqlStore) setPartyOwner(ctx context.Context, partyId int, uuid string) error {
+	_, err := db.ExecContext(ctx, "UPDATE parties SET owner = ? WHERE id = ?", uuid, partyId)
+	return err
+}
+
+func (s *mysqlStore) setPartyOwnerByRank(ctx context.Context, partyId int) error {
+	_, err := db.ExecContext(ctx, "UPDATE parties p SET p.owner = (SELECT pm.uuid FROM partyMembers pm JOIN players pd ON pd.uuid = pm.uuid WHERE pm.partyId = p.id ORDER BY pd.rank DESC, pm.id LIMIT 1) WHERE p.id = ?", partyId)
+	return err
+}
+
+func (s *mysqlStore) deleteParty(ctx context.Context, partyId int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM parties WHERE id = ?", partyId)
+	return err
+}
+
+func (s *mysqlStore) deletePartyAndMembers(ctx context.Context, partyId int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM partyMembers WHERE partyId = ?", partyId)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM parties WHERE id = ?", partyId)
+	return err
+}
+
+// badges
+
+func (s *mysqlStore) getPlayerBadgeSlotCounts(ctx context.Context, playerName string) (badgeSlotRows int, badgeSlotCols int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT badgeSlotRows, badgeSlotCols FROM accounts WHERE user = ?", playerName).Scan(&badgeSlotRows, &badgeSlotCols)
+	return
+}
+
+func (s *mysqlStore) updatePlayerBadgeSlotCounts(ctx context.Context, uuid string) (err error) {
+	query := "UPDATE accounts JOIN (SELECT pb.uuid, SUM(b.bp) bp, COUNT(b.badgeId) bc FROM playerBadges pb JOIN badges b ON b.badgeId = pb.badgeId AND b.hidden = 0 GROUP BY pb.uuid) AS pb ON pb.uuid = accounts.uuid " +
+		"SET badgeSlotRows = CASE WHEN bp < 300 THEN 1 WHEN bp < 1000 THEN 2 WHEN bp < 2000 THEN 3 WHEN bp < 4000 THEN 4 WHEN bp < 7500 THEN 5 WHEN bp < 12500 THEN 6 WHEN bp < 20000 THEN 7 WHEN bp < 30000 THEN 8 WHEN bp < 50000 THEN 9 ELSE 10 END, " +
+		"badgeSlotCols = CASE WHEN bc < 50 THEN 3 WHEN bc < 150 THEN 4 WHEN bc < 300 THEN 5 WHEN bc < 500 THEN 6 ELSE 7 END, " +
+		"screenshotLimit = GREATEST(CASE WHEN bp < 100 THEN 10 WHEN bp < 250 THEN 15 WHEN bp < 500 THEN 20 WHEN bp < 1000 THEN 25 WHEN bp < 2500 THEN 30 WHEN bp < 5000 THEN 35 WHEN bp < 7500 THEN 40 WHEN bp < 10000 THEN 45 WHEN bp < 12500 THEN 50 WHEN bp < 15000 THEN 55 WHEN bp < 17500 THEN 60 WHEN bp < 20000 THEN 65 WHEN bp < 25000 THEN 70 ELSE 75 END, screenshotLimit)"
+	if uuid == "" {
+		_, err = db.ExecContext(ctx, query)
+	} else {
+		query += " WHERE accounts.uuid = ?"
+		_, err = db.ExecContext(ctx, query, uuid)
+	}
+
+	return err
+}
+
+func (s *mysqlStore) setPlayerBadge(ctx context.Context, uuid string, badge string) error {
+	_, err := db.ExecContext(ctx, "UPDATE accounts SET badge = ? WHERE uuid = ?", badge, uuid)
+	return err
+}
+
+func (s *mysqlStore) getPlayerBadgeSlots(ctx context.Context, playerName string, badgeSlotRows int, badgeSlotCols int) (badgeSlots []BadgeSlot, err error) {
+	results, err := db.QueryContext(ctx, "SELECT pb.badgeId, pb.slotRow, pb.slotCol FROM playerBadges pb JOIN accounts a ON a.uuid = pb.uuid WHERE a.user = ? AND pb.slotRow BETWEEN 1 AND ? AND pb.slotCol BETWEEN 1 AND ? ORDER BY pb.slotRow, pb.slotCol", playerName, badgeSlotRows, badgeSlotCols)
+	if err != nil {
+		return badgeSlots, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var badgeSlot BadgeSlot
+
+		err := results.Scan(&badgeSlot.BadgeId, &badgeSlot.Row, &badgeSlot.Col)
+		if err != nil {
+			return badgeSlots, err
+		}
+
+		badgeSlots = append(badgeSlots, badgeSlot)
+	}
+
+	return badgeSlots, nil
+}
+
+func (s *mysqlStore) setPlayerBadgeSlot(ctx context.Context, uuid string, badgeId string, slotRow int, slotCol int) error {
+	var slotCurrentBadgeId string
+	err := db.QueryRowContext(ctx, "SELECT badgeId FROM playerBadges WHERE uuid = ? AND slotRow = ? AND slotCol = ? LIMIT 1", uuid, slotRow, slotCol).Scan(&slotCurrentBadgeId)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return err
+		}
+	} else if slotCurrentBadgeId == badgeId {
+		return nil
+	} else {
+		if badgeId != "null" {
+			var badgeCurrentSlotRow, badgeCurrentSlotCol int
+			err := db.QueryRowContext(ctx, "SELECT slotRow, slotCol FROM playerBadges WHERE uuid = ? AND badgeId = ? LIMIT 1", uuid, badgeId).Scan(&badgeCurrentSlotRow, &badgeCurrentSlotCol)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			} else {
+				_, err = db.ExecContext(ctx, "UPDATE playerBadges SET slotRow = ?, slotCol = ? WHERE uuid = ? AND badgeId = ?", badgeCurrentSlotRow, badgeCurrentSlotCol, uuid, slotCurrentBadgeId)
+				if err != nil && err != sql.ErrNoRows {
+					return err
+				}
+			}
+		} else {
+			_, err = db.ExecContext(ctx, "UPDATE playerBadges SET slotRow = 0, slotCol = 0 WHERE uuid = ? AND slotRow = ? AND slotCol = ?", uuid, slotRow, slotCol)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+		}
+	}
+
+	_, err = db.ExecContext(ctx, "UPDATE playerBadges SET slotRow = ?, slotCol = ? WHERE uuid = ? AND badgeId = ?", slotRow, slotCol, uuid, badgeId)
+	return err
+}
+
+func (s *mysqlStore) getPlayerBadgePreset(ctx context.Context, uuid string, presetId int) (preset string, err error) {
+	err = db.QueryRowContext(ctx, "SELECT data FROM playerBadgePresets WHERE uuid = ? AND presetId = ?", uuid, presetId).Scan(&preset)
+	return
+}
+
+func (s *mysqlStore) setPlayerBadgePreset(ctx context.Context, uuid string, presetId int, data string) error {
+	_, err := db.ExecContext(ctx, "REPLACE INTO playerBadgePresets (uuid, presetId, data) VALUES (?, ?, ?)", uuid, presetId, data)
+	return err
+}
+
+func (s *mysqlStore) applyPlayerBadgePreset(ctx context.Context, uuid string, preset [][]string, slotRows int, slotCols int) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, tx.Rollback())
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	for r := range slotRows {
+		if r >= len(preset) {
+			if _, err = db.ExecContext(ctx, "UPDATE playerBadges SET slotRow = 0, slotCol = 0 WHERE uuid = ? AND slotRow >= ?", uuid, r); err != nil {
+				return
+			}
+			continue
+		}
+
+		row := preset[r]
+		for c := range slotCols {
+			if c >= len(row) {
+				if _, err = db.ExecContext(ctx, "UPDATE playerBadges SET slotRow = 0, slotCol = 0 WHERE uuid = ? AND slotRow = ? AND slotCol >= ?", uuid, r, c); err != nil {
+					return
+				}
+				continue
+			}
+
+			badgeId := row[c]
+			if err = s.setPlayerBadgeSlot(ctx, uuid, badgeId, r+1, c+1); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (s *mysqlStore) writeBadges(ctx context.Context, badges []BadgeRecord) error {
+	_, err := db.ExecContext(ctx, "TRUNCATE TABLE badges")
+	if err != nil {
+		return err
+	}
+
+	for _, badge := range badges {
+		_, err = db.ExecContext(ctx, "INSERT INTO badges (badgeId, game, bp, hidden, percentUnlocked) VALUES (?, ?, ?, ?, ?)", badge.BadgeId, badge.Game, badge.Bp, badge.Hidden, badge.PercentUnlocked)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *mysqlStore) getPlayerUnlockedBadgeIds(ctx context.Context, uuid string) (unlockedBadgeIds []string, err error) {
+	results, err := db.QueryContext(ctx, "SELECT badgeId FROM playerBadges WHERE uuid = ?", uuid)
+	if err != nil {
+		return unlockedBadgeIds, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var badgeId string
+		err := results.Scan(&badgeId)
+		if err != nil {
+			return unlockedBadgeIds, err
+		}
+		unlockedBadgeIds = append(unlockedBadgeIds, badgeId)
+	}
+
+	return unlockedBadgeIds, nil
+}
+
+func (s *mysqlStore) unlockPlayerBadge(ctx context.Context, uuid string, badgeId string) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO playerBadges (uuid, badgeId, timestampUnlocked) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE badgeId = badgeId", uuid, badgeId, time.Now())
+	return err
+}
+
+func (s *mysqlStore) removePlayerBadge(ctx context.Context, uuid string, badgeId string) error {
+	var slotRow int
+	var slotCol int
+
+	err := db.QueryRowContext(ctx, "SELECT slotRow, slotCol FROM playerBadges WHERE uuid = ? AND badgeId = ?", uuid, badgeId).Scan(&slotRow, &slotCol)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM playerBadges WHERE uuid = ? AND badgeId = ?", uuid, badgeId)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "UPDATE accounts SET badge = 'null' WHERE uuid = ? AND badge = ?", uuid, badgeId)
+	return err
+}
+
+func (s *mysqlStore) getBadgeUnlockPercentage(ctx context.Context, badgeId string) (unlockPercentage float32, err error) {
+	err = db.QueryRowContext(ctx, "SELECT COALESCE(COUNT(b.uuid) / aa.count, 0) * 100 FROM playerBadges b JOIN accounts a ON a.uuid = b.uuid JOIN (SELECT COUNT(aa.uuid) count FROM accounts aa WHERE EXISTS(SELECT * FROM playerBadges aab WHERE aab.uuid = aa.uuid AND aa.inactive = 0)) aa WHERE EXISTS(SELECT * FROM playerBadges ab WHERE ab.uuid = a.uuid AND a.inactive = 0) AND b.badgeId = ?", badgeId).Scan(&unlockPercentage)
+	return
+}
+
+func (s *mysqlStore) getBadgeUnlockPercentages(ctx context.Context) (unlockPercentages map[string]float32, err error) {
+	results, err := db.QueryContext(ctx, "SELECT b.badgeId, (COUNT(b.uuid) / aa.count) * 100 FROM playerBadges b JOIN accounts a ON a.uuid = b.uuid JOIN (SELECT COUNT(aa.uuid) count FROM accounts aa WHERE EXISTS(SELECT * FROM playerBadges aab WHERE aab.uuid = aa.uuid AND aa.inactive = 0)) aa WHERE EXISTS(SELECT * FROM playerBadges ab WHERE ab.uuid = a.uuid AND a.inactive = 0) GROUP BY b.badgeId")
+	if err != nil {
+		return unlockPercentages, err
+	}
+
+	defer results.Close()
+
+	unlockPercentages = make(map[string]float32)
+
+	for results.Next() {
+		var badgeId string
+		var percentUnlocked float32
+
+		err := results.Scan(&badgeId, &percentUnlocked)
+		if err != nil {
+			return unlockPercentages, err
+		}
+
+		unlockPercentages[badgeId] = percentUnlocked
+	}
+
+	return unlockPercentages, nil
+}
+
+// events
+
+func (s *mysqlStore) getCurrentEventPeriodId(ctx context.Context) (periodId int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT id FROM eventPeriods WHERE UTC_DATE() >= startDate AND UTC_DATE() < endDate").Scan(&periodId)
+	return
+}
+
+func (s *mysqlStore) getCurrentEventPeriodData(ctx context.Context) (eventPeriod EventPeriod, err error) {
+	err = db.QueryRowContext(ctx, "SELECT ep.periodOrdinal, ep.endDate, gep.enableVms FROM eventPeriods ep JOIN gameEventPeriods gep ON gep.periodId = ep.id AND gep.game = ? WHERE UTC_DATE() >= ep.startDate AND UTC_DATE() < ep.endDate", getConfig().gameName).Scan(&eventPeriod.PeriodOrdinal, &eventPeriod.EndDate, &eventPeriod.EnableVms)
+	return
+}
+
+func (s *mysqlStore) getGameCurrentEventPeriodsData(ctx context.Context) (gameEventPeriods map[string]*EventPeriod, err error) {
+	gameEventPeriods = make(map[string]*EventPeriod)
+
+	results, err := db.QueryContext(ctx, "SELECT gep.id, ep.periodOrdinal, ep.endDate, gep.enableVms, gep.game FROM eventPeriods ep JOIN gameEventPeriods gep ON gep.periodId = ep.id WHERE UTC_DATE() >= ep.startDate AND UTC_DATE() < ep.endDate")
+	if err != nil {
+		return gameEventPeriods, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var gameId string
+		var eventPeriod EventPeriod
+
+		err = results.Scan(&eventPeriod.Id, &eventPeriod.PeriodOrdinal, &eventPeriod.EndDate, &eventPeriod.EnableVms, &gameId)
+		if err != nil {
+			return gameEventPeriods, err
+		}
+
+		gameEventPeriods[gameId] = &eventPeriod
+	}
+
+	return gameEventPeriods, nil
+}
+
+func (s *mysqlStore) getGameEventPeriodId(ctx context.Context, game string, periodId int) (id int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT id FROM gameEventPeriods WHERE game = ? AND periodId = ?", game, periodId).Scan(&id)
+	return
+}
+
+func (s *mysqlStore) getGamePlayerCounts(ctx context.Context, periodId int) (gameIds []string, playerCounts []int, err error) {
+	results, err := db.QueryContext(ctx, "SELECT CEIL(AVG(gpc.playerCount)), gpc.game FROM gamePlayerCounts gpc JOIN gameEventPeriods gep ON gep.periodId = ? AND gep.game = gpc.game GROUP BY gpc.game", periodId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var playerCount int
+		var gameId string
+
+		err = results.Scan(&playerCount, &gameId)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		gameIds = append(gameIds, gameId)
+		playerCounts = append(playerCounts, playerCount)
+	}
+
+	return gameIds, playerCounts, nil
+}
+
+func (s *mysqlStore) writeGamePlayerCount(ctx context.Context, playerCount int) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO gamePlayerCounts (game, playerCount) VALUES (?, ?)", getConfig().gameName, playerCount)
+	if err != nil {
+		return err
+	}
+
+	var playerCounts int
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM gamePlayerCounts WHERE game = ?", getConfig().gameName).Scan(&playerCounts)
+	if err != nil {
+		return err
+	}
+
+	if playerCounts > 28 {
+		_, err = db.ExecContext(ctx, "DELETE FROM gamePlayerCounts WHERE game = ? ORDER BY id LIMIT ?", getConfig().gameName, playerCounts-28)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *mysqlStore) getPlayerTotalEventExp(ctx context.Context, uuid string) (totalEventExp int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT SUM(exp) FROM ((SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventLocations el ON el.id = ec.eventId AND ec.type = 0 JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ec.uuid = ?) UNION ALL (SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventVms ev ON ev.id = ec.eventId AND ec.type = 2 JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ec.uuid = ?)) eventExp", uuid, uuid).Scan(&totalEventExp)
+	return
+}
+
+func (s *mysqlStore) getPlayerPeriodEventExp(ctx context.Context, uuid string, periodId int) (periodEventExp int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT SUM(exp) FROM ((SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventLocations el ON el.id = ec.eventId AND ec.type = 0 JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ep.id = ? AND ec.uuid = ?) UNION ALL (SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventVms ev ON ev.id = ec.eventId AND ec.type = 2 JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ep.id = ? AND ec.uuid = ?)) eventExp", periodId, uuid, periodId, uuid).Scan(&periodEventExp)
+	return
+}
+
+func (s *mysqlStore) getPlayerWeekEventExp(ctx context.Context, uuid string, periodId int) (weekEventExp int, err error) {
+	weekdayIndex := int(time.Now().UTC().Weekday())
+
+	err = db.QueryRowContext(ctx, "SELECT SUM(exp) FROM ((SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventLocations el ON el.id = ec.eventId AND ec.type = 0 JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ep.id = ? AND ec.uuid = ? AND DATE_SUB(UTC_DATE(), INTERVAL ? DAY) <= el.startDate AND DATE_ADD(UTC_DATE(), INTERVAL ? DAY) >= el.endDate) UNION ALL (SELECT COALESCE(SUM(ec.exp), 0) exp FROM eventCompletions ec JOIN eventVms ev ON ev.id = ec.eventId AND ec.type = 2 JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ep.id = ? AND ec.uuid = ? AND DATE_SUB(UTC_DATE(), INTERVAL ? DAY) <= ev.startDate AND DATE_ADD(UTC_DATE(), INTERVAL ? DAY) >= ev.endDate)) eventExp", periodId, uuid, weekdayIndex, 7-weekdayIndex, periodId, uuid, weekdayIndex, 7-weekdayIndex).Scan(&weekEventExp)
+	return
+}
+
+func (s *mysqlStore) getPlayerEventLocationCount(ctx context.Context, uuid string) (eventLocationCount int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT COUNT(eventId) FROM eventCompletions WHERE uuid = ? AND type < 2", uuid).Scan(&eventLocationCount)
+	return
+}
+
+func (s *mysqlStore) getPlayerEventLocationCompletion(ctx context.Context, uuid string) (eventLocationCompletion int, err error) {
+	err = db.QueryRowContext(ctx, `
+	SELECT COUNT(locationId)
+	FROM (
+		SELECT DISTINCT(COALESCE(el.locationId, pel.locationId)) AS locationId
+		FROM eventCompletions ec
+		JOIN accounts a ON a.uuid = ec.uuid
+		LEFT JOIN eventLocations el ON el.id = ec.eventId AND ec.type = 0
+		LEFT JOIN playerEventLocations pel ON pel.id = ec.eventId AND ec.type = 1
+		LEFT JOIN ( SELECT gl.id, gl.secret FROM gameLocations gl ) gl ON COALESCE(el.locationId, pel.locationId) = gl.id
+		WHERE gl.secret = 0 AND ec.uuid = ?) ael`, uuid).Scan(&eventLocationCompletion)
+	return
+}
+
+func (s *mysqlStore) getPlayerEventVmCount(ctx context.Context, uuid string) (eventVmCount int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT COUNT(eventId) FROM eventCompletions WHERE uuid = ? AND type = 2", uuid).Scan(&eventVmCount)
+	return
+}
+
+func (s *mysqlStore) getLocationName(ctx context.Context, locationId int) (locationName string, err error) {
+	err = db.QueryRowContext(ctx, "SELECT l.title FROM gameLocations l WHERE l.id = ?", locationId).Scan(&locationName)
+	return
+}
+
+func (s *mysqlStore) getEventLocationCount(ctx context.Context, periodId int, eventType int, exp int, daysAgo int) (count int, err error) {
+	if periodId == 0 {
+		err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM eventLocations").Scan(&count)
+		return
+	}
+
+	query := "SELECT COUNT(el.id) FROM eventLocations el JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE el.type = ? AND ep.id = ? AND el.startDate = DATE_SUB(UTC_DATE(), INTERVAL ? DAY)"
+	queryArgs := []any{eventType, periodId, daysAgo}
+
+	if exp != 0 {
+		query += " AND el.exp = ?"
+		queryArgs = append(queryArgs, exp)
+	}
+
+	err = db.QueryRowContext(ctx, query, queryArgs...).Scan(&count)
+	return
+}
+
+func (s *mysqlStore) getOrWriteLocationIdForEventLocation(ctx context.Context, gameId string, gameEventPeriodId int, title string, titleJP string, depth int, minDepth int, mapIds []string) (locationId int, err error) {
+	mapIdsJson, err := json.Marshal(mapIds)
+	if err != nil {
+		return locationId, err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO gameLocations (game, title, titleJP, depth, minDepth, mapIds) VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE titleJP = ?, depth = ?, minDepth = ?, mapIds = ?", gameId, title, titleJP, depth, minDepth, mapIdsJson, titleJP, depth, minDepth, mapIdsJson)
+	if err != nil {
+		return locationId, err
+	}
+
+	db.QueryRowContext(ctx, "SELECT l.id FROM gameLocations l JOIN gameEventPeriods gep ON gep.game = l.game WHERE gep.id = ? AND l.game = ? AND l.title = ?", gameEventPeriodId, gameId, title).Scan(&locationId)
+
+	return locationId, nil
+}
+
+func (s *mysqlStore) getOrWriteLocationIdForPlayerEventLocation(ctx context.Context, gameId string, gameEventPeriodId int, uuid string, title string, titleJP string, depth int, minDepth int, mapIds []string) (locationId int, err error) {
+	var playerEventLocationQueueLength int
+	db.QueryRowContext(ctx, "SELECT COUNT(*) FROM playerEventLocationQueue WHERE game = ? AND date = UTC_DATE()", gameId).Scan(&playerEventLocationQueueLength)
+
+	if playerEventLocationQueueLength > 0 {
+		var currentPlayerEventLocationQueueLength int
+		db.QueryRowContext(ctx, "SELECT COUNT(*) FROM eventCompletions ec JOIN playerEventLocations pel ON pel.id = ec.eventId AND ec.type = 1 WHERE pel.gamePeriodId = ? AND pel.startDate = UTC_DATE() AND pel.uuid = ?", gameEventPeriodId, uuid).Scan(&currentPlayerEventLocationQueueLength)
+
+		if currentPlayerEventLocationQueueLength < playerEventLocationQueueLength {
+			db.QueryRowContext(ctx, "SELECT locationId FROM playerEventLocationQueue WHERE game = ? AND date = UTC_DATE() AND queueIndex = ?", gameId, currentPlayerEventLocationQueueLength+1).Scan(&locationId)
+
+			return locationId, nil
+		}
+	}
+
+	locationId, err = s.getOrWriteLocationIdForEventLocation(ctx, gameId, gameEventPeriodId, title, titleJP, depth, minDepth, mapIds)
+	if err != nil {
+		return locationId, err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO playerEventLocationQueue (game, date, queueIndex, locationId) VALUES (?, UTC_DATE(), ?, ?)", gameId, playerEventLocationQueueLength+1, locationId)
+	if err != nil {
+		return locationId, err
+	}
+
+	return locationId, nil
+}
+
+func (s *mysqlStore) writeEventLocation(ctx context.Context, gameId string, gameEventPeriodId int, eventType int, title string, titleJP string, depth int, minDepth int, exp int, mapIds []string, offsetDays int, days int) error {
+	locationId, err := s.getOrWriteLocationIdForEventLocation(ctx, gameId, gameEventPeriodId, title, titleJP, depth, minDepth, mapIds)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO eventLocations (locationId, gamePeriodId, type, exp, startDate, endDate) VALUES (?, ?, ?, ?, DATE_SUB(UTC_DATE(), INTERVAL ? DAY), DATE_ADD(UTC_DATE(), INTERVAL ? DAY))", locationId, gameEventPeriodId, eventType, exp, offsetDays, days)
+	return err
+}
+
+func (s *mysqlStore) writePlayerEventLocation(ctx context.Context, gameId string, gameEventPeriodId int, uuid string, title string, titleJP string, depth int, minDepth int, mapIds []string) error {
+	locationId, err := s.getOrWriteLocationIdForPlayerEventLocation(ctx, gameId, gameEventPeriodId, uuid, title, titleJP, depth, minDepth, mapIds)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO playerEventLocations (locationId, gamePeriodId, uuid, startDate, endDate) SELECT ?, ?, ?, UTC_DATE(), DATE_ADD(UTC_DATE(), INTERVAL 1 DAY) WHERE NOT EXISTS(SELECT * FROM playerEventLocations pel LEFT JOIN eventCompletions ec ON ec.eventId = pel.id AND ec.type = 1 AND ec.uuid = pel.uuid WHERE pel.uuid = ? AND pel.gamePeriodId = ? AND ec.uuid IS NULL AND UTC_DATE() >= pel.startDate AND UTC_DATE() < pel.endDate)", locationId, gameEventPeriodId, uuid, uuid, gameEventPeriodId)
+	return err
+}
+
+func (s *mysqlStore) getCurrentEventLocations(ctx context.Context, uuid string, periodId int) (eventLocations []*EventLocation, err error) {
+	results, err := db.QueryContext(ctx, "SELECT el.id, el.type, gep.game, l.id, l.title, l.titleJP, l.depth, l.minDepth, el.exp, el.endDate, CASE WHEN ec.uuid IS NOT NULL THEN 1 ELSE 0 END FROM eventLocations el JOIN gameLocations l ON l.id = el.locationId JOIN gameEventPeriods gep ON gep.id = el.gamePeriodId LEFT JOIN eventCompletions ec ON ec.eventId = el.id AND ec.type = 0 AND ec.uuid = ? WHERE gep.periodId = ? AND UTC_DATE() >= el.startDate AND UTC_DATE() < el.endDate ORDER BY 2, 1", uuid, periodId)
+	if err != nil {
+		return eventLocations, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var eventLocation EventLocation
+
+		var completeBin int
+
+		err := results.Scan(&eventLocation.Id, &eventLocation.Type, &eventLocation.Game, &eventLocation.LocationId, &eventLocation.Title, &eventLocation.TitleJP, &eventLocation.Depth, &eventLocation.MinDepth, &eventLocation.Exp, &eventLocation.EndDate, &completeBin)
+		if err != nil {
+			return eventLocations, err
+		}
+
+		eventLocation.Complete = completeBin == 1
+
+		eventLocations = append(eventLocations, &eventLocation)
+	}
+
+	return eventLocations, nil
+}
+
+func (s *mysqlStore) getCurrentPlayerEventLocations(ctx context.Context, uuid string, periodId int) (eventLocations []*EventLocation, err error) {
+	results, err := db.QueryContext(ctx, "SELECT pel.id, gep.game, pl.id, pl.title, pl.titleJP, pl.depth, pl.minDepth, pel.endDate FROM playerEventLocations pel JOIN gameLocations pl ON pl.id = pel.locationId JOIN gameEventPeriods gep ON gep.id = pel.gamePeriodId LEFT JOIN eventCompletions ec ON ec.eventId = pel.id AND ec.type = 1 AND ec.uuid = pel.uuid WHERE pel.uuid = ? AND gep.periodId = ? AND gep.game = ? AND ec.uuid IS NULL AND UTC_DATE() >= pel.startDate AND UTC_DATE() < pel.endDate ORDER BY 1", uuid, periodId, getConfig().gameName)
+	if err != nil {
+		return eventLocations, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var eventLocation EventLocation
+
+		err := results.Scan(&eventLocation.Id, &eventLocation.Game, &eventLocation.LocationId, &eventLocation.Title, &eventLocation.TitleJP, &eventLocation.Depth, &eventLocation.MinDepth, &eventLocation.EndDate)
+		if err != nil {
+			return eventLocations, err
+		}
+
+		eventLocations = append(eventLocations, &eventLocation)
+	}
+
+	return eventLocations, nil
+}
+
+func (s *mysqlStore) getEventLocationCandidates(ctx context.Context, gameEventPeriodId int, title string) (candidates []*EventCandidate, err error) {
+	results, err := db.QueryContext(ctx, "SELECT el.id, el.type, el.exp, l.mapIds FROM eventLocations el JOIN gameLocations l ON l.id = el.locationId WHERE el.gamePeriodId = ? AND l.title = ? AND l.game = ? AND UTC_DATE() >= el.startDate AND UTC_DATE() < el.endDate ORDER BY 2", gameEventPeriodId, title, getConfig().gameName)
+	if err != nil {
+		return candidates, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var candidate EventCandidate
+		var mapIdsJson string
+
+		err := results.Scan(&candidate.Id, &candidate.Type, &candidate.Exp, &mapIdsJson)
+		if err != nil {
+			return candidates, err
+		}
+
+		err = json.Unmarshal([]byte(mapIdsJson), &candidate.MapIds)
+		if err != nil {
+			return candidates, err
+		}
+
+		candidates = append(candidates, &candidate)
+	}
+
+	return candidates, nil
+}
+
+func (s *mysqlStore) getPlayerEventLocationCandidates(ctx context.Context, gameEventPeriodId int, title string, uuid string) (candidates []*EventCandidate, err error) {
+	results, err := db.QueryContext(ctx, "SELECT pel.id, pl.mapIds FROM playerEventLocations pel JOIN gameLocations pl ON pl.id = pel.locationId WHERE pel.gamePeriodId = ? AND pl.title = ? AND pl.game = ? AND pel.uuid = ? AND UTC_DATE() >= pel.startDate AND UTC_DATE() < pel.endDate ORDER BY 2", gameEventPeriodId, title, getConfig().gameName, uuid)
+	if err != nil {
+		return candidates, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		candidate := EventCandidate{Type: 1}
+		var mapIdsJson string
+
+		err := results.Scan(&candidate.Id, &mapIdsJson)
+		if err != nil {
+			return candidates, err
+		}
+
+		err = json.Unmarshal([]byte(mapIdsJson), &candidate.MapIds)
+		if err != nil {
+			return candidates, err
+		}
+
+		candidates = append(candidates, &candidate)
+	}
+
+	return candidates, nil
+}
+
+func (s *mysqlStore) getCurrentEventVms(ctx context.Context, uuid string, periodId int) (eventVms []*EventVm, err error) {
+	results, err := db.QueryContext(ctx, "SELECT ev.id, gep.game, ev.exp, ev.endDate, CASE WHEN ec.uuid IS NOT NULL THEN 1 ELSE 0 END FROM eventVms ev JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId LEFT JOIN eventCompletions ec ON ec.eventId = ev.id AND ec.type = 2 AND ec.uuid = ? WHERE gep.periodId = ? AND UTC_DATE() >= ev.startDate AND UTC_DATE() < ev.endDate ORDER BY 2, 1", uuid, periodId)
+	if err != nil {
+		return eventVms, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var eventVm EventVm
+
+		var completeBin int
+
+		err := results.Scan(&eventVm.Id, &eventVm.Game, &eventVm.Exp, &eventVm.EndDate, &completeBin)
+		if err != nil {
+			return eventVms, err
+		}
+
+		eventVm.Complete = completeBin == 1
+
+		eventVms = append(eventVms, &eventVm)
+	}
+
+	return eventVms, nil
+}
+
+func (s *mysqlStore) getEventVmInfo(ctx context.Context, id int) (gameId string, mapId int, vmGroup []int, err error) {
+	var vmGroupJson []byte
+	err = db.QueryRowContext(ctx, "SELECT gep.game, ev.mapId, ev.eventIds FROM eventVms ev JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId WHERE ev.id = ?", id).Scan(&gameId, &mapId, &vmGroupJson)
+	err = errors.Join(err, json.Unmarshal(vmGroupJson, &vmGroup))
+	return
+}
+
+func (s *mysqlStore) getEventVmStartedDaysAgo(ctx context.Context, periodId int, daysAgo int) (id int, gameId string, mapId int, vmGroup []int, err error) {
+	var vmGroupJson []byte
+	err = db.QueryRowContext(ctx, "SELECT ev.id, gep.game, ev.mapId, ev.eventIds FROM eventVms ev JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId JOIN eventPeriods ep ON ep.id = gep.periodId WHERE ep.id = ? AND ev.startDate = DATE_SUB(UTC_DATE(), INTERVAL ? DAY)", periodId, daysAgo).Scan(&id, &gameId, &mapId, &vmGroupJson)
+	err = errors.Join(err, json.Unmarshal(vmGroupJson, &vmGroup))
+	return
+}
+
+func (s *mysqlStore) getEventVmCandidates(ctx context.Context, periodId int, mapId int, eventId int) (candidates []*EventCandidate, err error) {
+	results, err := db.QueryContext(ctx, "SELECT ev.id, ev.mapId, ev.exp FROM eventVms ev JOIN gameEventPeriods gep ON gep.id = ev.gamePeriodId WHERE gep.periodId = ? AND ev.mapId = ? AND JSON_CONTAINS(ev.eventIds, ?) AND UTC_DATE() >= ev.startDate AND UTC_DATE() < ev.endDate ORDER BY 2", periodId, mapId, eventId)
+	if err != nil {
+		return candidates, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		candidate := EventCandidate{Type: 2}
+
+		err := results.Scan(&candidate.Id, &candidate.MapId, &candidate.Exp)
+		if err != nil {
+			return candidates, err
+		}
+
+		candidates = append(candidates, &candidate)
+	}
+
+	return candidates, nil
+}
+
+func (s *mysqlStore) writeEventVm(ctx context.Context, gameEventPeriodId int, mapId int, vmGroup EventIds, exp int, offsetDays int, days int) error {
+	vmGroupJson, err := json.Marshal(vmGroup)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO eventVms (gamePeriodId, mapId, eventIds, exp, startDate, endDate) VALUES (?, ?, ?, ?, DATE_SUB(UTC_DATE(), INTERVAL ? DAY), DATE_ADD(UTC_DATE(), INTERVAL ? DAY))", gameEventPeriodId, mapId, vmGroupJson, exp, offsetDays, days)
+	return err
+}
+
+func (s *mysqlStore) writeEventCompletion(ctx context.Context, eventId int, uuid string, eventType int, exp int) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO eventCompletions (eventId, uuid, type, timestampCompleted, exp) VALUES (?, ?, ?, ?, ?)", eventId, uuid, eventType, time.Now(), exp)
+	return err
+}
+
+func (s *mysqlStore) cleanupEvents(ctx context.Context) error {
+	// Remove player expeditions that were never completed
+	_, err := db.ExecContext(ctx, "DELETE pel FROM playerEventLocations pel WHERE UTC_DATE() > pel.endDate AND NOT EXISTS (SELECT ec.eventId FROM eventCompletions ec WHERE ec.eventId = pel.id AND ec.type = 1)")
+	if err != nil {
+		return err
+	}
+
+	// Remove player event location queue for past dates
+	_, err = db.ExecContext(ctx, "DELETE FROM playerEventLocationQueue WHERE UTC_DATE() > date")
+	return err
+}
+
+// screenshots
+
+func (s *mysqlStore) getPlayerScreenshotLimit(ctx context.Context, uuid string) (screenshotLimit int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT screenshotLimit FROM accounts WHERE uuid = ?", uuid).Scan(&screenshotLimit)
+	return
+}
+
+func (s *mysqlStore) getScreenshotFeed(ctx context.Context, uuid string, limit int, offset int, offsetId string, game string, sortOrder string, intervalType string) ([]*ScreenshotData, error) {
+	var screenshots []*ScreenshotData
+
+	var queryArgs []any
+
+	var cteClause string
+	var selectClause string
+	var fromJoinClause string
+	var whereClause string
+	var orderByClause string
+
+	selectClause = "SELECT ps.id, op.uuid, oa.user, op.rank, COALESCE(oa.badge, ''), opgd.systemName, ps.game, ps.mapId, ps.mapX, ps.mapY, ps.publicTimestamp, ps.spoiler, (SELECT COUNT(*) FROM playerScreenshotLikes psl WHERE psl.screenshotId = ps.id) AS likeCount, CASE WHEN upsl.uuid IS NULL THEN 0 ELSE 1 END"
+
+	fromJoinClause = " FROM playerScreenshots ps JOIN players op ON op.uuid = ps.uuid JOIN accounts oa ON oa.uuid = op.uuid JOIN playerGameData opgd ON opgd.uuid = op.uuid AND opgd.game = ps.game LEFT JOIN playerScreenshotLikes upsl ON upsl.screenshotId = ps.id AND upsl.uuid = ? "
+
+	if offsetId != "" && sortOrder != "likes" {
+		cteClause = "WITH offsetScreenshot AS (SELECT publicTimestamp FROM playerScreenshots WHERE id = ?) "
+		fromJoinClause += "JOIN offsetScreenshot ops ON ops.publicTimestamp >= ps.publicTimestamp "
+		queryArgs = append(queryArgs, offsetId)
+	}
+
+	queryArgs = append(queryArgs, uuid)
+
+	whereClause = "WHERE ps.temp = 0 AND ps.public = 1 AND op.banned = 0 "
+
+	if game != "" {
+		whereClause += "AND ps.game = ? "
+		queryArgs = append(queryArgs, game)
+	}
+
+	if intervalType != "all" {
+		whereClause += "AND ps.publicTimestamp >= DATE_SUB(NOW(), INTERVAL 1 " + intervalType + ") "
+	}
+
+	orderByClause = "ORDER BY "
+
+	if sortOrder == "likes" {
+		if intervalType == "all" {
+			orderByClause += "likeCount"
+		} else {
+			orderByClause += "(SELECT COUNT(*) FROM playerScreenshotLikes ipsl WHERE ipsl.screenshotId = ps.id AND ipsl.timestamp >= DATE_SUB(NOW(), INTERVAL 1 " + intervalType + "))"
+		}
+		orderByClause += " DESC, "
+	}
+
+	orderByClause += "ps.publicTimestamp DESC, op.uuid, ps.id DESC "
+
+	query := cteClause + selectClause + fromJoinClause + whereClause + orderByClause + "LIMIT ?, ?"
+
+	queryArgs = append(queryArgs, offset, limit)
+
+	results, err := db.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		return screenshots, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var screenshot ScreenshotData
+		var owner ScreenshotOwner
+
+		err := results.Scan(&screenshot.Id, &owner.Uuid, &owner.Name, &owner.Rank, &owner.Badge, &owner.SystemName, &screenshot.Game, &screenshot.MapId, &screenshot.MapX, &screenshot.MapY, &screenshot.Timestamp, &screenshot.Spoiler, &screenshot.LikeCount, &screenshot.Liked)
+		if err != nil {
+			return screenshots, err
+		}
+
+		screenshot.Public = true
+		screenshot.Owner = &owner
+		screenshots = append(screenshots, &screenshot)
+	}
+
+	return screenshots, nil
+}
+
+func (s *mysqlStore) getScreenshotInfo(ctx context.Context, uuid string, ownerUuid string, id string) (*ScreenshotData, error) {
+	screenshot := &ScreenshotData{}
+	owner := &ScreenshotOwner{}
+
+	query := "SELECT ps.id, op.uuid, oa.user, op.rank, COALESCE(oa.badge, ''), opgd.systemName, ps.game, ps.mapId, ps.mapX, ps.mapY, ps.publicTimestamp, ps.public, ps.spoiler, (SELECT COUNT(*) FROM playerScreenshotLikes psl WHERE psl.screenshotId = ps.id) AS likeCount, CASE WHEN upsl.uuid IS NULL THEN 0 ELSE 1 END FROM playerScreenshots ps JOIN players op ON op.uuid = ps.uuid JOIN accounts oa ON oa.uuid = op.uuid JOIN playerGameData opgd ON opgd.uuid = op.uuid AND opgd.game = ps.game LEFT JOIN playerScreenshotLikes upsl ON upsl.screenshotId = ps.id AND upsl.uuid = ? WHERE ps.uuid = ? AND ps.id = ?"
+	err := db.QueryRowContext(ctx, query, uuid, ownerUuid, id).Scan(&screenshot.Id, &owner.Uuid, &owner.Name, &owner.Rank, &owner.Badge, &owner.SystemName, &screenshot.Game, &screenshot.MapId, &screenshot.MapX, &screenshot.MapY, &screenshot.Timestamp, &screenshot.Public, &screenshot.Spoiler, &screenshot.LikeCount, &screenshot.Liked)
+	if err != nil {
+		return nil, err
+	}
+
+	screenshot.Owner = owner
+
+	return screenshot, nil
+}
+
+func (s *mysqlStore) getPlayerScreenshots(ctx context.Context, uuid string) ([]*PlayerScreenshotData, error) {
+	var playerScreenshots []*PlayerScreenshotData
+
+	results, err := db.QueryContext(ctx, "SELECT ps.id, ps.uuid, ps.game, ps.mapId, ps.mapX, ps.mapY, opgd.systemName, ps.timestamp, ps.public, ps.spoiler, (SELECT COUNT(*) FROM playerScreenshotLikes psl WHERE psl.screenshotId = ps.id), CASE WHEN upsl.uuid IS NULL THEN 0 ELSE 1 END FROM playerScreenshots ps JOIN playerGameData opgd ON opgd.uuid = ps.uuid AND opgd.game = ps.game LEFT JOIN playerScreenshotLikes upsl ON upsl.screenshotId = ps.id AND upsl.uuid = ps.uuid WHERE ps.uuid = ? AND ps.temp = 0 ORDER BY ps.timestamp DESC, ps.id", uuid)
+	if err != nil {
+		return playerScreenshots, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var screenshot PlayerScreenshotData
+
+		err := results.Scan(&screenshot.Id, &screenshot.Uuid, &screenshot.Game, &screenshot.MapId, &screenshot.MapX, &screenshot.MapY, &screenshot.SystemName, &screenshot.Timestamp, &screenshot.Public, &screenshot.Spoiler, &screenshot.LikeCount, &screenshot.Liked)
+		if err != nil {
+			return playerScreenshots, err
+		}
+
+		playerScreenshots = append(playerScreenshots, &screenshot)
+	}
+
+	return playerScreenshots, nil
+}
+
+func (s *mysqlStore) getScreenshotGames(ctx context.Context) ([]string, error) {
+	var screenshotGames []string
+
+	results, err := db.QueryContext(ctx, "SELECT DISTINCT game FROM playerScreenshots")
+	if err != nil {
+		return screenshotGames, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var game string
+		err := results.Scan(&game)
+		if err != nil {
+			return screenshotGames, err
+		}
+		screenshotGames = append(screenshotGames, game)
+	}
+
+	return screenshotGames, nil
+}
+
+func (s *mysqlStore) getPlayerScreenshotCount(ctx context.Context, uuid string, temp bool) (playerScreenshotCount int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM playerScreenshots WHERE uuid = ? AND temp = ?", uuid, temp).Scan(&playerScreenshotCount)
+	return
+}
+
+func (s *mysqlStore) writeScreenshotData(ctx context.Context, id string, uuid string, game string, mapId string, mapX int, mapY int, temp bool) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO playerScreenshots (id, uuid, game, mapId, mapX, mapY, public, publicTimestamp, temp) VALUES (?, ?, ?, ?, ?, ?, ?, CASE WHEN ? = 1 THEN UTC_TIMESTAMP() ELSE NULL END, ?)", id, uuid, game, mapId, mapX, mapY, temp, temp, temp)
+	return err
+}
+
+func (s *mysqlStore) setPlayerScreenshotPublic(ctx context.Context, id string, uuid string, value bool) (bool, error) {
+	return rowsAffected(db.ExecContext(ctx, "UPDATE playerScreenshots SET public = ?, publicTimestamp = COALESCE(publicTimestamp, NOW()) WHERE id = ? AND EXISTS (SELECT * FROM playerScreenshots ps JOIN players p ON p.uuid = ? JOIN players op ON op.uuid = ps.uuid WHERE p.uuid = op.uuid OR p.rank > op.rank)", value, id, uuid))
+}
+
+func (s *mysqlStore) setPlayerScreenshotSpoiler(ctx context.Context, id string, uuid string, value bool) (bool, error) {
+	return rowsAffected(db.ExecContext(ctx, "UPDATE playerScreenshots SET spoiler = ? WHERE id = ? AND EXISTS (SELECT * FROM playerScreenshots ps JOIN players p ON p.uuid = ? JOIN players op ON op.uuid = ps.uuid WHERE p.uuid = op.uuid OR p.rank > op.rank)", value, id, uuid))
+}
+
+func (s *mysqlStore) writePlayerScreenshotLike(ctx context.Context, id string, uuid string) (bool, error) {
+	return rowsAffected(db.ExecContext(ctx, "INSERT IGNORE INTO playerScreenshotLikes (screenshotId, uuid) VALUES (?, ?)", id, uuid))
+}
+
+func (s *mysqlStore) deletePlayerScreenshotLike(ctx context.Context, id string, uuid string) (bool, error) {
+	return rowsAffected(db.ExecContext(ctx, "DELETE FROM playerScreenshotLikes WHERE screenshotId = ? AND uuid = ?", id, uuid))
+}
+
+func (s *mysqlStore) deleteScreenshot(ctx context.Context, id string, uuid string) (bool, error) {
+	return rowsAffected(db.ExecContext(ctx, "DELETE FROM playerScreenshots WHERE id = ? AND EXISTS (SELECT * FROM playerScreenshots ps JOIN players p ON p.uuid = ? JOIN players op ON op.uuid = ps.uuid WHERE p.uuid = op.uuid OR p.rank > op.rank)", id, uuid))
+}
+
+func (s *mysqlStore) deleteTempScreenshots(ctx context.Context) (screenshots []*PlayerScreenshotData, err error) {
+	results, err := db.QueryContext(ctx, "SELECT id, uuid FROM playerScreenshots WHERE temp = 1 AND timestamp < DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY)")
+	if err != nil {
+		return screenshots, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var screenshot PlayerScreenshotData
+		err = results.Scan(&screenshot.Id, &screenshot.Uuid)
+		if err != nil {
+			continue
+		}
+
+		screenshots = append(screenshots, &screenshot)
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM playerScreenshots WHERE temp = 1 AND timestamp < DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY)")
+	return screenshots, err
+}
+
+// schedules
+
+func (s *mysqlStore) listSchedules(ctx context.Context, uuid string, partyId int, mod bool) ([]*ScheduleDisplay, error) {
+	var schedules []*ScheduleDisplay
+
+	query := `
+WITH tally AS (SELECT scheduleId, COUNT(uuid) AS followerCount FROM playerScheduleFollows GROUP BY scheduleId)
+SELECT s.id, s.name, s.description, s.ownerUuid, acc.user AS ownerName, pd.rank AS ownerRank, acc.badge, pgd.systemName,
+	   s.partyId, s.game, s.official, s.recurring, s.intervalValue, s.intervalType, s.datetime, s.systemName, s.discord, s.youtube, s.twitch, s.niconico, s.openrec, s.bilibili,
+	   COALESCE(tally.followerCount, 0) AS followerCount, CASE WHEN s.id IN (SELECT scheduleId FROM playerScheduleFollows WHERE uuid = ?) THEN 1 ELSE 0 END AS playerLiked
+FROM schedules s
+JOIN accounts acc ON acc.uuid = s.ownerUuid
+JOIN playerGameData pgd ON pgd.uuid = s.ownerUuid AND pgd.game = ?
+JOIN players pd ON pd.uuid = s.ownerUuid
+LEFT JOIN tally ON tally.scheduleId = s.id
+WHERE COALESCE(s.partyId, 0) IN (0, ?) OR ?`
+
+	results, err := db.QueryContext(ctx, query, uuid, getConfig().gameName, partyId, mod)
+	if err != nil {
+		return schedules, err
+	}
+	defer results.Close()
+	for results.Next() {
+		var s ScheduleDisplay
+		err := results.Scan(&s.Id, &s.Name, &s.Description, &s.OwnerUuid, &s.OwnerName, &s.OwnerRank, &s.OwnerBadge, &s.OwnerSystemName, &s.PartyId, &s.Game, &s.Official,
+			&s.Recurring, &s.IntervalValue, &s.IntervalType, &s.Datetime, &s.SystemName, &s.Discord, &s.Youtube, &s.Twitch, &s.Niconico, &s.Openrec, &s.Bilibili, &s.FollowerCount, &s.PlayerLiked)
+		if err != nil {
+			return schedules, err
+		}
+		schedules = append(schedules, &s)
+	}
+	return schedules, nil
+}
+
+func (s *mysqlStore) createSchedule(ctx context.Context, sch *ScheduleUpdate) (int, error) {
+	query := `
+INSERT INTO schedules
+	(name, description, ownerUuid, partyId, game, official, recurring, intervalValue, intervalType, datetime, systemName, discord, youtube, twitch, niconico, openrec, bilibili)
+VALUES
+	(   ?,           ?,         ?,       ?,    ?,         ?,        ?,             ?,            ?,        ?,          ?,       ?,       ?,      ?,        ?,       ?,        ?)`
+	results, err := db.ExecContext(ctx, query, sch.Name, sch.Description, sch.OwnerUuid, sch.PartyId, sch.Game, sch.Official, sch.Recurring, sch.IntervalValue, sch.IntervalType, sch.Datetime, sch.SystemName,
+		sch.Discord, sch.Youtube, sch.Twitch, sch.Niconico, sch.Openrec, sch.Bilibili)
+	if err != nil {
+		return 0, err
+	}
+	id, err := results.LastInsertId()
+	return int(id), err
+}
+
+func (s *mysqlStore) updateSchedule(ctx context.Context, id int, mod bool, uuid string, sch *ScheduleUpdate) (bool, error) {
+	query := `
+UPDATE schedules SET
+	name = ?, description = ?, partyId = ?, game = ?, recurring = ?, intervalValue = ?, intervalType = ?, datetime = ?, systemName = ?,
+	official = (CASE WHEN ? THEN ? ELSE official END), ownerUuid = (CASE ? WHEN '' THEN ownerUuid ELSE ? END),
+	discord = ?, youtube = ?, twitch = ?, niconico = ?, openrec = ?, bilibili = ?
+WHERE id = ? AND (? OR ownerUuid = ?)`
+	return rowsAffected(db.ExecContext(ctx, query, sch.Name, sch.Description, sch.PartyId, sch.Game, sch.Recurring, sch.IntervalValue, sch.IntervalType, sch.Datetime, sch.SystemName,
+		mod, sch.Official, sch.OwnerUuid, sch.OwnerUuid,
+		sch.Discord, sch.Youtube, sch.Twitch, sch.Niconico, sch.Openrec, sch.Bilibili,
+		id, mod, uuid))
+}
+
+func (s *mysqlStore) getUpcomingSchedules(ctx context.Context, after time.Time) (map[int]time.Time, error) {
+	schedules := make(map[int]time.Time)
+
+	results, err := db.QueryContext(ctx, "SELECT id, datetime FROM schedules WHERE datetime >= ? AND game = ?", after, getConfig().gameName)
+	if err != nil {
+		return schedules, err
+	}
+
+	defer results.Close()
+	for results.Next() {
+		var scheduleId int
+		var datetime time.Time
+		err = results.Scan(&scheduleId, &datetime)
+		if err != nil {
+			return schedules, err
+		}
+		schedules[scheduleId] = datetime
+	}
+
+	return schedules, nil
+}
+
+func (s *mysqlStore) followSchedule(ctx context.Context, uuid string, scheduleId int, follow bool) (bool, error) {
+	var query string
+	if follow {
+		query = "INSERT IGNORE INTO playerScheduleFollows (uuid, scheduleId) VALUES (?, ?)"
+	} else {
+		query = "DELETE FROM playerScheduleFollows WHERE uuid = ? AND scheduleId = ?"
+	}
+	return rowsAffected(db.ExecContext(ctx, query, uuid, scheduleId))
+}
+
+func (s *mysqlStore) getScheduleFollowCount(ctx context.Context, scheduleId int) (followCount int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT COUNT(uuid) FROM playerScheduleFollows WHERE scheduleId = ?", scheduleId).Scan(&followCount)
+	return
+}
+
+func (s *mysqlStore) getScheduleFollowers(ctx context.Context, scheduleId int) ([]string, error) {
+	query := `
+SELECT psf.uuid
+FROM schedules s
+JOIN playerScheduleFollows psf ON psf.scheduleId = s.id
+WHERE s.id = ?`
+	results, err := db.QueryContext(ctx, query, scheduleId)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	var uuids []string
+	for results.Next() {
+		var uuid string
+		err = results.Scan(&uuid)
+		if err != nil {
+			return nil, err
+		}
+		uuids = append(uuids, uuid)
+	}
+	return uuids, nil
+}
+
+func (s *mysqlStore) getScheduleInfo(ctx context.Context, scheduleId int) (name string, gameId string, datetime time.Time, err error) {
+	err = db.QueryRowContext(ctx, "SELECT name, game, datetime FROM schedules WHERE id = ?", scheduleId).Scan(&name, &gameId, &datetime)
+	return
+}
+
+func (s *mysqlStore) cancelSchedule(ctx context.Context, uuid string, mod bool, scheduleId int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM schedules WHERE id = (SELECT id FROM schedules WHERE id = ? AND (? OR ownerUuid = ?))", scheduleId, mod, uuid)
+	return err
+}
+
+func (s *mysqlStore) deleteDoneSchedules(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM schedules WHERE datetime < NOW() AND NOT recurring AND game = ?", getConfig().gameName)
+	return err
+}
+
+func (s *mysqlStore) advanceRecurringSchedules(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, `
+UPDATE schedules
+SET datetime = CASE intervalType
+    WHEN 'days' THEN DATE_ADD(datetime, INTERVAL intervalValue DAY)
+    WHEN 'months' THEN DATE_ADD(datetime, INTERVAL intervalValue MONTH)
+    WHEN 'years' THEN DATE_ADD(datetime, INTERVAL intervalValue YEAR)
+    ELSE datetime
+END WHERE recurring AND datetime < NOW() AND game = ?`, getConfig().gameName)
+	return err
+}
+
+// chat
+
+func (s *mysqlStore) writeChatMessages(ctx context.Context, messages []ChatMessageWrite) error {
+	query := "INSERT INTO chatMessages (msgId, game, uuid, mapId, prevMapId, prevLocations, x, y, contents) VALUES " +
+		strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?), ", len(messages)-1) + "(?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	args := make([]any, 0, len(messages)*9)
+	for _, msg := range messages {
+		args = append(args, msg.msgId, getConfig().gameName, msg.uuid, msg.mapId, msg.prevMapId, msg.prevLocations, msg.x, msg.y, msg.contents)
+	}
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *mysqlStore) writePartyChatMessage(ctx context.Context, msg ChatMessageWrite, partyId int) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO chatMessages (msgId, game, uuid, mapId, prevMapId, prevLocations, x, y, contents, partyId) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", msg.msgId, getConfig().gameName, msg.uuid, msg.mapId, msg.prevMapId, msg.prevLocations, msg.x, msg.y, msg.contents, partyId)
+	return err
+}
+
+func (s *mysqlStore) setPlayerLastChatMessage(ctx context.Context, uuid string, lastMsgId string, party bool) error {
+	query := "UPDATE playerGameData SET "
+
+	if party {
+		query += "lastPartyMsgId"
+	} else {
+		query += "lastGlobalMsgId"
+	}
+
+	query += " = ? WHERE uuid = ? AND game = ?"
+
+	_, err := db.ExecContext(ctx, query, lastMsgId, uuid, getConfig().gameName)
+	return err
+}
+
+func (s *mysqlStore) getChatMessageHistory(ctx context.Context, partyId int, globalMsgLimit int, partyMsgLimit int, lastMsgId string) (*ChatHistory, error) {
+	var chatHistory ChatHistory
+
+	var query string
+
+	selectClause := "SELECT cm.msgId, cm.uuid, cm.mapId, cm.prevMapId, cm.prevLocations, cm.x, cm.y, cm.contents, cm.timestamp, "
+	globalSelectClause := selectClause + "0"
+	partySelectClause := selectClause + "1"
+
+	fromClause := " FROM chatMessages cm JOIN players pd ON pd.uuid = cm.uuid JOIN playerGameData pgd ON pgd.uuid = pd.uuid AND pgd.game = cm.game "
+
+	whereClause := "WHERE cm.game = ? AND pd.banned = 0"
+
+	if lastMsgId != "" {
+		whereClause += " AND cm.timestamp > (SELECT cm2.timestamp FROM chatMessages cm2 WHERE cm2.msgId = ?)"
+	}
+
+	globalWhereClause := whereClause + " AND cm.partyId IS NULL AND (pgd.lastGlobalMsgId IS NULL OR cm.timestamp > (SELECT cmg.timestamp FROM chatMessages cmg WHERE cmg.msgId = pgd.lastGlobalMsgId)) ORDER BY 9 DESC"
+	partyWhereClause := whereClause + " AND cm.partyId = ? AND (pgd.lastPartyMsgId IS NULL OR cm.timestamp > (SELECT cmp.timestamp FROM chatMessages cmp WHERE cmp.msgId = pgd.lastPartyMsgId)) ORDER BY 9 DESC"
+
+	var messageQueryArgs []interface{}
+
+	messageQueryArgs = append(messageQueryArgs, getConfig().gameName)
+
+	if lastMsgId != "" {
+		messageQueryArgs = append(messageQueryArgs, lastMsgId)
+	}
+
+	messageQueryArgs = append(messageQueryArgs, globalMsgLimit)
+
+	query += "("
+
+	if partyId == 0 {
+		query += globalSelectClause + fromClause + globalWhereClause + " LIMIT ?"
+	} else {
+		messageQueryArgs = append(messageQueryArgs, getConfig().gameName)
+
+		if lastMsgId != "" {
+			messageQueryArgs = append(messageQueryArgs, lastMsgId)
+		}
+
+		messageQueryArgs = append(messageQueryArgs, partyId, partyMsgLimit)
+
+		query += globalSelectClause + fromClause + globalWhereClause + " LIMIT ?) UNION (" + partySelectClause + fromClause + partyWhereClause + " LIMIT ?"
+	}
+
+	query += ") ORDER BY 9"
+
+	messageResults, err := db.QueryContext(ctx, query, messageQueryArgs...)
+	if err != nil {
+		return &chatHistory, err
+	}
+
+	defer messageResults.Close()
+
+	for messageResults.Next() {
+		var chatMessage ChatMessage
+
+		err := messageResults.Scan(&chatMessage.MsgId, &chatMessage.Uuid, &chatMessage.MapId, &chatMessage.PrevMapId, &chatMessage.PrevLocations, &chatMessage.X, &chatMessage.Y, &chatMessage.Contents, &chatMessage.Timestamp, &chatMessage.Party)
+		if err != nil {
+			return &chatHistory, err
+		}
+
+		chatHistory.Messages = append(chatHistory.Messages, &chatMessage)
+	}
+
+	var firstTimestamp time.Time
+	var lastTimestamp time.Time
+
+	if len(chatHistory.Messages) != 0 {
+		firstTimestamp = chatHistory.Messages[0].Timestamp
+		lastTimestamp = chatHistory.Messages[len(chatHistory.Messages)-1].Timestamp
+	}
+
+	playersQuery := "SELECT DISTINCT pd.uuid, COALESCE(a.user, pgd.name), pd.rank, CASE WHEN a.user IS NULL THEN 0 ELSE 1 END, COALESCE(a.badge, ''), pgd.systemName, pgd.medalCountBronze, pgd.medalCountSilver, pgd.medalCountGold, pgd.medalCountPlatinum, pgd.medalCountDiamond FROM players pd JOIN playerGameData pgd ON pgd.uuid = pd.uuid LEFT JOIN accounts a ON a.uuid = pd.uuid WHERE pgd.game = ? AND EXISTS (SELECT cm.uuid FROM chatMessages cm WHERE cm.uuid = pd.uuid AND cm.game = pgd.game AND cm.timestamp BETWEEN ? AND ? "
+
+	var playerQueryArgs []interface{}
+
+	playerQueryArgs = append(playerQueryArgs, getConfig().gameName, firstTimestamp, lastTimestamp)
+
+	if partyId == 0 {
+		playersQuery += "AND cm.partyId IS NULL"
+	} else {
+		playersQuery += "AND (cm.partyId IS NULL OR cm.partyId = ?)"
+
+		playerQueryArgs = append(playerQueryArgs, partyId)
+	}
+
+	playersQuery += ")"
+
+	playerResults, err := db.QueryContext(ctx, playersQuery, playerQueryArgs...)
+	if err != nil {
+		return &chatHistory, err
+	}
+
+	defer playerResults.Close()
+
+	for playerResults.Next() {
+		var chatPlayer ChatPlayer
+
+		err := playerResults.Scan(&chatPlayer.Uuid, &chatPlayer.Name, &chatPlayer.Rank, &chatPlayer.Account, &chatPlayer.Badge, &chatPlayer.SystemName, &chatPlayer.Medals[0], &chatPlayer.Medals[1], &chatPlayer.Medals[2], &chatPlayer.Medals[3], &chatPlayer.Medals[4])
+		if err != nil {
+			return &chatHistory, err
+		}
+
+		chatHistory.Players = append(chatHistory.Players, &chatPlayer)
+	}
+
+	return &chatHistory, nil
+}
+
+func (s *mysqlStore) getChatMessageContents(ctx context.Context, msgId string, uuid string) (contents string, err error) {
+	err = db.QueryRowContext(ctx, "SELECT contents FROM chatMessages WHERE msgId = ? AND uuid = ? AND game = ?", msgId, uuid, getConfig().gameName).Scan(&contents)
+	return
+}
+
+func (s *mysqlStore) deleteOldChatMessages(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM chatMessages WHERE timestamp < DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 DAY)")
+	return err
+}
+
+// locations
+
+func (s *mysqlStore) getGameLocation(ctx context.Context, title string) (gameLocation GameLocation, err error) {
+	var mapIdsJson []byte
+	err = db.QueryRowPrepared(ctx, "SELECT id, game, title, mapIds FROM gameLocations WHERE title = ? AND game = ?", title, getConfig().gameName).Scan(&gameLocation.Id, &gameLocation.Game, &gameLocation.Name, &mapIdsJson)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(mapIdsJson, &gameLocation.MapIds)
+	return
+}
+
+func (s *mysqlStore) getGameLocations(ctx context.Context) (locations []*Location, err error) {
+	results, err := db.QueryContext(ctx, "SELECT id, title, depth, minDepth, secret FROM gameLocations WHERE game = ?", getConfig().gameName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		location := &Location{}
+		err = results.Scan(&location.Id, &location.Title, &location.Depth, &location.MinDepth, &location.Secret)
+		if err != nil {
+			return nil, err
+		}
+
+		locations = append(locations, location)
+	}
+
+	return locations, nil
+}
+
+func (s *mysqlStore) createGameLocation(ctx context.Context, title string, titleJP string, depth int, minDepth int, mapIds []string) (id int, err error) {
+	mapIdsJson, err := json.Marshal(mapIds)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := db.ExecContext(ctx, "INSERT INTO gameLocations (game, title, titleJP, depth, minDepth, mapIds) VALUES (?, ?, ?, ?, ?, ?)", getConfig().gameName, title, titleJP, depth, minDepth, mapIdsJson)
+	if err != nil {
+		return 0, err
+	}
+
+	locationId, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(locationId), nil
+}
+
+func (s *mysqlStore) updateGameLocation(ctx context.Context, id int, title string, titleJP string, depth int, minDepth int, mapIds []string) error {
+	mapIdsJson, err := json.Marshal(mapIds)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "UPDATE gameLocations SET title = ?, titleJP = ?, depth = ?, minDepth = ?, mapIds = ? WHERE id = ?", title, titleJP, depth, minDepth, mapIdsJson, id)
+	return err
+}
+
+func (s *mysqlStore) writePlayerGameLocations(ctx context.Context, locations []GameLocationWrite) error {
+	query := "INSERT IGNORE INTO playerGameLocations (uuid, locationId, timestamp) VALUES " +
+		strings.Repeat("(?, ?, UTC_TIMESTAMP()), ", len(locations)-1) + "(?, ?, UTC_TIMESTAMP())"
+
+	args := make([]any, 0, len(locations)*2)
+	for _, location := range locations {
+		args = append(args, location.uuid, location.locationId)
+	}
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *mysqlStore) getPlayerGameLocationIds(ctx context.Context, uuid string, gameId string) (locationIds []int, err error) {
+	results, err := db.QueryContext(ctx, "SELECT gl.id FROM playerGameLocations pgl JOIN gameLocations gl ON gl.id = pgl.locationId AND gl.game = ? WHERE pgl.uuid = ?", gameId, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var locationId int
+		err = results.Scan(&locationId)
+		if err != nil {
+			return nil, err
+		}
+
+		locationIds = append(locationIds, locationId)
+	}
+
+	return locationIds, nil
+}
+
+func (s *mysqlStore) getPlayerGameLocationCompletion(ctx context.Context, uuid string, gameId string) (gameLocationCompletion int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT FLOOR(COUNT(*) / (SELECT COUNT(*) FROM gameLocations WHERE game = ? AND secret = 0) * 100) FROM playerGameLocations pgl JOIN gameLocations gl ON gl.id = pgl.locationId WHERE gl.game = ? and gl.secret = 0 AND pgl.uuid = ?", gameId, gameId, uuid).Scan(&gameLocationCompletion)
+	return
+}
+
+func (s *mysqlStore) getPlayerMissingGameLocationNames(ctx context.Context, uuid string, locationNames []string) ([]string, error) {
+	if len(locationNames) == 0 {
+		return nil, nil
+	}
+
+	queryArgs := []any{getConfig().gameName}
+	for _, locationName := range locationNames {
+		queryArgs = append(queryArgs, locationName)
+	}
+	queryArgs = append(queryArgs, uuid)
+
+	return queryLocationNames(ctx, "SELECT gl.title FROM gameLocations gl WHERE gl.game = ? AND gl.title IN (?"+strings.Repeat(", ?", len(locationNames)-1)+") AND NOT EXISTS (SELECT * FROM playerGameLocations pgl WHERE pgl.uuid = ? AND pgl.locationId = gl.id)", queryArgs...)
+}
+
+func (s *mysqlStore) getPlayerAllMissingGameLocationNames(ctx context.Context, uuid string) ([]string, error) {
+	return queryLocationNames(ctx, "SELECT gl.title FROM gameLocations gl WHERE gl.game = ? AND gl.secret = 0 AND NOT EXISTS (SELECT * FROM playerGameLocations pgl WHERE pgl.uuid = ? AND pgl.locationId = gl.id)", getConfig().gameName, uuid)
+}
+
+func queryLocationNames(ctx context.Context, query string, args ...any) (locationNames []string, err error) {
+	results, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var locationName string
+		err = results.Scan(&locationName)
+		if err != nil {
+			return nil, err
+		}
+
+		locationNames = append(locationNames, locationName)
+	}
+
+	return locationNames, nil
+}
+
+// records
+
+func (s *mysqlStore) getPlayerTags(ctx context.Context, uuid string) (tags []string, lastUnlocked time.Time, err error) {
+	results, err := db.QueryContext(ctx, "SELECT name, timestampUnlocked FROM playerTags WHERE uuid = ?", uuid)
+	if err != nil {
+		return nil, lastUnlocked, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var tagName string
+		var timestamp time.Time
+		err := results.Scan(&tagName, &timestamp)
+		if err != nil {
+			return nil, lastUnlocked, err
+		}
+		tags = append(tags, tagName)
+		if timestamp.After(lastUnlocked) {
+			lastUnlocked = timestamp
+		}
+	}
+
+	return tags, lastUnlocked, nil
+}
+
+func (s *mysqlStore) writePlayerTag(ctx context.Context, uuid string, name string) error {
+	_, err := db.ExecPrepared(ctx, "INSERT INTO playerTags (uuid, name, timestampUnlocked) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE name = name", uuid, name, time.Now())
+	return err
+}
+
+func (s *mysqlStore) getPlayerTimeTrialRecords(ctx context.Context, uuid string) (timeTrialRecords []*TimeTrialRecord, err error) {
+	results, err := db.QueryContext(ctx, "SELECT mapId, MIN(seconds) FROM playerTimeTrials WHERE uuid = ? GROUP BY mapId", uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		var timeTrialRecord TimeTrialRecord
+
+		err := results.Scan(&timeTrialRecord.MapId, &timeTrialRecord.Seconds)
+		if err != nil {
+			return nil, err
+		}
+
+		timeTrialRecords = append(timeTrialRecords, &timeTrialRecord)
+	}
+
+	return timeTrialRecords, nil
+}
+
+func (s *mysqlStore) writePlayerTimeTrial(ctx context.Context, uuid string, mapId int, seconds int) (bool, error) {
+	var prevSeconds int
+	err := db.QueryRowContext(ctx, "SELECT seconds FROM playerTimeTrials WHERE uuid = ? AND mapId = ?", uuid, mapId).Scan(&prevSeconds)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return false, err
+		}
+	} else if seconds >= prevSeconds {
+		return false, nil
+	} else {
+		_, err = db.ExecContext(ctx, "UPDATE playerTimeTrials SET seconds = ?, timestampCompleted = ? WHERE uuid = ? AND mapId = ?", seconds, time.Now(), uuid, mapId)
+		return err == nil, err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO playerTimeTrials (uuid, mapId, seconds, timestampCompleted) VALUES (?, ?, ?, ?)", uuid, mapId, seconds, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *mysqlStore) getPlayerMinigameScore(ctx context.Context, uuid string, minigameId string) (score int, err error) {
+	err = db.QueryRowContext(ctx, "SELECT score FROM playerMinigameScores WHERE uuid = ? AND minigameId = ?", uuid, minigameId).Scan(&score)
+	return
+}
+
+func (s *mysqlStore) writePlayerMinigameScore(ctx context.Context, uuid string, minigameId string, score int) (bool, error) {
+	prevScore, err := s.getPlayerMinigameScore(ctx, uuid, minigameId)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return false, err
+		}
+	} else if score <= prevScore {
+		return false, nil
+	} else {
+		_, err = db.ExecContext(ctx, "UPDATE playerMinigameScores SET score = ?, timestampCompleted = ? WHERE uuid = ? AND game = ? AND minigameId = ?", score, time.Now(), uuid, getConfig().gameName, minigameId)
+		return err == nil, err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO playerMinigameScores (uuid, game, minigameId, score, timestampCompleted) VALUES (?, ?, ?, ?, ?)", uuid, getConfig().gameName, minigameId, score, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// moderation
+
+func (s *mysqlStore) writeModAction(ctx context.Context, uuid string, action int, reason string, expiry time.Time) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO playerModerationActions (uuid, action, reason, time, expiry) VALUES (?, ?, ?, NOW(), ?)", uuid, action, reason, expiry)
+	return err
+}
+
+func (s *mysqlStore) getModActionExpiries(ctx context.Context) (map[ModAction]time.Time, error) {
+	rows, err := db.QueryContext(ctx, "SELECT uuid, action, expiry FROM playerModerationActions WHERE expiry > NOW()")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	expiries := make(map[ModAction]time.Time)
+	for rows.Next() {
+		var modAction ModAction
+		var expiry time.Time
+		err = rows.Scan(&modAction.uuid, &modAction.action, &expiry)
+		if err != nil {
+			return nil, err
+		}
+
+		// an action given again lasts until the latest expiry
+		if expiry.After(expiries[modAction]) {
+			expiries[modAction] = expiry
+		}
+	}
+
+	return expiries, nil
+}
+
+func (s *mysqlStore) deleteModAction(ctx context.Context, uuid string, action int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM playerModerationActions WHERE action = ? AND uuid = ?", action, uuid)
+	return err
+}
+
+func (s *mysqlStore) writeReport(ctx context.Context, uuid string, targetUuid string, msgId string, reason string, originalMsg string) error {
+	var msgIdLink *string
+	if msgId != "" {
+		msgIdLink = &msgId
+	}
+
+	_, err := db.ExecContext(ctx, `
+REPLACE INTO playerReports
+	(uuid, targetUuid, msgId, game, reason, originalMsg, timestampReported, actionTaken)
+VALUES
+	(?, ?, ?, ?, ?, ?, NOW(), 0)`,
+		uuid, targetUuid, msgIdLink, getConfig().gameName, reason, originalMsg)
+	return err
+}
+
+func (s *mysqlStore) getReportReasonCounts(ctx context.Context, targetUuid string) (map[string]int, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT reason, COUNT(*) FROM playerReports
+WHERE targetUuid = ? AND NOT actionTaken
+GROUP BY reason`, targetUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	reasons := make(map[string]int)
+	for rows.Next() {
+		var reason string
+		var count int
+		err := rows.Scan(&reason, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		reasons[reason] = count
+	}
+
+	return reasons, nil
+}
+
+func (s *mysqlStore) getReporters(ctx context.Context, targetUuid string, msgId string) (map[string]string, error) {
+	var msgIdLink *string
+	if msgId != "" {
+		msgIdLink = &msgId
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT pgd.name, pr.reason FROM playerReports pr
+		JOIN playerGameData pgd ON pgd.uuid = pr.uuid
+		WHERE pr.targetUuid = ? AND pr.msgId = ? AND NOT actionTaken`, targetUuid, msgIdLink)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	reporters := make(map[string]string)
+	for rows.Next() {
+		var reporter string
+		var reason string
+		err = rows.Scan(&reporter, &reason)
+		if err != nil {
+			return nil, err
+		}
+
+		reporters[reporter] = reason
+	}
+
+	return reporters, nil
+}
+
+func (s *mysqlStore) resolveReports(ctx context.Context, targetUuid string) error {
+	_, err := db.ExecContext(ctx, "UPDATE playerReports SET actionTaken = 1 WHERE targetUuid = ?", targetUuid)
+	return err
+}
+
+func (s *mysqlStore) getPlayerModInfo(ctx context.Context, player string) (name string, uuid string, banned bool, muted bool, onlineGames []string, err error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT
+	pgd.name, pgd.uuid, pgd.game, pgd.online, players.banned, players.muted
+FROM playerGameData pgd
+JOIN players ON players.uuid = pgd.uuid
+WHERE pgd.name = ? OR pgd.uuid = ?`, player, player)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var game string
+		var online bool
+		err = rows.Scan(&name, &uuid, &game, &online, &banned, &muted)
+		if err != nil {
+			return
+		}
+		if online {
+			onlineGames = append(onlineGames, game)
+		}
+	}
+
+	return
+}
+
+// notifications
+
+func (s *mysqlStore) addPushSubscription(ctx context.Context, uuid string, sub *webpush.Subscription) error {
+	_, err := db.ExecContext(ctx, "INSERT IGNORE INTO pushSubscriptions (uuid, endpoint, p256dh, auth) VALUES (?, ?, ?, ?)", uuid, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth)
+	return err
+}
+
+func (s *mysqlStore) removePushSubscription(ctx context.Context, uuid string, endpoint string) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM pushSubscriptions WHERE uuid = ? AND endpoint = ?", uuid, endpoint)
+	return err
+}
+
+func (s *mysqlStore) getPushSubscriptions(ctx context.Context, uuids []string) (subs []*webpush.Subscription, err error) {
+	query := "SELECT endpoint, p256dh, auth FROM pushSubscriptions"
+
+	var args []any
+	if len(uuids) != 0 {
+		query += " WHERE uuid IN (?" + strings.Repeat(", ?", len(uuids)-1) + ")"
+		for _, uuid := range uuids {
+			args = append(args, uuid)
+		}
+	}
+
+	results, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		sub := &webpush.Subscription{}
+		err = results.Scan(&sub.Endpoint, &sub.Keys.P256dh, &sub.Keys.Auth)
+		if err != nil {
+			return nil, err
+		}
+
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
+// api cache
+
+func (s *mysqlStore) get2kkiApiQuery(ctx context.Context, action string, query string) (response string, err error) {
+	err = db.QueryRowContext(ctx, "SELECT response FROM 2kkiApiQueries WHERE action = ? AND query = ? AND NOW() < timestampExpired", action, query).Scan(&response)
+	return
+}
+
+func (s *mysqlStore) write2kkiApiQuery(ctx context.Context, action string, query string, response string) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO 2kkiApiQueries (action, query, response, timestampExpired) VALUES (?, ?, ?, DATE_ADD(NOW(), INTERVAL 1 HOUR)) ON DUPLICATE KEY UPDATE response = ?, timestampExpired = DATE_ADD(NOW(), INTERVAL 1 HOUR)", action, query, response, response)
+	return err
+}
+
+func (s *mysqlStore) getWikiApiQuery(ctx context.Context, action string, query string) (response string, err error) {
+	err = db.QueryRowContext(ctx, "SELECT response FROM wikiApiQueries WHERE game = ? AND action = ? AND query = ? AND NOW() < timestampExpired", getConfig().gameName, action, query).Scan(&response)
+	return
+}
+
+func (s *mysqlStore) writeWikiApiQuery(ctx context.Context, action string, query string, response string) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO wikiApiQueries (game, action, query, response, timestampExpired) VALUES (?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL 1 HOUR)) ON DUPLICATE KEY UPDATE response = ?, timestampExpired = DATE_ADD(NOW(), INTERVAL 12 HOUR)", getConfig().gameName, action, query, response, response)
+	return err
+}
+
+func (s *mysqlStore) cleanupApiQueries(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM 2kkiApiQueries WHERE timestampExpired < NOW()")
+	return err
+}
+
+// rowsAffected reports whether a statement changed anything
+func rowsAffected(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affectedRows > 0, nil
+}
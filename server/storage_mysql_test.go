@@ -0,0 +1,52 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+// the test server runs on memory storage, so the batch queries are only checked as sql
+func TestPlayerGameActivitiesQuery(t *testing.T) {
+	const single = "UPDATE playerGameData pgd JOIN (" +
+		"SELECT ? AS uuid, ? AS name, ? AS systemName, ? AS spriteName, ? AS spriteIndex, ? AS online" +
+		") a ON a.uuid = pgd.uuid " +
+		"SET pgd.name = a.name, pgd.systemName = a.systemName, pgd.spriteName = a.spriteName, pgd.spriteIndex = a.spriteIndex, pgd.online = a.online, pgd.timestampLastActive = UTC_TIMESTAMP() " +
+		"WHERE pgd.game = ?"
+
+	if query := getPlayerGameActivitiesQuery(1); query != single {
+		t.Errorf("got %q for one row, want %q", query, single)
+	}
+
+	const rows = 3
+	query := getPlayerGameActivitiesQuery(rows)
+
+	if !strings.Contains(query, "JOIN (SELECT ? AS uuid,") {
+		t.Errorf("first select doesn't name the columns: %q", query)
+	}
+	if n := strings.Count(query, " AS "); n != 6 {
+		t.Errorf("%d aliases, want 6", n)
+	}
+	if n := strings.Count(query, "UNION ALL SELECT ?, ?, ?, ?, ?, ?"); n != rows-1 {
+		t.Errorf("%d unions, want %d", n, rows-1)
+	}
+	if n := strings.Count(query, "?"); n != rows*6+1 {
+		t.Errorf("%d placeholders, want %d", n, rows*6+1)
+	}
+}
@@ -30,17 +30,13 @@ func initUnconscious() {
 	scheduler.CronWithSeconds("58 */1 * * * *").Do(func() {
 		randint = rand.IntN(256)
 		time := getUnconsciousTime()
-		for _, client := range clients.Get() {
-			if client.roomC == nil {
-				continue
+		msg := buildMsg("cut", time, randint)
+		clients.Range(func(client *SessionClient) bool {
+			if client.roomC != nil {
+				client.roomC.outbox.send(msg)
 			}
-
-			select {
-			case client.roomC.outbox <- buildMsg("cut", time, randint):
-			default:
-				writeErrLog(client.uuid, client.roomC.mapId, "send channel is full")
-			}
-		}
+			return true
+		})
 	})
 	scheduler.CronWithSeconds("58 */2 * * * *").Do(func() {
 		temperature += weatherDelta(temperature)
@@ -48,17 +44,13 @@ func initUnconscious() {
 
 		tempValue := max(-100, min(100, temperature))
 		precipValue := max(0, min(100, precipitation))
-		for _, client := range clients.Get() {
-			if client.roomC == nil {
-				continue
+		msg := buildMsg("cuw", tempValue, precipValue)
+		clients.Range(func(client *SessionClient) bool {
+			if client.roomC != nil {
+				client.roomC.outbox.send(msg)
 			}
-
-			select {
-			case client.roomC.outbox <- buildMsg("cuw", tempValue, precipValue):
-			default:
-				writeErrLog(client.uuid, client.roomC.mapId, "send channel is full")
-			}
-		}
+			return true
+		})
 	})
 }
 
@@ -123,8 +115,8 @@ func didJoinRoomWsUnconscious(c *RoomClient) {
 		return
 	}
 
-	c.outbox <- buildMsg("cut", getUnconsciousTime(), randint)
-	c.outbox <- buildMsg("cuw", temperature, precipitation)
+	c.outbox.send(buildMsg("cut", getUnconsciousTime(), randint))
+	c.outbox.send(buildMsg("cuw", temperature, precipitation))
 }
 
 func didJoinRoomUnconscious(c *RoomClient) {
@@ -132,5 +124,5 @@ func didJoinRoomUnconscious(c *RoomClient) {
 		return
 	}
 
-	c.outbox <- buildMsg("ssv", unconsciousEventsVar, getUnconsciousEvents())
+	c.outbox.send(buildMsg("ssv", unconsciousEventsVar, getUnconsciousEvents()))
 }
@@ -34,7 +34,15 @@ func setWordFilter() error {
 		return err
 	}
 
-	wordFilter = regex
+	wordFilter.Store(regex)
 
 	return nil
 }
+
+// filterWords replaces the words in filterwords.txt
+func filterWords(msg string) string {
+	if filter := wordFilter.Load(); filter != nil {
+		return filter.ReplaceAllString(msg, ":2kkiSign:")
+	}
+	return msg
+}
@@ -0,0 +1,203 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// how long game activity updates wait for room in a full queue, see updatePlayerGameActivity
+const gameActivityWait = time.Second
+
+// Writes made while handling client messages are queued and written in
+// the background, several rows per statement, so that a slow database
+// doesn't hold up the reader goroutines.
+var (
+	chatMessageQueue  *WriteQueue[ChatMessageWrite]
+	gameLocationQueue *WriteQueue[GameLocationWrite]
+	gameActivityQueue *WriteQueue[GameActivityWrite]
+)
+
+var (
+	// orders game activity updates, see writeQueuedGameActivities
+	gameActivitySeq atomic.Uint64
+
+	// uuid -> seq of the last activity written without the queue
+	directGameActivities = struct {
+		seqs  map[string]uint64
+		mutex sync.Mutex
+	}{
+		seqs: make(map[string]uint64),
+	}
+)
+
+type ChatMessageWrite struct {
+	msgId, uuid, mapId, prevMapId, prevLocations string
+	x, y                                         int
+	contents                                     string
+}
+
+type GameLocationWrite struct {
+	uuid       string
+	locationId int
+}
+
+type GameActivityWrite struct {
+	activity PlayerGameActivity
+	seq      uint64
+}
+
+// WriteQueue hands queued items to write in batches of up to maxBatch,
+// at most maxDelay after the first item of a batch was queued
+type WriteQueue[T any] struct {
+	name     string
+	items    chan T
+	write    func(items []T) error
+	maxBatch int
+	maxDelay time.Duration
+
+	// adding holds stopMutex for reading so that close can't stop
+	// the queue between an add seeing it running and queueing the item
+	stopped   bool
+	stopMutex sync.RWMutex
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func newWriteQueue[T any](name string, write func(items []T) error) *WriteQueue[T] {
+	q := &WriteQueue[T]{
+		name:     name,
+		items:    make(chan T, getConfig().writeQueue.size),
+		write:    write,
+		maxBatch: getConfig().writeQueue.maxBatch,
+		maxDelay: getConfig().writeQueue.maxDelay,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go q.run()
+
+	return q
+}
+
+func initWriteQueues() {
+	chatMessageQueue = newWriteQueue("chat messages", writeGlobalChatMessages)
+	gameLocationQueue = newWriteQueue("game locations", writePlayerGameLocations)
+	gameActivityQueue = newWriteQueue("game activity", writeQueuedGameActivities)
+}
+
+// stopWriteQueues writes everything still queued and stops the queues
+func stopWriteQueues() {
+	chatMessageQueue.close()
+	gameLocationQueue.close()
+	gameActivityQueue.close()
+}
+
+// add queues item, waiting for room when the queue is full until ctx is done
+func (q *WriteQueue[T]) add(ctx context.Context, item T) error {
+	q.stopMutex.RLock()
+	if q.stopped {
+		q.stopMutex.RUnlock()
+
+		// nothing writes the queue anymore, so write it now
+		return q.write([]T{item})
+	}
+	defer q.stopMutex.RUnlock()
+
+	select {
+	case q.items <- item:
+		return nil
+	default:
+	}
+
+	metrics.writeQueueWaits.inc(q.name)
+
+	// the queue keeps being written until close gets the lock
+	select {
+	case q.items <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *WriteQueue[T]) close() {
+	q.stopMutex.Lock()
+	stopped := q.stopped
+	q.stopped = true
+	q.stopMutex.Unlock()
+
+	if stopped {
+		return
+	}
+
+	close(q.stop)
+	<-q.done
+}
+
+func (q *WriteQueue[T]) run() {
+	defer close(q.done)
+
+	batch := make([]T, 0, q.maxBatch)
+	var deadline <-chan time.Time
+
+	for {
+		select {
+		case item := <-q.items:
+			batch = append(batch, item)
+			if len(batch) == 1 {
+				deadline = time.After(q.maxDelay)
+			}
+			if len(batch) < q.maxBatch {
+				continue
+			}
+		case <-deadline:
+		case <-q.stop:
+			for len(q.items) != 0 {
+				batch = append(batch, <-q.items)
+				if len(batch) == q.maxBatch {
+					q.flush(batch)
+					batch = batch[:0]
+				}
+			}
+
+			if len(batch) != 0 {
+				q.flush(batch)
+			}
+			return
+		}
+
+		q.flush(batch)
+		clear(batch)
+		batch = batch[:0]
+		deadline = nil
+	}
+}
+
+func (q *WriteQueue[T]) flush(batch []T) {
+	start := time.Now()
+
+	if err := q.write(batch); err != nil {
+		eprintf("db", "failed to write %d queued %s: %s", len(batch), q.name, err)
+	}
+
+	metrics.writeQueueFlushes.observe(q.name, time.Since(start))
+}
@@ -0,0 +1,108 @@
+/*
+	Copyright (C) 2021-2024  The YNOproject Developers
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// TestWriteQueueClose adds while the queue is closed, nothing may get lost
+func TestWriteQueueClose(t *testing.T) {
+	const (
+		writers = 8
+		items   = 1000
+	)
+
+	var mutex sync.Mutex
+	var written int
+	q := newWriteQueue("test", func(batch []int) error {
+		mutex.Lock()
+		written += len(batch)
+		mutex.Unlock()
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range items {
+				if err := q.add(context.Background(), i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	q.close()
+	wg.Wait()
+
+	if written != writers*items {
+		t.Errorf("wrote %d items, want %d", written, writers*items)
+	}
+}
+
+// TestGameActivitySuperseded checks that queued activity older than
+// a direct write doesn't overwrite it when the queue is flushed
+func TestGameActivitySuperseded(t *testing.T) {
+	const uuid = "activitytest"
+
+	memory, ok := store.players.(*memoryStore)
+	if !ok {
+		t.Skip("not using the memory store")
+	}
+
+	if err := memory.addOrUpdatePlayerGameData(context.Background(), uuid); err != nil {
+		t.Fatal(err)
+	}
+
+	isOnline := func() bool {
+		memory.mu.Lock()
+		defer memory.mu.Unlock()
+		return memory.getGameData(uuid, getConfig().gameName).online
+	}
+
+	if err := writeGameActivityDirectly(PlayerGameActivity{Uuid: uuid}, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeQueuedGameActivities([]GameActivityWrite{{PlayerGameActivity{Uuid: uuid, Online: true}, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if isOnline() {
+		t.Error("update queued before going offline was written after it")
+	}
+
+	if err := writeQueuedGameActivities([]GameActivityWrite{{PlayerGameActivity{Uuid: uuid, Online: true}, 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if !isOnline() {
+		t.Error("update queued after going offline was skipped")
+	}
+
+	directGameActivities.mutex.Lock()
+	defer directGameActivities.mutex.Unlock()
+	if _, ok := directGameActivities.seqs[uuid]; ok {
+		t.Error("direct write is still tracked")
+	}
+}